@@ -3,14 +3,25 @@ package admin
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
 	"esb-go-app/storage"
 )
 
+// appTokenGraceSetting is how many minutes the ID token replaced by a credentials rotation stays valid.
+var appTokenGraceSetting = storage.SettingDefinition{Key: "app_token_grace_minutes", Type: storage.SettingInt, Default: "60", Min: 0, Max: 10080}
+
 // AppRoutes handles routing for /admin/app/* paths.
 func AppRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET /admin/app
+	if r.Method == http.MethodGet && (len(parts) == 0 || (len(parts) == 1 && parts[0] == "")) {
+		h.handleListApps(w, r)
+		return
+	}
+
 	// POST /admin/app/create
 	if r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "create" {
 		h.handleCreateApp(w, r)
@@ -39,6 +50,12 @@ func AppRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []strin
 			return
 		}
 
+		// POST /admin/app/{id}/rotate
+		if r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "rotate" {
+			h.handleRotateAppCredentials(w, r, appID)
+			return
+		}
+
 		// Nested Channel routes: /admin/app/{id}/channel/*
 		if len(parts) > 2 && parts[1] == "channel" {
 			ChannelRoutes(h, w, r, appID, parts[2:]) // Pass remaining parts for channel routing
@@ -49,6 +66,29 @@ func AppRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []strin
 	http.NotFound(w, r)
 }
 
+// handleListApps lists the applications, filtered by name or ID, with the form creating one.
+func (h *Handler) handleListApps(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+
+	page := h.listPage(r)
+	apps, err := h.Store.GetAllApplications(page.Filter())
+	if err != nil {
+		h.renderError(w, "applications.html", fmt.Sprintf("Failed to retrieve applications: %v", err), http.StatusInternalServerError, r)
+		return
+	}
+
+	data := PageData{
+		Applications:   pageRows(page, apps),
+		ListPage:       page,
+		AcceptLanguage: lang,
+	}
+	if r.URL.Query().Get("status") == "created" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Application created successfully!")
+	}
+
+	h.renderTemplate(w, "applications.html", data)
+}
+
 // handleShowApp displays details for a specific application.
 func (h *Handler) handleShowApp(w http.ResponseWriter, r *http.Request, appID string) {
 	lang := h.determineLanguage(r)
@@ -59,34 +99,51 @@ func (h *Handler) handleShowApp(w http.ResponseWriter, r *http.Request, appID st
 		return
 	}
 
-	channels, err := h.Store.GetChannelsByAppID(appID)
+	data, err := h.appPageData(r, app, lang)
 	if err != nil {
 		h.renderError(w, "app_details.html", fmt.Sprintf("Failed to retrieve channels: %v", err), http.StatusInternalServerError, r)
 		return
 	}
 
-	data := PageData{Application: app, Channels: channels, AcceptLanguage: lang}
-
 	status := r.URL.Query().Get("status")
 	if status == "channel_created" {
 		data.StatusMessage = h.I18n.Sprintf(lang, "Channel created successfully.")
 	} else if status == "channel_deleted" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "Channel deleted.")
+		data.StatusMessage = h.I18n.Sprintf(lang, "Channel moved to the trash, where it can be restored.")
+	} else if status == "channel_topology_kept" {
+		data.ErrorMessage = h.I18n.Sprintf(lang, "Channel moved to the trash, but its queue and exchange could not be deleted from the broker. See the logs for details.")
+	} else if status == "credentials_rotated" {
+		if app.PreviousIDToken != "" {
+			data.StatusMessage = h.I18n.Sprintf(lang, "Credentials rotated. The previous ID token is accepted until %s.", app.PreviousIDTokenExpiresAt.Local().Format("2006-01-02 15:04:05"))
+		} else {
+			data.StatusMessage = h.I18n.Sprintf(lang, "Credentials rotated. The previous ID token is no longer accepted.")
+		}
 	}
 
 	h.renderTemplate(w, "app_details.html", data)
 }
 
+// appPageData prepares the details page of an application, with its channels filtered by tag.
+func (h *Handler) appPageData(r *http.Request, app *storage.Application, lang string) (PageData, error) {
+	channels, err := h.Store.GetChannelsByAppID(app.ID)
+	if err != nil {
+		return PageData{}, err
+	}
+	data := PageData{Application: app, BrokerConnections: h.RabbitMQ.ConnectionNames(), ChannelDefaults: h.loadChannelDefaults(), AcceptLanguage: lang}
+	data.Channels = filterTagged(r, &data, channels, func(ch storage.Channel) []string { return ch.Tags })
+	return data, nil
+}
+
 // handleCreateApp creates a new application.
 func (h *Handler) handleCreateApp(w http.ResponseWriter, r *http.Request) {
 	lang := h.determineLanguage(r)
 	if err := r.ParseForm(); err != nil {
-		h.renderError(w, "admin.html", "Failed to parse form.", http.StatusBadRequest, r)
+		h.renderError(w, "applications.html", "Failed to parse form.", http.StatusBadRequest, r)
 		return
 	}
 	appName := r.FormValue("name")
 	if appName == "" {
-		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Application name cannot be empty."), http.StatusBadRequest, r)
+		h.renderError(w, "applications.html", h.I18n.Sprintf(lang, "Application name cannot be empty."), http.StatusBadRequest, r)
 		return
 	}
 
@@ -95,15 +152,16 @@ func (h *Handler) handleCreateApp(w http.ResponseWriter, r *http.Request) {
 		Name:         appName,
 		ClientSecret: uuid.New().String(),
 		IDToken:      uuid.New().String(),
+		VHost:        strings.TrimSpace(r.FormValue("vhost")),
 	}
 
 	if err := h.Store.CreateApplication(app); err != nil {
-		h.renderError(w, "admin.html", fmt.Sprintf("Failed to create application: %v", err), http.StatusInternalServerError, r)
+		h.renderError(w, "applications.html", fmt.Sprintf("Failed to create application: %v", err), http.StatusInternalServerError, r)
 		return
 	}
 
 	h.Logger.Info("application created successfully", "app_name", app.Name, "app_id", app.ID)
-	http.Redirect(w, r, "/admin?status=created", http.StatusSeeOther)
+	http.Redirect(w, r, "/admin/app?status=created", http.StatusSeeOther)
 }
 
 // handleUpdateApp updates an application's details.
@@ -119,9 +177,21 @@ func (h *Handler) handleUpdateApp(w http.ResponseWriter, r *http.Request, appID
 		return
 	}
 
+	oldApp, err := h.Store.GetApplicationByID(appID)
+	if err != nil || oldApp == nil {
+		http.NotFound(w, r)
+		return
+	}
+	channels, err := h.Store.GetChannelsByAppID(appID)
+	if err != nil {
+		h.renderError(w, "app_details.html", fmt.Sprintf("Failed to retrieve channels: %v", err), http.StatusInternalServerError, r)
+		return
+	}
+
 	app := &storage.Application{
-		ID:   appID,
-		Name: appName,
+		ID:    appID,
+		Name:  appName,
+		VHost: strings.TrimSpace(r.FormValue("vhost")),
 	}
 
 	if err := h.Store.UpdateApplication(app); err != nil {
@@ -129,16 +199,63 @@ func (h *Handler) handleUpdateApp(w http.ResponseWriter, r *http.Request, appID
 		return
 	}
 
+	// Moving to another vhost declares the topology there and restarts the workers and routers of every channel.
+	// Messages still queued in the old vhost stay there.
+	if app.VHost != oldApp.VHost {
+		for i := range channels {
+			newCh := channels[i]
+			newCh.VHost = app.VHost
+			if err := h.restartChannelWorkers(&channels[i], &newCh); err != nil {
+				h.Logger.Error("failed to move channel to the new vhost", "error", err, "channel_id", newCh.ID, "vhost", app.VHost)
+				h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Application updated, but moving channel %s to the new vhost failed: %s", newCh.Name, err.Error()), http.StatusInternalServerError, r)
+				return
+			}
+		}
+		h.Logger.Info("application moved to vhost", "app_id", appID, "old_vhost", oldApp.VHost, "vhost", app.VHost)
+	}
+
 	h.Logger.Info("application updated successfully", "app_id", appID)
 	http.Redirect(w, r, fmt.Sprintf("/admin/app/%s?status=updated", appID), http.StatusSeeOther)
 }
 
+// handleRotateAppCredentials replaces the client secret and ID token of an application, keeping the previous
+// ID token valid for the grace period of the settings.
+func (h *Handler) handleRotateAppCredentials(w http.ResponseWriter, r *http.Request, appID string) {
+	app, err := h.Store.GetApplicationByID(appID)
+	if err != nil || app == nil {
+		http.NotFound(w, r)
+		return
+	}
+	graceMinutes, err := h.Store.GetIntSetting(appTokenGraceSetting)
+	if err != nil {
+		h.Logger.Error("failed to get token grace period setting", "error", err)
+	}
+	grace := time.Duration(graceMinutes) * time.Minute
+
+	if err := h.Store.RotateApplicationCredentials(appID, uuid.New().String(), uuid.New().String(), grace); err != nil {
+		h.renderError(w, "app_details.html", fmt.Sprintf("Failed to rotate credentials: %v", err), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("application credentials rotated", "app_id", appID, "grace", grace)
+	http.Redirect(w, r, fmt.Sprintf("/admin/app/%s?status=credentials_rotated", appID), http.StatusSeeOther)
+}
+
 // handleDeleteApp deletes an application.
 func (h *Handler) handleDeleteApp(w http.ResponseWriter, r *http.Request, appID string) {
+	channels, err := h.Store.GetChannelsByAppID(appID)
+	if err != nil {
+		h.Logger.Error("failed to get channels before application delete", "error", err, "app_id", appID)
+	}
+
 	if err := h.Store.DeleteApplication(appID); err != nil {
-		h.renderError(w, "admin.html", fmt.Sprintf("Failed to delete application: %v", err), http.StatusInternalServerError, r)
+		h.renderError(w, "applications.html", fmt.Sprintf("Failed to delete application: %v", err), http.StatusInternalServerError, r)
 		return
 	}
+
+	for i := range channels {
+		h.stopChannelWorkers(&channels[i])
+	}
 	h.Logger.Info("application deleted successfully", "app_id", appID)
-	http.Redirect(w, r, "/admin?status=deleted", http.StatusSeeOther)
+	http.Redirect(w, r, "/admin/app?status=deleted", http.StatusSeeOther)
 }
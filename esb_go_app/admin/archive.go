@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// ArchiveRoutes handles routing for /admin/archive.
+func ArchiveRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	// GET /admin/archive[?route=&outcome=&q=]
+	case len(parts) == 0 || (len(parts) == 1 && parts[0] == ""):
+		h.handleArchive(w, r)
+	// GET /admin/archive/{id}
+	case len(parts) == 1:
+		h.handleArchivedMessage(w, r, parts[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleArchive lists the archived messages matching the route, outcome and search term of the query.
+func (h *Handler) handleArchive(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	query := r.URL.Query()
+	data := PageData{
+		ArchiveSearch: storage.ArchiveSearch{
+			RouteID: query.Get("route"),
+			Outcome: query.Get("outcome"),
+			Term:    strings.TrimSpace(query.Get("q")),
+			Limit:   h.listSize(),
+		},
+		AcceptLanguage: lang,
+	}
+
+	routes, err := h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		h.renderError(w, "archive.html", h.I18n.Sprintf(lang, "Failed to get routes: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	data.Routes = routes
+
+	data.ArchivedMessages, err = h.Store.SearchArchive(data.ArchiveSearch)
+	if err != nil {
+		h.renderError(w, "archive.html", h.I18n.Sprintf(lang, "Failed to read the message archive: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.renderTemplate(w, "archive.html", data)
+}
+
+// handleArchivedMessage shows an archived message with its headers and bodies.
+func (h *Handler) handleArchivedMessage(w http.ResponseWriter, r *http.Request, idParam string) {
+	lang := h.determineLanguage(r)
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	msg, err := h.Store.GetArchivedMessage(id)
+	if err != nil {
+		h.renderError(w, "archive.html", h.I18n.Sprintf(lang, "Failed to read the message archive: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if msg == nil {
+		h.renderError(w, "archive.html", h.I18n.Sprintf(lang, "Archived message not found."), http.StatusNotFound, r)
+		return
+	}
+
+	data := PageData{
+		ArchivedMessage: msg,
+		AcceptLanguage:  lang,
+	}
+	if msg.Headers != "" {
+		_ = json.Unmarshal([]byte(msg.Headers), &data.ArchivedHeaders)
+	}
+	h.renderTemplate(w, "archive.html", data)
+}
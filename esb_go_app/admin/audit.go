@@ -0,0 +1,369 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// auditKinds maps the sections of the admin interface to the kind of object their requests change.
+// Requests of the other sections are recorded with the section as their kind.
+var auditKinds = map[string]string{
+	"app":             "application",
+	"routes":          "route",
+	"transformations": "transformation",
+	"libraries":       "library",
+	"sql-connections": "sql_connection",
+	"file-servers":    "file_server",
+	"collectors":      "collector",
+	"integrations":    "integration",
+	"trash":           "trash",
+	"dead-letters":    "dead_letter",
+}
+
+// auditUserHeaders are the request headers an authenticating proxy in front of the admin interface may
+// name its user in, in order of preference. Without one, the user of HTTP basic authentication is used.
+var auditUserHeaders = []string{"X-Forwarded-User", "X-Auth-Request-User", "X-Remote-User", "Remote-User"}
+
+// auditSecretKeys are the parts of field names whose values are masked in the audit log.
+var auditSecretKeys = []string{"secret", "password", "passphrase", "token", "privatekey", "dsn"}
+
+// auditResponseWriter keeps the status of the response for the audit entry.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// serveAudited serves a request that may change the configuration and records it in the audit log,
+// with the changed object as it was before and after the request.
+func (h *Handler) serveAudited(w http.ResponseWriter, r *http.Request) {
+	entry := &storage.AuditEntry{
+		Actor:      auditActor(r),
+		RemoteAddr: auditRemoteAddr(r),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin"), "/"), "/")
+	entry.Kind, entry.EntityID, entry.Action = auditTarget(parts)
+	entry.OldValue = h.auditSnapshot(entry.Kind, entry.EntityID)
+
+	recorder := &auditResponseWriter{ResponseWriter: w}
+	h.route(recorder, r)
+	entry.Status = recorder.status
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+
+	if entry.Status < http.StatusBadRequest {
+		entry.NewValue = h.auditSnapshot(entry.Kind, entry.EntityID)
+	}
+	if entry.NewValue == "" && entry.Action != "delete" && entry.Action != "purge" {
+		// Created objects and actions without an object are recorded with what was submitted.
+		entry.NewValue = auditForm(r)
+	}
+	if err := h.Store.RecordAudit(entry); err != nil {
+		h.Logger.Error("failed to record audit entry", "path", entry.Path, "error", err)
+	}
+}
+
+// auditTarget returns the kind, ID and action of the object a request changes, from the path below /admin.
+func auditTarget(parts []string) (kind, id, action string) {
+	section, rest := parts[0], parts[1:]
+	kind, ok := auditKinds[section]
+	if !ok {
+		kind = section
+		if len(rest) == 0 || rest[0] == "" {
+			return kind, "", "update"
+		}
+		return kind, "", strings.Join(rest, "/")
+	}
+	switch {
+	case section == "app" && len(rest) >= 3 && rest[1] == "channel":
+		// /admin/app/{appID}/channel/create or /admin/app/{appID}/channel/{channelID}/{action}
+		kind, rest = "channel", rest[2:]
+	case section == "transformations" && len(rest) == 2 && rest[0] == "update":
+		return kind, rest[1], "update"
+	}
+	switch len(rest) {
+	case 0:
+		return kind, "", ""
+	case 1:
+		return kind, "", rest[0]
+	default:
+		return kind, rest[0], strings.Join(rest[1:], "/")
+	}
+}
+
+// auditSnapshot returns an object as indented JSON with its secrets masked, or an empty string when the
+// object does not exist or its kind is not tracked.
+func (h *Handler) auditSnapshot(kind, id string) string {
+	var value interface{}
+	var err error
+	if kind == "settings" {
+		value, err = h.Store.GetAllSettings()
+	}
+	if id != "" {
+		switch kind {
+		case "application":
+			value, err = nonNil(h.Store.GetApplicationByID(id))
+		case "channel":
+			value, err = nonNil(h.Store.GetChannelByID(id))
+		case "route":
+			var route *storage.Route
+			if route, err = h.Store.GetRouteByID(id); err == nil && route != nil {
+				snapshot := ConfigRoute{Route: *route}
+				snapshot.RoutingRules, err = h.Store.GetRoutingRules(id)
+				value = snapshot
+			}
+		case "transformation":
+			value, err = nonNil(h.Store.GetTransformationByID(id))
+		case "library":
+			value, err = nonNil(h.Store.GetScriptLibraryByID(id))
+		case "sql_connection":
+			value, err = nonNil(h.Store.GetSQLConnectionByID(id))
+		case "file_server":
+			value, err = nonNil(h.Store.GetFileServerByID(id))
+		case "collector":
+			value, err = nonNil(h.Store.GetCollectorByID(id))
+		case "integration":
+			value, err = nonNil(h.Store.GetIntegrationByID(id))
+		case "trash":
+			if trashID, parseErr := strconv.ParseInt(id, 10, 64); parseErr == nil {
+				value, err = nonNil(h.Store.GetTrashItem(trashID))
+			}
+		}
+	}
+	if err != nil {
+		h.Logger.Warn("failed to read object for the audit log", "kind", kind, "id", id, "error", err)
+		return ""
+	}
+	if value == nil {
+		return ""
+	}
+	return maskedJSON(value)
+}
+
+// nonNil turns a nil object pointer into a nil interface, so a missing object has no snapshot.
+func nonNil[T any](v *T, err error) (interface{}, error) {
+	if v == nil || err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// auditForm returns the submitted form of a request as indented JSON with its secrets masked. Uploaded
+// files are recorded by name and size.
+func auditForm(r *http.Request) string {
+	form := make(map[string]interface{})
+	add := func(values map[string][]string) {
+		for key, v := range values {
+			if len(v) == 1 {
+				form[key] = v[0]
+			} else {
+				form[key] = v
+			}
+		}
+	}
+	add(r.PostForm)
+	if r.MultipartForm != nil {
+		add(r.MultipartForm.Value)
+		for key, files := range r.MultipartForm.File {
+			names := make([]string, 0, len(files))
+			for _, f := range files {
+				names = append(names, fmt.Sprintf("%s (%d bytes)", f.Filename, f.Size))
+			}
+			form[key] = strings.Join(names, ", ")
+		}
+	}
+	if len(form) == 0 {
+		return ""
+	}
+	return maskedJSON(form)
+}
+
+// maskedJSON encodes a value as indented JSON, replacing the values of secret fields with a fingerprint
+// that shows whether they changed without revealing them.
+func maskedJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	var generic interface{}
+	if err := json.Unmarshal(encoded, &generic); err != nil {
+		return ""
+	}
+	masked, err := json.MarshalIndent(maskSecrets(generic), "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(masked)
+}
+
+func maskSecrets(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && isSecretKey(key) {
+				v[key] = maskSecret(s)
+			} else {
+				v[key] = maskSecrets(value)
+			}
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = maskSecrets(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isSecretKey(key string) bool {
+	normalized := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	for _, part := range auditSecretKeys {
+		if strings.Contains(normalized, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "******** sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// auditActor returns the user named by the authenticating proxy, or the user of basic authentication.
+func auditActor(r *http.Request) string {
+	for _, header := range auditUserHeaders {
+		if user := strings.TrimSpace(r.Header.Get(header)); user != "" {
+			return user
+		}
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+// auditRemoteAddr returns the address of the client, as forwarded by a proxy if there is one.
+func auditRemoteAddr(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// AuditRoutes handles routing for /admin/audit.
+func AuditRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	// GET /admin/audit[?kind=&action=&actor=&q=]
+	case len(parts) == 0 || (len(parts) == 1 && parts[0] == ""):
+		h.handleAuditLog(w, r)
+	// GET /admin/audit/{id}
+	case len(parts) == 1:
+		h.handleAuditEntry(w, r, parts[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleAuditLog lists the audit entries matching the kind, action, actor and search term of the query.
+func (h *Handler) handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	query := r.URL.Query()
+	data := PageData{
+		AuditSearch: storage.AuditSearch{
+			Kind:   query.Get("kind"),
+			Action: strings.TrimSpace(query.Get("action")),
+			Actor:  query.Get("actor"),
+			Term:   strings.TrimSpace(query.Get("q")),
+			Limit:  h.listSize(),
+		},
+		AuditKinds:     auditKindNames(),
+		AcceptLanguage: lang,
+	}
+
+	var err error
+	if data.AuditActors, err = h.Store.GetAuditActors(); err != nil {
+		h.renderError(w, "audit.html", h.I18n.Sprintf(lang, "Failed to read the audit log: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if data.AuditEntries, err = h.Store.SearchAudit(data.AuditSearch); err != nil {
+		h.renderError(w, "audit.html", h.I18n.Sprintf(lang, "Failed to read the audit log: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.renderTemplate(w, "audit.html", data)
+}
+
+// handleAuditEntry shows an audit entry with the changes it made.
+func (h *Handler) handleAuditEntry(w http.ResponseWriter, r *http.Request, idParam string) {
+	lang := h.determineLanguage(r)
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	entry, err := h.Store.GetAuditEntry(id)
+	if err != nil {
+		h.renderError(w, "audit.html", h.I18n.Sprintf(lang, "Failed to read the audit log: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if entry == nil {
+		h.renderError(w, "audit.html", h.I18n.Sprintf(lang, "Audit entry not found."), http.StatusNotFound, r)
+		return
+	}
+
+	data := PageData{
+		AuditEntry:     entry,
+		AcceptLanguage: lang,
+	}
+	if entry.OldValue != "" && entry.NewValue != "" {
+		data.AuditDiff = diffLines(entry.OldValue, entry.NewValue)
+	}
+	h.renderTemplate(w, "audit.html", data)
+}
+
+// auditKindNames returns the kinds of objects the audit log filter offers.
+func auditKindNames() []string {
+	kinds := []string{"channel", "settings", "config", "maintenance"}
+	for _, kind := range auditKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
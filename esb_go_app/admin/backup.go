@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"esb-go-app/storage"
+)
+
+// maxBackupSize bounds the database file uploaded to restore a backup.
+const maxBackupSize = 1 << 30
+
+// handleDownloadBackup serves a consistent snapshot of the SQLite database, taken while the service keeps
+// running, to recover the node or set up a copy of it.
+func (h *Handler) handleDownloadBackup(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	dir, err := os.MkdirTemp("", "esb-backup-")
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to back up the database: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := h.Store.Backup(r.Context(), path); err != nil {
+		h.renderError(w, "admin.html", h.backupErrorMessage(lang, "Failed to back up the database: %s", err), http.StatusInternalServerError, r)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to back up the database: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to back up the database: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="esb-backup-%s.db"`, time.Now().UTC().Format("20060102-150405")))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	if _, err := io.Copy(w, file); err != nil {
+		h.Logger.Error("failed to send database backup", "error", err)
+		return
+	}
+	h.Logger.Info("database backup downloaded", "bytes", info.Size())
+}
+
+// handleRestoreBackup replaces the database with an uploaded backup. The file is checked and its schema
+// brought up to date before anything is replaced, so a damaged or foreign file leaves the node untouched.
+// The running workers, routers and collectors keep their configuration until the service is restarted.
+func (h *Handler) handleRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if !h.Store.SupportsBackup() {
+		h.renderError(w, "admin.html", h.backupErrorMessage(lang, "Failed to restore the backup: %s", storage.ErrBackupUnsupported), http.StatusBadRequest, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBackupSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	upload, _, err := r.FormFile("backup")
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "A backup file is required."), http.StatusBadRequest, r)
+		return
+	}
+	defer upload.Close()
+
+	dir, err := os.MkdirTemp("", "esb-restore-")
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to restore the backup: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "restore.db")
+	file, err := os.Create(path)
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to restore the backup: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	_, err = io.Copy(file, upload)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to restore the backup: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	info, err := storage.ValidateBackup(path, h.Logger)
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "The backup is not valid: %s", err.Error()), http.StatusBadRequest, r)
+		return
+	}
+	if err := h.Store.Restore(r.Context(), path); err != nil {
+		h.renderError(w, "admin.html", h.backupErrorMessage(lang, "Failed to restore the backup: %s", err), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Warn("database restored from backup, restart the service to apply it to the running workers",
+		"applications", info.Applications, "channels", info.Channels, "transformations", info.Transformations, "routes", info.Routes)
+	http.Redirect(w, r, fmt.Sprintf("/admin?status=backup_restored&applications=%d&channels=%d&transformations=%d&routes=%d",
+		info.Applications, info.Channels, info.Transformations, info.Routes), http.StatusSeeOther)
+}
+
+// backupErrorMessage formats a failed backup or restore, explaining when the storage has no online backup.
+func (h *Handler) backupErrorMessage(lang, format string, err error) string {
+	if errors.Is(err, storage.ErrBackupUnsupported) {
+		return h.I18n.Sprintf(lang, format, h.I18n.Sprintf(lang, "backup and restore are only available with the SQLite storage, back up PostgreSQL with its own tools"))
+	}
+	return h.I18n.Sprintf(lang, format, err.Error())
+}
+
+// backupRestoredStatus describes the restored backup from the query of the redirect after a restore.
+func (h *Handler) backupRestoredStatus(lang string, r *http.Request) string {
+	q := r.URL.Query()
+	return h.I18n.Sprintf(lang, "Backup restored: %s applications, %s channels, %s transformations and %s routes. Restart the service so the workers, routers and collectors use the restored configuration.",
+		q.Get("applications"), q.Get("channels"), q.Get("transformations"), q.Get("routes"))
+}
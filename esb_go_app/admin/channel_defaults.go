@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// maxMessageTTL is the largest accepted message TTL in seconds (one year).
+const maxMessageTTL = 365 * 24 * 60 * 60
+
+// Settings of the installation-wide default channel options.
+var (
+	channelDefaultFanoutModeSetting        = storage.SettingDefinition{Key: "channel_default_fanout_mode", Type: storage.SettingBool, Default: "false"}
+	channelDefaultQueueTypeSetting         = storage.SettingDefinition{Key: "channel_default_queue_type", Type: storage.SettingString, Default: "classic", Options: []string{"classic", "quorum"}}
+	channelDefaultMessageTTLSetting        = storage.SettingDefinition{Key: "channel_default_message_ttl", Type: storage.SettingInt, Default: "0", Min: 0, Max: maxMessageTTL}
+	channelDefaultDestinationPrefixSetting = storage.SettingDefinition{Key: "channel_default_destination_prefix", Type: storage.SettingString}
+)
+
+// ChannelDefaults are the options preset on the new channel form. The destination prefix is also
+// enforced when a channel is created, so every new durable queue follows the naming standard.
+type ChannelDefaults struct {
+	FanoutMode        bool
+	QueueType         string
+	MessageTTL        int
+	DestinationPrefix string
+}
+
+// loadChannelDefaults reads the default channel options from the settings.
+func (h *Handler) loadChannelDefaults() ChannelDefaults {
+	var defaults ChannelDefaults
+	var errs []error
+	var err error
+	defaults.FanoutMode, err = h.Store.GetBoolSetting(channelDefaultFanoutModeSetting)
+	errs = append(errs, err)
+	defaults.QueueType, err = h.Store.GetStringSetting(channelDefaultQueueTypeSetting)
+	errs = append(errs, err)
+	defaults.MessageTTL, err = h.Store.GetIntSetting(channelDefaultMessageTTLSetting)
+	errs = append(errs, err)
+	defaults.DestinationPrefix, err = h.Store.GetStringSetting(channelDefaultDestinationPrefixSetting)
+	errs = append(errs, err)
+	if err := errors.Join(errs...); err != nil {
+		h.Logger.Error("failed to get channel default settings", "error", err)
+	}
+	return defaults
+}
+
+// applyDestinationPrefix prepends the default destination prefix unless the destination already carries it.
+func applyDestinationPrefix(prefix, destination string) string {
+	if prefix == "" || strings.HasPrefix(destination, prefix) {
+		return destination
+	}
+	return prefix + destination
+}
+
+// applyQueueOptions reads the queue type, message TTL and lazy mode fields of the channel forms.
+func (h *Handler) applyQueueOptions(r *http.Request, ch *storage.Channel, lang string) error {
+	queueType, err := parseQueueType(r.FormValue("queue_type"))
+	if err != nil {
+		return errors.New(h.I18n.Sprintf(lang, "Queue type must be classic or quorum."))
+	}
+	ttl, err := parseMessageTTL(r.FormValue("message_ttl_seconds"))
+	if err != nil {
+		return errors.New(h.I18n.Sprintf(lang, "Message TTL must be a number of seconds between 0 and %d.", maxMessageTTL))
+	}
+	ch.QueueType = queueType
+	ch.MessageTTL = ttl
+	ch.LazyMode = r.FormValue("lazy_mode") == "on"
+	// Quorum queues do not support x-max-priority.
+	if ch.QueueType == "quorum" && ch.MaxPriority > 0 {
+		return errors.New(h.I18n.Sprintf(lang, "Quorum queues do not support priorities. Set max priority to 0 or use a classic queue."))
+	}
+	// Quorum queues always keep their messages on disk and reject x-queue-mode.
+	if ch.QueueType == "quorum" && ch.LazyMode {
+		return errors.New(h.I18n.Sprintf(lang, "Lazy mode applies to classic queues only. Uncheck it or use a classic queue."))
+	}
+	return nil
+}
+
+// parseQueueType normalizes the queue type field; an empty value means a classic queue.
+func parseQueueType(value string) (string, error) {
+	switch value = strings.TrimSpace(value); value {
+	case "", "classic":
+		return "", nil
+	case "quorum":
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid queue type '%s'", value)
+	}
+}
+
+// parseMessageTTL reads an optional message TTL in seconds.
+func parseMessageTTL(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := strconv.Atoi(value)
+	if err != nil || ttl < 0 || ttl > maxMessageTTL {
+		return 0, fmt.Errorf("invalid message TTL '%s'", value)
+	}
+	return ttl, nil
+}
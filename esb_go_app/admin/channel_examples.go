@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"esb-go-app/storage"
+)
+
+// ChannelExamples holds ready-to-use snippets that show partners how to publish to and consume from a channel.
+type ChannelExamples struct {
+	Direction     string `json:"direction"`
+	Exchange      string `json:"exchange"`
+	Queue         string `json:"queue"`
+	SamplePayload string `json:"sample_payload"`
+	CurlToken     string `json:"curl_token"`
+	CurlRuntime   string `json:"curl_runtime"`
+	CurlPublish   string `json:"curl_publish"`
+	CurlConsume   string `json:"curl_consume"`
+	BSL           string `json:"bsl"`
+}
+
+// buildChannelExamples generates example payloads and snippets from the channel settings.
+func (h *Handler) buildChannelExamples(r *http.Request, app *storage.Application, ch *storage.Channel) (*ChannelExamples, error) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, r.Host)
+	managementURL := strings.TrimRight(h.RabbitMQ.ManagementURL(ch.Connection), "/")
+
+	payload, err := json.MarshalIndent(map[string]interface{}{
+		"channel":   ch.Name,
+		"message":   "example",
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build sample payload: %w", err)
+	}
+
+	exchange := "durable_exchange_for_" + ch.Destination
+	queue := "durable_queue_for_" + ch.Destination
+	vhost := "/"
+	if ch.VHost != "" {
+		vhost = ch.VHost
+	}
+
+	// The management API expects the payload as a JSON string inside the publish request.
+	publishBody, err := json.Marshal(map[string]interface{}{
+		"properties":       map[string]interface{}{"content_type": "application/json", "delivery_mode": 2},
+		"routing_key":      "",
+		"payload":          string(payload),
+		"payload_encoding": "string",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build publish request: %w", err)
+	}
+
+	examples := &ChannelExamples{
+		Direction:     ch.Direction,
+		Exchange:      exchange,
+		Queue:         queue,
+		SamplePayload: string(payload),
+		CurlToken: fmt.Sprintf("curl -X POST -u '%s:<client_secret>' %s/auth/oidc/token",
+			app.ID, baseURL),
+		CurlRuntime: fmt.Sprintf("curl -H 'Authorization: Bearer <id_token>' %s/applications/%s/sys/esb/runtime/channels",
+			baseURL, app.Name),
+		CurlPublish: fmt.Sprintf("curl -u '<user>:<password>' -H 'Content-Type: application/json' -X POST %s/api/exchanges/%s/%s/publish -d '%s'",
+			managementURL, url.PathEscape(vhost), exchange, string(publishBody)),
+		CurlConsume: fmt.Sprintf("curl -u '<user>:<password>' -H 'Content-Type: application/json' -X POST %s/api/queues/%s/%s/get -d '{\"count\":1,\"ackmode\":\"ack_requeue_true\",\"encoding\":\"auto\"}'",
+			managementURL, url.PathEscape(vhost), queue),
+	}
+
+	// 1C sends messages into outbound channels and receives them from inbound channels.
+	if ch.Direction == "outbound" {
+		examples.BSL = fmt.Sprintf(`Сообщение = СервисыИнтеграции.%[1]s.СоздатьСообщение();
+Поток = Сообщение.ПолучитьТелоКакПоток();
+ЗаписьТекста = Новый ЗаписьДанных(Поток);
+ЗаписьТекста.ЗаписатьСтроку("%[3]s");
+ЗаписьТекста.Закрыть();
+СервисыИнтеграции.%[1]s.%[2]s.ОтправитьСообщение(Сообщение);`,
+			app.Name, ch.Name, strings.ReplaceAll(strings.ReplaceAll(string(payload), "\n", ""), `"`, `""`))
+	} else {
+		examples.BSL = fmt.Sprintf(`// Обработчик канала %[2]s сервиса интеграции %[1]s
+Процедура %[2]sОбработкаСообщения(Сообщение, Отказ)
+	Поток = Сообщение.ПолучитьТелоКакПоток();
+	ЧтениеТекста = Новый ЧтениеТекста(Поток, КодировкаТекста.UTF8);
+	Текст = ЧтениеТекста.Прочитать();
+	ЧтениеJSON = Новый ЧтениеJSON;
+	ЧтениеJSON.УстановитьСтроку(Текст);
+	Данные = ПрочитатьJSON(ЧтениеJSON);
+КонецПроцедуры`,
+			app.Name, ch.Name)
+	}
+
+	return examples, nil
+}
+
+// handleChannelExamples serves the generated channel snippets as JSON.
+func (h *Handler) handleChannelExamples(w http.ResponseWriter, r *http.Request, appID, channelID string) {
+	channel, err := h.Store.GetChannelByID(channelID)
+	if err != nil {
+		h.Logger.Error("failed to get channel for examples", "error", err, "channel_id", channelID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if channel == nil || channel.ApplicationID != appID {
+		http.NotFound(w, r)
+		return
+	}
+
+	app, err := h.Store.GetApplicationByID(appID)
+	if err != nil || app == nil {
+		h.Logger.Error("failed to get application for channel examples", "error", err, "app_id", appID)
+		http.NotFound(w, r)
+		return
+	}
+
+	examples, err := h.buildChannelExamples(r, app, channel)
+	if err != nil {
+		h.Logger.Error("failed to build channel examples", "error", err, "channel_id", channelID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(examples)
+}
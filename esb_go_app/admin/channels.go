@@ -3,10 +3,13 @@ package admin
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
+	"esb-go-app/rabbitmq"
 	"esb-go-app/storage"
 )
 
@@ -25,6 +28,13 @@ func ChannelRoutes(h *Handler, w http.ResponseWriter, r *http.Request, appID str
 		return
 	}
 
+	// GET /admin/app/{appID}/channel/{channelID}/examples
+	if r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "examples" {
+		channelID := parts[0]
+		h.handleChannelExamples(w, r, appID, channelID)
+		return
+	}
+
 	// POST /admin/app/{appID}/channel/{channelID}/update
 	if r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "update" {
 		channelID := parts[0]
@@ -32,6 +42,13 @@ func ChannelRoutes(h *Handler, w http.ResponseWriter, r *http.Request, appID str
 		return
 	}
 
+	// GET /admin/app/{appID}/channel/{channelID}/delete
+	if r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "delete" {
+		channelID := parts[0]
+		h.handleDeleteChannelImpact(w, r, appID, channelID)
+		return
+	}
+
 	// POST /admin/app/{appID}/channel/{channelID}/delete
 	if r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "delete" {
 		channelID := parts[0]
@@ -39,6 +56,13 @@ func ChannelRoutes(h *Handler, w http.ResponseWriter, r *http.Request, appID str
 		return
 	}
 
+	// POST /admin/app/{appID}/channel/{channelID}/worker/{pause|resume|restart}
+	if r.Method == http.MethodPost && len(parts) == 3 && parts[1] == "worker" && isWorkerAction(parts[2]) {
+		channelID := parts[0]
+		h.handleChannelWorker(w, r, appID, channelID, parts[2])
+		return
+	}
+
 	// POST /admin/app/{appID}/channel/{channelID}/test
 	if r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "test" {
 		channelID := parts[0]
@@ -61,19 +85,43 @@ func (h *Handler) handleViewChannel(w http.ResponseWriter, r *http.Request, chan
 		return
 	}
 
-	data := PageData{
-		Channel:        channel,
-		AcceptLanguage: lang,
-	}
-
+	data := h.channelPageData(r, channel, lang)
 	status := r.URL.Query().Get("status")
 	if status == "updated" {
 		data.StatusMessage = h.I18n.Sprintf(lang, "Channel updated successfully!")
+	} else {
+		data.StatusMessage = h.workerStatusMessage(lang, status)
 	}
 
 	h.renderTemplate(w, "channel_details.html", data)
 }
 
+// channelPageData prepares the details page of a channel, with its worker activity and client examples.
+func (h *Handler) channelPageData(r *http.Request, channel *storage.Channel, lang string) PageData {
+	data := PageData{
+		Channel:           channel,
+		BrokerConnections: h.RabbitMQ.ConnectionNames(),
+		ChannelSilent:     h.RabbitMQ.IsChannelSilent(channel),
+		WorkerRunning:     h.RabbitMQ.IsChannelWorkerRunning(rabbitmq.ChannelConnection(channel), channel.Direction, channel.Destination),
+		AcceptLanguage:    lang,
+	}
+	if last, ok := h.RabbitMQ.ChannelLastActivity(channel); ok {
+		data.ChannelLastMessage = last.Format("2006-01-02 15:04:05")
+	}
+
+	app, err := h.Store.GetApplicationByID(channel.ApplicationID)
+	if err != nil {
+		h.Logger.Error("failed to get application for channel examples", "error", err, "app_id", channel.ApplicationID)
+	} else if app != nil {
+		examples, err := h.buildChannelExamples(r, app, channel)
+		if err != nil {
+			h.Logger.Error("failed to build channel examples", "error", err, "channel_id", channel.ID)
+		}
+		data.ChannelExamples = examples
+	}
+	return data
+}
+
 func (h *Handler) handleCreateChannel(w http.ResponseWriter, r *http.Request, appID string) {
 	lang := h.determineLanguage(r)
 	if err := r.ParseForm(); err != nil {
@@ -86,16 +134,51 @@ func (h *Handler) handleCreateChannel(w http.ResponseWriter, r *http.Request, ap
 		ApplicationID: appID,
 		Name:          r.FormValue("name"),
 		Direction:     r.FormValue("direction"),
-		Destination:   r.FormValue("destination"),
+		Destination:   strings.TrimSpace(r.FormValue("destination")),
 		FanoutMode:    r.FormValue("fanout_mode") == "on",
+		Connection:    r.FormValue("connection"),
+		Tags:          parseTags(r),
 	}
 
-	if ch.Name == "" || ch.Destination == "" {
-		h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Channel name and destination are required."), http.StatusBadRequest, r)
+	app, err := h.Store.GetApplicationByID(appID)
+	if err != nil || app == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ch.VHost = app.VHost
+	if ch.Destination != "" {
+		ch.Destination = applyDestinationPrefix(h.loadChannelDefaults().DestinationPrefix, ch.Destination)
+	}
+	if err := h.Store.ValidateChannel(ch); err != nil {
+		data, dataErr := h.appPageData(r, app, lang)
+		data.Channel = ch // The create form shows the submitted values again
+		if dataErr != nil || !h.renderInvalid(w, "app_details.html", data, err) {
+			h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Failed to save channel: %s", err.Error()), http.StatusInternalServerError, r)
+		}
+		return
+	}
+	if !h.RabbitMQ.HasConnection(ch.Connection) {
+		h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Unknown RabbitMQ connection: %s", ch.Connection), http.StatusBadRequest, r)
+		return
+	}
+	maxPriority, err := parseMaxPriority(r.FormValue("max_priority"))
+	if err != nil {
+		h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Max priority must be a number between 0 and 255."), http.StatusBadRequest, r)
+		return
+	}
+	ch.MaxPriority = maxPriority
+	silenceAlert, err := parseSilenceAlert(r.FormValue("silence_alert_minutes"))
+	if err != nil {
+		h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Silence alert must be a non-negative number of minutes."), http.StatusBadRequest, r)
+		return
+	}
+	ch.SilenceAlert = silenceAlert
+	if err := h.applyQueueOptions(r, ch, lang); err != nil {
+		h.renderError(w, "app_details.html", err.Error(), http.StatusBadRequest, r)
 		return
 	}
 
-	if err := h.RabbitMQ.SetupDurableTopology(ch.Destination); err != nil {
+	if err := h.RabbitMQ.SetupDurableTopology(rabbitmq.ChannelConnection(ch), ch.Destination, rabbitmq.ChannelQueueOptions(ch)); err != nil {
 		h.Logger.Error("failed to setup durable rabbitmq topology", "error", err)
 		h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Failed to setup RabbitMQ topology."), http.StatusInternalServerError, r)
 		return
@@ -108,9 +191,9 @@ func (h *Handler) handleCreateChannel(w http.ResponseWriter, r *http.Request, ap
 	}
 
 	if ch.Direction == "inbound" {
-		h.RabbitMQ.StartInboundForwarder(ch.Destination)
+		h.RabbitMQ.StartInboundForwarder(rabbitmq.ChannelConnection(ch), ch.Destination)
 	} else if ch.Direction == "outbound" {
-		h.RabbitMQ.StartOutboundCollector(ch.Destination)
+		h.RabbitMQ.StartOutboundCollector(rabbitmq.ChannelConnection(ch), ch.Destination)
 	}
 
 	h.Logger.Info("channel created successfully", "channel_name", ch.Name, "app_id", appID)
@@ -130,20 +213,64 @@ func (h *Handler) handleUpdateChannel(w http.ResponseWriter, r *http.Request, ap
 		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Channel not found to update."), http.StatusNotFound, r)
 		return
 	}
+	oldChannel := *ch
 
 	// Update properties from form
 	ch.Name = r.FormValue("name")
 	ch.Direction = r.FormValue("direction")
 	ch.Destination = r.FormValue("destination")
 	ch.FanoutMode = r.FormValue("fanout_mode") == "on"
+	ch.Connection = r.FormValue("connection")
+	ch.Tags = parseTags(r)
+	ch.Revision = formRevision(r)
 
-	if ch.Name == "" || ch.Destination == "" {
-		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Channel name and destination are required."), http.StatusBadRequest, r)
+	if err := h.Store.ValidateChannel(ch); err != nil {
+		if !h.renderInvalid(w, "channel_details.html", h.channelPageData(r, ch, lang), err) {
+			h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Failed to update channel: %s", err.Error()), http.StatusInternalServerError, r)
+		}
+		return
+	}
+	if !h.RabbitMQ.HasConnection(ch.Connection) {
+		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Unknown RabbitMQ connection: %s", ch.Connection), http.StatusBadRequest, r)
+		return
+	}
+	maxPriority, err := parseMaxPriority(r.FormValue("max_priority"))
+	if err != nil {
+		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Max priority must be a number between 0 and 255."), http.StatusBadRequest, r)
+		return
+	}
+	ch.MaxPriority = maxPriority
+	// RabbitMQ cannot change the arguments of an existing queue, so priorities are fixed per destination.
+	if ch.MaxPriority != oldChannel.MaxPriority && ch.Destination == oldChannel.Destination && sameConnection(ch.Connection, oldChannel.Connection) {
+		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "The max priority of an existing queue cannot be changed. Use a new destination instead."), http.StatusBadRequest, r)
+		return
+	}
+	silenceAlert, err := parseSilenceAlert(r.FormValue("silence_alert_minutes"))
+	if err != nil {
+		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Silence alert must be a non-negative number of minutes."), http.StatusBadRequest, r)
+		return
+	}
+	ch.SilenceAlert = silenceAlert
+	if err := h.applyQueueOptions(r, ch, lang); err != nil {
+		h.renderError(w, "channel_details.html", err.Error(), http.StatusBadRequest, r)
+		return
+	}
+	if (ch.QueueType != oldChannel.QueueType || ch.MessageTTL != oldChannel.MessageTTL || ch.LazyMode != oldChannel.LazyMode) && ch.Destination == oldChannel.Destination && sameConnection(ch.Connection, oldChannel.Connection) {
+		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "The queue type, message TTL and lazy mode of an existing queue cannot be changed. Use a new destination instead."), http.StatusBadRequest, r)
 		return
 	}
 
 	if err := h.Store.UpdateChannel(ch); err != nil {
-		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Failed to update channel: %s", err.Error()), http.StatusInternalServerError, r)
+		ch.Revision = oldChannel.Revision
+		if !h.renderConflict(w, "channel_details.html", h.channelPageData(r, ch, lang), err) {
+			h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Failed to update channel: %s", err.Error()), http.StatusInternalServerError, r)
+		}
+		return
+	}
+
+	if err := h.restartChannelWorkers(&oldChannel, ch); err != nil {
+		h.Logger.Error("failed to restart channel workers", "error", err, "channel_id", channelID)
+		h.renderError(w, "channel_details.html", h.I18n.Sprintf(lang, "Channel updated, but worker restart failed: %s", err.Error()), http.StatusInternalServerError, r)
 		return
 	}
 
@@ -168,9 +295,15 @@ func (h *Handler) handleTestExchange(w http.ResponseWriter, r *http.Request, app
 
 		action := r.FormValue("action")
 
-		if action == "receive" {
+		if action == "receive" || action == "peek" {
 			queueName := "durable_queue_for_" + channel.Destination
-			body, ok, err := h.RabbitMQ.GetOneMessage(queueName)
+			var body string
+			var ok bool
+			if action == "peek" {
+				body, ok, err = h.RabbitMQ.PeekMessage(rabbitmq.ChannelConnection(channel), queueName)
+			} else {
+				body, ok, err = h.RabbitMQ.GetOneMessage(rabbitmq.ChannelConnection(channel), queueName)
+			}
 			if err != nil {
 				h.Logger.Error("failed to get test message", "error", err)
 				http.Redirect(w, r, fmt.Sprintf("/admin/app/%s?error=receive_failed", appID), http.StatusSeeOther)
@@ -187,10 +320,14 @@ func (h *Handler) handleTestExchange(w http.ResponseWriter, r *http.Request, app
 				h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Failed to retrieve channels for test."), http.StatusInternalServerError, r)
 				return
 			}
-			data := PageData{Application: app, Channels: channels, AcceptLanguage: lang}
+			data := PageData{Application: app, Channels: channels, BrokerConnections: h.RabbitMQ.ConnectionNames(), AcceptLanguage: lang}
 			if ok {
 				data.TestMessageReceived = body
-				data.TestMessageStatus = h.I18n.Sprintf(lang, "1 message received and deleted from the persistent queue.")
+				if action == "peek" {
+					data.TestMessageStatus = h.I18n.Sprintf(lang, "1 message read, it stays in the persistent queue.")
+				} else {
+					data.TestMessageStatus = h.I18n.Sprintf(lang, "1 message received and deleted from the persistent queue.")
+				}
 			} else {
 				data.TestMessageStatus = h.I18n.Sprintf(lang, "The persistent queue store is empty.")
 			}
@@ -204,7 +341,7 @@ func (h *Handler) handleTestExchange(w http.ResponseWriter, r *http.Request, app
 			}
 
 			exchangeName := "durable_exchange_for_" + channel.Destination
-			err := h.RabbitMQ.Publish(exchangeName, "", payload)
+			err := h.RabbitMQ.Publish(rabbitmq.ChannelConnection(channel), exchangeName, "", payload)
 			if err != nil {
 				h.Logger.Error("failed to publish test message", "error", err)
 				http.Redirect(w, r, fmt.Sprintf("/admin/app/%s?error=send_failed", appID), http.StatusSeeOther)
@@ -218,11 +355,146 @@ func (h *Handler) handleTestExchange(w http.ResponseWriter, r *http.Request, app
 	h.handleShowApp(w, r, appID) // Render app details page with test form
 }
 
+// handleDeleteChannel moves a channel to the trash with the routes reading from it, releases the other
+// routes using it and stops the workers. The durable queue and exchange are deleted from the broker when
+// the delete_topology field is set.
 func (h *Handler) handleDeleteChannel(w http.ResponseWriter, r *http.Request, appID, channelID string) {
-	if err := h.Store.DeleteChannel(channelID); err != nil {
+	lang := h.determineLanguage(r)
+	channel, err := h.Store.GetChannelByID(channelID)
+	if err != nil || channel == nil {
+		h.Logger.Error("failed to get channel before delete", "error", err, "channel_id", channelID)
+		http.NotFound(w, r)
+		return
+	}
+
+	dependents, err := h.Store.DeleteChannel(channelID)
+	if err != nil {
 		h.Logger.Error("failed to delete channel", "error", err)
+		h.renderError(w, "delete_impact.html", h.I18n.Sprintf(lang, "Failed to delete channel: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.releaseRouters(dependents)
+	h.stopChannelWorkers(channel)
+
+	status := "channel_deleted"
+	if r.FormValue("delete_topology") == "on" {
+		if err := h.deleteChannelTopology(channel); err != nil {
+			h.Logger.Error("failed to delete topology of deleted channel", "error", err, "channel_id", channelID, "destination", channel.Destination)
+			status = "channel_topology_kept"
+		}
+	}
+
+	h.Logger.Info("channel deleted successfully", "channel_id", channelID, "dependent_routes", len(dependents))
+	http.Redirect(w, r, fmt.Sprintf("/admin/app/%s?status=%s", appID, status), http.StatusSeeOther)
+}
+
+// stopChannelWorkers stops the worker of a deleted channel unless another channel still uses the same destination.
+func (h *Handler) stopChannelWorkers(ch *storage.Channel) {
+	shared, err := h.isDestinationShared(ch)
+	if err != nil {
+		h.Logger.Error("failed to check remaining channels before stopping worker", "error", err, "channel_id", ch.ID)
+		return
+	}
+	if shared {
+		h.Logger.Info("destination still used by another channel, keeping worker", "channel_id", ch.ID, "destination", ch.Destination)
+		return
+	}
+
+	h.RabbitMQ.StopChannelWorker(rabbitmq.ChannelConnection(ch), ch.Direction, ch.Destination)
+}
+
+// isDestinationShared reports whether another channel uses the same destination, direction, connection and vhost as ch.
+func (h *Handler) isDestinationShared(ch *storage.Channel) (bool, error) {
+	other, err := h.sharedDestinationChannel(ch)
+	return other != nil, err
+}
+
+// sharedDestinationChannel returns another channel using the same destination, direction, connection and
+// vhost as ch, or nil if there is none.
+func (h *Handler) sharedDestinationChannel(ch *storage.Channel) (*storage.Channel, error) {
+	channels, err := h.Store.GetAllChannels(storage.ListFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for i, other := range channels {
+		if other.ID != ch.ID && other.Destination == ch.Destination && other.Direction == ch.Direction &&
+			sameConnection(other.Connection, ch.Connection) && other.VHost == ch.VHost {
+			return &channels[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// restartChannelWorkers replaces the worker of a channel whose destination, direction,
+// broker connection, vhost or fan-out mode changed, and restarts the routers reading from it so they pick up the new source queue.
+func (h *Handler) restartChannelWorkers(oldCh, newCh *storage.Channel) error {
+	connChanged := !sameConnection(oldCh.Connection, newCh.Connection) || oldCh.VHost != newCh.VHost
+	if oldCh.Destination == newCh.Destination && oldCh.Direction == newCh.Direction && oldCh.FanoutMode == newCh.FanoutMode && !connChanged {
+		return nil
+	}
+
+	if oldCh.Destination != newCh.Destination || oldCh.Direction != newCh.Direction || connChanged {
+		shared, err := h.isDestinationShared(oldCh)
+		if err != nil {
+			return err
+		}
+		if shared {
+			// Another channel still needs the old worker, only bring up the new one.
+			if err := h.RabbitMQ.SetupDurableTopology(rabbitmq.ChannelConnection(newCh), newCh.Destination, rabbitmq.ChannelQueueOptions(newCh)); err != nil {
+				return err
+			}
+			h.RabbitMQ.StartChannelWorker(rabbitmq.ChannelConnection(newCh), newCh.Direction, newCh.Destination)
+		} else if err := h.RabbitMQ.RestartChannelWorkers(oldCh, newCh); err != nil {
+			return err
+		}
+		h.Logger.Info("channel workers restarted", "channel_id", newCh.ID, "old_destination", oldCh.Destination, "new_destination", newCh.Destination)
+	}
+
+	routes, err := h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if route.SourceChannelID == newCh.ID {
+			h.RabbitMQ.RestartRouter(route.ID, route.Name, route.SourceChannelID)
+		}
+	}
+	return nil
+}
+
+// sameConnection compares two channel connection names, treating an empty name as the default connection.
+func sameConnection(a, b string) bool {
+	if a == "" {
+		a = rabbitmq.DefaultConnection
+	}
+	if b == "" {
+		b = rabbitmq.DefaultConnection
 	}
+	return a == b
+}
 
-	h.Logger.Info("channel deleted successfully", "channel_id", channelID)
-	http.Redirect(w, r, fmt.Sprintf("/admin/app/%s?status=channel_deleted", appID), http.StatusSeeOther)
+// parseMaxPriority reads the optional max priority field of the channel forms.
+func parseMaxPriority(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	maxPriority, err := strconv.Atoi(value)
+	if err != nil || maxPriority < 0 || maxPriority > 255 {
+		return 0, fmt.Errorf("invalid max priority '%s'", value)
+	}
+	return maxPriority, nil
+}
+
+// parseSilenceAlert reads the optional silence alert field (minutes) of the channel forms.
+func parseSilenceAlert(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("invalid silence alert '%s'", value)
+	}
+	return minutes, nil
 }
@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -8,6 +9,9 @@ import (
 	"esb-go-app/storage"
 )
 
+// maxShownCollectorRuns is how many of the latest runs the collector page lists.
+const maxShownCollectorRuns = 20
+
 // CollectorRoutes handles routing for /admin/collectors/* paths.
 func CollectorRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
 	if r.Method == http.MethodGet {
@@ -44,24 +48,12 @@ func CollectorRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts [
 
 func (h *Handler) handleListCollectors(w http.ResponseWriter, r *http.Request) {
 	lang := h.determineLanguage(r)
-	collectors, err := h.Store.GetAllCollectors()
-	if err != nil {
-		h.renderError(w, "collectors.html", h.I18n.Sprintf(lang, "Failed to retrieve collectors: %s", err.Error()), http.StatusInternalServerError, r)
-		return
-	}
-
-	integrations, err := h.Store.GetAllIntegrations()
+	data, err := h.collectorsPageData(r, lang)
 	if err != nil {
-		h.renderError(w, "collectors.html", h.I18n.Sprintf(lang, "Failed to retrieve integrations: %s", err.Error()), http.StatusInternalServerError, r)
+		h.renderError(w, "collectors.html", err.Error(), http.StatusInternalServerError, r)
 		return
 	}
 
-	data := PageData{
-		Collectors:     collectors,
-		Integrations:   integrations,
-		AcceptLanguage: lang,
-	}
-
 	status := r.URL.Query().Get("status")
 	if status == "created" {
 		data.StatusMessage = h.I18n.Sprintf(lang, "Collector created successfully!")
@@ -74,6 +66,26 @@ func (h *Handler) handleListCollectors(w http.ResponseWriter, r *http.Request) {
 	h.renderTemplate(w, "collectors.html", data)
 }
 
+// collectorsPageData prepares the collectors list, filtered by tag, with the integrations of the create form.
+func (h *Handler) collectorsPageData(r *http.Request, lang string) (PageData, error) {
+	collectors, err := h.Store.GetAllCollectors()
+	if err != nil {
+		return PageData{}, errors.New(h.I18n.Sprintf(lang, "Failed to retrieve collectors: %s", err.Error()))
+	}
+
+	integrations, err := h.Store.GetAllIntegrations()
+	if err != nil {
+		return PageData{}, errors.New(h.I18n.Sprintf(lang, "Failed to retrieve integrations: %s", err.Error()))
+	}
+
+	data := PageData{
+		Integrations:   integrations,
+		AcceptLanguage: lang,
+	}
+	data.Collectors = filterTagged(r, &data, collectors, func(c storage.Collector) []string { return c.Tags })
+	return data, nil
+}
+
 func (h *Handler) handleViewCollector(w http.ResponseWriter, r *http.Request, collectorID string) {
 	lang := h.determineLanguage(r)
 	collector, err := h.Store.GetCollectorByID(collectorID)
@@ -86,11 +98,20 @@ func (h *Handler) handleViewCollector(w http.ResponseWriter, r *http.Request, co
 		return
 	}
 
-	integrations, err := h.Store.GetAllIntegrations()
+	data, err := h.collectorPageData(collector, lang)
 	if err != nil {
-		h.renderError(w, "collector_details.html", h.I18n.Sprintf(lang, "Failed to retrieve integrations: %s", err.Error()), http.StatusInternalServerError, r)
+		h.renderError(w, "collector_details.html", err.Error(), http.StatusInternalServerError, r)
 		return
 	}
+	h.renderTemplate(w, "collector_details.html", data)
+}
+
+// collectorPageData prepares the edit page of a collector, with the integrations it can use and its latest runs.
+func (h *Handler) collectorPageData(collector *storage.Collector, lang string) (PageData, error) {
+	integrations, err := h.Store.GetAllIntegrations()
+	if err != nil {
+		return PageData{}, errors.New(h.I18n.Sprintf(lang, "Failed to retrieve integrations: %s", err.Error()))
+	}
 
 	data := PageData{
 		Collector:      collector,
@@ -100,8 +121,12 @@ func (h *Handler) handleViewCollector(w http.ResponseWriter, r *http.Request, co
 	if collector.IntegrationID != nil {
 		data.SelectedIntegrationID = *collector.IntegrationID
 	}
-
-	h.renderTemplate(w, "collector_details.html", data)
+	runs, err := h.Store.GetCollectorRuns(collector.ID, maxShownCollectorRuns)
+	if err != nil {
+		h.Logger.Warn("failed to get collector runs", "collector_id", collector.ID, "error", err)
+	}
+	data.CollectorRuns = runs
+	return data, nil
 }
 
 func (h *Handler) handleCreateCollector(w http.ResponseWriter, r *http.Request) {
@@ -124,15 +149,15 @@ func (h *Handler) handleCreateCollector(w http.ResponseWriter, r *http.Request)
 		Engine:        r.FormValue("engine"),
 		Script:        r.FormValue("script"),
 		IntegrationID: integrationIDPtr,
-	}
-
-	if collector.Name == "" || collector.Schedule == "" || collector.Engine == "" || collector.Script == "" {
-		h.renderError(w, "collectors.html", h.I18n.Sprintf(lang, "All fields except integration are required."), http.StatusBadRequest, r)
-		return
+		Tags:          parseTags(r),
 	}
 
 	if err := h.Store.CreateCollector(collector); err != nil {
-		h.renderError(w, "collectors.html", h.I18n.Sprintf(lang, "Failed to create collector: %s", err.Error()), http.StatusInternalServerError, r)
+		data, dataErr := h.collectorsPageData(r, lang)
+		data.Collector = collector // The create form shows the submitted values again
+		if dataErr != nil || !h.renderInvalid(w, "collectors.html", data, err) {
+			h.renderError(w, "collectors.html", h.I18n.Sprintf(lang, "Failed to create collector: %s", err.Error()), http.StatusInternalServerError, r)
+		}
 		return
 	}
 
@@ -160,15 +185,14 @@ func (h *Handler) handleUpdateCollector(w http.ResponseWriter, r *http.Request,
 		Engine:        r.FormValue("engine"),
 		Script:        r.FormValue("script"),
 		IntegrationID: integrationIDPtr,
-	}
-
-	if collector.Name == "" || collector.Schedule == "" || collector.Engine == "" || collector.Script == "" {
-		h.renderError(w, "collector_details.html", h.I18n.Sprintf(lang, "All fields except integration are required."), http.StatusBadRequest, r)
-		return
+		Tags:          parseTags(r),
 	}
 
 	if err := h.Store.UpdateCollector(collector); err != nil {
-		h.renderError(w, "collector_details.html", h.I18n.Sprintf(lang, "Failed to update collector: %s", err.Error()), http.StatusInternalServerError, r)
+		data, dataErr := h.collectorPageData(collector, lang)
+		if dataErr != nil || !h.renderInvalid(w, "collector_details.html", data, err) {
+			h.renderError(w, "collector_details.html", h.I18n.Sprintf(lang, "Failed to update collector: %s", err.Error()), http.StatusInternalServerError, r)
+		}
 		return
 	}
 
@@ -0,0 +1,1071 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/scripting"
+	"esb-go-app/storage"
+)
+
+// configBundleFormat identifies the format of a configuration export.
+const configBundleFormat = "esb-config/v1"
+
+// maxConfigBundleSize limits the size of an imported configuration.
+const maxConfigBundleSize = 20 << 20
+
+// collectorSourcePrefix starts the source of a route fed by a collector, followed by the collector ID.
+const collectorSourcePrefix = storage.CollectorSourcePrefix
+
+// ConfigBundle is the declarative configuration of an installation, used to promote the configuration
+// from one installation to another. The credentials of the applications are not exported: they belong
+// to each installation, and applications created by an import get new ones. Likewise the passwords and
+// private keys of the file servers and the connection strings of the SQL connections are left out, and
+// the ones created by an import are completed on their pages.
+type ConfigBundle struct {
+	Format              string                       `json:"format"`
+	ExportedAt          time.Time                    `json:"exported_at"`
+	AppVersion          string                       `json:"app_version,omitempty"`
+	Applications        []storage.Application        `json:"applications"`
+	Channels            []storage.Channel            `json:"channels"`
+	Integrations        []storage.Integration        `json:"integrations"`
+	ScriptLibraries     []storage.ScriptLibrary      `json:"script_libraries"`
+	Transformations     []storage.Transformation     `json:"transformations"`
+	TransformationHooks *storage.TransformationHooks `json:"transformation_hooks,omitempty"` // Nil leaves the hooks of the installation alone
+	FileServers         []storage.FileServer         `json:"file_servers"`
+	SQLConnections      []storage.SQLConnection      `json:"sql_connections"`
+	Collectors          []storage.Collector          `json:"collectors"`
+	Routes              []ConfigRoute                `json:"routes"`
+}
+
+// ConfigRoute is a route of a configuration export together with its routing rules.
+type ConfigRoute struct {
+	storage.Route
+	RoutingRules []storage.RoutingRule `json:"RoutingRules,omitempty"`
+}
+
+// Actions of a configuration import on one object.
+const (
+	configCreated   = "created"
+	configUpdated   = "updated"
+	configUnchanged = "unchanged"
+)
+
+// ConfigChange is what an import did with one object of the configuration.
+type ConfigChange struct {
+	Kind   string `json:"kind"` // "application", "channel", "integration", "script_library", "transformation", "transformation_hooks", "file_server", "sql_connection", "collector" or "route"
+	ID     string `json:"id"`   // ID of the object on this installation
+	Name   string `json:"name"`
+	Action string `json:"action"` // configCreated, configUpdated or configUnchanged
+}
+
+// ConfigImportReport is the result of POST /admin/config/import.
+type ConfigImportReport struct {
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Changes   []ConfigChange `json:"changes"`
+}
+
+// ConfigRoutes handles routing for /admin/config/* paths.
+func ConfigRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET /admin/config/export
+	if r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "export" {
+		h.handleExportConfig(w, r)
+		return
+	}
+
+	// POST /admin/config/import
+	if r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "import" {
+		h.handleImportConfig(w, r)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// handleExportConfig serves the applications, channels, integrations, script libraries, transformations
+// and their global hooks, file servers, SQL connections, collectors and routes of the installation as one
+// downloadable JSON document.
+func (h *Handler) handleExportConfig(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	bundle, err := h.exportConfig()
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to export configuration: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "Failed to export configuration: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="esb-config-%s.json"`, bundle.ExportedAt.Format("20060102-150405")))
+	_, _ = w.Write(data)
+	h.Logger.Info("configuration exported", "applications", len(bundle.Applications), "channels", len(bundle.Channels), "routes", len(bundle.Routes))
+}
+
+// exportConfig reads the configuration of the installation.
+func (h *Handler) exportConfig() (*ConfigBundle, error) {
+	bundle := &ConfigBundle{
+		Format:     configBundleFormat,
+		ExportedAt: time.Now().UTC(),
+		AppVersion: h.Version,
+	}
+	var err error
+	if bundle.Applications, err = h.Store.GetAllApplications(storage.ListFilter{}); err != nil {
+		return nil, err
+	}
+	for i := range bundle.Applications {
+		bundle.Applications[i].ClientSecret = ""
+		bundle.Applications[i].IDToken = ""
+		bundle.Applications[i].PreviousIDToken = ""
+		bundle.Applications[i].PreviousIDTokenExpiresAt = time.Time{}
+	}
+	if bundle.Channels, err = h.Store.GetAllChannels(storage.ListFilter{}); err != nil {
+		return nil, err
+	}
+	if bundle.Integrations, err = h.Store.GetAllIntegrations(); err != nil {
+		return nil, err
+	}
+	if bundle.ScriptLibraries, err = h.Store.GetAllScriptLibraries(); err != nil {
+		return nil, err
+	}
+	if bundle.Transformations, err = h.Store.GetAllTransformations(); err != nil {
+		return nil, err
+	}
+	hooks, err := h.Store.GetTransformationHooks()
+	if err != nil {
+		return nil, err
+	}
+	bundle.TransformationHooks = &hooks
+	if bundle.FileServers, err = h.Store.GetAllFileServers(); err != nil {
+		return nil, err
+	}
+	for i := range bundle.FileServers {
+		bundle.FileServers[i].Password = ""
+		bundle.FileServers[i].PrivateKey = ""
+	}
+	if bundle.SQLConnections, err = h.Store.GetAllSQLConnections(); err != nil {
+		return nil, err
+	}
+	for i := range bundle.SQLConnections {
+		bundle.SQLConnections[i].DSN = "" // Holds the user and password of the database
+	}
+	if bundle.Collectors, err = h.Store.GetAllCollectors(); err != nil {
+		return nil, err
+	}
+
+	routes, err := h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range routes {
+		route, err := h.Store.GetRouteByID(info.ID)
+		if err != nil {
+			return nil, err
+		}
+		if route == nil {
+			continue // Deleted during the export
+		}
+		rules, err := h.Store.GetRoutingRules(route.ID)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Routes = append(bundle.Routes, ConfigRoute{Route: *route, RoutingRules: rules})
+	}
+	return bundle, nil
+}
+
+// handleImportConfig applies a configuration export to the installation. The document is uploaded from the
+// admin page as the "bundle" file, or posted as the request body with Content-Type application/json by
+// deployment tooling, which gets a ConfigImportReport back instead of a redirect.
+func (h *Handler) handleImportConfig(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	api := mediaType == "application/json"
+	fail := func(message string, status int) {
+		if api {
+			writeJSONError(w, message, status)
+			return
+		}
+		h.renderError(w, "admin.html", message, status, r)
+	}
+
+	var data []byte
+	if api {
+		var err error
+		if data, err = io.ReadAll(io.LimitReader(r.Body, maxConfigBundleSize)); err != nil {
+			fail(h.I18n.Sprintf(lang, "Failed to read configuration file: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := r.ParseMultipartForm(maxConfigBundleSize); err != nil {
+			fail(h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("bundle")
+		if err != nil {
+			fail(h.I18n.Sprintf(lang, "A configuration file is required."), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(io.LimitReader(file, maxConfigBundleSize)); err != nil {
+			fail(h.I18n.Sprintf(lang, "Failed to read configuration file: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var bundle ConfigBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		fail(h.I18n.Sprintf(lang, "Invalid configuration file: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if bundle.Format != configBundleFormat {
+		fail(h.I18n.Sprintf(lang, "Unsupported configuration format %q, expected %q.", bundle.Format, configBundleFormat), http.StatusBadRequest)
+		return
+	}
+	if err := h.validateConfigBundle(&bundle, lang); err != nil {
+		fail(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	importer := newConfigImporter(h, lang)
+	if err := importer.run(&bundle); err != nil {
+		h.Logger.Error("configuration import stopped", "error", err, "created", importer.report.Created, "updated", importer.report.Updated)
+		fail(h.I18n.Sprintf(lang, "Failed to import configuration: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	report := importer.report
+	h.Logger.Info("configuration imported", "created", report.Created, "updated", report.Updated, "unchanged", report.Unchanged)
+	if api {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin?status=config_imported&created=%d&updated=%d&unchanged=%d", report.Created, report.Updated, report.Unchanged), http.StatusSeeOther)
+}
+
+// validateConfigBundle checks a configuration before anything of it is imported: every object must be
+// complete, every transformation must pass its tests and every reference must point to an object of the
+// configuration or of this installation.
+func (h *Handler) validateConfigBundle(bundle *ConfigBundle, lang string) error {
+	inBundle := make(map[string]bool)
+	for _, app := range bundle.Applications {
+		inBundle[app.ID] = true
+	}
+	for _, ch := range bundle.Channels {
+		inBundle[ch.ID] = true
+	}
+	for _, i := range bundle.Integrations {
+		inBundle[i.ID] = true
+	}
+	for _, t := range bundle.Transformations {
+		inBundle[t.ID] = true
+	}
+	for _, c := range bundle.Collectors {
+		inBundle[collectorSourcePrefix+c.ID] = true
+	}
+
+	// known reports whether a reference resolves, reading this installation with lookup when the
+	// configuration does not contain the object.
+	known := func(id string, lookup func(string) (bool, error)) (bool, error) {
+		if id == "" || inBundle[id] {
+			return true, nil
+		}
+		return lookup(id)
+	}
+	application := func(id string) (bool, error) { app, err := h.Store.GetApplicationByID(id); return app != nil, err }
+	channel := func(id string) (bool, error) { ch, err := h.Store.GetChannelByID(id); return ch != nil, err }
+	integration := func(id string) (bool, error) { i, err := h.Store.GetIntegrationByID(id); return i != nil, err }
+	transformation := func(id string) (bool, error) { t, err := h.Store.GetTransformationByID(id); return t != nil, err }
+	source := func(id string) (bool, error) {
+		if strings.HasPrefix(id, collectorSourcePrefix) {
+			c, err := h.Store.GetCollectorByID(strings.TrimPrefix(id, collectorSourcePrefix))
+			return c != nil, err
+		}
+		return channel(id)
+	}
+	missing := func(ids []string, lookup func(string) (bool, error)) (string, error) {
+		for _, id := range ids {
+			ok, err := known(id, lookup)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return id, nil
+			}
+		}
+		return "", nil
+	}
+
+	for _, app := range bundle.Applications {
+		if app.ID == "" || app.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+	}
+	for _, i := range bundle.Integrations {
+		if i.ID == "" || i.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+	}
+	libraries := make(map[string]string) // Scripts of the libraries of the configuration by libraryKey
+	for _, l := range bundle.ScriptLibraries {
+		if l.ID == "" || strings.TrimSpace(l.Name) == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+		if (l.Engine != "javascript" && l.Engine != "starlark") || l.Script == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Script library %s needs the javascript or starlark engine and a script.", l.Name))
+		}
+		libraries[libraryKey(l.Engine, strings.TrimSpace(l.Name))] = l.Script
+	}
+	for _, t := range bundle.Transformations {
+		if t.ID == "" || t.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+		transformation := t
+		if err := storage.ValidateTransformation(&transformation); err != nil {
+			return errors.New(h.I18n.Sprintf(lang, "Transformation %s: %s", t.Name, h.validationMessage(lang, err)))
+		}
+		// The tests of a transformation importing a library the configuration adds or changes need the
+		// new library, so they run during the import, once the libraries are written.
+		untested := false
+		for _, name := range scripting.ImportedLibraries(t.Engine, t.Script) {
+			installed, err := h.Store.GetScriptLibraryByName(t.Engine, name)
+			if err != nil {
+				return err
+			}
+			script, ok := libraries[libraryKey(t.Engine, name)]
+			if !ok && installed == nil {
+				return errors.New(h.I18n.Sprintf(lang, "Transformation %s imports the library %s, which is neither in the configuration nor on this installation.", t.Name, name))
+			}
+			if ok && (installed == nil || installed.Script != script) {
+				untested = true
+			}
+		}
+		if untested {
+			continue
+		}
+		if err := h.runTransformationTests(&transformation, lang); err != nil {
+			return errors.New(h.I18n.Sprintf(lang, "Transformation %s: %s", t.Name, err.Error()))
+		}
+	}
+	if hooks := bundle.TransformationHooks; hooks != nil {
+		id, err := missing([]string{hooks.PreID, hooks.PostID}, transformation)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			return errors.New(h.I18n.Sprintf(lang, "The transformation hooks refer to %s, which is neither in the configuration nor on this installation.", id))
+		}
+	}
+	for _, f := range bundle.FileServers {
+		if f.ID == "" || f.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+		server := f
+		if msg := h.validateFileServer(lang, &server); msg != "" {
+			return errors.New(h.I18n.Sprintf(lang, "File server %s: %s", f.Name, msg))
+		}
+	}
+	for _, c := range bundle.SQLConnections {
+		if c.ID == "" || c.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+		if !slices.Contains(storage.SQLConnectionDrivers, c.Driver) {
+			return errors.New(h.I18n.Sprintf(lang, "SQL connection %s: %s", c.Name, h.I18n.Sprintf(lang, "Unsupported SQL driver: %s", c.Driver)))
+		}
+	}
+	for _, c := range bundle.Collectors {
+		if c.ID == "" || c.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+		collector := c
+		if err := storage.ValidateCollector(&collector); err != nil {
+			return errors.New(h.I18n.Sprintf(lang, "Collector %s: %s", c.Name, h.validationMessage(lang, err)))
+		}
+		if c.IntegrationID != nil {
+			id, err := missing([]string{*c.IntegrationID}, integration)
+			if err != nil {
+				return err
+			}
+			if id != "" {
+				return errors.New(h.I18n.Sprintf(lang, "Collector %s refers to %s, which is neither in the configuration nor on this installation.", c.Name, id))
+			}
+		}
+	}
+	for _, ch := range bundle.Channels {
+		if ch.ID == "" || ch.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+		if ch.Destination == "" || !slices.Contains(storage.ChannelDirections, ch.Direction) {
+			return errors.New(h.I18n.Sprintf(lang, "Channel %s needs a destination and the inbound or outbound direction.", ch.Name))
+		}
+		if !h.RabbitMQ.HasConnection(ch.Connection) {
+			return errors.New(h.I18n.Sprintf(lang, "Unknown RabbitMQ connection: %s", ch.Connection))
+		}
+		id, err := missing([]string{ch.ApplicationID}, application)
+		if err != nil {
+			return err
+		}
+		if ch.ApplicationID == "" || id != "" {
+			return errors.New(h.I18n.Sprintf(lang, "Channel %s refers to %s, which is neither in the configuration nor on this installation.", ch.Name, ch.ApplicationID))
+		}
+	}
+	for _, cr := range bundle.Routes {
+		route := cr.Route
+		if route.ID == "" || route.Name == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Every object of the configuration needs an ID and a name."))
+		}
+		if route.SourceChannelID == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Route %s needs a source channel or collector.", route.Name))
+		}
+		channels := []string{route.SampleChannelID, route.WiretapChannelID}
+		if route.DestinationChannelID != nil {
+			channels = append(channels, *route.DestinationChannelID)
+		}
+		for _, rule := range cr.RoutingRules {
+			channels = append(channels, rule.DestinationChannelID)
+		}
+		transformations := append([]string(nil), route.Pipeline...)
+		if route.TransformationID != nil {
+			transformations = append(transformations, *route.TransformationID)
+		}
+		var integrations []string
+		if route.IntegrationID != nil {
+			integrations = append(integrations, *route.IntegrationID)
+		}
+
+		for _, check := range []struct {
+			ids    []string
+			lookup func(string) (bool, error)
+		}{
+			{[]string{route.SourceChannelID}, source},
+			{channels, channel},
+			{transformations, transformation},
+			{integrations, integration},
+		} {
+			id, err := missing(check.ids, check.lookup)
+			if err != nil {
+				return err
+			}
+			if id != "" {
+				return errors.New(h.I18n.Sprintf(lang, "Route %s refers to %s, which is neither in the configuration nor on this installation.", route.Name, id))
+			}
+		}
+	}
+	return nil
+}
+
+// configImporter applies a validated configuration. Objects are matched to those of the installation by
+// ID and, failing that, by name, so configurations created by hand on both installations can be promoted
+// too; references are translated to the IDs of the matched objects. Unchanged objects are left alone, so
+// importing the same configuration again changes nothing and restarts no worker. The import is not one
+// transaction: when a write fails, the objects before it stay imported and the import can be repeated once
+// the cause is fixed.
+type configImporter struct {
+	h         *Handler
+	lang      string
+	ids       map[string]string // IDs of the configuration mapped to the IDs of the matched objects
+	libraries map[string]bool   // libraryKey of the script libraries the import created or changed
+	report    ConfigImportReport
+}
+
+func newConfigImporter(h *Handler, lang string) *configImporter {
+	return &configImporter{h: h, lang: lang, ids: make(map[string]string), libraries: make(map[string]bool), report: ConfigImportReport{Changes: []ConfigChange{}}}
+}
+
+func (c *configImporter) run(bundle *ConfigBundle) error {
+	if err := c.importApplications(bundle.Applications); err != nil {
+		return err
+	}
+	if err := c.importIntegrations(bundle.Integrations); err != nil {
+		return err
+	}
+	if err := c.importFileServers(bundle.FileServers); err != nil {
+		return err
+	}
+	if err := c.importSQLConnections(bundle.SQLConnections); err != nil {
+		return err
+	}
+	if err := c.importLibraries(bundle.ScriptLibraries); err != nil {
+		return err
+	}
+	if err := c.importTransformations(bundle.Transformations); err != nil {
+		return err
+	}
+	if err := c.importTransformationHooks(bundle.TransformationHooks); err != nil {
+		return err
+	}
+	if err := c.importCollectors(bundle.Collectors); err != nil {
+		return err
+	}
+	if err := c.importChannels(bundle.Channels); err != nil {
+		return err
+	}
+	return c.importRoutes(bundle.Routes)
+}
+
+// id translates a reference of the configuration to the ID of the matched object.
+func (c *configImporter) id(id string) string {
+	if strings.HasPrefix(id, collectorSourcePrefix) {
+		return collectorSourcePrefix + c.id(strings.TrimPrefix(id, collectorSourcePrefix))
+	}
+	if matched, ok := c.ids[id]; ok {
+		return matched
+	}
+	return id
+}
+
+func (c *configImporter) idPtr(id *string) *string {
+	if id == nil {
+		return nil
+	}
+	matched := c.id(*id)
+	return &matched
+}
+
+func (c *configImporter) record(kind, id, name, action string) {
+	switch action {
+	case configCreated:
+		c.report.Created++
+	case configUpdated:
+		c.report.Updated++
+	default:
+		c.report.Unchanged++
+	}
+	c.report.Changes = append(c.report.Changes, ConfigChange{Kind: kind, ID: id, Name: name, Action: action})
+}
+
+func (c *configImporter) importApplications(apps []storage.Application) error {
+	for _, app := range apps {
+		existing, err := c.h.Store.GetApplicationByID(app.ID)
+		if err == nil && existing == nil {
+			existing, err = c.h.Store.GetApplicationByName(app.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			created := &storage.Application{ID: app.ID, Name: app.Name, ClientSecret: uuid.New().String(), IDToken: uuid.New().String(), VHost: app.VHost}
+			if err := c.h.Store.CreateApplication(created); err != nil {
+				return err
+			}
+			c.ids[app.ID] = created.ID
+			c.record("application", created.ID, created.Name, configCreated)
+			continue
+		}
+
+		c.ids[app.ID] = existing.ID
+		if existing.Name == app.Name && existing.VHost == app.VHost {
+			c.record("application", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		channels, err := c.h.Store.GetChannelsByAppID(existing.ID)
+		if err != nil {
+			return err
+		}
+		if err := c.h.Store.UpdateApplication(&storage.Application{ID: existing.ID, Name: app.Name, VHost: app.VHost}); err != nil {
+			return err
+		}
+		// Like an edit on the application page, moving to another vhost moves the workers of its channels.
+		if app.VHost != existing.VHost {
+			for i := range channels {
+				newCh := channels[i]
+				newCh.VHost = app.VHost
+				if err := c.h.restartChannelWorkers(&channels[i], &newCh); err != nil {
+					return fmt.Errorf("moving channel %s to vhost %q: %w", newCh.Name, app.VHost, err)
+				}
+			}
+		}
+		c.record("application", existing.ID, app.Name, configUpdated)
+	}
+	return nil
+}
+
+func (c *configImporter) importIntegrations(integrations []storage.Integration) error {
+	all, err := c.h.Store.GetAllIntegrations()
+	if err != nil {
+		return err
+	}
+	for _, integration := range integrations {
+		var existing *storage.Integration
+		for i := range all {
+			if all[i].ID == integration.ID {
+				existing = &all[i]
+				break
+			}
+			if all[i].Name == integration.Name {
+				existing = &all[i]
+			}
+		}
+		incoming := storage.Integration{ID: integration.ID, Name: integration.Name, Description: integration.Description}
+		if existing == nil {
+			if err := c.h.Store.CreateIntegration(&incoming); err != nil {
+				return err
+			}
+			c.ids[integration.ID] = incoming.ID
+			c.record("integration", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		c.ids[integration.ID] = existing.ID
+		if existing.Name == incoming.Name && existing.Description == incoming.Description {
+			c.record("integration", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		incoming.ID = existing.ID
+		if err := c.h.Store.UpdateIntegration(&incoming); err != nil {
+			return err
+		}
+		c.record("integration", existing.ID, incoming.Name, configUpdated)
+	}
+	return nil
+}
+
+// importLibraries imports the script libraries, matched by ID and, failing that, by name within their
+// engine, and drops the compiled scripts when one was created or changed, like the library forms do.
+func (c *configImporter) importLibraries(libraries []storage.ScriptLibrary) error {
+	for _, library := range libraries {
+		incoming := library
+		incoming.Name = strings.TrimSpace(incoming.Name)
+		existing, err := c.h.Store.GetScriptLibraryByID(library.ID)
+		if err == nil && existing == nil {
+			existing, err = c.h.Store.GetScriptLibraryByName(incoming.Engine, incoming.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			if err := c.h.Store.CreateScriptLibrary(&incoming); err != nil {
+				return err
+			}
+			c.libraries[libraryKey(incoming.Engine, incoming.Name)] = true
+			c.record("script_library", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		incoming.ID, incoming.CreatedAt, incoming.UpdatedAt = existing.ID, existing.CreatedAt, existing.UpdatedAt
+		if sameConfig(existing, &incoming) {
+			c.record("script_library", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		if err := c.h.Store.UpdateScriptLibrary(&incoming); err != nil {
+			return err
+		}
+		c.libraries[libraryKey(incoming.Engine, incoming.Name)] = true
+		c.record("script_library", existing.ID, incoming.Name, configUpdated)
+	}
+	if len(c.libraries) > 0 {
+		c.h.scriptingService.PurgeCache() // Cached scripts still run the previous code of the libraries
+	}
+	return nil
+}
+
+// importTransformations imports the transformations. The validation left the tests of those importing a
+// library created or changed by this import, so they run first, before any transformation is written.
+func (c *configImporter) importTransformations(transformations []storage.Transformation) error {
+	for i := range transformations {
+		transformation := &transformations[i]
+		if !slices.ContainsFunc(scripting.ImportedLibraries(transformation.Engine, transformation.Script), func(name string) bool {
+			return c.libraries[libraryKey(transformation.Engine, name)]
+		}) {
+			continue
+		}
+		if err := c.h.runTransformationTests(transformation, c.lang); err != nil {
+			return errors.New(c.h.I18n.Sprintf(c.lang, "Transformation %s: %s", transformation.Name, err.Error()))
+		}
+	}
+
+	for _, transformation := range transformations {
+		existing, err := c.h.Store.GetTransformationByID(transformation.ID)
+		if err == nil && existing == nil {
+			existing, err = c.h.Store.GetTransformationByName(transformation.Name)
+		}
+		if err != nil {
+			return err
+		}
+		incoming := transformation
+		incoming.Tags = storage.NormalizeTags(incoming.Tags)
+		if existing == nil {
+			if err := c.h.Store.CreateTransformation(&incoming); err != nil {
+				return err
+			}
+			c.ids[transformation.ID] = incoming.ID
+			c.record("transformation", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		c.ids[transformation.ID] = existing.ID
+		incoming.ID, incoming.Revision, incoming.CreatedAt, incoming.UpdatedAt = existing.ID, existing.Revision, existing.CreatedAt, existing.UpdatedAt
+		if sameConfig(existing, &incoming) {
+			c.record("transformation", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		if err := c.h.Store.UpdateTransformation(&incoming); err != nil {
+			return err
+		}
+		c.record("transformation", existing.ID, incoming.Name, configUpdated)
+	}
+	return nil
+}
+
+// importTransformationHooks sets the global transformation hooks of the configuration and hands them to
+// the running routers, like the settings form does.
+func (c *configImporter) importTransformationHooks(hooks *storage.TransformationHooks) error {
+	if hooks == nil {
+		return nil
+	}
+	incoming := storage.TransformationHooks{PreID: c.id(hooks.PreID), PostID: c.id(hooks.PostID)}
+	existing, err := c.h.Store.GetTransformationHooks()
+	if err != nil {
+		return err
+	}
+	if existing == incoming {
+		c.record("transformation_hooks", "", "", configUnchanged)
+		return nil
+	}
+	if err := c.h.Store.SaveTransformationHooks(incoming); err != nil {
+		return err
+	}
+	c.h.RabbitMQ.SetTransformationHooks(incoming)
+	c.record("transformation_hooks", "", "", configUpdated)
+	return nil
+}
+
+// importFileServers imports the file servers. The configuration has no passwords and private keys:
+// matched servers keep theirs, and created ones get them on their page.
+func (c *configImporter) importFileServers(servers []storage.FileServer) error {
+	for _, server := range servers {
+		existing, err := c.h.Store.GetFileServerByID(server.ID)
+		if err == nil && existing == nil {
+			existing, err = c.h.Store.GetFileServerByName(server.Name)
+		}
+		if err != nil {
+			return err
+		}
+		incoming := server
+		incoming.Password, incoming.PrivateKey = "", ""
+		if existing == nil {
+			if err := c.h.Store.CreateFileServer(&incoming); err != nil {
+				return err
+			}
+			c.record("file_server", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		incoming.ID, incoming.Password, incoming.PrivateKey = existing.ID, existing.Password, existing.PrivateKey
+		incoming.CreatedAt, incoming.UpdatedAt = existing.CreatedAt, existing.UpdatedAt
+		if sameConfig(existing, &incoming) {
+			c.record("file_server", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		if err := c.h.Store.UpdateFileServer(&incoming); err != nil {
+			return err
+		}
+		c.record("file_server", existing.ID, incoming.Name, configUpdated)
+	}
+	return nil
+}
+
+// importSQLConnections imports the SQL connections. The configuration has no connection strings: matched
+// connections keep theirs, and created ones get them on their page.
+func (c *configImporter) importSQLConnections(connections []storage.SQLConnection) error {
+	for _, connection := range connections {
+		existing, err := c.h.Store.GetSQLConnectionByID(connection.ID)
+		if err == nil && existing == nil {
+			existing, err = c.h.Store.GetSQLConnectionByName(connection.Name)
+		}
+		if err != nil {
+			return err
+		}
+		incoming := connection
+		incoming.DSN = ""
+		if existing == nil {
+			if err := c.h.Store.CreateSQLConnection(&incoming); err != nil {
+				return err
+			}
+			c.record("sql_connection", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		incoming.ID, incoming.DSN, incoming.CreatedAt, incoming.UpdatedAt = existing.ID, existing.DSN, existing.CreatedAt, existing.UpdatedAt
+		if sameConfig(existing, &incoming) {
+			c.record("sql_connection", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		if err := c.h.Store.UpdateSQLConnection(&incoming); err != nil {
+			return err
+		}
+		c.record("sql_connection", existing.ID, incoming.Name, configUpdated)
+	}
+	return nil
+}
+
+// importCollectors imports the collectors. Like collectors created on the collectors page, new and changed
+// schedules take effect when the service restarts.
+func (c *configImporter) importCollectors(collectors []storage.Collector) error {
+	for _, collector := range collectors {
+		existing, err := c.h.Store.GetCollectorByID(collector.ID)
+		if err == nil && existing == nil {
+			existing, err = c.h.Store.GetCollectorByName(collector.Name)
+		}
+		if err != nil {
+			return err
+		}
+		incoming := collector
+		incoming.Tags = storage.NormalizeTags(incoming.Tags)
+		incoming.IntegrationID = c.idPtr(collector.IntegrationID)
+		if existing == nil {
+			if err := c.h.Store.CreateCollector(&incoming); err != nil {
+				return err
+			}
+			c.ids[collector.ID] = incoming.ID
+			c.record("collector", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		c.ids[collector.ID] = existing.ID
+		incoming.ID, incoming.CreatedAt, incoming.UpdatedAt = existing.ID, existing.CreatedAt, existing.UpdatedAt
+		if sameConfig(existing, &incoming) {
+			c.record("collector", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		if err := c.h.Store.UpdateCollector(&incoming); err != nil {
+			return err
+		}
+		c.record("collector", existing.ID, incoming.Name, configUpdated)
+	}
+	return nil
+}
+
+// importChannels imports the channels, declaring the topology and starting or restarting the workers the
+// same way as the channel forms do.
+func (c *configImporter) importChannels(channels []storage.Channel) error {
+	for _, channel := range channels {
+		incoming := channel
+		incoming.Tags = storage.NormalizeTags(incoming.Tags)
+		incoming.ApplicationID = c.id(channel.ApplicationID)
+		app, err := c.h.Store.GetApplicationByID(incoming.ApplicationID)
+		if err != nil {
+			return err
+		}
+		if app == nil {
+			return fmt.Errorf("application %s of channel %s not found", incoming.ApplicationID, channel.Name)
+		}
+		incoming.VHost = app.VHost
+
+		existing, err := c.h.Store.GetChannelByID(channel.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			appChannels, err := c.h.Store.GetChannelsByAppID(incoming.ApplicationID)
+			if err != nil {
+				return err
+			}
+			for i := range appChannels {
+				if appChannels[i].Name == channel.Name {
+					existing = &appChannels[i]
+					break
+				}
+			}
+		}
+
+		if existing == nil {
+			if err := c.h.RabbitMQ.SetupDurableTopology(rabbitmq.ChannelConnection(&incoming), incoming.Destination, rabbitmq.ChannelQueueOptions(&incoming)); err != nil {
+				return fmt.Errorf("setting up the topology of channel %s: %w", incoming.Name, err)
+			}
+			if err := c.h.Store.CreateChannel(&incoming); err != nil {
+				return err
+			}
+			c.h.RabbitMQ.StartChannelWorker(rabbitmq.ChannelConnection(&incoming), incoming.Direction, incoming.Destination)
+			c.ids[channel.ID] = incoming.ID
+			c.record("channel", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		c.ids[channel.ID] = existing.ID
+		// The application of a channel is fixed once it exists.
+		incoming.ID, incoming.ApplicationID, incoming.VHost, incoming.Revision, incoming.CreatedAt = existing.ID, existing.ApplicationID, existing.VHost, existing.Revision, existing.CreatedAt
+		if sameConfig(existing, &incoming) {
+			c.record("channel", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		// RabbitMQ cannot change the arguments of an existing queue.
+		if incoming.Destination == existing.Destination && sameConnection(incoming.Connection, existing.Connection) {
+			if incoming.MaxPriority != existing.MaxPriority {
+				return errors.New(c.h.I18n.Sprintf(c.lang, "Channel %s: %s", incoming.Name, c.h.I18n.Sprintf(c.lang, "The max priority of an existing queue cannot be changed. Use a new destination instead.")))
+			}
+			if incoming.QueueType != existing.QueueType || incoming.MessageTTL != existing.MessageTTL || incoming.LazyMode != existing.LazyMode {
+				return errors.New(c.h.I18n.Sprintf(c.lang, "Channel %s: %s", incoming.Name, c.h.I18n.Sprintf(c.lang, "The queue type, message TTL and lazy mode of an existing queue cannot be changed. Use a new destination instead.")))
+			}
+		}
+		if err := c.h.Store.UpdateChannel(&incoming); err != nil {
+			return err
+		}
+		if err := c.h.restartChannelWorkers(existing, &incoming); err != nil {
+			return fmt.Errorf("restarting the workers of channel %s: %w", incoming.Name, err)
+		}
+		c.record("channel", existing.ID, incoming.Name, configUpdated)
+	}
+	return nil
+}
+
+// importRoutes imports the routes with their routing rules and starts or restarts their routers.
+func (c *configImporter) importRoutes(routes []ConfigRoute) error {
+	all, err := c.h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		return err
+	}
+	for _, cr := range routes {
+		incoming := cr.Route
+		incoming.Tags = storage.NormalizeTags(incoming.Tags)
+		incoming.SourceChannelID = c.id(incoming.SourceChannelID)
+		incoming.DestinationChannelID = c.idPtr(incoming.DestinationChannelID)
+		incoming.TransformationID = c.idPtr(incoming.TransformationID)
+		incoming.IntegrationID = c.idPtr(incoming.IntegrationID)
+		if incoming.Pipeline != nil {
+			incoming.Pipeline = make([]string, len(cr.Pipeline))
+			for i, id := range cr.Pipeline {
+				incoming.Pipeline[i] = c.id(id)
+			}
+		}
+		if incoming.SampleChannelID != "" {
+			incoming.SampleChannelID = c.id(incoming.SampleChannelID)
+		}
+		if incoming.WiretapChannelID != "" {
+			incoming.WiretapChannelID = c.id(incoming.WiretapChannelID)
+		}
+		rules := make([]storage.RoutingRule, len(cr.RoutingRules))
+		for i, rule := range cr.RoutingRules {
+			rules[i] = storage.RoutingRule{Field: rule.Field, Operator: rule.Operator, Value: rule.Value, DestinationChannelID: c.id(rule.DestinationChannelID)}
+		}
+
+		existing, err := c.h.Store.GetRouteByID(cr.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			// Route names are not unique, so only a single route of the same name is a match.
+			var matchID string
+			matches := 0
+			for _, info := range all {
+				if info.Name == cr.Name {
+					matchID = info.ID
+					matches++
+				}
+			}
+			if matches == 1 {
+				if existing, err = c.h.Store.GetRouteByID(matchID); err != nil {
+					return err
+				}
+			}
+		}
+
+		if existing == nil {
+			if err := c.h.Store.CreateRoute(&incoming); err != nil {
+				return err
+			}
+			if err := c.replaceRoutingRules(incoming.ID, nil, rules); err != nil {
+				return err
+			}
+			c.h.RabbitMQ.StartRouter(incoming.ID, incoming.Name, incoming.SourceChannelID)
+			c.ids[cr.ID] = incoming.ID
+			c.record("route", incoming.ID, incoming.Name, configCreated)
+			continue
+		}
+
+		c.ids[cr.ID] = existing.ID
+		incoming.ID, incoming.Revision, incoming.CreatedAt = existing.ID, existing.Revision, existing.CreatedAt
+		existingRules, err := c.h.Store.GetRoutingRules(existing.ID)
+		if err != nil {
+			return err
+		}
+		routeChanged := !sameConfig(existing, &incoming)
+		rulesChanged := !sameRoutingRules(existingRules, rules)
+		if !routeChanged && !rulesChanged {
+			c.record("route", existing.ID, existing.Name, configUnchanged)
+			continue
+		}
+		if routeChanged {
+			if err := c.h.Store.UpdateRoute(&incoming); err != nil {
+				return err
+			}
+		}
+		if rulesChanged {
+			if err := c.replaceRoutingRules(existing.ID, existingRules, rules); err != nil {
+				return err
+			}
+		}
+		c.h.RabbitMQ.RestartRouter(incoming.ID, incoming.Name, incoming.SourceChannelID)
+		c.record("route", existing.ID, incoming.Name, configUpdated)
+	}
+	return nil
+}
+
+// replaceRoutingRules replaces the routing rules of a route with the given ones, in their order.
+func (c *configImporter) replaceRoutingRules(routeID string, existing, rules []storage.RoutingRule) error {
+	for _, rule := range existing {
+		if err := c.h.Store.DeleteRoutingRule(routeID, rule.ID); err != nil {
+			return err
+		}
+	}
+	for _, rule := range rules {
+		rule.ID = uuid.New().String()
+		rule.RouteID = routeID
+		if err := c.h.Store.CreateRoutingRule(&rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// libraryKey identifies a script library by its engine and the name scripts import it by.
+func libraryKey(engine, name string) string {
+	return engine + "/" + name
+}
+
+// sameRoutingRules reports whether two lists of routing rules match the same messages to the same channels.
+func sameRoutingRules(a, b []storage.RoutingRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Field != b[i].Field || a[i].Operator != b[i].Operator || a[i].Value != b[i].Value || a[i].DestinationChannelID != b[i].DestinationChannelID {
+			return false
+		}
+	}
+	return true
+}
+
+// sameConfig reports whether two objects have the same JSON encoding, the form the configuration is
+// exported in.
+func sameConfig(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// configImportStatus renders the result of an import from the admin page for the status message.
+func (h *Handler) configImportStatus(lang string, r *http.Request) string {
+	count := func(name string) int {
+		n, _ := strconv.Atoi(r.URL.Query().Get(name))
+		return n
+	}
+	return h.I18n.Sprintf(lang, "Configuration imported: %d created, %d updated, %d unchanged.", count("created"), count("updated"), count("unchanged"))
+}
@@ -0,0 +1,199 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// ConfigDirStatus is the state of the configuration directory watcher shown on the admin page.
+type ConfigDirStatus struct {
+	Dir         string
+	Files       int       // YAML files read by the last run
+	LastChecked time.Time // Last time a change of the directory was applied, with or without errors
+	LastApplied time.Time // Last time the directory was applied without error
+	LastReport  ConfigImportReport
+	LastError   string
+}
+
+// defaultConfigDirInterval is how often the configuration directory is checked when no interval is set.
+const defaultConfigDirInterval = 30 * time.Second
+
+// configDirWatcher reconciles a directory of YAML configuration files into the database.
+type configDirWatcher struct {
+	mu          sync.Mutex // Guards status
+	status      ConfigDirStatus
+	fingerprint string // Hash of the files of the last run, to apply each state of the directory once
+}
+
+// StartConfigDirWatcher applies the YAML files of dir with the configuration import, then checks the
+// directory every interval and applies it again whenever a file changes. The files hold the sections of
+// a configuration export (applications, channels, integrations, transformations, collectors and routes)
+// with the same fields, so the configuration can be kept in Git. Like an import from the admin page,
+// objects that are removed from the files are not deleted.
+func (h *Handler) StartConfigDirWatcher(dir string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultConfigDirInterval
+	}
+	h.configDir = &configDirWatcher{status: ConfigDirStatus{Dir: dir}}
+	h.Logger.Info("configuration directory enabled", "dir", dir, "interval", interval.String())
+
+	go func() {
+		h.applyConfigDir()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.applyConfigDir()
+		}
+	}()
+}
+
+// configDirStatus returns the state of the configuration directory watcher, or nil when it is off.
+func (h *Handler) configDirStatus() *ConfigDirStatus {
+	if h.configDir == nil {
+		return nil
+	}
+	h.configDir.mu.Lock()
+	defer h.configDir.mu.Unlock()
+	status := h.configDir.status
+	return &status
+}
+
+// applyConfigDir imports the configuration directory if it changed since the last run. A directory that
+// fails to load or import is retried only once it changes again. It runs on the watcher goroutine only.
+func (h *Handler) applyConfigDir() {
+	watcher := h.configDir
+	bundle, files, fingerprint, err := loadConfigDir(watcher.status.Dir)
+	if err == nil && fingerprint == watcher.fingerprint {
+		return
+	}
+	watcher.fingerprint = fingerprint
+
+	var report ConfigImportReport
+	if err == nil {
+		// The errors go to the log, so they are reported in English.
+		err = h.validateConfigBundle(bundle, "en")
+	}
+	if err == nil {
+		importer := newConfigImporter(h, "en")
+		err = importer.run(bundle)
+		report = importer.report
+	}
+
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	watcher.status.Files = files
+	watcher.status.LastChecked = time.Now()
+	watcher.status.LastReport = report
+	if err != nil {
+		watcher.status.LastError = err.Error()
+		h.Logger.Error("failed to apply configuration directory", "dir", watcher.status.Dir, "error", err)
+		return
+	}
+	watcher.status.LastError = ""
+	watcher.status.LastApplied = watcher.status.LastChecked
+	h.Logger.Info("configuration directory applied", "dir", watcher.status.Dir, "files", files, "created", report.Created, "updated", report.Updated, "unchanged", report.Unchanged)
+}
+
+// loadConfigDir reads the .yaml and .yml files below dir in lexical order and merges their sections into
+// one configuration, taking the transformation hooks of the last file that sets them. It also returns the
+// number of files and a fingerprint of their names and contents.
+func loadConfigDir(dir string) (*ConfigBundle, int, string, error) {
+	bundle := &ConfigBundle{Format: configBundleFormat}
+	hash := sha256.New()
+	files := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files++
+		fmt.Fprintf(hash, "%s\x00%d\x00", path, len(data))
+		hash.Write(data)
+
+		part, err := parseConfigYAML(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if part.Format != "" && part.Format != configBundleFormat {
+			return fmt.Errorf("%s: unsupported configuration format %q, expected %q", path, part.Format, configBundleFormat)
+		}
+		bundle.Applications = append(bundle.Applications, part.Applications...)
+		bundle.Channels = append(bundle.Channels, part.Channels...)
+		bundle.Integrations = append(bundle.Integrations, part.Integrations...)
+		bundle.ScriptLibraries = append(bundle.ScriptLibraries, part.ScriptLibraries...)
+		bundle.Transformations = append(bundle.Transformations, part.Transformations...)
+		if part.TransformationHooks != nil {
+			bundle.TransformationHooks = part.TransformationHooks
+		}
+		bundle.FileServers = append(bundle.FileServers, part.FileServers...)
+		bundle.SQLConnections = append(bundle.SQLConnections, part.SQLConnections...)
+		bundle.Collectors = append(bundle.Collectors, part.Collectors...)
+		bundle.Routes = append(bundle.Routes, part.Routes...)
+		return nil
+	})
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+	if err != nil {
+		return nil, files, fingerprint, err
+	}
+	return bundle, files, fingerprint, nil
+}
+
+// parseConfigYAML decodes a YAML configuration file into the configuration it holds. The YAML is converted
+// to JSON first, so the files use the fields of the JSON export; unknown fields are rejected to catch typos.
+func parseConfigYAML(data []byte) (*ConfigBundle, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(yamlToJSON(doc))
+	if err != nil {
+		return nil, err
+	}
+	part := &ConfigBundle{}
+	if doc == nil {
+		return part, nil // An empty file
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(part); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+// yamlToJSON converts the maps decoded by YAML, which may have keys of any type, into JSON objects.
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = yamlToJSON(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = yamlToJSON(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,225 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// Limits of the operations dashboard.
+const (
+	dashboardQueueCount   = 10               // Deepest queues listed
+	dashboardErrorCount   = 10               // Recent errors listed
+	dashboardRateAge      = 10 * time.Minute // Period of the message rate sparkline
+	dashboardRateInterval = 30 * time.Second // Step of the message rate sparkline
+)
+
+// Size of the message rate sparkline in pixels.
+const (
+	sparklineWidth  = 200
+	sparklineHeight = 40
+)
+
+// Dashboard is the state of the service shown on the landing page of the admin interface.
+type Dashboard struct {
+	Workers        []DashboardWorkers
+	OpenBreakers   int // Destination channels whose circuit breaker is open or half-open
+	SilentChannels int // Channels with a silence alert that have gone quiet
+	Connections    []DashboardConnection
+	Queues         []DashboardQueue // Deepest queues of every connection, deepest first
+	Errors         []DashboardError // Latest dead letters and failed collector runs, newest first
+}
+
+// DashboardWorkers counts the workers of a kind. Stopped is only known for the channel workers and the
+// routers, which should run for every channel and enabled route.
+type DashboardWorkers struct {
+	Kind    string
+	Running int
+	Stopped int
+}
+
+// DashboardConnection is the state of a broker connection and its message rates.
+type DashboardConnection struct {
+	Name            string
+	Connected       bool   // Both the consumer and the publisher connection are open
+	ManagementError string // Why the Management API could not be read, empty when it could
+	Rates           *rabbitmq.MessageRates
+	Sparkline       string  // Points of the SVG polyline of the publish rate history
+	PeakRate        float64 // Highest publish rate of the sparkline, its top
+}
+
+// DashboardQueue is a queue of a broker connection with its depth.
+type DashboardQueue struct {
+	Connection string
+	rabbitmq.QueueInfo
+}
+
+// DashboardError is a recent failure, linked to the page it can be looked into on.
+type DashboardError struct {
+	Time    time.Time
+	Source  string // Route or collector name
+	Link    string
+	Message string
+}
+
+// handleDashboard renders the landing page of the admin interface: the worker registry, the broker
+// connections with their deepest queues and message rates, and the latest errors.
+func (h *Handler) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	dashboard, err := h.dashboard(lang)
+	if err != nil {
+		h.renderError(w, "admin.html", err.Error(), http.StatusInternalServerError, r)
+		return
+	}
+
+	data := PageData{
+		Dashboard:      dashboard,
+		Version:        h.Version,
+		AcceptLanguage: lang,
+	}
+	data.ConfigDir = h.configDirStatus()
+	data.BackupAvailable = h.Store.SupportsBackup()
+
+	status := r.URL.Query().Get("status")
+	if status == "recreated" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "All queues and routes recreated successfully!")
+	} else if pruned := r.URL.Query().Get("pruned"); pruned != "" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Pruned orphan channels: %s", pruned)
+	} else if status == "config_imported" {
+		data.StatusMessage = h.configImportStatus(lang, r)
+	} else if status == "backup_restored" {
+		data.StatusMessage = h.backupRestoredStatus(lang, r)
+	}
+
+	h.renderTemplate(w, "admin.html", data)
+}
+
+// dashboard collects the state shown on the dashboard. A broker whose Management API cannot be read is
+// shown with the error instead of its queues and rates.
+func (h *Handler) dashboard(lang string) (*Dashboard, error) {
+	channels, err := h.Store.GetAllChannels(storage.ListFilter{})
+	if err != nil {
+		return nil, errors.New(h.I18n.Sprintf(lang, "Failed to retrieve channels from database: %s", err.Error()))
+	}
+	routes, err := h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		return nil, errors.New(h.I18n.Sprintf(lang, "Failed to retrieve routes: %s", err.Error()))
+	}
+
+	summary := h.RabbitMQ.WorkerSummary()
+	dashboard := &Dashboard{OpenBreakers: summary.OpenBreakers, SilentChannels: summary.SilentChannels}
+	stopped := make(map[string]int)
+	for _, ch := range h.stoppedChannelWorkers(channels) {
+		stopped[ch.Direction]++
+	}
+	for _, route := range routes {
+		if !route.Disabled && !h.RabbitMQ.IsRouterRunning(route.ID) {
+			stopped["router"]++
+		}
+	}
+	for _, kind := range rabbitmq.WorkerKinds {
+		dashboard.Workers = append(dashboard.Workers, DashboardWorkers{Kind: kind, Running: summary.Running[kind], Stopped: stopped[kind]})
+	}
+	dashboard.Workers = append(dashboard.Workers, DashboardWorkers{Kind: rabbitmq.WorkerKindJob, Running: summary.Running[rabbitmq.WorkerKindJob]})
+
+	for _, name := range h.RabbitMQ.ConnectionNames() {
+		conn := DashboardConnection{Name: name, Connected: h.RabbitMQ.IsConnected(name)}
+		queues, err := h.RabbitMQ.ListQueues(name)
+		if err != nil {
+			conn.ManagementError = err.Error()
+			dashboard.Connections = append(dashboard.Connections, conn)
+			continue
+		}
+		for _, q := range queues {
+			dashboard.Queues = append(dashboard.Queues, DashboardQueue{Connection: name, QueueInfo: q})
+		}
+		if conn.Rates, err = h.RabbitMQ.MessageRates(name, dashboardRateAge, dashboardRateInterval); err != nil {
+			conn.ManagementError = err.Error()
+		} else {
+			conn.Sparkline, conn.PeakRate = sparkline(conn.Rates.PublishHist, sparklineWidth, sparklineHeight)
+		}
+		dashboard.Connections = append(dashboard.Connections, conn)
+	}
+	sort.SliceStable(dashboard.Queues, func(i, j int) bool {
+		return dashboard.Queues[i].Messages > dashboard.Queues[j].Messages
+	})
+	if len(dashboard.Queues) > dashboardQueueCount {
+		dashboard.Queues = dashboard.Queues[:dashboardQueueCount]
+	}
+
+	if dashboard.Errors, err = h.recentErrors(); err != nil {
+		h.Logger.Error("failed to get recent errors for the dashboard", "error", err)
+	}
+	return dashboard, nil
+}
+
+// recentErrors returns the latest dead letters and failed collector runs, newest first.
+func (h *Handler) recentErrors() ([]DashboardError, error) {
+	deadLetters, err := h.Store.SearchDeadLetters(storage.DeadLetterSearch{Limit: dashboardErrorCount})
+	if err != nil {
+		return nil, err
+	}
+	runs, err := h.Store.GetFailedCollectorRuns(dashboardErrorCount)
+	if err != nil {
+		return nil, err
+	}
+	collectors, err := h.Store.GetAllCollectors()
+	if err != nil {
+		return nil, err
+	}
+	collectorNames := make(map[string]string, len(collectors))
+	for _, c := range collectors {
+		collectorNames[c.ID] = c.Name
+	}
+
+	var errs []DashboardError
+	for _, msg := range deadLetters {
+		errs = append(errs, DashboardError{
+			Time: msg.CreatedAt, Source: msg.RouteName, Link: fmt.Sprintf("/admin/dead-letters/%d", msg.ID), Message: msg.Reason,
+		})
+	}
+	for _, run := range runs {
+		name := collectorNames[run.CollectorID]
+		if name == "" {
+			name = run.CollectorID
+		}
+		errs = append(errs, DashboardError{
+			Time: run.FinishedAt, Source: name, Link: "/admin/collectors/" + run.CollectorID, Message: run.Error,
+		})
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Time.After(errs[j].Time) })
+	if len(errs) > dashboardErrorCount {
+		errs = errs[:dashboardErrorCount]
+	}
+	return errs, nil
+}
+
+// sparkline returns the points of an SVG polyline drawing values from left to right in a box of the given
+// size, scaled to the highest value, and that value.
+func sparkline(values []float64, width, height int) (string, float64) {
+	if len(values) < 2 {
+		return "", 0
+	}
+	peak := 0.0
+	for _, v := range values {
+		if v > peak {
+			peak = v
+		}
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := float64(i) * float64(width) / float64(len(values)-1)
+		y := float64(height)
+		if peak > 0 {
+			y -= v / peak * float64(height)
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " "), peak
+}
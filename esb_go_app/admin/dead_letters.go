@@ -0,0 +1,177 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// DeadLetterRoutes handles routing for /admin/dead-letters.
+func DeadLetterRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET /admin/dead-letters[?route=&q=]
+	if r.Method == http.MethodGet && (len(parts) == 0 || (len(parts) == 1 && parts[0] == "")) {
+		h.handleDeadLetters(w, r)
+		return
+	}
+
+	// GET /admin/dead-letters/{id}
+	if r.Method == http.MethodGet && len(parts) == 1 {
+		h.handleDeadLetter(w, r, parts[0])
+		return
+	}
+
+	// POST /admin/dead-letters/replay
+	if r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "replay" {
+		h.handleReplayDeadLetters(w, r)
+		return
+	}
+
+	// POST /admin/dead-letters/delete
+	if r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "delete" {
+		h.handleDeleteDeadLetters(w, r)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// handleDeadLetters lists the dead letters matching the route and search term of the query.
+func (h *Handler) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	query := r.URL.Query()
+	data := PageData{
+		DeadLetterSearch: storage.DeadLetterSearch{
+			RouteID: query.Get("route"),
+			Term:    strings.TrimSpace(query.Get("q")),
+			Limit:   h.listSize(),
+		},
+		AcceptLanguage: lang,
+	}
+
+	routes, err := h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "Failed to get routes: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	data.Routes = routes
+
+	data.DeadLetters, err = h.Store.SearchDeadLetters(data.DeadLetterSearch)
+	if err != nil {
+		h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "Failed to read the dead letters: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	switch query.Get("status") {
+	case "replayed":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Dead letters replayed: %s", query.Get("count"))
+	case "deleted":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Dead letters deleted: %s", query.Get("count"))
+	}
+	h.renderTemplate(w, "dead_letters.html", data)
+}
+
+// handleDeadLetter shows a dead letter with its headers and body.
+func (h *Handler) handleDeadLetter(w http.ResponseWriter, r *http.Request, idParam string) {
+	lang := h.determineLanguage(r)
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	msg, err := h.Store.GetDeadLetter(id)
+	if err != nil {
+		h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "Failed to read the dead letters: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if msg == nil {
+		h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "Dead letter not found."), http.StatusNotFound, r)
+		return
+	}
+
+	data := PageData{
+		DeadLetter:     msg,
+		AcceptLanguage: lang,
+	}
+	if msg.Headers != "" {
+		_ = json.Unmarshal([]byte(msg.Headers), &data.DeadLetterHeaders)
+	}
+	h.renderTemplate(w, "dead_letters.html", data)
+}
+
+// handleReplayDeadLetters republishes the selected dead letters to the source queues of their routes and
+// removes them, stopping at the first one that cannot be replayed.
+func (h *Handler) handleReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	messages, ok := h.selectedDeadLetters(w, r, lang)
+	if !ok {
+		return
+	}
+	for i := range messages {
+		if err := h.RabbitMQ.ReplayDeadLetter(&messages[i]); err != nil {
+			h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "Failed to replay dead letters after %d of them: %s", i, err.Error()), http.StatusBadGateway, r)
+			return
+		}
+	}
+	h.Logger.Info("replayed dead letters", "count", len(messages))
+	h.redirectToDeadLetters(w, r, "replayed", len(messages))
+}
+
+// handleDeleteDeadLetters deletes the selected dead letters without replaying them.
+func (h *Handler) handleDeleteDeadLetters(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	messages, ok := h.selectedDeadLetters(w, r, lang)
+	if !ok {
+		return
+	}
+	for _, msg := range messages {
+		if err := h.Store.DeleteDeadLetter(msg.ID); err != nil {
+			h.renderError(w, "dead_letters.html", err.Error(), http.StatusInternalServerError, r)
+			return
+		}
+	}
+	h.Logger.Info("deleted dead letters", "count", len(messages))
+	h.redirectToDeadLetters(w, r, "deleted", len(messages))
+}
+
+// selectedDeadLetters loads the dead letters selected in the form of a request, rendering the error page
+// when there are none.
+func (h *Handler) selectedDeadLetters(w http.ResponseWriter, r *http.Request, lang string) ([]storage.DeadLetter, bool) {
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return nil, false
+	}
+	var messages []storage.DeadLetter
+	for _, idParam := range r.Form["message"] {
+		id, err := strconv.ParseInt(idParam, 10, 64)
+		if err != nil {
+			continue
+		}
+		msg, err := h.Store.GetDeadLetter(id)
+		if err != nil {
+			h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "Failed to read the dead letters: %s", err.Error()), http.StatusInternalServerError, r)
+			return nil, false
+		}
+		if msg != nil {
+			messages = append(messages, *msg)
+		}
+	}
+	if len(messages) == 0 {
+		h.renderError(w, "dead_letters.html", h.I18n.Sprintf(lang, "No messages selected."), http.StatusBadRequest, r)
+		return nil, false
+	}
+	return messages, true
+}
+
+// redirectToDeadLetters returns to the dead-letter list, filtered by the route it was showing.
+func (h *Handler) redirectToDeadLetters(w http.ResponseWriter, r *http.Request, status string, count int) {
+	target := fmt.Sprintf("/admin/dead-letters?status=%s&count=%d", status, count)
+	if routeID := r.FormValue("route"); routeID != "" {
+		target += "&route=" + url.QueryEscape(routeID)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
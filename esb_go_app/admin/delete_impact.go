@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"net/http"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// DeleteImpact is what deleting a channel or a transformation does to the routes and workers using it,
+// shown for confirmation before the deletion.
+type DeleteImpact struct {
+	Kind         string // storage.TrashChannel or storage.TrashTransformation
+	Name         string
+	ConfirmURL   string // The confirmation form posts the deletion here
+	CancelURL    string
+	Routes       []storage.RouteDependent
+	Worker       string // Destination of the channel worker stopped by the deletion, empty for a transformation
+	SharedWith   string // Another channel using the same destination, which keeps the worker and the topology
+	BlockedError string // Why the object cannot be deleted yet, empty when it can
+}
+
+// handleDeleteChannelImpact shows what deleting a channel does before it is confirmed.
+func (h *Handler) handleDeleteChannelImpact(w http.ResponseWriter, r *http.Request, appID, channelID string) {
+	lang := h.determineLanguage(r)
+	ch, err := h.Store.GetChannelByID(channelID)
+	if err != nil || ch == nil || ch.ApplicationID != appID {
+		http.NotFound(w, r)
+		return
+	}
+	impact := &DeleteImpact{
+		Kind:       storage.TrashChannel,
+		Name:       ch.Name,
+		ConfirmURL: "/admin/app/" + appID + "/channel/" + channelID + "/delete",
+		CancelURL:  "/admin/app/" + appID,
+		Worker:     ch.Destination,
+	}
+	if impact.Routes, err = h.Store.ChannelDependents(channelID); err != nil {
+		h.renderError(w, "delete_impact.html", h.I18n.Sprintf(lang, "Failed to find the routes using the channel: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	shared, err := h.sharedDestinationChannel(ch)
+	if err != nil {
+		h.renderError(w, "delete_impact.html", h.I18n.Sprintf(lang, "Failed to retrieve channels: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if shared != nil {
+		impact.SharedWith = shared.Name
+	}
+	h.renderTemplate(w, "delete_impact.html", PageData{DeleteImpact: impact, AcceptLanguage: lang})
+}
+
+// handleDeleteTransformationImpact shows what deleting a transformation does before it is confirmed.
+func (h *Handler) handleDeleteTransformationImpact(w http.ResponseWriter, r *http.Request, transformationID string) {
+	lang := h.determineLanguage(r)
+	t, err := h.Store.GetTransformationByID(transformationID)
+	if err != nil || t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	impact := &DeleteImpact{
+		Kind:       storage.TrashTransformation,
+		Name:       t.Name,
+		ConfirmURL: "/admin/transformations/" + transformationID + "/delete",
+		CancelURL:  "/admin/transformations",
+	}
+	if h.loadTransformationHooks().Uses(transformationID) {
+		impact.BlockedError = h.I18n.Sprintf(lang, "The transformation is a global hook. Remove it from the hook settings before deleting it.")
+	}
+	if impact.Routes, err = h.Store.TransformationDependents(transformationID); err != nil {
+		h.renderError(w, "delete_impact.html", h.I18n.Sprintf(lang, "Failed to find the routes using the transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.renderTemplate(w, "delete_impact.html", PageData{DeleteImpact: impact, AcceptLanguage: lang})
+}
+
+// releaseRouters stops the routers of the routes a deletion moved to the trash and restarts those of the
+// routes it changed, which stops the routers of the routes it disabled.
+func (h *Handler) releaseRouters(dependents []storage.RouteDependent) {
+	for _, d := range dependents {
+		if d.WasDisabled {
+			continue
+		}
+		if d.Action == storage.DependentDeleted {
+			h.RabbitMQ.StopRouter(d.RouteID)
+			continue
+		}
+		h.RabbitMQ.RestartRouter(d.RouteID, d.RouteName, d.SourceChannelID)
+	}
+}
+
+// deleteChannelTopology deletes the durable queue and exchange of a deleted channel from the broker,
+// unless another channel still uses them.
+func (h *Handler) deleteChannelTopology(ch *storage.Channel) error {
+	shared, err := h.sharedDestinationChannel(ch)
+	if err != nil {
+		return err
+	}
+	if shared != nil {
+		h.Logger.Info("destination still used by another channel, keeping topology", "channel_id", ch.ID, "destination", ch.Destination)
+		return nil
+	}
+	return h.RabbitMQ.DeleteDurableTopology(rabbitmq.ChannelConnection(ch), ch.Destination)
+}
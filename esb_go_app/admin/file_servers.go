@@ -0,0 +1,204 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"esb-go-app/storage"
+)
+
+// FileServerRoutes handles routing for /admin/file-servers/* paths.
+func FileServerRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	if r.Method == http.MethodGet {
+		if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+			h.handleListFileServers(w, r)
+			return
+		}
+		if len(parts) == 1 {
+			serverID := parts[0]
+			h.handleViewFileServer(w, r, serverID)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		if len(parts) == 1 && parts[0] == "create" {
+			h.handleCreateFileServer(w, r)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "update" {
+			serverID := parts[0]
+			h.handleUpdateFileServer(w, r, serverID)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "delete" {
+			serverID := parts[0]
+			h.handleDeleteFileServer(w, r, serverID)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (h *Handler) handleListFileServers(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	servers, err := h.Store.GetAllFileServers()
+	if err != nil {
+		h.renderError(w, "file_servers.html", h.I18n.Sprintf(lang, "Failed to retrieve file servers: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	data := PageData{
+		FileServers:    servers,
+		AcceptLanguage: lang,
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "created" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "File server created successfully!")
+	} else if status == "deleted" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "File server deleted.")
+	} else if status == "updated" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "File server updated successfully!")
+	}
+
+	h.renderTemplate(w, "file_servers.html", data)
+}
+
+func (h *Handler) handleViewFileServer(w http.ResponseWriter, r *http.Request, serverID string) {
+	lang := h.determineLanguage(r)
+	server, err := h.Store.GetFileServerByID(serverID)
+	if err != nil {
+		h.renderError(w, "file_servers.html", h.I18n.Sprintf(lang, "Failed to retrieve file server: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if server == nil {
+		h.renderError(w, "file_servers.html", h.I18n.Sprintf(lang, "File server not found."), http.StatusNotFound, r)
+		return
+	}
+
+	data := PageData{
+		FileServer:     server,
+		AcceptLanguage: lang,
+	}
+	h.renderTemplate(w, "file_server_details.html", data)
+}
+
+// fileServerFromForm reads the server fields of the create and edit forms. An empty port means the
+// default port of the protocol.
+func (h *Handler) fileServerFromForm(r *http.Request, serverID string) *storage.FileServer {
+	server := &storage.FileServer{
+		ID:                serverID,
+		Name:              strings.TrimSpace(r.FormValue("name")),
+		Description:       r.FormValue("description"),
+		Protocol:          r.FormValue("protocol"),
+		Host:              strings.TrimSpace(r.FormValue("host")),
+		Username:          strings.TrimSpace(r.FormValue("username")),
+		Password:          r.FormValue("password"),
+		PrivateKey:        strings.TrimSpace(r.FormValue("private_key")),
+		HostKey:           strings.TrimSpace(r.FormValue("host_key")),
+		SkipHostKeyVerify: r.FormValue("skip_host_key_verify") == "on",
+	}
+	if port, err := strconv.Atoi(strings.TrimSpace(r.FormValue("port"))); err == nil {
+		server.Port = port
+	} else {
+		server.Port = storage.FileServerProtocols[server.Protocol]
+	}
+	return server
+}
+
+// validateFileServer returns the message to show when a submitted file server is incomplete.
+func (h *Handler) validateFileServer(lang string, f *storage.FileServer) string {
+	if f.Name == "" || f.Protocol == "" || f.Host == "" {
+		return h.I18n.Sprintf(lang, "Name, protocol, and host are required.")
+	}
+	if _, ok := storage.FileServerProtocols[f.Protocol]; !ok {
+		return h.I18n.Sprintf(lang, "Unsupported file server protocol: %s", f.Protocol)
+	}
+	if f.Port <= 0 || f.Port > 65535 {
+		return h.I18n.Sprintf(lang, "Port must be between 1 and 65535.")
+	}
+	if f.Protocol == "sftp" && f.HostKey == "" && !f.SkipHostKeyVerify {
+		return h.I18n.Sprintf(lang, "An SFTP server needs its host key, unless its verification is skipped.")
+	}
+	return ""
+}
+
+func (h *Handler) handleCreateFileServer(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "file_servers.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	server := h.fileServerFromForm(r, uuid.New().String())
+	if msg := h.validateFileServer(lang, server); msg != "" {
+		h.renderError(w, "file_servers.html", msg, http.StatusBadRequest, r)
+		return
+	}
+
+	if err := h.Store.CreateFileServer(server); err != nil {
+		h.renderError(w, "file_servers.html", h.I18n.Sprintf(lang, "Failed to create file server: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("file server created successfully", "server_name", server.Name, "server_id", server.ID)
+	http.Redirect(w, r, "/admin/file-servers?status=created", http.StatusSeeOther)
+}
+
+// handleUpdateFileServer saves the edit form. The password and private key are never sent back to the
+// browser, so leaving them empty keeps the stored ones; the clear_credentials box removes them.
+func (h *Handler) handleUpdateFileServer(w http.ResponseWriter, r *http.Request, serverID string) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "file_server_details.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	existing, err := h.Store.GetFileServerByID(serverID)
+	if err != nil {
+		h.renderError(w, "file_server_details.html", h.I18n.Sprintf(lang, "Failed to retrieve file server: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if existing == nil {
+		h.renderError(w, "file_servers.html", h.I18n.Sprintf(lang, "File server not found."), http.StatusNotFound, r)
+		return
+	}
+
+	server := h.fileServerFromForm(r, serverID)
+	if r.FormValue("clear_credentials") != "on" {
+		if server.Password == "" {
+			server.Password = existing.Password
+		}
+		if server.PrivateKey == "" {
+			server.PrivateKey = existing.PrivateKey
+		}
+	}
+	if msg := h.validateFileServer(lang, server); msg != "" {
+		h.renderError(w, "file_server_details.html", msg, http.StatusBadRequest, r)
+		return
+	}
+
+	if err := h.Store.UpdateFileServer(server); err != nil {
+		h.renderError(w, "file_server_details.html", h.I18n.Sprintf(lang, "Failed to update file server: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("file server updated successfully", "server_id", serverID)
+	http.Redirect(w, r, "/admin/file-servers?status=updated", http.StatusSeeOther)
+}
+
+func (h *Handler) handleDeleteFileServer(w http.ResponseWriter, r *http.Request, serverID string) {
+	lang := h.determineLanguage(r)
+	if err := h.Store.DeleteFileServer(serverID); err != nil {
+		h.renderError(w, "file_servers.html", h.I18n.Sprintf(lang, "Failed to delete file server: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("file server deleted successfully", "server_id", serverID)
+	http.Redirect(w, r, "/admin/file-servers?status=deleted", http.StatusSeeOther)
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"html/template"
 	"log/slog"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"esb-go-app/i18n"
 )
@@ -18,40 +20,114 @@ type PageData struct {
 	Application           *storage.Application
 	Channels              []storage.Channel
 	Channel               *storage.Channel // For detail pages
+	ChannelExamples       *ChannelExamples // Publish/consume snippets for the channel details page
+	BrokerConnections     []string         // Configured RabbitMQ connection names for the channel forms
+	ChannelLastMessage    string           // When the channel worker last saw a message, empty if none since startup
+	ChannelSilent         bool             // The channel's silence alert is currently raised
+	WorkerRunning         bool             // The worker of the channel or router of the route on its details page is running
 	StatusMessage         string
 	ErrorMessage          string
+	FieldErrors           map[string]string // Messages of the invalid fields of a form shown again, keyed by field name
 	TestMessageReceived   string
 	TestMessageStatus     string
 	Routes                []storage.RouteInfo
-	Route                 *storage.RouteInfo // For detail pages
+	RouteStats            map[string]storage.RouteStats // Delivery statistics of the routes list, keyed by route ID
+	ListPage              *ListPage                     // Search and page of the routes or applications list
+	TagFilter             string                        // Tag the list of the page is filtered by, empty for all
+	TagOptions            []string                      // Tags offered by the tag filter of the list
+	DeleteImpact          *DeleteImpact                 // Routes and workers affected by a deletion awaiting confirmation
+	Route                 *storage.RouteInfo       // For detail pages
+	RouteVersions         []storage.RouteVersion   // Previous versions of the route on its details page, newest first
+	ParkingLotQueue       string                   // Parking-lot queue of the route on its details page
+	ReplyQueue            string                   // Reply queue of a request-reply route on its details page
+	ParkedMessages        []rabbitmq.ParkedMessage // Messages shown on the parking-lot page of a route
+	ParkedTotal           int                      // All messages in the route's parking lot, shown or not
+	DestinationBreaker    *rabbitmq.BreakerStatus  // Open circuit breaker of the route's destination, nil while closed
+	RouteOutsideWindow    bool                     // The route is paused outside its activity window
+	RouteDeadLetters      int                      // Dead letters the route stored in the database
+	RoutingRules          []storage.RoutingRule    // Content-based routing rules of the route on its details page
+	RoutingRuleOperators  []string                 // Operators offered by the routing rule form
 	RouteSources          []storage.RouteSource
 	InboundChannels       []storage.ChannelInfo
 	DestinationChannels   []storage.ChannelInfo // Unified list for destinations
 	Transformations       []storage.Transformation
 	Transformation        *storage.Transformation // For detail pages
+	TransformationTests   string                  // Tests of the transformation as indented JSON for the edit form
+	TransformationSamples string                  // Sample payloads of the transformation as indented JSON for the edit form
+	TestReport            *TransformationTestReport // Results of the last "Run tests" action of a transformation
+	ScriptExecutions      []storage.ScriptExecution // Latest runs of a transformation script by the routers, newest first
+	CollectorRuns         []storage.CollectorRun    // Latest runs of a collector, newest first
+	TransformationHistory []storage.TransformationVersion // Previous versions of the transformation on its page, newest first
+	ScriptDiff            *ScriptDiff                     // Comparison of two versions selected on the transformation page
+	ScriptLibraries       []storage.ScriptLibrary
+	ScriptLibrary         *storage.ScriptLibrary // For detail pages
+	SQLConnections        []storage.SQLConnection
+	SQLConnection         *storage.SQLConnection // For detail pages
+	FileServers           []storage.FileServer
+	FileServer            *storage.FileServer // For detail pages
 	Collectors            []storage.Collector
 	Collector             *storage.Collector // For detail pages
 	Integrations          []storage.Integration
 	Integration           *storage.Integration // For detail pages
 	Version               string
-	QueueRecon            *QueueReconResult
+	QueueRecon            []QueueReconResult
+	ShovelJobs            []rabbitmq.ShovelJob      // Move-messages jobs on the maintenance queues page
+	UnroutableCaptures    []UnroutableCapture       // Captured unroutable messages per broker connection
+	IntegrityReport       *IntegrityReport          // Broken references and stopped workers found by the integrity check
+	Dashboard             *Dashboard                // Workers, brokers and recent errors on the landing page
+	TraceQuery            string                    // Trace or message ID searched on the trace page
+	TraceHops             []storage.TraceHop        // Hops of the searched traces, in the order they happened
+	RecentTraces          []storage.TraceSummary    // Traces listed on the trace page when nothing is searched
+	TraceRouteNames       map[string]string         // Route names by ID for the trace page
+	ArchiveSearch         storage.ArchiveSearch     // Filters of the message archive page
+	ArchivedMessages      []storage.ArchivedMessage // Archived messages matching the filters, newest first
+	ArchivedMessage       *storage.ArchivedMessage  // Archived message shown in full
+	ArchivedHeaders       map[string]string         // Headers of the archived message shown in full
+	DeadLetterSearch      storage.DeadLetterSearch  // Filters of the dead-letter page
+	DeadLetters           []storage.DeadLetter      // Dead letters matching the filters, newest first
+	DeadLetter            *storage.DeadLetter       // Dead letter shown in full
+	DeadLetterHeaders     map[string]interface{}    // Headers of the dead letter shown in full
+	IntegrationStatuses   []IntegrationStatus       // For the public status page
 	SelectedIntegrationID string
 	MermaidDiagram        string
-	AcceptLanguage string
-	Settings       map[string]string // To hold current settings
+	AcceptLanguage        string
+	SettingGroups         []SettingGroup              // Typed settings of the settings page
+	ChannelDefaults       ChannelDefaults             // Defaults preset on the new channel form
+	MailSettings          *storage.MailSettings       // SMTP server of the mail module, shown in the settings
+	TransformationHooks   storage.TransformationHooks // Global hooks run around every route transformation, shown in the settings
+	ConfigDir             *ConfigDirStatus            // State of the configuration directory, nil unless it is enabled
+	BackupAvailable       bool                        // The database can be backed up and restored from the admin page
+	TrashItems            []storage.TrashItem         // Deleted routes, transformations and channels, most recent first
+	TrashRetentionDays    int                         // Days deleted objects stay in the trash, 0 for no limit
+	AuditEntries          []storage.AuditEntry        // Changes of the audit log matching AuditSearch, most recent first
+	AuditEntry            *storage.AuditEntry         // Change shown on the audit entry page
+	AuditSearch           storage.AuditSearch         // Filter of the audit log page
+	AuditKinds            []string                    // Kinds of objects offered by the audit log filter
+	AuditActors           []string                    // Users who made the changes of the audit log
+	AuditDiff             []DiffLine                  // Lines changed by the audit entry, when it has both values
+	SearchQuery           string                      // Term of the search page
+	SearchHits            []SearchHit                 // Objects matching SearchQuery, best matches first
+	User                  string                      // User making the request, as named by the authenticating proxy
+	Role                  string                      // Role of the user, secrets are only shown to admins
 }
 
 type Handler struct {
-	Store            *storage.Store
+	Store            storage.Store
 	RabbitMQ         *rabbitmq.RabbitMQ
 	Logger           *slog.Logger
 	templates        map[string]*template.Template
 	scriptingService *scripting.Service
 	Version          string
 	I18n             *i18n.Service
+	configDir        *configDirWatcher // Set by StartConfigDirWatcher
+	trashRetention   time.Duration     // Set by SetTrashRetention, 0 keeps deleted objects until they are purged
+	roles            map[string]string // Set by SetRoles, role of each user of the admin interface
+	defaultRole      string            // Set by SetRoles, role of the other users
+	userHeader       string            // Set by SetRoles, request header naming the user, empty for none
+	trustedProxies   []*net.IPNet      // Set by SetRoles, networks the user header is trusted from, all when empty
 }
 
-func NewHandler(s *storage.Store, r *rabbitmq.RabbitMQ, l *slog.Logger, ss *scripting.Service, version string, i18nService *i18n.Service) *Handler {
+func NewHandler(s storage.Store, r *rabbitmq.RabbitMQ, l *slog.Logger, ss *scripting.Service, version string, i18nService *i18n.Service) *Handler {
 	// Add a template function map
 	funcMap := template.FuncMap{
 		"T": func(key string, args ...interface{}) string {
@@ -68,22 +144,43 @@ func NewHandler(s *storage.Store, r *rabbitmq.RabbitMQ, l *slog.Logger, ss *scri
 			}
 			return s[start : start+length]
 		},
+		"join": strings.Join,
 	}
 
 	templates := make(map[string]*template.Template)
 	// Register all templates here and add the function map
 	templates["admin.html"] = template.Must(template.New("admin.html").Funcs(funcMap).ParseFiles("templates/admin.html", "templates/layout.html"))
+	templates["applications.html"] = template.Must(template.New("applications.html").Funcs(funcMap).ParseFiles("templates/applications.html", "templates/layout.html"))
 	templates["app_details.html"] = template.Must(template.New("app_details.html").Funcs(funcMap).ParseFiles("templates/app_details.html", "templates/layout.html"))
+	templates["delete_impact.html"] = template.Must(template.New("delete_impact.html").Funcs(funcMap).ParseFiles("templates/delete_impact.html", "templates/layout.html"))
 	templates["channel_details.html"] = template.Must(template.New("channel_details.html").Funcs(funcMap).ParseFiles("templates/channel_details.html", "templates/layout.html"))
 	templates["routes.html"] = template.Must(template.New("routes.html").Funcs(funcMap).ParseFiles("templates/routes.html", "templates/layout.html"))
 	templates["route_details.html"] = template.Must(template.New("route_details.html").Funcs(funcMap).ParseFiles("templates/route_details.html", "templates/layout.html"))
+	templates["route_parking_lot.html"] = template.Must(template.New("route_parking_lot.html").Funcs(funcMap).ParseFiles("templates/route_parking_lot.html", "templates/layout.html"))
 	templates["transformations.html"] = template.Must(template.New("transformations.html").Funcs(funcMap).ParseFiles("templates/transformations.html", "templates/layout.html"))
+	templates["audit.html"] = template.Must(template.New("audit.html").Funcs(funcMap).ParseFiles("templates/audit.html", "templates/layout.html"))
+	templates["search.html"] = template.Must(template.New("search.html").Funcs(funcMap).ParseFiles("templates/search.html", "templates/layout.html"))
+	templates["settings.html"] = template.Must(template.New("settings.html").Funcs(funcMap).ParseFiles("templates/settings.html", "templates/layout.html"))
+	templates["trash.html"] = template.Must(template.New("trash.html").Funcs(funcMap).ParseFiles("templates/trash.html", "templates/layout.html"))
 	templates["transformation_details.html"] = template.Must(template.New("transformation_details.html").Funcs(funcMap).ParseFiles("templates/transformation_details.html", "templates/layout.html"))
+	templates["libraries.html"] = template.Must(template.New("libraries.html").Funcs(funcMap).ParseFiles("templates/libraries.html", "templates/layout.html"))
+	templates["library_details.html"] = template.Must(template.New("library_details.html").Funcs(funcMap).ParseFiles("templates/library_details.html", "templates/layout.html"))
+	templates["sql_connections.html"] = template.Must(template.New("sql_connections.html").Funcs(funcMap).ParseFiles("templates/sql_connections.html", "templates/layout.html"))
+	templates["sql_connection_details.html"] = template.Must(template.New("sql_connection_details.html").Funcs(funcMap).ParseFiles("templates/sql_connection_details.html", "templates/layout.html"))
+	templates["file_servers.html"] = template.Must(template.New("file_servers.html").Funcs(funcMap).ParseFiles("templates/file_servers.html", "templates/layout.html"))
+	templates["file_server_details.html"] = template.Must(template.New("file_server_details.html").Funcs(funcMap).ParseFiles("templates/file_server_details.html", "templates/layout.html"))
 	templates["collectors.html"] = template.Must(template.New("collectors.html").Funcs(funcMap).ParseFiles("templates/collectors.html", "templates/layout.html"))
 	templates["collector_details.html"] = template.Must(template.New("collector_details.html").Funcs(funcMap).ParseFiles("templates/collector_details.html", "templates/layout.html"))
 	templates["maintenance_queues.html"] = template.Must(template.New("maintenance_queues.html").Funcs(funcMap).ParseFiles("templates/maintenance_queues.html", "templates/layout.html"))
+	templates["maintenance_unroutable.html"] = template.Must(template.New("maintenance_unroutable.html").Funcs(funcMap).ParseFiles("templates/maintenance_unroutable.html", "templates/layout.html"))
+	templates["maintenance_integrity.html"] = template.Must(template.New("maintenance_integrity.html").Funcs(funcMap).ParseFiles("templates/maintenance_integrity.html", "templates/layout.html"))
 	templates["integrations.html"] = template.Must(template.New("integrations.html").Funcs(funcMap).ParseFiles("templates/integrations.html", "templates/layout.html"))
+	templates["traces.html"] = template.Must(template.New("traces.html").Funcs(funcMap).ParseFiles("templates/traces.html", "templates/layout.html"))
+	templates["archive.html"] = template.Must(template.New("archive.html").Funcs(funcMap).ParseFiles("templates/archive.html", "templates/layout.html"))
+	templates["dead_letters.html"] = template.Must(template.New("dead_letters.html").Funcs(funcMap).ParseFiles("templates/dead_letters.html", "templates/layout.html"))
 	templates["integration_details.html"] = template.Must(template.New("integration_details.html").Funcs(funcMap).ParseFiles("templates/integration_details.html", "templates/layout.html"))
+	// The public status page has its own minimal layout without the admin navigation
+	templates["status_page.html"] = template.Must(template.New("status_page.html").Funcs(funcMap).ParseFiles("templates/status_page.html"))
 
 	return &Handler{
 		Store:            s,
@@ -100,7 +197,7 @@ func NewHandler(s *storage.Store, r *rabbitmq.RabbitMQ, l *slog.Logger, ss *scri
 // It prioritizes the language set in the database, falling back to the Accept-Language header.
 func (h *Handler) determineLanguage(r *http.Request) string {
 	// 1. Try to get language from DB
-	lang, err := h.Store.GetSetting("language")
+	lang, err := h.Store.GetStringSetting(languageSetting)
 	if err != nil {
 		h.Logger.Error("failed to get language setting from DB", "error", err)
 		// Fall through to using header
@@ -117,17 +214,27 @@ func (h *Handler) determineLanguage(r *http.Request) string {
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.Logger.Info("admin handler invoked", "method", r.Method, "path", r.URL.Path)
 
+	// Every request that may change something is recorded in the audit log.
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		h.route(w, r)
+		return
+	}
+	h.serveAudited(w, r)
+}
+
+// route dispatches an admin request to the handler of its section.
+func (h *Handler) route(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/admin")
 	parts := strings.Split(strings.Trim(path, "/"), "/")
 
-	if r.Method == http.MethodPost && path == "/settings/update" {
-		h.handleUpdateSettings(w, r)
+	w, ok := h.authorize(w, r, parts)
+	if !ok {
 		return
 	}
 
 	if len(parts) == 0 || parts[0] == "" {
 		if r.Method == http.MethodGet {
-			h.handleListAppsLegacy(w, r)
+			h.handleDashboard(w, r)
 			return
 		}
 		http.NotFound(w, r)
@@ -142,12 +249,36 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		RouteRoutes(h, w, r, subPath)
 	case "transformations":
 		TransformationRoutes(h, w, r, subPath)
+	case "libraries":
+		LibraryRoutes(h, w, r, subPath)
+	case "sql-connections":
+		SQLConnectionRoutes(h, w, r, subPath)
+	case "file-servers":
+		FileServerRoutes(h, w, r, subPath)
 	case "collectors":
 		CollectorRoutes(h, w, r, subPath)
 	case "integrations":
 		IntegrationRoutes(h, w, r, subPath)
 	case "maintenance":
 		MaintenanceRoutes(h, w, r, subPath)
+	case "traces":
+		TraceRoutes(h, w, r, subPath)
+	case "archive":
+		ArchiveRoutes(h, w, r, subPath)
+	case "dead-letters":
+		DeadLetterRoutes(h, w, r, subPath)
+	case "schema":
+		SchemaRoutes(h, w, r, subPath)
+	case "config":
+		ConfigRoutes(h, w, r, subPath)
+	case "trash":
+		TrashRoutes(h, w, r, subPath)
+	case "settings":
+		SettingsRoutes(h, w, r, subPath)
+	case "audit":
+		AuditRoutes(h, w, r, subPath)
+	case "search":
+		SearchRoutes(h, w, r, subPath)
 	default:
 		http.NotFound(w, r)
 	}
@@ -156,57 +287,32 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // handleUpdateSettings saves application-wide settings.
 func (h *Handler) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		h.renderError(w, "admin.html", "Failed to parse form.", http.StatusBadRequest, r)
+		h.renderError(w, "settings.html", "Failed to parse form.", http.StatusBadRequest, r)
 		return
 	}
 
-	lang := r.FormValue("language")
-	if lang != "" {
-		if err := h.Store.SetSetting("language", lang); err != nil {
-			h.renderError(w, "admin.html", "Failed to save language setting.", http.StatusInternalServerError, r)
+	if group := r.FormValue("settings_group"); group != "" {
+		if err := h.saveSettingGroup(r, h.determineLanguage(r), group); err != nil {
+			h.renderError(w, "settings.html", err.Error(), http.StatusBadRequest, r)
 			return
 		}
 	}
 
-	http.Redirect(w, r, "/admin?status=settings_updated", http.StatusSeeOther)
-}
-
-// This function will be removed once appRoutes correctly handles the root path.
-func (h *Handler) handleListAppsLegacy(w http.ResponseWriter, r *http.Request) {
-	lang := h.determineLanguage(r)
-
-	apps, err := h.Store.GetAllApplications()
-	if err != nil {
-		h.renderError(w, "admin.html", fmt.Sprintf("Failed to retrieve applications: %v", err), http.StatusInternalServerError, r)
-		return
-	}
-
-	// Get language setting for the dropdown
-	currentLang, err := h.Store.GetSetting("language")
-	if err != nil {
-		h.Logger.Error("failed to get language setting for admin page", "error", err)
-	}
-
-	data := PageData{
-		Applications:   apps,
-		Version:        h.Version,
-		AcceptLanguage: lang,
-		Settings:       map[string]string{"language": currentLang},
+	if r.FormValue("mail_settings") != "" {
+		if err := h.saveMailSettings(r, h.determineLanguage(r)); err != nil {
+			h.renderError(w, "settings.html", err.Error(), http.StatusBadRequest, r)
+			return
+		}
 	}
 
-	status := r.URL.Query().Get("status")
-	if status == "created" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "Application created successfully!")
-	} else if status == "recreated" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "All queues and routes recreated successfully!")
-	} else if pruned := r.URL.Query().Get("pruned"); pruned != "" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "Pruned orphan channels: %s", pruned)
-	} else if status == "settings_updated" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "Settings updated successfully.")
+	if r.FormValue("transformation_hooks") != "" {
+		if err := h.saveTransformationHooks(r, h.determineLanguage(r)); err != nil {
+			h.renderError(w, "settings.html", err.Error(), http.StatusBadRequest, r)
+			return
+		}
 	}
 
-
-	h.renderTemplate(w, "admin.html", data)
+	http.Redirect(w, r, "/admin/settings?status=settings_updated", http.StatusSeeOther)
 }
 
 func (h *Handler) renderTemplate(w http.ResponseWriter, name string, data PageData) {
@@ -224,6 +330,10 @@ func (h *Handler) renderTemplate(w http.ResponseWriter, name string, data PageDa
 		return
 	}
 
+	if rw, ok := w.(*roleResponseWriter); ok {
+		data.User, data.Role = rw.user, rw.role
+	}
+
 	// The FuncMap in NewHandler provides a placeholder for 'T'.
 	// Here we override it with a request-specific implementation.
 	clonedTmpl.Funcs(template.FuncMap{
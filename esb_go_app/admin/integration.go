@@ -197,7 +197,13 @@ func generateMermaidDiagram(collectors []storage.Collector, routes []storage.Rou
 		if r.TransformationID != "" {
 			transformNode := fmt.Sprintf("T%s", r.TransformationID)
 			sb.WriteString(fmt.Sprintf(`    %s["%s"]:::transform`+"\n", transformNode, template.HTMLEscapeString(r.TransformationName)))
-			sb.WriteString(fmt.Sprintf("    %s --> %s --> %s\n", sourceNode, transformNode, destNode))
+			chain := sourceNode + " --> " + transformNode
+			for i, id := range r.Pipeline {
+				stepNode := fmt.Sprintf("T%s", id)
+				sb.WriteString(fmt.Sprintf(`    %s["%s"]:::transform`+"\n", stepNode, template.HTMLEscapeString(r.PipelineNames[i])))
+				chain += " --> " + stepNode
+			}
+			sb.WriteString(fmt.Sprintf("    %s --> %s\n", chain, destNode))
 		} else {
 			sb.WriteString(fmt.Sprintf("    %s -->|%s| %s\n", sourceNode, r.RouteType, destNode))
 		}
@@ -0,0 +1,123 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// Fix actions of the referential integrity check, posted with the ID of the issue.
+const (
+	integrityFixChannel        = "release_channel"        // Release the routes referring to a missing channel or collector
+	integrityFixTransformation = "release_transformation" // Release the routes running a missing transformation
+	integrityFixIntegration    = "clear_integration"      // Detach a collector from a missing integration
+	integrityFixWorker         = "restart_worker"         // Start the worker of a channel again
+)
+
+// IntegrityReport is what the referential integrity check found.
+type IntegrityReport struct {
+	Issues         []storage.IntegrityIssue
+	StoppedWorkers []storage.Channel // Channels whose worker is not running, one per worker
+}
+
+// handleIntegrityCheck lists the references to objects that no longer exist and the channels without a
+// running worker, each with the fix to apply.
+func (h *Handler) handleIntegrityCheck(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	report := &IntegrityReport{}
+	var err error
+	if report.Issues, err = h.Store.FindIntegrityIssues(); err != nil {
+		h.renderError(w, "maintenance_integrity.html", h.I18n.Sprintf(lang, "Failed to check referential integrity: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	channels, err := h.Store.GetAllChannels(storage.ListFilter{})
+	if err != nil {
+		h.renderError(w, "maintenance_integrity.html", h.I18n.Sprintf(lang, "Failed to retrieve channels from database: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	report.StoppedWorkers = h.stoppedChannelWorkers(channels)
+
+	data := PageData{IntegrityReport: report, AcceptLanguage: lang}
+	switch r.URL.Query().Get("status") {
+	case "fixed":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Fixed, %s routes changed.", r.URL.Query().Get("routes"))
+	case "restarted":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Worker of %s started.", r.URL.Query().Get("destination"))
+	}
+	h.renderTemplate(w, "maintenance_integrity.html", data)
+}
+
+// stoppedChannelWorkers returns the channels whose worker is not running, one per worker, as channels sharing
+// a destination share its worker.
+func (h *Handler) stoppedChannelWorkers(channels []storage.Channel) []storage.Channel {
+	var stopped []storage.Channel
+	seen := make(map[string]bool)
+	for _, ch := range channels {
+		connName := rabbitmq.ChannelConnection(&ch)
+		worker := ch.Direction + "/" + connName + "/" + ch.Destination
+		if seen[worker] {
+			continue
+		}
+		seen[worker] = true
+		if !h.RabbitMQ.IsChannelWorkerRunning(connName, ch.Direction, ch.Destination) {
+			stopped = append(stopped, ch)
+		}
+	}
+	return stopped
+}
+
+// handleIntegrityFix applies one fix of the referential integrity check. Routes referring to a missing
+// object are changed as its deletion would have changed them, and their routers stopped or restarted.
+func (h *Handler) handleIntegrityFix(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "maintenance_integrity.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+	id := r.FormValue("id")
+	var dependents []storage.RouteDependent
+	var err error
+	switch r.FormValue("action") {
+	case integrityFixChannel:
+		dependents, err = h.Store.FixMissingChannel(id)
+	case integrityFixTransformation:
+		dependents, err = h.Store.FixMissingTransformation(id)
+	case integrityFixIntegration:
+		err = h.Store.ClearMissingIntegration(id)
+	case integrityFixWorker:
+		h.handleRestartChannelWorker(w, r, id)
+		return
+	default:
+		h.renderError(w, "maintenance_integrity.html", h.I18n.Sprintf(lang, "Unknown maintenance action."), http.StatusBadRequest, r)
+		return
+	}
+	if err != nil {
+		h.renderError(w, "maintenance_integrity.html", h.I18n.Sprintf(lang, "Failed to fix the reference to %s: %s", id, err.Error()), http.StatusConflict, r)
+		return
+	}
+	h.releaseRouters(dependents)
+	h.Logger.Info("integrity issue fixed", "action", r.FormValue("action"), "id", id, "routes", len(dependents))
+	http.Redirect(w, r, fmt.Sprintf("/admin/maintenance/integrity?status=fixed&routes=%d", len(dependents)), http.StatusSeeOther)
+}
+
+// handleRestartChannelWorker declares the durable topology of a channel again and starts its worker, for a
+// worker that stopped or was never started.
+func (h *Handler) handleRestartChannelWorker(w http.ResponseWriter, r *http.Request, channelID string) {
+	lang := h.determineLanguage(r)
+	ch, err := h.Store.GetChannelByID(channelID)
+	if err != nil || ch == nil {
+		http.NotFound(w, r)
+		return
+	}
+	connName := rabbitmq.ChannelConnection(ch)
+	if err := h.RabbitMQ.SetupDurableTopology(connName, ch.Destination, rabbitmq.ChannelQueueOptions(ch)); err != nil {
+		h.renderError(w, "maintenance_integrity.html", h.I18n.Sprintf(lang, "Failed to setup durable topology: %s", err.Error()), http.StatusBadGateway, r)
+		return
+	}
+	h.RabbitMQ.StartChannelWorker(connName, ch.Direction, ch.Destination)
+	h.Logger.Info("channel worker started from integrity check", "channel_id", ch.ID, "destination", ch.Destination)
+	http.Redirect(w, r, "/admin/maintenance/integrity?status=restarted&destination="+url.QueryEscape(ch.Destination), http.StatusSeeOther)
+}
@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"esb-go-app/storage"
+)
+
+// LibraryRoutes handles routing for /admin/libraries/* paths.
+func LibraryRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	if r.Method == http.MethodGet {
+		if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+			h.handleListLibraries(w, r)
+			return
+		}
+		if len(parts) == 1 {
+			libraryID := parts[0]
+			h.handleViewLibrary(w, r, libraryID)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		if len(parts) == 1 && parts[0] == "create" {
+			h.handleCreateLibrary(w, r)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "update" {
+			libraryID := parts[0]
+			h.handleUpdateLibrary(w, r, libraryID)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "delete" {
+			libraryID := parts[0]
+			h.handleDeleteLibrary(w, r, libraryID)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (h *Handler) handleListLibraries(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	libraries, err := h.Store.GetAllScriptLibraries()
+	if err != nil {
+		h.renderError(w, "libraries.html", h.I18n.Sprintf(lang, "Failed to retrieve script libraries: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	data := PageData{
+		ScriptLibraries: libraries,
+		AcceptLanguage:  lang,
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "created" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Script library created successfully!")
+	} else if status == "deleted" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Script library deleted.")
+	} else if status == "updated" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Script library updated successfully!")
+	}
+
+	h.renderTemplate(w, "libraries.html", data)
+}
+
+func (h *Handler) handleViewLibrary(w http.ResponseWriter, r *http.Request, libraryID string) {
+	lang := h.determineLanguage(r)
+	library, err := h.Store.GetScriptLibraryByID(libraryID)
+	if err != nil {
+		h.renderError(w, "libraries.html", h.I18n.Sprintf(lang, "Failed to retrieve script library: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if library == nil {
+		h.renderError(w, "libraries.html", h.I18n.Sprintf(lang, "Script library not found."), http.StatusNotFound, r)
+		return
+	}
+
+	data := PageData{
+		ScriptLibrary:  library,
+		AcceptLanguage: lang,
+	}
+	h.renderTemplate(w, "library_details.html", data)
+}
+
+// libraryFromForm reads the script library fields of the create and edit forms. The name is what the
+// scripts pass to load() or require(), so it is trimmed and may not be empty.
+func (h *Handler) libraryFromForm(r *http.Request, libraryID string) *storage.ScriptLibrary {
+	return &storage.ScriptLibrary{
+		ID:          libraryID,
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: r.FormValue("description"),
+		Engine:      r.FormValue("engine"),
+		Script:      r.FormValue("script"),
+	}
+}
+
+func (h *Handler) handleCreateLibrary(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "libraries.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	library := h.libraryFromForm(r, uuid.New().String())
+	if library.Name == "" || library.Engine == "" || library.Script == "" {
+		h.renderError(w, "libraries.html", h.I18n.Sprintf(lang, "Name, engine, and script are required."), http.StatusBadRequest, r)
+		return
+	}
+
+	if err := h.Store.CreateScriptLibrary(library); err != nil {
+		h.renderError(w, "libraries.html", h.I18n.Sprintf(lang, "Failed to create script library: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.scriptingService.PurgeCache() // Cached scripts may import a library of this name
+	h.Logger.Info("script library created successfully", "library_name", library.Name, "library_id", library.ID)
+	http.Redirect(w, r, "/admin/libraries?status=created", http.StatusSeeOther)
+}
+
+func (h *Handler) handleUpdateLibrary(w http.ResponseWriter, r *http.Request, libraryID string) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "library_details.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	library := h.libraryFromForm(r, libraryID)
+	if library.Name == "" || library.Engine == "" || library.Script == "" {
+		h.renderError(w, "library_details.html", h.I18n.Sprintf(lang, "Name, engine, and script are required."), http.StatusBadRequest, r)
+		return
+	}
+
+	if err := h.Store.UpdateScriptLibrary(library); err != nil {
+		h.renderError(w, "library_details.html", h.I18n.Sprintf(lang, "Failed to update script library: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.scriptingService.PurgeCache() // Cached scripts still run the previous code of the library
+	h.Logger.Info("script library updated successfully", "library_id", libraryID)
+	http.Redirect(w, r, "/admin/libraries?status=updated", http.StatusSeeOther)
+}
+
+func (h *Handler) handleDeleteLibrary(w http.ResponseWriter, r *http.Request, libraryID string) {
+	lang := h.determineLanguage(r)
+	if err := h.Store.DeleteScriptLibrary(libraryID); err != nil {
+		h.renderError(w, "libraries.html", h.I18n.Sprintf(lang, "Failed to delete script library: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.scriptingService.PurgeCache()
+	h.Logger.Info("script library deleted successfully", "library_id", libraryID)
+	http.Redirect(w, r, "/admin/libraries?status=deleted", http.StatusSeeOther)
+}
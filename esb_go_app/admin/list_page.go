@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// ListPage is the search term, the tag and the page of a paged list, such as the routes or the
+// applications. Pages hold the number of rows of the list size setting.
+type ListPage struct {
+	Term    string
+	Tag     string // Only rows with the tag are listed, for lists of tagged objects
+	Page    int    // 1 for the first page
+	HasNext bool   // Set by pageRows when rows remain after the page
+	size    int
+}
+
+// listPage reads the search term, the tag and the page of a list from the q, tag and page parameters of a
+// request.
+func (h *Handler) listPage(r *http.Request) *ListPage {
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	return &ListPage{Term: strings.TrimSpace(query.Get("q")), Tag: strings.TrimSpace(query.Get("tag")), Page: page, size: h.listSize()}
+}
+
+// Filter returns the storage filter reading the page, with one row more to tell whether another page follows.
+func (p *ListPage) Filter() storage.ListFilter {
+	return storage.ListFilter{Term: p.Term, Tag: p.Tag, Limit: p.size + 1, Offset: (p.Page - 1) * p.size}
+}
+
+// PrevPage and NextPage are the numbers of the pages around the current one, for the links of the template.
+func (p *ListPage) PrevPage() int { return p.Page - 1 }
+func (p *ListPage) NextPage() int { return p.Page + 1 }
+
+// pageRows drops the extra row read by the filter of a page and records whether it was there.
+func pageRows[T any](p *ListPage, rows []T) []T {
+	p.HasNext = len(rows) > p.size
+	if p.HasNext {
+		rows = rows[:p.size]
+	}
+	return rows
+}
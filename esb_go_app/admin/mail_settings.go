@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// loadMailSettings reads the SMTP settings shown on the settings form.
+func (h *Handler) loadMailSettings() *storage.MailSettings {
+	settings, err := h.Store.GetMailSettings()
+	if err != nil {
+		h.Logger.Error("failed to get mail settings", "error", err)
+		return &storage.MailSettings{Security: "starttls"}
+	}
+	return settings
+}
+
+// saveMailSettings validates and stores the SMTP settings of the settings form. An empty password keeps
+// the stored one, so the form never has to show it; clear_smtp_password removes it.
+func (h *Handler) saveMailSettings(r *http.Request, lang string) error {
+	current, err := h.Store.GetMailSettings()
+	if err != nil {
+		return err
+	}
+
+	settings := &storage.MailSettings{
+		Host:     strings.TrimSpace(r.FormValue("smtp_host")),
+		Security: r.FormValue("smtp_security"),
+		Username: strings.TrimSpace(r.FormValue("smtp_username")),
+		Password: r.FormValue("smtp_password"),
+		From:     strings.TrimSpace(r.FormValue("smtp_from")),
+	}
+	defaultPort, ok := storage.SMTPSecurityModes[settings.Security]
+	if !ok {
+		return errors.New(h.I18n.Sprintf(lang, "Security must be starttls, tls or none."))
+	}
+	settings.Port = defaultPort
+	if value := strings.TrimSpace(r.FormValue("smtp_port")); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return errors.New(h.I18n.Sprintf(lang, "Port must be between 1 and 65535."))
+		}
+		settings.Port = port
+	}
+	if settings.Host != "" {
+		if _, err := mail.ParseAddress(settings.From); err != nil {
+			return errors.New(h.I18n.Sprintf(lang, "Sender must be a valid email address."))
+		}
+	}
+	if settings.Password == "" && r.FormValue("clear_smtp_password") != "on" {
+		settings.Password = current.Password
+	}
+	return h.Store.SaveMailSettings(settings)
+}
@@ -3,7 +3,12 @@ package admin
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
 )
 
 // MaintenanceRoutes handles routing for /admin/maintenance/* paths.
@@ -14,6 +19,67 @@ func MaintenanceRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts
 		return
 	}
 
+	// GET /admin/maintenance/unroutable
+	if r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "unroutable" {
+		h.handleUnroutableMessages(w, r)
+		return
+	}
+
+	// GET /admin/maintenance/integrity
+	if r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "integrity" {
+		h.handleIntegrityCheck(w, r)
+		return
+	}
+
+	// POST /admin/maintenance/integrity/fix
+	if r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "integrity" && parts[1] == "fix" {
+		h.handleIntegrityFix(w, r)
+		return
+	}
+
+	// POST /admin/maintenance/queues/purge
+	if r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "queues" && parts[1] == "purge" {
+		h.handlePurgeQueue(w, r)
+		return
+	}
+
+	// POST /admin/maintenance/queues/delete-orphaned
+	if r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "queues" && parts[1] == "delete-orphaned" {
+		h.handleDeleteOrphanedQueues(w, r)
+		return
+	}
+
+	// POST /admin/maintenance/queues/shovel
+	if r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "queues" && parts[1] == "shovel" {
+		h.handleStartShovel(w, r)
+		return
+	}
+
+	// POST /admin/maintenance/queues/shovel/{jobID}/cancel
+	if r.Method == http.MethodPost && len(parts) == 4 && parts[0] == "queues" && parts[1] == "shovel" && parts[3] == "cancel" {
+		h.RabbitMQ.CancelShovel(parts[2])
+		http.Redirect(w, r, "/admin/maintenance/queues", http.StatusSeeOther)
+		return
+	}
+
+	// GET or POST /admin/maintenance/reconcile[?fix=true]
+	if (r.Method == http.MethodGet || r.Method == http.MethodPost) && len(parts) == 1 && parts[0] == "reconcile" {
+		h.handleReconciliationAPI(w, r)
+		return
+	}
+
+	// GET /admin/maintenance/backup
+	if r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "backup" {
+		h.handleDownloadBackup(w, r)
+		return
+	}
+
+	// POST /admin/maintenance/backup/restore
+	if r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "backup" && parts[1] == "restore" {
+		h.handleRestoreBackup(w, r)
+		return
+	}
+
 	// POST /admin/maintenance
 	if r.Method == http.MethodPost && (len(parts) == 0 || (len(parts) == 1 && parts[0] == "")) {
 		h.handleMaintenanceActions(w, r)
@@ -50,7 +116,128 @@ func (h *Handler) handlePruneOrphanedChannels(w http.ResponseWriter, r *http.Req
 	http.Redirect(w, r, fmt.Sprintf("/admin?pruned=%d", count), http.StatusSeeOther)
 }
 
+// handleDeleteOrphanedQueues deletes the selected orphaned durable queues together with their exchanges.
+// The selection is checked against a fresh reconciliation, so queues that are in use again are never deleted.
+func (h *Handler) handleDeleteOrphanedQueues(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	connName := r.FormValue("connection")
+	if !h.RabbitMQ.HasConnection(connName) {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Unknown RabbitMQ connection: %s", connName), http.StatusBadRequest, r)
+		return
+	}
+	selected := r.Form["queue"]
+	if len(selected) == 0 {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "No queues selected."), http.StatusBadRequest, r)
+		return
+	}
+
+	dbChannels, err := h.Store.GetAllChannels(storage.ListFilter{})
+	if err != nil {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to retrieve channels from database: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	recon := h.reconcileQueues(lang, connName, dbChannels)
+	if recon.Error != "" {
+		h.renderError(w, "maintenance_queues.html", recon.Error, http.StatusBadGateway, r)
+		return
+	}
+	orphaned := make(map[string]bool, len(recon.OrphanedQueues))
+	for _, qName := range recon.OrphanedQueues {
+		orphaned[qName] = true
+	}
+
+	deleted := 0
+	for _, qName := range selected {
+		if !orphaned[qName] {
+			h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Queue %s is not orphaned and was not deleted.", qName), http.StatusConflict, r)
+			return
+		}
+		if err := h.RabbitMQ.DeleteDurableTopology(connName, strings.TrimPrefix(qName, "durable_queue_for_")); err != nil {
+			h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to delete queue %s: %s", qName, err.Error()), http.StatusInternalServerError, r)
+			return
+		}
+		deleted++
+	}
+	h.Logger.Info("deleted orphaned queues", "connection", connName, "count", deleted)
+	http.Redirect(w, r, fmt.Sprintf("/admin/maintenance/queues?deleted_orphans=%d", deleted), http.StatusSeeOther)
+}
+
+// handleStartShovel starts moving messages from a queue to an exchange in the background.
+func (h *Handler) handleStartShovel(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	connName := r.FormValue("connection")
+	destConn := r.FormValue("destination_connection")
+	sourceQueue := strings.TrimSpace(r.FormValue("source_queue"))
+	destExchange := strings.TrimSpace(r.FormValue("destination_exchange"))
+	if sourceQueue == "" || destExchange == "" {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Source queue and destination exchange are required."), http.StatusBadRequest, r)
+		return
+	}
+	for _, name := range []string{connName, destConn} {
+		if !h.RabbitMQ.HasConnection(name) {
+			h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Unknown RabbitMQ connection: %s", name), http.StatusBadRequest, r)
+			return
+		}
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(r.FormValue("count")))
+	if err != nil || limit < 1 || limit > rabbitmq.MaxShovelMessages {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Message count must be a number between 1 and %d.", rabbitmq.MaxShovelMessages), http.StatusBadRequest, r)
+		return
+	}
+
+	jobID, err := h.RabbitMQ.StartShovel(connName, sourceQueue, destConn, destExchange, limit)
+	if err != nil {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to start moving messages: %s", err.Error()), http.StatusBadRequest, r)
+		return
+	}
+	h.Logger.Info("shovel job started", "job_id", jobID, "queue", sourceQueue, "exchange", destExchange, "limit", limit)
+	http.Redirect(w, r, "/admin/maintenance/queues", http.StatusSeeOther)
+}
+
+// UnroutableCapture holds the captured unroutable messages of one broker connection.
+type UnroutableCapture struct {
+	Connection string
+	Error      string
+	Total      int
+	Messages   []rabbitmq.ParkedMessage
+}
+
+// handleUnroutableMessages shows the messages the alternate exchange captured on every broker connection.
+func (h *Handler) handleUnroutableMessages(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	var captures []UnroutableCapture
+	for _, connName := range h.RabbitMQ.ConnectionNames() {
+		capture := UnroutableCapture{Connection: connName}
+		messages, total, err := h.RabbitMQ.BrowseUnroutable(connName, rabbitmq.MaxBrowsedParkedMessages)
+		if err != nil {
+			capture.Error = h.I18n.Sprintf(lang, "Failed to read unroutable messages: %s", err.Error())
+		}
+		capture.Messages = messages
+		capture.Total = total
+		captures = append(captures, capture)
+	}
+
+	data := PageData{
+		UnroutableCaptures: captures,
+		ParkingLotQueue:    rabbitmq.UnroutableQueue,
+		AcceptLanguage:     lang,
+	}
+	h.renderTemplate(w, "maintenance_unroutable.html", data)
+}
+
 type QueueReconResult struct {
+	Connection       string
+	Error            string
 	DBQueues         []string
 	RabbitMQQueues   []string
 	OrphanedQueues   []string // In RabbitMQ but not in DB
@@ -61,45 +248,95 @@ type QueueReconResult struct {
 func (h *Handler) handleQueueReconciliation(w http.ResponseWriter, r *http.Request) {
 	lang := h.determineLanguage(r)
 	// 1. Get all queues from the database (by getting all channels)
-	dbChannels, err := h.Store.GetAllChannels()
+	dbChannels, err := h.Store.GetAllChannels(storage.ListFilter{})
 	if err != nil {
 		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to retrieve channels from database: %s", err.Error()), http.StatusInternalServerError, r)
 		return
 	}
+
+	// 2. Compare them with the queues of every configured broker connection
+	var results []QueueReconResult
+	for _, connName := range h.RabbitMQ.ConnectionNames() {
+		results = append(results, h.reconcileQueues(lang, connName, dbChannels))
+	}
+
+	// 3. Render the template
+	data := PageData{
+		QueueRecon:        results,
+		ShovelJobs:        h.RabbitMQ.ShovelJobs(),
+		BrokerConnections: h.RabbitMQ.ConnectionNames(),
+		AcceptLanguage:    lang,
+	}
+	if queue := r.URL.Query().Get("purged_queue"); queue != "" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Queue %s purged, %s messages deleted.", queue, r.URL.Query().Get("purged"))
+	} else if deleted := r.URL.Query().Get("deleted_orphans"); deleted != "" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Orphaned queues deleted: %s", deleted)
+	}
+	h.renderTemplate(w, "maintenance_queues.html", data)
+}
+
+// handlePurgeQueue deletes all ready messages of a queue, e.g. to clear a poisoned backlog.
+func (h *Handler) handlePurgeQueue(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	connName := r.FormValue("connection")
+	queueName := strings.TrimSpace(r.FormValue("queue"))
+	if queueName == "" {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Queue name is required."), http.StatusBadRequest, r)
+		return
+	}
+	if !h.RabbitMQ.HasConnection(connName) {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Unknown RabbitMQ connection: %s", connName), http.StatusBadRequest, r)
+		return
+	}
+
+	count, err := h.RabbitMQ.PurgeQueue(connName, queueName)
+	if err != nil {
+		h.renderError(w, "maintenance_queues.html", h.I18n.Sprintf(lang, "Failed to purge queue: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.Logger.Info("purged queue", "connection", connName, "queue", queueName, "count", count)
+	http.Redirect(w, r, fmt.Sprintf("/admin/maintenance/queues?purged_queue=%s&purged=%d", url.QueryEscape(queueName), count), http.StatusSeeOther)
+}
+
+// reconcileQueues compares the durable queues of the channels on one broker connection with the queues in RabbitMQ.
+func (h *Handler) reconcileQueues(lang, connName string, dbChannels []storage.Channel) QueueReconResult {
+	result := QueueReconResult{Connection: connName}
+
 	dbQueueMap := make(map[string]bool)
-	var dbQueueList []string
 	for _, ch := range dbChannels {
+		if !sameConnection(ch.Connection, connName) {
+			continue
+		}
 		// Assuming the convention is "durable_queue_for_" + destination name
 		qName := "durable_queue_for_" + ch.Destination
 		if !dbQueueMap[qName] {
 			dbQueueMap[qName] = true
-			dbQueueList = append(dbQueueList, qName)
+			result.DBQueues = append(result.DBQueues, qName)
 		}
 	}
 
-	// 2. Get all queues from RabbitMQ Management API
-	rabbitQueues, err := h.RabbitMQ.ListQueues()
+	// Get all queues from RabbitMQ Management API
+	rabbitQueues, err := h.RabbitMQ.ListQueues(connName)
 	if err != nil {
-		errMsg := h.I18n.Sprintf(lang, "Could not get queue list from RabbitMQ Management API. Ensure the API is accessible and credentials are correct in config.json. Error: %v", err)
-		h.renderError(w, "maintenance_queues.html", errMsg, http.StatusInternalServerError, r)
-		return
+		result.Error = h.I18n.Sprintf(lang, "Could not get queue list from RabbitMQ Management API. Ensure the API is accessible and credentials are correct in config.json. Error: %v", err)
+		return result
 	}
 
 	rabbitQueueMap := make(map[string]bool)
-	var rabbitQueueList []string
 	for _, q := range rabbitQueues {
 		// Only consider durable queues managed by this app
 		if q.Durable && strings.HasPrefix(q.Name, "durable_queue_for_") {
 			rabbitQueueMap[q.Name] = true
-			rabbitQueueList = append(rabbitQueueList, q.Name)
+			result.RabbitMQQueues = append(result.RabbitMQQueues, q.Name)
 		}
 	}
 
-	// 3. Compare the lists
-	result := &QueueReconResult{
-		DBQueues:       dbQueueList,
-		RabbitMQQueues: rabbitQueueList,
-	}
+	// Compare the lists
 	for qName := range rabbitQueueMap {
 		if !dbQueueMap[qName] {
 			result.OrphanedQueues = append(result.OrphanedQueues, qName)
@@ -112,10 +349,5 @@ func (h *Handler) handleQueueReconciliation(w http.ResponseWriter, r *http.Reque
 			result.MissingQueues = append(result.MissingQueues, qName)
 		}
 	}
-
-	// 4. Render the template
-	h.renderTemplate(w, "maintenance_queues.html", PageData{
-		QueueRecon:     result,
-		AcceptLanguage: lang,
-	})
+	return result
 }
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"esb-go-app/rabbitmq"
+)
+
+// handleRouteParkingLot lists the dead-lettered messages of a route without removing them from the parking lot.
+func (h *Handler) handleRouteParkingLot(w http.ResponseWriter, r *http.Request, routeID string) {
+	lang := h.determineLanguage(r)
+	rawRoute, err := h.Store.GetRouteByID(routeID)
+	if err != nil || rawRoute == nil {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "Route not found."), http.StatusNotFound, r)
+		return
+	}
+	routeInfo, err := h.Store.BuildRouteInfo(*rawRoute)
+	if err != nil {
+		h.renderError(w, "route_parking_lot.html", "Failed to build route details: "+err.Error(), http.StatusInternalServerError, r)
+		return
+	}
+
+	connName, _, err := h.RabbitMQ.RouteSourceQueue(rawRoute)
+	if err != nil {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "Failed to determine the source queue of the route: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	queueName := rabbitmq.ParkingLotQueue(rawRoute.Name, rawRoute.ID)
+	messages, total, err := h.RabbitMQ.BrowseParkingLot(connName, queueName, rabbitmq.MaxBrowsedParkedMessages)
+	if err != nil {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "Failed to read the parking lot: %s", err.Error()), http.StatusBadGateway, r)
+		return
+	}
+
+	data := PageData{
+		Route:           &routeInfo,
+		ParkingLotQueue: queueName,
+		ParkedMessages:  messages,
+		ParkedTotal:     total,
+		AcceptLanguage:  lang,
+	}
+	if requeued := r.URL.Query().Get("requeued"); requeued != "" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Messages requeued: %s", requeued)
+	}
+	h.renderTemplate(w, "route_parking_lot.html", data)
+}
+
+// handleRequeueParked moves the selected parked messages back to the source queue of the route.
+func (h *Handler) handleRequeueParked(w http.ResponseWriter, r *http.Request, routeID string) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+	rawRoute, err := h.Store.GetRouteByID(routeID)
+	if err != nil || rawRoute == nil {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "Route not found."), http.StatusNotFound, r)
+		return
+	}
+	selected := r.Form["message"]
+	if len(selected) == 0 {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "No messages selected."), http.StatusBadRequest, r)
+		return
+	}
+
+	connName, sourceQueue, err := h.RabbitMQ.RouteSourceQueue(rawRoute)
+	if err != nil {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "Failed to determine the source queue of the route: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	queueName := rabbitmq.ParkingLotQueue(rawRoute.Name, rawRoute.ID)
+	requeued, err := h.RabbitMQ.RequeueParked(connName, queueName, sourceQueue, selected)
+	if err != nil {
+		h.renderError(w, "route_parking_lot.html", h.I18n.Sprintf(lang, "Failed to requeue messages after %d of them: %s", requeued, err.Error()), http.StatusBadGateway, r)
+		return
+	}
+	h.Logger.Info("requeued parked messages", "route_id", routeID, "selected", len(selected), "requeued", requeued)
+	http.Redirect(w, r, fmt.Sprintf("/admin/routes/%s/parking-lot?requeued=%d", routeID, requeued), http.StatusSeeOther)
+}
@@ -0,0 +1,176 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// Drift kinds reported by the reconciliation API.
+const (
+	driftMissingQueue     = "missing_queue"
+	driftMissingExchange  = "missing_exchange"
+	driftOrphanedQueue    = "orphaned_queue"
+	driftOrphanedExchange = "orphaned_exchange"
+)
+
+// DriftItem is a single difference between the channels in the database and the broker topology.
+type DriftItem struct {
+	Kind        string   `json:"kind"`
+	Name        string   `json:"name"`
+	Destination string   `json:"destination"`
+	ChannelIDs  []string `json:"channel_ids,omitempty"` // Channels that expect the object; empty for orphans
+	Fixable     bool     `json:"fixable"`
+	Fixed       bool     `json:"fixed"`
+	FixError    string   `json:"fix_error,omitempty"`
+}
+
+// ConnectionDrift holds the drift found on one broker connection.
+type ConnectionDrift struct {
+	Connection string      `json:"connection"`
+	Error      string      `json:"error,omitempty"`
+	Drift      []DriftItem `json:"drift"`
+}
+
+// ReconciliationReport is the machine-readable result of GET/POST /admin/maintenance/reconcile.
+type ReconciliationReport struct {
+	InSync      bool              `json:"in_sync"` // No unresolved drift and no connection errors
+	Fix         bool              `json:"fix"`     // Missing objects were redeclared by this request
+	Connections []ConnectionDrift `json:"connections"`
+}
+
+// handleReconciliationAPI reports the topology drift of every broker connection as JSON.
+// POST with ?fix=true redeclares the missing durable topology; orphaned objects are only reported.
+func (h *Handler) handleReconciliationAPI(w http.ResponseWriter, r *http.Request) {
+	fix := r.URL.Query().Get("fix") == "true"
+	if fix && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, "fix=true requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dbChannels, err := h.Store.GetAllChannels(storage.ListFilter{})
+	if err != nil {
+		writeJSONError(w, "failed to retrieve channels from database: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := ReconciliationReport{InSync: true, Fix: fix}
+	status := http.StatusOK
+	for _, connName := range h.RabbitMQ.ConnectionNames() {
+		drift := h.topologyDrift(connName, dbChannels, fix)
+		if drift.Error != "" {
+			report.InSync = false
+			status = http.StatusBadGateway
+		}
+		for _, item := range drift.Drift {
+			if !item.Fixed {
+				report.InSync = false
+			}
+		}
+		report.Connections = append(report.Connections, drift)
+	}
+
+	if fix {
+		h.Logger.Info("topology reconciliation with fix finished", "in_sync", report.InSync)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// topologyDrift compares the durable queues and exchanges expected by the channels of one connection
+// with those in RabbitMQ and, with fix set, redeclares the topology of every destination with missing objects.
+func (h *Handler) topologyDrift(connName string, dbChannels []storage.Channel, fix bool) ConnectionDrift {
+	result := ConnectionDrift{Connection: connName, Drift: []DriftItem{}}
+
+	// Expected destinations with the channels that use them
+	expected := make(map[string][]storage.Channel)
+	for _, ch := range dbChannels {
+		if sameConnection(ch.Connection, connName) {
+			expected[ch.Destination] = append(expected[ch.Destination], ch)
+		}
+	}
+
+	queues, err := h.RabbitMQ.ListQueues(connName)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	exchanges, err := h.RabbitMQ.ListExchanges(connName)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	existingQueues := make(map[string]bool)
+	for _, q := range queues {
+		if q.Durable && strings.HasPrefix(q.Name, "durable_queue_for_") {
+			existingQueues[strings.TrimPrefix(q.Name, "durable_queue_for_")] = true
+		}
+	}
+	existingExchanges := make(map[string]bool)
+	for _, ex := range exchanges {
+		if ex.Durable && strings.HasPrefix(ex.Name, "durable_exchange_for_") {
+			existingExchanges[strings.TrimPrefix(ex.Name, "durable_exchange_for_")] = true
+		}
+	}
+
+	for destination, channels := range expected {
+		channelIDs := make([]string, 0, len(channels))
+		for _, ch := range channels {
+			channelIDs = append(channelIDs, ch.ID)
+		}
+		sort.Strings(channelIDs)
+
+		var missing []DriftItem
+		if !existingQueues[destination] {
+			missing = append(missing, DriftItem{Kind: driftMissingQueue, Name: "durable_queue_for_" + destination, Destination: destination, ChannelIDs: channelIDs, Fixable: true})
+		}
+		if !existingExchanges[destination] {
+			missing = append(missing, DriftItem{Kind: driftMissingExchange, Name: "durable_exchange_for_" + destination, Destination: destination, ChannelIDs: channelIDs, Fixable: true})
+		}
+		if len(missing) > 0 && fix {
+			// SetupDurableTopology is idempotent and declares the exchange, the queue and their binding together.
+			err := h.RabbitMQ.SetupDurableTopology(rabbitmq.ChannelConnection(&channels[0]), destination, rabbitmq.ChannelQueueOptions(&channels[0]))
+			for i := range missing {
+				if err != nil {
+					missing[i].FixError = err.Error()
+				} else {
+					missing[i].Fixed = true
+				}
+			}
+		}
+		result.Drift = append(result.Drift, missing...)
+	}
+
+	for destination := range existingQueues {
+		if _, ok := expected[destination]; !ok {
+			result.Drift = append(result.Drift, DriftItem{Kind: driftOrphanedQueue, Name: "durable_queue_for_" + destination, Destination: destination})
+		}
+	}
+	for destination := range existingExchanges {
+		if _, ok := expected[destination]; !ok {
+			result.Drift = append(result.Drift, DriftItem{Kind: driftOrphanedExchange, Name: "durable_exchange_for_" + destination, Destination: destination})
+		}
+	}
+
+	sort.Slice(result.Drift, func(i, j int) bool {
+		if result.Drift[i].Kind != result.Drift[j].Kind {
+			return result.Drift[i].Kind < result.Drift[j].Kind
+		}
+		return result.Drift[i].Name < result.Drift[j].Name
+	})
+	return result
+}
+
+// writeJSONError writes {"error": message} with the given status code.
+func writeJSONError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Roles of the users of the admin interface. Each role may do everything the roles before it may.
+const (
+	RoleViewer   = "viewer"   // Reads every page, with the secrets of applications and connections masked
+	RoleOperator = "operator" // Also pauses, resumes and restarts workers, replays and moves messages and tests channels and transformations
+	RoleAdmin    = "admin"    // Also changes the configuration and backs up or restores the database
+)
+
+// roleRanks orders the roles, a user may make the requests of every role ranked at most as theirs.
+var roleRanks = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// roleResponseWriter carries the user and role of a request to renderTemplate, so the pages show them and
+// mask the secrets from the users who are not admins.
+type roleResponseWriter struct {
+	http.ResponseWriter
+	user string
+	role string
+}
+
+// SetRoles assigns the roles of the admin interface to the users named by the userHeader request header,
+// which the authenticating proxy in front of the admin interface sets. The header is only trusted from the
+// trustedProxies networks, or from every client when there are none; the other identity headers and the
+// user of HTTP basic authentication are ignored, since nothing here checks them. Users without a role, and
+// requests without a trusted user, get defaultRole, so roles have no effect without a userHeader. Until
+// SetRoles is called, every request has the admin role.
+func (h *Handler) SetRoles(roles map[string]string, defaultRole, userHeader string, trustedProxies []string) error {
+	for user, role := range roles {
+		if _, ok := roleRanks[role]; !ok {
+			return fmt.Errorf("unknown admin role %q of user %s", role, user)
+		}
+	}
+	if _, ok := roleRanks[defaultRole]; !ok {
+		return fmt.Errorf("unknown default admin role %q", defaultRole)
+	}
+	var proxies []*net.IPNet
+	for _, cidr := range trustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy network %q: %w", cidr, err)
+		}
+		proxies = append(proxies, network)
+	}
+	if len(roles) > 0 && userHeader == "" {
+		h.Logger.Warn("admin roles are configured without a user header and have no effect, every request gets the default role", "default_role", defaultRole)
+	}
+	h.roles = roles
+	h.defaultRole = defaultRole
+	h.userHeader = userHeader
+	h.trustedProxies = proxies
+	return nil
+}
+
+// roleUser returns the user a request is made by, as named by the user header, or an empty string when the
+// header is not configured, not set or not sent by a trusted proxy.
+func (h *Handler) roleUser(r *http.Request) string {
+	if h.userHeader == "" {
+		return ""
+	}
+	if len(h.trustedProxies) > 0 {
+		// The address of the connection itself: X-Forwarded-For is as easy to forge as the user header.
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		trusted := false
+		for _, network := range h.trustedProxies {
+			if ip != nil && network.Contains(ip) {
+				trusted = true
+				break
+			}
+		}
+		if !trusted {
+			return ""
+		}
+	}
+	return strings.TrimSpace(r.Header.Get(h.userHeader))
+}
+
+// userRole returns the role of a user of the admin interface.
+func (h *Handler) userRole(user string) string {
+	if role, ok := h.roles[user]; ok {
+		return role
+	}
+	if h.defaultRole == "" {
+		return RoleAdmin
+	}
+	return h.defaultRole
+}
+
+// requiredRole returns the least role allowed to make a request, from its method and the path below
+// /admin. Pages are read-only for viewers, the operations on workers and messages need an operator and
+// every other change needs an admin, so a new action is reserved to admins until it is listed here.
+func requiredRole(r *http.Request, parts []string) string {
+	section, rest := parts[0], parts[1:]
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if section == "maintenance" && len(rest) == 1 && rest[0] == "backup" {
+			// The backup holds the secrets of every application and connection.
+			return RoleAdmin
+		}
+		return RoleViewer
+	}
+	switch {
+	case section == "dead-letters" && len(rest) == 1 && rest[0] == "replay",
+		section == "routes" && len(rest) == 3 && rest[1] == "parking-lot" && rest[2] == "requeue",
+		section == "routes" && len(rest) == 3 && rest[1] == "worker",
+		section == "app" && len(rest) == 5 && rest[1] == "channel" && rest[3] == "worker",
+		section == "maintenance" && len(rest) >= 2 && rest[0] == "queues" && rest[1] == "shovel",
+		section == "app" && len(rest) == 4 && rest[1] == "channel" && rest[3] == "test",
+		section == "transformations" && len(rest) == 2 && (rest[1] == "run-tests" || rest[1] == "tests"):
+		return RoleOperator
+	case section == "maintenance" && len(rest) == 2 && rest[0] == "integrity" && rest[1] == "fix":
+		if r.FormValue("action") == integrityFixWorker {
+			return RoleOperator
+		}
+	}
+	return RoleAdmin
+}
+
+// authorize checks the role of the user making a request and renders a 403 page if it is not allowed. It
+// returns the writer to serve an allowed request with.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, parts []string) (http.ResponseWriter, bool) {
+	user := h.roleUser(r)
+	role := h.userRole(user)
+	required := requiredRole(r, parts)
+	if roleRanks[role] < roleRanks[required] {
+		h.Logger.Warn("admin request denied", "user", user, "role", role, "required_role", required, "method", r.Method, "path", r.URL.Path)
+		lang := h.determineLanguage(r)
+		h.renderError(w, "admin.html", h.I18n.Sprintf(lang, "The %s role may not do this, it needs the %s role.", role, required), http.StatusForbidden, r)
+		return w, false
+	}
+	return &roleResponseWriter{ResponseWriter: w, user: user, role: role}, true
+}
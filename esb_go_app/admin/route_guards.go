@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// parseGuardConditions parses the guard conditions textarea, one "header operator value" condition per line.
+func parseGuardConditions(text string) ([]storage.GuardCondition, error) {
+	var conditions []storage.GuardCondition
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		header, rest, ok := cutField(line)
+		if !ok {
+			return nil, fmt.Errorf("'%s': expected 'header operator value'", line)
+		}
+		operator, value, ok := cutField(rest)
+		if !ok {
+			return nil, fmt.Errorf("'%s': expected 'header operator value'", line)
+		}
+
+		switch operator {
+		case "equals", "contains":
+		case "regex":
+			if _, err := regexp.Compile(value); err != nil {
+				return nil, fmt.Errorf("'%s': %w", line, err)
+			}
+		default:
+			return nil, fmt.Errorf("'%s': unknown operator '%s'", line, operator)
+		}
+
+		conditions = append(conditions, storage.GuardCondition{Header: header, Operator: operator, Value: value})
+	}
+	return conditions, nil
+}
+
+// cutField splits off the first whitespace-separated field of s.
+func cutField(s string) (field, rest string, ok bool) {
+	idx := strings.IndexAny(s, " \t")
+	if idx < 0 {
+		return "", "", false
+	}
+	return s[:idx], strings.TrimSpace(s[idx:]), true
+}
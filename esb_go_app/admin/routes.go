@@ -1,10 +1,18 @@
 package admin
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
+	"esb-go-app/rabbitmq"
 	"esb-go-app/storage"
 )
 
@@ -20,6 +28,10 @@ func RouteRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []str
 			h.handleViewRoute(w, r, routeID)
 			return
 		}
+		if len(parts) == 2 && parts[1] == "parking-lot" {
+			h.handleRouteParkingLot(w, r, parts[0])
+			return
+		}
 	}
 
 	if r.Method == http.MethodPost {
@@ -37,6 +49,30 @@ func RouteRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []str
 			h.handleEditRoute(w, r, routeID)
 			return
 		}
+		if len(parts) == 2 && parts[1] == "clone" {
+			h.handleCloneRoute(w, r, parts[0])
+			return
+		}
+		if len(parts) == 3 && parts[1] == "worker" && isWorkerAction(parts[2]) {
+			h.handleRouteWorker(w, r, parts[0], parts[2])
+			return
+		}
+		if len(parts) == 3 && parts[1] == "parking-lot" && parts[2] == "requeue" {
+			h.handleRequeueParked(w, r, parts[0])
+			return
+		}
+		if len(parts) == 3 && parts[1] == "rules" && parts[2] == "create" {
+			h.handleCreateRoutingRule(w, r, parts[0])
+			return
+		}
+		if len(parts) == 4 && parts[1] == "rules" && parts[3] == "delete" {
+			h.handleDeleteRoutingRule(w, r, parts[0], parts[2])
+			return
+		}
+		if len(parts) == 4 && parts[1] == "versions" && parts[3] == "rollback" {
+			h.handleRollbackRoute(w, r, parts[0], parts[2])
+			return
+		}
 	}
 
 	http.NotFound(w, r)
@@ -45,7 +81,8 @@ func RouteRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []str
 func (h *Handler) handleRoutes(w http.ResponseWriter, r *http.Request) {
 	lang := h.determineLanguage(r)
 
-	routes, err := h.Store.GetAllRoutes()
+	page := h.listPage(r)
+	routes, err := h.Store.GetAllRoutes(page.Filter())
 	if err != nil {
 		h.renderError(w, "routes.html", "Failed to retrieve routes: "+err.Error(), http.StatusInternalServerError, r)
 		return
@@ -76,19 +113,27 @@ func (h *Handler) handleRoutes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := PageData{
-		Routes:          routes,
+		Routes:          pageRows(page, routes),
+		ListPage:        page,
 		RouteSources:    routeSources,
 		InboundChannels: inbound,
 		Transformations: transformations,
 		Integrations:    integrations,
+		TagFilter:       page.Tag,
 		AcceptLanguage:  lang,
 	}
+	if data.TagOptions, err = h.Store.GetTags(storage.SearchRoute); err != nil {
+		h.Logger.Error("failed to get route tags", "error", err)
+	}
+	if data.RouteStats, err = h.Store.GetAllRouteStats(); err != nil {
+		h.Logger.Error("failed to get route statistics", "error", err)
+	}
 
 	status := r.URL.Query().Get("status")
 	if status == "created" {
 		data.StatusMessage = h.I18n.Sprintf(lang, "Route created successfully!")
 	} else if status == "deleted" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "Route deleted.")
+		data.StatusMessage = h.I18n.Sprintf(lang, "Route moved to the trash, where it can be restored.")
 	} else if status == "created_worker_failed" {
 		data.ErrorMessage = h.I18n.Sprintf(lang, "Route created, but worker start failed. Check logs.")
 	}
@@ -104,28 +149,51 @@ func (h *Handler) handleViewRoute(w http.ResponseWriter, r *http.Request, routeI
 		return
 	}
 
-	routeInfo, err := h.Store.BuildRouteInfo(*rawRoute)
+	data, err := h.routePageData(rawRoute, lang)
 	if err != nil {
-		h.renderError(w, "routes.html", "Failed to build route details: "+err.Error(), http.StatusInternalServerError, r)
+		h.renderError(w, "route_details.html", err.Error(), http.StatusInternalServerError, r)
 		return
 	}
 
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "updated":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Route updated successfully!")
+	case "rule_created":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Routing rule added.")
+	case "rule_deleted":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Routing rule deleted.")
+	case "cloned":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Route duplicated. The copy is disabled until you enable it.")
+	case "rolled_back":
+		data.StatusMessage = h.I18n.Sprintf(lang, "Route rolled back to version %s.", r.URL.Query().Get("version"))
+	default:
+		data.StatusMessage = h.workerStatusMessage(lang, status)
+	}
+
+	h.renderTemplate(w, "route_details.html", data)
+}
+
+// routePageData builds the details page of a route, as stored or as submitted in its edit form.
+func (h *Handler) routePageData(route *storage.Route, lang string) (PageData, error) {
+	routeInfo, err := h.Store.BuildRouteInfo(*route)
+	if err != nil {
+		return PageData{}, fmt.Errorf("Failed to build route details: %w", err)
+	}
+
 	routeSources, err := h.Store.GetAllRouteSources()
 	if err != nil {
-		h.renderError(w, "route_details.html", "Failed to retrieve route sources: "+err.Error(), http.StatusInternalServerError, r)
-		return
+		return PageData{}, fmt.Errorf("Failed to retrieve route sources: %w", err)
 	}
 
 	inbound, err := h.Store.GetAllRoutableChannels("inbound")
 	if err != nil {
-		h.renderError(w, "route_details.html", "Failed to retrieve inbound channels: "+err.Error(), http.StatusInternalServerError, r)
-		return
+		return PageData{}, fmt.Errorf("Failed to retrieve inbound channels: %w", err)
 	}
 
 	outbound, err := h.Store.GetAllRoutableChannels("outbound")
 	if err != nil {
-		h.renderError(w, "route_details.html", "Failed to retrieve outbound channels: "+err.Error(), http.StatusInternalServerError, r)
-		return
+		return PageData{}, fmt.Errorf("Failed to retrieve outbound channels: %w", err)
 	}
 
 	// Create a unified list of destination channels as per user's request
@@ -136,32 +204,51 @@ func (h *Handler) handleViewRoute(w http.ResponseWriter, r *http.Request, routeI
 
 	transformations, err := h.Store.GetAllTransformations()
 	if err != nil {
-		h.renderError(w, "route_details.html", "Failed to retrieve transformations: "+err.Error(), http.StatusInternalServerError, r)
-		return
+		return PageData{}, fmt.Errorf("Failed to retrieve transformations: %w", err)
 	}
 
 	integrations, err := h.Store.GetAllIntegrations()
 	if err != nil {
-		h.renderError(w, "route_details.html", "Failed to retrieve integrations: "+err.Error(), http.StatusInternalServerError, r)
-		return
+		return PageData{}, fmt.Errorf("Failed to retrieve integrations: %w", err)
 	}
 
-	data := PageData{
-		Route:               &routeInfo,
-		RouteSources:        routeSources,
-		InboundChannels:     inbound,
-		DestinationChannels: destinationChannels,
-		Transformations:     transformations,
-		Integrations:        integrations,
-		AcceptLanguage:      lang,
+	rules, err := h.Store.GetRoutingRules(route.ID)
+	if err != nil {
+		return PageData{}, fmt.Errorf("Failed to retrieve routing rules: %w", err)
 	}
 
-	status := r.URL.Query().Get("status")
-	if status == "updated" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "Route updated successfully!")
+	versions, err := h.Store.GetRouteVersions(route.ID)
+	if err != nil {
+		return PageData{}, fmt.Errorf("Failed to retrieve route versions: %w", err)
 	}
 
-	h.renderTemplate(w, "route_details.html", data)
+	data := PageData{
+		Route:                &routeInfo,
+		RouteVersions:        versions,
+		RoutingRules:         rules,
+		RoutingRuleOperators: rabbitmq.RoutingRuleOperators,
+		RouteSources:         routeSources,
+		InboundChannels:      inbound,
+		DestinationChannels:  destinationChannels,
+		Transformations:      transformations,
+		Integrations:         integrations,
+		ParkingLotQueue:      rabbitmq.ParkingLotQueue(routeInfo.Name, routeInfo.ID),
+		ReplyQueue:           rabbitmq.ReplyQueue(routeInfo.Name, routeInfo.ID),
+		WorkerRunning:        h.RabbitMQ.IsRouterRunning(routeInfo.ID),
+		AcceptLanguage:       lang,
+	}
+	if breaker, open := h.RabbitMQ.DestinationBreaker(routeInfo.DestinationChannelID); open {
+		data.DestinationBreaker = &breaker
+	}
+	if window, err := rabbitmq.ParseActivityWindow(routeInfo.ActiveWindow); err == nil && !window.Active(time.Now()) {
+		data.RouteOutsideWindow = true
+	}
+	if routeInfo.DeadLetterStore != storage.DeadLetterBroker {
+		if data.RouteDeadLetters, err = h.Store.CountDeadLetters(routeInfo.ID); err != nil {
+			h.Logger.Error("failed to count dead letters of route", "route_id", routeInfo.ID, "error", err)
+		}
+	}
+	return data, nil
 }
 
 func (h *Handler) handleEditRoute(w http.ResponseWriter, r *http.Request, routeID string) {
@@ -216,9 +303,20 @@ func (h *Handler) handleEditRoute(w http.ResponseWriter, r *http.Request, routeI
 	route.RouteType = routeType
 	route.TransformationID = transformationID
 	route.IntegrationID = integrationID
+	route.Tags = parseTags(r)
+	currentRevision := route.Revision
+	route.Revision = formRevision(r)
+
+	if err := h.applyRouteOptions(r, route, lang); err != nil {
+		h.renderError(w, "routes.html", err.Error(), http.StatusBadRequest, r)
+		return
+	}
 
 	if err := h.Store.UpdateRoute(route); err != nil {
-		h.renderError(w, "routes.html", "Failed to update route: "+err.Error(), http.StatusInternalServerError, r)
+		route.Revision = currentRevision
+		if data, dataErr := h.routePageData(route, lang); dataErr != nil || !h.renderConflict(w, "route_details.html", data, err) {
+			h.renderError(w, "routes.html", "Failed to update route: "+err.Error(), http.StatusInternalServerError, r)
+		}
 		return
 	}
 
@@ -229,6 +327,41 @@ func (h *Handler) handleEditRoute(w http.ResponseWriter, r *http.Request, routeI
 	http.Redirect(w, r, "/admin/routes/"+routeID+"?status=updated", http.StatusSeeOther)
 }
 
+// handleRollbackRoute restores a previous version of a route and restarts its router. The rollback is
+// an update like any other, so the configuration it replaces becomes a new version and can be restored too.
+func (h *Handler) handleRollbackRoute(w http.ResponseWriter, r *http.Request, routeID, versionID string) {
+	lang := h.determineLanguage(r)
+	current, err := h.Store.GetRouteByID(routeID)
+	if err != nil || current == nil {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Route not found."), http.StatusNotFound, r)
+		return
+	}
+	id, err := strconv.ParseInt(versionID, 10, 64)
+	if err != nil {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Route version not found."), http.StatusNotFound, r)
+		return
+	}
+	version, err := h.Store.GetRouteVersion(routeID, id)
+	if err != nil || version == nil {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Route version not found."), http.StatusNotFound, r)
+		return
+	}
+
+	restored := version.Route
+	restored.ID = current.ID
+	restored.CreatedAt = current.CreatedAt
+	restored.Revision = current.Revision
+	if err := h.Store.UpdateRoute(&restored); err != nil {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Failed to roll back route: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.RabbitMQ.RestartRouter(restored.ID, restored.Name, restored.SourceChannelID)
+	h.Logger.Info("Route rolled back and worker restarted", "route_id", routeID, "version", version.Version)
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/routes/%s?status=rolled_back&version=%d", routeID, version.Version), http.StatusSeeOther)
+}
+
 func (h *Handler) handleCreateRoute(w http.ResponseWriter, r *http.Request) {
 	lang := h.determineLanguage(r)
 	if err := r.ParseForm(); err != nil {
@@ -274,6 +407,12 @@ func (h *Handler) handleCreateRoute(w http.ResponseWriter, r *http.Request) {
 		RouteType:            routeType,
 		TransformationID:     transformationID,
 		IntegrationID:        integrationID,
+		Tags:                 parseTags(r),
+	}
+
+	if err := h.applyRouteOptions(r, route, lang); err != nil {
+		h.renderError(w, "routes.html", err.Error(), http.StatusBadRequest, r)
+		return
 	}
 
 	if err := h.Store.CreateRoute(route); err != nil {
@@ -286,13 +425,226 @@ func (h *Handler) handleCreateRoute(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin/routes?status=created", http.StatusSeeOther)
 }
 
+// handleCloneRoute creates a disabled copy of a route, for operators who set up near-identical routes
+// per 1C base. The copy keeps the configuration of the original, including source, destination, type and
+// transformations, so only what differs has to be edited before it is enabled. Routing rules are not copied.
+func (h *Handler) handleCloneRoute(w http.ResponseWriter, r *http.Request, routeID string) {
+	lang := h.determineLanguage(r)
+	original, err := h.Store.GetRouteByID(routeID)
+	if err != nil || original == nil {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Route not found."), http.StatusNotFound, r)
+		return
+	}
+
+	clone := *original
+	clone.ID = uuid.New().String()
+	clone.Name = original.Name + " (copy)"
+	clone.Disabled = true
+	if err := h.Store.CreateRoute(&clone); err != nil {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Failed to duplicate route: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("route duplicated", "route_id", routeID, "clone_id", clone.ID)
+	http.Redirect(w, r, "/admin/routes/"+clone.ID+"?status=cloned", http.StatusSeeOther)
+}
+
 func (h *Handler) handleDeleteRoute(w http.ResponseWriter, r *http.Request, routeID string) {
 	lang := h.determineLanguage(r)
 	if err := h.Store.DeleteRoute(routeID); err != nil {
 		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Failed to delete route: %s", err.Error()), http.StatusInternalServerError, r)
 		return
 	}
+	// Restoring the route from the trash starts its router again.
+	h.RabbitMQ.StopRouter(routeID)
 
 	h.Logger.Info("route deleted successfully", "route_id", routeID)
 	http.Redirect(w, r, "/admin/routes?status=deleted", http.StatusSeeOther)
 }
+
+// applyRouteOptions reads the optional route settings shared by the create and edit forms.
+func (h *Handler) applyRouteOptions(r *http.Request, route *storage.Route, lang string) error {
+	conditions, err := parseGuardConditions(r.FormValue("guard_conditions"))
+	if err != nil {
+		return errors.New(h.I18n.Sprintf(lang, "Invalid guard condition: %s", err.Error()))
+	}
+	route.GuardConditions = conditions
+	route.GuardMismatchAction = r.FormValue("guard_mismatch_action")
+	if route.GuardMismatchAction != "forward" {
+		route.GuardMismatchAction = "skip"
+	}
+
+	route.DelaySeconds = 0
+	if delay := strings.TrimSpace(r.FormValue("delay_seconds")); delay != "" {
+		seconds, err := strconv.Atoi(delay)
+		if err != nil || seconds < 0 {
+			return errors.New(h.I18n.Sprintf(lang, "Delay must be a non-negative number of seconds."))
+		}
+		route.DelaySeconds = seconds
+	}
+
+	route.Priority = 0
+	if priority := strings.TrimSpace(r.FormValue("priority")); priority != "" {
+		value, err := strconv.Atoi(priority)
+		if err != nil || value < 0 || value > 255 {
+			return errors.New(h.I18n.Sprintf(lang, "Priority must be a number between 0 and 255."))
+		}
+		route.Priority = value
+	}
+
+	route.CanonicalizeJSON = r.FormValue("canonicalize_json") == "on"
+	route.Archive = r.FormValue("archive") == "on"
+
+	route.Disabled = r.FormValue("disabled") == "on"
+	route.RequestReply = r.FormValue("request_reply") == "on"
+	route.ReplyTimeoutSeconds = 30
+	if timeout := strings.TrimSpace(r.FormValue("reply_timeout_seconds")); timeout != "" {
+		value, err := strconv.Atoi(timeout)
+		if err != nil || value < 1 {
+			return errors.New(h.I18n.Sprintf(lang, "Reply timeout must be at least 1 second."))
+		}
+		route.ReplyTimeoutSeconds = value
+	}
+
+	route.BatchSize = 0
+	if batchSize := strings.TrimSpace(r.FormValue("batch_size")); batchSize != "" {
+		value, err := strconv.Atoi(batchSize)
+		if err != nil || value < 0 || value > rabbitmq.MaxBatchSize {
+			return errors.New(h.I18n.Sprintf(lang, "Batch size must be a number between 0 and %d.", rabbitmq.MaxBatchSize))
+		}
+		route.BatchSize = value
+	}
+
+	route.Concurrency = 0
+	if concurrency := strings.TrimSpace(r.FormValue("concurrency")); concurrency != "" {
+		value, err := strconv.Atoi(concurrency)
+		if err != nil || value < 0 || value > rabbitmq.MaxRouteConcurrency {
+			return errors.New(h.I18n.Sprintf(lang, "Concurrency must be a number between 0 and %d.", rabbitmq.MaxRouteConcurrency))
+		}
+		route.Concurrency = value
+	}
+
+	route.RateLimit = 0
+	if rateLimit := strings.TrimSpace(r.FormValue("rate_limit")); rateLimit != "" {
+		value, err := strconv.Atoi(rateLimit)
+		if err != nil || value < 0 {
+			return errors.New(h.I18n.Sprintf(lang, "Rate limit must be a non-negative number of messages per second."))
+		}
+		route.RateLimit = value
+	}
+
+	route.SampleRate = 0
+	route.SampleChannelID = strings.TrimSpace(r.FormValue("sample_channel_id"))
+	if sampleRate := strings.TrimSpace(r.FormValue("sample_rate")); sampleRate != "" {
+		value, err := strconv.Atoi(sampleRate)
+		if err != nil || value < 0 {
+			return errors.New(h.I18n.Sprintf(lang, "Sample rate must be a non-negative number."))
+		}
+		route.SampleRate = value
+	}
+	if route.SampleRate > 0 {
+		if route.SampleChannelID == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Select a sample channel to enable sampling."))
+		}
+		sampleChannel, err := h.Store.GetChannelByID(route.SampleChannelID)
+		if err != nil || sampleChannel == nil {
+			return errors.New(h.I18n.Sprintf(lang, "Sample channel not found."))
+		}
+	}
+
+	route.WiretapChannelID = strings.TrimSpace(r.FormValue("wiretap_channel_id"))
+	route.WiretapStage = rabbitmq.WiretapPost
+	if r.FormValue("wiretap_stage") == rabbitmq.WiretapPre {
+		route.WiretapStage = rabbitmq.WiretapPre
+	}
+	if route.WiretapChannelID != "" {
+		wiretapChannel, err := h.Store.GetChannelByID(route.WiretapChannelID)
+		if err != nil || wiretapChannel == nil {
+			return errors.New(h.I18n.Sprintf(lang, "Wiretap channel not found."))
+		}
+	}
+
+	route.ResequenceKey = strings.TrimSpace(r.FormValue("resequence_key"))
+	route.ResequenceSeconds = 10
+	if seconds := strings.TrimSpace(r.FormValue("resequence_seconds")); seconds != "" {
+		value, err := strconv.Atoi(seconds)
+		if err != nil || value < 1 {
+			return errors.New(h.I18n.Sprintf(lang, "Resequence window must be at least 1 second."))
+		}
+		route.ResequenceSeconds = value
+	}
+	if route.ResequenceKey != "" {
+		if route.ResequenceKey == "$." {
+			return errors.New(h.I18n.Sprintf(lang, "Sequence key must name a header or a body field."))
+		}
+		// Ordering needs a single consumer that sees every message on its own.
+		if route.Concurrency > 1 || route.BatchSize > 1 {
+			return errors.New(h.I18n.Sprintf(lang, "Resequencing cannot be combined with concurrency or batching."))
+		}
+	}
+
+	route.RetryMaxAttempts = 0
+	if attempts := strings.TrimSpace(r.FormValue("retry_max_attempts")); attempts != "" {
+		value, err := strconv.Atoi(attempts)
+		if err != nil || value < 0 {
+			return errors.New(h.I18n.Sprintf(lang, "Retry attempts must be a non-negative number."))
+		}
+		route.RetryMaxAttempts = value
+	}
+	route.RetryBackoffSeconds = 5
+	if backoff := strings.TrimSpace(r.FormValue("retry_backoff_seconds")); backoff != "" {
+		value, err := strconv.Atoi(backoff)
+		if err != nil || value < 1 {
+			return errors.New(h.I18n.Sprintf(lang, "Retry backoff must be at least 1 second."))
+		}
+		route.RetryBackoffSeconds = value
+	}
+
+	route.DeadLetterStore = r.FormValue("dead_letter_store")
+	if route.DeadLetterStore != storage.DeadLetterDatabase && route.DeadLetterStore != storage.DeadLetterBoth {
+		route.DeadLetterStore = storage.DeadLetterBroker
+	}
+
+	window, err := rabbitmq.ParseActivityWindow(r.FormValue("active_window"))
+	if err != nil {
+		return errors.New(h.I18n.Sprintf(lang, "Invalid activity window: %s", err.Error()))
+	}
+	route.ActiveWindow = ""
+	if window != nil {
+		route.ActiveWindow = window.String()
+	}
+
+	route.Pipeline = nil
+	if route.RouteType == "transform" {
+		for _, id := range r.Form["pipeline_transformation_id"] {
+			if id = strings.TrimSpace(id); id == "" {
+				continue
+			}
+			transform, err := h.Store.GetTransformationByID(id)
+			if err != nil || transform == nil {
+				return errors.New(h.I18n.Sprintf(lang, "Pipeline transformation not found."))
+			}
+			route.Pipeline = append(route.Pipeline, id)
+		}
+	}
+
+	route.EnrichURL, route.EnrichMerge, route.EnrichField = "", "shallow", ""
+	if route.RouteType == "enrich" {
+		route.EnrichURL = strings.TrimSpace(r.FormValue("enrich_url"))
+		if u, err := url.Parse(route.EnrichURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New(h.I18n.Sprintf(lang, "Enrichment URL must be an absolute http or https URL."))
+		}
+		route.EnrichMerge = r.FormValue("enrich_merge")
+		if !slices.Contains(rabbitmq.EnrichMergeStrategies, route.EnrichMerge) {
+			return errors.New(h.I18n.Sprintf(lang, "Unknown enrichment merge strategy."))
+		}
+		if route.EnrichMerge == "field" {
+			route.EnrichField = strings.TrimSpace(r.FormValue("enrich_field"))
+			if route.EnrichField == "" {
+				return errors.New(h.I18n.Sprintf(lang, "Enrichment field is required for the field merge strategy."))
+			}
+		}
+	}
+
+	return nil
+}
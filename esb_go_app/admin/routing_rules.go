@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// handleCreateRoutingRule appends a content-based routing rule to a route. Rules are read by the router
+// for every message, so the router does not need a restart.
+func (h *Handler) handleCreateRoutingRule(w http.ResponseWriter, r *http.Request, routeID string) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+	route, err := h.Store.GetRouteByID(routeID)
+	if err != nil || route == nil {
+		h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "Route not found."), http.StatusNotFound, r)
+		return
+	}
+
+	rule := storage.RoutingRule{
+		ID:                   uuid.New().String(),
+		RouteID:              routeID,
+		Field:                strings.TrimSpace(r.FormValue("field")),
+		Operator:             r.FormValue("operator"),
+		Value:                r.FormValue("value"),
+		DestinationChannelID: r.FormValue("destination_channel_id"),
+	}
+	if rule.Field == "" {
+		h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "The field of a routing rule is required."), http.StatusBadRequest, r)
+		return
+	}
+	if !isRoutingRuleOperator(rule.Operator) {
+		h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "Unknown routing rule operator: %s", rule.Operator), http.StatusBadRequest, r)
+		return
+	}
+	if rule.Operator == "regex" {
+		if _, err := regexp.Compile(rule.Value); err != nil {
+			h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "Invalid regular expression: %s", err.Error()), http.StatusBadRequest, r)
+			return
+		}
+	}
+	destination, err := h.Store.GetChannelByID(rule.DestinationChannelID)
+	if err != nil || destination == nil {
+		h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "Destination channel not found."), http.StatusBadRequest, r)
+		return
+	}
+
+	if err := h.Store.CreateRoutingRule(&rule); err != nil {
+		h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "Failed to create routing rule: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.Logger.Info("routing rule created", "route_id", routeID, "rule_id", rule.ID, "field", rule.Field, "operator", rule.Operator, "destination_channel_id", rule.DestinationChannelID)
+	http.Redirect(w, r, "/admin/routes/"+routeID+"?status=rule_created", http.StatusSeeOther)
+}
+
+// handleDeleteRoutingRule removes a routing rule from a route.
+func (h *Handler) handleDeleteRoutingRule(w http.ResponseWriter, r *http.Request, routeID, ruleID string) {
+	lang := h.determineLanguage(r)
+	if err := h.Store.DeleteRoutingRule(routeID, ruleID); err != nil {
+		h.renderError(w, "route_details.html", h.I18n.Sprintf(lang, "Failed to delete routing rule: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.Logger.Info("routing rule deleted", "route_id", routeID, "rule_id", ruleID)
+	http.Redirect(w, r, "/admin/routes/"+routeID+"?status=rule_deleted", http.StatusSeeOther)
+}
+
+// isRoutingRuleOperator reports whether op is one of the operators the router evaluates.
+func isRoutingRuleOperator(op string) bool {
+	for _, known := range rabbitmq.RoutingRuleOperators {
+		if op == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"esb-go-app/storage"
+)
+
+// jsonSchemaDialect is the JSON Schema version of the documents served under /admin/schema.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaModels are the models described by /admin/schema/{name}. The schemas are derived from
+// the Go types by reflection, so they follow every change to the structs without manual upkeep.
+var schemaModels = map[string]reflect.Type{
+	"channel":               reflect.TypeOf(storage.Channel{}),
+	"collector":             reflect.TypeOf(storage.Collector{}),
+	"integration":           reflect.TypeOf(storage.Integration{}),
+	"route":                 reflect.TypeOf(storage.Route{}),
+	"transformation":        reflect.TypeOf(storage.Transformation{}),
+	"transformation_bundle": reflect.TypeOf(TransformationBundle{}),
+	"reconciliation_report": reflect.TypeOf(ReconciliationReport{}),
+	"search_response":       reflect.TypeOf(SearchResponse{}),
+}
+
+// schemaEnums lists the allowed values of string fields, keyed by type name and JSON property name.
+var schemaEnums = map[string]map[string][]string{
+	"Channel":              {"Direction": storage.ChannelDirections},
+	"Collector":            {"Engine": storage.CollectorEngines},
+	"Route":                {"RouteType": {"direct", "transform", "enrich"}, "GuardMismatchAction": {"skip", "forward"}, "EnrichMerge": {"shallow", "deep", "field"}, "WiretapStage": {"pre", "post"}, "DeadLetterStore": {"", "database", "both"}},
+	"GuardCondition":       {"operator": {"equals", "contains", "regex"}},
+	"Transformation":       {"Engine": storage.TransformationEngines},
+	"TransformationBundle": {"engine": storage.TransformationEngines, "format": {transformationBundleFormat}},
+}
+
+// SchemaRoutes handles routing for /admin/schema/* paths.
+func SchemaRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// GET /admin/schema
+	if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+		h.handleSchemaIndex(w, r)
+		return
+	}
+
+	// GET /admin/schema/{model}
+	if len(parts) == 1 {
+		h.handleModelSchema(w, r, strings.TrimSuffix(parts[0], ".json"))
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// handleSchemaIndex lists the available model schemas together with the application version.
+func (h *Handler) handleSchemaIndex(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(schemaModels))
+	for name := range schemaModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	models := make(map[string]string, len(names))
+	for _, name := range names {
+		models[name] = "/admin/schema/" + name
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": h.Version,
+		"models":  models,
+	})
+}
+
+// handleModelSchema serves the JSON Schema of a single model.
+func (h *Handler) handleModelSchema(w http.ResponseWriter, r *http.Request, name string) {
+	t, ok := schemaModels[name]
+	if !ok {
+		writeJSONError(w, "unknown model: "+name, http.StatusNotFound)
+		return
+	}
+
+	schema := schemaForType(t)
+	schema["$schema"] = jsonSchemaDialect
+	schema["$id"] = "/admin/schema/" + name
+	schema["title"] = t.Name()
+
+	w.Header().Set("Content-Type", "application/schema+json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(schema)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaForType builds the JSON Schema of the value encoding/json produces for t.
+func schemaForType(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullableSchema(schemaForType(t.Elem()))
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		// A nil slice is encoded as null.
+		return nullableSchema(map[string]interface{}{"type": "array", "items": schemaForType(t.Elem())})
+	case reflect.Map:
+		return nullableSchema(map[string]interface{}{"type": "object", "additionalProperties": schemaForType(t.Elem())})
+	case reflect.Struct:
+		return objectSchema(t)
+	default:
+		// interface{} and anything else accepts any JSON value.
+		return map[string]interface{}{}
+	}
+}
+
+// objectSchema describes a struct the way encoding/json encodes it: json tags rename or drop fields,
+// omitempty fields are optional and the fields of embedded structs are promoted into the parent.
+func objectSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				collect(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			property := schemaForType(field.Type)
+			if values, ok := schemaEnums[t.Name()][name]; ok {
+				property["enum"] = values
+			}
+			properties[name] = property
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	collect(t)
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// nullableSchema additionally allows null for a schema with a single type.
+func nullableSchema(schema map[string]interface{}) map[string]interface{} {
+	if typeName, ok := schema["type"].(string); ok {
+		schema["type"] = []string{typeName, "null"}
+	}
+	return schema
+}
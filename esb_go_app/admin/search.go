@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"encoding/json"
+	"html"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// SearchHit is an object found by the search, with the page of the admin interface showing it.
+type SearchHit struct {
+	Kind        string        `json:"kind"`
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	URL         string        `json:"url"`
+	Snippet     string        `json:"snippet"` // Text around the matches
+	SnippetHTML template.HTML `json:"-"`       // The snippet with the matches highlighted, for the search page
+}
+
+// SearchResponse is the result of GET /admin/search/api.
+type SearchResponse struct {
+	Query   string      `json:"query"`
+	Results []SearchHit `json:"results"`
+}
+
+// SearchRoutes handles routing for /admin/search.
+func SearchRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET /admin/search[?q=]
+	if r.Method == http.MethodGet && (len(parts) == 0 || (len(parts) == 1 && parts[0] == "")) {
+		h.handleSearch(w, r)
+		return
+	}
+
+	// GET /admin/search/api?q=
+	if r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "api" {
+		h.handleSearchAPI(w, r)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// handleSearch shows the objects whose name, settings or script match the search term.
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	data := PageData{
+		SearchQuery:    strings.TrimSpace(r.URL.Query().Get("q")),
+		AcceptLanguage: lang,
+	}
+	hits, err := h.search(data.SearchQuery)
+	if err != nil {
+		h.renderError(w, "search.html", h.I18n.Sprintf(lang, "Search failed: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	data.SearchHits = hits
+	h.renderTemplate(w, "search.html", data)
+}
+
+// handleSearchAPI returns the objects matching the search term as JSON.
+func (h *Handler) handleSearchAPI(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeJSONError(w, "the q parameter is required", http.StatusBadRequest)
+		return
+	}
+	hits, err := h.search(query)
+	if err != nil {
+		writeJSONError(w, "search failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(SearchResponse{Query: query, Results: hits})
+}
+
+// search runs a search in the store and links its results to their pages.
+func (h *Handler) search(query string) ([]SearchHit, error) {
+	if query == "" {
+		return nil, nil
+	}
+	results, err := h.Store.SearchEntities(query, h.listSize())
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]SearchHit, 0, len(results))
+	for _, result := range results {
+		hits = append(hits, SearchHit{
+			Kind:        result.Kind,
+			ID:          result.ID,
+			Name:        result.Name,
+			URL:         searchResultURL(result),
+			Snippet:     strings.NewReplacer(storage.SnippetMatchStart, "", storage.SnippetMatchEnd, "").Replace(result.Snippet),
+			SnippetHTML: highlightSnippet(result.Snippet),
+		})
+	}
+	return hits, nil
+}
+
+// searchResultURL returns the admin page of an object found by the search.
+func searchResultURL(result storage.SearchResult) string {
+	switch result.Kind {
+	case storage.SearchApplication:
+		return "/admin/app/" + result.ID
+	case storage.SearchChannel:
+		return "/admin/app/" + result.ParentID + "/channel/" + result.ID
+	case storage.SearchRoute:
+		return "/admin/routes/" + result.ID
+	case storage.SearchTransformation:
+		return "/admin/transformations/" + result.ID
+	case storage.SearchCollector:
+		return "/admin/collectors/" + result.ID
+	}
+	return ""
+}
+
+// highlightSnippet escapes a snippet and turns its marked matches into <mark> elements.
+func highlightSnippet(snippet string) template.HTML {
+	escaped := html.EscapeString(snippet)
+	return template.HTML(strings.NewReplacer(storage.SnippetMatchStart, "<mark>", storage.SnippetMatchEnd, "</mark>").Replace(escaped))
+}
@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"esb-go-app/scripting"
+	"esb-go-app/storage"
+)
+
+// Setting groups of the settings page.
+const (
+	settingGroupRabbitMQ    = "rabbitmq"
+	settingGroupScripting   = "scripting"
+	settingGroupCredentials = "credentials"
+	settingGroupUI          = "ui"
+)
+
+// Settings of the user interface.
+var (
+	languageSetting = storage.SettingDefinition{Key: "language", Type: storage.SettingString, Options: []string{"en", "be", "ru"}}
+	listSizeSetting = storage.SettingDefinition{Key: "ui_list_size", Type: storage.SettingInt, Default: "100", Min: 10, Max: 1000}
+)
+
+// languageNames are the names of the interface languages, in their own language.
+var languageNames = map[string]string{"en": "English", "be": "Беларуская", "ru": "Русский"}
+
+// SettingField is a setting shown on the settings page.
+type SettingField struct {
+	storage.SettingDefinition
+	Label        string
+	Help         string
+	Value        string            // Stored value, empty while the default applies
+	OptionLabels map[string]string // Names shown for the options, the option itself when missing
+}
+
+// SettingChoice is a value offered by the select of a setting.
+type SettingChoice struct {
+	Value string
+	Label string
+}
+
+// Choices returns the values offered for a bool setting or a string setting with options, and nil for a
+// setting edited as text.
+func (f SettingField) Choices() []SettingChoice {
+	if f.Type == storage.SettingBool {
+		return []SettingChoice{{Value: "true", Label: "Yes"}, {Value: "false", Label: "No"}}
+	}
+	choices := make([]SettingChoice, 0, len(f.Options))
+	for _, option := range f.Options {
+		label := option
+		if name, ok := f.OptionLabels[option]; ok {
+			label = name
+		}
+		choices = append(choices, SettingChoice{Value: option, Label: label})
+	}
+	return choices
+}
+
+// DefaultLabel returns the label of the default value, shown on the option that keeps it.
+func (f SettingField) DefaultLabel() string {
+	for _, choice := range f.Choices() {
+		if choice.Value == f.Default {
+			return choice.Label
+		}
+	}
+	return f.Default
+}
+
+// SettingGroup is a form of the settings page saving related settings together.
+type SettingGroup struct {
+	ID          string
+	Title       string
+	Description string
+	Fields      []SettingField
+}
+
+// SettingsRoutes handles routing for /admin/settings.
+func SettingsRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET /admin/settings
+	if r.Method == http.MethodGet && (len(parts) == 0 || (len(parts) == 1 && parts[0] == "")) {
+		h.handleSettings(w, r)
+		return
+	}
+
+	// POST /admin/settings/update
+	if r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "update" {
+		h.handleUpdateSettings(w, r)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// settingGroups returns the typed settings of the settings page with their stored values.
+func (h *Handler) settingGroups() []SettingGroup {
+	scriptLimits := scripting.LimitSettings(h.scriptingService.DefaultLimits())
+	groups := []SettingGroup{
+		{
+			ID:          settingGroupRabbitMQ,
+			Title:       "Default channel options",
+			Description: "Preset on the new channel form. The destination prefix is added to every new channel destination that does not start with it.",
+			Fields: []SettingField{
+				{SettingDefinition: channelDefaultDestinationPrefixSetting, Label: "Destination prefix"},
+				{SettingDefinition: channelDefaultQueueTypeSetting, Label: "Queue type"},
+				{SettingDefinition: channelDefaultMessageTTLSetting, Label: "Message TTL (seconds)", Help: "0 keeps messages until they are consumed."},
+				{SettingDefinition: channelDefaultFanoutModeSetting, Label: "Fan-out"},
+			},
+		},
+		{
+			ID:          settingGroupScripting,
+			Title:       "Script limits",
+			Description: "Guard rails of every transformation and collector script run. They apply to the next runs without restarting any route; empty fields keep the limits of the configuration file.",
+			Fields: []SettingField{
+				{SettingDefinition: scriptLimits[0], Label: "Time limit", Help: "A duration such as 30s or 2m, 0s disables the limit."},
+				{SettingDefinition: scriptLimits[1], Label: "Memory limit (MB)", Help: "Heap growth allowed during a run, 0 disables the limit."},
+				{SettingDefinition: scriptLimits[2], Label: "Call stack depth", Help: "Maximum JavaScript call depth, 0 leaves it unlimited."},
+			},
+		},
+		{
+			ID:          settingGroupCredentials,
+			Title:       "Application credentials",
+			Description: "Applied when the credentials of an application are rotated on its page.",
+			Fields: []SettingField{
+				{SettingDefinition: appTokenGraceSetting, Label: "Previous ID token grace period (minutes)", Help: "How long the replaced ID token is still accepted, so the clients can switch to the new one. 0 rejects it at once."},
+			},
+		},
+		{
+			ID:    settingGroupUI,
+			Title: "User interface",
+			Fields: []SettingField{
+				{SettingDefinition: languageSetting, Label: "Language", Help: "Without a language the browser language is used.", OptionLabels: languageNames},
+				{SettingDefinition: listSizeSetting, Label: "List size", Help: "Rows shown on the traces, archive and audit pages, and on each page of the routes and applications lists."},
+			},
+		},
+	}
+	for _, group := range groups {
+		for i := range group.Fields {
+			value, err := h.Store.GetSetting(group.Fields[i].Key)
+			if err != nil {
+				h.Logger.Error("failed to get setting", "key", group.Fields[i].Key, "error", err)
+			}
+			group.Fields[i].Value = value
+		}
+	}
+	return groups
+}
+
+// handleSettings shows the settings page.
+func (h *Handler) handleSettings(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	data := PageData{
+		SettingGroups:       h.settingGroups(),
+		MailSettings:        h.loadMailSettings(),
+		TransformationHooks: h.loadTransformationHooks(),
+		AcceptLanguage:      lang,
+	}
+	var err error
+	if data.Transformations, err = h.Store.GetAllTransformations(); err != nil {
+		h.Logger.Error("failed to get transformations for the hook settings", "error", err)
+	}
+	if r.URL.Query().Get("status") == "settings_updated" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Settings updated successfully.")
+	}
+	h.renderTemplate(w, "settings.html", data)
+}
+
+// saveSettingGroup validates every setting of a group before storing any, so an invalid field leaves the
+// whole form unsaved, then applies the settings the running service reads only at startup.
+func (h *Handler) saveSettingGroup(r *http.Request, lang, groupID string) error {
+	var group *SettingGroup
+	groups := h.settingGroups()
+	for i := range groups {
+		if groups[i].ID == groupID {
+			group = &groups[i]
+		}
+	}
+	if group == nil {
+		return errors.New(h.I18n.Sprintf(lang, "Unknown settings group %s.", groupID))
+	}
+
+	for _, field := range group.Fields {
+		if _, err := field.Normalize(r.FormValue(field.Key)); err != nil {
+			return errors.New(h.I18n.Sprintf(lang, "Invalid value of %s: %s", h.I18n.Sprintf(lang, field.Label), err.Error()))
+		}
+	}
+	for _, field := range group.Fields {
+		if err := h.Store.SaveSetting(field.SettingDefinition, r.FormValue(field.Key)); err != nil {
+			return err
+		}
+	}
+
+	if group.ID == settingGroupScripting {
+		if err := h.scriptingService.ApplyLimitSettings(); err != nil {
+			return err
+		}
+		h.Logger.Info("script limits updated from the settings")
+	}
+	return nil
+}
+
+// listSize returns how many rows the list pages show.
+func (h *Handler) listSize() int {
+	size, err := h.Store.GetIntSetting(listSizeSetting)
+	if err != nil {
+		h.Logger.Error("failed to get list size setting", "error", err)
+	}
+	return size
+}
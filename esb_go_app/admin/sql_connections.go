@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"esb-go-app/storage"
+)
+
+// SQLConnectionRoutes handles routing for /admin/sql-connections/* paths.
+func SQLConnectionRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	if r.Method == http.MethodGet {
+		if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+			h.handleListSQLConnections(w, r)
+			return
+		}
+		if len(parts) == 1 {
+			connectionID := parts[0]
+			h.handleViewSQLConnection(w, r, connectionID)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		if len(parts) == 1 && parts[0] == "create" {
+			h.handleCreateSQLConnection(w, r)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "update" {
+			connectionID := parts[0]
+			h.handleUpdateSQLConnection(w, r, connectionID)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "delete" {
+			connectionID := parts[0]
+			h.handleDeleteSQLConnection(w, r, connectionID)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (h *Handler) handleListSQLConnections(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	connections, err := h.Store.GetAllSQLConnections()
+	if err != nil {
+		h.renderError(w, "sql_connections.html", h.I18n.Sprintf(lang, "Failed to retrieve SQL connections: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	data := PageData{
+		SQLConnections: connections,
+		AcceptLanguage: lang,
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "created" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "SQL connection created successfully!")
+	} else if status == "deleted" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "SQL connection deleted.")
+	} else if status == "updated" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "SQL connection updated successfully!")
+	}
+
+	h.renderTemplate(w, "sql_connections.html", data)
+}
+
+func (h *Handler) handleViewSQLConnection(w http.ResponseWriter, r *http.Request, connectionID string) {
+	lang := h.determineLanguage(r)
+	connection, err := h.Store.GetSQLConnectionByID(connectionID)
+	if err != nil {
+		h.renderError(w, "sql_connections.html", h.I18n.Sprintf(lang, "Failed to retrieve SQL connection: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if connection == nil {
+		h.renderError(w, "sql_connections.html", h.I18n.Sprintf(lang, "SQL connection not found."), http.StatusNotFound, r)
+		return
+	}
+
+	data := PageData{
+		SQLConnection:  connection,
+		AcceptLanguage: lang,
+	}
+	h.renderTemplate(w, "sql_connection_details.html", data)
+}
+
+// sqlConnectionFromForm reads the connection profile fields of the create and edit forms. The name is what
+// collector scripts pass to sql.query, so it is trimmed.
+func (h *Handler) sqlConnectionFromForm(r *http.Request, connectionID string) *storage.SQLConnection {
+	return &storage.SQLConnection{
+		ID:          connectionID,
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: r.FormValue("description"),
+		Driver:      r.FormValue("driver"),
+		DSN:         strings.TrimSpace(r.FormValue("dsn")),
+	}
+}
+
+// validateSQLConnection returns the message to show when a submitted connection profile is incomplete.
+func (h *Handler) validateSQLConnection(lang string, c *storage.SQLConnection) string {
+	if c.Name == "" || c.Driver == "" || c.DSN == "" {
+		return h.I18n.Sprintf(lang, "Name, driver, and connection string are required.")
+	}
+	if !slices.Contains(storage.SQLConnectionDrivers, c.Driver) {
+		return h.I18n.Sprintf(lang, "Unsupported SQL driver: %s", c.Driver)
+	}
+	return ""
+}
+
+func (h *Handler) handleCreateSQLConnection(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "sql_connections.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	connection := h.sqlConnectionFromForm(r, uuid.New().String())
+	if msg := h.validateSQLConnection(lang, connection); msg != "" {
+		h.renderError(w, "sql_connections.html", msg, http.StatusBadRequest, r)
+		return
+	}
+
+	if err := h.Store.CreateSQLConnection(connection); err != nil {
+		h.renderError(w, "sql_connections.html", h.I18n.Sprintf(lang, "Failed to create SQL connection: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("SQL connection created successfully", "connection_name", connection.Name, "connection_id", connection.ID)
+	http.Redirect(w, r, "/admin/sql-connections?status=created", http.StatusSeeOther)
+}
+
+func (h *Handler) handleUpdateSQLConnection(w http.ResponseWriter, r *http.Request, connectionID string) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "sql_connection_details.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+
+	connection := h.sqlConnectionFromForm(r, connectionID)
+	if msg := h.validateSQLConnection(lang, connection); msg != "" {
+		h.renderError(w, "sql_connection_details.html", msg, http.StatusBadRequest, r)
+		return
+	}
+
+	if err := h.Store.UpdateSQLConnection(connection); err != nil {
+		h.renderError(w, "sql_connection_details.html", h.I18n.Sprintf(lang, "Failed to update SQL connection: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("SQL connection updated successfully", "connection_id", connectionID)
+	http.Redirect(w, r, "/admin/sql-connections?status=updated", http.StatusSeeOther)
+}
+
+func (h *Handler) handleDeleteSQLConnection(w http.ResponseWriter, r *http.Request, connectionID string) {
+	lang := h.determineLanguage(r)
+	if err := h.Store.DeleteSQLConnection(connectionID); err != nil {
+		h.renderError(w, "sql_connections.html", h.I18n.Sprintf(lang, "Failed to delete SQL connection: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("SQL connection deleted successfully", "connection_id", connectionID)
+	http.Redirect(w, r, "/admin/sql-connections?status=deleted", http.StatusSeeOther)
+}
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// IntegrationStatus is the traffic-light state of one integration on the public status page.
+type IntegrationStatus struct {
+	Name   string
+	Status string // "green", "yellow", "red" or "inactive"
+}
+
+// ServeStatusPage renders the unauthenticated status page. It only reveals integration names and
+// whether their routes are running, never payloads, queues or credentials.
+func (h *Handler) ServeStatusPage(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	integrations, err := h.Store.GetAllIntegrations()
+	if err != nil {
+		h.Logger.Error("failed to get integrations for status page", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	statuses := make([]IntegrationStatus, 0, len(integrations))
+	for _, integration := range integrations {
+		routes, err := h.Store.GetRoutesByIntegrationID(integration.ID)
+		if err != nil {
+			h.Logger.Error("failed to get routes for status page", "error", err, "integration_id", integration.ID)
+			statuses = append(statuses, IntegrationStatus{Name: integration.Name, Status: "red"})
+			continue
+		}
+		statuses = append(statuses, IntegrationStatus{Name: integration.Name, Status: h.integrationStatus(routes)})
+	}
+
+	h.renderTemplate(w, "status_page.html", PageData{
+		IntegrationStatuses: statuses,
+		AcceptLanguage:      lang,
+	})
+}
+
+// integrationStatus is green when every enabled route of the integration is healthy, red when none is,
+// and yellow otherwise. Disabled routes have no router and are left out; an integration without enabled
+// routes exchanges nothing and is inactive rather than green.
+func (h *Handler) integrationStatus(routes []storage.RouteInfo) string {
+	enabled, healthy := 0, 0
+	for _, route := range routes {
+		if route.Disabled {
+			continue
+		}
+		enabled++
+		if h.isRouteHealthy(route) {
+			healthy++
+		}
+	}
+	switch {
+	case enabled == 0:
+		return "inactive"
+	case healthy == enabled:
+		return "green"
+	case healthy == 0:
+		return "red"
+	default:
+		return "yellow"
+	}
+}
+
+// isRouteHealthy checks that the router and the workers of its source and destination channels are running
+// and that none of these channels has raised its silence alert or tripped the destination's circuit breaker.
+func (h *Handler) isRouteHealthy(route storage.RouteInfo) bool {
+	if !h.RabbitMQ.IsRouterRunning(route.ID) {
+		return false
+	}
+	if _, open := h.RabbitMQ.DestinationBreaker(route.DestinationChannelID); open {
+		return false
+	}
+
+	channelIDs := []string{route.DestinationChannelID}
+	if !strings.HasPrefix(route.SourceChannelID, "collector-output:") {
+		channelIDs = append(channelIDs, route.SourceChannelID)
+	} else if !h.RabbitMQ.IsConnected("") {
+		return false
+	}
+
+	for _, channelID := range channelIDs {
+		if channelID == "" {
+			continue
+		}
+		ch, err := h.Store.GetChannelByID(channelID)
+		if err != nil || ch == nil {
+			return false
+		}
+		if !h.RabbitMQ.IsConnected(rabbitmq.ChannelConnection(ch)) || !h.RabbitMQ.IsChannelWorkerRunning(rabbitmq.ChannelConnection(ch), ch.Direction, ch.Destination) {
+			return false
+		}
+		if h.RabbitMQ.IsChannelSilent(ch) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// parseTags reads the comma-separated tags field of a form.
+func parseTags(r *http.Request) []string {
+	return storage.NormalizeTags(strings.Split(r.FormValue("tags"), ","))
+}
+
+// filterTagged keeps the rows of a list carrying the tag of the tag parameter of a request. It sets the tag
+// filter of the page, offering the tags of all rows.
+func filterTagged[T any](r *http.Request, data *PageData, rows []T, tags func(T) []string) []T {
+	var all []string
+	for _, row := range rows {
+		all = append(all, tags(row)...)
+	}
+	data.TagOptions = storage.NormalizeTags(all)
+	sort.Strings(data.TagOptions)
+
+	data.TagFilter = strings.TrimSpace(r.URL.Query().Get("tag"))
+	if data.TagFilter == "" {
+		return rows
+	}
+	var tagged []T
+	for _, row := range rows {
+		if storage.HasTag(tags(row), data.TagFilter) {
+			tagged = append(tagged, row)
+		}
+	}
+	return tagged
+}
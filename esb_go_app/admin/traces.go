@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// TraceRoutes handles routing for /admin/traces.
+func TraceRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET /admin/traces[?q=]
+	if r.Method == http.MethodGet && (len(parts) == 0 || (len(parts) == 1 && parts[0] == "")) {
+		h.handleTraces(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// handleTraces searches a trace by its trace ID or a message ID and shows every hop of it. Without a
+// search it lists the most recent traces.
+func (h *Handler) handleTraces(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	data := PageData{
+		TraceQuery:     query,
+		AcceptLanguage: lang,
+	}
+
+	routes, err := h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		h.renderError(w, "traces.html", h.I18n.Sprintf(lang, "Failed to get routes: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	data.TraceRouteNames = make(map[string]string, len(routes))
+	for _, route := range routes {
+		data.TraceRouteNames[route.ID] = route.Name
+	}
+
+	if query == "" {
+		data.RecentTraces, err = h.Store.GetRecentTraces(h.listSize())
+	} else {
+		data.TraceHops, err = h.Store.SearchTraceHops(query)
+	}
+	if err != nil {
+		h.renderError(w, "traces.html", h.I18n.Sprintf(lang, "Failed to read traces: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	h.renderTemplate(w, "traces.html", data)
+}
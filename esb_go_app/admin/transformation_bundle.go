@@ -0,0 +1,190 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"esb-go-app/storage"
+)
+
+// transformationBundleFormat identifies the portable single-file transformation format.
+const transformationBundleFormat = "esb-transformation/v1"
+
+// maxTransformationBundleSize limits the size of an uploaded bundle.
+const maxTransformationBundleSize = 5 << 20
+
+// TransformationBundle is the portable representation of a transformation that is shared between installations.
+type TransformationBundle struct {
+	Format      string                       `json:"format"`
+	Name        string                       `json:"name"`
+	Description string                       `json:"description,omitempty"`
+	Engine      string                       `json:"engine"`
+	Script      string                       `json:"script"`
+	Tests       []storage.TransformationTest `json:"tests,omitempty"`
+	Samples     []map[string]interface{}     `json:"samples,omitempty"`
+	Tags        []string                     `json:"tags,omitempty"`
+	ExportedAt  time.Time                    `json:"exported_at"`
+	AppVersion  string                       `json:"app_version,omitempty"`
+}
+
+// handleExportTransformation serves a transformation as a downloadable bundle file.
+func (h *Handler) handleExportTransformation(w http.ResponseWriter, r *http.Request, transformationID string) {
+	lang := h.determineLanguage(r)
+	transformation, err := h.Store.GetTransformationByID(transformationID)
+	if err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to retrieve transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if transformation == nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Transformation not found."), http.StatusNotFound, r)
+		return
+	}
+
+	bundle := TransformationBundle{
+		Format:      transformationBundleFormat,
+		Name:        transformation.Name,
+		Description: transformation.Description,
+		Engine:      transformation.Engine,
+		Script:      transformation.Script,
+		Tests:       transformation.Tests,
+		Samples:     transformation.Samples,
+		Tags:        transformation.Tags,
+		ExportedAt:  time.Now().UTC(),
+		AppVersion:  h.Version,
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to export transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="transformation.json"; filename*=UTF-8''%s.json`, url.PathEscape(transformation.Name)))
+	_, _ = w.Write(data)
+	h.Logger.Info("transformation exported", "transformation_id", transformation.ID, "transformation_name", transformation.Name)
+}
+
+// handleImportTransformation creates a transformation from an uploaded bundle after its tests pass.
+// With "replace" set, a transformation of the same name is overwritten instead of rejected.
+func (h *Handler) handleImportTransformation(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	if err := r.ParseMultipartForm(maxTransformationBundleSize); err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to parse form."), http.StatusBadRequest, r)
+		return
+	}
+	file, _, err := r.FormFile("bundle")
+	if err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "A bundle file is required."), http.StatusBadRequest, r)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxTransformationBundleSize))
+	if err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to read bundle file: %s", err.Error()), http.StatusBadRequest, r)
+		return
+	}
+
+	var bundle TransformationBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Invalid bundle file: %s", err.Error()), http.StatusBadRequest, r)
+		return
+	}
+	if bundle.Format != transformationBundleFormat {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Unsupported bundle format %q, expected %q.", bundle.Format, transformationBundleFormat), http.StatusBadRequest, r)
+		return
+	}
+
+	transformation := &storage.Transformation{
+		ID:          uuid.New().String(),
+		Name:        bundle.Name,
+		Description: bundle.Description,
+		Engine:      bundle.Engine,
+		Script:      bundle.Script,
+		Tests:       bundle.Tests,
+		Samples:     bundle.Samples,
+		Tags:        bundle.Tags,
+	}
+	if err := storage.ValidateTransformation(transformation); err != nil {
+		h.renderError(w, "transformations.html", h.validationMessage(lang, err), http.StatusBadRequest, r)
+		return
+	}
+	if err := h.runTransformationTests(transformation, lang); err != nil {
+		h.renderError(w, "transformations.html", err.Error(), http.StatusBadRequest, r)
+		return
+	}
+
+	existing, err := h.Store.GetTransformationByName(bundle.Name)
+	if err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to retrieve transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if existing != nil {
+		if r.FormValue("replace") != "on" {
+			h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "A transformation named %s already exists.", bundle.Name), http.StatusConflict, r)
+			return
+		}
+		transformation.ID = existing.ID
+		if err := h.Store.UpdateTransformation(transformation); err != nil {
+			h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to update transformation: %s", err.Error()), http.StatusInternalServerError, r)
+			return
+		}
+	} else if err := h.Store.CreateTransformation(transformation); err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to create transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("transformation imported successfully", "transformation_name", transformation.Name, "transformation_id", transformation.ID, "tests", len(transformation.Tests), "replaced", existing != nil)
+	http.Redirect(w, r, "/admin/transformations?status=imported", http.StatusSeeOther)
+}
+
+// parseTransformationExtras reads the tests and samples JSON fields of the transformation forms.
+func (h *Handler) parseTransformationExtras(r *http.Request, transformation *storage.Transformation, lang string) error {
+	if raw := r.FormValue("tests"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &transformation.Tests); err != nil {
+			return errors.New(h.I18n.Sprintf(lang, "Invalid tests JSON: %s", err.Error()))
+		}
+	}
+	if raw := r.FormValue("samples"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &transformation.Samples); err != nil {
+			return errors.New(h.I18n.Sprintf(lang, "Invalid sample payloads JSON: %s", err.Error()))
+		}
+	}
+	return nil
+}
+
+// runTransformationTests executes the script against every test case and returns the first failure.
+func (h *Handler) runTransformationTests(transformation *storage.Transformation, lang string) error {
+	for _, result := range h.testTransformation(transformation).Results {
+		if result.Error != "" {
+			return errors.New(h.I18n.Sprintf(lang, "Test %s failed: %s", result.Name, result.Error))
+		}
+		if !result.Passed {
+			return errors.New(h.I18n.Sprintf(lang, "Test %s failed: expected %s, got %s", result.Name, result.Expected, result.Actual))
+		}
+	}
+	return nil
+}
+
+// cloneJSONMap deep-copies a JSON object, returning an empty map for nil.
+func cloneJSONMap(m map[string]interface{}) (map[string]interface{}, error) {
+	clone := make(map[string]interface{})
+	if m == nil {
+		return clone, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
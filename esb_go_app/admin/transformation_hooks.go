@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// loadTransformationHooks reads the global transformation hooks shown on the settings form.
+func (h *Handler) loadTransformationHooks() storage.TransformationHooks {
+	hooks, err := h.Store.GetTransformationHooks()
+	if err != nil {
+		h.Logger.Error("failed to get transformation hooks", "error", err)
+	}
+	return hooks
+}
+
+// saveTransformationHooks validates and stores the hooks of the settings form and hands them to the
+// running routers, so they apply to the next messages without restarting any route.
+func (h *Handler) saveTransformationHooks(r *http.Request, lang string) error {
+	hooks := storage.TransformationHooks{
+		PreID:  strings.TrimSpace(r.FormValue("hook_pre_transformation_id")),
+		PostID: strings.TrimSpace(r.FormValue("hook_post_transformation_id")),
+	}
+	for _, id := range []string{hooks.PreID, hooks.PostID} {
+		if id == "" {
+			continue
+		}
+		transformation, err := h.Store.GetTransformationByID(id)
+		if err != nil {
+			return err
+		}
+		if transformation == nil {
+			return errors.New(h.I18n.Sprintf(lang, "Transformation not found."))
+		}
+	}
+	if err := h.Store.SaveTransformationHooks(hooks); err != nil {
+		return err
+	}
+	h.RabbitMQ.SetTransformationHooks(hooks)
+	return nil
+}
@@ -0,0 +1,216 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"esb-go-app/storage"
+)
+
+// TransformationTestResult is the outcome of one test case of a transformation.
+type TransformationTestResult struct {
+	Name     string   `json:"name"`
+	Passed   bool     `json:"passed"`
+	Expected string   `json:"expected"`         // Expected body as JSON, null when the message must be filtered
+	Actual   string   `json:"actual,omitempty"` // Body returned by the script as JSON
+	Diff     []string `json:"diff,omitempty"`   // One line per differing JSON path
+	Error    string   `json:"error,omitempty"`  // Why the script could not be run
+}
+
+// TransformationTestReport is the result of running all test cases of a transformation, shown on the
+// transformation page and returned by POST /admin/transformations/{id}/tests.
+type TransformationTestReport struct {
+	TransformationID string                     `json:"transformation_id"`
+	Passed           bool                       `json:"passed"`
+	Total            int                        `json:"total"`
+	Failed           int                        `json:"failed"`
+	Results          []TransformationTestResult `json:"results"`
+}
+
+// testTransformation runs every test case of the transformation and reports all of them, so a script
+// author sees each failing case at once. Test runs use a throwaway kv state.
+func (h *Handler) testTransformation(transformation *storage.Transformation) TransformationTestReport {
+	report := TransformationTestReport{TransformationID: transformation.ID, Results: []TransformationTestResult{}}
+	for i, test := range transformation.Tests {
+		result := h.runTransformationTest(transformation, test)
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if !result.Passed {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+	report.Total = len(report.Results)
+	report.Passed = report.Failed == 0
+	return report
+}
+
+// runTransformationTest executes the script against one test case and compares the result with the expected body.
+func (h *Handler) runTransformationTest(transformation *storage.Transformation, test storage.TransformationTest) TransformationTestResult {
+	result := TransformationTestResult{Name: test.Name}
+	expected, err := normalizeJSON(test.Expected)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	expectedJSON, _ := json.Marshal(expected)
+	result.Expected = string(expectedJSON)
+
+	// Scripts may modify their input, so every run gets its own copy of the test data.
+	message, err := cloneJSONMap(test.Message)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	headers, err := cloneJSONMap(test.Headers)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	transformed, err := h.scriptingService.ExecuteScript(transformation.Engine, "", transformation.Script, message, headers, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var body interface{}
+	if transformed != nil && transformed.Body != nil {
+		body = transformed.Body
+	}
+	actual, err := normalizeJSON(body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	actualJSON, _ := json.Marshal(actual)
+	result.Actual = string(actualJSON)
+
+	result.Diff = jsonDiff("$", expected, actual)
+	result.Passed = len(result.Diff) == 0
+	return result
+}
+
+// normalizeJSON round-trips a value through JSON, so values produced by the scripts and decoded from the
+// tests compare alike.
+func normalizeJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// jsonDiff lists the differences between two decoded JSON values as "path: expected X, got Y" lines.
+func jsonDiff(path string, expected, actual interface{}) []string {
+	switch exp := expected.(type) {
+	case map[string]interface{}:
+		act, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(exp)+len(act))
+		for k := range exp {
+			keys = append(keys, k)
+		}
+		for k := range act {
+			if _, ok := exp[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var diff []string
+		for _, k := range keys {
+			expValue, inExpected := exp[k]
+			actValue, inActual := act[k]
+			switch {
+			case !inActual:
+				diff = append(diff, fmt.Sprintf("%s.%s: missing, expected %s", path, k, jsonText(expValue)))
+			case !inExpected:
+				diff = append(diff, fmt.Sprintf("%s.%s: unexpected %s", path, k, jsonText(actValue)))
+			default:
+				diff = append(diff, jsonDiff(path+"."+k, expValue, actValue)...)
+			}
+		}
+		return diff
+	case []interface{}:
+		act, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		if len(exp) != len(act) {
+			return []string{fmt.Sprintf("%s: expected %d items, got %d", path, len(exp), len(act))}
+		}
+		var diff []string
+		for i := range exp {
+			diff = append(diff, jsonDiff(fmt.Sprintf("%s[%d]", path, i), exp[i], act[i])...)
+		}
+		return diff
+	}
+	if jsonText(expected) == jsonText(actual) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: expected %s, got %s", path, jsonText(expected), jsonText(actual))}
+}
+
+// jsonText formats a decoded JSON value for a diff line.
+func jsonText(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// handleRunTransformationTests runs the tests of a transformation and shows the report on its page.
+func (h *Handler) handleRunTransformationTests(w http.ResponseWriter, r *http.Request, transformationID string) {
+	lang := h.determineLanguage(r)
+	transformation, err := h.Store.GetTransformationByID(transformationID)
+	if err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to retrieve transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	if transformation == nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Transformation not found."), http.StatusNotFound, r)
+		return
+	}
+
+	report := h.testTransformation(transformation)
+	h.Logger.Info("transformation tests run", "transformation_id", transformationID, "total", report.Total, "failed", report.Failed)
+
+	data := h.transformationPageData(transformation, lang)
+	data.TestReport = &report
+	if len(transformation.Tests) == 0 {
+		data.ErrorMessage = h.I18n.Sprintf(lang, "The transformation has no tests.")
+	} else if report.Passed {
+		data.StatusMessage = h.I18n.Sprintf(lang, "All %d tests passed.", report.Total)
+	} else {
+		data.ErrorMessage = h.I18n.Sprintf(lang, "%d of %d tests failed.", report.Failed, report.Total)
+	}
+	h.renderTemplate(w, "transformation_details.html", data)
+}
+
+// handleTransformationTestsAPI runs the tests of a transformation and returns the report as JSON. The
+// response status is 200 whether or not the tests pass; check the passed field. Only POST runs them, as
+// the scripts may send HTTP requests and mails.
+func (h *Handler) handleTransformationTestsAPI(w http.ResponseWriter, r *http.Request, transformationID string) {
+	transformation, err := h.Store.GetTransformationByID(transformationID)
+	if err != nil {
+		writeJSONError(w, "failed to retrieve transformation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if transformation == nil {
+		writeJSONError(w, "transformation not found", http.StatusNotFound)
+		return
+	}
+
+	report := h.testTransformation(transformation)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,193 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// currentVersion selects the saved transformation, rather than one of its versions, in a comparison.
+const currentVersion = "current"
+
+// maxDiffCells bounds the work of a script comparison; longer scripts are shown as entirely replaced.
+const maxDiffCells = 4 << 20
+
+// DiffLine is a line of a script comparison.
+type DiffLine struct {
+	Op      string // " " in both scripts, "-" only in the older one, "+" only in the newer one
+	Text    string
+	OldLine int // Line number in the older script, 0 for added lines
+	NewLine int // Line number in the newer script, 0 for removed lines
+}
+
+// ScriptDiff compares two versions of a transformation on its page.
+type ScriptDiff struct {
+	From      string // currentVersion or the ID of a version, as selected in the form
+	To        string
+	FromTitle string
+	ToTitle   string
+	Lines     []DiffLine
+	Changed   []string // Other settings that differ, such as the tests
+	Same      bool     // The scripts are identical
+}
+
+// compareTransformationVersions prepares the comparison selected with the from and to query parameters of
+// the transformation page. Without from nothing is compared; without to, from is compared with the saved
+// transformation.
+func (h *Handler) compareTransformationVersions(r *http.Request, current *storage.Transformation, versions []storage.TransformationVersion, lang string) *ScriptDiff {
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		return nil
+	}
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		to = currentVersion
+	}
+	pick := func(selected string) (*storage.Transformation, string, bool) {
+		if selected == currentVersion {
+			return current, h.I18n.Sprintf(lang, "Current"), true
+		}
+		for i := range versions {
+			if strconv.FormatInt(versions[i].ID, 10) == selected {
+				return &versions[i].Transformation, h.I18n.Sprintf(lang, "Version %d", versions[i].Version), true
+			}
+		}
+		return nil, "", false
+	}
+	older, fromTitle, okFrom := pick(from)
+	newer, toTitle, okTo := pick(to)
+	if !okFrom || !okTo {
+		return nil
+	}
+
+	diff := &ScriptDiff{From: from, To: to, FromTitle: fromTitle, ToTitle: toTitle, Lines: diffLines(older.Script, newer.Script)}
+	diff.Same = older.Script == newer.Script
+	if older.Name != newer.Name {
+		diff.Changed = append(diff.Changed, h.I18n.Sprintf(lang, "Name"))
+	}
+	if older.Description != newer.Description {
+		diff.Changed = append(diff.Changed, h.I18n.Sprintf(lang, "Description"))
+	}
+	if older.Engine != newer.Engine {
+		diff.Changed = append(diff.Changed, h.I18n.Sprintf(lang, "Engine"))
+	}
+	if !reflect.DeepEqual(older.Tests, newer.Tests) {
+		diff.Changed = append(diff.Changed, h.I18n.Sprintf(lang, "Tests"))
+	}
+	if !reflect.DeepEqual(older.Samples, newer.Samples) {
+		diff.Changed = append(diff.Changed, h.I18n.Sprintf(lang, "Sample payloads"))
+	}
+	return diff
+}
+
+// diffLines compares two scripts line by line with their longest common subsequence.
+func diffLines(older, newer string) []DiffLine {
+	a := strings.Split(older, "\n")
+	b := strings.Split(newer, "\n")
+	if len(a)*len(b) > maxDiffCells {
+		lines := make([]DiffLine, 0, len(a)+len(b))
+		for i, text := range a {
+			lines = append(lines, DiffLine{Op: "-", Text: text, OldLine: i + 1})
+		}
+		for j, text := range b {
+			lines = append(lines, DiffLine{Op: "+", Text: text, NewLine: j + 1})
+		}
+		return lines
+	}
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	common := make([][]int32, len(a)+1)
+	for i := range common {
+		common[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]DiffLine, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Text: a[i], OldLine: i + 1, NewLine: j + 1})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, DiffLine{Op: "-", Text: a[i], OldLine: i + 1})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j], NewLine: j + 1})
+			j++
+		}
+	}
+	return lines
+}
+
+// handleRollbackTransformation restores a previous version of a transformation and restarts the routers
+// that run it. Like a route rollback, it is an update like any other, so the script it replaces becomes a
+// new version and can be restored too.
+func (h *Handler) handleRollbackTransformation(w http.ResponseWriter, r *http.Request, transformationID, versionID string) {
+	lang := h.determineLanguage(r)
+	current, err := h.Store.GetTransformationByID(transformationID)
+	if err != nil || current == nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Transformation not found."), http.StatusNotFound, r)
+		return
+	}
+	id, err := strconv.ParseInt(versionID, 10, 64)
+	if err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Transformation version not found."), http.StatusNotFound, r)
+		return
+	}
+	version, err := h.Store.GetTransformationVersion(transformationID, id)
+	if err != nil || version == nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Transformation version not found."), http.StatusNotFound, r)
+		return
+	}
+
+	restored := version.Transformation
+	restored.ID = current.ID
+	restored.CreatedAt = current.CreatedAt
+	restored.Revision = current.Revision
+	if err := h.Store.UpdateTransformation(&restored); err != nil {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to roll back transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	restarted := h.restartTransformationRouters(transformationID)
+	h.Logger.Info("transformation rolled back", "transformation_id", transformationID, "version", version.Version, "routers_restarted", restarted)
+	http.Redirect(w, r, fmt.Sprintf("/admin/transformations/%s?status=rolled_back&version=%d", transformationID, version.Version), http.StatusSeeOther)
+}
+
+// restartTransformationRouters restarts the routers of the routes that run a transformation, in their
+// transformation, their pipeline or as a global hook, so no batch in progress keeps the replaced script.
+// It returns how many routers were restarted.
+func (h *Handler) restartTransformationRouters(transformationID string) int {
+	routes, err := h.Store.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		h.Logger.Error("failed to get routes to restart after transformation change", "transformation_id", transformationID, "error", err)
+		return 0
+	}
+	hook := h.loadTransformationHooks().Uses(transformationID)
+	restarted := 0
+	for _, route := range routes {
+		if route.RouteType != "transform" {
+			continue
+		}
+		if hook || route.TransformationID == transformationID || slices.Contains(route.Pipeline, transformationID) {
+			h.RabbitMQ.RestartRouter(route.ID, route.Name, route.SourceChannelID)
+			restarted++
+		}
+	}
+	return restarted
+}
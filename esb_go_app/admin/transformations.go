@@ -1,6 +1,8 @@
 package admin
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -8,6 +10,9 @@ import (
 	"esb-go-app/storage"
 )
 
+// maxShownExecutions is how many of the latest script runs the transformation page lists.
+const maxShownExecutions = 100
+
 // TransformationRoutes handles routing for /admin/transformations/* paths.
 func TransformationRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
 	if r.Method == http.MethodGet {
@@ -20,13 +25,33 @@ func TransformationRoutes(h *Handler, w http.ResponseWriter, r *http.Request, pa
 			h.handleViewTransformation(w, r, transformationID)
 			return
 		}
+		if len(parts) == 2 && parts[1] == "export" {
+			transformationID := parts[0]
+			h.handleExportTransformation(w, r, transformationID)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "delete" {
+			transformationID := parts[0]
+			h.handleDeleteTransformationImpact(w, r, transformationID)
+			return
+		}
 	}
 
 	if r.Method == http.MethodPost {
+		// POST /admin/transformations/{id}/tests
+		if len(parts) == 2 && parts[1] == "tests" {
+			transformationID := parts[0]
+			h.handleTransformationTestsAPI(w, r, transformationID)
+			return
+		}
 		if len(parts) == 1 && parts[0] == "create" {
 			h.handleCreateTransformation(w, r)
 			return
 		}
+		if len(parts) == 1 && parts[0] == "import" {
+			h.handleImportTransformation(w, r)
+			return
+		}
 		if len(parts) == 2 && parts[0] == "update" {
 			transformationID := parts[1]
 			h.handleUpdateTransformation(w, r, transformationID)
@@ -37,6 +62,16 @@ func TransformationRoutes(h *Handler, w http.ResponseWriter, r *http.Request, pa
 			h.handleDeleteTransformation(w, r, transformationID)
 			return
 		}
+		if len(parts) == 2 && parts[1] == "run-tests" {
+			transformationID := parts[0]
+			h.handleRunTransformationTests(w, r, transformationID)
+			return
+		}
+		if len(parts) == 4 && parts[1] == "versions" && parts[3] == "rollback" {
+			transformationID := parts[0]
+			h.handleRollbackTransformation(w, r, transformationID, parts[2])
+			return
+		}
 	}
 
 	http.NotFound(w, r)
@@ -44,29 +79,37 @@ func TransformationRoutes(h *Handler, w http.ResponseWriter, r *http.Request, pa
 
 func (h *Handler) handleListTransformations(w http.ResponseWriter, r *http.Request) {
 	lang := h.determineLanguage(r)
-	transformations, err := h.Store.GetAllTransformations()
+	data, err := h.transformationsPageData(r, lang)
 	if err != nil {
 		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to retrieve transformations: %s", err.Error()), http.StatusInternalServerError, r)
 		return
 	}
 
-	data := PageData{
-		Transformations: transformations,
-		AcceptLanguage:  lang,
-	}
-
 	status := r.URL.Query().Get("status")
 	if status == "created" {
 		data.StatusMessage = h.I18n.Sprintf(lang, "Transformation created successfully!")
 	} else if status == "deleted" {
-		data.StatusMessage = h.I18n.Sprintf(lang, "Transformation deleted.")
+		data.StatusMessage = h.I18n.Sprintf(lang, "Transformation moved to the trash, where it can be restored.")
 	} else if status == "updated" {
 		data.StatusMessage = h.I18n.Sprintf(lang, "Transformation updated successfully!")
+	} else if status == "imported" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Transformation imported successfully!")
 	}
 
 	h.renderTemplate(w, "transformations.html", data)
 }
 
+// transformationsPageData prepares the transformations list, filtered by tag.
+func (h *Handler) transformationsPageData(r *http.Request, lang string) (PageData, error) {
+	transformations, err := h.Store.GetAllTransformations()
+	if err != nil {
+		return PageData{}, err
+	}
+	data := PageData{AcceptLanguage: lang}
+	data.Transformations = filterTagged(r, &data, transformations, func(t storage.Transformation) []string { return t.Tags })
+	return data, nil
+}
+
 func (h *Handler) handleViewTransformation(w http.ResponseWriter, r *http.Request, transformationID string) {
 	lang := h.determineLanguage(r)
 	transformation, err := h.Store.GetTransformationByID(transformationID)
@@ -79,12 +122,41 @@ func (h *Handler) handleViewTransformation(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	data := h.transformationPageData(transformation, lang)
+	data.ScriptDiff = h.compareTransformationVersions(r, transformation, data.TransformationHistory, lang)
+	if r.URL.Query().Get("status") == "rolled_back" {
+		data.StatusMessage = h.I18n.Sprintf(lang, "Transformation rolled back to version %s.", r.URL.Query().Get("version"))
+	}
+	h.renderTemplate(w, "transformation_details.html", data)
+}
+
+// transformationPageData prepares the edit page of a transformation, with its tests and samples as indented JSON.
+func (h *Handler) transformationPageData(transformation *storage.Transformation, lang string) PageData {
 	data := PageData{
 		Transformation: transformation,
 		AcceptLanguage: lang,
 	}
-
-	h.renderTemplate(w, "transformation_details.html", data)
+	if len(transformation.Tests) > 0 {
+		if tests, err := json.MarshalIndent(transformation.Tests, "", "  "); err == nil {
+			data.TransformationTests = string(tests)
+		}
+	}
+	if len(transformation.Samples) > 0 {
+		if samples, err := json.MarshalIndent(transformation.Samples, "", "  "); err == nil {
+			data.TransformationSamples = string(samples)
+		}
+	}
+	executions, err := h.Store.GetScriptExecutions(transformation.ID, maxShownExecutions)
+	if err != nil {
+		h.Logger.Warn("failed to get script executions", "transformation_id", transformation.ID, "error", err)
+	}
+	data.ScriptExecutions = executions
+	versions, err := h.Store.GetTransformationVersions(transformation.ID)
+	if err != nil {
+		h.Logger.Warn("failed to get transformation versions", "transformation_id", transformation.ID, "error", err)
+	}
+	data.TransformationHistory = versions
+	return data
 }
 
 func (h *Handler) handleCreateTransformation(w http.ResponseWriter, r *http.Request) {
@@ -95,19 +167,20 @@ func (h *Handler) handleCreateTransformation(w http.ResponseWriter, r *http.Requ
 	}
 
 	transformation := &storage.Transformation{
-		ID:     uuid.New().String(),
-		Name:   r.FormValue("name"),
-		Engine: r.FormValue("engine"),
-		Script: r.FormValue("script"),
-	}
-
-	if transformation.Name == "" || transformation.Engine == "" || transformation.Script == "" {
-		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Name, engine, and script are required."), http.StatusBadRequest, r)
-		return
+		ID:          uuid.New().String(),
+		Name:        r.FormValue("name"),
+		Description: r.FormValue("description"),
+		Engine:      r.FormValue("engine"),
+		Script:      r.FormValue("script"),
+		Tags:        parseTags(r),
 	}
 
 	if err := h.Store.CreateTransformation(transformation); err != nil {
-		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to create transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		data, dataErr := h.transformationsPageData(r, lang)
+		data.Transformation = transformation // The create form shows the submitted values again
+		if dataErr != nil || !h.renderInvalid(w, "transformations.html", data, err) {
+			h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to create transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		}
 		return
 	}
 
@@ -123,19 +196,30 @@ func (h *Handler) handleUpdateTransformation(w http.ResponseWriter, r *http.Requ
 	}
 
 	transformation := &storage.Transformation{
-		ID:     transformationID,
-		Name:   r.FormValue("name"),
-		Engine: r.FormValue("engine"),
-		Script: r.FormValue("script"),
+		ID:          transformationID,
+		Name:        r.FormValue("name"),
+		Description: r.FormValue("description"),
+		Engine:      r.FormValue("engine"),
+		Script:      r.FormValue("script"),
+		Tags:        parseTags(r),
+		Revision:    formRevision(r),
 	}
 
-	if transformation.Name == "" || transformation.Engine == "" || transformation.Script == "" {
-		h.renderError(w, "transformation_details.html", h.I18n.Sprintf(lang, "Name, engine, and script are required."), http.StatusBadRequest, r)
+	if err := h.parseTransformationExtras(r, transformation, lang); err != nil {
+		h.renderError(w, "transformation_details.html", err.Error(), http.StatusBadRequest, r)
 		return
 	}
 
 	if err := h.Store.UpdateTransformation(transformation); err != nil {
-		h.renderError(w, "transformation_details.html", h.I18n.Sprintf(lang, "Failed to update transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		if errors.Is(err, storage.ErrConflict) {
+			if current, _ := h.Store.GetTransformationByID(transformationID); current != nil {
+				transformation.Revision = current.Revision
+			}
+		}
+		data := h.transformationPageData(transformation, lang)
+		if !h.renderInvalid(w, "transformation_details.html", data, err) && !h.renderConflict(w, "transformation_details.html", data, err) {
+			h.renderError(w, "transformation_details.html", h.I18n.Sprintf(lang, "Failed to update transformation: %s", err.Error()), http.StatusInternalServerError, r)
+		}
 		return
 	}
 
@@ -143,13 +227,22 @@ func (h *Handler) handleUpdateTransformation(w http.ResponseWriter, r *http.Requ
 	http.Redirect(w, r, "/admin/transformations?status=updated", http.StatusSeeOther)
 }
 
+// handleDeleteTransformation moves a transformation to the trash and restarts the routers of the routes
+// using it, which stops those it disabled.
 func (h *Handler) handleDeleteTransformation(w http.ResponseWriter, r *http.Request, transformationID string) {
 	lang := h.determineLanguage(r)
-	if err := h.Store.DeleteTransformation(transformationID); err != nil {
+	// Routers would fail every message that reaches a deleted hook.
+	if h.loadTransformationHooks().Uses(transformationID) {
+		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "The transformation is a global hook. Remove it from the hook settings before deleting it."), http.StatusConflict, r)
+		return
+	}
+	dependents, err := h.Store.DeleteTransformation(transformationID)
+	if err != nil {
 		h.renderError(w, "transformations.html", h.I18n.Sprintf(lang, "Failed to delete transformation: %s", err.Error()), http.StatusInternalServerError, r)
 		return
 	}
+	h.releaseRouters(dependents)
 
-	h.Logger.Info("transformation deleted successfully", "transformation_id", transformationID)
+	h.Logger.Info("transformation deleted successfully", "transformation_id", transformationID, "dependent_routes", len(dependents))
 	http.Redirect(w, r, "/admin/transformations?status=deleted", http.StatusSeeOther)
 }
@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// TrashRoutes handles routing for /admin/trash/* paths.
+func TrashRoutes(h *Handler, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET /admin/trash
+	if r.Method == http.MethodGet && (len(parts) == 0 || (len(parts) == 1 && parts[0] == "")) {
+		h.handleTrash(w, r)
+		return
+	}
+
+	// POST /admin/trash/{id}/restore
+	if r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "restore" {
+		h.handleRestoreTrashItem(w, r, parts[0])
+		return
+	}
+
+	// POST /admin/trash/{id}/purge
+	if r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "purge" {
+		h.handlePurgeTrashItem(w, r, parts[0])
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// SetTrashRetention sets the retention shown on the trash page. The housekeeping job purges the routes,
+// transformations and channels deleted longer than retention ago.
+func (h *Handler) SetTrashRetention(retention time.Duration) {
+	h.trashRetention = retention
+}
+
+// handleTrash lists the deleted routes, transformations and channels.
+func (h *Handler) handleTrash(w http.ResponseWriter, r *http.Request) {
+	lang := h.determineLanguage(r)
+	items, err := h.Store.GetTrash()
+	if err != nil {
+		h.renderError(w, "trash.html", h.I18n.Sprintf(lang, "Failed to read the trash: %s", err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+	data := PageData{
+		TrashItems:         items,
+		TrashRetentionDays: int(h.trashRetention / (24 * time.Hour)),
+		AcceptLanguage:     lang,
+	}
+
+	switch r.URL.Query().Get("status") {
+	case "restored":
+		data.StatusMessage = h.I18n.Sprintf(lang, "%s restored.", r.URL.Query().Get("name"))
+	case "purged":
+		data.StatusMessage = h.I18n.Sprintf(lang, "%s deleted permanently.", r.URL.Query().Get("name"))
+	}
+	h.renderTemplate(w, "trash.html", data)
+}
+
+// handleRestoreTrashItem recreates a deleted object and starts what deleting it stopped: the router of a
+// route, the worker and topology of a channel, and the routers of the routes given back their references
+// to a channel or transformation.
+func (h *Handler) handleRestoreTrashItem(w http.ResponseWriter, r *http.Request, idParam string) {
+	lang := h.determineLanguage(r)
+	item, ok := h.trashItem(w, r, idParam, lang)
+	if !ok {
+		return
+	}
+
+	if item.Kind == storage.TrashChannel {
+		app, err := h.Store.GetApplicationByID(item.Channel.ApplicationID)
+		if err != nil || app == nil {
+			h.renderError(w, "trash.html", h.I18n.Sprintf(lang, "The application of the channel no longer exists."), http.StatusConflict, r)
+			return
+		}
+	}
+	relinked, err := h.Store.RestoreTrashItem(item)
+	if err != nil {
+		h.renderError(w, "trash.html", h.I18n.Sprintf(lang, "Failed to restore %s: %s", item.Name, err.Error()), http.StatusConflict, r)
+		return
+	}
+
+	switch item.Kind {
+	case storage.TrashRoute:
+		h.RabbitMQ.StartRouter(item.Route.ID, item.Route.Name, item.Route.SourceChannelID)
+	case storage.TrashChannel:
+		// Read the channel back for the current vhost of its application.
+		ch, err := h.Store.GetChannelByID(item.EntityID)
+		if err != nil || ch == nil {
+			ch = item.Channel
+		}
+		if err := h.RabbitMQ.SetupDurableTopology(rabbitmq.ChannelConnection(ch), ch.Destination, rabbitmq.ChannelQueueOptions(ch)); err != nil {
+			h.Logger.Error("failed to setup durable topology of restored channel", "channel_id", ch.ID, "error", err)
+		} else {
+			h.RabbitMQ.StartChannelWorker(rabbitmq.ChannelConnection(ch), ch.Direction, ch.Destination)
+		}
+	}
+
+	for _, d := range relinked {
+		if !d.WasDisabled {
+			h.RabbitMQ.RestartRouter(d.RouteID, d.RouteName, d.SourceChannelID)
+		}
+	}
+
+	h.Logger.Info("restored from trash", "kind", item.Kind, "id", item.EntityID, "name", item.Name, "routes_relinked", len(relinked))
+	http.Redirect(w, r, fmt.Sprintf("/admin/trash?status=restored&name=%s", url.QueryEscape(item.Name)), http.StatusSeeOther)
+}
+
+// handlePurgeTrashItem deletes an object of the trash for good.
+func (h *Handler) handlePurgeTrashItem(w http.ResponseWriter, r *http.Request, idParam string) {
+	lang := h.determineLanguage(r)
+	item, ok := h.trashItem(w, r, idParam, lang)
+	if !ok {
+		return
+	}
+	if err := h.Store.PurgeTrashItem(item); err != nil {
+		h.renderError(w, "trash.html", h.I18n.Sprintf(lang, "Failed to delete %s permanently: %s", item.Name, err.Error()), http.StatusInternalServerError, r)
+		return
+	}
+
+	h.Logger.Info("purged from trash", "kind", item.Kind, "id", item.EntityID, "name", item.Name)
+	http.Redirect(w, r, fmt.Sprintf("/admin/trash?status=purged&name=%s", url.QueryEscape(item.Name)), http.StatusSeeOther)
+}
+
+// trashItem loads the trash item of a request, rendering the error page when there is none.
+func (h *Handler) trashItem(w http.ResponseWriter, r *http.Request, idParam, lang string) (*storage.TrashItem, bool) {
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	item, err := h.Store.GetTrashItem(id)
+	if err != nil {
+		h.renderError(w, "trash.html", h.I18n.Sprintf(lang, "Failed to read the trash: %s", err.Error()), http.StatusInternalServerError, r)
+		return nil, false
+	}
+	if item == nil {
+		h.renderError(w, "trash.html", h.I18n.Sprintf(lang, "The item is no longer in the trash."), http.StatusNotFound, r)
+		return nil, false
+	}
+	return item, true
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// fieldErrors returns the translated messages of the invalid fields of a validation error keyed by form
+// field, or nil when err is not a validation error.
+func (h *Handler) fieldErrors(lang string, err error) map[string]string {
+	var invalid *storage.ValidationError
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+	fields := make(map[string]string, len(invalid.Fields))
+	for _, f := range invalid.Fields {
+		if _, ok := fields[f.Field]; !ok {
+			fields[f.Field] = h.I18n.Sprintf(lang, f.Message, f.Args...)
+		}
+	}
+	return fields
+}
+
+// validationMessage joins the translated messages of a validation error, for the pages that have no form
+// to show them next to the fields. Other errors are returned as they are.
+func (h *Handler) validationMessage(lang string, err error) string {
+	var invalid *storage.ValidationError
+	if !errors.As(err, &invalid) {
+		return err.Error()
+	}
+	messages := make([]string, 0, len(invalid.Fields))
+	for _, f := range invalid.Fields {
+		messages = append(messages, h.I18n.Sprintf(lang, f.Message, f.Args...))
+	}
+	return strings.Join(messages, " ")
+}
+
+// renderInvalid shows a form again with the messages of its invalid fields and returns true when err is a
+// validation error. Other errors are left to the caller.
+func (h *Handler) renderInvalid(w http.ResponseWriter, templateName string, data PageData, err error) bool {
+	data.FieldErrors = h.fieldErrors(data.AcceptLanguage, err)
+	if data.FieldErrors == nil {
+		return false
+	}
+	data.StatusMessage = ""
+	data.ErrorMessage = h.I18n.Sprintf(data.AcceptLanguage, "Some fields are not valid, see the messages next to them.")
+	w.WriteHeader(http.StatusBadRequest)
+	h.renderTemplate(w, templateName, data)
+	return true
+}
+
+// formRevision returns the revision an edit form was rendered with, or 0 when the form has none, which
+// updates the object without checking for concurrent edits.
+func formRevision(r *http.Request) int {
+	revision, _ := strconv.Atoi(r.FormValue("revision"))
+	return revision
+}
+
+// renderConflict shows an edit form again with the submitted values and returns true when err is a
+// conflict with a concurrent edit. The caller moves the submitted object to the stored revision first, so
+// saving the form again deliberately replaces the other edit.
+func (h *Handler) renderConflict(w http.ResponseWriter, templateName string, data PageData, err error) bool {
+	if !errors.Is(err, storage.ErrConflict) {
+		return false
+	}
+	data.StatusMessage = ""
+	data.ErrorMessage = h.I18n.Sprintf(data.AcceptLanguage, "Someone else changed this while you were editing it. Your changes were not saved and are shown below; reload the page to see the other changes, or save again to replace them.")
+	w.WriteHeader(http.StatusConflict)
+	h.renderTemplate(w, templateName, data)
+	return true
+}
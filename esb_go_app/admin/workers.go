@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"esb-go-app/rabbitmq"
+)
+
+// Actions of the worker controls on the route and channel pages. A paused worker stays stopped until it
+// is resumed or restarted, or the service starts again.
+const (
+	workerPause   = "pause"
+	workerResume  = "resume"
+	workerRestart = "restart"
+)
+
+// workerStatuses are the status query values of the page redirected to after each worker action.
+var workerStatuses = map[string]string{
+	workerPause:   "worker_paused",
+	workerResume:  "worker_resumed",
+	workerRestart: "worker_restarted",
+}
+
+// isWorkerAction reports whether action is one of the worker controls.
+func isWorkerAction(action string) bool {
+	_, ok := workerStatuses[action]
+	return ok
+}
+
+// workerStatusMessage returns the message shown on a page after one of its worker controls was used, or
+// an empty string for another status.
+func (h *Handler) workerStatusMessage(lang, status string) string {
+	switch status {
+	case "worker_paused":
+		return h.I18n.Sprintf(lang, "Worker paused. It stays stopped until it is resumed or the service restarts.")
+	case "worker_resumed":
+		return h.I18n.Sprintf(lang, "Worker resumed.")
+	case "worker_restarted":
+		return h.I18n.Sprintf(lang, "Worker restarted.")
+	}
+	return ""
+}
+
+// handleRouteWorker pauses, resumes or restarts the router of a route. A disabled route has no router to
+// start, it is enabled by editing the route.
+func (h *Handler) handleRouteWorker(w http.ResponseWriter, r *http.Request, routeID, action string) {
+	lang := h.determineLanguage(r)
+	route, err := h.Store.GetRouteByID(routeID)
+	if err != nil || route == nil {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "Route not found."), http.StatusNotFound, r)
+		return
+	}
+	if route.Disabled && action != workerPause {
+		h.renderError(w, "routes.html", h.I18n.Sprintf(lang, "The route is disabled, enable it to start its router."), http.StatusConflict, r)
+		return
+	}
+
+	switch action {
+	case workerPause:
+		h.RabbitMQ.StopRouter(route.ID)
+	case workerResume:
+		if !h.RabbitMQ.IsRouterRunning(route.ID) {
+			h.RabbitMQ.StartRouter(route.ID, route.Name, route.SourceChannelID)
+		}
+	case workerRestart:
+		h.RabbitMQ.RestartRouter(route.ID, route.Name, route.SourceChannelID)
+	}
+	h.Logger.Info("router worker controlled from admin", "route_id", route.ID, "action", action)
+	http.Redirect(w, r, fmt.Sprintf("/admin/routes/%s?status=%s", route.ID, workerStatuses[action]), http.StatusSeeOther)
+}
+
+// handleChannelWorker pauses, resumes or restarts the worker of a channel. Resuming and restarting
+// declare the durable topology of the channel again, like saving the channel does.
+func (h *Handler) handleChannelWorker(w http.ResponseWriter, r *http.Request, appID, channelID, action string) {
+	lang := h.determineLanguage(r)
+	ch, err := h.Store.GetChannelByID(channelID)
+	if err != nil || ch == nil {
+		h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Channel not found."), http.StatusNotFound, r)
+		return
+	}
+
+	connName := rabbitmq.ChannelConnection(ch)
+	switch action {
+	case workerPause:
+		h.RabbitMQ.StopChannelWorker(connName, ch.Direction, ch.Destination)
+	case workerResume:
+		if !h.RabbitMQ.IsChannelWorkerRunning(connName, ch.Direction, ch.Destination) {
+			if err := h.RabbitMQ.SetupDurableTopology(connName, ch.Destination, rabbitmq.ChannelQueueOptions(ch)); err != nil {
+				h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Failed to setup durable topology: %s", err.Error()), http.StatusBadGateway, r)
+				return
+			}
+			h.RabbitMQ.StartChannelWorker(connName, ch.Direction, ch.Destination)
+		}
+	case workerRestart:
+		if err := h.RabbitMQ.RestartChannelWorkers(ch, ch); err != nil {
+			h.renderError(w, "app_details.html", h.I18n.Sprintf(lang, "Failed to restart the worker: %s", err.Error()), http.StatusBadGateway, r)
+			return
+		}
+	}
+	h.Logger.Info("channel worker controlled from admin", "channel_id", ch.ID, "destination", ch.Destination, "action", action)
+	http.Redirect(w, r, fmt.Sprintf("/admin/app/%s/channel/%s?status=%s", appID, ch.ID, workerStatuses[action]), http.StatusSeeOther)
+}
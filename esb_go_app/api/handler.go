@@ -13,14 +13,14 @@ import (
 )
 
 type Handler struct {
-	Store            *storage.Store
+	Store            storage.Store
 	RabbitMQ         *rabbitmq.RabbitMQ
 	Logger           *slog.Logger
 	scriptingService *scripting.Service
 	I18n             *i18n.Service
 }
 
-func NewHandler(s *storage.Store, r *rabbitmq.RabbitMQ, l *slog.Logger, ss *scripting.Service, i18n *i18n.Service) *Handler {
+func NewHandler(s storage.Store, r *rabbitmq.RabbitMQ, l *slog.Logger, ss *scripting.Service, i18n *i18n.Service) *Handler {
 	return &Handler{
 		Store:            s,
 		RabbitMQ:         r,
@@ -175,6 +175,10 @@ func (h *Handler) handleGetRuntimeChannels(w http.ResponseWriter, r *http.Reques
 		"items": items,
 		"port":  5672,
 	}
+	// Tenants with their own vhost connect to it instead of the broker's default vhost.
+	if app.VHost != "" {
+		responseBody["vhost"] = app.VHost
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(responseBody)
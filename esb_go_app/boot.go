@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+
+	"esb-go-app/rabbitmq"
+	"esb-go-app/storage"
+)
+
+// runBounded runs every task with at most limit tasks in flight and waits until all of them finish.
+func runBounded(limit int, tasks []func()) {
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(task func()) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			task()
+		}(task)
+	}
+	wg.Wait()
+}
+
+// initChannelWorkers declares the durable topology and starts the worker of every channel in parallel.
+func initChannelWorkers(dataStore storage.Store, rmq *rabbitmq.RabbitMQ, log *slog.Logger, concurrency int) {
+	apps, err := dataStore.GetAllApplications(storage.ListFilter{})
+	if err != nil {
+		log.Error("failed to get applications for worker init", "error", err)
+		return
+	}
+
+	var tasks []func()
+	for _, app := range apps {
+		channels, err := dataStore.GetChannelsByAppID(app.ID)
+		if err != nil {
+			log.Error("failed to get channels for worker init", "app_id", app.ID, "error", err)
+			continue
+		}
+		for _, ch := range channels {
+			ch := ch
+			tasks = append(tasks, func() {
+				log.Info("setting up topology and starting worker on boot", "channel_name", ch.Name, "destination", ch.Destination, "direction", ch.Direction)
+				if err := rmq.SetupDurableTopology(rabbitmq.ChannelConnection(&ch), ch.Destination, rabbitmq.ChannelQueueOptions(&ch)); err != nil {
+					log.Error("failed to setup durable topology on boot", "channel_name", ch.Name, "error", err)
+					return
+				}
+
+				if ch.Direction == "inbound" {
+					rmq.StartInboundForwarder(rabbitmq.ChannelConnection(&ch), ch.Destination)
+				} else if ch.Direction == "outbound" {
+					rmq.StartOutboundCollector(rabbitmq.ChannelConnection(&ch), ch.Destination)
+				} else {
+					log.Warn("unknown channel direction, no worker started", "channel_name", ch.Name, "direction", ch.Direction)
+				}
+			})
+		}
+	}
+	runBounded(concurrency, tasks)
+}
+
+// initRouters starts the router worker of every route in parallel.
+func initRouters(dataStore storage.Store, rmq *rabbitmq.RabbitMQ, log *slog.Logger, concurrency int) {
+	routes, err := dataStore.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		log.Error("failed to get routes for router init", "error", err)
+		return
+	}
+
+	var tasks []func()
+	for _, route := range routes {
+		route := route
+		tasks = append(tasks, func() {
+			log.Info("starting router worker", "route_id", route.ID, "source_id", route.SourceChannelID, "route_type", route.RouteType, "route_name", route.Name)
+			if route.SourceChannelID != "" {
+				rmq.StartRouter(route.ID, route.Name, route.SourceChannelID)
+			} else {
+				log.Error("route missing source channel ID, skipping router start", "route_id", route.ID)
+			}
+		})
+	}
+	runBounded(concurrency, tasks)
+}
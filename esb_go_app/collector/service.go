@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"esb-go-app/rabbitmq"
 	"esb-go-app/scripting"
@@ -12,14 +13,14 @@ import (
 
 // Service is responsible for running collectors.
 type Service struct {
-	store     *storage.Store
+	store     storage.Store
 	scripting *scripting.Service
 	rmq       *rabbitmq.RabbitMQ
 	logger    *slog.Logger
 }
 
 // NewService creates a new collector service.
-func NewService(store *storage.Store, scripting *scripting.Service, rmq *rabbitmq.RabbitMQ, logger *slog.Logger) *Service {
+func NewService(store storage.Store, scripting *scripting.Service, rmq *rabbitmq.RabbitMQ, logger *slog.Logger) *Service {
 	return &Service{
 		store:     store,
 		scripting: scripting,
@@ -28,7 +29,10 @@ func NewService(store *storage.Store, scripting *scripting.Service, rmq *rabbitm
 	}
 }
 
-// RunCollector executes a single collector job.
+// runHistorySize is how many runs of every collector are kept in the run history.
+const runHistorySize = 100
+
+// RunCollector executes a single collector job and records the run in the history of the collector.
 func (s *Service) RunCollector(collectorID string) {
 	s.logger.Info("running collector", "collector_id", collectorID)
 
@@ -38,39 +42,67 @@ func (s *Service) RunCollector(collectorID string) {
 		return
 	}
 
+	run := &storage.CollectorRun{CollectorID: collector.ID, StartedAt: time.Now()}
+	run.Messages, err = s.runCollector(collector)
+	run.FinishedAt = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if err := s.store.RecordCollectorRun(run, runHistorySize); err != nil {
+		s.logger.Error("failed to record collector run", "collector_id", collectorID, "error", err)
+	}
+}
+
+// runCollector executes the script of a collector and publishes what it returned. It returns the number
+// of published messages, with the error that stopped the run.
+func (s *Service) runCollector(collector *storage.Collector) (int, error) {
+	collectorID := collector.ID
+
 	// Execute the script
-	transformedMsg, err := s.scripting.ExecuteScript(collector.Engine, collector.Script, nil, nil)
+	transformedMsg, err := s.scripting.ExecuteScript(collector.Engine, storage.CollectorStateNamespace(collector.ID), collector.Script, nil, nil, &scripting.ScriptContext{CollectorID: collector.ID, CollectorName: collector.Name})
 	if err != nil {
 		s.logger.Error("failed to execute collector script", "collector_id", collectorID, "error", err)
-		return
+		return 0, fmt.Errorf("failed to execute collector script: %w", err)
 	}
 
-	if transformedMsg == nil || transformedMsg.Body == nil {
+	if transformedMsg == nil || (transformedMsg.Body == nil && len(transformedMsg.Messages) == 0) {
 		s.logger.Info("collector script did not return any data", "collector_id", collectorID)
-		return
+		return 0, nil
 	}
 
-	// Marshal the message body to JSON
-	bodyBytes, err := json.Marshal(transformedMsg.Body)
-	if err != nil {
-		s.logger.Error("failed to marshal collector message body to JSON", "collector_id", collectorID, "error", err)
-		return
+	// A collect function that returned a list publishes one message per item
+	messages := transformedMsg.Messages
+	if transformedMsg.Body != nil {
+		messages = []*scripting.TransformedMessage{transformedMsg}
+	}
+
+	// Marshal every message body to JSON before publishing, so a bad item does not leave a partial batch
+	payloads := make([][]byte, 0, len(messages))
+	for i, msg := range messages {
+		bodyBytes, err := json.Marshal(msg.Body)
+		if err != nil {
+			s.logger.Error("failed to marshal collector message body to JSON", "collector_id", collectorID, "message_index", i, "error", err)
+			return 0, fmt.Errorf("failed to marshal message %d to JSON: %w", i, err)
+		}
+		payloads = append(payloads, bodyBytes)
 	}
 
 	// The destination is now an internal exchange unique to the collector
 	exchangeName := fmt.Sprintf("collector-output:%s", collector.ID)
 
-	if err := s.rmq.EnsureExchange(exchangeName); err != nil {
+	if err := s.rmq.EnsureExchange(rabbitmq.DefaultConnection, exchangeName); err != nil {
 		s.logger.Error("failed to ensure collector output exchange exists", "collector_id", collectorID, "exchange", exchangeName, "error", err)
-		return
+		return 0, fmt.Errorf("failed to ensure output exchange %s: %w", exchangeName, err)
 	}
 
-	// Publish the message to the collector's own output exchange
-	err = s.rmq.Publish(exchangeName, "", string(bodyBytes))
-	if err != nil {
-		s.logger.Error("failed to publish collected message", "collector_id", collectorID, "exchange", exchangeName, "error", err)
-		return
+	// Publish the messages to the collector's own output exchange
+	for i, payload := range payloads {
+		if err := s.rmq.PublishCollected(rabbitmq.DefaultConnection, exchangeName, payload, messages[i]); err != nil {
+			s.logger.Error("failed to publish collected message", "collector_id", collectorID, "exchange", exchangeName, "published", i, "total", len(payloads), "error", err)
+			return i, fmt.Errorf("failed to publish message %d of %d: %w", i+1, len(payloads), err)
+		}
 	}
 
-	s.logger.Info("collector successfully executed and message published", "collector_id", collectorID, "exchange", exchangeName)
+	s.logger.Info("collector successfully executed and messages published", "collector_id", collectorID, "exchange", exchangeName, "count", len(payloads))
+	return len(payloads), nil
 }
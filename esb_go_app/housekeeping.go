@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"esb-go-app/config"
+	"esb-go-app/storage"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleHousekeeping adds the job that deletes the history and purges the trash items older than the
+// retentions of the configuration to the scheduler of the collectors.
+func scheduleHousekeeping(c *cron.Cron, cfg *config.Config, dataStore storage.Store, log *slog.Logger) {
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	policy := storage.RetentionPolicy{
+		AuditLog:      days(cfg.AuditRetentionDays),
+		CollectorRuns: days(cfg.CollectorRunRetentionDays),
+		Archive:       days(cfg.ArchiveRetentionDays),
+		TraceHops:     days(cfg.TraceRetentionDays),
+		Trash:         days(cfg.TrashRetentionDays),
+	}
+	_, err := c.AddFunc(cfg.HousekeepingSchedule, func() {
+		result, err := dataStore.Housekeep(policy, time.Now())
+		if err != nil {
+			log.Error("housekeeping failed", "error", err)
+		}
+		if result.Total() > 0 {
+			log.Info("housekeeping pruned expired history", "audit_entries", result.AuditEntries, "collector_runs", result.CollectorRuns,
+				"archived_messages", result.ArchivedMessages, "trace_hops", result.TraceHops, "trash_items", result.TrashItems)
+		}
+	})
+	if err != nil {
+		log.Error("failed to schedule housekeeping", "schedule", cfg.HousekeepingSchedule, "error", err)
+		return
+	}
+	log.Info("housekeeping scheduled", "schedule", cfg.HousekeepingSchedule, "audit_retention_days", cfg.AuditRetentionDays,
+		"collector_run_retention_days", cfg.CollectorRunRetentionDays, "archive_retention_days", cfg.ArchiveRetentionDays,
+		"trace_retention_days", cfg.TraceRetentionDays, "trash_retention_days", cfg.TrashRetentionDays)
+}
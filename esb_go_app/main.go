@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"esb-go-app/admin"
 	"esb-go-app/api"
@@ -40,14 +41,37 @@ func main() {
 		os.Exit(1)
 	}
 	log.Info("logger initialized successfully")
-	log.Info("config loaded", "port", cfg.Port, "log_dir", cfg.LogDir, "db_path", cfg.DBPath, "rabbitmq_dsn", cfg.RabbitMQ.DSN)
-
-	dataStore, err := storage.NewStore(cfg.DBPath, log)
+	log.Info("config loaded", "port", cfg.Port, "log_dir", cfg.LogDir, "db_driver", cfg.DBDriver, "db_path", cfg.DBPath, "rabbitmq_dsn", cfg.RabbitMQ.DSN)
+
+	var dataStore storage.Store
+	switch cfg.DBDriver {
+	case storage.DriverSQLite, "":
+		dataStore, err = storage.NewStore(cfg.DBPath, log)
+	case storage.DriverPostgres:
+		dataStore, err = storage.NewPostgresStore(cfg.DBDSN, log)
+	default:
+		err = fmt.Errorf("unknown db_driver %q, expected %q or %q", cfg.DBDriver, storage.DriverSQLite, storage.DriverPostgres)
+	}
 	if err != nil {
 		log.Error("failed to create data store", "error", err)
 		os.Exit(1)
 	}
 	defer dataStore.Close()
+
+	var secretsKey []byte
+	if cfg.SecretsKey != "" {
+		if secretsKey, err = storage.ParseSecretsKey(cfg.SecretsKey); err != nil {
+			log.Error("invalid secrets key", "error", err)
+			os.Exit(1)
+		}
+	}
+	if err := dataStore.UseSecretsKey(secretsKey); err != nil {
+		log.Error("failed to set up encryption of application credentials", "error", err)
+		os.Exit(1)
+	}
+	if secretsKey == nil {
+		log.Warn("application credentials are stored in plain text, set secrets_key or SECRETS_KEY to encrypt them")
+	}
 	log.Info("data store initialized")
 
 	i18nService, err := i18n.NewService("./locales", log)
@@ -57,8 +81,23 @@ func main() {
 	}
 	log.Info("i18n service initialized")
 
-	scriptingHTTPClient := scripting.NewHTTPClient(log)
-	scriptingService := scripting.NewService(log, scriptingHTTPClient, dataStore)
+	scriptingHTTPClient := scripting.NewHTTPClient(log, scripting.HTTPOptions{
+		Timeout: time.Duration(cfg.ScriptHTTP.TimeoutMs) * time.Millisecond,
+		Retries: cfg.ScriptHTTP.Retries,
+		Backoff: time.Duration(cfg.ScriptHTTP.BackoffMs) * time.Millisecond,
+	})
+	if err := scriptingHTTPClient.RestrictHosts(cfg.ScriptHTTP.AllowedHosts, cfg.ScriptHTTP.DeniedHosts); err != nil {
+		log.Error("invalid script HTTP hosts", "error", err)
+		os.Exit(1)
+	}
+	scriptingService := scripting.NewService(log, scriptingHTTPClient, dataStore, scripting.Limits{
+		Timeout:      time.Duration(cfg.ScriptTimeoutMs) * time.Millisecond,
+		MaxMemory:    uint64(cfg.ScriptMaxMemoryMB) << 20,
+		MaxCallDepth: cfg.ScriptMaxCallDepth,
+	}, cfg.ScriptEnvAllowlist)
+	if err := scriptingService.ApplyLimitSettings(); err != nil {
+		log.Error("failed to apply script limit settings, using the limits of the configuration file", "error", err)
+	}
 
 	rmq, err := rabbitmq.New(&cfg.RabbitMQ, log, dataStore, scriptingService)
 	if err != nil {
@@ -69,52 +108,34 @@ func main() {
 
 	collectorService := collector.NewService(dataStore, scriptingService, rmq, log)
 
-	log.Info("initializing workers for existing channels...")
-	apps, err := dataStore.GetAllApplications()
-	if err != nil {
-		log.Error("failed to get applications for worker init", "error", err)
-	} else {
-		for _, app := range apps {
-			channels, err := dataStore.GetChannelsByAppID(app.ID)
-			if err != nil {
-				log.Error("failed to get channels for worker init", "app_id", app.ID, "error", err)
-				continue
-			}
-			for _, ch := range channels {
-				log.Info("setting up topology and starting worker on boot", "channel_name", ch.Name, "destination", ch.Destination, "direction", ch.Direction)
-				if err := rmq.SetupDurableTopology(ch.Destination); err != nil {
-					log.Error("failed to setup durable topology on boot", "channel_name", ch.Name, "error", err)
-					continue
-				}
-
-				if ch.Direction == "inbound" {
-					rmq.StartInboundForwarder(ch.Destination)
-				} else if ch.Direction == "outbound" {
-					rmq.StartOutboundCollector(ch.Destination)
-				} else {
-					log.Warn("unknown channel direction, no worker started", "channel_name", ch.Name, "direction", ch.Direction)
-				}
-			}
-		}
-	}
+	bootStart := time.Now()
+	log.Info("initializing workers for existing channels...", "concurrency", cfg.BootConcurrency)
+	initChannelWorkers(dataStore, rmq, log, cfg.BootConcurrency)
 	log.Info("worker initialization complete")
 
-	log.Info("initializing routers for existing routes...")
-	routes, err := dataStore.GetAllRoutes()
-	if err != nil {
-		log.Error("failed to get routes for router init", "error", err)
+	if cfg.ExecutionHistorySize > 0 {
+		rmq.EnableExecutionHistory(cfg.ExecutionHistorySize, cfg.ExecutionPayloadBytes)
+	}
+	if hooks, err := dataStore.GetTransformationHooks(); err != nil {
+		log.Error("failed to get transformation hooks", "error", err)
 	} else {
-		for _, route := range routes {
-			log.Info("starting router worker", "route_id", route.ID, "source_id", route.SourceChannelID, "route_type", route.RouteType, "route_name", route.Name)
-			if route.SourceChannelID != "" {
-				rmq.StartRouter(route.ID, route.Name, route.SourceChannelID)
-			} else {
-				log.Error("route missing source channel ID, skipping router start", "route_id", route.ID)
-			}
-		}
+		rmq.SetTransformationHooks(hooks)
 	}
+
+	log.Info("initializing routers for existing routes...")
+	initRouters(dataStore, rmq, log, cfg.BootConcurrency)
 	log.Info("router initialization complete")
 
+	bootDuration := time.Since(bootStart)
+	metrics.BootDuration.Set(bootDuration.Seconds())
+	log.Info("boot initialization finished", "duration", bootDuration.String())
+
+	rmq.StartSilenceMonitor()
+	rmq.StartRouteStatsFlusher()
+	if cfg.TopologyRepairMinutes > 0 {
+		rmq.StartTopologyRepair(time.Duration(cfg.TopologyRepairMinutes) * time.Minute)
+	}
+
 	log.Info("initializing collectors...")
 	c := cron.New()
 	collectors, err := dataStore.GetAllCollectors()
@@ -132,12 +153,25 @@ func main() {
 			}
 		}
 	}
+	if cfg.HousekeepingSchedule != "" {
+		scheduleHousekeeping(c, cfg, dataStore, log)
+	}
 	c.Start()
 	log.Info("collectors scheduled", "count", len(collectors))
 
 	mux := http.NewServeMux()
 	adminHandler := admin.NewHandler(dataStore, rmq, log, scriptingService, version, i18nService) // Pass i18nService
 	apiHandler := api.NewHandler(dataStore, rmq, log, scriptingService, i18nService)               // Pass i18nService
+	if err := adminHandler.SetRoles(cfg.AdminAccess.Roles, cfg.AdminAccess.DefaultRole, cfg.AdminAccess.UserHeader, cfg.AdminAccess.TrustedProxies); err != nil {
+		log.Error("invalid admin access configuration", "error", err)
+		os.Exit(1)
+	}
+	if cfg.ConfigDir != "" {
+		adminHandler.StartConfigDirWatcher(cfg.ConfigDir, time.Duration(cfg.ConfigDirPollSeconds)*time.Second)
+	}
+	if cfg.HousekeepingSchedule != "" {
+		adminHandler.SetTrashRetention(time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour)
+	}
 
 	metrics.Register()
 
@@ -146,6 +180,10 @@ func main() {
 	mux.Handle("/auth/oidc/token", apiHandler)
 	mux.Handle("/applications/", apiHandler)
 	mux.Handle("/metrics", promhttp.Handler())
+	if cfg.StatusPage.Enabled && cfg.StatusPage.Path != "" {
+		log.Info("public status page enabled", "path", cfg.StatusPage.Path)
+		mux.HandleFunc(cfg.StatusPage.Path, adminHandler.ServeStatusPage)
+	}
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
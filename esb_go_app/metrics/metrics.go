@@ -29,6 +29,77 @@ var (
 		},
 		[]string{"worker_type"},
 	)
+
+	ChannelLastMessage = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "esb_go_channel_last_message_timestamp_seconds",
+			Help: "Unix time of the last message seen by the worker of a channel.",
+		},
+		[]string{"connection", "destination"},
+	)
+
+	ChannelSilent = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "esb_go_channel_silent",
+			Help: "1 when a channel with a silence alert has not seen a message for longer than its threshold.",
+		},
+		[]string{"channel_id", "channel"},
+	)
+
+	CircuitBreakerOpen = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "esb_go_circuit_breaker_open",
+			Help: "1 while the circuit breaker of a destination channel is open and its routes are paused.",
+		},
+		[]string{"destination_channel_id"},
+	)
+
+	ReturnedMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "esb_go_returned_messages_total",
+			Help: "Mandatory messages returned by the broker because no queue was bound to the exchange.",
+		},
+		[]string{"connection", "exchange"},
+	)
+
+	ConsumerRecoveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "esb_go_consumer_recoveries_total",
+			Help: "Consumers re-established after the broker closed their channel or cancelled them.",
+		},
+		[]string{"connection", "queue"},
+	)
+
+	TopologyRepairs = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "esb_go_topology_repairs_total",
+			Help: "Durable exchanges, queues and bindings recreated by the topology drift auto-repair job.",
+		},
+		[]string{"connection", "kind"},
+	)
+
+	RequestReplies = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "esb_go_request_replies_total",
+			Help: "Replies to requests of request-reply routes, by outcome: delivered, timeout or unmatched.",
+		},
+		[]string{"route_id", "outcome"},
+	)
+
+	ScriptHTTPCache = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "esb_go_script_http_cache_total",
+			Help: "Script GET requests with cache_ttl_ms, by result: hit (answered from the cache) or miss.",
+		},
+		[]string{"result"},
+	)
+
+	BootDuration = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "esb_go_boot_duration_seconds",
+			Help: "Time spent setting up topology and starting workers at startup.",
+		},
+	)
 )
 
 func Register() {
@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// The alternate exchange of every durable exchange and the catch-all queue bound to it. Messages
+// published to a durable exchange without a bound queue end up here instead of being dropped.
+const (
+	UnroutableExchange = "esb_unroutable_exchange"
+	UnroutableQueue    = "esb_unroutable_queue"
+)
+
+// durableExchangeArgs are the arguments of every durable exchange declared by the ESB.
+func durableExchangeArgs() amqp091.Table {
+	return amqp091.Table{"alternate-exchange": UnroutableExchange}
+}
+
+// declareDurableExchange declares a durable fanout exchange with the unroutable capture as its alternate
+// exchange. Declaring it on its own channel keeps a failed declaration from closing the caller's channel:
+// exchanges created before the capture existed cannot be redeclared with the new argument, so they are
+// left as they are with a warning until they are recreated.
+func (r *RabbitMQ) declareDurableExchange(connName, exchangeName string) error {
+	if err := r.ensureUnroutableCapture(connName); err != nil {
+		return err
+	}
+
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return fmt.Errorf("could not open channel: %w", err)
+	}
+	err = ch.ExchangeDeclare(exchangeName, "fanout", true, false, false, false, durableExchangeArgs())
+	ch.Close()
+	if err == nil {
+		return nil
+	}
+	if !isPreconditionFailed(err) {
+		return err
+	}
+
+	if err := r.checkExchangeExists(connName, exchangeName); err != nil {
+		return err
+	}
+	r.logger.Warn("exchange exists without the unroutable alternate exchange, unroutable messages are dropped until it is recreated",
+		"connection", connName, "exchange", exchangeName)
+	return nil
+}
+
+// ensureUnroutableCapture declares the alternate exchange and the catch-all queue on a connection.
+func (r *RabbitMQ) ensureUnroutableCapture(connName string) error {
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := ch.ExchangeDeclare(UnroutableExchange, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare unroutable exchange: %w", err)
+	}
+	if _, err := ch.QueueDeclare(UnroutableQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare unroutable queue: %w", err)
+	}
+	if err := ch.QueueBind(UnroutableQueue, "", UnroutableExchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind unroutable queue: %w", err)
+	}
+	return nil
+}
+
+// BrowseUnroutable returns up to limit captured unroutable messages of a connection without removing
+// them, together with their total number. The exchange they were published to is kept as the original exchange.
+func (r *RabbitMQ) BrowseUnroutable(connName string, limit int) ([]ParkedMessage, int, error) {
+	return r.BrowseParkingLot(connName, UnroutableQueue, limit)
+}
+
+// isPreconditionFailed reports whether err is the broker's 406 reply, e.g. to a redeclaration with other arguments.
+func isPreconditionFailed(err error) bool {
+	var amqpErr *amqp091.Error
+	return errors.As(err, &amqpErr) && amqpErr.Code == amqp091.PreconditionFailed
+}
@@ -0,0 +1,211 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// batchFlushInterval is how long a partial batch waits for more messages before it is processed.
+const batchFlushInterval = 200 * time.Millisecond
+
+// MaxBatchSize bounds the per-route batch size, which is also used as the consumer prefetch.
+const MaxBatchSize = 1000
+
+// routeBatch caches what the deliveries of one batch share: the destination channel, script destination,
+// routing rule and transformation lookups and one publishing channel per broker connection. A nil *routeBatch falls back to uncached calls.
+type routeBatch struct {
+	destChannels    map[string]*storage.Channel
+	scriptChannels  map[string]*storage.Channel // Destinations returned by scripts, keyed by name or ID
+	rules           map[string][]storage.RoutingRule
+	transformations map[string]*storage.Transformation
+	publishChannels map[string]*amqp091.Channel
+}
+
+func newRouteBatch() *routeBatch {
+	return &routeBatch{
+		destChannels:    make(map[string]*storage.Channel),
+		scriptChannels:  make(map[string]*storage.Channel),
+		rules:           make(map[string][]storage.RoutingRule),
+		transformations: make(map[string]*storage.Transformation),
+		publishChannels: make(map[string]*amqp091.Channel),
+	}
+}
+
+// destinationChannel returns the channel with the given ID, loading it from the store once per batch.
+func (b *routeBatch) destinationChannel(r *RabbitMQ, id string) (*storage.Channel, error) {
+	if b == nil {
+		return r.dataStore.GetChannelByID(id)
+	}
+	if ch, ok := b.destChannels[id]; ok {
+		return ch, nil
+	}
+	ch, err := r.dataStore.GetChannelByID(id)
+	if err != nil || ch == nil {
+		return ch, err
+	}
+	b.destChannels[id] = ch
+	return ch, nil
+}
+
+// scriptDestination resolves the destination channel name or ID returned by a transformation script,
+// loading it from the store once per batch. Unknown and ambiguous names are errors.
+func (b *routeBatch) scriptDestination(r *RabbitMQ, identifier string) (*storage.Channel, error) {
+	if b != nil {
+		if ch, ok := b.scriptChannels[identifier]; ok {
+			return ch, nil
+		}
+	}
+	ch, err := r.dataStore.FindChannel(identifier)
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, fmt.Errorf("destination channel '%s' not found", identifier)
+	}
+	if b != nil {
+		b.scriptChannels[identifier] = ch
+	}
+	return ch, nil
+}
+
+// routingRules returns the routing rules of a route, loading them from the store once per batch.
+func (b *routeBatch) routingRules(r *RabbitMQ, routeID string) ([]storage.RoutingRule, error) {
+	if b == nil {
+		return r.dataStore.GetRoutingRules(routeID)
+	}
+	if rules, ok := b.rules[routeID]; ok {
+		return rules, nil
+	}
+	rules, err := r.dataStore.GetRoutingRules(routeID)
+	if err != nil {
+		return nil, err
+	}
+	b.rules[routeID] = rules
+	return rules, nil
+}
+
+// transformation returns the transformation with the given ID, loading it from the store once per batch.
+func (b *routeBatch) transformation(r *RabbitMQ, id string) (*storage.Transformation, error) {
+	if b == nil {
+		return r.dataStore.GetTransformationByID(id)
+	}
+	if t, ok := b.transformations[id]; ok {
+		return t, nil
+	}
+	t, err := r.dataStore.GetTransformationByID(id)
+	if err != nil || t == nil {
+		return t, err
+	}
+	b.transformations[id] = t
+	return t, nil
+}
+
+// publish republishes a message as persistent on a channel that stays open for the rest of the batch.
+func (b *routeBatch) publish(r *RabbitMQ, connName string, msg *amqp091.Delivery, exchangeName string) error {
+	ch, ok := b.publishChannels[connName]
+	if !ok {
+		var err error
+		ch, err = r.openPublishChannel(connName)
+		if err != nil {
+			return err
+		}
+		r.watchReturns(connName, ch)
+		b.publishChannels[connName] = ch
+	}
+	if err := publishDurable(ch, msg, exchangeName); err != nil {
+		// A failed publish usually closes the channel, so the next message opens a fresh one.
+		_ = ch.Close()
+		delete(b.publishChannels, connName)
+		return err
+	}
+	return nil
+}
+
+// close closes the publishing channels opened for the batch.
+func (b *routeBatch) close() {
+	for connName, ch := range b.publishChannels {
+		_ = ch.Close()
+		delete(b.publishChannels, connName)
+	}
+}
+
+// routeBatchLoop collects up to batchSize deliveries, or whatever arrived within batchFlushInterval,
+// and routes them together once the rate limiter has granted a token for each of them.
+func (r *RabbitMQ) routeBatchLoop(ctx context.Context, routeID, sourceConn, sourceQueue string, msgs <-chan amqp091.Delivery, batchSize int, limiter *tokenBucket) error {
+	for {
+		var deliveries []amqp091.Delivery
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("consumer channel for '%s' closed", sourceQueue)
+			}
+			deliveries = append(deliveries, d)
+		}
+
+		timer := time.NewTimer(batchFlushInterval)
+	collect:
+		for len(deliveries) < batchSize {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				// Unacknowledged deliveries return to the queue when the channel closes.
+				return ctx.Err()
+			case d, ok := <-msgs:
+				if !ok {
+					timer.Stop()
+					return fmt.Errorf("consumer channel for '%s' closed", sourceQueue)
+				}
+				deliveries = append(deliveries, d)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		for range deliveries {
+			if err := limiter.wait(ctx); err != nil {
+				return err
+			}
+		}
+		r.routeDeliveries(ctx, routeID, sourceConn, sourceQueue, deliveries)
+	}
+}
+
+// routeDeliveries routes one batch with a single route lookup and acknowledges every successfully
+// routed delivery with one multiple-ack. Failed deliveries are settled individually beforehand,
+// so the multiple-ack only covers the ones that are still outstanding.
+func (r *RabbitMQ) routeDeliveries(ctx context.Context, routeID, sourceConn, sourceQueue string, deliveries []amqp091.Delivery) {
+	last := &deliveries[len(deliveries)-1]
+	route, err := r.loadRoute(routeID)
+	if err != nil {
+		r.logger.Error("failed to get route details after retries, requeueing batch", "route_id", routeID, "batch_size", len(deliveries), "error", err)
+		_ = last.Nack(true, true)
+		return
+	}
+
+	batch := newRouteBatch()
+	defer batch.close()
+
+	var lastRouted *amqp091.Delivery
+	routed := 0
+	for i := range deliveries {
+		if r.routeDelivery(ctx, route, &deliveries[i], sourceConn, sourceQueue, batch) {
+			lastRouted = &deliveries[i]
+			routed++
+		}
+	}
+	if lastRouted != nil {
+		if err := lastRouted.Ack(true); err != nil {
+			r.logger.Error("failed to acknowledge batch", "route_id", routeID, "error", err)
+			return
+		}
+	}
+	r.logger.Debug("batch routed", "route_id", routeID, "batch_size", len(deliveries), "acknowledged", routed)
+}
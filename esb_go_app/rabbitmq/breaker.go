@@ -0,0 +1,105 @@
+package rabbitmq
+
+import (
+	"context"
+	"time"
+
+	"esb-go-app/metrics"
+)
+
+const (
+	breakerFailureThreshold = 5                // Consecutive publish failures that trip the breaker
+	breakerProbeInterval    = 30 * time.Second // Pause between probe messages while the breaker is open
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerStatus is a snapshot of the circuit breaker of a destination channel.
+type BreakerStatus struct {
+	State     string
+	Failures  int       // Consecutive publish failures
+	OpenedAt  time.Time // When the breaker last opened or let a probe through
+	LastError string
+}
+
+// DestinationBreaker returns the breaker of a destination channel; ok is false while it is closed.
+func (r *RabbitMQ) DestinationBreaker(destChannelID string) (BreakerStatus, bool) {
+	r.stoppersMu.Lock()
+	defer r.stoppersMu.Unlock()
+	b, ok := r.breakers[destChannelID]
+	if !ok || b.State == BreakerClosed {
+		return BreakerStatus{}, false
+	}
+	return *b, true
+}
+
+// awaitBreaker blocks while the breaker of a destination channel is open, which pauses every route
+// publishing to it. Once the probe interval has passed a single caller is let through as the probe
+// and the breaker becomes half-open; the other callers keep waiting for the outcome of that probe.
+func (r *RabbitMQ) awaitBreaker(ctx context.Context, destChannelID string) error {
+	for {
+		r.stoppersMu.Lock()
+		b, ok := r.breakers[destChannelID]
+		if !ok || b.State == BreakerClosed {
+			r.stoppersMu.Unlock()
+			return nil
+		}
+		wait := breakerProbeInterval - time.Since(b.OpenedAt)
+		if wait <= 0 {
+			// Restarting the interval also covers a probe whose router stopped before reporting back.
+			b.State = BreakerHalfOpen
+			b.OpenedAt = time.Now()
+			r.stoppersMu.Unlock()
+			r.logger.Info("circuit breaker half-open, sending probe message", "destination_channel_id", destChannelID)
+			return nil
+		}
+		r.stoppersMu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// recordPublishResult updates the breaker of a destination channel after a publish attempt.
+func (r *RabbitMQ) recordPublishResult(destChannelID string, err error) {
+	r.stoppersMu.Lock()
+	defer r.stoppersMu.Unlock()
+
+	b, ok := r.breakers[destChannelID]
+	if err == nil {
+		if ok {
+			delete(r.breakers, destChannelID)
+			if b.State != BreakerClosed {
+				r.logger.Info("circuit breaker closed, destination recovered", "destination_channel_id", destChannelID)
+				metrics.CircuitBreakerOpen.WithLabelValues(destChannelID).Set(0)
+			}
+		}
+		return
+	}
+
+	if !ok {
+		b = &BreakerStatus{State: BreakerClosed}
+		r.breakers[destChannelID] = b
+	}
+	b.Failures++
+	b.LastError = err.Error()
+	switch {
+	case b.State == BreakerHalfOpen:
+		b.State = BreakerOpen
+		b.OpenedAt = time.Now()
+		r.logger.Warn("circuit breaker probe failed, staying open", "destination_channel_id", destChannelID, "failures", b.Failures, "error", err)
+	case b.State == BreakerClosed && b.Failures >= breakerFailureThreshold:
+		b.State = BreakerOpen
+		b.OpenedAt = time.Now()
+		r.logger.Error("circuit breaker tripped, pausing routes to destination", "destination_channel_id", destChannelID, "failures", b.Failures, "probe_interval", breakerProbeInterval.String(), "error", err)
+		metrics.CircuitBreakerOpen.WithLabelValues(destChannelID).Set(1)
+	}
+}
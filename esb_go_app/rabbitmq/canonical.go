@@ -0,0 +1,122 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// canonicalizeJSON re-encodes a JSON document with sorted object keys, no insignificant whitespace
+// and normalized numbers, so consumers comparing payload text byte-for-byte see a stable form.
+func canonicalizeJSON(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("body is not valid JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("body contains more than one JSON value")
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonical writes a decoded JSON value in canonical form.
+func writeCanonical(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalString(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		return writeCanonicalString(buf, v)
+	case json.Number:
+		number, err := normalizeNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(number)
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("unsupported JSON value of type %T", value)
+	}
+	return nil
+}
+
+// writeCanonicalString writes a JSON string without HTML escaping.
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimRight(encoded.Bytes(), "\n"))
+	return nil
+}
+
+// normalizeNumber formats a number the same way regardless of how it was written (1.0, 1e0 and 1 all become 1).
+func normalizeNumber(n json.Number) (string, error) {
+	// Integer literals are kept digit for digit so large identifiers do not lose precision.
+	if !strings.ContainsAny(n.String(), ".eE") {
+		if n.String() == "-0" {
+			return "0", nil
+		}
+		return n.String(), nil
+	}
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid number '%s': %w", n, err)
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("number '%s' is out of range", n)
+	}
+	if f == 0 {
+		return "0", nil // Also folds -0
+	}
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return strconv.FormatFloat(f, 'e', -1, 64), nil
+}
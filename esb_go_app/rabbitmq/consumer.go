@@ -6,8 +6,8 @@ import (
 	"github.com/rabbitmq/amqp091-go"
 )
 // GetOneMessage retrieves a single message from a queue for testing purposes.
-func (r *RabbitMQ) GetOneMessage(queueName string) (body string, ok bool, err error) {
-	ch, err := r.conn.Channel()
+func (r *RabbitMQ) GetOneMessage(connName, queueName string) (body string, ok bool, err error) {
+	ch, err := r.openChannel(connName)
 	if err != nil {
 		return "", false, fmt.Errorf("could not open channel: %w", err)
 	}
@@ -31,3 +31,29 @@ func (r *RabbitMQ) GetOneMessage(queueName string) (body string, ok bool, err er
 
 	return string(msg.Body), true, nil
 }
+
+// PeekMessage reads the message at the head of a queue without removing it. The message is rejected
+// with requeue, which puts it back to its original position where possible; it is marked as redelivered.
+func (r *RabbitMQ) PeekMessage(connName, queueName string) (body string, ok bool, err error) {
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return "", false, fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close()
+
+	msg, ok, err := ch.Get(queueName, false)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get message from '%s': %w", queueName, err)
+	}
+	if !ok {
+		return "", false, nil
+	}
+
+	if err := msg.Nack(false, true); err != nil {
+		// Closing the channel returns the unacknowledged message to the queue as well.
+		r.logger.Warn("failed to requeue peeked message", "queue", queueName, "error", err)
+	}
+	r.logger.Info("peeked at message", "queue", queueName, "message_id", msg.MessageId)
+
+	return string(msg.Body), true, nil
+}
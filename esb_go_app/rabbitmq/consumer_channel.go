@@ -0,0 +1,183 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"esb-go-app/metrics"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Bounds of the backoff between attempts to re-establish a consumer.
+const (
+	minConsumerRecoveryDelay = time.Second
+	maxConsumerRecoveryDelay = 30 * time.Second
+)
+
+// consumerChannel is a worker's consumer that survives the loss of its AMQP channel. When the broker
+// closes the channel or cancels the consumer (e.g. the queue was deleted or the node went down), a new
+// channel is opened and the consumer is registered again with the same prefetch and consumer tag, so
+// the worker keeps reading from Deliveries without noticing. Deliveries received on a lost channel
+// cannot be acknowledged any more; the broker redelivers them on the new one.
+type consumerChannel struct {
+	r        *RabbitMQ
+	connName string
+	queue    string
+	tag      string
+	prefetch int                          // Qos prefetch count, 0 keeps the broker default
+	setup    func(*amqp091.Channel) error // Runs on every new channel before the consumer is registered
+
+	mu         sync.Mutex
+	ch         *amqp091.Channel
+	deliveries chan amqp091.Delivery
+}
+
+// consumption is one registration of a consumer on one AMQP channel.
+type consumption struct {
+	msgs      <-chan amqp091.Delivery
+	closed    chan *amqp091.Error
+	cancelled chan string
+}
+
+// newConsumerChannel registers a consumer on queue and keeps it registered until ctx is cancelled.
+// It fails when the first registration fails, leaving the initial retry policy to the caller.
+func (r *RabbitMQ) newConsumerChannel(ctx context.Context, connName, queue, tag string, prefetch int, setup func(*amqp091.Channel) error) (*consumerChannel, error) {
+	c := &consumerChannel{
+		r:          r,
+		connName:   connName,
+		queue:      queue,
+		tag:        tag,
+		prefetch:   prefetch,
+		setup:      setup,
+		deliveries: make(chan amqp091.Delivery),
+	}
+	s, err := c.consume(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go c.run(ctx, s)
+	return c, nil
+}
+
+// Deliveries returns the messages of all registrations. It is closed once ctx is cancelled.
+func (c *consumerChannel) Deliveries() <-chan amqp091.Delivery {
+	return c.deliveries
+}
+
+// Close closes the current AMQP channel; unacknowledged deliveries return to the queue.
+func (c *consumerChannel) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ch != nil {
+		c.ch.Close()
+		c.ch = nil
+	}
+}
+
+// consume opens a channel, applies the prefetch and the setup and registers the consumer.
+func (c *consumerChannel) consume(ctx context.Context) (*consumption, error) {
+	ch, err := c.r.openChannel(c.connName)
+	if err != nil {
+		return nil, fmt.Errorf("could not open channel: %w", err)
+	}
+	s := &consumption{
+		closed:    ch.NotifyClose(make(chan *amqp091.Error, 1)),
+		cancelled: ch.NotifyCancel(make(chan string, 1)),
+	}
+
+	if c.prefetch > 0 {
+		if err := ch.Qos(c.prefetch, 0, false); err != nil {
+			ch.Close()
+			return nil, fmt.Errorf("failed to set prefetch for '%s': %w", c.queue, err)
+		}
+	}
+	if c.setup != nil {
+		if err := c.setup(ch); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+	s.msgs, err = ch.ConsumeWithContext(ctx, c.queue, c.tag, false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to register a consumer for '%s': %w", c.queue, err)
+	}
+
+	c.mu.Lock()
+	c.ch = ch
+	c.mu.Unlock()
+	return s, nil
+}
+
+// run forwards deliveries and re-registers the consumer whenever its channel is lost.
+func (c *consumerChannel) run(ctx context.Context, s *consumption) {
+	defer close(c.deliveries)
+	for {
+		if !c.forward(ctx, s.msgs) {
+			return
+		}
+
+		select {
+		case amqpErr := <-s.closed:
+			c.r.logger.Warn("consumer channel closed, re-establishing consumer", "connection", c.connName, "queue", c.queue, "consumer_tag", c.tag, "error", amqpErr)
+		case tag := <-s.cancelled:
+			c.r.logger.Warn("consumer cancelled by the broker, re-establishing consumer", "connection", c.connName, "queue", c.queue, "consumer_tag", tag)
+		default:
+			c.r.logger.Warn("consumer stopped, re-establishing consumer", "connection", c.connName, "queue", c.queue, "consumer_tag", c.tag)
+		}
+		c.Close()
+
+		if s = c.reestablish(ctx); s == nil {
+			return
+		}
+	}
+}
+
+// forward passes deliveries on until msgs is closed, which it reports with true, or ctx is cancelled.
+func (c *consumerChannel) forward(ctx context.Context, msgs <-chan amqp091.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case d, ok := <-msgs:
+			if !ok {
+				return ctx.Err() == nil
+			}
+			select {
+			case c.deliveries <- d:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+}
+
+// reestablish registers the consumer again with an exponential backoff. It returns nil when ctx is cancelled.
+func (c *consumerChannel) reestablish(ctx context.Context) *consumption {
+	delay := minConsumerRecoveryDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+
+		s, err := c.consume(ctx)
+		if err == nil {
+			metrics.ConsumerRecoveries.WithLabelValues(c.connName, c.queue).Inc()
+			c.r.logger.Info("consumer re-established", "connection", c.connName, "queue", c.queue, "consumer_tag", c.tag, "attempts", attempt)
+			return s
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if delay *= 2; delay > maxConsumerRecoveryDelay {
+			delay = maxConsumerRecoveryDelay
+		}
+		c.r.logger.Error("failed to re-establish consumer, retrying", "connection", c.connName, "queue", c.queue, "consumer_tag", c.tag, "attempt", attempt, "retry_in", delay, "error", err)
+	}
+}
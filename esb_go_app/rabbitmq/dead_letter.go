@@ -0,0 +1,149 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// deadLetterHeader reports whether a header is added by the broker or the retry policy while a message
+// fails, so it is neither stored with a dead letter nor replayed.
+func deadLetterHeader(key string) bool {
+	switch key {
+	case retryCountHeader, lastErrorHeader, parkedIDHeader, parkedAtHeader, originalExchangeHeader, originalQueueHeader, "x-death":
+		return true
+	}
+	return false
+}
+
+// storeDeadLetter keeps a message that failed for good in the database when the route stores its dead
+// letters there. It returns false when the route does not, or when the message could not be stored, so
+// the caller leaves it to the broker.
+func (r *RabbitMQ) storeDeadLetter(route *storage.Route, d *amqp091.Delivery, sourceQueue string, cause error, attempts int) bool {
+	if route.DeadLetterStore != storage.DeadLetterDatabase && route.DeadLetterStore != storage.DeadLetterBoth {
+		return false
+	}
+	headers := amqp091.Table{}
+	for k, v := range d.Headers {
+		if !deadLetterHeader(k) {
+			headers[k] = v
+		}
+	}
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		r.logger.Error("failed to encode headers of dead letter, keeping it on the broker", "route_id", route.ID, "msgId", d.MessageId, "error", err)
+		return false
+	}
+	msg := &storage.DeadLetter{
+		RouteID:       route.ID,
+		RouteName:     route.Name,
+		MessageID:     d.MessageId,
+		TraceID:       TraceID(d.Headers),
+		Source:        sourceQueue,
+		Attempts:      attempts,
+		Headers:       string(encoded),
+		ContentType:   d.ContentType,
+		CorrelationID: d.CorrelationId,
+		Body:          string(d.Body),
+	}
+	if cause != nil {
+		msg.Reason = cause.Error()
+	}
+	if err := r.dataStore.StoreDeadLetter(msg); err != nil {
+		r.logger.Error("failed to store dead letter, keeping it on the broker", "route_id", route.ID, "msgId", d.MessageId, "error", err)
+		return false
+	}
+	r.logger.Error("message stored as dead letter", "route_id", route.ID, "msgId", d.MessageId, "dead_letter_id", msg.ID, "attempts", attempts, "error", cause)
+	return true
+}
+
+// rejectDelivery dead-letters a delivery that failed for good outside the retry policy. Routes keeping
+// their dead letters only in the database acknowledge it once stored; otherwise it is rejected to the
+// dead-letter exchange of the source queue, if it has one.
+func (r *RabbitMQ) rejectDelivery(route *storage.Route, d *amqp091.Delivery, sourceQueue string, cause error) {
+	if r.storeDeadLetter(route, d, sourceQueue, cause, retryCount(d.Headers)) && route.DeadLetterStore == storage.DeadLetterDatabase {
+		_ = d.Ack(false)
+		return
+	}
+	_ = d.Nack(false, false)
+}
+
+// ReplayDeadLetter publishes a dead letter to the queue its route consumes from, so the route processes it
+// again with a fresh retry count, and deletes it once the broker confirmed the message.
+func (r *RabbitMQ) ReplayDeadLetter(msg *storage.DeadLetter) error {
+	route, err := r.dataStore.GetRouteByID(msg.RouteID)
+	if err != nil {
+		return err
+	}
+	if route == nil {
+		return fmt.Errorf("route %s no longer exists", msg.RouteID)
+	}
+	connName, sourceQueue, err := r.RouteSourceQueue(route)
+	if err != nil {
+		return err
+	}
+
+	headers := amqp091.Table{}
+	if msg.Headers != "" {
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(msg.Headers), &decoded); err != nil {
+			return fmt.Errorf("failed to decode headers: %w", err)
+		}
+		for k, v := range decoded {
+			headers[k] = replayedHeaderValue(v)
+		}
+	}
+
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirm("", sourceQueue, false, false, amqp091.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		CorrelationId: msg.CorrelationID,
+		MessageId:     msg.MessageID,
+		DeliveryMode:  amqp091.Persistent,
+		Body:          []byte(msg.Body),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to '%s': %w", sourceQueue, err)
+	}
+	if !confirmation.Wait() {
+		return fmt.Errorf("broker rejected replayed message %d", msg.ID)
+	}
+
+	if err := r.dataStore.DeleteDeadLetter(msg.ID); err != nil {
+		return fmt.Errorf("message replayed but not removed from the dead letters: %w", err)
+	}
+	r.logger.Info("dead letter replayed", "route_id", route.ID, "dead_letter_id", msg.ID, "msgId", msg.MessageID, "queue", sourceQueue)
+	return nil
+}
+
+// replayedHeaderValue turns the JSON objects of a stored header into the tables AMQP accepts. Numbers
+// come back as floats and timestamps as strings.
+func replayedHeaderValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		table := amqp091.Table{}
+		for k, value := range v {
+			table[k] = replayedHeaderValue(value)
+		}
+		return table
+	case []interface{}:
+		for i := range v {
+			v[i] = replayedHeaderValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,100 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// deliveryRecord collects the outcome of one delivery while the router handles it, counted in the route
+// statistics, and for archiving routes what the message archive keeps about the delivery.
+type deliveryRecord struct {
+	routeID   string
+	outcome   storage.DeliveryOutcome
+	archived  *storage.ArchivedMessage // Nil unless the route archives its deliveries
+	discarded bool
+}
+
+// startDelivery starts the record of a delivery. For an archiving route it takes the message as
+// received, before any step of the route changes it.
+func (r *RabbitMQ) startDelivery(route *storage.Route, d *amqp091.Delivery, sourceQueue string) deliveryRecord {
+	if !route.Archive {
+		return deliveryRecord{routeID: route.ID}
+	}
+	headers := make(map[string]string, len(d.Headers))
+	for k, v := range d.Headers {
+		headers[k] = fmt.Sprint(v)
+	}
+	encoded, _ := json.Marshal(headers)
+	return deliveryRecord{routeID: route.ID, archived: &storage.ArchivedMessage{
+		RouteID:    route.ID,
+		RouteName:  route.Name,
+		MessageID:  d.MessageId,
+		TraceID:    TraceID(d.Headers),
+		Source:     sourceQueue,
+		Headers:    string(encoded),
+		Body:       string(d.Body),
+		ReceivedAt: time.Now(),
+	}}
+}
+
+func (rec *deliveryRecord) skipped() {
+	rec.outcome = storage.DeliverySkipped
+}
+
+func (rec *deliveryRecord) filtered() {
+	rec.outcome = storage.DeliveryFiltered
+}
+
+func (rec *deliveryRecord) failed(err error) {
+	rec.outcome = storage.DeliveryFailed
+	if err != nil && rec.archived != nil {
+		rec.archived.Error = err.Error()
+	}
+}
+
+func (rec *deliveryRecord) routed(destination string, published *amqp091.Delivery) {
+	rec.outcome = storage.DeliveryRouted
+	if rec.archived != nil {
+		rec.archived.Destination = destination
+		rec.archived.OutputBody = string(published.Body)
+		if rec.archived.TraceID == "" {
+			rec.archived.TraceID = TraceID(published.Headers)
+		}
+	}
+}
+
+// discard drops the record of a delivery that returns to the queue unprocessed because the router is
+// stopping; it is counted and archived when it is delivered again.
+func (rec *deliveryRecord) discard() {
+	rec.discarded = true
+}
+
+// finishDelivery counts the outcome of the delivery in the route statistics once the router is done
+// with it, and stores the record of archiving routes. Like tracing, archiving is best effort: a message
+// that cannot be archived is logged and never affects the message flow.
+func (r *RabbitMQ) finishDelivery(rec *deliveryRecord) {
+	if rec.discarded {
+		return
+	}
+	if rec.outcome == "" {
+		// Every return of routeDelivery sets the outcome; a missing one is a bug of the router, not a
+		// failed message.
+		r.logger.Error("router bug: delivery finished without an outcome, not counted", "route_id", rec.routeID)
+		return
+	}
+	processedAt := time.Now()
+	r.countDelivery(rec.routeID, rec.outcome, processedAt)
+	if rec.archived == nil {
+		return
+	}
+	rec.archived.Outcome = rec.outcome
+	rec.archived.ProcessedAt = processedAt
+	if err := r.dataStore.ArchiveMessage(rec.archived); err != nil {
+		r.logger.Warn("failed to archive message", "route_id", rec.routeID, "msgId", rec.archived.MessageID, "error", err)
+	}
+}
@@ -0,0 +1,95 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// EnrichMergeStrategies are the ways the response of an enrichment endpoint is merged into the message body.
+var EnrichMergeStrategies = []string{"shallow", "deep", "field"}
+
+// maxEnrichResponseSize bounds the response body read from an enrichment endpoint.
+const maxEnrichResponseSize = 10 << 20
+
+// enrichClient calls the enrichment endpoints of enrich routes.
+var enrichClient = &http.Client{Timeout: 10 * time.Second}
+
+// errPermanentEnrich marks enrichment failures that a retry cannot fix, e.g. a 4xx reply or a non-JSON body.
+var errPermanentEnrich = errors.New("permanent enrichment failure")
+
+// enrichBody POSTs the message body to the route's enrichment endpoint and merges the JSON object it
+// returns into the body according to the route's merge strategy. The message ID and the correlation ID
+// are passed along as X-Message-Id and X-Correlation-Id headers.
+func enrichBody(route *storage.Route, d *amqp091.Delivery) ([]byte, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(d.Body, &body); err != nil {
+		return nil, fmt.Errorf("%w: message body is not a JSON object: %v", errPermanentEnrich, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, route.EnrichURL, bytes.NewReader(d.Body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPermanentEnrich, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.MessageId != "" {
+		req.Header.Set("X-Message-Id", d.MessageId)
+	}
+	if d.CorrelationId != "" {
+		req.Header.Set("X-Correlation-Id", d.CorrelationId)
+	}
+
+	resp, err := enrichClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("enrichment request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxEnrichResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrichment response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("enrichment endpoint returned %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %v", errPermanentEnrich, err)
+		}
+		return nil, err
+	}
+
+	var enrichment map[string]interface{}
+	if err := json.Unmarshal(respBody, &enrichment); err != nil {
+		return nil, fmt.Errorf("%w: enrichment response is not a JSON object: %v", errPermanentEnrich, err)
+	}
+
+	switch route.EnrichMerge {
+	case "deep":
+		deepMerge(body, enrichment)
+	case "field":
+		body[route.EnrichField] = enrichment
+	default:
+		for k, v := range enrichment {
+			body[k] = v
+		}
+	}
+	return json.Marshal(body)
+}
+
+// deepMerge copies src into dst, merging nested objects key by key instead of replacing them.
+func deepMerge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, ok := v.(map[string]interface{})
+		if dstMap, isMap := dst[k].(map[string]interface{}); ok && isMap {
+			deepMerge(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
@@ -0,0 +1,81 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"time"
+	"unicode/utf8"
+
+	"esb-go-app/scripting"
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// executionHistory holds how the runs of transformation scripts are recorded.
+type executionHistory struct {
+	keep         int // Runs kept per transformation
+	payloadBytes int // Bytes of the input and output bodies stored with each run, 0 for none
+}
+
+// EnableExecutionHistory makes the routers record the latest keep runs of every transformation script,
+// with up to payloadBytes of their input and output bodies. It must be called before the routers start.
+func (r *RabbitMQ) EnableExecutionHistory(keep, payloadBytes int) {
+	r.executionHistory = executionHistory{keep: keep, payloadBytes: payloadBytes}
+	r.logger.Info("script execution history enabled", "keep", keep, "payload_bytes", payloadBytes)
+}
+
+// executionInput returns the input body to store with a run, taken before the script runs because
+// scripts may modify the message they are given.
+func (r *RabbitMQ) executionInput(body map[string]interface{}) string {
+	if r.executionHistory.keep == 0 || r.executionHistory.payloadBytes == 0 {
+		return ""
+	}
+	return r.executionPayload(body)
+}
+
+// recordExecution stores a run of a transformation script in its history. Like tracing, the history is
+// best effort: a run that cannot be stored is logged and never affects the message flow.
+func (r *RabbitMQ) recordExecution(route *storage.Route, transform *storage.Transformation, d *amqp091.Delivery, started time.Time, input string, result *scripting.TransformedMessage, err error) {
+	if r.executionHistory.keep == 0 {
+		return
+	}
+	exec := &storage.ScriptExecution{
+		TransformationID: transform.ID,
+		RouteID:          route.ID,
+		RouteName:        route.Name,
+		MessageID:        d.MessageId,
+		Duration:         time.Since(started),
+		Success:          err == nil,
+		Input:            input,
+		ExecutedAt:       started,
+	}
+	if err != nil {
+		exec.Error = err.Error()
+	} else if r.executionHistory.payloadBytes > 0 {
+		var body interface{}
+		if result != nil && result.Body != nil {
+			body = result.Body
+		}
+		exec.Output = r.executionPayload(body)
+	}
+	if err := r.dataStore.RecordScriptExecution(exec, r.executionHistory.keep); err != nil {
+		r.logger.Warn("failed to record script execution", "transformation_id", transform.ID, "route_id", route.ID, "error", err)
+	}
+}
+
+// executionPayload encodes a body as JSON and truncates it to the configured size.
+func (r *RabbitMQ) executionPayload(body interface{}) string {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return ""
+	}
+	limit := r.executionHistory.payloadBytes
+	if len(data) <= limit {
+		return string(data)
+	}
+	// Cut on a rune boundary so the stored text stays valid UTF-8.
+	for limit > 0 && !utf8.RuneStart(data[limit]) {
+		limit--
+	}
+	return string(data[:limit]) + "…"
+}
@@ -0,0 +1,62 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// guardRegexCache keeps compiled guard patterns so they are not recompiled for every message.
+var guardRegexCache sync.Map // map[string]*regexp.Regexp
+
+// matchGuardConditions reports whether the message headers satisfy every guard condition of a route.
+// A route without conditions always matches.
+func matchGuardConditions(conditions []storage.GuardCondition, headers amqp091.Table) (bool, error) {
+	for _, cond := range conditions {
+		raw, ok := headers[cond.Header]
+		if !ok {
+			return false, nil
+		}
+		value := fmt.Sprint(raw)
+
+		switch cond.Operator {
+		case "equals":
+			if value != cond.Value {
+				return false, nil
+			}
+		case "contains":
+			if !strings.Contains(value, cond.Value) {
+				return false, nil
+			}
+		case "regex":
+			re, err := compileGuardRegex(cond.Value)
+			if err != nil {
+				return false, err
+			}
+			if !re.MatchString(value) {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("unsupported guard operator '%s'", cond.Operator)
+		}
+	}
+	return true, nil
+}
+
+// compileGuardRegex returns a cached compiled pattern.
+func compileGuardRegex(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := guardRegexCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid guard regex '%s': %w", pattern, err)
+	}
+	guardRegexCache.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,34 @@
+package rabbitmq
+
+import (
+	"esb-go-app/storage"
+)
+
+// SetTransformationHooks sets the transformations run before and after the transformations of every
+// transform route. It is called at startup and whenever the hooks are changed in the admin settings;
+// deliveries already being routed finish with the hooks they started with.
+func (r *RabbitMQ) SetTransformationHooks(hooks storage.TransformationHooks) {
+	r.hooksMu.Lock()
+	r.hooks = hooks
+	r.hooksMu.Unlock()
+	r.logger.Info("transformation hooks set", "pre_transformation_id", hooks.PreID, "post_transformation_id", hooks.PostID)
+}
+
+// transformationSteps returns the transformations a transform route runs in order: the pre hook, the
+// route transformation, its pipeline and the post hook.
+func (r *RabbitMQ) transformationSteps(route *storage.Route) []string {
+	r.hooksMu.RLock()
+	hooks := r.hooks
+	r.hooksMu.RUnlock()
+
+	steps := make([]string, 0, len(route.Pipeline)+3)
+	if hooks.PreID != "" {
+		steps = append(steps, hooks.PreID)
+	}
+	steps = append(steps, *route.TransformationID)
+	steps = append(steps, route.Pipeline...)
+	if hooks.PostID != "" {
+		steps = append(steps, hooks.PostID)
+	}
+	return steps
+}
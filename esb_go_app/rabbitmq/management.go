@@ -8,35 +8,75 @@ import (
 
 // QueueInfo represents information about a queue from the RabbitMQ Management API.
 type QueueInfo struct {
+	Name      string `json:"name"`
+	Vhost     string `json:"vhost"`
+	Durable   bool   `json:"durable"`
+	Messages  int    `json:"messages"`                // Ready and unacknowledged messages
+	Unacked   int    `json:"messages_unacknowledged"` // Messages delivered to consumers and not acknowledged yet
+	Consumers int    `json:"consumers"`
+}
+
+// ManagementURL returns the base URL of the RabbitMQ Management API of the given connection.
+func (r *RabbitMQ) ManagementURL(connName string) string {
+	b, err := r.broker(connName)
+	if err != nil {
+		return ""
+	}
+	return b.cfg.ManagementDSN
+}
+
+// ExchangeInfo represents information about an exchange from the RabbitMQ Management API.
+type ExchangeInfo struct {
 	Name    string `json:"name"`
 	Vhost   string `json:"vhost"`
+	Type    string `json:"type"`
 	Durable bool   `json:"durable"`
 }
 
-// ListQueues retrieves a list of all queues from the RabbitMQ Management API.
-func (r *RabbitMQ) ListQueues() ([]QueueInfo, error) {
-	url := fmt.Sprintf("%s/api/queues", r.cfg.ManagementDSN)
+// ListQueues retrieves a list of all queues from the RabbitMQ Management API of the given connection.
+func (r *RabbitMQ) ListQueues(connName string) ([]QueueInfo, error) {
+	var queues []QueueInfo
+	if err := r.managementGet(connName, "/api/queues", &queues); err != nil {
+		return nil, fmt.Errorf("could not get queue list: %w", err)
+	}
+	return queues, nil
+}
+
+// ListExchanges retrieves a list of all exchanges from the RabbitMQ Management API of the given connection.
+func (r *RabbitMQ) ListExchanges(connName string) ([]ExchangeInfo, error) {
+	var exchanges []ExchangeInfo
+	if err := r.managementGet(connName, "/api/exchanges", &exchanges); err != nil {
+		return nil, fmt.Errorf("could not get exchange list: %w", err)
+	}
+	return exchanges, nil
+}
+
+// managementGet performs a GET request against the Management API of the given connection and decodes the JSON response into out.
+func (r *RabbitMQ) managementGet(connName, path string, out interface{}) error {
+	b, err := r.broker(connName)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s%s", b.cfg.ManagementDSN, path)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not create request: %w", err)
+		return fmt.Errorf("could not create request: %w", err)
 	}
-	req.SetBasicAuth(r.cfg.ManagementUser, r.cfg.ManagementPass)
+	req.SetBasicAuth(b.cfg.ManagementUser, b.cfg.ManagementPass)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("could not perform request to management API: %w", err)
+		return fmt.Errorf("could not perform request to management API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("rabbitmq management API returned non-200 status: %s", resp.Status)
+		return fmt.Errorf("rabbitmq management API returned non-200 status: %s", resp.Status)
 	}
 
-	var queues []QueueInfo
-	if err := json.NewDecoder(resp.Body).Decode(&queues); err != nil {
-		return nil, fmt.Errorf("could not decode queue list from management API: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode response from management API: %w", err)
 	}
-
-	return queues, nil
+	return nil
 }
@@ -0,0 +1,103 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WorkerKinds are the kinds of workers counted by WorkerSummary, named by the prefix of their registry key.
+// The other registered workers are the background jobs of the service.
+var WorkerKinds = []string{"inbound", "outbound", "router", "reply-listener", "shovel"}
+
+// WorkerKindJob counts the registered workers of no other kind, like the silence monitor.
+const WorkerKindJob = "job"
+
+// WorkerSummary is a snapshot of the worker registry.
+type WorkerSummary struct {
+	Running        map[string]int // Registered workers by kind, see WorkerKinds and WorkerKindJob
+	OpenBreakers   int            // Destination channels whose circuit breaker is open or half-open
+	SilentChannels int            // Channels with a silence alert that have gone quiet
+}
+
+// WorkerSummary counts the registered workers by kind, with the circuit breakers and silence alerts that
+// are raised.
+func (r *RabbitMQ) WorkerSummary() WorkerSummary {
+	summary := WorkerSummary{Running: make(map[string]int)}
+	r.stoppersMu.Lock()
+	for key := range r.workers {
+		summary.Running[workerKind(key)]++
+	}
+	for _, b := range r.breakers {
+		if b.State != BreakerClosed {
+			summary.OpenBreakers++
+		}
+	}
+	r.stoppersMu.Unlock()
+
+	r.activityMu.Lock()
+	summary.SilentChannels = len(r.silentChannels)
+	r.activityMu.Unlock()
+	return summary
+}
+
+// workerKind returns the kind of the worker registered under workerKey.
+func workerKind(workerKey string) string {
+	for _, kind := range WorkerKinds {
+		if strings.HasPrefix(workerKey, kind+"-") {
+			return kind
+		}
+	}
+	return WorkerKindJob
+}
+
+// MessageRates is the recent message rate of a broker from the Management API.
+type MessageRates struct {
+	Publish     float64   // Messages published per second right now
+	Deliver     float64   // Messages delivered to consumers or fetched per second right now
+	PublishHist []float64 // Messages published per second in each interval, oldest first
+	Interval    time.Duration
+}
+
+// managementRateDetails is a message rate of the Management API with its samples, newest first. Samples
+// are the total number of messages at their timestamp, in milliseconds.
+type managementRateDetails struct {
+	Rate    float64 `json:"rate"`
+	Samples []struct {
+		Sample    float64 `json:"sample"`
+		Timestamp int64   `json:"timestamp"`
+	} `json:"samples"`
+}
+
+// MessageRates returns the message rates of the broker of a connection over the last age, sampled every
+// interval. RabbitMQ keeps the samples for as long as its management rates retention allows.
+func (r *RabbitMQ) MessageRates(connName string, age, interval time.Duration) (*MessageRates, error) {
+	var overview struct {
+		MessageStats struct {
+			PublishDetails    managementRateDetails `json:"publish_details"`
+			DeliverGetDetails managementRateDetails `json:"deliver_get_details"`
+		} `json:"message_stats"`
+	}
+	path := fmt.Sprintf("/api/overview?msg_rates_age=%d&msg_rates_incr=%d", int(age.Seconds()), int(interval.Seconds()))
+	if err := r.managementGet(connName, path, &overview); err != nil {
+		return nil, fmt.Errorf("could not get message rates: %w", err)
+	}
+
+	rates := &MessageRates{
+		Publish:  overview.MessageStats.PublishDetails.Rate,
+		Deliver:  overview.MessageStats.DeliverGetDetails.Rate,
+		Interval: interval,
+	}
+	samples := overview.MessageStats.PublishDetails.Samples
+	for i := len(samples) - 1; i > 0; i-- {
+		newer, older := samples[i-1], samples[i]
+		seconds := float64(newer.Timestamp-older.Timestamp) / 1000
+		rate := 0.0
+		if seconds > 0 && newer.Sample > older.Sample {
+			// A total that went down was reset by a broker restart.
+			rate = (newer.Sample - older.Sample) / seconds
+		}
+		rates.PublishHist = append(rates.PublishHist, rate)
+	}
+	return rates, nil
+}
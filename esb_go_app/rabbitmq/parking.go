@@ -0,0 +1,231 @@
+package rabbitmq
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Headers added to a message when it is moved to a parking lot.
+const (
+	parkedIDHeader         = "x-parked-id"
+	parkedAtHeader         = "x-parked-at"
+	originalExchangeHeader = "x-original-exchange"
+	originalQueueHeader    = "x-original-queue"
+)
+
+// MaxBrowsedParkedMessages bounds the number of parked messages shown on the parking-lot page.
+const MaxBrowsedParkedMessages = 100
+
+// maxParkingLotScan bounds the number of messages a requeue looks at to find the selected ones.
+const maxParkingLotScan = 10000
+
+// ParkedMessage is a dead-lettered message of a route as shown on the parking-lot page.
+type ParkedMessage struct {
+	ID               string // x-parked-id, or a digest of the message for messages parked before the header existed
+	MessageID        string
+	ContentType      string
+	Reason           string // The last processing error
+	Attempts         int
+	OriginalExchange string
+	OriginalQueue    string
+	RoutingKey       string
+	ParkedAt         string
+	Headers          map[string]string
+	Body             string
+}
+
+// RouteSourceQueue returns the connection and the queue a route consumes from, following the same
+// rules as StartRouter.
+func (r *RabbitMQ) RouteSourceQueue(route *storage.Route) (string, string, error) {
+	fanoutQueue := fmt.Sprintf("route_fanout_queue_for_%s_%s", route.Name, route.ID)
+	if strings.HasPrefix(route.SourceChannelID, "collector-output:") {
+		return DefaultConnection, fanoutQueue, nil
+	}
+	sourceChannel, err := r.dataStore.GetChannelByID(route.SourceChannelID)
+	if err != nil {
+		return "", "", err
+	}
+	if sourceChannel == nil {
+		return "", "", fmt.Errorf("source channel %s not found", route.SourceChannelID)
+	}
+	if sourceChannel.FanoutMode {
+		return ChannelConnection(sourceChannel), fanoutQueue, nil
+	}
+	return ChannelConnection(sourceChannel), "durable_queue_for_" + sourceChannel.Destination, nil
+}
+
+// BrowseParkingLot returns up to limit messages of a parking-lot queue without removing them, together
+// with the total number of parked messages. The messages are fetched unacknowledged and return to the
+// queue when the channel closes.
+func (r *RabbitMQ) BrowseParkingLot(connName, queueName string, limit int) ([]ParkedMessage, int, error) {
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(queueName, true, false, false, false, nil)
+	if err != nil {
+		if isNotFound(err) {
+			// The parking lot is declared when the first message is parked.
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to inspect queue '%s': %w", queueName, err)
+	}
+
+	var messages []ParkedMessage
+	for len(messages) < limit {
+		d, ok, err := ch.Get(queueName, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get message from '%s': %w", queueName, err)
+		}
+		if !ok {
+			break
+		}
+		messages = append(messages, parkedMessage(&d))
+	}
+	return messages, q.Messages, nil
+}
+
+// RequeueParked moves the selected messages of a parking-lot queue back to the queue they were parked
+// from, or to fallbackQueue for messages without an x-original-queue header. The retry count is reset,
+// so the requeued messages get the full retry policy again. It returns the number of requeued messages.
+func (r *RabbitMQ) RequeueParked(connName, queueName, fallbackQueue string, ids []string) (int, error) {
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return 0, fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close() // Returns the messages that were not selected
+	if err := ch.Confirm(false); err != nil {
+		return 0, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	requeued := 0
+	for scanned := 0; scanned < maxParkingLotScan && requeued < len(selected); scanned++ {
+		d, ok, err := ch.Get(queueName, false)
+		if err != nil {
+			return requeued, fmt.Errorf("failed to get message from '%s': %w", queueName, err)
+		}
+		if !ok {
+			break
+		}
+		msg := parkedMessage(&d)
+		if !selected[msg.ID] {
+			continue
+		}
+
+		target := msg.OriginalQueue
+		if target == "" {
+			target = fallbackQueue
+		}
+		publishing := durablePublishing(&d)
+		publishing.Headers = amqp091.Table{}
+		for k, v := range d.Headers {
+			switch k {
+			case retryCountHeader, lastErrorHeader, parkedIDHeader, parkedAtHeader, originalExchangeHeader, originalQueueHeader:
+			default:
+				publishing.Headers[k] = v
+			}
+		}
+
+		confirmation, err := ch.PublishWithDeferredConfirm("", target, false, false, publishing)
+		if err != nil {
+			return requeued, fmt.Errorf("failed to publish to '%s': %w", target, err)
+		}
+		if !confirmation.Wait() {
+			return requeued, fmt.Errorf("broker rejected requeued message %s", msg.ID)
+		}
+		if err := d.Ack(false); err != nil {
+			return requeued, fmt.Errorf("failed to acknowledge requeued message: %w", err)
+		}
+		requeued++
+		r.logger.Info("requeued parked message", "queue", queueName, "target_queue", target, "parked_id", msg.ID, "msgId", d.MessageId)
+	}
+	return requeued, nil
+}
+
+// parkedMessage extracts the parking-lot details of a delivery.
+func parkedMessage(d *amqp091.Delivery) ParkedMessage {
+	msg := ParkedMessage{
+		MessageID:        d.MessageId,
+		ContentType:      d.ContentType,
+		Attempts:         retryCount(d.Headers),
+		Reason:           headerString(d.Headers, lastErrorHeader),
+		OriginalExchange: headerString(d.Headers, originalExchangeHeader),
+		OriginalQueue:    headerString(d.Headers, originalQueueHeader),
+		RoutingKey:       d.RoutingKey,
+		ParkedAt:         headerString(d.Headers, parkedAtHeader),
+		ID:               headerString(d.Headers, parkedIDHeader),
+		Headers:          make(map[string]string, len(d.Headers)),
+		Body:             string(d.Body),
+	}
+	for k, v := range d.Headers {
+		msg.Headers[k] = fmt.Sprint(v)
+	}
+
+	// Messages dead-lettered by the broker carry an x-death header instead of ours.
+	if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp091.Table); ok {
+			if msg.Reason == "" {
+				msg.Reason, _ = death["reason"].(string)
+			}
+			if msg.OriginalQueue == "" {
+				msg.OriginalQueue, _ = death["queue"].(string)
+			}
+			if msg.OriginalExchange == "" {
+				msg.OriginalExchange, _ = death["exchange"].(string)
+			}
+		}
+	}
+
+	if msg.OriginalExchange == "" {
+		// Captured unroutable messages keep the exchange they were published to.
+		msg.OriginalExchange = d.Exchange
+	}
+	if msg.ID == "" {
+		msg.ID = parkedMessageDigest(d)
+	}
+	return msg
+}
+
+// parkedMessageDigest identifies a parked message without an x-parked-id header by its ID, headers and body.
+func parkedMessageDigest(d *amqp091.Delivery) string {
+	keys := make([]string, 0, len(d.Headers))
+	for k := range d.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n", d.MessageId)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%v\n", k, d.Headers[k])
+	}
+	h.Write(d.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// headerString reads a string header, returning "" when it is missing or not a string.
+func headerString(headers amqp091.Table, key string) string {
+	s, _ := headers[key].(string)
+	return s
+}
+
+// isNotFound reports whether err is the broker's 404 reply, e.g. to a passive declare of a missing queue.
+func isNotFound(err error) bool {
+	var amqpErr *amqp091.Error
+	return errors.As(err, &amqpErr) && amqpErr.Code == amqp091.NotFound
+}
@@ -4,75 +4,78 @@ import (
 	"fmt"
 	"time"
 
+	"esb-go-app/scripting"
+
 	"github.com/rabbitmq/amqp091-go"
 )
 
-// EnsureExchange declares a durable fanout exchange if it doesn't already exist.
-func (r *RabbitMQ) EnsureExchange(name string) error {
-	ch, err := r.conn.Channel()
-	if err != nil {
-		return fmt.Errorf("could not open channel to ensure exchange: %w", err)
-	}
-	defer ch.Close()
-
+// EnsureExchange declares a durable fanout exchange on the given connection if it doesn't already exist.
+// Unroutable messages are captured through the alternate exchange like on every durable exchange.
+func (r *RabbitMQ) EnsureExchange(connName, name string) error {
 	r.logger.Info("ensuring fanout exchange exists", "exchange_name", name)
-	return ch.ExchangeDeclare(
-		name,
-		"fanout",
-		true,  // durable
-		false, // auto-delete
-		false, // internal
-		false, // no-wait
-		nil,   // arguments
-	)
+	if err := r.declareDurableExchange(connName, name); err != nil {
+		return fmt.Errorf("could not ensure exchange: %w", err)
+	}
+	return nil
 }
 
 // republishAsDurable re-publishes a message to a new exchange, ensuring it's persistent.
-func (r *RabbitMQ) republishAsDurable(msg *amqp091.Delivery, exchangeName string) error {
-	ch, err := r.conn.Channel()
+func (r *RabbitMQ) republishAsDurable(connName string, msg *amqp091.Delivery, exchangeName string) error {
+	ch, err := r.openPublishChannel(connName)
 	if err != nil {
 		return err
 	}
 	defer ch.Close()
-	var _ amqp091.Delivery
+	r.watchReturns(connName, ch)
+	return publishDurable(ch, msg, exchangeName)
+}
 
+// publishDurable publishes a persistent copy of msg to exchangeName on an already open channel.
+// The message is mandatory, so the broker returns it when nothing is bound; register watchReturns on ch.
+func publishDurable(ch *amqp091.Channel, msg *amqp091.Delivery, exchangeName string) error {
 	return ch.Publish(
 		exchangeName,
-		"", // fanout does not use a routing key
+		"",   // fanout does not use a routing key
+		true, // mandatory
 		false,
-		false,
-		amqp091.Publishing{
-			Headers:         msg.Headers,
-			ContentType:     msg.ContentType,
-			ContentEncoding: msg.ContentEncoding,
-			DeliveryMode:    amqp091.Persistent,
-			Priority:        msg.Priority,
-			CorrelationId:   msg.CorrelationId,
-			ReplyTo:         msg.ReplyTo,
-			Expiration:      msg.Expiration,
-			MessageId:       msg.MessageId,
-			Timestamp:       msg.Timestamp,
-			Type:            msg.Type,
-			UserId:          msg.UserId,
-			AppId:           msg.AppId,
-			Body:            msg.Body,
-		},
+		durablePublishing(msg),
 	)
 }
 
-// Publish publishes a transient text message to a given exchange.
-func (r *RabbitMQ) Publish(exchangeName, routingKey, body string) error {
-	ch, err := r.conn.Channel()
+// durablePublishing copies the properties and body of a delivery into a persistent publishing.
+func durablePublishing(msg *amqp091.Delivery) amqp091.Publishing {
+	return amqp091.Publishing{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    amqp091.Persistent,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+// Publish publishes a transient text message to a given exchange on the given connection.
+func (r *RabbitMQ) Publish(connName, exchangeName, routingKey, body string) error {
+	ch, err := r.openPublishChannel(connName)
 	if err != nil {
 		return fmt.Errorf("could not open channel: %w", err)
 	}
 	defer ch.Close()
+	r.watchReturns(connName, ch)
 
 	r.logger.Info("publishing test message", "exchange", exchangeName, "routingKey", routingKey)
 	err = ch.Publish(
 		exchangeName,
 		routingKey,
-		false, // mandatory
+		true,  // mandatory, returned messages are reported by watchReturns
 		false, // immediate
 		amqp091.Publishing{
 			ContentType:  "application/json",
@@ -88,3 +91,78 @@ func (r *RabbitMQ) Publish(exchangeName, routingKey, body string) error {
 
 	return nil
 }
+
+// PublishCollected publishes a persistent JSON message a collector script returned to the given exchange,
+// with the headers, priority and AMQP properties the script set on it.
+func (r *RabbitMQ) PublishCollected(connName, exchangeName string, body []byte, msg *scripting.TransformedMessage) error {
+	ch, err := r.openPublishChannel(connName)
+	if err != nil {
+		return fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close()
+	r.watchReturns(connName, ch)
+
+	delivery := amqp091.Delivery{
+		ContentType: "application/json",
+		Headers:     headersTable(msg.Headers),
+		Timestamp:   time.Now(),
+		Body:        body,
+	}
+	if msg.Priority != nil {
+		delivery.Priority = uint8(*msg.Priority)
+	}
+	applyProperties(&delivery, msg.Properties)
+
+	if err := publishDurable(ch, &delivery, exchangeName); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// publishDelayed parks a message in a TTL staging queue whose dead-letter exchange is the final destination,
+// so the broker delivers it after delaySeconds. One staging queue exists per destination and delay.
+func (r *RabbitMQ) publishDelayed(connName string, msg *amqp091.Delivery, exchangeName string, delaySeconds int) error {
+	stagingQueue := fmt.Sprintf("delay_queue_for_%s_%ds", exchangeName, delaySeconds)
+	return r.publishToStagingQueue(connName, msg, stagingQueue, delaySeconds, exchangeName, "")
+}
+
+// publishToStagingQueue publishes a persistent copy of msg into a TTL queue that dead-letters to
+// deadLetterExchange/deadLetterRoutingKey once delaySeconds have passed.
+func (r *RabbitMQ) publishToStagingQueue(connName string, msg *amqp091.Delivery, stagingQueue string, delaySeconds int, deadLetterExchange, deadLetterRoutingKey string) error {
+	ch, err := r.openPublishChannel(connName)
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	_, err = ch.QueueDeclare(stagingQueue, true, false, false, false, amqp091.Table{
+		"x-message-ttl":             int64(delaySeconds) * 1000,
+		"x-dead-letter-exchange":    deadLetterExchange,
+		"x-dead-letter-routing-key": deadLetterRoutingKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare staging queue '%s': %w", stagingQueue, err)
+	}
+
+	return ch.Publish(
+		"", // default exchange routes directly to the staging queue
+		stagingQueue,
+		false,
+		false,
+		amqp091.Publishing{
+			Headers:         msg.Headers,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    amqp091.Persistent,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			UserId:          msg.UserId,
+			AppId:           msg.AppId,
+			Body:            msg.Body,
+		},
+	)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,55 +16,229 @@ import (
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// DefaultConnection is the name of the broker connection built from the top-level RabbitMQ settings.
+const DefaultConnection = "default"
+
+// brokerConnection is a single named connection of the registry. Publishing runs on its own TCP
+// connection, so flow control the broker applies to publishers never blocks the consumers and the
+// acknowledgements they send, and a slow consumer never holds up publishing.
+type brokerConnection struct {
+	cfg         *config.RabbitMQConfig
+	conn        *amqp091.Connection // Consuming, topology and maintenance channels
+	publishConn *amqp091.Connection // Channels that publish messages
+}
+
+// dialBroker opens the consumer and the publisher connection of a broker.
+func dialBroker(cfg *config.RabbitMQConfig) (*brokerConnection, error) {
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	publishConn, err := dial(cfg)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("publisher connection: %w", err)
+	}
+	return &brokerConnection{cfg: cfg, conn: conn, publishConn: publishConn}, nil
+}
+
+// close closes both connections of a broker and returns the first error.
+func (b *brokerConnection) close() error {
+	err := b.conn.Close()
+	if publishErr := b.publishConn.Close(); err == nil {
+		err = publishErr
+	}
+	return err
+}
+
 // RabbitMQ holds the connection and configuration for RabbitMQ interactions.
 type RabbitMQ struct {
-	conn             *amqp091.Connection
+	brokers          map[string]*brokerConnection // Broker connections keyed by name, including vhost connections dialed on demand
+	brokersMu        sync.RWMutex                 // Mutex to protect brokers
 	logger           *slog.Logger
-	dataStore        *storage.Store
+	dataStore        storage.Store
 	scriptingService *scripting.Service
 	workers          map[string]bool
 	stoppers         map[string]context.CancelFunc // Map to hold cancellation functions for workers
-	stoppersMu       sync.Mutex                    // Mutex to protect the stoppers map
+	breakers         map[string]*BreakerStatus     // Circuit breakers keyed by destination channel ID
+	shovels          map[string]*ShovelJob         // Running and recently finished shovel jobs keyed by ID
+	stoppersMu       sync.Mutex                    // Mutex to protect the workers, stoppers, breakers and shovels maps
+	lastActivity     map[string]time.Time          // Time of the last message seen per channel worker key
+	silentChannels   map[string]bool               // Channel IDs currently reported as silent
+	activityMu       sync.Mutex                    // Mutex to protect lastActivity and silentChannels
+	sampleCounters   map[string]uint64             // Routed messages per route ID, used to pick every Nth one for sampling
+	sampleMu         sync.Mutex                    // Mutex to protect sampleCounters
+	routeCounters    map[string]*routeCounters     // Delivery outcomes per route ID counted since the last flush to the database
+	routeCountersMu  sync.Mutex                    // Mutex to protect routeCounters
+	pendingReplies   map[string]*pendingReply      // Requests of request-reply routes waiting for their reply, keyed by route and correlation ID
+	repliesMu        sync.Mutex                    // Mutex to protect pendingReplies
+	executionHistory executionHistory              // Settings of the script execution history, disabled when keep is 0
+	hooks            storage.TransformationHooks   // Global transformations run around the transformations of every transform route
+	hooksMu          sync.RWMutex                  // Mutex to protect hooks
+	startedAt        time.Time
 	cfg              *config.RabbitMQConfig
 }
 
-// New creates a new RabbitMQ instance and connects to the broker.
-func New(cfg *config.RabbitMQConfig, logger *slog.Logger, dataStore *storage.Store, scriptingService *scripting.Service) (*RabbitMQ, error) {
-	conn, err := amqp091.Dial(cfg.DSN)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+// New creates a new RabbitMQ instance and connects to every configured broker.
+func New(cfg *config.RabbitMQConfig, logger *slog.Logger, dataStore storage.Store, scriptingService *scripting.Service) (*RabbitMQ, error) {
+	configs := map[string]*config.RabbitMQConfig{DefaultConnection: cfg}
+	for name, connCfg := range cfg.Connections {
+		if name == DefaultConnection {
+			return nil, fmt.Errorf("connection name '%s' is reserved for the top-level RabbitMQ settings", DefaultConnection)
+		}
+		if strings.Contains(name, vhostSeparator) {
+			return nil, fmt.Errorf("connection name '%s' must not contain '%s'", name, vhostSeparator)
+		}
+		connCfg := connCfg
+		configs[name] = &connCfg
+	}
+
+	brokers := make(map[string]*brokerConnection, len(configs))
+	for name, connCfg := range configs {
+		b, err := dialBroker(connCfg)
+		if err != nil {
+			for _, b := range brokers {
+				b.close()
+			}
+			return nil, fmt.Errorf("failed to connect to RabbitMQ (connection '%s'): %w", name, err)
+		}
+		brokers[name] = b
+		logger.Info("connected to RabbitMQ successfully", "connection", name)
 	}
-	logger.Info("connected to RabbitMQ successfully")
 
 	return &RabbitMQ{
-		conn:             conn,
+		brokers:          brokers,
 		logger:           logger,
 		dataStore:        dataStore,
 		scriptingService: scriptingService,
 		workers:          make(map[string]bool),
 		stoppers:         make(map[string]context.CancelFunc), // Initialize stoppers
+		breakers:         make(map[string]*BreakerStatus),
+		shovels:          make(map[string]*ShovelJob),
+		lastActivity:     make(map[string]time.Time),
+		silentChannels:   make(map[string]bool),
+		sampleCounters:   make(map[string]uint64),
+		routeCounters:    make(map[string]*routeCounters),
+		pendingReplies:   make(map[string]*pendingReply),
+		startedAt:        time.Now(),
 		cfg:              cfg,
 	}, nil
 }
 
-// Close
+// broker returns the named connection; an empty name selects the default connection.
+func (r *RabbitMQ) broker(name string) (*brokerConnection, error) {
+	if name == "" {
+		name = DefaultConnection
+	}
+	r.brokersMu.RLock()
+	b, ok := r.brokers[name]
+	r.brokersMu.RUnlock()
+	if ok {
+		return b, nil
+	}
+	if base, vhost, isVHost := strings.Cut(name, vhostSeparator); isVHost {
+		return r.dialVHost(name, base, vhost)
+	}
+	return nil, fmt.Errorf("unknown RabbitMQ connection '%s'", name)
+}
+
+// openChannel opens an AMQP channel on the consumer connection of the named connection.
+func (r *RabbitMQ) openChannel(connName string) (*amqp091.Channel, error) {
+	b, err := r.broker(connName)
+	if err != nil {
+		return nil, err
+	}
+	return b.conn.Channel()
+}
+
+// openPublishChannel opens an AMQP channel on the publisher connection of the named connection.
+func (r *RabbitMQ) openPublishChannel(connName string) (*amqp091.Channel, error) {
+	b, err := r.broker(connName)
+	if err != nil {
+		return nil, err
+	}
+	return b.publishConn.Channel()
+}
+
+// HasConnection reports whether a broker connection with the given name is configured.
+func (r *RabbitMQ) HasConnection(name string) bool {
+	_, err := r.broker(name)
+	return err == nil
+}
+
+// ConnectionNames returns the configured connection names, default first.
+func (r *RabbitMQ) ConnectionNames() []string {
+	r.brokersMu.RLock()
+	defer r.brokersMu.RUnlock()
+	names := make([]string, 0, len(r.brokers))
+	for name := range r.brokers {
+		if name != DefaultConnection && !strings.Contains(name, vhostSeparator) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultConnection}, names...)
+}
+
+// channelWorkerKey builds the worker registry key for a channel worker on a connection.
+func channelWorkerKey(kind, connName, baseName string) string {
+	if connName == "" || connName == DefaultConnection {
+		return kind + "-" + baseName
+	}
+	return kind + "-" + connName + ":" + baseName
+}
+
+// Close stores the route statistics counted since the last flush and closes the consumer and publisher
+// connections of every broker.
 func (r *RabbitMQ) Close() error {
-	return r.conn.Close()
+	r.flushRouteStats()
+	r.brokersMu.RLock()
+	defer r.brokersMu.RUnlock()
+	var firstErr error
+	for name, b := range r.brokers {
+		if err := b.close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close connection '%s': %w", name, err)
+		}
+	}
+	return firstErr
 }
 
-// StopRouter stops a running router worker.
-func (r *RabbitMQ) StopRouter(routeID string) {
-	workerKey := "router-" + routeID
+// registerWorker atomically registers a worker under workerKey and returns the context that stops it.
+// It returns false when a worker with the same key is already running.
+func (r *RabbitMQ) registerWorker(workerKey string) (context.Context, bool) {
+	r.stoppersMu.Lock()
+	defer r.stoppersMu.Unlock()
 
+	if r.workers[workerKey] {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.stoppers[workerKey] = cancel
+	r.workers[workerKey] = true
+	return ctx, true
+}
+
+// stopWorker cancels the worker registered under workerKey and reports whether it was running.
+func (r *RabbitMQ) stopWorker(workerKey string) bool {
 	r.stoppersMu.Lock()
 	defer r.stoppersMu.Unlock()
 
-	if cancel, ok := r.stoppers[workerKey]; ok {
+	cancel, ok := r.stoppers[workerKey]
+	if !ok {
+		return false
+	}
+	cancel() // Signal the worker to stop
+	delete(r.stoppers, workerKey)
+	delete(r.workers, workerKey)
+	return true
+}
+
+// StopRouter stops a running router worker.
+func (r *RabbitMQ) StopRouter(routeID string) {
+	if r.stopWorker("router-" + routeID) {
 		r.logger.Info("stopping router worker", "route_id", routeID)
-		cancel() // Signal the worker to stop
-		delete(r.stoppers, workerKey)
-		delete(r.workers, workerKey)
 	}
+	r.stopReplyListeners(routeID)
 }
 
 // RestartRouter stops and then starts a router worker.
@@ -72,3 +248,30 @@ func (r *RabbitMQ) RestartRouter(routeID, routeName, sourceID string) {
 	time.Sleep(100 * time.Millisecond)
 	r.StartRouter(routeID, routeName, sourceID)
 }
+
+// IsConnected reports whether both connections of the named broker are open.
+func (r *RabbitMQ) IsConnected(connName string) bool {
+	b, err := r.broker(connName)
+	if err != nil {
+		return false
+	}
+	return !b.conn.IsClosed() && !b.publishConn.IsClosed()
+}
+
+// isWorkerRunning reports whether a worker is registered under workerKey.
+func (r *RabbitMQ) isWorkerRunning(workerKey string) bool {
+	r.stoppersMu.Lock()
+	defer r.stoppersMu.Unlock()
+	_, ok := r.stoppers[workerKey]
+	return ok
+}
+
+// IsRouterRunning reports whether the router worker of a route is running.
+func (r *RabbitMQ) IsRouterRunning(routeID string) bool {
+	return r.isWorkerRunning("router-" + routeID)
+}
+
+// IsChannelWorkerRunning reports whether the worker of a channel destination is running.
+func (r *RabbitMQ) IsChannelWorkerRunning(connName, direction, baseName string) bool {
+	return r.isWorkerRunning(channelWorkerKey(direction, connName, baseName))
+}
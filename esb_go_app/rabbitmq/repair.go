@@ -0,0 +1,229 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"esb-go-app/metrics"
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Kinds of topology drift the repair job fixes.
+const (
+	repairMissingExchange = "missing_exchange"
+	repairMissingQueue    = "missing_queue"
+	repairMissingBinding  = "missing_binding"
+)
+
+// expectedBinding is a durable queue bound to a durable exchange that the database says must exist:
+// the storage queue of a channel or the subscription queue of a fan-out route.
+type expectedBinding struct {
+	connName string
+	exchange string
+	queue    string
+	opts     QueueOptions
+}
+
+// StartTopologyRepair starts the job that checks the durable topology of every channel and fan-out
+// route every interval and recreates the exchanges, queues and bindings missing in RabbitMQ, e.g. after
+// an operator deleted a queue by hand. Consumers of a recreated queue re-register on their own.
+func (r *RabbitMQ) StartTopologyRepair(interval time.Duration) {
+	ctx, ok := r.registerWorker("topology-repair")
+	if !ok {
+		return
+	}
+	r.logger.Info("topology drift auto-repair enabled", "interval", interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.repairTopology()
+			}
+		}
+	}()
+}
+
+// repairTopology checks every expected binding once and logs a summary when anything was repaired.
+func (r *RabbitMQ) repairTopology() {
+	expected, err := r.expectedTopology()
+	if err != nil {
+		r.logger.Error("failed to load the expected topology for the repair job", "error", err)
+		return
+	}
+
+	repaired := 0
+	for _, b := range expected {
+		n, err := r.repairBinding(b)
+		repaired += n
+		if err != nil {
+			r.logger.Error("failed to verify or repair topology", "connection", b.connName, "exchange", b.exchange, "queue", b.queue, "error", err)
+		}
+	}
+	if repaired > 0 {
+		r.logger.Warn("topology drift repaired", "checked", len(expected), "repaired", repaired)
+	} else {
+		r.logger.Debug("topology verified, no drift found", "checked", len(expected))
+	}
+}
+
+// expectedTopology lists the bindings declared by the channels and the fan-out routes in the database,
+// following the same naming rules as SetupDurableTopology and StartRouter.
+func (r *RabbitMQ) expectedTopology() ([]expectedBinding, error) {
+	channels, err := r.dataStore.GetAllChannels(storage.ListFilter{})
+	if err != nil {
+		return nil, err
+	}
+	routes, err := r.dataStore.GetAllRoutes(storage.ListFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	var expected []expectedBinding
+	seen := make(map[string]bool)
+	add := func(b expectedBinding) {
+		// Channels sharing a destination share its topology.
+		key := b.connName + "|" + b.queue
+		if !seen[key] {
+			seen[key] = true
+			expected = append(expected, b)
+		}
+	}
+
+	channelsByID := make(map[string]int, len(channels))
+	for i := range channels {
+		ch := &channels[i]
+		channelsByID[ch.ID] = i
+		add(expectedBinding{
+			connName: ChannelConnection(ch),
+			exchange: "durable_exchange_for_" + ch.Destination,
+			queue:    "durable_queue_for_" + ch.Destination,
+			opts:     ChannelQueueOptions(ch),
+		})
+	}
+
+	for _, route := range routes {
+		fanoutQueue := fmt.Sprintf("route_fanout_queue_for_%s_%s", route.Name, route.ID)
+		if strings.HasPrefix(route.SourceChannelID, "collector-output:") {
+			add(expectedBinding{connName: DefaultConnection, exchange: route.SourceChannelID, queue: fanoutQueue})
+			continue
+		}
+		i, ok := channelsByID[route.SourceChannelID]
+		if !ok || !channels[i].FanoutMode {
+			continue
+		}
+		ch := &channels[i]
+		add(expectedBinding{
+			connName: ChannelConnection(ch),
+			exchange: "durable_exchange_for_" + ch.Destination,
+			queue:    fanoutQueue,
+			opts:     QueueOptions{MaxPriority: ch.MaxPriority},
+		})
+	}
+	return expected, nil
+}
+
+// repairBinding recreates whatever is missing of an expected binding and returns the number of repairs.
+func (r *RabbitMQ) repairBinding(b expectedBinding) (int, error) {
+	exchangeMissing, err := missing(r.checkExchangeExists(b.connName, b.exchange))
+	if err != nil {
+		return 0, err
+	}
+	queueMissing, err := missing(r.checkQueueExists(b.connName, b.queue))
+	if err != nil {
+		return 0, err
+	}
+	bindingMissing := exchangeMissing || queueMissing
+	bindingVerified := true
+	if !bindingMissing {
+		exists, err := r.bindingExists(b.connName, b.exchange, b.queue)
+		if err != nil {
+			// Without the Management API the binding cannot be inspected; rebinding is idempotent.
+			r.logger.Debug("could not verify binding, rebinding", "connection", b.connName, "exchange", b.exchange, "queue", b.queue, "error", err)
+			bindingVerified = false
+		}
+		bindingMissing = !exists
+	}
+	if !bindingMissing {
+		return 0, nil
+	}
+
+	repairs := 0
+	if exchangeMissing {
+		if err := r.declareDurableExchange(b.connName, b.exchange); err != nil {
+			return repairs, fmt.Errorf("failed to recreate exchange: %w", err)
+		}
+		r.logTopologyRepair(b, repairMissingExchange, b.exchange)
+		repairs++
+	}
+
+	ch, err := r.openChannel(b.connName)
+	if err != nil {
+		return repairs, fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close()
+
+	if queueMissing {
+		if _, err := ch.QueueDeclare(b.queue, true, false, false, false, b.opts.args()); err != nil {
+			return repairs, fmt.Errorf("failed to recreate queue: %w", err)
+		}
+		r.logTopologyRepair(b, repairMissingQueue, b.queue)
+		repairs++
+	}
+	if err := ch.QueueBind(b.queue, "", b.exchange, false, nil); err != nil {
+		return repairs, fmt.Errorf("failed to recreate binding: %w", err)
+	}
+	if exchangeMissing || queueMissing || !bindingVerified {
+		// The binding went away with the exchange or the queue, or it was only redeclared as a precaution.
+		return repairs, nil
+	}
+	r.logTopologyRepair(b, repairMissingBinding, b.queue)
+	return repairs + 1, nil
+}
+
+// logTopologyRepair logs and counts a single repaired object.
+func (r *RabbitMQ) logTopologyRepair(b expectedBinding, kind, name string) {
+	metrics.TopologyRepairs.WithLabelValues(b.connName, kind).Inc()
+	r.logger.Warn("recreated missing topology", "connection", b.connName, "kind", kind, "name", name, "exchange", b.exchange, "queue", b.queue)
+}
+
+// bindingExists asks the Management API whether exchange is bound to queue in the vhost of the connection.
+func (r *RabbitMQ) bindingExists(connName, exchange, queue string) (bool, error) {
+	b, err := r.broker(connName)
+	if err != nil {
+		return false, err
+	}
+	uri, err := amqp091.ParseURI(b.cfg.DSN)
+	if err != nil {
+		return false, fmt.Errorf("invalid DSN of connection '%s': %w", connName, err)
+	}
+
+	var bindings []struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+	}
+	path := fmt.Sprintf("/api/bindings/%s/e/%s/q/%s", url.PathEscape(uri.Vhost), url.PathEscape(exchange), url.PathEscape(queue))
+	if err := r.managementGet(connName, path, &bindings); err != nil {
+		return false, fmt.Errorf("could not get bindings: %w", err)
+	}
+	return len(bindings) > 0, nil
+}
+
+// missing turns the result of a passive declaration into whether the object is missing, keeping other errors.
+func missing(err error) (bool, error) {
+	if err == nil {
+		return false, nil
+	}
+	if isNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
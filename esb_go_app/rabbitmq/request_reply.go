@@ -0,0 +1,224 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"esb-go-app/metrics"
+	"esb-go-app/storage"
+
+	"github.com/google/uuid"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// defaultReplyTimeout applies to request-reply routes without a reply timeout.
+const defaultReplyTimeout = 30 * time.Second
+
+// pendingReply is a request routed by a request-reply route that waits for its reply.
+type pendingReply struct {
+	routeID  string
+	connName string // Connection of the requester
+	replyTo  string // Reply queue of the requester
+	timeout  time.Duration
+	timer    *time.Timer // Forgets the request when the reply timeout expires
+}
+
+// ReplyQueue returns the queue a request-reply route receives the replies to its requests on.
+func ReplyQueue(routeName, routeID string) string {
+	return fmt.Sprintf("reply_queue_for_%s_%s", routeName, routeID)
+}
+
+// replyTimeout returns the reply timeout of a request-reply route.
+func replyTimeout(route *storage.Route) time.Duration {
+	if route.ReplyTimeoutSeconds <= 0 {
+		return defaultReplyTimeout
+	}
+	return time.Duration(route.ReplyTimeoutSeconds) * time.Second
+}
+
+// replyKey identifies a pending request by its route and correlation ID.
+func replyKey(routeID, correlationID string) string {
+	return routeID + "|" + correlationID
+}
+
+// trackRequest prepares a request routed by a request-reply route. The requester's reply_to queue
+// usually exists on the requester's connection only, so it is swapped for the route's reply queue on the
+// destination connection, and the reply listener relays replies back by their correlation ID. Requests
+// without a correlation ID get the message ID or a new one. A request whose reply does not arrive within
+// the reply timeout is forgotten; it also expires in the destination queues after that time unless it
+// already carries an expiration. Pending requests are kept in memory and do not survive a restart.
+func (r *RabbitMQ) trackRequest(route *storage.Route, msg *amqp091.Delivery, sourceConn, destConn string) error {
+	replyQueue := ReplyQueue(route.Name, route.ID)
+	if err := r.ensureReplyListener(route.ID, destConn, replyQueue); err != nil {
+		return err
+	}
+
+	if msg.CorrelationId == "" {
+		msg.CorrelationId = msg.MessageId
+		if msg.CorrelationId == "" {
+			msg.CorrelationId = uuid.New().String()
+		}
+	}
+	timeout := replyTimeout(route)
+	if msg.Expiration == "" {
+		msg.Expiration = strconv.FormatInt(timeout.Milliseconds(), 10)
+	}
+
+	correlationID := msg.CorrelationId
+	key := replyKey(route.ID, correlationID)
+	pending := &pendingReply{routeID: route.ID, connName: sourceConn, replyTo: msg.ReplyTo, timeout: timeout}
+	pending.timer = time.AfterFunc(timeout, func() {
+		if r.takePendingReply(key, pending) != nil {
+			metrics.RequestReplies.WithLabelValues(route.ID, "timeout").Inc()
+			r.logger.Warn("no reply received within the reply timeout", "route_id", route.ID, "correlation_id", correlationID, "reply_to", pending.replyTo, "timeout", timeout.String())
+		}
+	})
+
+	r.repliesMu.Lock()
+	if previous, ok := r.pendingReplies[key]; ok {
+		// A redelivered request replaces its earlier registration.
+		previous.timer.Stop()
+	}
+	r.pendingReplies[key] = pending
+	r.repliesMu.Unlock()
+
+	msg.ReplyTo = replyQueue
+	return nil
+}
+
+// takePendingReply removes and returns the pending request under key. When want is set, it is only
+// removed if it is still that registration.
+func (r *RabbitMQ) takePendingReply(key string, want *pendingReply) *pendingReply {
+	r.repliesMu.Lock()
+	defer r.repliesMu.Unlock()
+	pending, ok := r.pendingReplies[key]
+	if !ok || (want != nil && pending != want) {
+		return nil
+	}
+	delete(r.pendingReplies, key)
+	return pending
+}
+
+// ensureReplyListener declares the reply queue of a route on a connection and starts its listener.
+func (r *RabbitMQ) ensureReplyListener(routeID, connName, replyQueue string) error {
+	workerKey := "reply-listener-" + routeID + "-" + connName
+	if r.isWorkerRunning(workerKey) {
+		return nil
+	}
+
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return fmt.Errorf("could not open channel: %w", err)
+	}
+	_, err = ch.QueueDeclare(replyQueue, true, false, false, false, nil)
+	ch.Close()
+	if err != nil {
+		return fmt.Errorf("failed to declare reply queue '%s': %w", replyQueue, err)
+	}
+
+	ctx, ok := r.registerWorker(workerKey)
+	if !ok {
+		return nil
+	}
+	r.logger.Info("starting reply listener", "route_id", routeID, "connection", connName, "queue", replyQueue)
+	metrics.ActiveWorkers.WithLabelValues("reply").Inc()
+
+	go func() {
+		defer metrics.ActiveWorkers.WithLabelValues("reply").Dec()
+		for {
+			err := r.relayReplies(ctx, routeID, connName, replyQueue)
+			if ctx.Err() != nil {
+				r.logger.Info("reply listener stopped", "route_id", routeID, "connection", connName)
+				return
+			}
+			r.logger.Error("reply listener failed, restarting...", "route_id", routeID, "connection", connName, "error", err)
+			metrics.ErrorsTotal.WithLabelValues("reply").Inc()
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// stopReplyListeners stops the reply listeners of a route on every connection.
+func (r *RabbitMQ) stopReplyListeners(routeID string) {
+	prefix := "reply-listener-" + routeID + "-"
+	r.stoppersMu.Lock()
+	var keys []string
+	for key := range r.stoppers {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	r.stoppersMu.Unlock()
+
+	for _, key := range keys {
+		if r.stopWorker(key) {
+			r.logger.Info("stopping reply listener", "route_id", routeID, "connection", strings.TrimPrefix(key, prefix))
+		}
+	}
+}
+
+// relayReplies consumes the reply queue of a route and publishes every reply to the reply_to queue of
+// its request on the requester's connection. Replies without a pending request, e.g. late replies, are discarded.
+func (r *RabbitMQ) relayReplies(ctx context.Context, routeID, connName, replyQueue string) error {
+	consumer, err := r.newConsumerChannel(ctx, connName, replyQueue, "esb-reply-"+routeID, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-consumer.Deliveries():
+			if !ok {
+				return fmt.Errorf("consumer channel for '%s' closed", replyQueue)
+			}
+
+			key := replyKey(routeID, d.CorrelationId)
+			pending := r.takePendingReply(key, nil)
+			if pending == nil {
+				metrics.RequestReplies.WithLabelValues(routeID, "unmatched").Inc()
+				r.logger.Warn("reply without a pending request discarded", "route_id", routeID, "correlation_id", d.CorrelationId, "msgId", d.MessageId)
+				_ = d.Ack(false)
+				continue
+			}
+			pending.timer.Stop()
+
+			if err := r.publishReply(pending, &d); err != nil {
+				// Keep the request pending for another timeout so that the redelivered reply still finds it.
+				r.repliesMu.Lock()
+				r.pendingReplies[key] = pending
+				r.repliesMu.Unlock()
+				pending.timer.Reset(pending.timeout)
+				r.logger.Error("failed to relay reply, requeueing", "route_id", routeID, "correlation_id", d.CorrelationId, "reply_to", pending.replyTo, "error", err)
+				_ = d.Nack(false, true)
+				continue
+			}
+			_ = d.Ack(false)
+			metrics.RequestReplies.WithLabelValues(routeID, "delivered").Inc()
+			r.logger.Info("reply relayed to requester", "route_id", routeID, "correlation_id", d.CorrelationId, "reply_to", pending.replyTo, "connection", pending.connName)
+		}
+	}
+}
+
+// publishReply publishes a reply to the requester's reply_to queue through the default exchange.
+func (r *RabbitMQ) publishReply(pending *pendingReply, reply *amqp091.Delivery) error {
+	ch, err := r.openPublishChannel(pending.connName)
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	publishing := durablePublishing(reply)
+	publishing.ReplyTo = ""
+	return ch.Publish("", pending.replyTo, false, false, publishing)
+}
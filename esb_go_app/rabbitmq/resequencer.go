@@ -0,0 +1,200 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// MaxResequenceBuffer bounds the messages a resequencing route holds back, which is also used as the
+// consumer prefetch. When the buffer is full the lowest sequence number is released without waiting.
+const MaxResequenceBuffer = 1000
+
+// resequenceCheckInterval is how often the resequencer checks whether a gap has waited long enough.
+const resequenceCheckInterval = 250 * time.Millisecond
+
+// defaultResequenceWindow applies to resequencing routes without a window.
+const defaultResequenceWindow = 10 * time.Second
+
+// sequencedDelivery is a delivery held back by the resequencer.
+type sequencedDelivery struct {
+	seq        int64
+	receivedAt time.Time
+	d          amqp091.Delivery
+	late       bool  // Its sequence number was already passed, so it is routed out of order
+	skipped    int64 // Missing sequence numbers given up on before it
+}
+
+// resequencer orders the deliveries of a route by their sequence number. A delivery is released as soon
+// as it is the next expected one; a gap is waited for at most window, after which the lowest buffered
+// delivery is released and the sequence continues from it.
+type resequencer struct {
+	window  time.Duration
+	next    int64 // Next expected sequence number, valid once started is set
+	started bool
+	buffer  []sequencedDelivery // Sorted by sequence number
+}
+
+// add buffers a delivery, keeping the buffer sorted.
+func (q *resequencer) add(seq int64, d amqp091.Delivery) {
+	i := sort.Search(len(q.buffer), func(i int) bool { return q.buffer[i].seq > seq })
+	q.buffer = append(q.buffer, sequencedDelivery{})
+	copy(q.buffer[i+1:], q.buffer[i:])
+	q.buffer[i] = sequencedDelivery{seq: seq, receivedAt: time.Now(), d: d}
+}
+
+// release removes and returns the deliveries that may be routed now, in sequence order.
+func (q *resequencer) release(now time.Time) []sequencedDelivery {
+	var released []sequencedDelivery
+	for len(q.buffer) > 0 {
+		head := q.buffer[0]
+		switch {
+		case q.started && head.seq <= q.next:
+			// The next expected one, or a late or duplicate one that cannot be ordered any more.
+		case len(q.buffer) >= MaxResequenceBuffer, q.oldest().Add(q.window).Before(now):
+			// Give up on the gap; the sequence continues from the lowest buffered number.
+		default:
+			return released
+		}
+		q.buffer = q.buffer[1:]
+		switch {
+		case !q.started:
+			q.next = head.seq + 1
+			q.started = true
+		case head.seq < q.next:
+			head.late = true
+		default:
+			head.skipped = head.seq - q.next
+			q.next = head.seq + 1
+		}
+		released = append(released, head)
+	}
+	return released
+}
+
+// oldest returns when the longest waiting delivery of the buffer was received.
+func (q *resequencer) oldest() time.Time {
+	oldest := q.buffer[0].receivedAt
+	for _, s := range q.buffer[1:] {
+		if s.receivedAt.Before(oldest) {
+			oldest = s.receivedAt
+		}
+	}
+	return oldest
+}
+
+// routeResequenceLoop routes the deliveries of a resequencing route in the order of their sequence
+// numbers. Deliveries without a readable sequence number are routed right away. Buffered deliveries are
+// unacknowledged, so they return to the queue and are ordered again when the router stops.
+func (r *RabbitMQ) routeResequenceLoop(ctx context.Context, routeID, sourceConn, sourceQueue string, msgs <-chan amqp091.Delivery, key string, window time.Duration, limiter *tokenBucket) error {
+	q := &resequencer{window: window}
+	ticker := time.NewTicker(resequenceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("consumer channel for '%s' closed", sourceQueue)
+			}
+			seq, err := sequenceNumber(&d, key)
+			if err != nil {
+				r.logger.Warn("message without a usable sequence number, routed without resequencing", "route_id", routeID, "msgId", d.MessageId, "resequence_key", key, "error", err)
+				if err := r.routeSequenced(ctx, routeID, sourceConn, sourceQueue, &d, limiter); err != nil {
+					return err
+				}
+				continue
+			}
+			q.add(seq, d)
+		case <-ticker.C:
+		}
+
+		for _, s := range q.release(time.Now()) {
+			if s.late {
+				r.logger.Warn("message arrived after its sequence number was passed, routed out of order", "route_id", routeID, "msgId", s.d.MessageId, "sequence", s.seq)
+			} else if s.skipped > 0 {
+				r.logger.Warn("missing sequence numbers not received within the window, skipped", "route_id", routeID, "msgId", s.d.MessageId, "sequence", s.seq, "skipped", s.skipped)
+			}
+			if err := r.routeSequenced(ctx, routeID, sourceConn, sourceQueue, &s.d, limiter); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// routeSequenced routes and acknowledges one delivery released by the resequencer.
+func (r *RabbitMQ) routeSequenced(ctx context.Context, routeID, sourceConn, sourceQueue string, d *amqp091.Delivery, limiter *tokenBucket) error {
+	if err := limiter.wait(ctx); err != nil {
+		return err
+	}
+	route, err := r.loadRoute(routeID)
+	if err != nil {
+		r.logger.Error("failed to get route details after retries, requeueing", "route_id", routeID, "error", err)
+		_ = d.Nack(false, true)
+		return nil
+	}
+	if r.routeDelivery(ctx, route, d, sourceConn, sourceQueue, nil) {
+		_ = d.Ack(false)
+	}
+	return nil
+}
+
+// resequenceWindow returns the gap timeout of a resequencing route.
+func resequenceWindow(route *storage.Route) time.Duration {
+	if route.ResequenceSeconds <= 0 {
+		return defaultResequenceWindow
+	}
+	return time.Duration(route.ResequenceSeconds) * time.Second
+}
+
+// sequenceNumber reads the sequence number of a delivery: from the JSON body when key starts with
+// "$.", otherwise from the header named key. Numbers and numeric strings are accepted.
+func sequenceNumber(d *amqp091.Delivery, key string) (int64, error) {
+	var raw interface{}
+	if strings.HasPrefix(key, "$.") {
+		var body interface{}
+		if err := json.Unmarshal(d.Body, &body); err != nil {
+			return 0, fmt.Errorf("body is not JSON: %w", err)
+		}
+		value, found := lookupField(body, key)
+		if !found {
+			return 0, fmt.Errorf("field %s not found", key)
+		}
+		raw = value
+	} else {
+		value, found := d.Headers[key]
+		if !found {
+			return 0, fmt.Errorf("header %s not found", key)
+		}
+		raw = value
+	}
+
+	switch v := raw.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("sequence number must be a number, got %T", raw)
+	}
+}
@@ -0,0 +1,136 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"time"
+
+	"esb-go-app/storage"
+
+	"github.com/google/uuid"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	retryCountHeader = "x-retry-count"
+	lastErrorHeader  = "x-last-error"
+	maxRetryBackoff  = time.Hour
+)
+
+// ParkingLotQueue is the queue that keeps the messages of a route whose retries are exhausted.
+func ParkingLotQueue(routeName, routeID string) string {
+	return fmt.Sprintf("route_parking_lot_for_%s_%s", routeName, routeID)
+}
+
+// retryOrPark applies the retry policy of a route to a message that failed to process.
+// While attempts remain, the message is sent back to its source queue through a delay queue with an
+// incremented x-retry-count header; afterwards, or right away for permanent failures, it is moved to the
+// route's parking-lot queue, stored in the database, or both, as the DeadLetterStore of the route says. It
+// returns false when the route has no retry policy, so the caller keeps its default handling.
+func (r *RabbitMQ) retryOrPark(route *storage.Route, d *amqp091.Delivery, sourceConn, sourceQueue string, cause error, permanent bool) bool {
+	if route.RetryMaxAttempts <= 0 {
+		return false
+	}
+
+	attempt := retryCount(d.Headers) + 1
+	retry := *d
+	retry.Headers = amqp091.Table{}
+	for k, v := range d.Headers {
+		retry.Headers[k] = v
+	}
+	retry.Headers[retryCountHeader] = int32(attempt)
+	if cause != nil {
+		retry.Headers[lastErrorHeader] = cause.Error()
+	}
+
+	var err error
+	if !permanent && attempt <= route.RetryMaxAttempts {
+		delay := retryDelay(route.RetryBackoffSeconds, attempt)
+		stagingQueue := fmt.Sprintf("retry_queue_for_%s_%ds", sourceQueue, delay)
+		err = r.publishToStagingQueue(sourceConn, &retry, stagingQueue, delay, "", sourceQueue)
+		if err == nil {
+			r.logger.Warn("message processing failed, scheduled for retry", "route_id", route.ID, "msgId", d.MessageId, "attempt", attempt, "max_attempts", route.RetryMaxAttempts, "delay_seconds", delay, "error", cause)
+		}
+	} else if !r.storeDeadLetter(route, d, sourceQueue, cause, attempt-1) || route.DeadLetterStore != storage.DeadLetterDatabase {
+		// Messages the database could not take are parked rather than lost.
+		// Record where the message came from so it can be requeued from the parking-lot page.
+		retry.Headers[parkedIDHeader] = uuid.New().String()
+		retry.Headers[parkedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+		retry.Headers[originalExchangeHeader] = d.Exchange
+		retry.Headers[originalQueueHeader] = sourceQueue
+		err = r.parkMessage(sourceConn, &retry, ParkingLotQueue(route.Name, route.ID))
+		if err == nil {
+			r.logger.Error("message moved to parking lot", "route_id", route.ID, "msgId", d.MessageId, "attempts", attempt-1, "error", cause)
+		}
+	}
+
+	if err != nil {
+		// Keep the message on the source queue rather than losing it.
+		r.logger.Error("failed to apply retry policy, requeueing", "route_id", route.ID, "error", err)
+		_ = d.Nack(false, true)
+		return true
+	}
+	_ = d.Ack(false)
+	return true
+}
+
+// parkMessage declares the parking-lot queue and publishes the message to it.
+func (r *RabbitMQ) parkMessage(connName string, msg *amqp091.Delivery, queueName string) error {
+	ch, err := r.openPublishChannel(connName)
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if _, err := ch.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare parking lot queue '%s': %w", queueName, err)
+	}
+
+	return ch.Publish("", queueName, false, false, amqp091.Publishing{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    amqp091.Persistent,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	})
+}
+
+// retryCount reads the x-retry-count header, which is 0 for first deliveries.
+func retryCount(headers amqp091.Table) int {
+	switch v := headers[retryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int8:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// retryDelay returns the exponential backoff in seconds for the given attempt, capped at maxRetryBackoff.
+func retryDelay(baseSeconds, attempt int) int {
+	if baseSeconds <= 0 {
+		baseSeconds = 1
+	}
+	delay := time.Duration(baseSeconds) * time.Second
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return int(delay / time.Second)
+}
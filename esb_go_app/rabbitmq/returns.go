@@ -0,0 +1,71 @@
+package rabbitmq
+
+import (
+	"esb-go-app/metrics"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// watchReturns handles the basic.return replies of a channel that publishes with mandatory set.
+// The broker returns a mandatory message it could not route to any queue, which would otherwise
+// disappear without a trace. The watcher stops when the channel closes.
+func (r *RabbitMQ) watchReturns(connName string, ch *amqp091.Channel) {
+	returns := ch.NotifyReturn(make(chan amqp091.Return, 16))
+	go func() {
+		for ret := range returns {
+			r.handleReturn(connName, ret)
+		}
+	}()
+}
+
+// handleReturn logs and counts a returned message and, when store_returned_messages is enabled,
+// keeps it in the unroutable queue so it can be inspected and replayed.
+func (r *RabbitMQ) handleReturn(connName string, ret amqp091.Return) {
+	r.logger.Error("message returned by broker as unroutable", "connection", connName, "exchange", ret.Exchange,
+		"routing_key", ret.RoutingKey, "reply_code", ret.ReplyCode, "reason", ret.ReplyText, "msgId", ret.MessageId)
+	metrics.ReturnedMessages.WithLabelValues(connName, ret.Exchange).Inc()
+
+	if r.cfg == nil || !r.cfg.StoreReturnedMessages {
+		return
+	}
+	if err := r.storeReturned(connName, ret); err != nil {
+		r.logger.Error("failed to store returned message", "connection", connName, "exchange", ret.Exchange, "msgId", ret.MessageId, "error", err)
+	}
+}
+
+// storeReturned publishes a returned message to the unroutable queue, recording the exchange and the
+// reason in the same headers the parking lot uses. The routing key is kept as it was.
+func (r *RabbitMQ) storeReturned(connName string, ret amqp091.Return) error {
+	if err := r.ensureUnroutableCapture(connName); err != nil {
+		return err
+	}
+	ch, err := r.openPublishChannel(connName)
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	headers := amqp091.Table{}
+	for k, v := range ret.Headers {
+		headers[k] = v
+	}
+	headers[originalExchangeHeader] = ret.Exchange
+	headers[lastErrorHeader] = ret.ReplyText
+
+	return ch.Publish(UnroutableExchange, ret.RoutingKey, false, false, amqp091.Publishing{
+		Headers:         headers,
+		ContentType:     ret.ContentType,
+		ContentEncoding: ret.ContentEncoding,
+		DeliveryMode:    amqp091.Persistent,
+		Priority:        ret.Priority,
+		CorrelationId:   ret.CorrelationId,
+		ReplyTo:         ret.ReplyTo,
+		Expiration:      ret.Expiration,
+		MessageId:       ret.MessageId,
+		Timestamp:       ret.Timestamp,
+		Type:            ret.Type,
+		UserId:          ret.UserId,
+		AppId:           ret.AppId,
+		Body:            ret.Body,
+	})
+}
@@ -0,0 +1,101 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"esb-go-app/storage"
+)
+
+// routeStatsFlushInterval is how often the delivery counters of the routers are added to the route
+// statistics in the database.
+const routeStatsFlushInterval = 30 * time.Second
+
+// routeCounters are the delivery outcomes of a route counted since the last flush.
+type routeCounters struct {
+	routed, filtered, failed int64
+	lastMessageAt            time.Time
+}
+
+// countDelivery counts the outcome of a delivery for the statistics of its route.
+func (r *RabbitMQ) countDelivery(routeID string, outcome storage.DeliveryOutcome, at time.Time) {
+	r.routeCountersMu.Lock()
+	defer r.routeCountersMu.Unlock()
+
+	counters, ok := r.routeCounters[routeID]
+	if !ok {
+		counters = &routeCounters{}
+		r.routeCounters[routeID] = counters
+	}
+	switch outcome {
+	case storage.DeliveryRouted:
+		counters.routed++
+	case storage.DeliveryFiltered, storage.DeliverySkipped:
+		counters.filtered++
+	case storage.DeliveryFailed:
+		counters.failed++
+	}
+	if at.After(counters.lastMessageAt) {
+		counters.lastMessageAt = at
+	}
+}
+
+// flushRouteStats adds the counters of the routers to the route statistics. Counters the database could
+// not take are kept for the next flush.
+func (r *RabbitMQ) flushRouteStats() {
+	r.routeCountersMu.Lock()
+	pending := r.routeCounters
+	r.routeCounters = make(map[string]*routeCounters)
+	r.routeCountersMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	stats := make([]storage.RouteStats, 0, len(pending))
+	for routeID, counters := range pending {
+		stats = append(stats, storage.RouteStats{
+			RouteID:       routeID,
+			Routed:        counters.routed,
+			Filtered:      counters.filtered,
+			Failed:        counters.failed,
+			LastMessageAt: counters.lastMessageAt,
+		})
+	}
+	if err := r.dataStore.AddRouteStats(stats); err != nil {
+		r.logger.Error("failed to store route statistics, keeping them for the next flush", "routes", len(stats), "error", err)
+		r.routeCountersMu.Lock()
+		for routeID, counters := range pending {
+			if current, ok := r.routeCounters[routeID]; ok {
+				counters.routed += current.routed
+				counters.filtered += current.filtered
+				counters.failed += current.failed
+				if current.lastMessageAt.After(counters.lastMessageAt) {
+					counters.lastMessageAt = current.lastMessageAt
+				}
+			}
+			r.routeCounters[routeID] = counters
+		}
+		r.routeCountersMu.Unlock()
+	}
+}
+
+// StartRouteStatsFlusher starts the job that periodically stores the delivery counters of the routers.
+// The counters left when the service stops are stored by Close.
+func (r *RabbitMQ) StartRouteStatsFlusher() {
+	ctx, ok := r.registerWorker("route-stats-flusher")
+	if !ok {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(routeStatsFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.flushRouteStats()
+			}
+		}
+	}()
+}
@@ -3,24 +3,39 @@ package rabbitmq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"esb-go-app/metrics"
+	"esb-go-app/scripting"
 	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
 )
 
+// MaxRouteConcurrency bounds the number of competing consumers a single route may run.
+const MaxRouteConcurrency = 64
+
 // StartRouter starts a worker for a specific route.
 // sourceID is either a channel ID or a collector ID prefixed with "collector-output:"
+// The worker runs as many competing consumers on the source queue as the route's concurrency asks for.
+// Disabled routes are not started.
 func (r *RabbitMQ) StartRouter(routeID, routeName, sourceID string) {
 	workerKey := "router-" + routeID
-	if r.workers[workerKey] {
+	if r.isWorkerRunning(workerKey) {
 		r.logger.Warn("router worker already started, skipping", "route_id", routeID)
 		return
 	}
+	if route, err := r.dataStore.GetRouteByID(routeID); err == nil && route != nil && route.Disabled {
+		r.logger.Info("route is disabled, router not started", "route_id", routeID)
+		return
+	}
 
 	var sourceQueue string
+	sourceConn := DefaultConnection // Collectors always publish on the default connection
+	maxPriority := 0
 	isFanout := false
 
 	// Determine source type and fanout mode
@@ -31,7 +46,7 @@ func (r *RabbitMQ) StartRouter(routeID, routeName, sourceID string) {
 		r.logger.Info("starting ROUTER from collector (fanout mode)", "route_id", routeID, "from_exchange", sourceExchange)
 
 		sourceQueue = fmt.Sprintf("route_fanout_queue_for_%s_%s", routeName, routeID)
-		if err := r.setupFanoutSubscription(sourceExchange, sourceQueue); err != nil {
+		if err := r.setupFanoutSubscription(sourceConn, sourceExchange, sourceQueue, maxPriority); err != nil {
 			r.logger.Error("failed to setup fanout route topology for collector", "route_id", routeID, "exchange", sourceExchange, "error", err)
 			return
 		}
@@ -43,12 +58,14 @@ func (r *RabbitMQ) StartRouter(routeID, routeName, sourceID string) {
 			return
 		}
 
+		sourceConn = ChannelConnection(sourceChannel)
+		maxPriority = sourceChannel.MaxPriority
 		isFanout = sourceChannel.FanoutMode
 		if isFanout {
 			sourceExchange := "durable_exchange_for_" + sourceChannel.Destination
 			sourceQueue = fmt.Sprintf("route_fanout_queue_for_%s_%s", routeName, routeID)
 			r.logger.Info("starting ROUTER from channel (fanout mode)", "route_id", routeID, "from_exchange", sourceExchange)
-			if err := r.setupFanoutSubscription(sourceExchange, sourceQueue); err != nil {
+			if err := r.setupFanoutSubscription(sourceConn, sourceExchange, sourceQueue, maxPriority); err != nil {
 				r.logger.Error("failed to setup fanout route topology for channel", "route_id", routeID, "exchange", sourceExchange, "error", err)
 				return
 			}
@@ -58,48 +75,97 @@ func (r *RabbitMQ) StartRouter(routeID, routeName, sourceID string) {
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	r.stoppersMu.Lock()
-	r.stoppers[workerKey] = cancel
-	r.stoppersMu.Unlock()
+	concurrency := 1
+	var limiter *tokenBucket
+	if route, err := r.dataStore.GetRouteByID(routeID); err == nil && route != nil {
+		if route.Concurrency > 1 {
+			concurrency = route.Concurrency
+		}
+		if route.RateLimit > 0 {
+			// One bucket for all consumers keeps the limit per route rather than per consumer.
+			limiter = newTokenBucket(route.RateLimit)
+		}
+		if route.RequestReply && route.DestinationChannelID != nil {
+			// Replies arriving while the route restarts are relayed without waiting for the next request.
+			if destChannel, err := r.dataStore.GetChannelByID(*route.DestinationChannelID); err == nil && destChannel != nil {
+				if err := r.ensureReplyListener(routeID, ChannelConnection(destChannel), ReplyQueue(routeName, routeID)); err != nil {
+					r.logger.Error("failed to start reply listener", "route_id", routeID, "error", err)
+				}
+			}
+		}
+	}
 
-	r.workers[workerKey] = true
-	metrics.ActiveWorkers.WithLabelValues("router").Inc()
+	ctx, ok := r.registerWorker(workerKey)
+	if !ok {
+		r.logger.Warn("router worker already started, skipping", "route_id", routeID)
+		return
+	}
 
-	go func() {
-		defer metrics.ActiveWorkers.WithLabelValues("router").Dec()
-		for {
-			select {
-			case <-ctx.Done():
-				r.logger.Info("router worker stopping before loop", "route_id", routeID)
-				return
-			default:
-			}
+	// All consumers share the worker's context, so stopping the router stops every one of them.
+	for consumer := 1; consumer <= concurrency; consumer++ {
+		metrics.ActiveWorkers.WithLabelValues("router").Inc()
+		go r.runRouterConsumer(ctx, routeID, consumer, sourceConn, sourceQueue, concurrency > 1, limiter)
+	}
+	if concurrency > 1 {
+		r.logger.Info("router started with competing consumers", "route_id", routeID, "consumers", concurrency)
+	}
+	if limiter != nil {
+		r.logger.Info("router throttled", "route_id", routeID, "messages_per_second", limiter.rate)
+	}
+}
 
-			err := r.routeMessageLoop(ctx, routeID, sourceQueue)
-			if err != nil {
-				if ctx.Err() == context.Canceled {
-					r.logger.Info("router worker gracefully stopped.", "route_id", routeID)
-					return
-				}
-				r.logger.Error("router worker failed, restarting...", "route_id", routeID, "error", err)
-				metrics.ErrorsTotal.WithLabelValues("router").Inc()
-			}
+// runRouterConsumer runs one consumer of a router, restarting the message loop after failures until ctx is cancelled.
+// limiter is the route's shared rate limit, nil when the route is not throttled. Outside the route's
+// activity window the consumer is cancelled, so waiting messages stay in the queue until the window opens.
+func (r *RabbitMQ) runRouterConsumer(ctx context.Context, routeID string, consumer int, sourceConn, sourceQueue string, competing bool, limiter *tokenBucket) {
+	defer metrics.ActiveWorkers.WithLabelValues("router").Dec()
+	consumerTag := fmt.Sprintf("esb-router-%s-%d", routeID, consumer)
+	window := r.routeActivityWindow(routeID) // Updating a route restarts its router
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("router worker stopping before loop", "route_id", routeID, "consumer", consumer)
+			return
+		default:
+		}
 
-			select {
-			case <-time.After(5 * time.Second):
-			case <-ctx.Done():
-				r.logger.Info("router worker stopping during backoff.", "route_id", routeID)
+		loopCtx, cancel := ctx, context.CancelFunc(func() {})
+		if window != nil {
+			if err := r.awaitActivityWindow(ctx, routeID, window); err != nil {
+				r.logger.Info("router worker stopping while paused", "route_id", routeID, "consumer", consumer)
+				return
+			}
+			loopCtx, cancel = context.WithDeadline(ctx, window.NextClose(time.Now()))
+		}
+		err := r.routeMessageLoop(loopCtx, routeID, consumerTag, sourceConn, sourceQueue, competing, limiter)
+		windowClosed := ctx.Err() == nil && loopCtx.Err() == context.DeadlineExceeded
+		cancel()
+		if windowClosed {
+			r.logger.Debug("route activity window closed, stopping consumer", "route_id", routeID, "consumer", consumer)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == context.Canceled {
+				r.logger.Info("router worker gracefully stopped.", "route_id", routeID, "consumer", consumer)
 				return
 			}
+			r.logger.Error("router worker failed, restarting...", "route_id", routeID, "consumer", consumer, "error", err)
+			metrics.ErrorsTotal.WithLabelValues("router").Inc()
+		}
+
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			r.logger.Info("router worker stopping during backoff.", "route_id", routeID, "consumer", consumer)
+			return
 		}
-	}()
+	}
 }
 
 // setupFanoutSubscription ensures a unique queue exists and is bound to a fanout exchange.
-// This is used for collectors and channels in FanoutMode.
-func (r *RabbitMQ) setupFanoutSubscription(exchangeName, queueName string) error {
-	ch, err := r.conn.Channel()
+// This is used for collectors and channels in FanoutMode. The queue inherits the source channel's max priority.
+func (r *RabbitMQ) setupFanoutSubscription(connName, exchangeName, queueName string, maxPriority int) error {
+	ch, err := r.openChannel(connName)
 	if err != nil {
 		return fmt.Errorf("could not open channel: %w", err)
 	}
@@ -107,15 +173,8 @@ func (r *RabbitMQ) setupFanoutSubscription(exchangeName, queueName string) error
 
 	// 1. Declare the fanout exchange (idempotent)
 	// This ensures it exists, whether it's from a collector or a durable channel topology.
-	err = ch.ExchangeDeclare(
-		exchangeName,
-		"fanout", // Fanout for broadcast to all listening routes
-		true,     // durable
-		false,    // auto-delete
-		false,    // internal
-		false,    // no-wait
-		nil,      // arguments
-	)
+	// Fanout for broadcast to all listening routes, with the same arguments as every durable exchange.
+	err = r.declareDurableExchange(connName, exchangeName)
 	if err != nil {
 		return fmt.Errorf("failed to declare fanout exchange '%s': %w", exchangeName, err)
 	}
@@ -127,7 +186,7 @@ func (r *RabbitMQ) setupFanoutSubscription(exchangeName, queueName string) error
 		false, // delete when unused
 		false, // exclusive
 		false, // no-wait
-		nil,   // arguments
+		priorityQueueArgs(maxPriority),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to declare subscription queue '%s': %w", queueName, err)
@@ -149,17 +208,47 @@ func (r *RabbitMQ) setupFanoutSubscription(exchangeName, queueName string) error
 	return nil
 }
 
-// routeMessageLoop is the core logic for routing a single message.
-func (r *RabbitMQ) routeMessageLoop(ctx context.Context, routeID, sourceQueue string) error {
-	ch, err := r.conn.Channel()
-	if err != nil {
-		return fmt.Errorf("could not open channel: %w", err)
+// routeMessageLoop is the core logic for routing a single message. The consumer re-establishes itself when
+// the broker closes its channel; the loop only returns on setup failures and when ctx is cancelled.
+// Messages are consumed on the source connection and republished on the destination channel's connection.
+// Routes with a batch size above one are handed over to routeBatchLoop, resequencing routes to
+// routeResequenceLoop. Competing consumers of the same route use a prefetch of one message so the broker
+// spreads the deliveries between them; throttled routes do the same so that waiting messages stay in the
+// queue instead of the consumer buffer.
+func (r *RabbitMQ) routeMessageLoop(ctx context.Context, routeID, consumerTag, sourceConn, sourceQueue string, competing bool, limiter *tokenBucket) error {
+	// The batch size and resequencing are read once per loop; updating a route restarts its router.
+	batchSize := 1
+	prefetch := 0
+	resequenceKey := ""
+	var window time.Duration
+	route, err := r.dataStore.GetRouteByID(routeID)
+	if err == nil && route != nil && route.ResequenceKey != "" {
+		resequenceKey = route.ResequenceKey
+		window = resequenceWindow(route)
+		// The messages waiting for a gap to fill are held unacknowledged.
+		prefetch = MaxResequenceBuffer
+	} else if err == nil && route != nil && route.BatchSize > 1 {
+		batchSize = route.BatchSize
+		// Prefetch a full batch so it can be collected before anything is acknowledged.
+		prefetch = batchSize
+	} else if competing || limiter != nil {
+		prefetch = 1
 	}
-	defer ch.Close()
 
-	msgs, err := ch.ConsumeWithContext(ctx, sourceQueue, "", false, false, false, false, nil)
+	consumer, err := r.newConsumerChannel(ctx, sourceConn, sourceQueue, consumerTag, prefetch, nil)
 	if err != nil {
-		return fmt.Errorf("failed to register a consumer for '%s': %w", sourceQueue, err)
+		return err
+	}
+	defer consumer.Close()
+	msgs := consumer.Deliveries()
+
+	if batchSize > 1 {
+		r.logger.Info("router consuming in batches", "route_id", routeID, "batch_size", batchSize)
+		return r.routeBatchLoop(ctx, routeID, sourceConn, sourceQueue, msgs, batchSize, limiter)
+	}
+	if resequenceKey != "" {
+		r.logger.Info("router resequencing messages", "route_id", routeID, "resequence_key", resequenceKey, "window", window.String())
+		return r.routeResequenceLoop(ctx, routeID, sourceConn, sourceQueue, msgs, resequenceKey, window, limiter)
 	}
 
 	for {
@@ -170,102 +259,365 @@ func (r *RabbitMQ) routeMessageLoop(ctx context.Context, routeID, sourceQueue st
 			if !ok {
 				return fmt.Errorf("consumer channel for '%s' closed", sourceQueue)
 			}
-
-			var route *storage.Route
-			var getRouteErr error
-			// Use a simple retry mechanism for fetching route details
-			for i := 0; i < 3; i++ {
-				route, getRouteErr = r.dataStore.GetRouteByID(routeID)
-				if getRouteErr == nil && route != nil {
-					break
-				}
-				time.Sleep(100 * time.Millisecond)
+			// Throttling delays consumption; the unacknowledged delivery returns to the queue if the router stops.
+			if err := limiter.wait(ctx); err != nil {
+				return err
 			}
 
-			if getRouteErr != nil || route == nil {
-				r.logger.Error("failed to get route details after retries, requeueing", "route_id", routeID, "error", getRouteErr)
+			route, err := r.loadRoute(routeID)
+			if err != nil {
+				r.logger.Error("failed to get route details after retries, requeueing", "route_id", routeID, "error", err)
 				_ = d.Nack(false, true)
 				continue
 			}
 
-			if route.DestinationChannelID == nil || *route.DestinationChannelID == "" {
-				r.logger.Error("route has no destination channel, dead-lettering", "route_id", routeID)
-				_ = d.Nack(false, false)
-				continue
+			if r.routeDelivery(ctx, route, &d, sourceConn, sourceQueue, nil) {
+				_ = d.Ack(false)
 			}
-			destChannel, err := r.dataStore.GetChannelByID(*route.DestinationChannelID)
-			if err != nil || destChannel == nil {
-				r.logger.Error("failed to get destination channel for route, requeueing", "route_id", routeID, "error", err)
-				_ = d.Nack(false, true)
-				continue
+		}
+	}
+}
+
+// loadRoute fetches a route, retrying briefly to ride out transient database errors.
+func (r *RabbitMQ) loadRoute(routeID string) (*storage.Route, error) {
+	var route *storage.Route
+	var err error
+	// Use a simple retry mechanism for fetching route details
+	for i := 0; i < 3; i++ {
+		route, err = r.dataStore.GetRouteByID(routeID)
+		if err == nil && route != nil {
+			return route, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err == nil {
+		err = fmt.Errorf("route %s not found", routeID)
+	}
+	return nil, err
+}
+
+// scriptContext describes the route to its transformation scripts. Lookup failures only leave the
+// names empty: the context is informational and must not fail the delivery.
+func (r *RabbitMQ) scriptContext(route *storage.Route, destChannel *storage.Channel, batch *routeBatch) *scripting.ScriptContext {
+	scriptContext := &scripting.ScriptContext{RouteID: route.ID, RouteName: route.Name, DestinationChannel: destChannel.Name}
+	if collectorID, ok := strings.CutPrefix(route.SourceChannelID, "collector-output:"); ok {
+		scriptContext.CollectorID = collectorID
+		if collector, err := r.dataStore.GetCollectorByID(collectorID); err == nil && collector != nil {
+			scriptContext.CollectorName = collector.Name
+		}
+	} else if source, err := batch.destinationChannel(r, route.SourceChannelID); err == nil && source != nil {
+		scriptContext.SourceChannel = source.Name
+	}
+	return scriptContext
+}
+
+// routeDelivery transforms and republishes one delivery of a route. It returns true when the delivery
+// should be acknowledged by the caller (routed, filtered or skipped); in every other case the delivery
+// has already been rejected or handed to the retry policy. batch is nil for unbatched consumption.
+// While the circuit breaker of the destination is open the delivery is held back, pausing the route.
+// Every outcome is counted in the route statistics, and routes with archiving on store every delivery
+// with its outcome in the message archive.
+func (r *RabbitMQ) routeDelivery(ctx context.Context, route *storage.Route, d *amqp091.Delivery, sourceConn, sourceQueue string, batch *routeBatch) bool {
+	routeID := route.ID
+	applyTransform := route.RouteType == "transform"
+	applyEnrich := route.RouteType == "enrich"
+	delivery := r.startDelivery(route, d, sourceQueue)
+	defer r.finishDelivery(&delivery)
+	r.wiretapMessage(route, d, WiretapPre, sourceQueue, batch)
+	if len(route.GuardConditions) > 0 {
+		matched, err := matchGuardConditions(route.GuardConditions, d.Headers)
+		if err != nil {
+			r.logger.Error("failed to evaluate route guard conditions, dead-lettering", "route_id", routeID, "error", err)
+			delivery.failed(err)
+			r.rejectDelivery(route, d, sourceQueue, err)
+			return false
+		}
+		if !matched {
+			if route.GuardMismatchAction != "forward" {
+				r.logger.Info("route guard conditions not met, message skipped", "route_id", routeID, "msgId", d.MessageId)
+				delivery.skipped()
+				return true
 			}
+			r.logger.Debug("route guard conditions not met, forwarding without transformation", "route_id", routeID, "msgId", d.MessageId)
+			applyTransform = false
+			applyEnrich = false
+		}
+	}
 
-			finalDestExchange := "durable_exchange_for_" + destChannel.Destination
-			finalBody := d.Body // Default to original body
+	if route.DestinationChannelID == nil || *route.DestinationChannelID == "" {
+		r.logger.Error("route has no destination channel, dead-lettering", "route_id", routeID)
+		delivery.failed(errors.New("route has no destination channel"))
+		r.rejectDelivery(route, d, sourceQueue, errors.New("route has no destination channel"))
+		return false
+	}
+	destChannel, err := batch.destinationChannel(r, *route.DestinationChannelID)
+	if err != nil || destChannel == nil {
+		r.logger.Error("failed to get destination channel for route, requeueing", "route_id", routeID, "error", err)
+		delivery.failed(fmt.Errorf("destination channel lookup failed: %v", err))
+		if !r.retryOrPark(route, d, sourceConn, sourceQueue, fmt.Errorf("destination channel lookup failed: %v", err), false) {
+			_ = d.Nack(false, true)
+		}
+		return false
+	}
 
-			if route.RouteType == "transform" {
-				r.logger.Debug("performing transformation for route", "route_id", routeID)
+	finalDestExchange := "durable_exchange_for_" + destChannel.Destination
+	finalBody := d.Body                 // Default to original body
+	var appliedTransformations []string // Names of the scripts run, recorded in the trace
+	var scriptPriority *int
+	var scriptHeaders amqp091.Table
+	var scriptProperties []scripting.MessageProperties // Properties returned by each step, applied in order
+	scriptDestination := false
+
+	if applyTransform {
+		r.logger.Debug("performing transformation for route", "route_id", routeID)
+
+		if route.TransformationID == nil || *route.TransformationID == "" {
+			r.logger.Error("transformation route has no transformation ID, dead-lettering", "route_id", routeID)
+			delivery.failed(errors.New("transformation route has no transformation"))
+			r.rejectDelivery(route, d, sourceQueue, errors.New("transformation route has no transformation"))
+			return false
+		}
 
-				if route.TransformationID == nil || *route.TransformationID == "" {
-					r.logger.Error("transformation route has no transformation ID, dead-lettering", "route_id", routeID)
-					_ = d.Nack(false, false)
-					continue
-				}
+		var bodyMap map[string]interface{}
+		if err := json.Unmarshal(d.Body, &bodyMap); err != nil {
+			r.logger.Error("failed to unmarshal message body for transformation, dead-lettering", "msg_id", d.MessageId, "error", err)
+			delivery.failed(err)
+			if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, true) {
+				r.rejectDelivery(route, d, sourceQueue, err)
+			}
+			return false
+		}
 
-				transform, err := r.dataStore.GetTransformationByID(*route.TransformationID)
-				if err != nil || transform == nil {
-					r.logger.Error("failed to get transformation details, dead-lettering", "transformation_id", *route.TransformationID, "error", err)
-					_ = d.Nack(false, false)
-					continue
-				}
+		headersMap := make(map[string]interface{})
+		for k, v := range d.Headers {
+			headersMap[k] = v
+		}
 
-				var bodyMap map[string]interface{}
-				if err := json.Unmarshal(d.Body, &bodyMap); err != nil {
-					r.logger.Error("failed to unmarshal message body for transformation, dead-lettering", "msg_id", d.MessageId, "error", err)
-					_ = d.Nack(false, false)
-					continue
+		// The pipeline runs the route transformation first and then the further steps in order, each
+		// working on the body and headers returned by the previous one, between the global pre and post
+		// hooks. A step that filters the message ends it.
+		var scriptDestinationName string
+		scriptContext := r.scriptContext(route, destChannel, batch)
+		steps := r.transformationSteps(route)
+		for step, transformationID := range steps {
+			transform, err := batch.transformation(r, transformationID)
+			if err != nil || transform == nil {
+				r.logger.Error("failed to get transformation details, dead-lettering", "transformation_id", transformationID, "step", step+1, "error", err)
+				delivery.failed(fmt.Errorf("transformation lookup failed: %v", err))
+				if !r.retryOrPark(route, d, sourceConn, sourceQueue, fmt.Errorf("transformation lookup failed: %v", err), false) {
+					r.rejectDelivery(route, d, sourceQueue, fmt.Errorf("transformation lookup failed: %v", err))
 				}
+				return false
+			}
 
-				headersMap := make(map[string]interface{})
-				for k, v := range d.Headers {
-					headersMap[k] = v
+			input := r.executionInput(bodyMap)
+			started := time.Now()
+			transformedMsg, err := r.scriptingService.ExecuteScript(transform.Engine, storage.TransformationStateNamespace(transform.ID), transform.Script, bodyMap, headersMap, scriptContext)
+			r.recordExecution(route, transform, d, started, input, transformedMsg, err)
+			if err != nil {
+				r.logger.Error("failed to execute transformation script, dead-lettering", "transformation_id", transform.ID, "step", step+1, "error", err)
+				delivery.failed(err)
+				if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, false) {
+					r.rejectDelivery(route, d, sourceQueue, err)
 				}
+				return false
+			}
 
-				transformedMsg, err := r.scriptingService.ExecuteScript(transform.Engine, transform.Script, bodyMap, headersMap)
-				if err != nil {
-					r.logger.Error("failed to execute transformation script, dead-lettering", "transformation_id", transform.ID, "error", err)
-					_ = d.Nack(false, false)
-					continue
-				}
+			if transformedMsg == nil || transformedMsg.Body == nil {
+				r.logger.Info("transformation script returned nil, message filtered", "route_id", routeID, "transformation_id", transform.ID, "step", step+1)
+				delivery.filtered()
+				return true // Acknowledge and drop
+			}
 
-				if transformedMsg == nil || transformedMsg.Body == nil {
-					r.logger.Info("transformation script returned nil, message filtered", "route_id", routeID, "transformation_id", transform.ID)
-					_ = d.Ack(false) // Acknowledge and drop
-					continue
-				}
+			appliedTransformations = append(appliedTransformations, transform.Name)
+			bodyMap = transformedMsg.Body
+			if transformedMsg.Headers != nil {
+				headersMap = transformedMsg.Headers
+			}
+			if transformedMsg.Priority != nil {
+				scriptPriority = transformedMsg.Priority
+			}
+			scriptProperties = append(scriptProperties, transformedMsg.Properties)
+			if transformedMsg.Destination != "" {
+				scriptDestinationName = transformedMsg.Destination
+			}
+		}
 
-				newBodyBytes, err := json.Marshal(transformedMsg.Body)
-				if err != nil {
-					r.logger.Error("failed to marshal transformed message body, dead-lettering", "msg_id", d.MessageId, "error", err)
-					_ = d.Nack(false, false)
-					continue
+		newBodyBytes, err := json.Marshal(bodyMap)
+		if err != nil {
+			r.logger.Error("failed to marshal transformed message body, dead-lettering", "msg_id", d.MessageId, "error", err)
+			delivery.failed(err)
+			if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, true) {
+				r.rejectDelivery(route, d, sourceQueue, err)
+			}
+			return false
+		}
+		finalBody = newBodyBytes
+		scriptHeaders = headersTable(headersMap)
+		if scriptDestinationName != "" {
+			// A destination chosen by a script replaces the route's destination channel.
+			scriptChannel, err := batch.scriptDestination(r, scriptDestinationName)
+			if err != nil {
+				r.logger.Error("failed to resolve the destination returned by the script, dead-lettering", "route_id", routeID, "destination", scriptDestinationName, "error", err)
+				delivery.failed(err)
+				if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, true) {
+					r.rejectDelivery(route, d, sourceQueue, err)
 				}
-				finalBody = newBodyBytes
+				return false
 			}
+			r.logger.Debug("script selected the destination channel", "route_id", routeID, "channel_id", scriptChannel.ID, "channel", scriptChannel.Name)
+			destChannel = scriptChannel
+			finalDestExchange = "durable_exchange_for_" + destChannel.Destination
+			scriptDestination = true
+		}
+	}
 
-			// Republish logic
-			republishDelivery := d
-			republishDelivery.Body = finalBody
+	if applyEnrich {
+		r.logger.Debug("enriching message for route", "route_id", routeID, "url", route.EnrichURL)
+		enrichedBody, err := enrichBody(route, d)
+		if err != nil {
+			r.logger.Error("failed to enrich message, dead-lettering", "route_id", routeID, "msg_id", d.MessageId, "error", err)
+			delivery.failed(err)
+			if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, errors.Is(err, errPermanentEnrich)) {
+				r.rejectDelivery(route, d, sourceQueue, err)
+			}
+			return false
+		}
+		finalBody = enrichedBody
+	}
 
-			err = r.republishAsDurable(&republishDelivery, finalDestExchange)
-			if err != nil {
-				r.logger.Error("failed to republish routed message, requeueing", "error", err)
+	// Routing rules choose the destination unless the script already did.
+	if !scriptDestination {
+		ruleChannel, err := r.applyRoutingRules(route, finalBody, batch)
+		if err != nil {
+			r.logger.Error("failed to apply routing rules, requeueing", "route_id", routeID, "error", err)
+			delivery.failed(err)
+			if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, false) {
 				_ = d.Nack(false, true)
-			} else {
-				r.logger.Info("message routed successfully", "from", sourceQueue, "to", finalDestExchange, "msgId", d.MessageId)
-				metrics.MessagesProcessed.WithLabelValues("router", sourceQueue, finalDestExchange).Inc()
-				_ = d.Ack(false)
 			}
+			return false
+		}
+		if ruleChannel != nil {
+			destChannel = ruleChannel
+			finalDestExchange = "durable_exchange_for_" + destChannel.Destination
+		}
+	}
+
+	if route.CanonicalizeJSON {
+		canonicalBody, err := canonicalizeJSON(finalBody)
+		if err != nil {
+			r.logger.Error("failed to canonicalize message body, dead-lettering", "route_id", routeID, "msg_id", d.MessageId, "error", err)
+			delivery.failed(err)
+			if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, true) {
+				r.rejectDelivery(route, d, sourceQueue, err)
+			}
+			return false
+		}
+		finalBody = canonicalBody
+	}
+
+	// Republish logic
+	republishDelivery := *d
+	republishDelivery.Body = finalBody
+	if scriptHeaders != nil {
+		// Headers added, replaced or removed by the scripts.
+		republishDelivery.Headers = scriptHeaders
+	}
+	for _, props := range scriptProperties {
+		applyProperties(&republishDelivery, props)
+	}
+	// A priority set by the script wins over the route priority; otherwise the original is kept.
+	if scriptPriority != nil {
+		republishDelivery.Priority = uint8(*scriptPriority)
+	} else if route.Priority > 0 {
+		republishDelivery.Priority = uint8(route.Priority)
+	}
+	// Messages published to the source exchange by other systems start their trace at the router. The
+	// trace ID is restored when a script dropped the header.
+	traceID := TraceID(d.Headers)
+	if traceID == "" {
+		traceID = ensureTraceID(&republishDelivery)
+	} else if TraceID(republishDelivery.Headers) != traceID {
+		setTraceID(&republishDelivery, traceID)
+	}
+
+	if route.RequestReply && republishDelivery.ReplyTo != "" {
+		if err := r.trackRequest(route, &republishDelivery, sourceConn, ChannelConnection(destChannel)); err != nil {
+			r.logger.Error("failed to prepare request for its reply, requeueing", "route_id", routeID, "msg_id", d.MessageId, "error", err)
+			delivery.failed(err)
+			if !r.retryOrPark(route, d, sourceConn, sourceQueue, err, false) {
+				_ = d.Nack(false, true)
+			}
+			return false
+		}
+	}
+
+	if err := r.awaitBreaker(ctx, destChannel.ID); err != nil {
+		// The router is stopping; the unacknowledged delivery returns to the queue with the channel.
+		delivery.discard()
+		return false
+	}
+	if route.DelaySeconds > 0 {
+		err = r.publishDelayed(ChannelConnection(destChannel), &republishDelivery, finalDestExchange, route.DelaySeconds)
+	} else if batch != nil {
+		err = batch.publish(r, ChannelConnection(destChannel), &republishDelivery, finalDestExchange)
+	} else {
+		err = r.republishAsDurable(ChannelConnection(destChannel), &republishDelivery, finalDestExchange)
+	}
+	r.recordPublishResult(destChannel.ID, err)
+	if err != nil {
+		r.logger.Error("failed to republish routed message, requeueing", "error", err)
+		delivery.failed(err)
+		_ = d.Nack(false, true)
+		return false
+	}
+	r.logger.Info("message routed successfully", "from", sourceQueue, "to", finalDestExchange, "msgId", d.MessageId)
+	metrics.MessagesProcessed.WithLabelValues("router", sourceQueue, finalDestExchange).Inc()
+	r.recordHop(traceID, TraceRoute, routeID, sourceQueue, finalDestExchange, &republishDelivery, appliedTransformations)
+	delivery.routed(finalDestExchange, &republishDelivery)
+	r.sampleMessage(route, &republishDelivery, sourceQueue, batch)
+	r.wiretapMessage(route, &republishDelivery, WiretapPost, sourceQueue, batch)
+	return true
+}
+
+// headersTable turns the headers returned by a transformation script into an AMQP table, converting
+// nested maps to tables so the broker can encode them.
+func headersTable(headers map[string]interface{}) amqp091.Table {
+	table := make(amqp091.Table, len(headers))
+	for k, v := range headers {
+		table[k] = headerField(v)
+	}
+	return table
+}
+
+// applyProperties sets the AMQP properties a script returned on the delivery, keeping the ones it left empty.
+func applyProperties(d *amqp091.Delivery, props scripting.MessageProperties) {
+	if props.ContentType != "" {
+		d.ContentType = props.ContentType
+	}
+	if props.MessageID != "" {
+		d.MessageId = props.MessageID
+	}
+	if props.CorrelationID != "" {
+		d.CorrelationId = props.CorrelationID
+	}
+	if props.Expiration != "" {
+		d.Expiration = props.Expiration
+	}
+}
+
+// headerField converts a header value returned by a script into a value amqp091 can encode.
+func headerField(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return headersTable(val)
+	case []interface{}:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			items[i] = headerField(item)
 		}
+		return items
+	default:
+		return v
 	}
 }
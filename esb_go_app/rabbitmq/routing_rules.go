@@ -0,0 +1,134 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"esb-go-app/storage"
+)
+
+// RoutingRuleOperators are the operators a routing rule can use, in the order the admin form lists them.
+var RoutingRuleOperators = []string{"equals", "not_equals", "contains", "regex", "exists"}
+
+// applyRoutingRules returns the destination channel of the first routing rule of the route that matches
+// the message body, or nil when the route has no rules, none matches or the body is not JSON.
+func (r *RabbitMQ) applyRoutingRules(route *storage.Route, body []byte, batch *routeBatch) (*storage.Channel, error) {
+	rules, err := batch.routingRules(r, route.ID)
+	if err != nil {
+		return nil, fmt.Errorf("routing rules lookup failed: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		r.logger.Debug("message body is not JSON, routing rules skipped", "route_id", route.ID)
+		return nil, nil
+	}
+	rule, err := matchRoutingRules(rules, doc)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return nil, nil
+	}
+
+	ch, err := batch.destinationChannel(r, rule.DestinationChannelID)
+	if err != nil {
+		return nil, fmt.Errorf("destination channel lookup failed: %w", err)
+	}
+	if ch == nil {
+		return nil, fmt.Errorf("destination channel %s of routing rule %s not found", rule.DestinationChannelID, rule.ID)
+	}
+	r.logger.Debug("routing rule matched", "route_id", route.ID, "rule_id", rule.ID, "field", rule.Field, "channel_id", ch.ID)
+	return ch, nil
+}
+
+// matchRoutingRules returns the first rule whose condition holds for the JSON body, or nil when none does.
+func matchRoutingRules(rules []storage.RoutingRule, body interface{}) (*storage.RoutingRule, error) {
+	for i := range rules {
+		matched, err := matchRoutingRule(&rules[i], body)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// matchRoutingRule evaluates a single rule. A missing field only matches "not_equals".
+func matchRoutingRule(rule *storage.RoutingRule, body interface{}) (bool, error) {
+	raw, found := lookupField(body, rule.Field)
+	if rule.Operator == "exists" {
+		return found, nil
+	}
+	if !found {
+		return rule.Operator == "not_equals", nil
+	}
+	value := fieldString(raw)
+
+	switch rule.Operator {
+	case "equals":
+		return value == rule.Value, nil
+	case "not_equals":
+		return value != rule.Value, nil
+	case "contains":
+		return strings.Contains(value, rule.Value), nil
+	case "regex":
+		re, err := compileGuardRegex(rule.Value)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(value), nil
+	default:
+		return false, fmt.Errorf("unsupported routing rule operator '%s'", rule.Operator)
+	}
+}
+
+// lookupField resolves a dotted path such as "order.lines.0.sku" in a decoded JSON document.
+// A leading "$." is accepted for JSONPath-style paths; numeric segments index arrays.
+func lookupField(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, true
+	}
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// fieldString renders a JSON value for comparison; numbers keep their JSON form, so 42 equals "42".
+func fieldString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
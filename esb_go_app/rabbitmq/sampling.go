@@ -0,0 +1,45 @@
+package rabbitmq
+
+import (
+	"esb-go-app/metrics"
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// shouldSample counts a routed message of the route and reports whether it is the Nth one to be sampled.
+func (r *RabbitMQ) shouldSample(route *storage.Route) bool {
+	if route.SampleRate <= 0 || route.SampleChannelID == "" {
+		return false
+	}
+	r.sampleMu.Lock()
+	defer r.sampleMu.Unlock()
+	r.sampleCounters[route.ID]++
+	return r.sampleCounters[route.ID]%uint64(route.SampleRate) == 0
+}
+
+// sampleMessage copies 1 of every SampleRate routed messages, as published to the destination, to the
+// route's sample channel. Sampling is best effort: a failed copy is logged and never affects the delivery.
+func (r *RabbitMQ) sampleMessage(route *storage.Route, msg *amqp091.Delivery, sourceQueue string, batch *routeBatch) {
+	if !r.shouldSample(route) {
+		return
+	}
+	sampleChannel, err := batch.destinationChannel(r, route.SampleChannelID)
+	if err != nil || sampleChannel == nil {
+		r.logger.Warn("failed to get sample channel for route, sample dropped", "route_id", route.ID, "sample_channel_id", route.SampleChannelID, "error", err)
+		return
+	}
+
+	sampleExchange := "durable_exchange_for_" + sampleChannel.Destination
+	if batch != nil {
+		err = batch.publish(r, ChannelConnection(sampleChannel), msg, sampleExchange)
+	} else {
+		err = r.republishAsDurable(ChannelConnection(sampleChannel), msg, sampleExchange)
+	}
+	if err != nil {
+		r.logger.Warn("failed to publish sampled message, sample dropped", "route_id", route.ID, "to", sampleExchange, "error", err)
+		return
+	}
+	r.logger.Debug("message sampled", "route_id", route.ID, "to", sampleExchange, "msgId", msg.MessageId)
+	metrics.MessagesProcessed.WithLabelValues("sampler", sourceQueue, sampleExchange).Inc()
+}
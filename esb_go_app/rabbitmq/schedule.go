@@ -0,0 +1,161 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ActivityWindow is the part of the day a route consumes messages in, e.g. "22:00-06:00" for a heavy
+// synchronization that runs off-hours. It is made of one or more daily spans in the server's local time;
+// a span ending before it starts runs over midnight.
+type ActivityWindow struct {
+	spans []windowSpan
+}
+
+// windowSpan is one daily span, in minutes since midnight.
+type windowSpan struct {
+	start, end int
+}
+
+// ParseActivityWindow parses comma-separated "HH:MM-HH:MM" spans. An empty spec returns nil, which
+// means the route is always active.
+func ParseActivityWindow(spec string) (*ActivityWindow, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	w := &ActivityWindow{}
+	for _, part := range strings.Split(spec, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, fmt.Errorf("span %q must look like HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("span %q is empty", part)
+		}
+		w.spans = append(w.spans, windowSpan{start: start, end: end})
+	}
+	return w, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether the span covers the given minute of the day.
+func (s windowSpan) contains(minute int) bool {
+	if s.start < s.end {
+		return minute >= s.start && minute < s.end
+	}
+	return minute >= s.start || minute < s.end
+}
+
+// Active reports whether t falls into the window.
+func (w *ActivityWindow) Active(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, s := range w.spans {
+		if s.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns the earliest start of a span after t.
+func (w *ActivityWindow) NextOpen(t time.Time) time.Time {
+	var next time.Time
+	for _, s := range w.spans {
+		open := atMinute(t, s.start)
+		if !open.After(t) {
+			open = atMinute(t.AddDate(0, 0, 1), s.start)
+		}
+		if next.IsZero() || open.Before(next) {
+			next = open
+		}
+	}
+	return next
+}
+
+// NextClose returns when the window closes for an active t: the latest end of the spans covering t.
+// Overlapping spans are not chained; the router briefly reconnects when the next span takes over.
+func (w *ActivityWindow) NextClose(t time.Time) time.Time {
+	minute := t.Hour()*60 + t.Minute()
+	var next time.Time
+	for _, s := range w.spans {
+		if !s.contains(minute) {
+			continue
+		}
+		end := atMinute(t, s.end)
+		if s.start > s.end && minute >= s.start {
+			end = atMinute(t.AddDate(0, 0, 1), s.end)
+		}
+		if end.After(next) {
+			next = end
+		}
+	}
+	return next
+}
+
+// String returns the window in the notation it is configured with.
+func (w *ActivityWindow) String() string {
+	parts := make([]string, len(w.spans))
+	for i, s := range w.spans {
+		parts[i] = fmt.Sprintf("%02d:%02d-%02d:%02d", s.start/60, s.start%60, s.end/60, s.end%60)
+	}
+	return strings.Join(parts, ",")
+}
+
+// atMinute returns the given minute of the day of t, in the location of t.
+func atMinute(t time.Time, minute int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), minute/60, minute%60, 0, 0, t.Location())
+}
+
+// routeActivityWindow reads the activity window of a route. A window that cannot be parsed is logged
+// and ignored so that a bad value in the database does not stop the route for good.
+func (r *RabbitMQ) routeActivityWindow(routeID string) *ActivityWindow {
+	route, err := r.dataStore.GetRouteByID(routeID)
+	if err != nil || route == nil {
+		return nil
+	}
+	window, err := ParseActivityWindow(route.ActiveWindow)
+	if err != nil {
+		r.logger.Error("invalid route activity window, the route stays always active", "route_id", routeID, "active_window", route.ActiveWindow, "error", err)
+		return nil
+	}
+	return window
+}
+
+// awaitActivityWindow blocks until the window is open or ctx is done.
+func (r *RabbitMQ) awaitActivityWindow(ctx context.Context, routeID string, window *ActivityWindow) error {
+	now := time.Now()
+	if window.Active(now) {
+		return nil
+	}
+	opens := window.NextOpen(now)
+	r.logger.Info("route outside its activity window, consumption paused", "route_id", routeID, "active_window", window.String(), "resumes_at", opens.Format(time.RFC3339))
+	select {
+	case <-time.After(time.Until(opens)):
+		r.logger.Info("route activity window opened, resuming consumption", "route_id", routeID, "active_window", window.String())
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
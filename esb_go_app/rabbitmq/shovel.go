@@ -0,0 +1,216 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxShovelMessages bounds the number of messages a single shovel job may move.
+const MaxShovelMessages = 100000
+
+// maxFinishedShovels is how many finished shovel jobs are kept for the maintenance page.
+const maxFinishedShovels = 20
+
+// ShovelJob is a maintenance job that moves messages from a queue to an exchange, e.g. from a
+// misconfigured destination back to the correct one. Messages are acknowledged on the source queue
+// only after the destination broker confirmed them, so an interrupted job never loses messages.
+type ShovelJob struct {
+	ID             string
+	Connection     string // Connection of the source queue
+	SourceQueue    string
+	DestConnection string // Connection of the destination exchange
+	DestExchange   string
+	Limit          int
+	Moved          int
+	Running        bool
+	Error          string
+	StartedAt      time.Time
+	FinishedAt     time.Time
+}
+
+// shovelWorkerKey builds the worker registry key of a shovel job.
+func shovelWorkerKey(id string) string {
+	return "shovel-" + id
+}
+
+// StartShovel checks that the source queue and the destination exchange exist and starts moving
+// up to limit messages in the background. It returns the ID of the job.
+func (r *RabbitMQ) StartShovel(connName, sourceQueue, destConn, destExchange string, limit int) (string, error) {
+	if limit <= 0 || limit > MaxShovelMessages {
+		return "", fmt.Errorf("message count must be between 1 and %d", MaxShovelMessages)
+	}
+	if err := r.checkQueueExists(connName, sourceQueue); err != nil {
+		return "", err
+	}
+	if err := r.checkExchangeExists(destConn, destExchange); err != nil {
+		return "", err
+	}
+
+	job := &ShovelJob{
+		ID:             uuid.New().String(),
+		Connection:     connName,
+		SourceQueue:    sourceQueue,
+		DestConnection: destConn,
+		DestExchange:   destExchange,
+		Limit:          limit,
+		Running:        true,
+		StartedAt:      time.Now(),
+	}
+	ctx, ok := r.registerWorker(shovelWorkerKey(job.ID))
+	if !ok {
+		return "", fmt.Errorf("shovel job %s is already running", job.ID)
+	}
+
+	r.stoppersMu.Lock()
+	r.shovels[job.ID] = job
+	r.pruneShovelsLocked()
+	r.stoppersMu.Unlock()
+
+	go r.runShovel(ctx, job)
+	return job.ID, nil
+}
+
+// CancelShovel stops a running shovel job; messages moved so far stay at the destination.
+func (r *RabbitMQ) CancelShovel(id string) bool {
+	return r.stopWorker(shovelWorkerKey(id))
+}
+
+// ShovelJobs returns a snapshot of the running and recently finished shovel jobs, newest first.
+func (r *RabbitMQ) ShovelJobs() []ShovelJob {
+	r.stoppersMu.Lock()
+	defer r.stoppersMu.Unlock()
+
+	jobs := make([]ShovelJob, 0, len(r.shovels))
+	for _, job := range r.shovels {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	return jobs
+}
+
+// pruneShovelsLocked drops the oldest finished jobs beyond maxFinishedShovels. stoppersMu must be held.
+func (r *RabbitMQ) pruneShovelsLocked() {
+	var finished []*ShovelJob
+	for _, job := range r.shovels {
+		if !job.Running {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedShovels {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt.Before(finished[j].StartedAt) })
+	for _, job := range finished[:len(finished)-maxFinishedShovels] {
+		delete(r.shovels, job.ID)
+	}
+}
+
+// runShovel moves messages one at a time until the limit is reached, the queue is empty or the job is cancelled.
+func (r *RabbitMQ) runShovel(ctx context.Context, job *ShovelJob) {
+	r.logger.Info("shovel job started", "job_id", job.ID, "connection", job.Connection, "queue", job.SourceQueue,
+		"destination_connection", job.DestConnection, "exchange", job.DestExchange, "limit", job.Limit)
+
+	moved, err := r.shovelMessages(ctx, job)
+
+	r.stopWorker(shovelWorkerKey(job.ID))
+	r.stoppersMu.Lock()
+	job.Moved = moved
+	job.Running = false
+	job.FinishedAt = time.Now()
+	if err != nil {
+		job.Error = err.Error()
+	}
+	r.stoppersMu.Unlock()
+
+	if err != nil {
+		r.logger.Error("shovel job failed", "job_id", job.ID, "moved", moved, "error", err)
+		return
+	}
+	r.logger.Info("shovel job finished", "job_id", job.ID, "moved", moved)
+}
+
+// shovelMessages does the work of runShovel and returns the number of moved messages.
+func (r *RabbitMQ) shovelMessages(ctx context.Context, job *ShovelJob) (int, error) {
+	src, err := r.openChannel(job.Connection)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open source channel: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := r.openPublishChannel(job.DestConnection)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open destination channel: %w", err)
+	}
+	defer dst.Close()
+	if err := dst.Confirm(false); err != nil {
+		return 0, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	moved := 0
+	for moved < job.Limit {
+		if ctx.Err() != nil {
+			return moved, fmt.Errorf("cancelled")
+		}
+
+		d, ok, err := src.Get(job.SourceQueue, false)
+		if err != nil {
+			return moved, fmt.Errorf("failed to get message from '%s': %w", job.SourceQueue, err)
+		}
+		if !ok {
+			break // The queue is empty
+		}
+
+		confirmation, err := dst.PublishWithDeferredConfirm(job.DestExchange, "", false, false, durablePublishing(&d))
+		if err != nil {
+			_ = d.Nack(false, true)
+			return moved, fmt.Errorf("failed to publish to '%s': %w", job.DestExchange, err)
+		}
+		if !confirmation.Wait() {
+			_ = d.Nack(false, true)
+			return moved, fmt.Errorf("destination broker rejected message %d", moved+1)
+		}
+		if err := d.Ack(false); err != nil {
+			// The message is already at the destination and will be delivered again from the source.
+			return moved, fmt.Errorf("failed to acknowledge moved message: %w", err)
+		}
+
+		moved++
+		r.stoppersMu.Lock()
+		job.Moved = moved
+		r.stoppersMu.Unlock()
+		if moved%1000 == 0 {
+			r.logger.Info("shovel job progress", "job_id", job.ID, "moved", moved, "limit", job.Limit)
+		}
+	}
+	return moved, nil
+}
+
+// checkQueueExists passively declares a queue, which fails when it does not exist.
+func (r *RabbitMQ) checkQueueExists(connName, queueName string) error {
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+	if _, err := ch.QueueDeclarePassive(queueName, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("queue '%s' not found: %w", queueName, err)
+	}
+	return nil
+}
+
+// checkExchangeExists passively declares an exchange, which fails when it does not exist.
+func (r *RabbitMQ) checkExchangeExists(connName, exchangeName string) error {
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+	if err := ch.ExchangeDeclarePassive(exchangeName, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("exchange '%s' not found: %w", exchangeName, err)
+	}
+	return nil
+}
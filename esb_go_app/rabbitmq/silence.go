@@ -0,0 +1,101 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"esb-go-app/metrics"
+	"esb-go-app/storage"
+)
+
+// silenceCheckInterval is how often the channels with a silence alert are checked.
+const silenceCheckInterval = time.Minute
+
+// recordChannelActivity notes that the worker of a channel destination has just seen a message.
+func (r *RabbitMQ) recordChannelActivity(direction, connName, baseName string) {
+	now := time.Now()
+	r.activityMu.Lock()
+	r.lastActivity[channelWorkerKey(direction, connName, baseName)] = now
+	r.activityMu.Unlock()
+
+	if connName == "" {
+		connName = DefaultConnection
+	}
+	metrics.ChannelLastMessage.WithLabelValues(connName, baseName).Set(float64(now.Unix()))
+}
+
+// ChannelLastActivity returns when the worker of a channel last saw a message since startup.
+func (r *RabbitMQ) ChannelLastActivity(ch *storage.Channel) (time.Time, bool) {
+	r.activityMu.Lock()
+	defer r.activityMu.Unlock()
+	last, ok := r.lastActivity[channelWorkerKey(ch.Direction, ChannelConnection(ch), ch.Destination)]
+	return last, ok
+}
+
+// IsChannelSilent reports whether a channel with a silence alert has gone quiet for longer than its threshold.
+func (r *RabbitMQ) IsChannelSilent(ch *storage.Channel) bool {
+	if ch.SilenceAlert <= 0 {
+		return false
+	}
+	last, ok := r.ChannelLastActivity(ch)
+	if !ok {
+		// Nothing seen yet: measure the silence from startup instead of alerting right away.
+		last = r.startedAt
+	}
+	return time.Since(last) > time.Duration(ch.SilenceAlert)*time.Minute
+}
+
+// StartSilenceMonitor starts the dead man's switch that periodically checks every channel with a
+// silence alert and reports the ones that have not seen a message for longer than their threshold.
+func (r *RabbitMQ) StartSilenceMonitor() {
+	ctx, ok := r.registerWorker("silence-monitor")
+	if !ok {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(silenceCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.checkSilentChannels()
+			}
+		}
+	}()
+}
+
+// checkSilentChannels raises or clears the silence alert of every channel. Alerts are logged once when
+// they start and once when they clear; the esb_go_channel_silent gauge carries the current state.
+func (r *RabbitMQ) checkSilentChannels() {
+	channels, err := r.dataStore.GetAllChannels(storage.ListFilter{})
+	if err != nil {
+		r.logger.Error("failed to load channels for the silence check", "error", err)
+		return
+	}
+
+	for i := range channels {
+		ch := &channels[i]
+		silent := r.IsChannelSilent(ch)
+
+		r.activityMu.Lock()
+		wasSilent := r.silentChannels[ch.ID]
+		if silent {
+			r.silentChannels[ch.ID] = true
+		} else {
+			delete(r.silentChannels, ch.ID)
+		}
+		r.activityMu.Unlock()
+
+		switch {
+		case silent && !wasSilent:
+			last, _ := r.ChannelLastActivity(ch)
+			r.logger.Error("channel is silent, no messages seen within the expected interval", "channel_id", ch.ID, "channel", ch.Name, "destination", ch.Destination, "expected_every_minutes", ch.SilenceAlert, "last_message", last)
+			metrics.ChannelSilent.WithLabelValues(ch.ID, ch.Name).Set(1)
+		case !silent && wasSilent:
+			r.logger.Info("channel is receiving messages again", "channel_id", ch.ID, "channel", ch.Name, "destination", ch.Destination)
+			metrics.ChannelSilent.WithLabelValues(ch.ID, ch.Name).Set(0)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a rate limiter shared by all consumers of a throttled route. It holds up to one
+// second worth of tokens, so short bursts pass at full speed while the long-term rate stays capped.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second
+	burst  float64 // Maximum number of stored tokens
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket for ratePerSecond messages per second.
+func newTokenBucket(ratePerSecond int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(ratePerSecond),
+		burst:  float64(ratePerSecond),
+		tokens: float64(ratePerSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available or ctx is done. A nil bucket never blocks.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"esb-go-app/config"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// dial connects to the broker, using TLS when it is configured or the DSN uses the amqps scheme.
+func dial(cfg *config.RabbitMQConfig) (*amqp091.Connection, error) {
+	if cfg.TLS == nil && !strings.HasPrefix(cfg.DSN, "amqps://") {
+		return amqp091.Dial(cfg.DSN)
+	}
+
+	tlsCfg, err := buildTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return amqp091.DialTLS(cfg.DSN, tlsCfg)
+}
+
+// buildTLSConfig loads the CA bundle and client certificate referenced by the TLS settings.
+func buildTLSConfig(settings *config.TLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if settings == nil {
+		return tlsCfg, nil
+	}
+	tlsCfg.InsecureSkipVerify = settings.SkipVerify
+
+	if settings.CACert != "" {
+		caPEM, err := os.ReadFile(settings.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file '%s'", settings.CACert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" || settings.ClientKey != "" {
+		if settings.ClientCert == "" || settings.ClientKey == "" {
+			return nil, fmt.Errorf("both client_cert and client_key must be set for TLS client authentication")
+		}
+		cert, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
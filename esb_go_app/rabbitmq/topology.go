@@ -3,12 +3,15 @@ package rabbitmq
 import (
 	"fmt"
 
+	"esb-go-app/storage"
+
 	"github.com/rabbitmq/amqp091-go"
 )
 // SetupDurableTopology creates the durable part of the topology for a given channel.
 // This topology is used for reliable storage of messages within the ESB.
-func (r *RabbitMQ) SetupDurableTopology(baseName string) error {
-	ch, err := r.conn.Channel()
+// The queue options are only applied when the durable queue is first declared.
+func (r *RabbitMQ) SetupDurableTopology(connName, baseName string, opts QueueOptions) error {
+	ch, err := r.openChannel(connName)
 	if err != nil {
 		return fmt.Errorf("failed to open a channel: %w", err)
 	}
@@ -22,14 +25,14 @@ func (r *RabbitMQ) SetupDurableTopology(baseName string) error {
 
 	// 1. Declare a durable exchange
 	r.logger.Info("declaring durable exchange", "exchange", durableExchangeName)
-	err = ch.ExchangeDeclare(durableExchangeName, "fanout", true, false, false, false, nil)
+	err = r.declareDurableExchange(connName, durableExchangeName)
 	if err != nil {
 		return fmt.Errorf("failed to declare durable exchange: %w", err)
 	}
 
 	// 2. Declare a durable queue
 	r.logger.Info("declaring durable queue", "queue", durableQueueName)
-	_, err = ch.QueueDeclare(durableQueueName, true, false, false, false, nil)
+	_, err = ch.QueueDeclare(durableQueueName, true, false, false, false, opts.args())
 	if err != nil {
 		return fmt.Errorf("failed to declare durable queue: %w", err)
 	}
@@ -44,3 +47,96 @@ func (r *RabbitMQ) SetupDurableTopology(baseName string) error {
 	r.logger.Info("durable topology setup complete", "baseName", baseName)
 	return nil
 }
+
+// QueueOptions are the arguments of a channel's durable queue. RabbitMQ cannot change them on an existing queue.
+type QueueOptions struct {
+	MaxPriority int  // x-max-priority, 0 disables priorities
+	Quorum      bool // Declare a replicated quorum queue instead of a classic one
+	MessageTTL  int  // x-message-ttl in seconds, 0 keeps messages until they are consumed
+	Lazy        bool // x-queue-mode=lazy keeps classic queue messages on disk instead of in memory
+}
+
+// ChannelQueueOptions returns the durable queue options configured on a channel.
+func ChannelQueueOptions(ch *storage.Channel) QueueOptions {
+	return QueueOptions{
+		MaxPriority: ch.MaxPriority,
+		Quorum:      ch.QueueType == "quorum",
+		MessageTTL:  ch.MessageTTL,
+		Lazy:        ch.LazyMode && ch.QueueType != "quorum",
+	}
+}
+
+// args returns the queue arguments for the options, or nil for a plain classic queue.
+func (o QueueOptions) args() amqp091.Table {
+	args := priorityQueueArgs(o.MaxPriority)
+	if !o.Quorum && o.MessageTTL <= 0 && !o.Lazy {
+		return args
+	}
+	if args == nil {
+		args = amqp091.Table{}
+	}
+	if o.Quorum {
+		args["x-queue-type"] = "quorum"
+	} else if o.Lazy {
+		args["x-queue-mode"] = "lazy"
+	}
+	if o.MessageTTL > 0 {
+		args["x-message-ttl"] = int64(o.MessageTTL) * 1000
+	}
+	return args
+}
+
+// priorityQueueArgs returns the queue arguments enabling priorities, or nil when they are disabled.
+func priorityQueueArgs(maxPriority int) amqp091.Table {
+	if maxPriority <= 0 {
+		return nil
+	}
+	return amqp091.Table{"x-max-priority": int32(maxPriority)}
+}
+
+// PurgeQueue removes all ready messages from a queue on the given connection and returns how many were deleted.
+// Unacknowledged messages held by consumers are not affected.
+func (r *RabbitMQ) PurgeQueue(connName, queueName string) (int, error) {
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	count, err := ch.QueuePurge(queueName, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge queue '%s': %w", queueName, err)
+	}
+	r.logger.Warn("queue purged", "connection", connName, "queue", queueName, "deleted", count)
+	return count, nil
+}
+
+// DeleteDurableTopology deletes the durable queue and exchange of a destination on the given connection.
+// Deleting the exchange also removes its bindings, including those of route fan-out queues.
+func (r *RabbitMQ) DeleteDurableTopology(connName, baseName string) error {
+	ch, err := r.openChannel(connName)
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	durableQueueName := "durable_queue_for_" + baseName
+	durableExchangeName := "durable_exchange_for_" + baseName
+
+	deleted, err := ch.QueueDelete(durableQueueName, false, false, false)
+	if err != nil {
+		return fmt.Errorf("failed to delete durable queue: %w", err)
+	}
+	r.logger.Warn("durable queue deleted", "connection", connName, "queue", durableQueueName, "messages", deleted)
+
+	// Deleting an exchange that does not exist closes the channel, so check for it passively first.
+	if err := ch.ExchangeDeclarePassive(durableExchangeName, "fanout", true, false, false, false, nil); err != nil {
+		r.logger.Info("durable exchange already absent", "connection", connName, "exchange", durableExchangeName)
+		return nil
+	}
+	if err := ch.ExchangeDelete(durableExchangeName, false, false); err != nil {
+		return fmt.Errorf("failed to delete durable exchange: %w", err)
+	}
+	r.logger.Warn("durable exchange deleted", "connection", connName, "exchange", durableExchangeName)
+	return nil
+}
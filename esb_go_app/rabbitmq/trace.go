@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"esb-go-app/storage"
+
+	"github.com/google/uuid"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// TraceHeader carries the ID that follows a message through every hop of the bus.
+const TraceHeader = "x-esb-trace-id"
+
+// Stages of the hops recorded for a traced message.
+const (
+	TraceOutbound = "outbound" // Collected from the 1C queue of an outbound channel
+	TraceRoute    = "route"    // Republished by a router
+	TraceInbound  = "inbound"  // Forwarded to the 1C queue of an inbound channel
+)
+
+// TraceID returns the trace ID carried in the headers of a message, or an empty string.
+func TraceID(headers amqp091.Table) string {
+	traceID, _ := headers[TraceHeader].(string)
+	return traceID
+}
+
+// ensureTraceID returns the trace ID of msg, starting a new trace when it has none.
+func ensureTraceID(msg *amqp091.Delivery) string {
+	traceID := TraceID(msg.Headers)
+	if traceID == "" {
+		traceID = uuid.New().String()
+		setTraceID(msg, traceID)
+	}
+	return traceID
+}
+
+// setTraceID sets the trace header of msg on a copy of its headers, so the table of the original
+// delivery is never changed.
+func setTraceID(msg *amqp091.Delivery, traceID string) {
+	headers := make(amqp091.Table, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[TraceHeader] = traceID
+	msg.Headers = headers
+}
+
+// recordHop stores a hop of a traced message. Like sampling, tracing is best effort: a hop that cannot
+// be stored is logged and never affects the message flow.
+func (r *RabbitMQ) recordHop(traceID, stage, routeID, source, destination string, msg *amqp091.Delivery, transformations []string) {
+	if traceID == "" {
+		return
+	}
+	hop := &storage.TraceHop{
+		TraceID:         traceID,
+		Stage:           stage,
+		RouteID:         routeID,
+		Source:          source,
+		Destination:     destination,
+		MessageID:       msg.MessageId,
+		Transformations: transformations,
+	}
+	if err := r.dataStore.CreateTraceHop(hop); err != nil {
+		r.logger.Warn("failed to record trace hop", "trace_id", traceID, "stage", stage, "msgId", msg.MessageId, "error", err)
+	}
+}
@@ -0,0 +1,61 @@
+package rabbitmq
+
+import (
+	"fmt"
+
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// vhostSeparator joins a configured connection name and a virtual host into the name of a vhost connection.
+const vhostSeparator = "@"
+
+// VHostConnection returns the name of the connection to vhost with the settings of the configured
+// connection connName. An empty vhost keeps the configured connection and its own vhost.
+func VHostConnection(connName, vhost string) string {
+	if vhost == "" {
+		return connName
+	}
+	if connName == "" {
+		connName = DefaultConnection
+	}
+	return connName + vhostSeparator + vhost
+}
+
+// ChannelConnection returns the connection the topology and the workers of a channel use: the channel's
+// configured connection inside the vhost of its application.
+func ChannelConnection(ch *storage.Channel) string {
+	return VHostConnection(ch.Connection, ch.VHost)
+}
+
+// dialVHost connects to a vhost with the credentials and TLS settings of a configured connection and
+// keeps the connection in the registry under name, so every vhost is dialed once.
+func (r *RabbitMQ) dialVHost(name, baseName, vhost string) (*brokerConnection, error) {
+	r.brokersMu.Lock()
+	defer r.brokersMu.Unlock()
+
+	if b, ok := r.brokers[name]; ok {
+		return b, nil
+	}
+	base, ok := r.brokers[baseName]
+	if !ok {
+		return nil, fmt.Errorf("unknown RabbitMQ connection '%s'", baseName)
+	}
+
+	uri, err := amqp091.ParseURI(base.cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN of connection '%s': %w", baseName, err)
+	}
+	uri.Vhost = vhost
+	cfg := *base.cfg
+	cfg.DSN = uri.String()
+
+	b, err := dialBroker(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to vhost '%s' (connection '%s'): %w", vhost, baseName, err)
+	}
+	r.brokers[name] = b
+	r.logger.Info("connected to RabbitMQ vhost", "connection", baseName, "vhost", vhost)
+	return b, nil
+}
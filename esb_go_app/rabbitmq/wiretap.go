@@ -0,0 +1,58 @@
+package rabbitmq
+
+import (
+	"esb-go-app/metrics"
+	"esb-go-app/storage"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Headers added to the copies published to a wiretap channel.
+const (
+	wiretapRouteHeader = "x-wiretap-route-id"
+	wiretapStageHeader = "x-wiretap-stage"
+)
+
+// Stages of the route a wiretap copies messages at.
+const (
+	WiretapPre  = "pre"  // As received from the source, before guards, scripts and enrichment
+	WiretapPost = "post" // As published to the destination
+)
+
+// wiretapMessage publishes a copy of msg to the route's wiretap channel when the route taps at stage.
+// Pre-stage copies are only taken on the first attempt, so retried messages are not tapped twice. Like
+// sampling, the wiretap is best effort: a failed copy is logged and never affects the main flow.
+func (r *RabbitMQ) wiretapMessage(route *storage.Route, msg *amqp091.Delivery, stage, sourceQueue string, batch *routeBatch) {
+	if route.WiretapChannelID == "" || route.WiretapStage != stage {
+		return
+	}
+	if stage == WiretapPre && retryCount(msg.Headers) > 0 {
+		return
+	}
+	wiretapChannel, err := batch.destinationChannel(r, route.WiretapChannelID)
+	if err != nil || wiretapChannel == nil {
+		r.logger.Warn("failed to get wiretap channel for route, copy dropped", "route_id", route.ID, "wiretap_channel_id", route.WiretapChannelID, "error", err)
+		return
+	}
+
+	tapped := *msg
+	tapped.Headers = amqp091.Table{}
+	for k, v := range msg.Headers {
+		tapped.Headers[k] = v
+	}
+	tapped.Headers[wiretapRouteHeader] = route.ID
+	tapped.Headers[wiretapStageHeader] = stage
+
+	wiretapExchange := "durable_exchange_for_" + wiretapChannel.Destination
+	if batch != nil {
+		err = batch.publish(r, ChannelConnection(wiretapChannel), &tapped, wiretapExchange)
+	} else {
+		err = r.republishAsDurable(ChannelConnection(wiretapChannel), &tapped, wiretapExchange)
+	}
+	if err != nil {
+		r.logger.Warn("failed to publish wiretap copy, copy dropped", "route_id", route.ID, "to", wiretapExchange, "error", err)
+		return
+	}
+	r.logger.Debug("message wiretapped", "route_id", route.ID, "stage", stage, "to", wiretapExchange, "msgId", msg.MessageId)
+	metrics.MessagesProcessed.WithLabelValues("wiretap", sourceQueue, wiretapExchange).Inc()
+}
@@ -1,19 +1,58 @@
 package rabbitmq
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
 	"esb-go-app/metrics"
+	"esb-go-app/storage"
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// StartChannelWorker starts the worker matching the channel direction on the given broker connection.
+func (r *RabbitMQ) StartChannelWorker(connName, direction, baseName string) {
+	switch direction {
+	case "inbound":
+		r.StartInboundForwarder(connName, baseName)
+	case "outbound":
+		r.StartOutboundCollector(connName, baseName)
+	default:
+		r.logger.Warn("unknown channel direction, no worker started", "baseName", baseName, "direction", direction)
+	}
+}
+
+// StopChannelWorker stops the worker matching the channel direction on the given broker connection.
+func (r *RabbitMQ) StopChannelWorker(connName, direction, baseName string) {
+	switch direction {
+	case "inbound":
+		r.StopInboundForwarder(connName, baseName)
+	case "outbound":
+		r.StopOutboundCollector(connName, baseName)
+	}
+}
+
+// RestartChannelWorkers stops the worker for the old channel settings, declares the durable topology
+// for the new destination and starts the matching worker.
+func (r *RabbitMQ) RestartChannelWorkers(oldCh, newCh *storage.Channel) error {
+	r.StopChannelWorker(ChannelConnection(oldCh), oldCh.Direction, oldCh.Destination)
+	// Give it a moment to shutdown before restarting
+	time.Sleep(100 * time.Millisecond)
+
+	if err := r.SetupDurableTopology(ChannelConnection(newCh), newCh.Destination, ChannelQueueOptions(newCh)); err != nil {
+		return fmt.Errorf("failed to setup durable topology for '%s': %w", newCh.Destination, err)
+	}
+	r.StartChannelWorker(ChannelConnection(newCh), newCh.Direction, newCh.Destination)
+	return nil
+}
+
 // StartInboundForwarder starts a worker for an INBOUND channel.
 // It forwards messages from the durable queue to the transient queue for 1C.
-func (r *RabbitMQ) StartInboundForwarder(baseName string) {
-	workerKey := "inbound-" + baseName
-	if r.workers[workerKey] {
+func (r *RabbitMQ) StartInboundForwarder(connName, baseName string) {
+	workerKey := channelWorkerKey("inbound", connName, baseName)
+	ctx, ok := r.registerWorker(workerKey)
+	if !ok {
 		r.logger.Warn("inbound forwarder already started, skipping", "baseName", baseName)
 		return
 	}
@@ -21,29 +60,45 @@ func (r *RabbitMQ) StartInboundForwarder(baseName string) {
 	sourceQueue := "durable_queue_for_" + baseName
 	destQueue := baseName
 
-	r.logger.Info("starting INBOUND forwarder", "from", sourceQueue, "to", destQueue)
-	r.workers[workerKey] = true
+	r.logger.Info("starting INBOUND forwarder", "from", sourceQueue, "to", destQueue, "connection", connName)
 	metrics.ActiveWorkers.WithLabelValues("inbound").Inc()
 
 	go func() {
 		defer metrics.ActiveWorkers.WithLabelValues("inbound").Dec()
 		for {
-			time.Sleep(1 * time.Second) // Simple backoff
-			err := r.forwardOneMessage(sourceQueue, destQueue)
+			select {
+			case <-time.After(1 * time.Second): // Simple backoff
+			case <-ctx.Done():
+				r.logger.Info("inbound forwarder stopped", "baseName", baseName)
+				return
+			}
+			err := r.forwardOneMessage(connName, sourceQueue, destQueue)
 			if err != nil {
 				if err.Error() != "no message in queue" && !strings.Contains(err.Error(), "does not exist yet") {
 					r.logger.Error("inbound forwarder error", "baseName", baseName, "error", err)
 					metrics.ErrorsTotal.WithLabelValues("inbound").Inc()
-					time.Sleep(5 * time.Second)
+					select {
+					case <-time.After(5 * time.Second):
+					case <-ctx.Done():
+						r.logger.Info("inbound forwarder stopped during backoff", "baseName", baseName)
+						return
+					}
 				}
 			}
 		}
 	}()
 }
 
+// StopInboundForwarder stops a running inbound forwarder for the given channel destination.
+func (r *RabbitMQ) StopInboundForwarder(connName, baseName string) {
+	if r.stopWorker(channelWorkerKey("inbound", connName, baseName)) {
+		r.logger.Info("stopping INBOUND forwarder", "baseName", baseName)
+	}
+}
+
 // forwardOneMessage performs the one-shot forwarding for the Inbound worker.
-func (r *RabbitMQ) forwardOneMessage(sourceQueue, destQueue string) error {
-	ch, err := r.conn.Channel()
+func (r *RabbitMQ) forwardOneMessage(connName, sourceQueue, destQueue string) error {
+	ch, err := r.openChannel(connName)
 	if err != nil {
 		return fmt.Errorf("could not open channel: %w", err)
 	}
@@ -62,7 +117,14 @@ func (r *RabbitMQ) forwardOneMessage(sourceQueue, destQueue string) error {
 		return fmt.Errorf("no message in queue")
 	}
 
-	err = ch.Publish("", destQueue, false, false, amqp091.Publishing{
+	publishCh, err := r.openPublishChannel(connName)
+	if err != nil {
+		_ = msg.Nack(false, true)
+		return fmt.Errorf("could not open publish channel: %w", err)
+	}
+	defer publishCh.Close()
+
+	err = publishCh.Publish("", destQueue, false, false, amqp091.Publishing{
 		Headers:         msg.Headers,
 		ContentType:     msg.ContentType,
 		ContentEncoding: msg.ContentEncoding,
@@ -86,6 +148,8 @@ func (r *RabbitMQ) forwardOneMessage(sourceQueue, destQueue string) error {
 	}
 
 	_ = msg.Ack(false)
+	r.recordChannelActivity("inbound", connName, destQueue)
+	r.recordHop(TraceID(msg.Headers), TraceInbound, "", sourceQueue, destQueue, &msg, nil)
 	r.logger.Info("message forwarded successfully (INBOUND)", "from", sourceQueue, "to", destQueue, "msgId", msg.MessageId)
 	metrics.MessagesProcessed.WithLabelValues("inbound", sourceQueue, destQueue).Inc()
 	return nil
@@ -93,9 +157,10 @@ func (r *RabbitMQ) forwardOneMessage(sourceQueue, destQueue string) error {
 
 // StartOutboundCollector starts a worker for an OUTBOUND channel.
 // It collects messages from the transient 1C queue and persists them to the durable exchange.
-func (r *RabbitMQ) StartOutboundCollector(baseName string) {
-	workerKey := "outbound-" + baseName
-	if r.workers[workerKey] {
+func (r *RabbitMQ) StartOutboundCollector(connName, baseName string) {
+	workerKey := channelWorkerKey("outbound", connName, baseName)
+	ctx, ok := r.registerWorker(workerKey)
+	if !ok {
 		r.logger.Warn("outbound collector already started, skipping", "baseName", baseName)
 		return
 	}
@@ -103,42 +168,56 @@ func (r *RabbitMQ) StartOutboundCollector(baseName string) {
 	sourceQueue := baseName
 	destExchange := "durable_exchange_for_" + baseName
 
-	r.logger.Info("starting OUTBOUND collector", "from", sourceQueue, "to", destExchange)
-	r.workers[workerKey] = true
+	r.logger.Info("starting OUTBOUND collector", "from", sourceQueue, "to", destExchange, "connection", connName)
 	metrics.ActiveWorkers.WithLabelValues("outbound").Inc()
 
 	go func() {
 		defer metrics.ActiveWorkers.WithLabelValues("outbound").Dec()
 		for {
-			err := r.collectMessages(sourceQueue, destExchange)
+			err := r.collectMessages(ctx, connName, sourceQueue, destExchange)
+			if ctx.Err() == context.Canceled {
+				r.logger.Info("outbound collector stopped", "baseName", baseName)
+				return
+			}
 			r.logger.Error("outbound collector failed, restarting...", "baseName", baseName, "error", err)
 			metrics.ErrorsTotal.WithLabelValues("outbound").Inc()
-			time.Sleep(5 * time.Second)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				r.logger.Info("outbound collector stopped during backoff", "baseName", baseName)
+				return
+			}
 		}
 	}()
 }
 
-// collectMessages is the core logic for the Outbound worker.
-func (r *RabbitMQ) collectMessages(sourceQueue, destExchange string) error {
-	ch, err := r.conn.Channel()
-	if err != nil {
-		return fmt.Errorf("could not open channel: %w", err)
+// StopOutboundCollector stops a running outbound collector for the given channel destination.
+func (r *RabbitMQ) StopOutboundCollector(connName, baseName string) {
+	if r.stopWorker(channelWorkerKey("outbound", connName, baseName)) {
+		r.logger.Info("stopping OUTBOUND collector", "baseName", baseName)
 	}
-	defer ch.Close()
+}
 
-	_, err = ch.QueueDeclarePassive(sourceQueue, false, false, false, false, nil)
-	if err != nil {
-		return fmt.Errorf("source queue '%s' does not exist yet or cannot be declared: %w", sourceQueue, err)
+// collectMessages is the core logic for the Outbound worker. Its consumer survives channel closes and cancels.
+func (r *RabbitMQ) collectMessages(ctx context.Context, connName, sourceQueue, destExchange string) error {
+	checkSource := func(ch *amqp091.Channel) error {
+		if _, err := ch.QueueDeclarePassive(sourceQueue, false, false, false, false, nil); err != nil {
+			return fmt.Errorf("source queue '%s' does not exist yet or cannot be declared: %w", sourceQueue, err)
+		}
+		return nil
 	}
-
-	msgs, err := ch.Consume(sourceQueue, "", false, false, false, false, nil)
+	consumer, err := r.newConsumerChannel(ctx, connName, sourceQueue, "esb-outbound-"+sourceQueue, 0, checkSource)
 	if err != nil {
-		return fmt.Errorf("failed to register a consumer for '%s': %w", sourceQueue, err)
+		return err
 	}
+	defer consumer.Close()
 
-	for d := range msgs {
+	for d := range consumer.Deliveries() {
+		r.recordChannelActivity("outbound", connName, sourceQueue)
 		r.logger.Debug("collected message from transient queue, processing...", "source", sourceQueue, "msgId", d.MessageId)
-		err := r.republishAsDurable(&d, destExchange)
+		// Messages enter the bus here, so this is where their trace starts.
+		traceID := ensureTraceID(&d)
+		err := r.republishAsDurable(connName, &d, destExchange)
 		if err != nil {
 			r.logger.Error("failed to republish message as durable, requeueing", "error", err)
 			_ = d.Nack(false, true)
@@ -146,6 +225,7 @@ func (r *RabbitMQ) collectMessages(sourceQueue, destExchange string) error {
 			r.logger.Info("message collected successfully (OUTBOUND)", "from", sourceQueue, "to", destExchange, "msgId", d.MessageId)
 			metrics.MessagesProcessed.WithLabelValues("outbound", sourceQueue, destExchange).Inc()
 			_ = d.Ack(false)
+			r.recordHop(traceID, TraceOutbound, "", sourceQueue, destExchange, &d, nil)
 		}
 	}
 
@@ -0,0 +1,141 @@
+package scripting
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/dop251/goja"
+	"go.starlark.net/starlark"
+)
+
+const (
+	// maxCachedScripts bounds the scripts a runner keeps compiled; the cache starts over once it is full.
+	maxCachedScripts = 512
+	// maxIdleVMs is the number of idle JavaScript VMs kept per script for the next messages.
+	maxIdleVMs = 8
+)
+
+// scriptCacheKey identifies a script of a transformation or collector. The key changes with the source,
+// so an edited script is compiled again on its next run. Runs without a namespace, such as bundle tests,
+// are not cached because their kv state must not outlive the run.
+func scriptCacheKey(namespace, script string) string {
+	if namespace == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(script))
+	return namespace + "|" + hex.EncodeToString(sum[:])
+}
+
+// gojaCache keeps the compiled programs of JavaScript scripts and pools the VMs that already ran them.
+// A pooled VM keeps the globals of its script: its top-level code runs once per VM, not per message.
+type gojaCache struct {
+	mu       sync.Mutex
+	programs map[string]*goja.Program
+	idle     map[string][]*goja.Runtime
+}
+
+func newGojaCache() *gojaCache {
+	return &gojaCache{programs: make(map[string]*goja.Program), idle: make(map[string][]*goja.Runtime)}
+}
+
+// program returns the compiled script, compiling it on first use.
+func (c *gojaCache) program(key, script string) (*goja.Program, error) {
+	if key != "" {
+		c.mu.Lock()
+		program, ok := c.programs[key]
+		c.mu.Unlock()
+		if ok {
+			return program, nil
+		}
+	}
+	program, err := goja.Compile("script", script, false)
+	if err != nil || key == "" {
+		return program, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.programs) >= maxCachedScripts {
+		c.programs = make(map[string]*goja.Program)
+		c.idle = make(map[string][]*goja.Runtime)
+	}
+	c.programs[key] = program
+	return program, nil
+}
+
+// take returns an idle VM that already ran the script, or nil if there is none.
+func (c *gojaCache) take(key string) *goja.Runtime {
+	if key == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vms := c.idle[key]
+	if len(vms) == 0 {
+		return nil
+	}
+	vm := vms[len(vms)-1]
+	c.idle[key] = vms[:len(vms)-1]
+	return vm
+}
+
+// put returns a VM to the pool of its script after a successful run.
+func (c *gojaCache) put(key string, vm *goja.Runtime) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.programs[key]; !ok || len(c.idle[key]) >= maxIdleVMs {
+		return
+	}
+	c.idle[key] = append(c.idle[key], vm)
+}
+
+// purge drops every compiled program and pooled VM.
+func (c *gojaCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.programs = make(map[string]*goja.Program)
+	c.idle = make(map[string][]*goja.Runtime)
+}
+
+// starlarkCache keeps the globals of executed Starlark scripts. ExecFile freezes them, so the transform
+// and collect functions can be called from the threads of concurrent runs.
+type starlarkCache struct {
+	mu      sync.Mutex
+	globals map[string]starlark.StringDict
+}
+
+func newStarlarkCache() *starlarkCache {
+	return &starlarkCache{globals: make(map[string]starlark.StringDict)}
+}
+
+func (c *starlarkCache) get(key string) (starlark.StringDict, bool) {
+	if key == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	globals, ok := c.globals[key]
+	return globals, ok
+}
+
+func (c *starlarkCache) put(key string, globals starlark.StringDict) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.globals) >= maxCachedScripts {
+		c.globals = make(map[string]starlark.StringDict)
+	}
+	c.globals[key] = globals
+}
+
+// purge drops every cached script.
+func (c *starlarkCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.globals = make(map[string]starlark.StringDict)
+}
@@ -0,0 +1,176 @@
+package scripting
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+)
+
+// celInterruptFrequency is how many comprehension iterations a CEL expression runs between checks of
+// its time limit.
+const celInterruptFrequency = 100
+
+// CELRunner evaluates CEL expressions, the engine for transformations that only filter messages or map
+// a few fields. An expression is compiled once and evaluated without a VM, which is far cheaper per
+// message than a script, and it cannot loop forever, call out or keep state.
+//
+// The expression sees message, headers and context, the route running it. A bool keeps (true) or filters (false) the message
+// unchanged, a map becomes the new body and null filters the message.
+type CELRunner struct {
+	limits   *liveLimits
+	env      *cel.Env
+	mu       sync.Mutex
+	programs map[string]cel.Program // Compiled expressions keyed by a hash of their source
+}
+
+// NewCELRunner creates a new CELRunner instance. The declarations of the environment are fixed, so
+// failing to create it is a programming error and panics.
+func NewCELRunner(limits Limits) *CELRunner {
+	env, err := cel.NewEnv(
+		cel.Variable("message", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("context", cel.MapType(cel.StringType, cel.StringType)),
+		cel.CrossTypeNumericComparisons(true), // JSON numbers are doubles, so message.count > 5 must work
+		ext.Strings(),
+	)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create CEL environment: %v", err))
+	}
+	return &CELRunner{limits: newLiveLimits(limits), env: env, programs: make(map[string]cel.Program)}
+}
+
+// Execute evaluates the expression against the message. Only the time limit applies: an expression
+// allocates too little for the memory limit to matter.
+func (r *CELRunner) Execute(expression string, messageBody map[string]interface{}, messageHeaders map[string]interface{}, scriptContext *ScriptContext) (*TransformedMessage, error) {
+	program, err := r.program(expression)
+	if err != nil {
+		return nil, err
+	}
+	if messageHeaders == nil {
+		messageHeaders = make(map[string]interface{})
+	}
+
+	timeout := r.limits.get().Timeout
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	out, _, err := program.ContextEval(ctx, map[string]interface{}{"message": messageBody, "headers": messageHeaders, "context": scriptContext.values()})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w after %s", ErrScriptTimeout, timeout.Round(time.Millisecond))
+		}
+		return nil, fmt.Errorf("failed to evaluate CEL expression: %w", err)
+	}
+
+	result, err := celNative(out)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CEL result: %w", err)
+	}
+	switch v := result.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return &TransformedMessage{Body: messageBody, Headers: messageHeaders}, nil
+	case map[string]interface{}:
+		return &TransformedMessage{Body: v, Headers: messageHeaders}, nil
+	default:
+		return nil, fmt.Errorf("CEL expression must return a bool, a map or null, got %s", out.Type().TypeName())
+	}
+}
+
+// program returns the compiled expression, compiling it on first use.
+func (r *CELRunner) program(expression string) (cel.Program, error) {
+	sum := sha256.Sum256([]byte(expression))
+	key := hex.EncodeToString(sum[:])
+	r.mu.Lock()
+	program, ok := r.programs[key]
+	r.mu.Unlock()
+	if ok {
+		return program, nil
+	}
+
+	ast, issues := r.env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("failed to compile CEL expression: %w", issues.Err())
+	}
+	program, err := r.env.Program(ast, cel.InterruptCheckFrequency(celInterruptFrequency))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile CEL expression: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.programs) >= maxCachedScripts {
+		r.programs = make(map[string]cel.Program)
+	}
+	r.programs[key] = program
+	return program, nil
+}
+
+// celNative converts a CEL value to the Go values used for message bodies.
+func celNative(v ref.Val) (interface{}, error) {
+	switch val := v.(type) {
+	case types.Null:
+		return nil, nil
+	case types.Bool:
+		return bool(val), nil
+	case types.Int:
+		return int64(val), nil
+	case types.Uint:
+		return uint64(val), nil
+	case types.Double:
+		return float64(val), nil
+	case types.String:
+		return string(val), nil
+	case types.Bytes:
+		return string(val), nil
+	case types.Timestamp:
+		return val.Time.Format(time.RFC3339Nano), nil
+	case types.Duration:
+		return val.Duration.String(), nil
+	case traits.Mapper:
+		result := make(map[string]interface{})
+		for it := val.Iterator(); it.HasNext() == types.True; {
+			key := it.Next()
+			name, ok := key.(types.String)
+			if !ok {
+				return nil, fmt.Errorf("map keys must be strings, got %s", key.Type().TypeName())
+			}
+			item, err := celNative(val.Get(key))
+			if err != nil {
+				return nil, err
+			}
+			result[string(name)] = item
+		}
+		return result, nil
+	case traits.Lister:
+		result := []interface{}{}
+		for it := val.Iterator(); it.HasNext() == types.True; {
+			item, err := celNative(it.Next())
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	case *types.Err:
+		return nil, errors.New(val.String())
+	default:
+		return nil, fmt.Errorf("unsupported value of type %s", v.Type().TypeName())
+	}
+}
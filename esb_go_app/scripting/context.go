@@ -0,0 +1,57 @@
+package scripting
+
+import (
+	"go.starlark.net/starlark"
+)
+
+// ScriptContext describes what invoked a script. It is passed to transform() and collect() as an extra
+// argument, so one script can branch on the route running it and record provenance in its output.
+type ScriptContext struct {
+	RouteID            string
+	RouteName          string
+	SourceChannel      string // Name of the channel the route consumes, empty when a collector feeds it
+	DestinationChannel string // Name of the destination channel of the route
+	CollectorID        string // Collector running the script, or feeding the route
+	CollectorName      string
+}
+
+// values returns the context as the script sees it. Every key is always present, empty when it does not
+// apply, so scripts can read the fields without checking for them first.
+func (c *ScriptContext) values() map[string]interface{} {
+	if c == nil {
+		c = &ScriptContext{}
+	}
+	return map[string]interface{}{
+		"route_id":            c.RouteID,
+		"route_name":          c.RouteName,
+		"source_channel":      c.SourceChannel,
+		"destination_channel": c.DestinationChannel,
+		"collector_id":        c.CollectorID,
+		"collector_name":      c.CollectorName,
+	}
+}
+
+// starlarkCallArgs appends the context to the arguments of a Starlark transform or collect function that
+// declares a parameter for it. Starlark rejects extra arguments, so scripts written before the context
+// existed keep working unchanged.
+func starlarkCallArgs(callable starlark.Callable, args starlark.Tuple, scriptContext *ScriptContext) (starlark.Tuple, error) {
+	fn, ok := callable.(*starlark.Function)
+	if !ok {
+		return args, nil
+	}
+	positional := fn.NumParams() - fn.NumKwonlyParams()
+	if fn.HasVarargs() {
+		positional--
+	}
+	if fn.HasKwargs() {
+		positional--
+	}
+	if positional <= len(args) && !fn.HasVarargs() {
+		return args, nil
+	}
+	ctx, err := convertMapToStarlarkDict(scriptContext.values())
+	if err != nil {
+		return nil, err
+	}
+	return append(args, ctx), nil
+}
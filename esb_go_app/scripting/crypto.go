@@ -0,0 +1,161 @@
+package scripting
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// hashAlgorithms are the digests offered by the crypto module, by the name the scripts use.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// digest hashes the data with the named algorithm and returns the digest as hex.
+func digest(algorithm, data string) (string, error) {
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash algorithm %q, expected md5, sha1, sha256 or sha512", algorithm)
+	}
+	h := newHash()
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hmacDigest signs the message with the key and returns the signature as "hex" or "base64".
+func hmacDigest(algorithm, key, message, encoding string) (string, error) {
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash algorithm %q, expected md5, sha1, sha256 or sha512", algorithm)
+	}
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write([]byte(message))
+	sum := mac.Sum(nil)
+	switch encoding {
+	case "", "hex":
+		return hex.EncodeToString(sum), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(sum), nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %q, expected hex or base64", encoding)
+	}
+}
+
+// base64Encoding returns the standard alphabet, or the URL-safe one used in JWTs and URLs.
+func base64Encoding(urlSafe bool) *base64.Encoding {
+	if urlSafe {
+		return base64.URLEncoding
+	}
+	return base64.StdEncoding
+}
+
+// starlarkCryptoModule is the crypto module of Starlark scripts.
+var starlarkCryptoModule = &starlarkstruct.Module{
+	Name: "crypto",
+	Members: starlark.StringDict{
+		"base64_encode": starlark.NewBuiltin("crypto.base64_encode", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var data string
+			var urlSafe bool
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data, "url?", &urlSafe); err != nil {
+				return nil, err
+			}
+			return starlark.String(base64Encoding(urlSafe).EncodeToString([]byte(data))), nil
+		}),
+		"base64_decode": starlark.NewBuiltin("crypto.base64_decode", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var data string
+			var urlSafe bool
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data, "url?", &urlSafe); err != nil {
+				return nil, err
+			}
+			decoded, err := base64Encoding(urlSafe).DecodeString(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.String(decoded), nil
+		}),
+		"md5":    starlarkDigest("md5"),
+		"sha1":   starlarkDigest("sha1"),
+		"sha256": starlarkDigest("sha256"),
+		"sha512": starlarkDigest("sha512"),
+		"hmac": starlark.NewBuiltin("crypto.hmac", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var algorithm, key, message, encoding string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "algorithm", &algorithm, "key", &key, "message", &message, "encoding?", &encoding); err != nil {
+				return nil, err
+			}
+			sum, err := hmacDigest(algorithm, key, message, encoding)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.String(sum), nil
+		}),
+	},
+}
+
+// starlarkDigest returns the crypto module function that hashes its argument with the algorithm.
+func starlarkDigest(algorithm string) *starlark.Builtin {
+	return starlark.NewBuiltin("crypto."+algorithm, func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var data string
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data); err != nil {
+			return nil, err
+		}
+		sum, err := digest(algorithm, data)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.String(sum), nil
+	})
+}
+
+// gojaCrypto returns the crypto object of JavaScript scripts, with the same functions as in Starlark
+// plus randomUUID, which Starlark scripts get as uuid().
+func gojaCrypto(vm *goja.Runtime) *goja.Object {
+	obj := vm.NewObject()
+	_ = obj.Set("randomUUID", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(uuid.New().String())
+	})
+	_ = obj.Set("base64_encode", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(base64Encoding(call.Argument(1).ToBoolean()).EncodeToString([]byte(call.Argument(0).String())))
+	})
+	_ = obj.Set("base64_decode", func(call goja.FunctionCall) goja.Value {
+		decoded, err := base64Encoding(call.Argument(1).ToBoolean()).DecodeString(call.Argument(0).String())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(string(decoded))
+	})
+	for algorithm := range hashAlgorithms {
+		_ = obj.Set(algorithm, func(call goja.FunctionCall) goja.Value {
+			sum, err := digest(algorithm, call.Argument(0).String())
+			if err != nil {
+				panic(vm.NewGoError(err))
+			}
+			return vm.ToValue(sum)
+		})
+	}
+	_ = obj.Set("hmac", func(call goja.FunctionCall) goja.Value {
+		encoding := ""
+		if arg := call.Argument(3); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			encoding = arg.String()
+		}
+		sum, err := hmacDigest(call.Argument(0).String(), call.Argument(1).String(), call.Argument(2).String(), encoding)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(sum)
+	})
+	return obj
+}
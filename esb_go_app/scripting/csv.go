@@ -0,0 +1,279 @@
+package scripting
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// csvOptions are the options of csv.parse and csv.render. Files exported from 1C usually use ";" as
+// the delimiter, a UTF-8 byte order mark and CRLF line endings.
+type csvOptions struct {
+	Delimiter string
+	Header    bool     // parse: the first row names the columns; render: write the column names first
+	Columns   []string // render: the columns and their order, by default the keys of the first record
+	CRLF      bool     // render: end lines with \r\n
+}
+
+func defaultCSVOptions() csvOptions {
+	return csvOptions{Delimiter: ",", Header: true}
+}
+
+func (o csvOptions) delimiter() (rune, error) {
+	r, size := utf8.DecodeRuneInString(o.Delimiter)
+	if size == 0 || size != len(o.Delimiter) || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("delimiter must be a single character other than a quote or a line break, got %q", o.Delimiter)
+	}
+	return r, nil
+}
+
+// parseCSV reads delimited text. With a header row every record becomes a dict of its columns in file
+// order, otherwise a list of fields. All fields are strings.
+func parseCSV(text string, opts csvOptions) ([]interface{}, error) {
+	delimiter, err := opts.delimiter()
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(text, "\uFEFF")))
+	reader.Comma = delimiter
+	if !opts.Header {
+		reader.FieldsPerRecord = -1
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]interface{}, 0, len(rows))
+	if !opts.Header {
+		for _, row := range rows {
+			fields := make([]interface{}, len(row))
+			for i, field := range row {
+				fields[i] = field
+			}
+			records = append(records, fields)
+		}
+		return records, nil
+	}
+	if len(rows) == 0 {
+		return records, nil
+	}
+	header := rows[0]
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q in the header row", name)
+		}
+		seen[name] = true
+	}
+	for _, row := range rows[1:] {
+		record := newXMLObject()
+		for i, name := range header {
+			record.set(name, row[i])
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// renderCSV writes records, given as dicts or as lists of fields, as delimited text.
+func renderCSV(records []interface{}, opts csvOptions) (string, error) {
+	delimiter, err := opts.delimiter()
+	if err != nil {
+		return "", err
+	}
+	columns := opts.Columns
+	if columns == nil && len(records) > 0 {
+		if first, ok := records[0].(*xmlObject); ok {
+			columns = first.keys
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
+	writer.UseCRLF = opts.CRLF
+	if opts.Header && len(columns) > 0 {
+		if err := writer.Write(columns); err != nil {
+			return "", err
+		}
+	}
+	for i, record := range records {
+		var row []string
+		switch val := record.(type) {
+		case *xmlObject:
+			row = make([]string, len(columns))
+			for j, name := range columns {
+				field, err := csvField(val.values[name])
+				if err != nil {
+					return "", fmt.Errorf("record %d, column %q: %w", i, name, err)
+				}
+				row[j] = field
+			}
+		case []interface{}:
+			row = make([]string, len(val))
+			for j, item := range val {
+				field, err := csvField(item)
+				if err != nil {
+					return "", fmt.Errorf("record %d, field %d: %w", i, j, err)
+				}
+				row[j] = field
+			}
+		default:
+			return "", fmt.Errorf("record %d must be a dict or a list, got %T", i, record)
+		}
+		if err := writer.Write(row); err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// csvField formats one value of a rendered record. Missing values and null become empty fields.
+func csvField(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int:
+		return strconv.Itoa(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case *xmlObject, []interface{}:
+		return "", fmt.Errorf("values must be strings, numbers, booleans or null, got a nested dict or list")
+	default:
+		return "", fmt.Errorf("values must be strings, numbers, booleans or null, got %T", v)
+	}
+}
+
+// csvRecords reads the records argument of csv.render, converted by xmlFromStarlark or xmlFromGoja so
+// that dicts keep the order of their keys.
+func csvRecords(v interface{}) ([]interface{}, error) {
+	records, ok := v.([]interface{})
+	if !ok {
+		if v == nil {
+			return []interface{}{}, nil
+		}
+		return nil, fmt.Errorf("records must be a list, got %T", v)
+	}
+	return records, nil
+}
+
+// starlarkCSVModule is the csv module of Starlark scripts:
+// csv.parse(text, delimiter=",", header=True) and csv.render(records, delimiter=",", header=True, columns=None, crlf=False).
+var starlarkCSVModule = &starlarkstruct.Module{
+	Name: "csv",
+	Members: starlark.StringDict{
+		"parse": starlark.NewBuiltin("csv.parse", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var text string
+			opts := defaultCSVOptions()
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "text", &text, "delimiter?", &opts.Delimiter, "header?", &opts.Header); err != nil {
+				return nil, err
+			}
+			records, err := parseCSV(text, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return xmlToStarlark(records), nil
+		}),
+		"render": starlark.NewBuiltin("csv.render", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var value starlark.Value
+			var columns *starlark.List
+			opts := defaultCSVOptions()
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "records", &value, "delimiter?", &opts.Delimiter, "header?", &opts.Header, "columns?", &columns, "crlf?", &opts.CRLF); err != nil {
+				return nil, err
+			}
+			if columns != nil {
+				opts.Columns = []string{}
+				for i := 0; i < columns.Len(); i++ {
+					name, ok := starlark.AsString(columns.Index(i))
+					if !ok {
+						return nil, fmt.Errorf("%s: columns must be strings, got %s", fn.Name(), columns.Index(i).Type())
+					}
+					opts.Columns = append(opts.Columns, name)
+				}
+			}
+			converted, err := xmlFromStarlark(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			records, err := csvRecords(converted)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			out, err := renderCSV(records, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.String(out), nil
+		}),
+	},
+}
+
+// gojaCSV returns the csv object of JavaScript scripts: csv.parse(text, options) and
+// csv.render(records, options), where the options are delimiter, header, columns and crlf.
+func gojaCSV(vm *goja.Runtime) *goja.Object {
+	options := func(v goja.Value) csvOptions {
+		opts := defaultCSVOptions()
+		if goja.IsUndefined(v) || goja.IsNull(v) {
+			return opts
+		}
+		obj := v.ToObject(vm)
+		if d := obj.Get("delimiter"); d != nil && !goja.IsUndefined(d) {
+			opts.Delimiter = d.String()
+		}
+		if h := obj.Get("header"); h != nil && !goja.IsUndefined(h) {
+			opts.Header = h.ToBoolean()
+		}
+		if c := obj.Get("crlf"); c != nil && !goja.IsUndefined(c) {
+			opts.CRLF = c.ToBoolean()
+		}
+		if cols := obj.Get("columns"); cols != nil && !goja.IsUndefined(cols) && !goja.IsNull(cols) {
+			list, ok := cols.Export().([]interface{})
+			if !ok {
+				panic(vm.NewGoError(fmt.Errorf("columns must be a list of names")))
+			}
+			opts.Columns = []string{}
+			for _, name := range list {
+				opts.Columns = append(opts.Columns, fmt.Sprint(name))
+			}
+		}
+		return opts
+	}
+	obj := vm.NewObject()
+	_ = obj.Set("parse", func(call goja.FunctionCall) goja.Value {
+		records, err := parseCSV(call.Argument(0).String(), options(call.Argument(1)))
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return xmlToGoja(vm, records)
+	})
+	_ = obj.Set("render", func(call goja.FunctionCall) goja.Value {
+		records, err := csvRecords(xmlFromGoja(vm, call.Argument(0)))
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		out, err := renderCSV(records, options(call.Argument(1)))
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(out)
+	})
+	return obj
+}
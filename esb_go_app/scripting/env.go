@@ -0,0 +1,78 @@
+package scripting
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dop251/goja"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// scriptEnv gives scripts read access to the environment variables named in the script_env_allowlist
+// setting, so deployment-specific endpoints and flags need not be written into every script. Reading any
+// other variable fails, which keeps secrets such as broker credentials out of reach of the scripts.
+type scriptEnv struct {
+	allowed map[string]bool
+}
+
+func newScriptEnv(allowlist []string) *scriptEnv {
+	allowed := make(map[string]bool, len(allowlist))
+	for _, name := range allowlist {
+		allowed[name] = true
+	}
+	return &scriptEnv{allowed: allowed}
+}
+
+// get returns the value of an allowlisted variable and whether it is set.
+func (e *scriptEnv) get(name string) (string, bool, error) {
+	if !e.allowed[name] {
+		return "", false, fmt.Errorf("environment variable %q is not in the script_env_allowlist setting", name)
+	}
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+// starlarkModule returns the env module of Starlark scripts: env.get(name, default=None).
+func (e *scriptEnv) starlarkModule() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "env",
+		Members: starlark.StringDict{
+			"get": starlark.NewBuiltin("env.get", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var name string
+				var fallback starlark.Value = starlark.None
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "default?", &fallback); err != nil {
+					return nil, err
+				}
+				value, ok, err := e.get(name)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				if !ok {
+					return fallback, nil
+				}
+				return starlark.String(value), nil
+			}),
+		},
+	}
+}
+
+// gojaObject returns the env object of JavaScript scripts: env.get(name, defaultValue), which returns
+// null for an unset variable without a default.
+func (e *scriptEnv) gojaObject(vm *goja.Runtime) *goja.Object {
+	obj := vm.NewObject()
+	_ = obj.Set("get", func(call goja.FunctionCall) goja.Value {
+		value, ok, err := e.get(call.Argument(0).String())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		if !ok {
+			if fallback := call.Argument(1); !goja.IsUndefined(fallback) {
+				return fallback
+			}
+			return goja.Null()
+		}
+		return vm.ToValue(value)
+	})
+	return obj
+}
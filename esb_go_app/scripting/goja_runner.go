@@ -1,6 +1,7 @@
 package scripting
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -13,40 +14,82 @@ import (
 type GojaRunner struct {
 	logger     *slog.Logger
 	httpClient *HTTPClient // Injected HTTP client
-	store      *storage.Store
+	store      storage.Store
+	limits     *liveLimits
+	env        *scriptEnv    // Allowlisted environment variables readable with env.get
+	databases  *sqlDatabases // Pools of the external databases collectors query with sql
+	files      *fileServers  // File servers collectors reach with sftp
+	mail       *mailer       // SMTP server of the admin settings used by mail.send
+	cache      *gojaCache    // Compiled scripts and idle VMs, keyed by scriptCacheKey
 }
 
 // NewGojaRunner creates a new GojaRunner instance.
-func NewGojaRunner(logger *slog.Logger, httpClient *HTTPClient, store *storage.Store) *GojaRunner {
+func NewGojaRunner(logger *slog.Logger, httpClient *HTTPClient, store storage.Store, limits Limits, envAllowlist []string) *GojaRunner {
 	return &GojaRunner{
 		logger:     logger,
 		httpClient: httpClient,
 		store:      store,
+		limits:     newLiveLimits(limits),
+		env:        newScriptEnv(envAllowlist),
+		databases:  newSQLDatabases(store),
+		files:      &fileServers{store: store, logger: logger},
+		mail:       &mailer{store: store},
+		cache:      newGojaCache(),
 	}
 }
 
-// Execute runs the JavaScript script.
-func (r *GojaRunner) Execute(script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}) (*TransformedMessage, error) {
-	vm := goja.New()
+// Execute runs the JavaScript script. A run that exceeds the time or memory limit is interrupted and
+// fails with ErrScriptTimeout or ErrScriptMemoryLimit. The VM of a successful run goes back to the pool
+// of its script, so the next message skips compiling and loading it.
+func (r *GojaRunner) Execute(namespace, script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}, scriptContext *ScriptContext) (*TransformedMessage, error) {
+	limits := r.limits.get()
+	key := scriptCacheKey(namespace, script)
+	vm := r.cache.take(key)
+	loaded := vm != nil
+	if loaded {
+		vm.ClearInterrupt() // A limit may have fired just as the previous run finished
+	} else {
+		vm = goja.New()
+		if limits.MaxCallDepth > 0 {
+			vm.SetMaxCallStackSize(limits.MaxCallDepth)
+		}
+	}
+	guard := startGuard(limits, func(reason error) { vm.Interrupt(reason) })
 
-	vm.Set("log", NewLogger(r.logger))
-	vm.Set("http", r.httpClient)
+	result, err := r.execute(vm, loaded, key, namespace, script, messageBody, messageHeaders, scriptContext)
+	guard.stop()
+	var stackErr *goja.StackOverflowError
+	if errors.As(err, &stackErr) {
+		return nil, fmt.Errorf("script call stack exceeded %d frames: %w", limits.MaxCallDepth, err)
+	}
+	if err = guard.wrap(err); err != nil {
+		return nil, err
+	}
+	r.cache.put(key, vm)
+	return result, nil
+}
 
-	jsBody := vm.ToValue(messageBody)
-	jsHeaders := vm.ToValue(messageHeaders)
+// PurgeCache drops the compiled scripts and pooled VMs, so the next runs load the scripts again.
+func (r *GojaRunner) PurgeCache() {
+	r.cache.purge()
+}
 
-	program, err := goja.Compile("script", script, false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to compile JavaScript script: %w", err)
-	}
-	_, err = vm.RunProgram(program)
-	if err != nil {
-		return nil, fmt.Errorf("failed to run JavaScript script: %w", err)
+// execute runs the transform or collect function of the script on the given VM, loading the script into
+// it first unless the VM comes from the pool.
+func (r *GojaRunner) execute(vm *goja.Runtime, loaded bool, key, namespace, script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}, scriptContext *ScriptContext) (*TransformedMessage, error) {
+	if !loaded {
+		if err := r.load(vm, key, namespace, script); err != nil {
+			return nil, err
+		}
 	}
 
+	jsBody := vm.ToValue(messageBody)
+	jsHeaders := vm.ToValue(messageHeaders)
+	jsContext := vm.ToValue(scriptContext.values())
+
 	// Handle 'transform' function for transformation routes
 	if transformFunc, ok := goja.AssertFunction(vm.Get("transform")); ok {
-		result, err := transformFunc(goja.Undefined(), jsBody, jsHeaders)
+		result, err := transformFunc(goja.Undefined(), jsBody, jsHeaders, jsContext)
 		if err != nil {
 			return nil, fmt.Errorf("failed to execute transform function: %w", err)
 		}
@@ -61,7 +104,7 @@ func (r *GojaRunner) Execute(script string, messageBody map[string]interface{},
 			return nil, fmt.Errorf("failed to export transform result: %w", err)
 		}
 
-		// The script is only responsible for the body now. Destination is ignored.
+		// The script returns the body and may choose the destination channel and the priority.
 		transformedBody, _ := resultObj["body"].(map[string]interface{})
 
 		// If body is not returned, treat as null/filter
@@ -69,15 +112,35 @@ func (r *GojaRunner) Execute(script string, messageBody map[string]interface{},
 			return nil, nil
 		}
 
+		priority, err := parsePriority(resultObj)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform result: %w", err)
+		}
+		destination, err := parseDestination(resultObj)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform result: %w", err)
+		}
+		headers, err := parseHeaders(resultObj, messageHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform result: %w", err)
+		}
+		props, err := parseProperties(resultObj)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform result: %w", err)
+		}
+
 		return &TransformedMessage{
-			Body:    transformedBody,
-			Headers: messageHeaders, // Headers are passed through for now
+			Body:        transformedBody,
+			Headers:     headers,
+			Destination: destination,
+			Priority:    priority,
+			Properties:  props,
 		}, nil
 	}
 
 	// Handle 'collect' function for collector jobs
 	if collectFunc, ok := goja.AssertFunction(vm.Get("collect")); ok {
-		result, err := collectFunc(goja.Undefined())
+		result, err := collectFunc(goja.Undefined(), jsContext)
 		if err != nil {
 			return nil, fmt.Errorf("failed to execute collect function: %w", err)
 		}
@@ -86,20 +149,36 @@ func (r *GojaRunner) Execute(script string, messageBody map[string]interface{},
 			return nil, nil // No data collected
 		}
 
-		// For now, we only support returning a single message object from a collector script.
-		var resultObj map[string]interface{}
-		if err := vm.ExportTo(result, &resultObj); err != nil {
-			return nil, fmt.Errorf("failed to export collect result into a message object: %w", err)
-		}
-
-		if len(resultObj) > 0 {
-			return &TransformedMessage{
-				Body:    resultObj,
-				Headers: make(map[string]interface{}), // Collectors start with fresh headers
-			}, nil
-		}
-		return nil, nil // No data in the object
+		// A collector returns the body of one message, or a list of bodies to publish one message each.
+		return collectedMessage(result.Export())
 	}
 
 	return nil, fmt.Errorf("script must define a 'transform' or 'collect' function")
 }
+
+// load sets the global objects of the scripts on a new VM and runs the top-level code of the script.
+func (r *GojaRunner) load(vm *goja.Runtime, key, namespace, script string) error {
+	vm.Set("log", NewLogger(r.logger))
+	vm.Set("http", r.httpClient)
+	vm.Set("require", r.gojaRequire(vm))
+	vm.Set("xml", gojaXML(vm))
+	vm.Set("csv", gojaCSV(vm))
+	vm.Set("soap", r.gojaSOAP(vm))
+	vm.Set("mail", r.gojaMail(vm))
+	vm.Set("crypto", gojaCrypto(vm))
+	vm.Set("env", r.env.gojaObject(vm))
+	vm.Set("kv", gojaState(vm, newScriptState(r.store, namespace)))
+	if storage.IsCollectorStateNamespace(namespace) {
+		vm.Set("sql", r.gojaSQL(vm))
+		vm.Set("sftp", r.gojaSFTP(vm))
+	}
+
+	program, err := r.cache.program(key, script)
+	if err != nil {
+		return fmt.Errorf("failed to compile JavaScript script: %w", err)
+	}
+	if _, err := vm.RunProgram(program); err != nil {
+		return fmt.Errorf("failed to run JavaScript script: %w", err)
+	}
+	return nil
+}
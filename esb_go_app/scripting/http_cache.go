@@ -0,0 +1,108 @@
+package scripting
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"esb-go-app/metrics"
+)
+
+const (
+	// maxHTTPCacheEntries bounds the responses the HTTP client keeps cached; expired entries are dropped
+	// first when the cache is full.
+	maxHTTPCacheEntries = 1024
+	// maxCachedResponseBytes is the largest response body that is cached. Reference data bigger than
+	// this is fetched on every call rather than pinned in memory.
+	maxCachedResponseBytes = 1 << 20
+	// MaxHTTPCacheTTL caps the cache_ttl_ms a script can ask for.
+	MaxHTTPCacheTTL = 24 * time.Hour
+)
+
+// httpCache keeps successful GET responses for the TTL the calling script chose, so transformations
+// that look up the same reference data for every message call the external API once per TTL. Entries
+// are shared by all scripts: the key covers the URL and every request header, credentials included.
+type httpCache struct {
+	mu      sync.Mutex
+	entries map[string]httpCacheEntry
+}
+
+type httpCacheEntry struct {
+	response *HTTPResponse
+	expires  time.Time
+}
+
+func newHTTPCache() *httpCache {
+	return &httpCache{entries: make(map[string]httpCacheEntry)}
+}
+
+// httpCacheKey identifies a GET request by its URL and headers, in a stable order.
+func httpCacheKey(url string, headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	h.Write([]byte(url))
+	for _, name := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(headers[name]))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns a copy of the cached response, or nil when there is none or it expired.
+func (c *httpCache) get(key string) *HTTPResponse {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		metrics.ScriptHTTPCache.WithLabelValues("miss").Inc()
+		return nil
+	}
+	metrics.ScriptHTTPCache.WithLabelValues("hit").Inc()
+	return copyHTTPResponse(entry.response)
+}
+
+// put caches a 2xx response without an error for the given TTL.
+func (c *httpCache) put(key string, resp *HTTPResponse, ttl time.Duration) {
+	if resp.Error != "" || resp.StatusCode < 200 || resp.StatusCode > 299 || len(resp.Body) > maxCachedResponseBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxHTTPCacheEntries {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// Still full: drop an arbitrary entry, which only costs one more call to its API.
+		for k := range c.entries {
+			if len(c.entries) < maxHTTPCacheEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = httpCacheEntry{response: copyHTTPResponse(resp), expires: time.Now().Add(ttl)}
+}
+
+// copyHTTPResponse copies a response, so a script changing the headers of its result cannot change the cache.
+func copyHTTPResponse(resp *HTTPResponse) *HTTPResponse {
+	headers := make(map[string]string, len(resp.Headers))
+	for k, v := range resp.Headers {
+		headers[k] = v
+	}
+	return &HTTPResponse{StatusCode: resp.StatusCode, Body: resp.Body, Headers: headers, Error: resp.Error}
+}
@@ -0,0 +1,208 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrHostNotAllowed is returned for script HTTP calls to a host the host policy does not allow.
+var ErrHostNotAllowed = errors.New("host is not allowed for script HTTP calls")
+
+// privateHostsRule is the policy entry matching loopback, private, link-local (including cloud metadata
+// endpoints) and unspecified addresses.
+const privateHostsRule = "private"
+
+// hostRule is one entry of the allowed or denied hosts: a host name, a *.domain wildcard, an IP address,
+// a CIDR network or "private".
+type hostRule struct {
+	name    string     // Lower-case host name, or the domain with its leading dot for a wildcard
+	network *net.IPNet // Set for IP and CIDR entries
+	private bool
+}
+
+func parseHostRules(entries []string) ([]hostRule, error) {
+	rules := make([]hostRule, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == privateHostsRule:
+			rules = append(rules, hostRule{private: true})
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+			}
+			rules = append(rules, hostRule{network: network})
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			rules = append(rules, hostRule{network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}})
+		case strings.HasPrefix(entry, "*."):
+			rules = append(rules, hostRule{name: entry[1:]})
+		default:
+			rules = append(rules, hostRule{name: entry})
+		}
+	}
+	return rules, nil
+}
+
+func (r hostRule) matchesName(host string) bool {
+	if r.name == "" {
+		return false
+	}
+	if strings.HasPrefix(r.name, ".") {
+		return strings.HasSuffix(host, r.name)
+	}
+	return host == r.name
+}
+
+func (r hostRule) matchesIP(ip net.IP) bool {
+	if r.private {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+	}
+	return r.network != nil && r.network.Contains(ip)
+}
+
+// hostPolicy decides which hosts script HTTP calls may reach. A denied host is never reached; when
+// allowed hosts are configured, a host must match one of them by name or with every address it
+// resolves to.
+type hostPolicy struct {
+	allowed []hostRule
+	denied  []hostRule
+}
+
+// check evaluates a host and its resolved addresses. Without addresses, as for the URL of a call that
+// goes through a proxy, only the name rules and a literal IP host can be checked.
+func (p *hostPolicy) check(host string, ips []net.IP) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	}
+	for _, rule := range p.denied {
+		if rule.matchesName(host) {
+			return fmt.Errorf("%w: %s is denied", ErrHostNotAllowed, host)
+		}
+		for _, ip := range ips {
+			if !rule.matchesIP(ip) {
+				continue
+			}
+			if ip.String() == host {
+				return fmt.Errorf("%w: %s is denied", ErrHostNotAllowed, host)
+			}
+			return fmt.Errorf("%w: %s resolves to the denied address %s", ErrHostNotAllowed, host, ip)
+		}
+	}
+	if len(p.allowed) == 0 {
+		return nil
+	}
+	for _, rule := range p.allowed {
+		if rule.matchesName(host) {
+			return nil
+		}
+	}
+	if len(ips) == 0 {
+		return p.namesOnly(host)
+	}
+	for _, ip := range ips {
+		allowed := false
+		for _, rule := range p.allowed {
+			if rule.matchesIP(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %s is not in the allowed hosts", ErrHostNotAllowed, host)
+		}
+	}
+	return nil
+}
+
+// namesOnly handles a host that did not match an allowed name before it is resolved: it may still be
+// allowed by an address rule once resolved, so only a policy without address rules rejects it here.
+func (p *hostPolicy) namesOnly(host string) error {
+	for _, rule := range p.allowed {
+		if rule.network != nil || rule.private {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not in the allowed hosts", ErrHostNotAllowed, host)
+}
+
+// checkURL checks the host of a request URL before it is sent and before a redirect is followed.
+func (p *hostPolicy) checkURL(u *url.URL) error {
+	return p.check(u.Hostname(), nil)
+}
+
+// dialContext resolves the host, checks every address and connects to a checked one, so a DNS answer
+// that changes between the check and the connection cannot lead a script to a denied address.
+func (p *hostPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ips := make([]net.IP, len(addrs))
+		for i, a := range addrs {
+			ips[i] = a.IP
+		}
+		if err := p.check(host, ips); err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// RestrictHosts limits the hosts the scripts can call. Entries are host names, *.domain wildcards, IP
+// addresses, CIDR networks or "private" for loopback, private and link-local addresses. An empty allowed
+// list allows every host that is not denied. It must be called before scripts run.
+func (c *HTTPClient) RestrictHosts(allowed, denied []string) error {
+	allowedRules, err := parseHostRules(allowed)
+	if err != nil {
+		return fmt.Errorf("allowed hosts: %w", err)
+	}
+	deniedRules, err := parseHostRules(denied)
+	if err != nil {
+		return fmt.Errorf("denied hosts: %w", err)
+	}
+	if len(allowedRules) == 0 && len(deniedRules) == 0 {
+		return nil
+	}
+	policy := &hostPolicy{allowed: allowedRules, denied: deniedRules}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = policy.dialContext(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+	c.Client.Transport = transport
+	c.Client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return policy.checkURL(req.URL)
+	}
+	c.hosts = policy
+	c.Logger.Info("script HTTP hosts restricted", "allowed", len(allowedRules), "denied", len(deniedRules))
+	return nil
+}
@@ -0,0 +1,123 @@
+package scripting
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"esb-go-app/storage"
+
+	"github.com/dop251/goja"
+	"go.starlark.net/starlark"
+)
+
+// lookupLibrary finds the script library a script of the given engine imports by name.
+func lookupLibrary(store storage.Store, engine, name string) (*storage.ScriptLibrary, error) {
+	if store == nil {
+		return nil, fmt.Errorf("script libraries are not available")
+	}
+	lib, err := store.GetScriptLibraryByName(engine, strings.TrimSpace(name))
+	if err != nil {
+		return nil, err
+	}
+	if lib == nil {
+		return nil, fmt.Errorf("no %s library with this name", engine)
+	}
+	return lib, nil
+}
+
+// Imports of a library by a literal name: require("name") in JavaScript and load("name", ...) in Starlark.
+var (
+	gojaRequirePattern  = regexp.MustCompile(`\brequire\(\s*["']([^"']+)["']\s*\)`)
+	starlarkLoadPattern = regexp.MustCompile(`\bload\(\s*["']([^"']+)["']`)
+)
+
+// ImportedLibraries returns the names of the script libraries a script of the given engine imports, in
+// the order of their first import. Only literal names are found, not names computed when the script runs.
+func ImportedLibraries(engine, script string) []string {
+	var pattern *regexp.Regexp
+	switch engine {
+	case "javascript":
+		pattern = gojaRequirePattern
+	case "starlark":
+		pattern = starlarkLoadPattern
+	default:
+		return nil
+	}
+	var names []string
+	for _, match := range pattern.FindAllStringSubmatch(script, -1) {
+		if name := strings.TrimSpace(match[1]); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// starlarkModule is a library loaded during a Starlark run. The loader caches a nil module while the
+// library is still being loaded, so an import cycle can be reported instead of looping.
+type starlarkModule struct {
+	globals starlark.StringDict
+	err     error
+}
+
+// starlarkLoader returns the thread Load function that resolves load("name", ...) statements to script
+// libraries. Every library is executed once per run with the same predeclared modules as the script.
+func (r *StarlarkRunner) starlarkLoader(predeclared starlark.StringDict) func(*starlark.Thread, string) (starlark.StringDict, error) {
+	cache := make(map[string]*starlarkModule)
+	return func(thread *starlark.Thread, name string) (starlark.StringDict, error) {
+		if m, ok := cache[name]; ok {
+			if m == nil {
+				return nil, fmt.Errorf("import cycle")
+			}
+			return m.globals, m.err
+		}
+		cache[name] = nil
+
+		m := &starlarkModule{}
+		lib, err := lookupLibrary(r.store, "starlark", name)
+		if err != nil {
+			m.err = err
+		} else {
+			m.globals, m.err = starlark.ExecFile(thread, lib.Name, lib.Script, predeclared)
+		}
+		cache[name] = m
+		return m.globals, m.err
+	}
+}
+
+// gojaRequire returns the require function of a JavaScript run. A library sets its exports on
+// module.exports or exports like a CommonJS module, and is executed once per run.
+func (r *GojaRunner) gojaRequire(vm *goja.Runtime) func(goja.FunctionCall) goja.Value {
+	modules := make(map[string]*goja.Object)
+	return func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0).String()
+		if module, ok := modules[name]; ok {
+			return module.Get("exports") // Also breaks import cycles with the exports set so far
+		}
+
+		lib, err := lookupLibrary(r.store, "javascript", name)
+		if err != nil {
+			panic(vm.NewGoError(fmt.Errorf("cannot load library %q: %w", name, err)))
+		}
+		program, err := goja.Compile(lib.Name, "(function(module, exports) {\n"+lib.Script+"\n})", false)
+		if err != nil {
+			panic(vm.NewGoError(fmt.Errorf("failed to compile library %q: %w", name, err)))
+		}
+		wrapper, err := vm.RunProgram(program)
+		if err != nil {
+			panic(vm.NewGoError(fmt.Errorf("failed to load library %q: %w", name, err)))
+		}
+		fn, _ := goja.AssertFunction(wrapper)
+
+		module := vm.NewObject()
+		exports := vm.NewObject()
+		_ = module.Set("exports", exports)
+		modules[name] = module
+		if _, err := fn(goja.Undefined(), module, exports); err != nil {
+			delete(modules, name)
+			panic(vm.NewGoError(fmt.Errorf("failed to load library %q: %w", name, err)))
+		}
+		return module.Get("exports")
+	}
+}
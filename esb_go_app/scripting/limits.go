@@ -0,0 +1,144 @@
+package scripting
+
+import (
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"esb-go-app/storage"
+)
+
+// ErrScriptTimeout is returned when a script runs longer than the configured time limit.
+var ErrScriptTimeout = errors.New("script execution time limit exceeded")
+
+// ErrScriptMemoryLimit is returned when the heap grows by more than the configured limit during a script run.
+var ErrScriptMemoryLimit = errors.New("script memory limit exceeded")
+
+// memoryCheckInterval is how often the heap is sampled while a script with a memory limit runs.
+const memoryCheckInterval = 20 * time.Millisecond
+
+// heapMetric is the runtime metric sampled by the memory guard: bytes of heap objects not yet freed by the GC.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Limits are the guard rails applied to every script run.
+type Limits struct {
+	Timeout      time.Duration // Maximum duration of a script run, including its transform or collect call; 0 disables it
+	MaxMemory    uint64        // Heap growth allowed during a script run in bytes; 0 disables it
+	MaxCallDepth int           // Maximum JavaScript call stack depth; 0 keeps the engine default
+}
+
+// Setting keys of the script limits, which override the limits of the configuration file.
+const (
+	SettingScriptTimeout      = "script_timeout"
+	SettingScriptMaxMemoryMB  = "script_max_memory_mb"
+	SettingScriptMaxCallDepth = "script_max_call_depth"
+)
+
+// LimitSettings returns the definitions of the script limit settings, defaulting to the given limits.
+func LimitSettings(defaults Limits) []storage.SettingDefinition {
+	return []storage.SettingDefinition{
+		{Key: SettingScriptTimeout, Type: storage.SettingDuration, Default: defaults.Timeout.String(), Min: 0, Max: int64(time.Hour)},
+		{Key: SettingScriptMaxMemoryMB, Type: storage.SettingInt, Default: fmt.Sprint(defaults.MaxMemory >> 20), Min: 0, Max: 64 << 10},
+		{Key: SettingScriptMaxCallDepth, Type: storage.SettingInt, Default: fmt.Sprint(defaults.MaxCallDepth), Min: 0, Max: 1000000},
+	}
+}
+
+// liveLimits holds the limits of a runner, which the settings can change while scripts run.
+type liveLimits struct {
+	p atomic.Pointer[Limits]
+}
+
+func newLiveLimits(limits Limits) *liveLimits {
+	l := &liveLimits{}
+	l.set(limits)
+	return l
+}
+
+func (l *liveLimits) get() Limits {
+	return *l.p.Load()
+}
+
+func (l *liveLimits) set(limits Limits) {
+	l.p.Store(&limits)
+}
+
+// scriptGuard interrupts a script run once it passes its time or memory limit. The heap is shared by the
+// whole process, so the memory limit is approximate: it is measured as the growth since the run started.
+type scriptGuard struct {
+	limits Limits
+	timer  *time.Timer
+	done   chan struct{}
+
+	mu     sync.Mutex
+	reason error // Why the run was interrupted, nil while it is within its limits
+}
+
+// startGuard starts watching a script run and calls interrupt with the reason once a limit is exceeded.
+func startGuard(limits Limits, interrupt func(reason error)) *scriptGuard {
+	g := &scriptGuard{limits: limits, done: make(chan struct{})}
+	fire := func(reason error) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.reason != nil {
+			return
+		}
+		g.reason = reason
+		interrupt(reason)
+	}
+
+	if limits.Timeout > 0 {
+		g.timer = time.AfterFunc(limits.Timeout, func() {
+			fire(fmt.Errorf("%w (%s)", ErrScriptTimeout, limits.Timeout))
+		})
+	}
+	if limits.MaxMemory > 0 {
+		go func() {
+			start := heapObjectsBytes()
+			ticker := time.NewTicker(memoryCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if heap := heapObjectsBytes(); heap > start && heap-start > limits.MaxMemory {
+						fire(fmt.Errorf("%w (%d MB)", ErrScriptMemoryLimit, limits.MaxMemory>>20))
+						return
+					}
+				case <-g.done:
+					return
+				}
+			}
+		}()
+	}
+	return g
+}
+
+// stop releases the timer and the memory watcher of a finished run.
+func (g *scriptGuard) stop() {
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	close(g.done)
+}
+
+// wrap replaces the error of an interrupted run with the limit it exceeded.
+func (g *scriptGuard) wrap(err error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil && g.reason != nil {
+		return g.reason
+	}
+	return err
+}
+
+// heapObjectsBytes returns the current size of the heap objects of the process.
+func heapObjectsBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
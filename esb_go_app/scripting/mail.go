@@ -0,0 +1,296 @@
+package scripting
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"esb-go-app/storage"
+
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	// maxMailRecipients bounds the to, cc and bcc addresses of one message together.
+	maxMailRecipients = 50
+	// defaultMailTimeout bounds sending a message when the script run itself has no time limit.
+	defaultMailTimeout = 30 * time.Second
+)
+
+// mailer sends the messages of the mail module through the SMTP server of the admin settings. The
+// settings are read on every send, so a changed server applies without restarting the service.
+type mailer struct {
+	store storage.Store
+}
+
+// mailMessage is one message a script sends.
+type mailMessage struct {
+	To      []string
+	Cc      []string
+	Bcc     []string
+	From    string // Overrides the sender of the settings
+	ReplyTo string
+	Subject string
+	Body    string
+	HTML    bool
+}
+
+// send validates the message and delivers it to the SMTP server.
+func (m *mailer) send(timeout time.Duration, msg mailMessage) error {
+	if m.store == nil {
+		return fmt.Errorf("mail is not available")
+	}
+	settings, err := m.store.GetMailSettings()
+	if err != nil {
+		return err
+	}
+	if settings.Host == "" {
+		return fmt.Errorf("mail is not configured: set the SMTP server in the admin settings")
+	}
+	if msg.From == "" {
+		msg.From = settings.From
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", msg.From, err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("subject must be a single line")
+	}
+
+	headers := [][2]string{{"From", from.String()}}
+	var recipients []string
+	for _, field := range []struct {
+		header    string
+		addresses []string
+	}{{"To", msg.To}, {"Cc", msg.Cc}, {"Bcc", msg.Bcc}} {
+		var formatted []string
+		for _, text := range field.addresses {
+			addr, err := mail.ParseAddress(text)
+			if err != nil {
+				return fmt.Errorf("invalid %s address %q: %w", strings.ToLower(field.header), text, err)
+			}
+			formatted = append(formatted, addr.String())
+			recipients = append(recipients, addr.Address)
+		}
+		// Bcc recipients get the message without being listed in it.
+		if len(formatted) > 0 && field.header != "Bcc" {
+			headers = append(headers, [2]string{field.header, strings.Join(formatted, ", ")})
+		}
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("the message has no recipients")
+	}
+	if len(recipients) > maxMailRecipients {
+		return fmt.Errorf("the message has %d recipients, at most %d are allowed", len(recipients), maxMailRecipients)
+	}
+	if msg.ReplyTo != "" {
+		replyTo, err := mail.ParseAddress(msg.ReplyTo)
+		if err != nil {
+			return fmt.Errorf("invalid reply_to address %q: %w", msg.ReplyTo, err)
+		}
+		headers = append(headers, [2]string{"Reply-To", replyTo.String()})
+	}
+
+	if timeout <= 0 {
+		timeout = defaultMailTimeout
+	}
+	return deliverMail(settings, timeout, from.Address, recipients, buildMail(headers, from.Address, msg))
+}
+
+// buildMail renders the message with a UTF-8 subject and a base64 body, so any text survives transport.
+func buildMail(headers [][2]string, sender string, msg mailMessage) []byte {
+	domain := sender[strings.LastIndex(sender, "@")+1:]
+	contentType := "text/plain"
+	if msg.HTML {
+		contentType = "text/html"
+	}
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		[2]string{"Date", time.Now().Format(time.RFC1123Z)},
+		[2]string{"Message-ID", "<" + uuid.NewString() + "@" + domain + ">"},
+		[2]string{"MIME-Version", "1.0"},
+		[2]string{"Content-Type", contentType + "; charset=utf-8"},
+		[2]string{"Content-Transfer-Encoding", "base64"},
+	)
+
+	var buf bytes.Buffer
+	for _, h := range headers {
+		buf.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// deliverMail runs one SMTP session. The deadline of the connection covers the whole session.
+func deliverMail(settings *storage.MailSettings, timeout time.Duration, sender string, recipients []string, message []byte) error {
+	addr := net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port))
+	tlsConfig := &tls.Config{ServerName: settings.Host}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if settings.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, settings.Host)
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+	if settings.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if settings.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(sender); err != nil {
+		return fmt.Errorf("SMTP server rejected sender %s: %w", sender, err)
+	}
+	for _, rcpt := range recipients {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP server rejected recipient %s: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return client.Quit()
+}
+
+// mailAddresses reads a recipient argument: one address or a list of addresses.
+func mailAddresses(v interface{}) ([]string, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if val == "" {
+			return nil, nil
+		}
+		return []string{val}, nil
+	case []interface{}:
+		addresses := make([]string, 0, len(val))
+		for _, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("addresses must be strings, got %T", item)
+			}
+			addresses = append(addresses, s)
+		}
+		return addresses, nil
+	default:
+		return nil, fmt.Errorf("expected an address or a list of addresses, got %T", v)
+	}
+}
+
+// starlarkMail returns the mail module of Starlark scripts:
+// mail.send(to, subject, body, cc=None, bcc=None, html=False, reply_to="", sender="").
+func (r *StarlarkRunner) starlarkMail() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "mail",
+		Members: starlark.StringDict{
+			"send": starlark.NewBuiltin("mail.send", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var msg mailMessage
+				var to, cc, bcc starlark.Value = starlark.None, starlark.None, starlark.None
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+					"to", &to, "subject", &msg.Subject, "body", &msg.Body,
+					"cc?", &cc, "bcc?", &bcc, "html?", &msg.HTML, "reply_to?", &msg.ReplyTo, "sender?", &msg.From); err != nil {
+					return nil, err
+				}
+				for name, field := range map[string]struct {
+					value starlark.Value
+					dest  *[]string
+				}{"to": {to, &msg.To}, "cc": {cc, &msg.Cc}, "bcc": {bcc, &msg.Bcc}} {
+					goVal, err := fromStarlarkValue(field.value)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %s: %w", fn.Name(), name, err)
+					}
+					if *field.dest, err = mailAddresses(goVal); err != nil {
+						return nil, fmt.Errorf("%s: %s: %w", fn.Name(), name, err)
+					}
+				}
+				if err := r.mail.send(r.limits.get().Timeout, msg); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+		},
+	}
+}
+
+// gojaMail returns the mail object of JavaScript scripts: mail.send(to, subject, body, options), where
+// the options are cc, bcc, html, reply_to and from.
+func (r *GojaRunner) gojaMail(vm *goja.Runtime) *goja.Object {
+	obj := vm.NewObject()
+	_ = obj.Set("send", func(call goja.FunctionCall) goja.Value {
+		msg := mailMessage{Subject: call.Argument(1).String(), Body: call.Argument(2).String()}
+		var err error
+		if msg.To, err = mailAddresses(call.Argument(0).Export()); err != nil {
+			panic(vm.NewGoError(fmt.Errorf("to: %w", err)))
+		}
+		if arg := call.Argument(3); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			for k, v := range arg.ToObject(vm).Export().(map[string]interface{}) {
+				switch k {
+				case "cc":
+					msg.Cc, err = mailAddresses(v)
+				case "bcc":
+					msg.Bcc, err = mailAddresses(v)
+				case "html":
+					msg.HTML, _ = v.(bool)
+				case "reply_to":
+					msg.ReplyTo = fmt.Sprint(v)
+				case "from":
+					msg.From = fmt.Sprint(v)
+				default:
+					err = fmt.Errorf("unknown option")
+				}
+				if err != nil {
+					panic(vm.NewGoError(fmt.Errorf("%s: %w", k, err)))
+				}
+			}
+		}
+		if err := r.mail.send(r.limits.get().Timeout, msg); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return goja.Undefined()
+	})
+	return obj
+}
@@ -2,23 +2,257 @@ package scripting
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 // TransformedMessage represents the output of a transformation or collector script.
 type TransformedMessage struct {
 	Body        map[string]interface{}
-	Headers     map[string]interface{}
-	Destination string // The destination channel name for routing
+	Headers     map[string]interface{} // Message headers with the changes of the optional "headers" map returned by the script
+	Destination string                 // Optional destination channel name or ID returned by the script as "destination"
+	Priority    *int                   // Optional AMQP priority (0-255) returned by the script as "priority"
+	Properties  MessageProperties      // Optional AMQP properties returned by the script
+	Messages    []*TransformedMessage  // Messages of a collect function that returned a list, Body is nil then
+}
+
+// MessageProperties are the AMQP properties a script result can set next to the body. Empty fields keep
+// the property of the incoming message, or the default of the collector.
+type MessageProperties struct {
+	ContentType   string // "content_type"
+	MessageID     string // "message_id"
+	CorrelationID string // "correlation_id"
+	Expiration    string // "expiration", the per-message TTL in milliseconds
+}
+
+// parseProperties reads the optional AMQP properties of a script result. The expiration may be given as
+// a number of milliseconds or as the string AMQP carries.
+func parseProperties(result map[string]interface{}) (MessageProperties, error) {
+	var props MessageProperties
+	for key, field := range map[string]*string{
+		"content_type":   &props.ContentType,
+		"message_id":     &props.MessageID,
+		"correlation_id": &props.CorrelationID,
+	} {
+		raw, ok := result[key]
+		if !ok || raw == nil {
+			continue
+		}
+		value, ok := raw.(string)
+		if !ok {
+			return props, fmt.Errorf("%s must be a string, got %T", key, raw)
+		}
+		*field = strings.TrimSpace(value)
+	}
+
+	var expiration int64
+	switch v := result["expiration"].(type) {
+	case nil:
+		return props, nil
+	case int64:
+		expiration = v
+	case float64:
+		expiration = int64(v)
+	case string:
+		parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return props, fmt.Errorf("expiration must be a number of milliseconds, got %q", v)
+		}
+		expiration = parsed
+	default:
+		return props, fmt.Errorf("expiration must be a number of milliseconds, got %T", v)
+	}
+	if expiration < 0 {
+		return props, fmt.Errorf("expiration must not be negative, got %d", expiration)
+	}
+	props.Expiration = strconv.FormatInt(expiration, 10)
+	return props, nil
+}
+
+// collectEnvelopeKeys are the keys next to "body" that make a collected dict a message envelope.
+var collectEnvelopeKeys = map[string]bool{
+	"body": true, "headers": true, "priority": true,
+	"content_type": true, "message_id": true, "correlation_id": true, "expiration": true,
+}
+
+// collectedItem turns one collected dict into a message. A dict with a "body" dict and only the keys of
+// collectEnvelopeKeys is an envelope that sets the headers and properties of the message like a transform
+// result; any other dict is the body itself.
+func collectedItem(item map[string]interface{}) (*TransformedMessage, error) {
+	body, isEnvelope := item["body"].(map[string]interface{})
+	for key := range item {
+		if !collectEnvelopeKeys[key] {
+			isEnvelope = false
+			break
+		}
+	}
+	if !isEnvelope {
+		return &TransformedMessage{Body: item, Headers: make(map[string]interface{})}, nil
+	}
+
+	priority, err := parsePriority(item)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := parseHeaders(item, make(map[string]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	props, err := parseProperties(item)
+	if err != nil {
+		return nil, err
+	}
+	return &TransformedMessage{Body: body, Headers: headers, Priority: priority, Properties: props}, nil
+}
+
+// collectedMessage turns the result of a collect function into the collected message. A dict is a single
+// message and a list of dicts one message each, see collectedItem. Empty dicts carry no data and are
+// skipped, so a run that collected nothing returns nil.
+func collectedMessage(result interface{}) (*TransformedMessage, error) {
+	switch v := result.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		msg, err := collectedItem(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collect result: %w", err)
+		}
+		return msg, nil
+	case []interface{}:
+		messages := make([]*TransformedMessage, 0, len(v))
+		for i, item := range v {
+			body, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("collect result item %d must be a dict, got %T", i, item)
+			}
+			if len(body) == 0 {
+				continue
+			}
+			msg, err := collectedItem(body)
+			if err != nil {
+				return nil, fmt.Errorf("invalid collect result item %d: %w", i, err)
+			}
+			messages = append(messages, msg)
+		}
+		if len(messages) == 0 {
+			return nil, nil
+		}
+		return &TransformedMessage{Messages: messages, Headers: make(map[string]interface{})}, nil
+	default:
+		return nil, fmt.Errorf("collect result must be a dict or a list of dicts, got %T", result)
+	}
+}
+
+// parsePriority reads the optional "priority" field of a script result.
+func parsePriority(result map[string]interface{}) (*int, error) {
+	raw, ok := result["priority"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	var priority int
+	switch v := raw.(type) {
+	case int:
+		priority = v
+	case int64:
+		priority = int(v)
+	case float64:
+		priority = int(v)
+	default:
+		return nil, fmt.Errorf("priority must be a number, got %T", raw)
+	}
+	if priority < 0 || priority > 255 {
+		return nil, fmt.Errorf("priority must be between 0 and 255, got %d", priority)
+	}
+	return &priority, nil
+}
+
+// parseDestination reads the optional "destination" field of a script result.
+func parseDestination(result map[string]interface{}) (string, error) {
+	raw, ok := result["destination"]
+	if !ok || raw == nil {
+		return "", nil
+	}
+	destination, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("destination must be a channel name or ID, got %T", raw)
+	}
+	return strings.TrimSpace(destination), nil
+}
+
+// parseHeaders applies the optional "headers" map of a script result to the message headers. Returned
+// headers are added or replace existing ones, a header set to null is removed and headers the script does
+// not mention are kept. Values must be strings, numbers, booleans, or lists and maps of them, so they can
+// be sent as AMQP headers.
+func parseHeaders(result map[string]interface{}, messageHeaders map[string]interface{}) (map[string]interface{}, error) {
+	raw, ok := result["headers"]
+	if !ok || raw == nil {
+		return messageHeaders, nil
+	}
+	returned, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("headers must be a map of header names to values, got %T", raw)
+	}
+
+	headers := make(map[string]interface{}, len(messageHeaders)+len(returned))
+	for k, v := range messageHeaders {
+		headers[k] = v
+	}
+	for k, v := range returned {
+		if v == nil {
+			delete(headers, k)
+			continue
+		}
+		if orig, ok := messageHeaders[k]; ok && reflect.DeepEqual(orig, v) {
+			continue // Passed through unchanged, possibly with an AMQP type the scripts cannot create
+		}
+		if err := validateHeaderValue(v); err != nil {
+			return nil, fmt.Errorf("header %q: %w", k, err)
+		}
+		headers[k] = v
+	}
+	return headers, nil
+}
+
+// validateHeaderValue checks that a header value returned by a script can be encoded as an AMQP field.
+func validateHeaderValue(v interface{}) error {
+	switch val := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return nil
+	case []interface{}:
+		for _, item := range val {
+			if err := validateHeaderValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for _, item := range val {
+			if err := validateHeaderValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("value must be a string, number, boolean, list or map, got %T", v)
+	}
 }
 
 // Runner defines the interface for executing a script.
-// It takes the script code, the message body, and message headers as input.
+// It takes the state namespace, the script code, the message body, message headers and the context
+// of the route or collector running the script as input.
 // It returns a TransformedMessage or an error.
 type Runner interface {
-	Execute(script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}) (*TransformedMessage, error)
+	Execute(namespace, script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}, scriptContext *ScriptContext) (*TransformedMessage, error)
 }
 
 // Logger is a simplified logger interface for scripts
@@ -48,8 +282,11 @@ func NewLogger(logger *slog.Logger) *Logger {
 
 // HTTPClient is a wrapper for net/http.Client to be injected into scripts.
 type HTTPClient struct {
-	Client *http.Client
-	Logger *slog.Logger
+	Client   *http.Client
+	Logger   *slog.Logger
+	Defaults HTTPOptions // Timeout and retries of calls that do not pass their own options
+	cache    *httpCache  // GET responses kept for the cache_ttl_ms of the calls that asked for it
+	hosts    *hostPolicy // Hosts the scripts may call, nil when every host is allowed
 }
 
 type HTTPResponse struct {
@@ -59,81 +296,144 @@ type HTTPResponse struct {
 	Error      string
 }
 
-// NewHTTPClient creates a new HTTPClient with a default timeout.
-func NewHTTPClient(logger *slog.Logger) *HTTPClient {
+// HTTPOptions controls the timeout, retries and caching of a script HTTP call.
+type HTTPOptions struct {
+	Timeout  time.Duration // Timeout of a single attempt
+	Retries  int           // Extra attempts after a network error or a 5xx/429 response
+	Backoff  time.Duration // Delay before the first retry, doubled for each next one
+	CacheTTL time.Duration // How long a successful GET response is reused, 0 disables caching
+}
+
+// MaxHTTPRetries caps the retries a script can ask for, so a single call cannot stall a collector for long.
+const MaxHTTPRetries = 10
+
+// NewHTTPClient creates a new HTTPClient with the given default options. A zero timeout falls back to 10s.
+func NewHTTPClient(logger *slog.Logger, defaults HTTPOptions) *HTTPClient {
+	if defaults.Timeout <= 0 {
+		defaults.Timeout = 10 * time.Second
+	}
 	return &HTTPClient{
-		Client: &http.Client{
-			Timeout: 10 * time.Second, // Default timeout
-		},
-		Logger: logger,
+		Client:   &http.Client{}, // Timeouts are set per call
+		Logger:   logger,
+		Defaults: defaults,
+		cache:    newHTTPCache(),
 	}
 }
 
 // Get performs an HTTP GET request.
-func (c *HTTPClient) Get(url string, headers map[string]string) *HTTPResponse {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		c.Logger.Error("failed to create GET request", "error", err, "url", url)
-		return &HTTPResponse{Error: err.Error()}
-	}
+func (c *HTTPClient) Get(url string, headers map[string]string, options ...map[string]interface{}) *HTTPResponse {
+	return c.Do("GET", url, headers, "", options...)
+}
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
+// Post performs an HTTP POST request.
+func (c *HTTPClient) Post(url string, headers map[string]string, body string, options ...map[string]interface{}) *HTTPResponse {
+	return c.Do("POST", url, headers, body, options...)
+}
 
-	resp, err := c.Client.Do(req)
-	if err != nil {
-		c.Logger.Error("failed to perform GET request", "error", err, "url", url)
-		return &HTTPResponse{Error: err.Error()}
-	}
-	defer resp.Body.Close()
+// Put performs an HTTP PUT request.
+func (c *HTTPClient) Put(url string, headers map[string]string, body string, options ...map[string]interface{}) *HTTPResponse {
+	return c.Do("PUT", url, headers, body, options...)
+}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.Logger.Error("failed to read response body", "error", err, "url", url)
-		return &HTTPResponse{StatusCode: resp.StatusCode, Error: err.Error()}
-	}
+// Patch performs an HTTP PATCH request.
+func (c *HTTPClient) Patch(url string, headers map[string]string, body string, options ...map[string]interface{}) *HTTPResponse {
+	return c.Do("PATCH", url, headers, body, options...)
+}
 
-	respHeaders := make(map[string]string)
-	for k, v := range resp.Header {
-		if len(v) > 0 {
-			respHeaders[k] = v[0]
+// Delete performs an HTTP DELETE request.
+func (c *HTTPClient) Delete(url string, headers map[string]string, options ...map[string]interface{}) *HTTPResponse {
+	return c.Do("DELETE", url, headers, "", options...)
+}
+
+// Head performs an HTTP HEAD request. The response has the status code and headers but no body.
+func (c *HTTPClient) Head(url string, headers map[string]string, options ...map[string]interface{}) *HTTPResponse {
+	return c.Do("HEAD", url, headers, "", options...)
+}
+
+// Do performs an HTTP request with the given method. Requests with a body are sent as JSON unless the
+// headers set another Content-Type. The optional options map may set "timeout_ms", "retries",
+// "backoff_ms" and, for GET requests, "cache_ttl_ms" for this call; the client defaults are used for the rest.
+func (c *HTTPClient) Do(method, url string, headers map[string]string, body string, options ...map[string]interface{}) *HTTPResponse {
+	opts := c.Defaults
+	for _, o := range options {
+		var err error
+		if opts, err = parseHTTPOptions(opts, o); err != nil {
+			c.Logger.Error("invalid "+method+" request options", "error", err, "url", url)
+			return &HTTPResponse{Error: err.Error()}
+		}
+	}
+	var cacheKey string
+	if opts.CacheTTL > 0 {
+		if method != "GET" {
+			c.Logger.Error("invalid "+method+" request options", "error", "cache_ttl_ms applies to GET requests only", "url", url)
+			return &HTTPResponse{Error: "option \"cache_ttl_ms\" applies to GET requests only"}
+		}
+		cacheKey = httpCacheKey(url, headers)
+		if resp := c.cache.get(cacheKey); resp != nil {
+			return resp
 		}
 	}
 
-	return &HTTPResponse{
-		StatusCode: resp.StatusCode,
-		Body:       string(bodyBytes),
-		Headers:    respHeaders,
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, retryable := c.doOnce(method, url, headers, body, opts.Timeout)
+		if !retryable || attempt >= opts.Retries {
+			if cacheKey != "" {
+				c.cache.put(cacheKey, resp, opts.CacheTTL)
+			}
+			return resp
+		}
+		c.Logger.Warn("retrying "+method+" request", "url", url, "attempt", attempt+1, "status", resp.StatusCode, "error", resp.Error, "backoff", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 }
 
-// Post performs an HTTP POST request.
-func (c *HTTPClient) Post(url string, headers map[string]string, body string) *HTTPResponse {
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(body)))
+// doOnce performs a single attempt of an HTTP request. It reports whether the failure is worth a retry:
+// network errors, timeouts, 5xx and 429 responses are.
+func (c *HTTPClient) doOnce(method, url string, headers map[string]string, body string, timeout time.Duration) (*HTTPResponse, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = bytes.NewBufferString(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
-		c.Logger.Error("failed to create POST request", "error", err, "url", url)
-		return &HTTPResponse{Error: err.Error()}
+		c.Logger.Error("failed to create "+method+" request", "error", err, "url", url)
+		return &HTTPResponse{Error: err.Error()}, false
+	}
+
+	if c.hosts != nil {
+		if err := c.hosts.checkURL(req.URL); err != nil {
+			c.Logger.Warn("blocked "+method+" request", "error", err, "url", url)
+			return &HTTPResponse{Error: err.Error()}, false
+		}
 	}
 
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
-	if _, ok := headers["Content-Type"]; !ok {
+	if _, ok := headers["Content-Type"]; !ok && (body != "" || method == "POST" || method == "PUT" || method == "PATCH") {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		c.Logger.Error("failed to perform POST request", "error", err, "url", url)
-		return &HTTPResponse{Error: err.Error()}
+		if errors.Is(err, ErrHostNotAllowed) {
+			c.Logger.Warn("blocked "+method+" request", "error", err, "url", url)
+			return &HTTPResponse{Error: err.Error()}, false
+		}
+		c.Logger.Error("failed to perform "+method+" request", "error", err, "url", url)
+		return &HTTPResponse{Error: err.Error()}, true
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		c.Logger.Error("failed to read response body", "error", err, "url", url)
-		return &HTTPResponse{StatusCode: resp.StatusCode, Error: err.Error()}
+		return &HTTPResponse{StatusCode: resp.StatusCode, Error: err.Error()}, true
 	}
 
 	respHeaders := make(map[string]string)
@@ -147,5 +447,47 @@ func (c *HTTPClient) Post(url string, headers map[string]string, body string) *H
 		StatusCode: resp.StatusCode,
 		Body:       string(bodyBytes),
 		Headers:    respHeaders,
+	}, resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// parseHTTPOptions applies the per-call options passed by a script on top of the given defaults.
+func parseHTTPOptions(defaults HTTPOptions, raw map[string]interface{}) (HTTPOptions, error) {
+	opts := defaults
+	for k, v := range raw {
+		var n int64
+		switch val := v.(type) {
+		case int:
+			n = int64(val)
+		case int64:
+			n = val
+		case float64:
+			n = int64(val)
+		default:
+			return opts, fmt.Errorf("option %q must be a number, got %T", k, v)
+		}
+		if n < 0 {
+			return opts, fmt.Errorf("option %q must not be negative, got %d", k, n)
+		}
+		switch k {
+		case "timeout_ms":
+			if n > 0 {
+				opts.Timeout = time.Duration(n) * time.Millisecond
+			}
+		case "retries":
+			if n > MaxHTTPRetries {
+				return opts, fmt.Errorf("option \"retries\" must be at most %d, got %d", MaxHTTPRetries, n)
+			}
+			opts.Retries = int(n)
+		case "backoff_ms":
+			opts.Backoff = time.Duration(n) * time.Millisecond
+		case "cache_ttl_ms":
+			if ttl := time.Duration(n) * time.Millisecond; ttl > MaxHTTPCacheTTL {
+				return opts, fmt.Errorf("option \"cache_ttl_ms\" must be at most %d, got %d", MaxHTTPCacheTTL.Milliseconds(), n)
+			}
+			opts.CacheTTL = time.Duration(n) * time.Millisecond
+		default:
+			return opts, fmt.Errorf("unknown option %q, expected timeout_ms, retries, backoff_ms or cache_ttl_ms", k)
+		}
 	}
+	return opts, nil
 }
@@ -11,32 +11,80 @@ import (
 type Service struct {
 	gojaRunner     *GojaRunner
 	starlarkRunner *StarlarkRunner
+	celRunner      *CELRunner
 	logger         *slog.Logger
-	store          *storage.Store
+	store          storage.Store
+	defaultLimits  Limits // Limits of the configuration file, used for the limit settings left empty
 }
 
-// NewService creates a new scripting service.
-func NewService(logger *slog.Logger, httpClient *HTTPClient, store *storage.Store) *Service {
+// NewService creates a new scripting service. envAllowlist names the environment variables the scripts
+// may read with env.get.
+func NewService(logger *slog.Logger, httpClient *HTTPClient, store storage.Store, limits Limits, envAllowlist []string) *Service {
 	return &Service{
-		gojaRunner:     NewGojaRunner(logger, httpClient, store),
-		starlarkRunner: NewStarlarkRunner(logger, httpClient, store),
+		gojaRunner:     NewGojaRunner(logger, httpClient, store, limits, envAllowlist),
+		starlarkRunner: NewStarlarkRunner(logger, httpClient, store, limits, envAllowlist),
+		celRunner:      NewCELRunner(limits),
 		logger:         logger,
 		store:          store,
+		defaultLimits:  limits,
 	}
 }
 
-// ExecuteScript executes a script using the specified engine.
+// DefaultLimits returns the limits the service was created with, from the configuration file.
+func (s *Service) DefaultLimits() Limits {
+	return s.defaultLimits
+}
+
+// ApplyLimitSettings reads the script limit settings and applies them to the next script runs. Settings
+// left empty keep the limits of the configuration file.
+func (s *Service) ApplyLimitSettings() error {
+	settings := LimitSettings(s.defaultLimits)
+	timeout, err := s.store.GetDurationSetting(settings[0])
+	if err != nil {
+		return err
+	}
+	maxMemoryMB, err := s.store.GetIntSetting(settings[1])
+	if err != nil {
+		return err
+	}
+	maxCallDepth, err := s.store.GetIntSetting(settings[2])
+	if err != nil {
+		return err
+	}
+	limits := Limits{Timeout: timeout, MaxMemory: uint64(maxMemoryMB) << 20, MaxCallDepth: maxCallDepth}
+	s.gojaRunner.limits.set(limits)
+	s.starlarkRunner.limits.set(limits)
+	s.celRunner.limits.set(limits)
+	// Pooled VMs keep the call stack depth they were created with.
+	s.gojaRunner.PurgeCache()
+	return nil
+}
+
+// PurgeCache drops the compiled scripts of both engines. Scripts are cached by their source, so this is
+// only needed when something they import changes, such as a script library.
+func (s *Service) PurgeCache() {
+	s.gojaRunner.PurgeCache()
+	s.starlarkRunner.PurgeCache()
+}
+
+// ExecuteScript executes a script using the specified engine. The namespace keeps the kv state of the
+// transformation or collector the script belongs to; an empty one gives the run a throwaway state. The
+// script context may be nil when no route or collector runs the script, as in transformation tests.
 func (s *Service) ExecuteScript(
 	engine string,
+	namespace string,
 	script string,
 	messageBody map[string]interface{},
 	messageHeaders map[string]interface{},
+	scriptContext *ScriptContext,
 ) (*TransformedMessage, error) {
 	switch engine {
 	case "javascript":
-		return s.gojaRunner.Execute(script, messageBody, messageHeaders)
+		return s.gojaRunner.Execute(namespace, script, messageBody, messageHeaders, scriptContext)
 	case "starlark":
-		return s.starlarkRunner.Execute(script, messageBody, messageHeaders)
+		return s.starlarkRunner.Execute(namespace, script, messageBody, messageHeaders, scriptContext)
+	case "cel":
+		return s.celRunner.Execute(script, messageBody, messageHeaders, scriptContext) // Expressions keep no kv state
 	default:
 		return nil, fmt.Errorf("unsupported scripting engine: %s", engine)
 	}
@@ -0,0 +1,430 @@
+package scripting
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path"
+	"strconv"
+	"time"
+
+	"esb-go-app/storage"
+
+	"github.com/dop251/goja"
+	"github.com/jlaffaye/ftp"
+	"github.com/pkg/sftp"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// MaxFileBytes is the largest file a script can download or upload with the sftp module.
+	MaxFileBytes = 64 << 20
+	// defaultFileTimeout bounds a file server call when the script run itself has no time limit.
+	defaultFileTimeout = 60 * time.Second
+)
+
+// fileServers opens the connections of collector scripts to the file servers configured in admin.
+// Every call connects, runs its operation and disconnects: collectors poll on a schedule, so keeping
+// sessions open would only hold connections that servers of legacy systems often limit.
+type fileServers struct {
+	store  storage.Store
+	logger *slog.Logger
+}
+
+// fileClient is an open connection to an SFTP or FTP server.
+type fileClient interface {
+	list(dir string) ([]interface{}, error)
+	download(file string) ([]byte, error)
+	upload(file string, data []byte) error
+	move(from, to string) error
+	close() error
+}
+
+// connect opens a connection to the named file server.
+func (f *fileServers) connect(timeout time.Duration, name string) (fileClient, error) {
+	if f.store == nil {
+		return nil, fmt.Errorf("file servers are not available")
+	}
+	server, err := f.store.GetFileServerByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if server == nil {
+		return nil, fmt.Errorf("no file server named %q", name)
+	}
+	if timeout <= 0 {
+		timeout = defaultFileTimeout
+	}
+	addr := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+	switch server.Protocol {
+	case "sftp":
+		return dialSFTP(server, addr, timeout, f.logger)
+	case "ftp":
+		return dialFTP(server, addr, timeout)
+	default:
+		return nil, fmt.Errorf("unsupported file server protocol %q", server.Protocol)
+	}
+}
+
+// run connects to the named server, runs the operation and disconnects.
+func (f *fileServers) run(timeout time.Duration, name string, op func(fileClient) error) error {
+	client, err := f.connect(timeout, name)
+	if err != nil {
+		return err
+	}
+	defer client.close()
+	return op(client)
+}
+
+// fileEntry describes a listed file the same way for both protocols.
+func fileEntry(dir, name string, size int64, modified time.Time, isDir bool) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     name,
+		"path":     path.Join(dir, name),
+		"size":     size,
+		"modified": modified.UTC().Format(time.RFC3339),
+		"dir":      isDir,
+	}
+}
+
+// readFile reads a downloaded file, failing when it is larger than MaxFileBytes.
+func readFile(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileBytes {
+		return nil, fmt.Errorf("file is larger than %d bytes", MaxFileBytes)
+	}
+	return data, nil
+}
+
+type sftpClient struct {
+	ssh  *ssh.Client
+	sftp *sftp.Client
+}
+
+// dialSFTP connects over SSH with the private key and/or password of the server. The whole call must
+// finish within the timeout, which is set as the deadline of the connection. The server must answer with
+// its host key, unless verification is explicitly skipped for it.
+func dialSFTP(server *storage.FileServer, addr string, timeout time.Duration, logger *slog.Logger) (fileClient, error) {
+	var auth []ssh.AuthMethod
+	if server.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if server.Password != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(server.PrivateKey), []byte(server.Password))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(server.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key of file server %q: %w", server.Name, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else if server.Password != "" {
+		auth = append(auth, ssh.Password(server.Password))
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case server.HostKey != "":
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(server.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host key of file server %q: %w", server.Name, err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(hostKey)
+	case server.SkipHostKeyVerify:
+		logger.Warn("connecting to SFTP server without verifying its host key", "file_server", server.Name, "address", addr)
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("file server %q has no host key; add the key of the server or skip its verification", server.Name)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to file server %q: %w", server.Name, err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            server.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to file server %q: %w", server.Name, err)
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	sftpConn, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("failed to start SFTP on file server %q: %w", server.Name, err)
+	}
+	return &sftpClient{ssh: sshClient, sftp: sftpConn}, nil
+}
+
+func (c *sftpClient) list(dir string) ([]interface{}, error) {
+	infos, err := c.sftp.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]interface{}, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fileEntry(dir, info.Name(), info.Size(), info.ModTime(), info.IsDir()))
+	}
+	return entries, nil
+}
+
+func (c *sftpClient) download(file string) ([]byte, error) {
+	f, err := c.sftp.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readFile(f)
+}
+
+func (c *sftpClient) upload(file string, data []byte) error {
+	f, err := c.sftp.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// move renames with the POSIX extension where the server has it, which replaces an existing target
+// like a local rename does; plain SFTP rename fails in that case.
+func (c *sftpClient) move(from, to string) error {
+	if _, ok := c.sftp.HasExtension("posix-rename@openssh.com"); ok {
+		return c.sftp.PosixRename(from, to)
+	}
+	return c.sftp.Rename(from, to)
+}
+
+func (c *sftpClient) close() error {
+	c.sftp.Close()
+	return c.ssh.Close()
+}
+
+type ftpClient struct {
+	conn *ftp.ServerConn
+}
+
+// dialFTP connects to a plain FTP server and logs in, anonymously when the server has no user.
+func dialFTP(server *storage.FileServer, addr string, timeout time.Duration) (fileClient, error) {
+	conn, err := ftp.Dial(addr, ftp.DialWithTimeout(timeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to file server %q: %w", server.Name, err)
+	}
+	user, password := server.Username, server.Password
+	if user == "" {
+		user, password = "anonymous", "anonymous"
+	}
+	if err := conn.Login(user, password); err != nil {
+		conn.Quit()
+		return nil, fmt.Errorf("failed to log in to file server %q: %w", server.Name, err)
+	}
+	return &ftpClient{conn: conn}, nil
+}
+
+func (c *ftpClient) list(dir string) ([]interface{}, error) {
+	items, err := c.conn.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if item.Name == "." || item.Name == ".." {
+			continue
+		}
+		entries = append(entries, fileEntry(dir, item.Name, int64(item.Size), item.Time, item.Type == ftp.EntryTypeFolder))
+	}
+	return entries, nil
+}
+
+func (c *ftpClient) download(file string) ([]byte, error) {
+	resp, err := c.conn.Retr(file)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	return readFile(resp)
+}
+
+func (c *ftpClient) upload(file string, data []byte) error {
+	return c.conn.Stor(file, bytes.NewReader(data))
+}
+
+func (c *ftpClient) move(from, to string) error {
+	return c.conn.Rename(from, to)
+}
+
+func (c *ftpClient) close() error {
+	return c.conn.Quit()
+}
+
+// fileContent returns a downloaded file as text, or as base64 for binary files.
+func fileContent(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case "", "text":
+		return string(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %q, expected text or base64", encoding)
+	}
+}
+
+// fileData decodes the content a script uploads, given as text or as base64.
+func fileData(content, encoding string) ([]byte, error) {
+	var data []byte
+	switch encoding {
+	case "", "text":
+		data = []byte(content)
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q, expected text or base64", encoding)
+	}
+	if len(data) > MaxFileBytes {
+		return nil, fmt.Errorf("file is larger than %d bytes", MaxFileBytes)
+	}
+	return data, nil
+}
+
+// sftpList, sftpDownload, sftpUpload and sftpMove are the operations of the sftp module shared by both engines.
+func (f *fileServers) sftpList(timeout time.Duration, server, dir string) ([]interface{}, error) {
+	var entries []interface{}
+	err := f.run(timeout, server, func(c fileClient) (err error) {
+		entries, err = c.list(dir)
+		return err
+	})
+	return entries, err
+}
+
+func (f *fileServers) sftpDownload(timeout time.Duration, server, file, encoding string) (string, error) {
+	var data []byte
+	err := f.run(timeout, server, func(c fileClient) (err error) {
+		data, err = c.download(file)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return fileContent(data, encoding)
+}
+
+func (f *fileServers) sftpUpload(timeout time.Duration, server, file, content, encoding string) error {
+	data, err := fileData(content, encoding)
+	if err != nil {
+		return err
+	}
+	return f.run(timeout, server, func(c fileClient) error { return c.upload(file, data) })
+}
+
+func (f *fileServers) sftpMove(timeout time.Duration, server, from, to string) error {
+	return f.run(timeout, server, func(c fileClient) error { return c.move(from, to) })
+}
+
+// starlarkSFTP returns the sftp module of a Starlark collector run.
+func (r *StarlarkRunner) starlarkSFTP() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "sftp",
+		Members: starlark.StringDict{
+			"list": starlark.NewBuiltin("sftp.list", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var server, dir string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "server", &server, "path", &dir); err != nil {
+					return nil, err
+				}
+				entries, err := r.files.sftpList(r.limits.get().Timeout, server, dir)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return toStarlarkValue(entries)
+			}),
+			"download": starlark.NewBuiltin("sftp.download", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var server, file, encoding string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "server", &server, "path", &file, "encoding?", &encoding); err != nil {
+					return nil, err
+				}
+				content, err := r.files.sftpDownload(r.limits.get().Timeout, server, file, encoding)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.String(content), nil
+			}),
+			"upload": starlark.NewBuiltin("sftp.upload", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var server, file, content, encoding string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "server", &server, "path", &file, "content", &content, "encoding?", &encoding); err != nil {
+					return nil, err
+				}
+				if err := r.files.sftpUpload(r.limits.get().Timeout, server, file, content, encoding); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+			"move": starlark.NewBuiltin("sftp.move", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var server, from, to string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "server", &server, "source", &from, "target", &to); err != nil {
+					return nil, err
+				}
+				if err := r.files.sftpMove(r.limits.get().Timeout, server, from, to); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+		},
+	}
+}
+
+// gojaSFTP returns the sftp object of a JavaScript collector run.
+func (r *GojaRunner) gojaSFTP(vm *goja.Runtime) *goja.Object {
+	optionalString := func(v goja.Value) string {
+		if goja.IsUndefined(v) || goja.IsNull(v) {
+			return ""
+		}
+		return v.String()
+	}
+	obj := vm.NewObject()
+	_ = obj.Set("list", func(call goja.FunctionCall) goja.Value {
+		entries, err := r.files.sftpList(r.limits.get().Timeout, call.Argument(0).String(), call.Argument(1).String())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(entries)
+	})
+	_ = obj.Set("download", func(call goja.FunctionCall) goja.Value {
+		content, err := r.files.sftpDownload(r.limits.get().Timeout, call.Argument(0).String(), call.Argument(1).String(), optionalString(call.Argument(2)))
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(content)
+	})
+	_ = obj.Set("upload", func(call goja.FunctionCall) goja.Value {
+		if err := r.files.sftpUpload(r.limits.get().Timeout, call.Argument(0).String(), call.Argument(1).String(), call.Argument(2).String(), optionalString(call.Argument(3))); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return goja.Undefined()
+	})
+	_ = obj.Set("move", func(call goja.FunctionCall) goja.Value {
+		if err := r.files.sftpMove(r.limits.get().Timeout, call.Argument(0).String(), call.Argument(1).String(), call.Argument(2).String()); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return goja.Undefined()
+	})
+	return obj
+}
@@ -0,0 +1,358 @@
+package scripting
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// soapVersion holds what differs between SOAP 1.1 and 1.2 on the wire.
+type soapVersion struct {
+	namespace   string
+	contentType string
+}
+
+// soapVersions are the SOAP versions the soap module speaks. 1C publishes its web services in both;
+// 1.1 is the default.
+var soapVersions = map[string]soapVersion{
+	"1.1": {namespace: "http://schemas.xmlsoap.org/soap/envelope/", contentType: "text/xml; charset=utf-8"},
+	"1.2": {namespace: "http://www.w3.org/2003/05/soap-envelope", contentType: "application/soap+xml; charset=utf-8"},
+}
+
+func lookupSOAPVersion(version string) (soapVersion, error) {
+	if version == "" {
+		version = "1.1"
+	}
+	v, ok := soapVersions[version]
+	if !ok {
+		return soapVersion{}, fmt.Errorf("unsupported SOAP version %q, expected 1.1 or 1.2", version)
+	}
+	return v, nil
+}
+
+// soapEnvelope wraps the body, and the optional header, into a SOAP envelope. Both are dicts in the
+// format of xml.build, typically a single key naming the operation with its namespace as an attribute.
+func soapEnvelope(body, header interface{}, version string) (string, error) {
+	v, err := lookupSOAPVersion(version)
+	if err != nil {
+		return "", err
+	}
+	envelope := newXMLObject()
+	envelope.set(xmlAttrPrefix+"xmlns:soap", v.namespace)
+	if header != nil {
+		envelope.set("soap:Header", header)
+	}
+	envelope.set("soap:Body", body)
+	root := newXMLObject()
+	root.set("soap:Envelope", envelope)
+	return buildXML(root, "", true)
+}
+
+// soapRequest is a call of a SOAP operation.
+type soapRequest struct {
+	URL      string
+	Action   string // SOAPAction of the operation, as listed in the WSDL of the service
+	Envelope string
+	User     string // Basic auth user, as 1C web services expect; no authentication when empty
+	Password string
+	Version  string
+	Headers  map[string]string      // Extra HTTP headers
+	Options  map[string]interface{} // timeout_ms, retries and backoff_ms of the HTTP call
+}
+
+// soapResponse is the answer of a SOAP call. Error is set when no answer could be read: the transport
+// failed, the response is not a SOAP envelope or the status is an error without a fault in the body.
+type soapResponse struct {
+	StatusCode int
+	Body       string      // Raw response text
+	Result     interface{} // Content of the SOAP body, nil on a fault
+	Fault      *xmlObject  // code, message and detail of a SOAP fault
+	Error      string
+}
+
+// callSOAP posts the envelope to the endpoint. Unlike the http module it does not retry by default: a
+// SOAP fault arrives as a 500 response and sending the same request again would not change it.
+func (c *HTTPClient) callSOAP(req soapRequest) *soapResponse {
+	v, err := lookupSOAPVersion(req.Version)
+	if err != nil {
+		return &soapResponse{Error: err.Error()}
+	}
+	headers := map[string]string{}
+	for k, val := range req.Headers {
+		headers[k] = val
+	}
+	headers["Content-Type"] = v.contentType
+	if req.Version == "1.2" {
+		if req.Action != "" {
+			headers["Content-Type"] += fmt.Sprintf("; action=%q", req.Action)
+		}
+	} else {
+		headers["SOAPAction"] = fmt.Sprintf("%q", req.Action)
+	}
+	if req.User != "" {
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(req.User+":"+req.Password))
+	}
+
+	resp := c.Do("POST", req.URL, headers, req.Envelope, map[string]interface{}{"retries": 0}, req.Options)
+	result := &soapResponse{StatusCode: resp.StatusCode, Body: resp.Body, Error: resp.Error}
+	if resp.Error != "" {
+		return result
+	}
+	parsed, err := parseSOAP(resp.Body)
+	if err != nil {
+		if resp.StatusCode >= 300 {
+			result.Error = fmt.Sprintf("SOAP call failed with HTTP status %d", resp.StatusCode)
+		} else {
+			result.Error = err.Error()
+		}
+		return result
+	}
+	result.Result, result.Fault = parsed.Result, parsed.Fault
+	if resp.StatusCode >= 300 && result.Fault == nil {
+		result.Error = fmt.Sprintf("SOAP call failed with HTTP status %d", resp.StatusCode)
+	}
+	return result
+}
+
+// parseSOAP reads a SOAP envelope. The namespace prefixes of the envelope vary between services, so its
+// elements are found by local name; the content of the body keeps the names of the document.
+func parseSOAP(text string) (*soapResponse, error) {
+	doc, err := parseXML(text)
+	if err != nil {
+		return nil, err
+	}
+	envelope, ok := xmlChild(doc, "Envelope").(*xmlObject)
+	if !ok {
+		return nil, fmt.Errorf("invalid SOAP response: no Envelope element")
+	}
+	bodyValue := xmlChild(envelope, "Body")
+	if bodyValue == nil {
+		return nil, fmt.Errorf("invalid SOAP response: no Body element")
+	}
+	body, _ := bodyValue.(*xmlObject)
+	if body == nil {
+		return &soapResponse{}, nil // An empty body, as returned by one-way operations
+	}
+
+	content := newXMLObject()
+	for _, key := range body.keys {
+		if !strings.HasPrefix(key, xmlAttrPrefix+"xmlns") {
+			content.set(key, body.values[key])
+		}
+	}
+	if fault := xmlChild(content, "Fault"); fault != nil {
+		return &soapResponse{Fault: soapFault(fault)}, nil
+	}
+	if len(content.keys) == 0 {
+		return &soapResponse{}, nil
+	}
+	return &soapResponse{Result: content}, nil
+}
+
+// soapFault normalizes a SOAP 1.1 (faultcode, faultstring, detail) or 1.2 (Code/Value, Reason/Text,
+// Detail) fault into code, message and detail.
+func soapFault(fault interface{}) *xmlObject {
+	result := newXMLObject()
+	obj, ok := fault.(*xmlObject)
+	if !ok {
+		result.set("code", "")
+		result.set("message", xmlText(fault))
+		result.set("detail", nil)
+		return result
+	}
+	code := xmlChild(obj, "faultcode")
+	if c, ok := xmlChild(obj, "Code").(*xmlObject); ok {
+		code = xmlChild(c, "Value")
+	}
+	message := xmlChild(obj, "faultstring")
+	if r, ok := xmlChild(obj, "Reason").(*xmlObject); ok {
+		message = xmlChild(r, "Text")
+	}
+	if m, ok := message.(*xmlObject); ok {
+		message = m.values[xmlTextKey] // A 1.2 Text with an xml:lang attribute
+	}
+	detail := xmlChild(obj, "detail")
+	if detail == nil {
+		detail = xmlChild(obj, "Detail")
+	}
+	result.set("code", xmlText(code))
+	result.set("message", xmlText(message))
+	result.set("detail", detail)
+	return result
+}
+
+// xmlChild returns the child element with the given local name, whatever its namespace prefix.
+func xmlChild(obj *xmlObject, local string) interface{} {
+	for _, key := range obj.keys {
+		if key == local || strings.HasSuffix(key, ":"+local) {
+			return obj.values[key]
+		}
+	}
+	return nil
+}
+
+// soapFaultValue returns the fault as a value that is nil when there is none, so a missing fault is
+// converted to None/null rather than to an empty dict.
+func soapFaultValue(fault *xmlObject) interface{} {
+	if fault == nil {
+		return nil
+	}
+	return fault
+}
+
+// starlarkSOAP returns the soap module of Starlark scripts.
+func (r *StarlarkRunner) starlarkSOAP() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "soap",
+		Members: starlark.StringDict{
+			"envelope": starlark.NewBuiltin("soap.envelope", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var body starlark.Value
+				var header starlark.Value = starlark.None
+				var version string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "body", &body, "header?", &header, "version?", &version); err != nil {
+					return nil, err
+				}
+				bodyDoc, err := xmlFromStarlark(body)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				var headerDoc interface{}
+				if header != starlark.None {
+					if headerDoc, err = xmlFromStarlark(header); err != nil {
+						return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+					}
+				}
+				out, err := soapEnvelope(bodyDoc, headerDoc, version)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.String(out), nil
+			}),
+			"call": starlark.NewBuiltin("soap.call", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var req soapRequest
+				var headersDict *starlark.Dict
+				var timeoutMs, retries, backoffMs starlark.Value
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+					"url", &req.URL, "action", &req.Action, "envelope", &req.Envelope,
+					"user?", &req.User, "password?", &req.Password, "version?", &req.Version, "headers?", &headersDict,
+					"timeout_ms?", &timeoutMs, "retries?", &retries, "backoff_ms?", &backoffMs); err != nil {
+					return nil, err
+				}
+				req.Headers = make(map[string]string)
+				if headersDict != nil {
+					for _, item := range headersDict.Items() {
+						key, _ := item.Index(0).(starlark.String)
+						val, _ := item.Index(1).(starlark.String)
+						req.Headers[key.GoString()] = val.GoString()
+					}
+				}
+				req.Options = make(map[string]interface{})
+				for name, v := range map[string]starlark.Value{"timeout_ms": timeoutMs, "retries": retries, "backoff_ms": backoffMs} {
+					if v == nil || v == starlark.None {
+						continue
+					}
+					goVal, err := fromStarlarkValue(v)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %s: %w", fn.Name(), name, err)
+					}
+					req.Options[name] = goVal
+				}
+				resp := r.httpClient.callSOAP(req)
+				return starlarkstruct.FromStringDict(starlark.String("SOAPResponse"), starlark.StringDict{
+					"status_code": starlark.MakeInt(resp.StatusCode),
+					"body":        starlark.String(resp.Body),
+					"result":      xmlToStarlark(resp.Result),
+					"fault":       xmlToStarlark(soapFaultValue(resp.Fault)),
+					"error":       starlark.String(resp.Error),
+				}), nil
+			}),
+			"parse": starlark.NewBuiltin("soap.parse", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var text string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "text", &text); err != nil {
+					return nil, err
+				}
+				parsed, err := parseSOAP(text)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlarkstruct.FromStringDict(starlark.String("SOAPMessage"), starlark.StringDict{
+					"result": xmlToStarlark(parsed.Result),
+					"fault":  xmlToStarlark(soapFaultValue(parsed.Fault)),
+				}), nil
+			}),
+		},
+	}
+}
+
+// gojaSOAP returns the soap object of JavaScript scripts: soap.envelope(body, header, version),
+// soap.call(url, action, envelope, options) and soap.parse(text). The options of a call are user,
+// password, version, headers, timeout_ms, retries and backoff_ms.
+func (r *GojaRunner) gojaSOAP(vm *goja.Runtime) *goja.Object {
+	obj := vm.NewObject()
+	_ = obj.Set("envelope", func(call goja.FunctionCall) goja.Value {
+		var header interface{}
+		if arg := call.Argument(1); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			header = xmlFromGoja(vm, arg)
+		}
+		version := ""
+		if arg := call.Argument(2); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			version = arg.String()
+		}
+		out, err := soapEnvelope(xmlFromGoja(vm, call.Argument(0)), header, version)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(out)
+	})
+	_ = obj.Set("call", func(call goja.FunctionCall) goja.Value {
+		req := soapRequest{
+			URL:      call.Argument(0).String(),
+			Action:   call.Argument(1).String(),
+			Envelope: call.Argument(2).String(),
+			Headers:  make(map[string]string),
+			Options:  make(map[string]interface{}),
+		}
+		if arg := call.Argument(3); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			for k, v := range arg.ToObject(vm).Export().(map[string]interface{}) {
+				switch k {
+				case "user":
+					req.User = fmt.Sprint(v)
+				case "password":
+					req.Password = fmt.Sprint(v)
+				case "version":
+					req.Version = fmt.Sprint(v)
+				case "headers":
+					headers, _ := v.(map[string]interface{})
+					for name, value := range headers {
+						req.Headers[name] = fmt.Sprint(value)
+					}
+				default:
+					req.Options[k] = v
+				}
+			}
+		}
+		resp := r.httpClient.callSOAP(req)
+		result := vm.NewObject()
+		_ = result.Set("status_code", resp.StatusCode)
+		_ = result.Set("body", resp.Body)
+		_ = result.Set("result", xmlToGoja(vm, resp.Result))
+		_ = result.Set("fault", xmlToGoja(vm, soapFaultValue(resp.Fault)))
+		_ = result.Set("error", resp.Error)
+		return result
+	})
+	_ = obj.Set("parse", func(call goja.FunctionCall) goja.Value {
+		parsed, err := parseSOAP(call.Argument(0).String())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		result := vm.NewObject()
+		_ = result.Set("result", xmlToGoja(vm, parsed.Result))
+		_ = result.Set("fault", xmlToGoja(vm, soapFaultValue(parsed.Fault)))
+		return result
+	})
+	return obj
+}
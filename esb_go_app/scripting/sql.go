@@ -0,0 +1,220 @@
+package scripting
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"esb-go-app/storage"
+
+	"github.com/dop251/goja"
+	_ "github.com/lib/pq"               // postgres driver
+	_ "github.com/microsoft/go-mssqldb" // sqlserver driver
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	// MaxSQLRows is the largest number of rows a single sql.query call returns to a script.
+	MaxSQLRows = 10000
+	// defaultSQLTimeout bounds a query when the script run itself has no time limit.
+	defaultSQLTimeout = 30 * time.Second
+)
+
+// sqlDatabases keeps one connection pool per connection profile, so the collectors that poll the same
+// database share its connections. A pool is reopened when its profile is edited in admin.
+type sqlDatabases struct {
+	store storage.Store
+	mu    sync.Mutex
+	pools map[string]*sqlPool // By connection name
+}
+
+type sqlPool struct {
+	driver string
+	dsn    string
+	db     *sql.DB
+}
+
+func newSQLDatabases(store storage.Store) *sqlDatabases {
+	return &sqlDatabases{store: store, pools: make(map[string]*sqlPool)}
+}
+
+// open returns the pool of the named connection profile, opening it on first use.
+func (d *sqlDatabases) open(name string) (*sqlPool, error) {
+	if d.store == nil {
+		return nil, fmt.Errorf("SQL connections are not available")
+	}
+	conn, err := d.store.GetSQLConnectionByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		return nil, fmt.Errorf("no SQL connection named %q", name)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if pool, ok := d.pools[name]; ok {
+		if pool.driver == conn.Driver && pool.dsn == conn.DSN {
+			return pool, nil
+		}
+		pool.db.Close()
+		delete(d.pools, name)
+	}
+	db, err := sql.Open(conn.Driver, conn.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQL connection %q: %w", name, err)
+	}
+	db.SetMaxOpenConns(4)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	pool := &sqlPool{driver: conn.Driver, dsn: conn.DSN, db: db}
+	d.pools[name] = pool
+	return pool, nil
+}
+
+// query runs a read-only statement against the named connection and returns its rows as maps keyed by
+// column name. Only a single SELECT (or WITH ... SELECT) is accepted, and it runs in a transaction that
+// is always rolled back, read-only where the driver supports it. A profile should still use a database
+// user limited to reading, which is the only guarantee against functions with side effects.
+func (d *sqlDatabases) query(timeout time.Duration, name, statement string, args []interface{}) ([]interface{}, error) {
+	if err := checkReadOnlyStatement(statement); err != nil {
+		return nil, err
+	}
+	pool, err := d.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultSQLTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// go-mssqldb rejects read-only transactions, so SQL Server relies on the rollback alone.
+	tx, err := pool.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: pool.driver == "postgres"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction on %q: %w", name, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []interface{}{}
+	for rows.Next() {
+		if len(result) == MaxSQLRows {
+			return nil, fmt.Errorf("query returned more than %d rows, narrow it with WHERE or a row limit", MaxSQLRows)
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = sqlValue(values[i])
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkReadOnlyStatement accepts a single SELECT or WITH statement. Semicolons are only allowed at the
+// end, which also rejects a literal containing one; pass such values as query arguments instead.
+func checkReadOnlyStatement(statement string) error {
+	trimmed := strings.TrimRight(strings.TrimSpace(statement), "; \t\r\n")
+	if strings.Contains(trimmed, ";") {
+		return fmt.Errorf("only a single statement can be run")
+	}
+	fields := strings.Fields(trimmed)
+	if len(fields) == 0 {
+		return fmt.Errorf("query must not be empty")
+	}
+	switch strings.ToLower(fields[0]) {
+	case "select", "with":
+		return nil
+	default:
+		return fmt.Errorf("only SELECT queries can be run, got %s", fields[0])
+	}
+}
+
+// sqlValue converts a scanned column value to one the script engines can represent.
+func sqlValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case []byte:
+		if utf8.Valid(val) {
+			return string(val)
+		}
+		return base64.StdEncoding.EncodeToString(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return val
+	}
+}
+
+// starlarkSQL returns the sql module of a Starlark collector run.
+func (r *StarlarkRunner) starlarkSQL() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "sql",
+		Members: starlark.StringDict{
+			"query": starlark.NewBuiltin("sql.query", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				if len(args) < 2 {
+					return nil, fmt.Errorf("%s: expected a connection name and a query", fn.Name())
+				}
+				var connection, statement string
+				if err := starlark.UnpackPositionalArgs(fn.Name(), args[:2], kwargs, 2, &connection, &statement); err != nil {
+					return nil, err
+				}
+				queryArgs := make([]interface{}, 0, len(args)-2)
+				for _, arg := range args[2:] {
+					value, err := fromStarlarkValue(arg)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+					}
+					queryArgs = append(queryArgs, value)
+				}
+				rows, err := r.databases.query(r.limits.get().Timeout, connection, statement, queryArgs)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return toStarlarkValue(rows)
+			}),
+		},
+	}
+}
+
+// gojaSQL returns the sql object of a JavaScript collector run.
+func (r *GojaRunner) gojaSQL(vm *goja.Runtime) *goja.Object {
+	obj := vm.NewObject()
+	_ = obj.Set("query", func(call goja.FunctionCall) goja.Value {
+		queryArgs := make([]interface{}, 0, len(call.Arguments))
+		for i := 2; i < len(call.Arguments); i++ {
+			queryArgs = append(queryArgs, call.Arguments[i].Export())
+		}
+		rows, err := r.databases.query(r.limits.get().Timeout, call.Argument(0).String(), call.Argument(1).String(), queryArgs)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(rows)
+	})
+	return obj
+}
@@ -0,0 +1,230 @@
+package scripting
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// maxCachedPatterns bounds the number of compiled regular expressions kept between script runs.
+const maxCachedPatterns = 256
+
+var (
+	patternCacheMu sync.Mutex
+	patternCache   = make(map[string]*regexp.Regexp)
+)
+
+// compilePattern compiles a regular expression, reusing the compiled form across script runs.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patternCacheMu.Lock()
+	defer patternCacheMu.Unlock()
+	if re, ok := patternCache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(patternCache) >= maxCachedPatterns {
+		patternCache = make(map[string]*regexp.Regexp)
+	}
+	patternCache[pattern] = re
+	return re, nil
+}
+
+// starlarkReModule is the "re" module available to Starlark scripts. It follows the Python API where
+// possible, but uses Go RE2 syntax; replacements in re.sub refer to groups as $1 or ${name}.
+var starlarkReModule = starlarkstruct.FromStringDict(starlark.String("re"), starlark.StringDict{
+	"match":     starlark.NewBuiltin("re.match", reMatch),
+	"fullmatch": starlark.NewBuiltin("re.fullmatch", reMatch),
+	"search":    starlark.NewBuiltin("re.search", reMatch),
+	"findall":   starlark.NewBuiltin("re.findall", reFindall),
+	"sub":       starlark.NewBuiltin("re.sub", reSub),
+	"split":     starlark.NewBuiltin("re.split", reSplit),
+})
+
+// reMatch implements re.search, re.match (anchored at the start) and re.fullmatch (anchored at both ends).
+func reMatch(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "string", &s); err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return starlark.None, nil
+	}
+	switch fn.Name() {
+	case "re.match":
+		if loc[0] != 0 {
+			// The leftmost match is not at the start; retry with the pattern anchored there.
+			anchored, err := compilePattern(`^(?:` + pattern + `)`)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			if loc = anchored.FindStringSubmatchIndex(s); loc == nil {
+				return starlark.None, nil
+			}
+		}
+	case "re.fullmatch":
+		if loc[0] != 0 || loc[1] != len(s) {
+			anchored, err := compilePattern(`^(?:` + pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			if loc = anchored.FindStringSubmatchIndex(s); loc == nil {
+				return starlark.None, nil
+			}
+		}
+	}
+	return newMatch(re, s, loc), nil
+}
+
+// newMatch builds the match object returned by re.match and re.search.
+func newMatch(re *regexp.Regexp, s string, loc []int) starlark.Value {
+	group := func(i int) starlark.Value {
+		if loc[2*i] < 0 {
+			return starlark.None
+		}
+		return starlark.String(s[loc[2*i]:loc[2*i+1]])
+	}
+	names := re.SubexpNames()
+
+	return starlarkstruct.FromStringDict(starlark.String("Match"), starlark.StringDict{
+		"start": starlark.MakeInt(loc[0]),
+		"end":   starlark.MakeInt(loc[1]),
+		"group": starlark.NewBuiltin("group", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var index starlark.Value = starlark.MakeInt(0)
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0, &index); err != nil {
+				return nil, err
+			}
+			switch v := index.(type) {
+			case starlark.String:
+				for i, name := range names {
+					if name != "" && name == string(v) {
+						return group(i), nil
+					}
+				}
+				return nil, fmt.Errorf("group: no such group %q", string(v))
+			case starlark.Int:
+				i, ok := v.Int64()
+				if !ok || i < 0 || int(i) >= len(names) {
+					return nil, fmt.Errorf("group: no such group %s", v)
+				}
+				return group(int(i)), nil
+			default:
+				return nil, fmt.Errorf("group: want int or string, got %s", index.Type())
+			}
+		}),
+		"groups": starlark.NewBuiltin("groups", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			groups := make(starlark.Tuple, 0, len(names)-1)
+			for i := 1; i < len(names); i++ {
+				groups = append(groups, group(i))
+			}
+			return groups, nil
+		}),
+		"groupdict": starlark.NewBuiltin("groupdict", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			dict := starlark.NewDict(len(names))
+			for i, name := range names {
+				if name != "" {
+					if err := dict.SetKey(starlark.String(name), group(i)); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return dict, nil
+		}),
+	})
+}
+
+// reFindall returns all matches: strings without groups, the group for one group and tuples of groups otherwise.
+func reFindall(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "string", &s); err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	var results []starlark.Value
+	for _, m := range re.FindAllStringSubmatch(s, -1) {
+		switch len(m) {
+		case 1:
+			results = append(results, starlark.String(m[0]))
+		case 2:
+			results = append(results, starlark.String(m[1]))
+		default:
+			groups := make(starlark.Tuple, 0, len(m)-1)
+			for _, g := range m[1:] {
+				groups = append(groups, starlark.String(g))
+			}
+			results = append(results, groups)
+		}
+	}
+	return starlark.NewList(results), nil
+}
+
+// reSub replaces the matches of pattern; count limits the number of replacements, 0 replaces all.
+func reSub(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, repl, s string
+	count := 0
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "repl", &repl, "string", &s, "count?", &count); err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	if count <= 0 {
+		return starlark.String(re.ReplaceAllString(s, repl)), nil
+	}
+
+	var result []byte
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, count) {
+		result = append(result, s[last:loc[0]]...)
+		result = re.ExpandString(result, repl, s, loc)
+		last = loc[1]
+	}
+	result = append(result, s[last:]...)
+	return starlark.String(result), nil
+}
+
+// reSplit splits string around the matches of pattern; maxsplit limits the number of splits, 0 splits on all.
+func reSplit(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	maxsplit := 0
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "string", &s, "maxsplit?", &maxsplit); err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	n := -1
+	if maxsplit > 0 {
+		n = maxsplit + 1
+	}
+	parts := re.Split(s, n)
+	values := make([]starlark.Value, 0, len(parts))
+	for _, part := range parts {
+		values = append(values, starlark.String(part))
+	}
+	return starlark.NewList(values), nil
+}
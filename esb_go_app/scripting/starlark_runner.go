@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"esb-go-app/storage"
 
+	starlarkmath "go.starlark.net/lib/math"
+	starlarktime "go.starlark.net/lib/time"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkjson"
 	"go.starlark.net/starlarkstruct"
@@ -16,21 +20,48 @@ import (
 type StarlarkRunner struct {
 	logger     *slog.Logger
 	httpClient *HTTPClient // Injected HTTP client
-	store      *storage.Store
+	store      storage.Store
+	limits     *liveLimits
+	env        *scriptEnv     // Allowlisted environment variables readable with env.get
+	databases  *sqlDatabases  // Pools of the external databases collectors query with sql
+	files      *fileServers   // File servers collectors reach with sftp
+	mail       *mailer        // SMTP server of the admin settings used by mail.send
+	cache      *starlarkCache // Frozen globals of executed scripts, keyed by scriptCacheKey
 }
 
 // NewStarlarkRunner creates a new StarlarkRunner instance.
-func NewStarlarkRunner(logger *slog.Logger, httpClient *HTTPClient, store *storage.Store) *StarlarkRunner {
+func NewStarlarkRunner(logger *slog.Logger, httpClient *HTTPClient, store storage.Store, limits Limits, envAllowlist []string) *StarlarkRunner {
 	return &StarlarkRunner{
 		logger:     logger,
 		httpClient: httpClient,
 		store:      store,
+		limits:     newLiveLimits(limits),
+		env:        newScriptEnv(envAllowlist),
+		databases:  newSQLDatabases(store),
+		files:      &fileServers{store: store, logger: logger},
+		mail:       &mailer{store: store},
+		cache:      newStarlarkCache(),
 	}
 }
 
-// Execute runs the Starlark script.
-func (r *StarlarkRunner) Execute(script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}) (*TransformedMessage, error) {
+// Execute runs the Starlark script. A run that exceeds the time or memory limit is cancelled and fails
+// with ErrScriptTimeout or ErrScriptMemoryLimit.
+func (r *StarlarkRunner) Execute(namespace, script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}, scriptContext *ScriptContext) (*TransformedMessage, error) {
 	thread := &starlark.Thread{Name: "script_execution_thread"}
+	guard := startGuard(r.limits.get(), func(reason error) { thread.Cancel(reason.Error()) })
+	defer guard.stop()
+
+	result, err := r.execute(thread, namespace, script, messageBody, messageHeaders, scriptContext)
+	return result, guard.wrap(err)
+}
+
+// PurgeCache drops the cached script globals, so the next runs execute the scripts again.
+func (r *StarlarkRunner) PurgeCache() {
+	r.cache.purge()
+}
+
+// execute runs the script and its transform or collect function on the given thread.
+func (r *StarlarkRunner) execute(thread *starlark.Thread, namespace, script string, messageBody map[string]interface{}, messageHeaders map[string]interface{}, scriptContext *ScriptContext) (*TransformedMessage, error) {
 
 	// Inject logger
 	logModule := starlarkstruct.FromStringDict(starlark.String("log"), starlark.StringDict{
@@ -62,28 +93,12 @@ func (r *StarlarkRunner) Execute(script string, messageBody map[string]interface
 
 	// Inject HTTP client
 	httpClientModule := starlarkstruct.FromStringDict(starlark.String("http"), starlark.StringDict{
-		"get": starlark.NewBuiltin("http.get", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-			var url string
-			var headersDict *starlark.Dict
-			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &url, "headers?", &headersDict); err != nil {
-				return nil, err
-			}
-			headers := make(map[string]string)
-			if headersDict != nil {
-				for _, item := range headersDict.Items() {
-					key, _ := item.Index(0).(starlark.String)
-					val, _ := item.Index(1).(starlark.String)
-					headers[key.GoString()] = val.GoString()
-				}
-			}
-			resp := r.httpClient.Get(url, headers)
-			return starlarkstruct.FromStringDict(starlark.String("HTTPResponse"), starlark.StringDict{
-				"status_code": starlark.MakeInt(resp.StatusCode),
-				"body":        starlark.String(resp.Body),
-				"headers":     convertStringMapToStarlarkDict(resp.Headers),
-				"error":       starlark.String(resp.Error),
-			}), nil
-		}),
+		"get":    r.httpBuiltin("get", false),
+		"post":   r.httpBuiltin("post", true),
+		"put":    r.httpBuiltin("put", true),
+		"patch":  r.httpBuiltin("patch", true),
+		"delete": r.httpBuiltin("delete", false),
+		"head":   r.httpBuiltin("head", false),
 	})
 
 	starlarkBody, err := convertMapToStarlarkDict(messageBody)
@@ -96,19 +111,44 @@ func (r *StarlarkRunner) Execute(script string, messageBody map[string]interface
 	}
 
 	predeclared := starlark.StringDict{
-		"log":  logModule,
-		"http": httpClientModule,
-		"json": starlarkjson.Module,
+		"log":    logModule,
+		"http":   httpClientModule,
+		"json":   starlarkjson.Module,
+		"re":     starlarkReModule,
+		"math":   starlarkmath.Module,
+		"xml":    starlarkXMLModule,
+		"csv":    starlarkCSVModule,
+		"soap":   r.starlarkSOAP(),
+		"mail":   r.starlarkMail(),
+		"crypto": starlarkCryptoModule,
+		"time":   starlarkTimeModule,
+		"uuid":   starlarkUUID,
+		"env":    r.env.starlarkModule(),
+		"kv":     starlarkState(newScriptState(r.store, namespace)),
+	}
+	if storage.IsCollectorStateNamespace(namespace) {
+		predeclared["sql"] = r.starlarkSQL()
+		predeclared["sftp"] = r.starlarkSFTP()
 	}
 
-	starlarkGlobals, err := starlark.ExecFile(thread, "script", script, predeclared)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute Starlark script: %w", err)
+	// The top-level code of a script runs once; later runs call the functions of its cached globals.
+	key := scriptCacheKey(namespace, script)
+	starlarkGlobals, cached := r.cache.get(key)
+	if !cached {
+		thread.Load = r.starlarkLoader(predeclared)
+		starlarkGlobals, err = starlark.ExecFile(thread, "script", script, predeclared)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute Starlark script: %w", err)
+		}
+		r.cache.put(key, starlarkGlobals)
 	}
 
 	if transformFunc, found := starlarkGlobals["transform"]; found {
 		if callable, ok := transformFunc.(starlark.Callable); ok {
-			args := starlark.Tuple{starlarkBody, starlarkHeaders}
+			args, err := starlarkCallArgs(callable, starlark.Tuple{starlarkBody, starlarkHeaders}, scriptContext)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert script context to Starlark dict: %w", err)
+			}
 			result, err := starlark.Call(thread, callable, args, nil)
 			if err != nil {
 				return nil, fmt.Errorf("failed to execute transform function: %w", err)
@@ -128,39 +168,108 @@ func (r *StarlarkRunner) Execute(script string, messageBody map[string]interface
 				return nil, nil // No body returned, treat as filtered
 			}
 
+			priority, err := parsePriority(resultMap)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform result: %w", err)
+			}
+			destination, err := parseDestination(resultMap)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform result: %w", err)
+			}
+			headers, err := parseHeaders(resultMap, messageHeaders)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform result: %w", err)
+			}
+			props, err := parseProperties(resultMap)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform result: %w", err)
+			}
+
 			return &TransformedMessage{
-				Body:    transformedBody,
-				Headers: messageHeaders, // Headers passed through
+				Body:        transformedBody,
+				Headers:     headers,
+				Destination: destination,
+				Priority:    priority,
+				Properties:  props,
 			}, nil
 		}
 	}
 
 	if collectFunc, found := starlarkGlobals["collect"]; found {
 		if callable, ok := collectFunc.(starlark.Callable); ok {
-			result, err := starlark.Call(thread, callable, nil, nil)
+			args, err := starlarkCallArgs(callable, nil, scriptContext)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert script context to Starlark dict: %w", err)
+			}
+			result, err := starlark.Call(thread, callable, args, nil)
 			if err != nil {
 				return nil, fmt.Errorf("failed to execute collect function: %w", err)
 			}
 			if result == starlark.None {
 				return nil, nil // No data collected
 			}
-			resultMap, err := convertStarlarkDictToMap(result)
-			if err != nil {
-				return nil, fmt.Errorf("collect result must be a dict, got %s", result.Type())
+			switch result.(type) {
+			case *starlark.Dict, *starlark.List:
+			default:
+				return nil, fmt.Errorf("collect result must be a dict or a list of dicts, got %s", result.Type())
 			}
-			if len(resultMap) > 0 {
-				return &TransformedMessage{
-					Body:    resultMap,
-					Headers: make(map[string]interface{}),
-				}, nil
+			goResult, err := fromStarlarkValue(result)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert collect result: %w", err)
 			}
-			return nil, nil
+			return collectedMessage(goResult)
 		}
 	}
 
 	return nil, fmt.Errorf("script must define a 'transform' or 'collect' function")
 }
 
+// httpBuiltin returns the http module function for the given method. Methods with a body take it as
+// the optional "body" argument after the url and headers. Every method also accepts the timeout_ms,
+// retries and backoff_ms keyword arguments that override the client defaults for this call, and get
+// accepts cache_ttl_ms.
+func (r *StarlarkRunner) httpBuiltin(method string, withBody bool) *starlark.Builtin {
+	return starlark.NewBuiltin("http."+method, func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var url, body string
+		var headersDict *starlark.Dict
+		var timeoutMs, retries, backoffMs, cacheTTLMs starlark.Value
+		params := []interface{}{"url", &url, "headers?", &headersDict}
+		if withBody {
+			params = append(params, "body?", &body)
+		}
+		params = append(params, "timeout_ms?", &timeoutMs, "retries?", &retries, "backoff_ms?", &backoffMs, "cache_ttl_ms?", &cacheTTLMs)
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, params...); err != nil {
+			return nil, err
+		}
+		headers := make(map[string]string)
+		if headersDict != nil {
+			for _, item := range headersDict.Items() {
+				key, _ := item.Index(0).(starlark.String)
+				val, _ := item.Index(1).(starlark.String)
+				headers[key.GoString()] = val.GoString()
+			}
+		}
+		options := make(map[string]interface{})
+		for name, v := range map[string]starlark.Value{"timeout_ms": timeoutMs, "retries": retries, "backoff_ms": backoffMs, "cache_ttl_ms": cacheTTLMs} {
+			if v == nil || v == starlark.None {
+				continue
+			}
+			goVal, err := fromStarlarkValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", fn.Name(), name, err)
+			}
+			options[name] = goVal
+		}
+		resp := r.httpClient.Do(strings.ToUpper(method), url, headers, body, options)
+		return starlarkstruct.FromStringDict(starlark.String("HTTPResponse"), starlark.StringDict{
+			"status_code": starlark.MakeInt(resp.StatusCode),
+			"body":        starlark.String(resp.Body),
+			"headers":     convertStringMapToStarlarkDict(resp.Headers),
+			"error":       starlark.String(resp.Error),
+		}), nil
+	})
+}
+
 // convertMapToStarlarkDict converts a Go map[string]interface{} to a Starlark dictionary.
 func convertMapToStarlarkDict(goMap map[string]interface{}) (*starlark.Dict, error) {
 	dict := starlark.NewDict(len(goMap))
@@ -293,6 +402,10 @@ func fromStarlarkValue(s starlark.Value) (interface{}, error) {
 			goList[i] = item
 		}
 		return goList, nil
+	case starlarktime.Time:
+		return time.Time(v).Format(time.RFC3339Nano), nil
+	case starlarktime.Duration:
+		return time.Duration(v).String(), nil
 	case *starlarkstruct.Struct: // Handle structs for HTTPResponse etc.
 		goMap := make(map[string]interface{})
 		for _, field := range v.AttrNames() {
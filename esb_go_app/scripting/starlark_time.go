@@ -0,0 +1,50 @@
+package scripting
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	starlarktime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// starlarkUUID is the uuid() builtin of Starlark scripts, the counterpart of crypto.randomUUID() in
+// JavaScript. It returns a random (version 4) UUID as a string.
+var starlarkUUID = starlark.NewBuiltin("uuid", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	return starlark.String(uuid.New().String()), nil
+})
+
+// starlarkTimeModule is the time module of Starlark scripts. It is the standard Starlark time module
+// with the layouts needed to format timestamps and the helpers that mirror Date in JavaScript:
+// time.now_ms() is Date.now() and time.now_iso() is new Date().toISOString().
+var starlarkTimeModule = newStarlarkTimeModule()
+
+func newStarlarkTimeModule() *starlarkstruct.Module {
+	members := starlark.StringDict{
+		"RFC3339":     starlark.String(time.RFC3339),
+		"RFC3339Nano": starlark.String(time.RFC3339Nano),
+		"RFC1123":     starlark.String(time.RFC1123),
+		"DateOnly":    starlark.String(time.DateOnly),
+		"DateTime":    starlark.String(time.DateTime),
+		"now_ms": starlark.NewBuiltin("time.now_ms", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+				return nil, err
+			}
+			return starlark.MakeInt64(time.Now().UnixMilli()), nil
+		}),
+		"now_iso": starlark.NewBuiltin("time.now_iso", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+				return nil, err
+			}
+			return starlark.String(time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")), nil
+		}),
+	}
+	for name, member := range starlarktime.Module.Members {
+		members[name] = member
+	}
+	return &starlarkstruct.Module{Name: "time", Members: members}
+}
@@ -0,0 +1,201 @@
+package scripting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"esb-go-app/storage"
+
+	"github.com/dop251/goja"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// MaxStateValueSize is the largest JSON-encoded value a script can store with kv.set.
+const MaxStateValueSize = 1 << 20
+
+// scriptState is the kv object of a script run. Values are stored as JSON in the namespace of the
+// transformation or collector, so they survive between runs. A run without a namespace, such as a
+// bundle test, keeps its state in memory for the duration of the run only.
+type scriptState struct {
+	store     storage.Store
+	namespace string
+	local     map[string]string
+}
+
+func newScriptState(store storage.Store, namespace string) *scriptState {
+	st := &scriptState{store: store, namespace: namespace}
+	if store == nil || namespace == "" {
+		st.local = make(map[string]string)
+	}
+	return st
+}
+
+// get returns the value stored under the key, and false if there is none.
+func (st *scriptState) get(key string) (interface{}, bool, error) {
+	var raw string
+	var found bool
+	if st.local != nil {
+		raw, found = st.local[key]
+	} else {
+		var err error
+		if raw, found, err = st.store.GetScriptState(st.namespace, key); err != nil {
+			return nil, false, err
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+	value, err := decodeStateValue(raw)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode state %q: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// set stores the value under the key. Setting a key to null removes it.
+func (st *scriptState) set(key string, value interface{}) error {
+	if key == "" {
+		return fmt.Errorf("state key must not be empty")
+	}
+	if value == nil {
+		return st.delete(key)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("state %q must be JSON-compatible: %w", key, err)
+	}
+	if len(encoded) > MaxStateValueSize {
+		return fmt.Errorf("state %q is %d bytes, the limit is %d", key, len(encoded), MaxStateValueSize)
+	}
+	if st.local != nil {
+		st.local[key] = string(encoded)
+		return nil
+	}
+	return st.store.SetScriptState(st.namespace, key, string(encoded))
+}
+
+// delete removes the value stored under the key.
+func (st *scriptState) delete(key string) error {
+	if st.local != nil {
+		delete(st.local, key)
+		return nil
+	}
+	return st.store.DeleteScriptState(st.namespace, key)
+}
+
+// decodeStateValue decodes a stored value, keeping whole numbers as integers so counters stay ints.
+func decodeStateValue(raw string) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return normalizeStateNumbers(value), nil
+}
+
+// normalizeStateNumbers replaces the json.Number values of a decoded value with int64 or float64.
+func normalizeStateNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = normalizeStateNumbers(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeStateNumbers(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// starlarkState returns the kv module of a Starlark run.
+func starlarkState(st *scriptState) *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "kv",
+		Members: starlark.StringDict{
+			"get": starlark.NewBuiltin("kv.get", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var key string
+				var def starlark.Value = starlark.None
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "default?", &def); err != nil {
+					return nil, err
+				}
+				value, found, err := st.get(key)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				if !found {
+					return def, nil
+				}
+				return toStarlarkValue(value)
+			}),
+			"set": starlark.NewBuiltin("kv.set", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var key string
+				var value starlark.Value
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "value", &value); err != nil {
+					return nil, err
+				}
+				goValue, err := fromStarlarkValue(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				if err := st.set(key, goValue); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+			"delete": starlark.NewBuiltin("kv.delete", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var key string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key); err != nil {
+					return nil, err
+				}
+				if err := st.delete(key); err != nil {
+					return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+		},
+	}
+}
+
+// gojaState returns the kv object of a JavaScript run.
+func gojaState(vm *goja.Runtime, st *scriptState) *goja.Object {
+	kv := vm.NewObject()
+	_ = kv.Set("get", func(call goja.FunctionCall) goja.Value {
+		value, found, err := st.get(call.Argument(0).String())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		if !found {
+			if len(call.Arguments) > 1 {
+				return call.Argument(1)
+			}
+			return goja.Null()
+		}
+		return vm.ToValue(value)
+	})
+	_ = kv.Set("set", func(call goja.FunctionCall) goja.Value {
+		if err := st.set(call.Argument(0).String(), call.Argument(1).Export()); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return goja.Undefined()
+	})
+	_ = kv.Set("delete", func(call goja.FunctionCall) goja.Value {
+		if err := st.delete(call.Argument(0).String()); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return goja.Undefined()
+	})
+	return kv
+}
@@ -0,0 +1,446 @@
+package scripting
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// XML documents map to dicts the way the xmltodict convention does: an element becomes a key holding its
+// text, or a dict when it has attributes or children. Attributes are keys prefixed with "@", the text of
+// such an element is kept under "#text" and repeated children become a list. Keys keep the document
+// order, so a dict built from a parsed document is serialized in the same order.
+const (
+	xmlAttrPrefix = "@"
+	xmlTextKey    = "#text"
+)
+
+// xmlObject is an element of a parsed document, or a dict passed to xml.build, with its keys in order.
+type xmlObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newXMLObject() *xmlObject {
+	return &xmlObject{values: make(map[string]interface{})}
+}
+
+func (o *xmlObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// addChild adds a child element, turning the key into a list when the element repeats.
+func (o *xmlObject) addChild(key string, value interface{}) {
+	existing, ok := o.values[key]
+	if !ok {
+		o.set(key, value)
+		return
+	}
+	if list, ok := existing.([]interface{}); ok {
+		o.values[key] = append(list, value)
+		return
+	}
+	o.values[key] = []interface{}{existing, value}
+}
+
+// xmlElement is an element that is being parsed.
+type xmlElement struct {
+	name   string
+	object *xmlObject
+	text   strings.Builder
+}
+
+// parseXML parses an XML document into a single-key object holding its root element. Documents in
+// other encodings than UTF-8, such as windows-1251, are decoded according to their declaration.
+func parseXML(data string) (*xmlObject, error) {
+	decoder := xml.NewDecoder(strings.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported XML encoding %q", label)
+		}
+		return enc.NewDecoder().Reader(input), nil
+	}
+
+	prefixes := map[string]string{"http://www.w3.org/XML/1998/namespace": "xml"} // Namespace URL to the prefix declared for it
+	qualify := func(name xml.Name) string {
+		if name.Space == "" {
+			return name.Local
+		}
+		if prefix := prefixes[name.Space]; prefix != "" {
+			return prefix + ":" + name.Local
+		}
+		return name.Local // The default namespace, or an undeclared one
+	}
+
+	root := newXMLObject()
+	var stack []*xmlElement
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &xmlElement{object: newXMLObject()}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					prefixes[attr.Value] = attr.Name.Local
+				}
+			}
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					el.object.set(xmlAttrPrefix+"xmlns:"+attr.Name.Local, attr.Value)
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					el.object.set(xmlAttrPrefix+"xmlns", attr.Value)
+				default:
+					el.object.set(xmlAttrPrefix+qualify(attr.Name), attr.Value)
+				}
+			}
+			el.name = qualify(t.Name)
+			stack = append(stack, el)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			el := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			text := strings.TrimSpace(el.text.String())
+			var value interface{} = text
+			if len(el.object.keys) > 0 {
+				if text != "" {
+					el.object.set(xmlTextKey, text)
+				}
+				value = el.object
+			}
+			if len(stack) == 0 {
+				root.set(el.name, value)
+			} else {
+				stack[len(stack)-1].object.addChild(el.name, value)
+			}
+		}
+	}
+	if len(root.keys) == 0 {
+		return nil, fmt.Errorf("invalid XML: no root element")
+	}
+	return root, nil
+}
+
+// buildXML serializes a single-key object into an XML document with the key as the root element.
+func buildXML(value interface{}, indent string, header bool) (string, error) {
+	root, ok := value.(*xmlObject)
+	if !ok || len(root.keys) != 1 {
+		return "", fmt.Errorf("xml.build expects a dict with a single key naming the root element")
+	}
+	rootName := root.keys[0]
+	if _, ok := root.values[rootName].([]interface{}); ok {
+		return "", fmt.Errorf("the root element %q cannot be a list", rootName)
+	}
+
+	var buf bytes.Buffer
+	if header {
+		buf.WriteString(xml.Header)
+	}
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", indent)
+	if err := writeXMLElement(encoder, rootName, root.values[rootName]); err != nil {
+		return "", err
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeXMLElement writes the element with the given name and value; a list writes the element once per item.
+func writeXMLElement(encoder *xml.Encoder, name string, value interface{}) error {
+	if name == "" || strings.HasPrefix(name, xmlAttrPrefix) || name == xmlTextKey {
+		return fmt.Errorf("invalid XML element name %q", name)
+	}
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			if _, nested := item.([]interface{}); nested {
+				return fmt.Errorf("element %q: nested lists cannot be serialized", name)
+			}
+			if err := writeXMLElement(encoder, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	obj, isObject := value.(*xmlObject)
+	if !isObject {
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		if text := xmlText(value); text != "" {
+			if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	}
+
+	for _, key := range obj.keys {
+		if strings.HasPrefix(key, xmlAttrPrefix) {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: strings.TrimPrefix(key, xmlAttrPrefix)}, Value: xmlText(obj.values[key])})
+		}
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if text := xmlText(obj.values[xmlTextKey]); text != "" {
+		if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	for _, key := range obj.keys {
+		if strings.HasPrefix(key, xmlAttrPrefix) || key == xmlTextKey {
+			continue
+		}
+		if err := writeXMLElement(encoder, key, obj.values[key]); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlText formats a scalar value as element text or an attribute value.
+func xmlText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// xmlObjectFromMap converts a Go map into an xmlObject with sorted keys, for values that lost their order.
+func xmlObjectFromMap(m map[string]interface{}) *xmlObject {
+	obj := newXMLObject()
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		obj.set(k, xmlValueFromGo(m[k]))
+	}
+	return obj
+}
+
+// xmlValueFromGo converts nested Go maps and slices into the values written by buildXML.
+func xmlValueFromGo(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return xmlObjectFromMap(val)
+	case []interface{}:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			items[i] = xmlValueFromGo(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+// xmlToStarlark converts a parsed document into Starlark dicts and lists.
+func xmlToStarlark(v interface{}) starlark.Value {
+	switch val := v.(type) {
+	case *xmlObject:
+		dict := starlark.NewDict(len(val.keys))
+		for _, k := range val.keys {
+			_ = dict.SetKey(starlark.String(k), xmlToStarlark(val.values[k]))
+		}
+		return dict
+	case []interface{}:
+		items := make([]starlark.Value, len(val))
+		for i, item := range val {
+			items[i] = xmlToStarlark(item)
+		}
+		return starlark.NewList(items)
+	case string:
+		return starlark.String(val)
+	default:
+		return starlark.None
+	}
+}
+
+// xmlFromStarlark converts a Starlark value passed to xml.build, keeping the order of dict keys.
+func xmlFromStarlark(v starlark.Value) (interface{}, error) {
+	switch val := v.(type) {
+	case *starlark.Dict:
+		obj := newXMLObject()
+		for _, item := range val.Items() {
+			key, ok := item.Index(0).(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, got %s", item.Index(0).Type())
+			}
+			child, err := xmlFromStarlark(item.Index(1))
+			if err != nil {
+				return nil, err
+			}
+			obj.set(key.GoString(), child)
+		}
+		return obj, nil
+	case *starlark.List, starlark.Tuple:
+		iter := starlark.Iterate(val)
+		defer iter.Done()
+		var items []interface{}
+		var item starlark.Value
+		for iter.Next(&item) {
+			child, err := xmlFromStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, child)
+		}
+		return items, nil
+	default:
+		goVal, err := fromStarlarkValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return xmlValueFromGo(goVal), nil
+	}
+}
+
+// xmlToGoja converts a parsed document into JavaScript objects and arrays.
+func xmlToGoja(vm *goja.Runtime, v interface{}) goja.Value {
+	switch val := v.(type) {
+	case *xmlObject:
+		obj := vm.NewObject()
+		for _, k := range val.keys {
+			_ = obj.Set(k, xmlToGoja(vm, val.values[k]))
+		}
+		return obj
+	case []interface{}:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			items[i] = xmlToGoja(vm, item)
+		}
+		return vm.NewArray(items...)
+	case string:
+		return vm.ToValue(val)
+	default:
+		return goja.Null()
+	}
+}
+
+// xmlFromGoja converts a JavaScript value passed to xml.build, keeping the order of object keys.
+func xmlFromGoja(vm *goja.Runtime, v goja.Value) interface{} {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return v.Export()
+	}
+	switch obj.Export().(type) {
+	case []interface{}:
+		length := int(obj.Get("length").ToInteger())
+		items := make([]interface{}, length)
+		for i := 0; i < length; i++ {
+			items[i] = xmlFromGoja(vm, obj.Get(strconv.Itoa(i)))
+		}
+		return items
+	case map[string]interface{}:
+		result := newXMLObject()
+		for _, k := range obj.Keys() {
+			result.set(k, xmlFromGoja(vm, obj.Get(k)))
+		}
+		return result
+	default:
+		return obj.Export()
+	}
+}
+
+// starlarkXMLModule is the xml module of Starlark scripts.
+var starlarkXMLModule = &starlarkstruct.Module{
+	Name: "xml",
+	Members: starlark.StringDict{
+		"parse": starlark.NewBuiltin("xml.parse", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var data string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "data", &data); err != nil {
+				return nil, err
+			}
+			doc, err := parseXML(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return xmlToStarlark(doc), nil
+		}),
+		"build": starlark.NewBuiltin("xml.build", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var value starlark.Value
+			var indent string
+			header := true
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &value, "indent?", &indent, "header?", &header); err != nil {
+				return nil, err
+			}
+			doc, err := xmlFromStarlark(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			out, err := buildXML(doc, indent, header)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.String(out), nil
+		}),
+	},
+}
+
+// gojaXML returns the xml object of JavaScript scripts: xml.parse(text) and xml.build(value, indent, header).
+func gojaXML(vm *goja.Runtime) *goja.Object {
+	obj := vm.NewObject()
+	_ = obj.Set("parse", func(call goja.FunctionCall) goja.Value {
+		doc, err := parseXML(call.Argument(0).String())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return xmlToGoja(vm, doc)
+	})
+	_ = obj.Set("build", func(call goja.FunctionCall) goja.Value {
+		indent := ""
+		if arg := call.Argument(1); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			indent = arg.String()
+		}
+		header := true
+		if arg := call.Argument(2); !goja.IsUndefined(arg) {
+			header = arg.ToBoolean()
+		}
+		out, err := buildXML(xmlFromGoja(vm, call.Argument(0)), indent, header)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(out)
+	})
+	return obj
+}
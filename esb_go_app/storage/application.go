@@ -3,12 +3,21 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// applicationColumns is the column list used by every query that loads full Application rows.
+const applicationColumns = `id, name, client_secret, id_token, vhost, created_at, updated_at, previous_id_token, previous_id_token_expires_at`
+
 // CreateApplication.
-func (s *Store) CreateApplication(app *Application) error {
-	query := `INSERT INTO applications (id, name, client_secret, id_token) VALUES (?, ?, ?, ?)`
-	_, err := s.db.Exec(query, app.ID, app.Name, app.ClientSecret, app.IDToken)
+func (s *SQLStore) CreateApplication(app *Application) error {
+	secret, token, tokenHash, err := s.sealCredentials(app.ClientSecret, app.IDToken)
+	if err != nil {
+		return fmt.Errorf("failed to create application: %w", err)
+	}
+	query := `INSERT INTO applications (id, name, client_secret, id_token, id_token_hash, vhost) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = s.db.Exec(query, app.ID, app.Name, secret, token, tokenHash, app.VHost)
 	if err != nil {
 		return fmt.Errorf("failed to create application: %w", err)
 	}
@@ -16,12 +25,8 @@ func (s *Store) CreateApplication(app *Application) error {
 }
 
 // GetApplicationByName
-func (s *Store) GetApplicationByName(name string) (*Application, error) {
-	query := `SELECT id, name, client_secret, id_token, created_at, updated_at FROM applications WHERE name = ?`
-	row := s.db.QueryRow(query, name)
-
-	app := &Application{}
-	err := row.Scan(&app.ID, &app.Name, &app.ClientSecret, &app.IDToken, &app.CreatedAt, &app.UpdatedAt)
+func (s *SQLStore) GetApplicationByName(name string) (*Application, error) {
+	app, err := s.scanApplication(s.db.QueryRow(`SELECT `+applicationColumns+` FROM applications WHERE name = ?`, name))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -32,12 +37,8 @@ func (s *Store) GetApplicationByName(name string) (*Application, error) {
 }
 
 // GetApplicationByID
-func (s *Store) GetApplicationByID(id string) (*Application, error) {
-	query := `SELECT id, name, client_secret, id_token, created_at, updated_at FROM applications WHERE id = ?`
-	row := s.db.QueryRow(query, id)
-
-	app := &Application{}
-	err := row.Scan(&app.ID, &app.Name, &app.ClientSecret, &app.IDToken, &app.CreatedAt, &app.UpdatedAt)
+func (s *SQLStore) GetApplicationByID(id string) (*Application, error) {
+	app, err := s.scanApplication(s.db.QueryRow(`SELECT `+applicationColumns+` FROM applications WHERE id = ?`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -47,13 +48,26 @@ func (s *Store) GetApplicationByID(id string) (*Application, error) {
 	return app, nil
 }
 
-// GetApplicationByIDToken
-func (s *Store) GetApplicationByIDToken(token string) (*Application, error) {
-	query := `SELECT id, name, client_secret, id_token, created_at, updated_at FROM applications WHERE id_token = ?`
-	row := s.db.QueryRow(query, token)
-
-	app := &Application{}
-	err := row.Scan(&app.ID, &app.Name, &app.ClientSecret, &app.IDToken, &app.CreatedAt, &app.UpdatedAt)
+// GetApplicationByIDToken finds an application by its ID token, or by the token replaced by its last
+// rotation while the grace period of that token lasts. Encrypted tokens are looked up by their hash, so
+// only the application found is decrypted.
+func (s *SQLStore) GetApplicationByIDToken(token string) (*Application, error) {
+	if token == "" {
+		return nil, nil
+	}
+	column, previousColumn := "id_token", "previous_id_token"
+	if s.secrets != nil {
+		column, previousColumn = "id_token_hash", "previous_id_token_hash"
+		token = s.secrets.hash(token)
+	}
+	app, err := s.scanApplication(s.db.QueryRow(`SELECT `+applicationColumns+` FROM applications WHERE `+column+` = ?`, token))
+	if err == sql.ErrNoRows {
+		app, err = s.scanApplication(s.db.QueryRow(`SELECT `+applicationColumns+` FROM applications WHERE `+previousColumn+` = ?`, token))
+		if err == nil && app.PreviousIDToken == "" {
+			// The grace period of the previous token is over.
+			return nil, nil
+		}
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -63,10 +77,16 @@ func (s *Store) GetApplicationByIDToken(token string) (*Application, error) {
 	return app, nil
 }
 
-// GetAllApplications
-func (s *Store) GetAllApplications() ([]Application, error) {
-	query := `SELECT id, name, client_secret, id_token, created_at, updated_at FROM applications ORDER BY created_at DESC`
-	rows, err := s.db.Query(query)
+// GetAllApplications retrieves the applications matching the filter by name, newest first.
+func (s *SQLStore) GetAllApplications(filter ListFilter) ([]Application, error) {
+	query := `SELECT ` + applicationColumns + ` FROM applications`
+	conditions, args := filterConditions(filter, "id", "", "name")
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	page, pageArgs := pageClause(filter)
+	query += ` ORDER BY created_at DESC, id` + page
+	rows, err := s.db.Query(query, append(args, pageArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all applications: %w", err)
 	}
@@ -74,28 +94,57 @@ func (s *Store) GetAllApplications() ([]Application, error) {
 
 	var apps []Application
 	for rows.Next() {
-		var app Application
-		if err := rows.Scan(&app.ID, &app.Name, &app.ClientSecret, &app.IDToken, &app.CreatedAt, &app.UpdatedAt); err != nil {
+		app, err := s.scanApplication(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan application row: %w", err)
 		}
-		apps = append(apps, app)
+		apps = append(apps, *app)
 	}
 
 	return apps, nil
 }
 
 // UpdateApplication
-func (s *Store) UpdateApplication(app *Application) error {
-	query := `UPDATE applications SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := s.db.Exec(query, app.Name, app.ID)
+func (s *SQLStore) UpdateApplication(app *Application) error {
+	query := `UPDATE applications SET name = ?, vhost = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := s.db.Exec(query, app.Name, app.VHost, app.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update application: %w", err)
 	}
 	return nil
 }
 
+// RotateApplicationCredentials replaces the client secret and ID token of an application. The replaced ID
+// token stays valid for the grace period, and is rejected at once when the grace period is zero.
+func (s *SQLStore) RotateApplicationCredentials(id, secret, token string, grace time.Duration) error {
+	app, err := s.GetApplicationByID(id)
+	if err != nil {
+		return err
+	}
+	if app == nil {
+		return fmt.Errorf("application %s not found", id)
+	}
+	secret, token, tokenHash, err := s.sealCredentials(secret, token)
+	if err != nil {
+		return fmt.Errorf("failed to rotate application credentials: %w", err)
+	}
+	var previous, previousHash string
+	var expiresAt interface{}
+	if grace > 0 {
+		if previous, previousHash, err = s.sealToken(app.IDToken); err != nil {
+			return fmt.Errorf("failed to rotate application credentials: %w", err)
+		}
+		expiresAt = time.Now().UTC().Add(grace)
+	}
+	query := `UPDATE applications SET client_secret = ?, id_token = ?, id_token_hash = ?, previous_id_token = ?, previous_id_token_hash = ?, previous_id_token_expires_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err := s.db.Exec(query, secret, token, tokenHash, previous, previousHash, expiresAt, id); err != nil {
+		return fmt.Errorf("failed to rotate application credentials: %w", err)
+	}
+	return nil
+}
+
 // DeleteApplication
-func (s *Store) DeleteApplication(id string) error {
+func (s *SQLStore) DeleteApplication(id string) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -113,3 +162,29 @@ func (s *Store) DeleteApplication(id string) error {
 
 	return tx.Commit()
 }
+
+// scanApplication scans an application row of applicationColumns and decrypts its credentials. A previous
+// ID token whose grace period is over is left out.
+func (s *SQLStore) scanApplication(row rowScanner) (*Application, error) {
+	app := &Application{}
+	var previousExpiresAt sql.NullTime
+	if err := row.Scan(&app.ID, &app.Name, &app.ClientSecret, &app.IDToken, &app.VHost, &app.CreatedAt, &app.UpdatedAt, &app.PreviousIDToken, &previousExpiresAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if app.ClientSecret, err = s.openSecret(app.ClientSecret); err != nil {
+		return nil, fmt.Errorf("client secret of application %s: %w", app.ID, err)
+	}
+	if app.IDToken, err = s.openSecret(app.IDToken); err != nil {
+		return nil, fmt.Errorf("ID token of application %s: %w", app.ID, err)
+	}
+	if !previousExpiresAt.Valid || !time.Now().Before(previousExpiresAt.Time) {
+		app.PreviousIDToken = ""
+		return app, nil
+	}
+	if app.PreviousIDToken, err = s.openSecret(app.PreviousIDToken); err != nil {
+		return nil, fmt.Errorf("previous ID token of application %s: %w", app.ID, err)
+	}
+	app.PreviousIDTokenExpiresAt = previousExpiresAt.Time
+	return app, nil
+}
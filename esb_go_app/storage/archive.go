@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const archiveColumns = `id, route_id, route_name, message_id, trace_id, source, destination, outcome, error, headers, body, output_body, received_at, processed_at`
+
+// DefaultArchiveSearchLimit is how many archived messages a search returns when it sets no limit.
+const DefaultArchiveSearchLimit = 100
+
+// ArchiveMessage stores a delivery of an archiving route.
+func (s *SQLStore) ArchiveMessage(msg *ArchivedMessage) error {
+	if msg.ProcessedAt.IsZero() {
+		msg.ProcessedAt = time.Now()
+	}
+	if msg.ReceivedAt.IsZero() {
+		msg.ReceivedAt = msg.ProcessedAt
+	}
+	query := `INSERT INTO message_archive (route_id, route_name, message_id, trace_id, source, destination, outcome, error, headers, body, output_body, received_at, processed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.db.insertID(query, msg.RouteID, msg.RouteName, msg.MessageID, msg.TraceID, msg.Source, msg.Destination, msg.Outcome, msg.Error, msg.Headers, msg.Body, msg.OutputBody, msg.ReceivedAt, msg.ProcessedAt)
+	if err != nil {
+		return fmt.Errorf("failed to archive message: %w", err)
+	}
+	msg.ID = id
+	return nil
+}
+
+// SearchArchive returns the archived messages matching the search, newest first.
+func (s *SQLStore) SearchArchive(search ArchiveSearch) ([]ArchivedMessage, error) {
+	var conditions []string
+	var args []interface{}
+	if search.RouteID != "" {
+		conditions = append(conditions, `route_id = ?`)
+		args = append(args, search.RouteID)
+	}
+	if search.Outcome != "" {
+		conditions = append(conditions, `outcome = ?`)
+		args = append(args, search.Outcome)
+	}
+	if term := strings.TrimSpace(search.Term); term != "" {
+		conditions = append(conditions, `(message_id = ? OR trace_id = ? OR body LIKE '%' || ? || '%')`)
+		args = append(args, term, term, term)
+	}
+	limit := search.Limit
+	if limit <= 0 {
+		limit = DefaultArchiveSearchLimit
+	}
+
+	query := `SELECT ` + archiveColumns + ` FROM message_archive`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search message archive: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []ArchivedMessage
+	for rows.Next() {
+		msg, err := scanArchivedMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	return messages, rows.Err()
+}
+
+// GetArchivedMessage returns an archived message by its ID, or nil if there is none.
+func (s *SQLStore) GetArchivedMessage(id int64) (*ArchivedMessage, error) {
+	msg, err := scanArchivedMessage(s.db.QueryRow(`SELECT `+archiveColumns+` FROM message_archive WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// PruneArchive deletes the messages archived before the given time and returns how many were deleted.
+func (s *SQLStore) PruneArchive(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM message_archive WHERE processed_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune message archive: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// scanArchivedMessage scans a row selected with archiveColumns.
+func scanArchivedMessage(row rowScanner) (*ArchivedMessage, error) {
+	msg := &ArchivedMessage{}
+	if err := row.Scan(&msg.ID, &msg.RouteID, &msg.RouteName, &msg.MessageID, &msg.TraceID, &msg.Source, &msg.Destination, &msg.Outcome, &msg.Error, &msg.Headers, &msg.Body, &msg.OutputBody, &msg.ReceivedAt, &msg.ProcessedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan archived message row: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const auditColumns = `id, actor, remote_addr, method, path, kind, entity_id, action, status, old_value, new_value, created_at`
+
+// DefaultAuditSearchLimit is how many audit entries a search returns when it sets no limit.
+const DefaultAuditSearchLimit = 200
+
+// RecordAudit stores an entry of the audit log.
+func (s *SQLStore) RecordAudit(entry *AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	query := `INSERT INTO audit_log (actor, remote_addr, method, path, kind, entity_id, action, status, old_value, new_value, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.db.insertID(query, entry.Actor, entry.RemoteAddr, entry.Method, entry.Path, entry.Kind, entry.EntityID, entry.Action, entry.Status, entry.OldValue, entry.NewValue, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	entry.ID = id
+	return nil
+}
+
+// SearchAudit returns the audit entries matching the search, newest first.
+func (s *SQLStore) SearchAudit(search AuditSearch) ([]AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	if search.Kind != "" {
+		conditions = append(conditions, `kind = ?`)
+		args = append(args, search.Kind)
+	}
+	if search.Action != "" {
+		conditions = append(conditions, `action = ?`)
+		args = append(args, search.Action)
+	}
+	if search.Actor != "" {
+		conditions = append(conditions, `actor = ?`)
+		args = append(args, search.Actor)
+	}
+	if term := strings.TrimSpace(search.Term); term != "" {
+		conditions = append(conditions, `(entity_id = ? OR path LIKE '%' || ? || '%' OR old_value LIKE '%' || ? || '%' OR new_value LIKE '%' || ? || '%')`)
+		args = append(args, term, term, term, term)
+	}
+	limit := search.Limit
+	if limit <= 0 {
+		limit = DefaultAuditSearchLimit
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_log`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+// GetAuditEntry returns an audit entry by its ID, or nil if there is none.
+func (s *SQLStore) GetAuditEntry(id int64) (*AuditEntry, error) {
+	entry, err := scanAuditEntry(s.db.QueryRow(`SELECT `+auditColumns+` FROM audit_log WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetAuditActors returns the distinct actors of the audit log, to filter the log by.
+func (s *SQLStore) GetAuditActors() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT actor FROM audit_log WHERE actor <> '' ORDER BY actor`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit actors: %w", err)
+	}
+	defer rows.Close()
+
+	var actors []string
+	for rows.Next() {
+		var actor string
+		if err := rows.Scan(&actor); err != nil {
+			return nil, fmt.Errorf("failed to scan audit actor: %w", err)
+		}
+		actors = append(actors, actor)
+	}
+	return actors, rows.Err()
+}
+
+// scanAuditEntry scans a row selected with auditColumns.
+func scanAuditEntry(row rowScanner) (*AuditEntry, error) {
+	entry := &AuditEntry{}
+	if err := row.Scan(&entry.ID, &entry.Actor, &entry.RemoteAddr, &entry.Method, &entry.Path, &entry.Kind, &entry.EntityID, &entry.Action, &entry.Status, &entry.OldValue, &entry.NewValue, &entry.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan audit entry row: %w", err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"modernc.org/sqlite"
+)
+
+// ErrBackupUnsupported is returned by Backup and Restore when the store does not run on SQLite;
+// PostgreSQL databases are backed up with the tools of the server.
+var ErrBackupUnsupported = errors.New("backup and restore are only available with the SQLite storage")
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// backupRequiredTables are the tables a file must have to be accepted as a backup of the service.
+var backupRequiredTables = []string{"applications", "channels", "transformations", "routes"}
+
+// BackupInfo describes the content of a validated backup.
+type BackupInfo struct {
+	Applications    int
+	Channels        int
+	Transformations int
+	Routes          int
+}
+
+// sqliteBackuper is implemented by the connections of the SQLite driver.
+type sqliteBackuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// SupportsBackup reports whether the store can be backed up and restored online.
+func (s *SQLStore) SupportsBackup() bool {
+	_, ok := s.db.dialect.(sqliteDialect)
+	return ok
+}
+
+// Backup writes a consistent snapshot of the database to a new file at path with the SQLite backup
+// API. The pages are copied in a single step, so the routers keep writing while it runs and the
+// snapshot holds the database as it was when the step started.
+func (s *SQLStore) Backup(ctx context.Context, path string) error {
+	return s.copyDatabase(ctx, path, false)
+}
+
+// Restore replaces the content of the database with the backup at path, which should have been
+// checked with ValidateBackup. The connections of the pool see the restored data as soon as it
+// returns, but the workers, routers and collectors keep the configuration they were started with.
+// Credentials the backup holds in plain text are encrypted if the store has a secrets key.
+func (s *SQLStore) Restore(ctx context.Context, path string) error {
+	if err := s.copyDatabase(ctx, path, true); err != nil {
+		return err
+	}
+	if s.secrets != nil {
+		return s.encryptApplicationSecrets()
+	}
+	return nil
+}
+
+func (s *SQLStore) copyDatabase(ctx context.Context, path string, restore bool) error {
+	if !s.SupportsBackup() {
+		return ErrBackupUnsupported
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		backuper, ok := driverConn.(sqliteBackuper)
+		if !ok {
+			return ErrBackupUnsupported
+		}
+		var backup *sqlite.Backup
+		if restore {
+			backup, err = backuper.NewRestore(path)
+		} else {
+			backup, err = backuper.NewBackup(path)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to start backup: %w", err)
+		}
+		for more := true; more; {
+			if more, err = backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to copy database: %w", err)
+			}
+		}
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("failed to finish backup: %w", err)
+		}
+		return nil
+	})
+}
+
+// ValidateBackup checks that the file at path is an intact SQLite database holding the tables of the
+// service and brings its schema up to date, so a backup of an older version can be restored.
+func ValidateBackup(path string, logger *slog.Logger) (*BackupInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(f, header)
+	f.Close()
+	if err != nil || !bytes.Equal(header, sqliteHeader) {
+		return nil, errors.New("the file is not a SQLite database")
+	}
+
+	db, err := sql.Open(DriverSQLite, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check backup: %w", err)
+	}
+	if result != "ok" {
+		db.Close()
+		return nil, fmt.Errorf("the backup is damaged: %s", result)
+	}
+	for _, table := range backupRequiredTables {
+		var name string
+		err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&name)
+		if err == sql.ErrNoRows {
+			db.Close()
+			return nil, fmt.Errorf("the database has no %s table, it is not a backup of the service", table)
+		}
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to check backup: %w", err)
+		}
+	}
+	db.Close()
+
+	store, err := NewStore(path, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	info := &BackupInfo{}
+	counts := []struct {
+		table string
+		count *int
+	}{
+		{"applications", &info.Applications},
+		{"channels", &info.Channels},
+		{"transformations", &info.Transformations},
+		{"routes", &info.Routes},
+	}
+	for _, c := range counts {
+		if err := store.db.QueryRow(`SELECT COUNT(*) FROM ` + c.table).Scan(c.count); err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+	}
+	return info, nil
+}
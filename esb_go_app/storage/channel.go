@@ -3,12 +3,44 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
+// channelColumns lists the columns read by scanChannel, in order.
+// The vhost is taken from the channel's application.
+const channelColumns = "id, application_id, name, direction, destination, fanout_mode, connection, max_priority, silence_alert_minutes, queue_type, message_ttl_seconds, lazy_mode, tags, revision, " +
+	"COALESCE((SELECT vhost FROM applications WHERE applications.id = channels.application_id), ''), created_at"
+
+// scanChannel reads a single channel row selected with channelColumns.
+func scanChannel(row rowScanner) (*Channel, error) {
+	ch := &Channel{}
+	var tags string
+	if err := row.Scan(&ch.ID, &ch.ApplicationID, &ch.Name, &ch.Direction, &ch.Destination, &ch.FanoutMode, &ch.Connection, &ch.MaxPriority, &ch.SilenceAlert, &ch.QueueType, &ch.MessageTTL, &ch.LazyMode, &tags, &ch.Revision, &ch.VHost, &ch.CreatedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if ch.Tags, err = decodeTags(tags, ch.ID); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
 // CreateChannel
-func (s *Store) CreateChannel(ch *Channel) error {
-	query := `INSERT INTO channels (id, application_id, name, direction, destination, fanout_mode) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err := s.db.Exec(query, ch.ID, ch.ApplicationID, ch.Name, ch.Direction, ch.Destination, ch.FanoutMode)
+func (s *SQLStore) CreateChannel(ch *Channel) error {
+	if err := s.ValidateChannel(ch); err != nil {
+		return err
+	}
+	return insertChannel(s.db, ch)
+}
+
+// insertChannel inserts a channel that is already validated on the database or within a transaction.
+func insertChannel(e execer, ch *Channel) error {
+	tags, err := encodeTags(ch.Tags)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO channels (id, application_id, name, direction, destination, fanout_mode, connection, max_priority, silence_alert_minutes, queue_type, message_ttl_seconds, lazy_mode, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = e.Exec(query, ch.ID, ch.ApplicationID, ch.Name, ch.Direction, ch.Destination, ch.FanoutMode, ch.Connection, ch.MaxPriority, ch.SilenceAlert, ch.QueueType, ch.MessageTTL, ch.LazyMode, tags)
 	if err != nil {
 		return fmt.Errorf("failed to create channel: %w", err)
 	}
@@ -16,18 +48,25 @@ func (s *Store) CreateChannel(ch *Channel) error {
 }
 
 // UpdateChannel
-func (s *Store) UpdateChannel(ch *Channel) error {
-	query := `UPDATE channels SET name = ?, direction = ?, destination = ?, fanout_mode = ? WHERE id = ?`
-	_, err := s.db.Exec(query, ch.Name, ch.Direction, ch.Destination, ch.FanoutMode, ch.ID)
+func (s *SQLStore) UpdateChannel(ch *Channel) error {
+	if err := s.ValidateChannel(ch); err != nil {
+		return err
+	}
+	tags, err := encodeTags(ch.Tags)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE channels SET name = ?, direction = ?, destination = ?, fanout_mode = ?, connection = ?, max_priority = ?, silence_alert_minutes = ?, queue_type = ?, message_ttl_seconds = ?, lazy_mode = ?, tags = ?, revision = revision + 1 WHERE id = ?` + revisionCondition
+	res, err := s.db.Exec(query, ch.Name, ch.Direction, ch.Destination, ch.FanoutMode, ch.Connection, ch.MaxPriority, ch.SilenceAlert, ch.QueueType, ch.MessageTTL, ch.LazyMode, tags, ch.ID, ch.Revision, ch.Revision)
 	if err != nil {
 		return fmt.Errorf("failed to update channel: %w", err)
 	}
-	return nil
+	return checkRevision(res, &ch.Revision)
 }
 
 // GetChannelsByAppID
-func (s *Store) GetChannelsByAppID(appID string) ([]Channel, error) {
-	query := `SELECT id, application_id, name, direction, destination, fanout_mode, created_at FROM channels WHERE application_id = ?`
+func (s *SQLStore) GetChannelsByAppID(appID string) ([]Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE application_id = ?`
 	rows, err := s.db.Query(query, appID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get channels by app id: %w", err)
@@ -36,20 +75,27 @@ func (s *Store) GetChannelsByAppID(appID string) ([]Channel, error) {
 
 	var channels []Channel
 	for rows.Next() {
-		var ch Channel
-		if err := rows.Scan(&ch.ID, &ch.ApplicationID, &ch.Name, &ch.Direction, &ch.Destination, &ch.FanoutMode, &ch.CreatedAt); err != nil {
+		ch, err := scanChannel(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel row: %w", err)
 		}
-		channels = append(channels, ch)
+		channels = append(channels, *ch)
 	}
 
 	return channels, nil
 }
 
-// GetAllChannels
-func (s *Store) GetAllChannels() ([]Channel, error) {
-	query := `SELECT id, application_id, name, direction, destination, fanout_mode, created_at FROM channels`
-	rows, err := s.db.Query(query)
+// GetAllChannels retrieves the channels matching the filter by name, destination or tag, in the order
+// they were created.
+func (s *SQLStore) GetAllChannels(filter ListFilter) ([]Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels`
+	conditions, args := filterConditions(filter, "id", "tags", "name", "destination")
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	page, pageArgs := pageClause(filter)
+	query += ` ORDER BY created_at, id` + page
+	rows, err := s.db.Query(query, append(args, pageArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all channels: %w", err)
 	}
@@ -57,23 +103,22 @@ func (s *Store) GetAllChannels() ([]Channel, error) {
 
 	var channels []Channel
 	for rows.Next() {
-		var ch Channel
-		if err := rows.Scan(&ch.ID, &ch.ApplicationID, &ch.Name, &ch.Direction, &ch.Destination, &ch.FanoutMode, &ch.CreatedAt); err != nil {
+		ch, err := scanChannel(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel row: %w", err)
 		}
-		channels = append(channels, ch)
+		channels = append(channels, *ch)
 	}
 
 	return channels, nil
 }
 
 // GetChannelByID
-func (s *Store) GetChannelByID(id string) (*Channel, error) {
-	query := `SELECT id, application_id, name, direction, destination, fanout_mode, created_at FROM channels WHERE id = ?`
+func (s *SQLStore) GetChannelByID(id string) (*Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE id = ?`
 	row := s.db.QueryRow(query, id)
 
-	ch := &Channel{}
-	err := row.Scan(&ch.ID, &ch.ApplicationID, &ch.Name, &ch.Direction, &ch.Destination, &ch.FanoutMode, &ch.CreatedAt)
+	ch, err := scanChannel(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -84,8 +129,8 @@ func (s *Store) GetChannelByID(id string) (*Channel, error) {
 }
 
 // GetChannelsByName
-func (s *Store) GetChannelsByName(name string) ([]Channel, error) {
-	query := `SELECT id, application_id, name, direction, destination, fanout_mode, created_at FROM channels WHERE name = ?`
+func (s *SQLStore) GetChannelsByName(name string) ([]Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE name = ?`
 	rows, err := s.db.Query(query, name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get channels by name: %w", err)
@@ -94,17 +139,17 @@ func (s *Store) GetChannelsByName(name string) ([]Channel, error) {
 
 	var channels []Channel
 	for rows.Next() {
-		var ch Channel
-		if err := rows.Scan(&ch.ID, &ch.ApplicationID, &ch.Name, &ch.Direction, &ch.Destination, &ch.FanoutMode, &ch.CreatedAt); err != nil {
+		ch, err := scanChannel(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel row: %w", err)
 		}
-		channels = append(channels, ch)
+		channels = append(channels, *ch)
 	}
 	return channels, nil
 }
 
 // FindChannel
-func (s *Store) FindChannel(identifier string) (*Channel, error) {
+func (s *SQLStore) FindChannel(identifier string) (*Channel, error) {
 	// First, try to find by ID
 	channel, err := s.GetChannelByID(identifier)
 	if err != nil {
@@ -134,18 +179,108 @@ func (s *Store) FindChannel(identifier string) (*Channel, error) {
 	return &channels[0], nil // Found unique match by name
 }
 
-// DeleteChannel
-func (s *Store) DeleteChannel(id string) error {
+// DeleteChannel moves a channel to the trash together with the routes reading from it. Routes delivering
+// to it are disabled, and its wiretaps, samples and routing rules are removed from the other routes; the
+// trash item keeps them, so that restoring the channel puts them back. It returns the routes it changed,
+// so that their routers can be stopped or restarted.
+func (s *SQLStore) DeleteChannel(id string) ([]RouteDependent, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin channel deletion: %w", err)
+	}
+	defer tx.Rollback()
+	ch, err := scanChannel(tx.QueryRow(`SELECT `+channelColumns+` FROM channels WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read channel before deletion: %w", err)
+	}
+	dependents, released, err := releaseChannel(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := moveToTrash(tx, TrashChannel, ch.ID, ch.Name, ch, released); err != nil {
+		return nil, err
+	}
+
 	query := `DELETE FROM channels WHERE id = ?`
-	_, err := s.db.Exec(query, id)
+	if _, err := tx.Exec(query, id); err != nil {
+		return nil, fmt.Errorf("failed to delete channel: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit channel deletion: %w", err)
+	}
+	return routeDependents(dependents), nil
+}
+
+// releaseChannel removes the references to a channel from the routes using it within a transaction: the
+// routes reading from it are moved to the trash, those delivering to it are disabled and its routing rules
+// are deleted. It returns what it removed from each route, to be kept in the trash item of the channel.
+func releaseChannel(tx *dbTx, id string) ([]dependentRoute, []ReleasedRoute, error) {
+	dependents, err := channelDependents(tx, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete channel: %w", err)
+		return nil, nil, err
 	}
-	return nil
+	rules, err := channelRoutingRules(tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var released []ReleasedRoute
+	for _, d := range dependents {
+		r := ReleasedRoute{RouteID: d.RouteID, RoutingRules: rules[d.RouteID]}
+		if d.Action != DependentDeleted {
+			// A route moved to the trash keeps its references in its own trash item.
+			r.Usages = d.Usages
+			r.Disabled = d.Action == DependentDisabled && !d.WasDisabled
+			r.SampleRate = d.route.SampleRate
+		}
+		if len(r.Usages) > 0 || len(r.RoutingRules) > 0 {
+			released = append(released, r)
+		}
+	}
+
+	err = releaseDependents(tx, dependents, func(route *Route) {
+		if route.DestinationChannelID != nil && *route.DestinationChannelID == id {
+			route.DestinationChannelID = nil
+		}
+		if route.WiretapChannelID == id {
+			route.WiretapChannelID = ""
+		}
+		if route.SampleChannelID == id {
+			route.SampleChannelID, route.SampleRate = "", 0
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM routing_rules WHERE destination_channel_id = ?`, id); err != nil {
+		return nil, nil, fmt.Errorf("failed to delete routing rules of channel: %w", err)
+	}
+	return dependents, released, nil
+}
+
+// channelRoutingRules returns the routing rules delivering to a channel within a transaction, by route.
+func channelRoutingRules(tx *dbTx, id string) (map[string][]RoutingRule, error) {
+	rows, err := tx.Query(`SELECT id, route_id, position, field, operator, value, destination_channel_id, created_at FROM routing_rules WHERE destination_channel_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing rules of channel: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make(map[string][]RoutingRule)
+	for rows.Next() {
+		var rule RoutingRule
+		if err := rows.Scan(&rule.ID, &rule.RouteID, &rule.Position, &rule.Field, &rule.Operator, &rule.Value, &rule.DestinationChannelID, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan routing rule row: %w", err)
+		}
+		rules[rule.RouteID] = append(rules[rule.RouteID], rule)
+	}
+	return rules, rows.Err()
 }
 
 // DeleteOrphanedChannels
-func (s *Store) DeleteOrphanedChannels() (int64, error) {
+func (s *SQLStore) DeleteOrphanedChannels() (int64, error) {
 	query := `DELETE FROM channels WHERE application_id NOT IN (SELECT id FROM applications)`
 	res, err := s.db.Exec(query)
 	if err != nil {
@@ -161,9 +296,9 @@ func (s *Store) DeleteOrphanedChannels() (int64, error) {
 }
 
 // GetAllRoutableChannels
-func (s *Store) GetAllRoutableChannels(direction string) ([]ChannelInfo, error) {
+func (s *SQLStore) GetAllRoutableChannels(direction string) ([]ChannelInfo, error) {
 	query := `
-		SELECT c.id, c.name, c.destination, c.fanout_mode, a.name
+		SELECT c.id, c.name, c.destination, c.fanout_mode, c.connection, c.max_priority, a.name
 		FROM channels c
 		JOIN applications a ON c.application_id = a.id
 		WHERE c.direction = ?
@@ -178,7 +313,7 @@ func (s *Store) GetAllRoutableChannels(direction string) ([]ChannelInfo, error)
 	var channels []ChannelInfo
 	for rows.Next() {
 		var ch ChannelInfo
-		if err := rows.Scan(&ch.ID, &ch.Name, &ch.Destination, &ch.FanoutMode, &ch.ApplicationName); err != nil {
+		if err := rows.Scan(&ch.ID, &ch.Name, &ch.Destination, &ch.FanoutMode, &ch.Connection, &ch.MaxPriority, &ch.ApplicationName); err != nil {
 			return nil, fmt.Errorf("failed to scan routable channel row: %w", err)
 		}
 		channels = append(channels, ch)
@@ -5,10 +5,34 @@ import (
 	"fmt"
 )
 
+// collectorColumns lists the columns read by scanCollector, in order.
+const collectorColumns = `id, name, schedule, engine, script, integration_id, tags, created_at, updated_at`
+
+// scanCollector reads a single collector row selected with collectorColumns.
+func scanCollector(row rowScanner) (*Collector, error) {
+	c := &Collector{}
+	var tags string
+	if err := row.Scan(&c.ID, &c.Name, &c.Schedule, &c.Engine, &c.Script, &c.IntegrationID, &tags, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if c.Tags, err = decodeTags(tags, c.ID); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 // CreateCollector creates a new collector in the database.
-func (s *Store) CreateCollector(c *Collector) error {
-	query := `INSERT INTO collectors (id, name, schedule, engine, script, integration_id) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err := s.db.Exec(query, c.ID, c.Name, c.Schedule, c.Engine, c.Script, c.IntegrationID)
+func (s *SQLStore) CreateCollector(c *Collector) error {
+	if err := ValidateCollector(c); err != nil {
+		return err
+	}
+	tags, err := encodeTags(c.Tags)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO collectors (id, name, schedule, engine, script, integration_id, tags) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.db.Exec(query, c.ID, c.Name, c.Schedule, c.Engine, c.Script, c.IntegrationID, tags)
 	if err != nil {
 		return fmt.Errorf("failed to create collector: %w", err)
 	}
@@ -16,12 +40,9 @@ func (s *Store) CreateCollector(c *Collector) error {
 }
 
 // GetCollectorByID retrieves a collector by its ID.
-func (s *Store) GetCollectorByID(id string) (*Collector, error) {
-	query := `SELECT id, name, schedule, engine, script, integration_id, created_at, updated_at FROM collectors WHERE id = ?`
-	row := s.db.QueryRow(query, id)
-
-	c := &Collector{}
-	err := row.Scan(&c.ID, &c.Name, &c.Schedule, &c.Engine, &c.Script, &c.IntegrationID, &c.CreatedAt, &c.UpdatedAt)
+func (s *SQLStore) GetCollectorByID(id string) (*Collector, error) {
+	query := `SELECT ` + collectorColumns + ` FROM collectors WHERE id = ?`
+	c, err := scanCollector(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -32,8 +53,8 @@ func (s *Store) GetCollectorByID(id string) (*Collector, error) {
 }
 
 // GetCollectorsByIntegrationID retrieves all collectors for a given integration ID.
-func (s *Store) GetCollectorsByIntegrationID(integrationID string) ([]Collector, error) {
-	query := `SELECT id, name, schedule, engine, script, integration_id, created_at, updated_at FROM collectors WHERE integration_id = ? ORDER BY created_at DESC`
+func (s *SQLStore) GetCollectorsByIntegrationID(integrationID string) ([]Collector, error) {
+	query := `SELECT ` + collectorColumns + ` FROM collectors WHERE integration_id = ? ORDER BY created_at DESC`
 	rows, err := s.db.Query(query, integrationID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get collectors by integration id: %w", err)
@@ -42,23 +63,20 @@ func (s *Store) GetCollectorsByIntegrationID(integrationID string) ([]Collector,
 
 	var collectors []Collector
 	for rows.Next() {
-		var c Collector
-		if err := rows.Scan(&c.ID, &c.Name, &c.Schedule, &c.Engine, &c.Script, &c.IntegrationID, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		c, err := scanCollector(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan collector row: %w", err)
 		}
-		collectors = append(collectors, c)
+		collectors = append(collectors, *c)
 	}
 	return collectors, nil
 }
 
 
 // GetCollectorByName retrieves a collector by its name.
-func (s *Store) GetCollectorByName(name string) (*Collector, error) {
-	query := `SELECT id, name, schedule, engine, script, integration_id, created_at, updated_at FROM collectors WHERE name = ?`
-	row := s.db.QueryRow(query, name)
-
-	c := &Collector{}
-	err := row.Scan(&c.ID, &c.Name, &c.Schedule, &c.Engine, &c.Script, &c.IntegrationID, &c.CreatedAt, &c.UpdatedAt)
+func (s *SQLStore) GetCollectorByName(name string) (*Collector, error) {
+	query := `SELECT ` + collectorColumns + ` FROM collectors WHERE name = ?`
+	c, err := scanCollector(s.db.QueryRow(query, name))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -69,8 +87,8 @@ func (s *Store) GetCollectorByName(name string) (*Collector, error) {
 }
 
 // GetAllCollectors retrieves all collectors from the database.
-func (s *Store) GetAllCollectors() ([]Collector, error) {
-	query := `SELECT id, name, schedule, engine, script, integration_id, created_at, updated_at FROM collectors ORDER BY created_at DESC`
+func (s *SQLStore) GetAllCollectors() ([]Collector, error) {
+	query := `SELECT ` + collectorColumns + ` FROM collectors ORDER BY created_at DESC`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all collectors: %w", err)
@@ -79,19 +97,26 @@ func (s *Store) GetAllCollectors() ([]Collector, error) {
 
 	var collectors []Collector
 	for rows.Next() {
-		var c Collector
-		if err := rows.Scan(&c.ID, &c.Name, &c.Schedule, &c.Engine, &c.Script, &c.IntegrationID, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		c, err := scanCollector(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan collector row: %w", err)
 		}
-		collectors = append(collectors, c)
+		collectors = append(collectors, *c)
 	}
 	return collectors, nil
 }
 
 // UpdateCollector updates an existing collector in the database.
-func (s *Store) UpdateCollector(c *Collector) error {
-	query := `UPDATE collectors SET name = ?, schedule = ?, engine = ?, script = ?, integration_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := s.db.Exec(query, c.Name, c.Schedule, c.Engine, c.Script, c.IntegrationID, c.ID)
+func (s *SQLStore) UpdateCollector(c *Collector) error {
+	if err := ValidateCollector(c); err != nil {
+		return err
+	}
+	tags, err := encodeTags(c.Tags)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE collectors SET name = ?, schedule = ?, engine = ?, script = ?, integration_id = ?, tags = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err = s.db.Exec(query, c.Name, c.Schedule, c.Engine, c.Script, c.IntegrationID, tags, c.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update collector: %w", err)
 	}
@@ -99,11 +124,14 @@ func (s *Store) UpdateCollector(c *Collector) error {
 }
 
 // DeleteCollector deletes a collector by its ID.
-func (s *Store) DeleteCollector(id string) error {
+func (s *SQLStore) DeleteCollector(id string) error {
 	query := `DELETE FROM collectors WHERE id = ?`
 	_, err := s.db.Exec(query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete collector: %w", err)
 	}
-	return nil
+	if err := s.deleteCollectorRuns(id); err != nil {
+		return err
+	}
+	return s.deleteScriptStateNamespace(CollectorStateNamespace(id))
 }
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecordCollectorRun stores an execution of a collector and deletes the oldest runs of the collector
+// beyond the keep most recent ones.
+func (s *SQLStore) RecordCollectorRun(run *CollectorRun, keep int) error {
+	if run.FinishedAt.IsZero() {
+		run.FinishedAt = time.Now()
+	}
+	if run.StartedAt.IsZero() {
+		run.StartedAt = run.FinishedAt
+	}
+	run.Duration = run.FinishedAt.Sub(run.StartedAt)
+	query := `INSERT INTO collector_runs (collector_id, started_at, finished_at, duration_ms, messages, error) VALUES (?, ?, ?, ?, ?, ?)`
+	id, err := s.db.insertID(query, run.CollectorID, run.StartedAt, run.FinishedAt, run.Duration.Milliseconds(), run.Messages, run.Error)
+	if err != nil {
+		return fmt.Errorf("failed to record collector run: %w", err)
+	}
+	run.ID = id
+
+	_, err = s.db.Exec(`DELETE FROM collector_runs WHERE collector_id = ? AND id <= (
+		SELECT id FROM collector_runs WHERE collector_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`,
+		run.CollectorID, run.CollectorID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to prune collector runs: %w", err)
+	}
+	return nil
+}
+
+// GetCollectorRuns returns the most recent runs of a collector, newest first.
+func (s *SQLStore) GetCollectorRuns(collectorID string, limit int) ([]CollectorRun, error) {
+	query := `SELECT id, collector_id, started_at, finished_at, duration_ms, messages, error
+		FROM collector_runs WHERE collector_id = ? ORDER BY id DESC LIMIT ?`
+	return s.queryCollectorRuns(query, collectorID, limit)
+}
+
+// GetFailedCollectorRuns returns the most recent failed runs of every collector, newest first.
+func (s *SQLStore) GetFailedCollectorRuns(limit int) ([]CollectorRun, error) {
+	query := `SELECT id, collector_id, started_at, finished_at, duration_ms, messages, error
+		FROM collector_runs WHERE error <> '' ORDER BY id DESC LIMIT ?`
+	return s.queryCollectorRuns(query, limit)
+}
+
+// queryCollectorRuns reads the collector runs selected by a query.
+func (s *SQLStore) queryCollectorRuns(query string, args ...interface{}) ([]CollectorRun, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collector runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []CollectorRun
+	for rows.Next() {
+		var run CollectorRun
+		var durationMs int64
+		if err := rows.Scan(&run.ID, &run.CollectorID, &run.StartedAt, &run.FinishedAt, &durationMs, &run.Messages, &run.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan collector run row: %w", err)
+		}
+		run.Duration = time.Duration(durationMs) * time.Millisecond
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// deleteCollectorRuns deletes the run history of a collector.
+func (s *SQLStore) deleteCollectorRuns(collectorID string) error {
+	if _, err := s.db.Exec(`DELETE FROM collector_runs WHERE collector_id = ?`, collectorID); err != nil {
+		return fmt.Errorf("failed to delete collector runs: %w", err)
+	}
+	return nil
+}
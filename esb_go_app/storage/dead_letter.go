@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const deadLetterColumns = `id, route_id, route_name, message_id, trace_id, source, reason, attempts, headers, content_type, correlation_id, body, created_at`
+
+// DefaultDeadLetterSearchLimit is how many dead letters a search returns when it sets no limit.
+const DefaultDeadLetterSearchLimit = 100
+
+// StoreDeadLetter stores a message that failed for good on a route.
+func (s *SQLStore) StoreDeadLetter(msg *DeadLetter) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	query := `INSERT INTO dead_letters (route_id, route_name, message_id, trace_id, source, reason, attempts, headers, content_type, correlation_id, body, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.db.insertID(query, msg.RouteID, msg.RouteName, msg.MessageID, msg.TraceID, msg.Source, msg.Reason, msg.Attempts, msg.Headers, msg.ContentType, msg.CorrelationID, msg.Body, msg.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store dead letter: %w", err)
+	}
+	msg.ID = id
+	return nil
+}
+
+// SearchDeadLetters returns the dead letters matching the search, newest first.
+func (s *SQLStore) SearchDeadLetters(search DeadLetterSearch) ([]DeadLetter, error) {
+	var conditions []string
+	var args []interface{}
+	if search.RouteID != "" {
+		conditions = append(conditions, `route_id = ?`)
+		args = append(args, search.RouteID)
+	}
+	if term := strings.TrimSpace(search.Term); term != "" {
+		conditions = append(conditions, `(message_id = ? OR trace_id = ? OR reason LIKE '%' || ? || '%' OR body LIKE '%' || ? || '%')`)
+		args = append(args, term, term, term, term)
+	}
+	limit := search.Limit
+	if limit <= 0 {
+		limit = DefaultDeadLetterSearchLimit
+	}
+
+	query := `SELECT ` + deadLetterColumns + ` FROM dead_letters`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []DeadLetter
+	for rows.Next() {
+		msg, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	return messages, rows.Err()
+}
+
+// CountDeadLetters returns how many dead letters a route has.
+func (s *SQLStore) CountDeadLetters(routeID string) (int, error) {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM dead_letters WHERE route_id = ?`, routeID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+	return count, nil
+}
+
+// GetDeadLetter returns a dead letter by its ID, or nil if there is none.
+func (s *SQLStore) GetDeadLetter(id int64) (*DeadLetter, error) {
+	msg, err := scanDeadLetter(s.db.QueryRow(`SELECT `+deadLetterColumns+` FROM dead_letters WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// DeleteDeadLetter deletes a dead letter, once it is replayed or no longer wanted.
+func (s *SQLStore) DeleteDeadLetter(id int64) error {
+	if _, err := s.db.Exec(`DELETE FROM dead_letters WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+	return nil
+}
+
+// scanDeadLetter scans a row selected with deadLetterColumns.
+func scanDeadLetter(row rowScanner) (*DeadLetter, error) {
+	msg := &DeadLetter{}
+	if err := row.Scan(&msg.ID, &msg.RouteID, &msg.RouteName, &msg.MessageID, &msg.TraceID, &msg.Source, &msg.Reason, &msg.Attempts, &msg.Headers, &msg.ContentType, &msg.CorrelationID, &msg.Body, &msg.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan dead letter row: %w", err)
+	}
+	return msg, nil
+}
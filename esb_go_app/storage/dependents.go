@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Ways a route uses a channel or a transformation.
+const (
+	UsageSource         = "source"
+	UsageDestination    = "destination"
+	UsageRoutingRule    = "routing_rule"
+	UsageWiretap        = "wiretap"
+	UsageSample         = "sample"
+	UsageTransformation = "transformation"
+	UsagePipeline       = "pipeline"
+)
+
+// What the deletion of a channel or a transformation does to a route using it.
+const (
+	DependentDeleted  = "deleted"  // The route is moved to the trash with the object
+	DependentDisabled = "disabled" // The reference is cleared and the route is disabled, as it cannot deliver without it
+	DependentUpdated  = "updated"  // The reference is removed and the route keeps running
+)
+
+// RouteDependent is a route using a channel or a transformation that is deleted, and what the deletion
+// does to it.
+type RouteDependent struct {
+	RouteID         string
+	RouteName       string
+	SourceChannelID string
+	WasDisabled     bool     // No router ran for the route before the deletion
+	Usages          []string // How the route uses the object, Usage* constants
+	Action          string   // DependentDeleted, DependentDisabled or DependentUpdated
+}
+
+// queryer runs the queries of the dependents lookups on the database or within a transaction.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// dependentRoute is a route using a deleted object together with how it is used.
+type dependentRoute struct {
+	route *Route
+	RouteDependent
+}
+
+// dependentActionRank orders the actions of the usages of a route, the route getting the strongest one.
+var dependentActionRank = map[string]int{DependentUpdated: 1, DependentDisabled: 2, DependentDeleted: 3}
+
+// use records a usage of the object by the route, keeping the strongest action of its usages.
+func (d *dependentRoute) use(usage, action string) {
+	d.Usages = append(d.Usages, usage)
+	if dependentActionRank[action] > dependentActionRank[d.Action] {
+		d.Action = action
+	}
+}
+
+// findDependentRoutes reads the routes and returns those for which usages reports a usage, in the order of
+// the routes list.
+func findDependentRoutes(q queryer, usages func(route *Route, d *dependentRoute)) ([]dependentRoute, error) {
+	rows, err := q.Query(`SELECT ` + routeColumns + ` FROM routes ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes for dependents: %w", err)
+	}
+	defer rows.Close()
+
+	var dependents []dependentRoute
+	for rows.Next() {
+		route, err := scanRoute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan route row: %w", err)
+		}
+		d := dependentRoute{route: route, RouteDependent: RouteDependent{
+			RouteID: route.ID, RouteName: route.Name, SourceChannelID: route.SourceChannelID, WasDisabled: route.Disabled,
+		}}
+		usages(route, &d)
+		if d.Action != "" {
+			dependents = append(dependents, d)
+		}
+	}
+	return dependents, rows.Err()
+}
+
+// channelDependents returns the routes reading from, delivering to, wiretapping, sampling or routing
+// messages to a channel.
+func channelDependents(q queryer, channelID string) ([]dependentRoute, error) {
+	rows, err := q.Query(`SELECT DISTINCT route_id FROM routing_rules WHERE destination_channel_id = ?`, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing rules for dependents: %w", err)
+	}
+	ruleRoutes := make(map[string]bool)
+	for rows.Next() {
+		var routeID string
+		if err := rows.Scan(&routeID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan routing rule row: %w", err)
+		}
+		ruleRoutes[routeID] = true
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return findDependentRoutes(q, func(route *Route, d *dependentRoute) {
+		if route.SourceChannelID == channelID {
+			d.use(UsageSource, DependentDeleted)
+		}
+		if route.DestinationChannelID != nil && *route.DestinationChannelID == channelID {
+			d.use(UsageDestination, DependentDisabled)
+		}
+		if ruleRoutes[route.ID] {
+			d.use(UsageRoutingRule, DependentUpdated)
+		}
+		if route.WiretapChannelID == channelID {
+			d.use(UsageWiretap, DependentUpdated)
+		}
+		if route.SampleChannelID == channelID {
+			d.use(UsageSample, DependentUpdated)
+		}
+	})
+}
+
+// transformationDependents returns the routes running a transformation, first or in their pipeline.
+func transformationDependents(q queryer, transformationID string) ([]dependentRoute, error) {
+	return findDependentRoutes(q, func(route *Route, d *dependentRoute) {
+		if route.TransformationID != nil && *route.TransformationID == transformationID {
+			d.use(UsageTransformation, DependentDisabled)
+		}
+		for _, id := range route.Pipeline {
+			if id == transformationID {
+				d.use(UsagePipeline, DependentUpdated)
+				break
+			}
+		}
+	})
+}
+
+// ChannelDependents returns the routes using a channel and what deleting the channel would do to them.
+func (s *SQLStore) ChannelDependents(channelID string) ([]RouteDependent, error) {
+	dependents, err := channelDependents(s.db, channelID)
+	return routeDependents(dependents), err
+}
+
+// TransformationDependents returns the routes using a transformation and what deleting the transformation
+// would do to them.
+func (s *SQLStore) TransformationDependents(transformationID string) ([]RouteDependent, error) {
+	dependents, err := transformationDependents(s.db, transformationID)
+	return routeDependents(dependents), err
+}
+
+// routeDependents drops the routes of the dependents, which are only needed within a deletion.
+func routeDependents(dependents []dependentRoute) []RouteDependent {
+	var result []RouteDependent
+	for _, d := range dependents {
+		result = append(result, d.RouteDependent)
+	}
+	return result
+}
+
+// releaseDependents applies the deletion of an object to the routes using it within the deletion's
+// transaction, with clear removing the references to the object from a route that is kept.
+func releaseDependents(tx *dbTx, dependents []dependentRoute, clear func(route *Route)) error {
+	for _, d := range dependents {
+		if d.Action == DependentDeleted {
+			if err := trashRoute(tx, d.route); err != nil {
+				return err
+			}
+			continue
+		}
+		clear(d.route)
+		if d.Action == DependentDisabled {
+			d.route.Disabled = true
+		}
+		if err := updateRoute(tx, d.route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
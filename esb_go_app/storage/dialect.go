@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// Storage drivers selectable with the db_driver setting.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// dialect holds what differs between the database backends. The queries of the store are written once,
+// in the SQL SQLite accepts, and the dialect adapts them to its backend.
+type dialect interface {
+	// rewrite adapts a query, schema statements included, to the backend.
+	rewrite(query string) string
+	// tableInfoQuery returns a query listing the columns of a table with the columns of SQLite's
+	// PRAGMA table_info: cid, name, type, notnull, dflt_value and pk.
+	tableInfoQuery(table string) string
+	// returningID reports whether generated IDs are read with RETURNING instead of LastInsertId.
+	returningID() bool
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) rewrite(query string) string { return query }
+
+func (sqliteDialect) tableInfoQuery(table string) string {
+	return `PRAGMA table_info(` + table + `);`
+}
+
+func (sqliteDialect) returningID() bool { return false }
+
+// postgresDialect runs the store on PostgreSQL, so several instances of the service can share one
+// configuration database.
+type postgresDialect struct{}
+
+var (
+	postgresAutoincrement = regexp.MustCompile(`INTEGER PRIMARY KEY AUTOINCREMENT`)
+	postgresInteger       = regexp.MustCompile(`\bINTEGER\b`)
+	postgresDatetime      = regexp.MustCompile(`\bDATETIME\b`)
+	postgresBoolDefault   = regexp.MustCompile(`(BOOLEAN(?: NOT NULL)? DEFAULT )([01])\b`)
+	// SQLite opens the database without enforcing foreign keys, and route sources such as
+	// collector-output:<id> are not channel IDs, so the PostgreSQL schema declares none either.
+	postgresForeignKey = regexp.MustCompile(`,\s*FOREIGN KEY \([a-z_]+\) REFERENCES [a-z_]+\([a-z_]+\)(?: ON DELETE (?:CASCADE|SET NULL))?`)
+)
+
+func (postgresDialect) rewrite(query string) string {
+	trimmed := strings.TrimSpace(query)
+	if strings.HasPrefix(trimmed, "CREATE TABLE") || strings.HasPrefix(trimmed, "ALTER TABLE") {
+		query = postgresAutoincrement.ReplaceAllString(query, "BIGSERIAL PRIMARY KEY")
+		query = postgresInteger.ReplaceAllString(query, "BIGINT")
+		query = postgresDatetime.ReplaceAllString(query, "TIMESTAMPTZ")
+		query = postgresBoolDefault.ReplaceAllStringFunc(query, func(m string) string {
+			if strings.HasSuffix(m, "1") {
+				return strings.TrimSuffix(m, "1") + "TRUE"
+			}
+			return strings.TrimSuffix(m, "0") + "FALSE"
+		})
+		query = postgresForeignKey.ReplaceAllString(query, "")
+	}
+	return rebindPositional(query)
+}
+
+func (postgresDialect) tableInfoQuery(table string) string {
+	return `SELECT ordinal_position, column_name, data_type, CASE WHEN is_nullable = 'NO' THEN 1 ELSE 0 END, column_default, 0
+		FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = '` + table + `' ORDER BY ordinal_position`
+}
+
+func (postgresDialect) returningID() bool { return true }
+
+// rebindPositional turns the ? placeholders of a query into PostgreSQL's $1, $2, ..., leaving question
+// marks inside string literals alone.
+func rebindPositional(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// database is the connection pool of the store. Its query methods shadow the ones of *sql.DB to pass
+// every query through the dialect.
+type database struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (db *database) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rewrite(query), args...)
+}
+
+func (db *database) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rewrite(query), args...)
+}
+
+func (db *database) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rewrite(query), args...)
+}
+
+func (db *database) Begin() (*dbTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// insertID runs an INSERT into a table with a generated id column and returns the new id.
+func (db *database) insertID(query string, args ...interface{}) (int64, error) {
+	if db.dialect.returningID() {
+		var id int64
+		err := db.QueryRow(query+` RETURNING id`, args...).Scan(&id)
+		return id, err
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := result.LastInsertId()
+	return id, nil
+}
+
+// execer runs statements on the database or within a transaction, for the writes that are made both on
+// their own and as part of a larger change.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// dbTx is a transaction of the store, passing its queries through the dialect like database.
+type dbTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *dbTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rewrite(query), args...)
+}
+
+func (tx *dbTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rewrite(query), args...)
+}
+
+func (tx *dbTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rewrite(query), args...)
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// FileServerProtocols are the protocols a file server can use, with their default ports.
+var FileServerProtocols = map[string]int{"sftp": 22, "ftp": 21}
+
+// fileServerColumns is the column list used by every query that loads full FileServer rows.
+const fileServerColumns = `id, name, description, protocol, host, port, username, password, private_key, host_key, skip_host_key_verify, created_at, updated_at`
+
+// scanFileServer scans a row selected with fileServerColumns into a FileServer.
+func scanFileServer(row rowScanner) (*FileServer, error) {
+	f := &FileServer{}
+	if err := row.Scan(&f.ID, &f.Name, &f.Description, &f.Protocol, &f.Host, &f.Port, &f.Username, &f.Password, &f.PrivateKey, &f.HostKey, &f.SkipHostKeyVerify, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// CreateFileServer creates a new file server in the database.
+func (s *SQLStore) CreateFileServer(f *FileServer) error {
+	query := `INSERT INTO file_servers (id, name, description, protocol, host, port, username, password, private_key, host_key, skip_host_key_verify) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, f.ID, f.Name, f.Description, f.Protocol, f.Host, f.Port, f.Username, f.Password, f.PrivateKey, f.HostKey, f.SkipHostKeyVerify)
+	if err != nil {
+		return fmt.Errorf("failed to create file server: %w", err)
+	}
+	return nil
+}
+
+// GetFileServerByID retrieves a file server by its ID.
+func (s *SQLStore) GetFileServerByID(id string) (*FileServer, error) {
+	query := `SELECT ` + fileServerColumns + ` FROM file_servers WHERE id = ?`
+	f, err := scanFileServer(s.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file server by ID: %w", err)
+	}
+	return f, nil
+}
+
+// GetFileServerByName retrieves the file server that scripts refer to by name.
+func (s *SQLStore) GetFileServerByName(name string) (*FileServer, error) {
+	query := `SELECT ` + fileServerColumns + ` FROM file_servers WHERE name = ?`
+	f, err := scanFileServer(s.db.QueryRow(query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file server by name: %w", err)
+	}
+	return f, nil
+}
+
+// GetAllFileServers retrieves all file servers ordered by name.
+func (s *SQLStore) GetAllFileServers() ([]FileServer, error) {
+	query := `SELECT ` + fileServerColumns + ` FROM file_servers ORDER BY name`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all file servers: %w", err)
+	}
+	defer rows.Close()
+
+	var servers []FileServer
+	for rows.Next() {
+		f, err := scanFileServer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file server row: %w", err)
+		}
+		servers = append(servers, *f)
+	}
+	return servers, nil
+}
+
+// UpdateFileServer updates an existing file server in the database.
+func (s *SQLStore) UpdateFileServer(f *FileServer) error {
+	query := `UPDATE file_servers SET name = ?, description = ?, protocol = ?, host = ?, port = ?, username = ?, password = ?, private_key = ?, host_key = ?, skip_host_key_verify = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := s.db.Exec(query, f.Name, f.Description, f.Protocol, f.Host, f.Port, f.Username, f.Password, f.PrivateKey, f.HostKey, f.SkipHostKeyVerify, f.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update file server: %w", err)
+	}
+	return nil
+}
+
+// DeleteFileServer deletes a file server by its ID.
+func (s *SQLStore) DeleteFileServer(id string) error {
+	query := `DELETE FROM file_servers WHERE id = ?`
+	_, err := s.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete file server: %w", err)
+	}
+	return nil
+}
+
+// migrateFileServersTable adds the skip_host_key_verify column to file servers created before it. They
+// keep connecting without a host key only once it is enabled for them.
+func (s *SQLStore) migrateFileServersTable() error {
+	rows, err := s.db.Query(s.db.dialect.tableInfoQuery("file_servers"))
+	if err != nil {
+		return fmt.Errorf("failed to read table_info for file_servers: %w", err)
+	}
+	hasSkipHostKeyVerify := false
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, rtype string
+		var dfltValue interface{}
+		if err := rows.Scan(&cid, &name, &rtype, &notnull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan table_info for file_servers: %w", err)
+		}
+		if name == "skip_host_key_verify" {
+			hasSkipHostKeyVerify = true
+		}
+	}
+	rows.Close()
+	if hasSkipHostKeyVerify {
+		return nil
+	}
+
+	s.logger.Info("migrating 'file_servers' table: adding skip_host_key_verify column...")
+	if _, err := s.db.Exec(`ALTER TABLE file_servers ADD COLUMN skip_host_key_verify BOOLEAN NOT NULL DEFAULT 0`); err != nil {
+		return fmt.Errorf("failed to add skip_host_key_verify to file_servers table: %w", err)
+	}
+	s.logger.Info("'file_servers' table migrated successfully (skip_host_key_verify).")
+	return nil
+}
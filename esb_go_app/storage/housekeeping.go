@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy is how long the housekeeping job keeps each kind of history. A zero duration keeps it
+// forever.
+type RetentionPolicy struct {
+	AuditLog      time.Duration
+	CollectorRuns time.Duration
+	Archive       time.Duration
+	TraceHops     time.Duration
+	Trash         time.Duration
+}
+
+// HousekeepingResult counts the rows a housekeeping run deleted.
+type HousekeepingResult struct {
+	AuditEntries     int64
+	CollectorRuns    int64
+	ArchivedMessages int64
+	TraceHops        int64
+	TrashItems       int64
+}
+
+// Total is the number of rows the run deleted.
+func (r HousekeepingResult) Total() int64 {
+	return r.AuditEntries + r.CollectorRuns + r.ArchivedMessages + r.TraceHops + r.TrashItems
+}
+
+// Housekeep deletes the audit entries, collector runs, archived messages and trace hops older than the
+// retention of the policy, so the history tables do not grow without bound, and purges the objects that
+// stayed in the trash longer than its retention. SQLite reuses the freed pages
+// for new rows instead of growing the file. Every kind is pruned even if another one fails; the first
+// error is returned with the counts of what was deleted.
+func (s *SQLStore) Housekeep(policy RetentionPolicy, now time.Time) (HousekeepingResult, error) {
+	var result HousekeepingResult
+	var firstErr error
+	prune := func(retention time.Duration, count *int64, fn func(before time.Time) (int64, error)) {
+		if retention <= 0 {
+			return
+		}
+		n, err := fn(now.Add(-retention))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		*count = n
+	}
+	prune(policy.AuditLog, &result.AuditEntries, s.PruneAuditLog)
+	prune(policy.CollectorRuns, &result.CollectorRuns, s.PruneCollectorRuns)
+	prune(policy.Archive, &result.ArchivedMessages, s.PruneArchive)
+	prune(policy.TraceHops, &result.TraceHops, s.PruneTraceHops)
+	prune(policy.Trash, &result.TrashItems, s.PruneTrash)
+	return result, firstErr
+}
+
+// PruneAuditLog deletes the audit entries recorded before the given time and returns how many were deleted.
+func (s *SQLStore) PruneAuditLog(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM audit_log WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune audit log: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// PruneCollectorRuns deletes the collector runs that finished before the given time and returns how many
+// were deleted.
+func (s *SQLStore) PruneCollectorRuns(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM collector_runs WHERE finished_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune collector runs: %w", err)
+	}
+	return result.RowsAffected()
+}
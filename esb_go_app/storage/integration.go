@@ -6,7 +6,7 @@ import (
 )
 
 // CreateIntegration creates a new integration in the database.
-func (s *Store) CreateIntegration(i *Integration) error {
+func (s *SQLStore) CreateIntegration(i *Integration) error {
 	query := `INSERT INTO integrations (id, name, description) VALUES (?, ?, ?)`
 	_, err := s.db.Exec(query, i.ID, i.Name, i.Description)
 	if err != nil {
@@ -16,7 +16,7 @@ func (s *Store) CreateIntegration(i *Integration) error {
 }
 
 // GetIntegrationByID retrieves an integration by its ID.
-func (s *Store) GetIntegrationByID(id string) (*Integration, error) {
+func (s *SQLStore) GetIntegrationByID(id string) (*Integration, error) {
 	query := `SELECT id, name, description, created_at, updated_at FROM integrations WHERE id = ?`
 	row := s.db.QueryRow(query, id)
 
@@ -32,7 +32,7 @@ func (s *Store) GetIntegrationByID(id string) (*Integration, error) {
 }
 
 // GetAllIntegrations retrieves all integrations from the database.
-func (s *Store) GetAllIntegrations() ([]Integration, error) {
+func (s *SQLStore) GetAllIntegrations() ([]Integration, error) {
 	query := `SELECT id, name, description, created_at, updated_at FROM integrations ORDER BY name ASC`
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -52,7 +52,7 @@ func (s *Store) GetAllIntegrations() ([]Integration, error) {
 }
 
 // UpdateIntegration updates an existing integration in the database.
-func (s *Store) UpdateIntegration(i *Integration) error {
+func (s *SQLStore) UpdateIntegration(i *Integration) error {
 	query := `UPDATE integrations SET name = ?, description = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
 	_, err := s.db.Exec(query, i.Name, i.Description, i.ID)
 	if err != nil {
@@ -63,7 +63,7 @@ func (s *Store) UpdateIntegration(i *Integration) error {
 
 // DeleteIntegration deletes an integration by its ID.
 // Note: This does not delete associated routes or collectors, it just nullifies the foreign key.
-func (s *Store) DeleteIntegration(id string) error {
+func (s *SQLStore) DeleteIntegration(id string) error {
 	query := `DELETE FROM integrations WHERE id = ?`
 	_, err := s.db.Exec(query, id)
 	if err != nil {
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// CollectorSourcePrefix starts the source of a route fed by a collector, followed by the collector ID.
+const CollectorSourcePrefix = "collector-output:"
+
+// Kinds of references to objects that no longer exist.
+const (
+	IntegrityMissingChannel        = "missing_channel"        // Routes or routing rules refer to a deleted channel
+	IntegrityMissingCollector      = "missing_collector"      // Routes are fed by a deleted collector
+	IntegrityMissingTransformation = "missing_transformation" // Routes run a deleted transformation
+	IntegrityMissingIntegration    = "missing_integration"    // A collector belongs to a deleted integration
+)
+
+// IntegrityIssue is a reference to an object that no longer exists, left behind by a deletion that did not
+// go through the store or by an imported database.
+type IntegrityIssue struct {
+	Kind          string // IntegrityMissing* constants
+	MissingID     string // ID of the object that no longer exists
+	Routes        []RouteDependent
+	CollectorID   string // Collector referring to the missing integration
+	CollectorName string
+}
+
+// FindIntegrityIssues returns the references of the routes and collectors to channels, collectors,
+// transformations and integrations that no longer exist. The routes of an issue come with what fixing it
+// does to them, as for a deletion.
+func (s *SQLStore) FindIntegrityIssues() ([]IntegrityIssue, error) {
+	channels, err := s.existingIDs("channels")
+	if err != nil {
+		return nil, err
+	}
+	collectors, err := s.existingIDs("collectors")
+	if err != nil {
+		return nil, err
+	}
+	transformations, err := s.existingIDs("transformations")
+	if err != nil {
+		return nil, err
+	}
+	integrations, err := s.existingIDs("integrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var missingChannels, missingTransformations []string
+	seen := make(map[string]bool)
+	missing := func(list *[]string, existing map[string]bool, id string) {
+		if id == "" || existing[id] || seen[id] {
+			return
+		}
+		seen[id] = true
+		*list = append(*list, id)
+	}
+	rows, err := s.db.Query(`SELECT ` + routeColumns + ` FROM routes ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes for integrity check: %w", err)
+	}
+	for rows.Next() {
+		route, err := scanRoute(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan route row: %w", err)
+		}
+		if collectorID, ok := strings.CutPrefix(route.SourceChannelID, CollectorSourcePrefix); ok {
+			if !collectors[collectorID] {
+				missing(&missingChannels, nil, route.SourceChannelID)
+			}
+		} else {
+			missing(&missingChannels, channels, route.SourceChannelID)
+		}
+		if route.DestinationChannelID != nil {
+			missing(&missingChannels, channels, *route.DestinationChannelID)
+		}
+		missing(&missingChannels, channels, route.WiretapChannelID)
+		missing(&missingChannels, channels, route.SampleChannelID)
+		if route.TransformationID != nil {
+			missing(&missingTransformations, transformations, *route.TransformationID)
+		}
+		for _, id := range route.Pipeline {
+			missing(&missingTransformations, transformations, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	ruleDestinations, err := s.existingIDs("routing_rules", "destination_channel_id")
+	if err != nil {
+		return nil, err
+	}
+	for id := range ruleDestinations {
+		missing(&missingChannels, channels, id)
+	}
+
+	var issues []IntegrityIssue
+	for _, id := range missingChannels {
+		dependents, err := channelDependents(s.db, id)
+		if err != nil {
+			return nil, err
+		}
+		kind := IntegrityMissingChannel
+		if strings.HasPrefix(id, CollectorSourcePrefix) {
+			kind = IntegrityMissingCollector
+		}
+		issues = append(issues, IntegrityIssue{Kind: kind, MissingID: id, Routes: routeDependents(dependents)})
+	}
+	for _, id := range missingTransformations {
+		dependents, err := transformationDependents(s.db, id)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, IntegrityIssue{Kind: IntegrityMissingTransformation, MissingID: id, Routes: routeDependents(dependents)})
+	}
+
+	allCollectors, err := s.GetAllCollectors()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range allCollectors {
+		if c.IntegrationID != nil && *c.IntegrationID != "" && !integrations[*c.IntegrationID] {
+			issues = append(issues, IntegrityIssue{
+				Kind: IntegrityMissingIntegration, MissingID: *c.IntegrationID, CollectorID: c.ID, CollectorName: c.Name,
+			})
+		}
+	}
+	return issues, nil
+}
+
+// existingIDs returns the distinct values of a column of a table, the id column by default.
+func (s *SQLStore) existingIDs(table string, column ...string) (map[string]bool, error) {
+	col := "id"
+	if len(column) > 0 {
+		col = column[0]
+	}
+	rows, err := s.db.Query(`SELECT DISTINCT ` + col + ` FROM ` + table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s for integrity check: %w", table, err)
+	}
+	defer rows.Close()
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id sql.NullString
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan %s row: %w", table, err)
+		}
+		if id.Valid {
+			ids[id.String] = true
+		}
+	}
+	return ids, rows.Err()
+}
+
+// FixMissingChannel removes the references to a channel or collector source that no longer exists, as
+// deleting it would have: the routes reading from it are moved to the trash, those delivering to it are
+// disabled and its wiretaps, samples and routing rules are removed. It returns the routes it changed, so
+// that their routers can be stopped or restarted.
+func (s *SQLStore) FixMissingChannel(id string) ([]RouteDependent, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin integrity fix: %w", err)
+	}
+	defer tx.Rollback()
+	table, key := "channels", id
+	if collectorID, ok := strings.CutPrefix(id, CollectorSourcePrefix); ok {
+		table, key = "collectors", collectorID
+	}
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE id = ?`, key).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", table, err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%s still exists", id)
+	}
+	// The channel has no trash item to keep the removed references in.
+	dependents, _, err := releaseChannel(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit integrity fix: %w", err)
+	}
+	return routeDependents(dependents), nil
+}
+
+// FixMissingTransformation removes the references to a transformation that no longer exists, as deleting
+// it would have: the routes running it first are disabled and it is dropped from the pipelines. It returns
+// the routes it changed, so that their routers can be restarted.
+func (s *SQLStore) FixMissingTransformation(id string) ([]RouteDependent, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin integrity fix: %w", err)
+	}
+	defer tx.Rollback()
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM transformations WHERE id = ?`, id).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check transformation: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("transformation %s still exists", id)
+	}
+	dependents, _, err := releaseTransformation(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit integrity fix: %w", err)
+	}
+	return routeDependents(dependents), nil
+}
+
+// ClearMissingIntegration detaches a collector from an integration that no longer exists.
+func (s *SQLStore) ClearMissingIntegration(collectorID string) error {
+	query := `UPDATE collectors SET integration_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND integration_id IS NOT NULL AND integration_id NOT IN (SELECT id FROM integrations)`
+	res, err := s.db.Exec(query, collectorID)
+	if err != nil {
+		return fmt.Errorf("failed to clear integration of collector: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("collector %s has no missing integration", collectorID)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"math"
+	"strings"
+)
+
+// filterConditions returns the conditions matching the term of a filter against the ID and name columns
+// of a list query, and its tag against the tags column when the objects have tags.
+func filterConditions(filter ListFilter, idColumn, tagsColumn string, nameColumns ...string) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if term := strings.TrimSpace(filter.Term); term != "" {
+		termConditions := []string{idColumn + ` = ?`}
+		args = append(args, term)
+		for _, column := range nameColumns {
+			termConditions = append(termConditions, `LOWER(`+column+`) LIKE '%' || LOWER(?) || '%'`)
+			args = append(args, term)
+		}
+		conditions = append(conditions, `(`+strings.Join(termConditions, ` OR `)+`)`)
+	}
+	if tagsColumn != "" {
+		if condition, tagArgs := tagCondition(filter, tagsColumn); condition != "" {
+			conditions = append(conditions, condition)
+			args = append(args, tagArgs...)
+		}
+	}
+	return conditions, args
+}
+
+// pageClause returns the LIMIT and OFFSET of a filter to append after the ORDER BY of a list query.
+func pageClause(filter ListFilter) (string, []interface{}) {
+	if filter.Limit <= 0 {
+		if filter.Offset <= 0 {
+			return "", nil
+		}
+		// SQLite only takes an OFFSET after a LIMIT, and PostgreSQL no negative LIMIT
+		return ` LIMIT ? OFFSET ?`, []interface{}{int64(math.MaxInt64), filter.Offset}
+	}
+	return ` LIMIT ? OFFSET ?`, []interface{}{filter.Limit, max(filter.Offset, 0)}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import "strconv"
+
+// Setting keys of the SMTP server scripts send mail through.
+const (
+	settingSMTPHost     = "smtp_host"
+	settingSMTPPort     = "smtp_port"
+	settingSMTPSecurity = "smtp_security"
+	settingSMTPUsername = "smtp_username"
+	settingSMTPPassword = "smtp_password"
+	settingSMTPFrom     = "smtp_from"
+)
+
+// SMTPSecurityModes lists the accepted connection security modes with their default ports: starttls
+// upgrades a plain connection, tls connects over TLS from the start and none sends in clear text.
+var SMTPSecurityModes = map[string]int{"starttls": 587, "tls": 465, "none": 25}
+
+// MailSettings is the SMTP server of the mail module, configured in the admin settings.
+type MailSettings struct {
+	Host     string
+	Port     int
+	Security string // One of SMTPSecurityModes; empty means starttls
+	Username string
+	Password string
+	From     string // Sender address used when a script does not pass one
+}
+
+// GetMailSettings reads the SMTP settings. An empty host means mail is not configured.
+func (s *SQLStore) GetMailSettings() (*MailSettings, error) {
+	values := make(map[string]string)
+	for _, key := range []string{settingSMTPHost, settingSMTPPort, settingSMTPSecurity, settingSMTPUsername, settingSMTPPassword, settingSMTPFrom} {
+		value, err := s.GetSetting(key)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	settings := &MailSettings{
+		Host:     values[settingSMTPHost],
+		Security: values[settingSMTPSecurity],
+		Username: values[settingSMTPUsername],
+		Password: values[settingSMTPPassword],
+		From:     values[settingSMTPFrom],
+	}
+	if settings.Security == "" {
+		settings.Security = "starttls"
+	}
+	settings.Port, _ = strconv.Atoi(values[settingSMTPPort])
+	if settings.Port == 0 {
+		settings.Port = SMTPSecurityModes[settings.Security]
+	}
+	return settings, nil
+}
+
+// SaveMailSettings stores the SMTP settings.
+func (s *SQLStore) SaveMailSettings(settings *MailSettings) error {
+	values := map[string]string{
+		settingSMTPHost:     settings.Host,
+		settingSMTPPort:     strconv.Itoa(settings.Port),
+		settingSMTPSecurity: settings.Security,
+		settingSMTPUsername: settings.Username,
+		settingSMTPPassword: settings.Password,
+		settingSMTPFrom:     settings.From,
+	}
+	for key, value := range values {
+		if err := s.SetSetting(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,8 +8,12 @@ type Application struct {
 	Name         string
 	ClientSecret string
 	IDToken      string
+	VHost        string // RabbitMQ virtual host of the application's channels; empty uses the vhost of the connection
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+
+	PreviousIDToken          string    // ID token replaced by the last rotation, still accepted; empty once its grace period is over
+	PreviousIDTokenExpiresAt time.Time // End of the grace period of PreviousIDToken
 }
 
 // Channel
@@ -19,7 +23,16 @@ type Channel struct {
 	Name          string
 	Direction     string // "inbound" или "outbound"
 	Destination   string
-	FanoutMode    bool // If true, allows multiple consumers (pub/sub). If false, one queue (competing consumers).
+	FanoutMode    bool     // If true, allows multiple consumers (pub/sub). If false, one queue (competing consumers).
+	Connection    string   // Name of the RabbitMQ connection the channel lives on; empty means the default connection.
+	MaxPriority   int      // x-max-priority of the durable queue, 0 disables priorities.
+	SilenceAlert  int      // Minutes without messages after which the channel is reported as silent, 0 disables the alert.
+	QueueType     string   // "classic" (or empty) or "quorum"; fixed for the lifetime of the durable queue.
+	MessageTTL    int      // x-message-ttl of the durable queue in seconds, 0 keeps messages until they are consumed.
+	LazyMode      bool     // Declare the durable queue with x-queue-mode=lazy to keep large backlogs on disk; classic queues only.
+	Tags          []string // Free-form labels for grouping and filtering the channels.
+	VHost         string   // Virtual host of the channel's application, read from the applications table.
+	Revision      int      // Incremented by every update, see ErrConflict.
 	CreatedAt     time.Time
 }
 
@@ -29,12 +42,69 @@ type Route struct {
 	Name                 string
 	SourceChannelID      string
 	DestinationChannelID *string // Nullable for transform routes
-	RouteType            string  // "direct" or "transform"
+	RouteType            string  // "direct", "transform" or "enrich"
 	TransformationID     *string // Nullable, only for "transform" routes
 	IntegrationID        *string // Nullable
+	GuardConditions      []GuardCondition
+	GuardMismatchAction  string // "skip" or "forward", applied when a guard condition does not match
+	DelaySeconds         int    // Deliver to the destination after this many seconds, 0 for immediate delivery
+	Priority             int    // Priority set on republished messages, 0 keeps the original priority
+	CanonicalizeJSON     bool   // Re-encode JSON bodies with sorted keys, no whitespace and normalized numbers before delivery
+	RetryMaxAttempts     int    // Retries of a failed message before it is parked, 0 disables the retry policy
+	RetryBackoffSeconds  int    // Delay before the first retry, doubled on every further attempt
+	BatchSize            int    // Messages consumed and acknowledged together, 0 or 1 processes messages one by one
+	Concurrency          int    // Consumers competing on the source queue, 0 or 1 runs a single consumer
+	RateLimit            int    // Maximum messages per second delivered by the route, 0 means unlimited
+	SampleRate           int    // Copy 1 of every N routed messages to SampleChannelID, 0 = off
+	SampleChannelID      string
+	EnrichURL            string   // Endpoint the enrich route type POSTs the message body to
+	EnrichMerge          string   // "shallow", "deep" or "field", how the enrichment response is merged into the body
+	EnrichField          string   // Body field receiving the response with the "field" merge strategy
+	Pipeline             []string // IDs of transformations run after TransformationID, in order
+	ActiveWindow         string   // Comma-separated HH:MM-HH:MM spans in server time when the route consumes, empty = always
+	RequestReply         bool     // Relay replies to the requester's reply_to queue through an ESB reply queue
+	ReplyTimeoutSeconds  int      // How long a request waits for its reply; also the expiration of the request
+	WiretapChannelID     string   // Audit channel receiving a copy of every routed message, empty = off
+	WiretapStage         string   // "pre" taps the message as received, "post" as published to the destination
+	ResequenceKey        string   // Header name, or "$." body path, holding the sequence number; empty = no resequencing
+	ResequenceSeconds    int      // How long the resequencer waits for a missing sequence number
+	Disabled             bool     // Disabled routes keep their configuration, but no router is started for them
+	Archive              bool     // Store every delivery of the route in the message archive
+	DeadLetterStore      string   // DeadLetterBroker, DeadLetterDatabase or DeadLetterBoth, where messages that failed for good are kept
+	Tags                 []string // Free-form labels for grouping and filtering, next to the integration
+	Revision             int      // Incremented by every update, see ErrConflict
 	CreatedAt            time.Time
 }
 
+// GuardCondition is a declarative header check evaluated by the router before any script runs.
+type GuardCondition struct {
+	Header   string `json:"header"`
+	Operator string `json:"operator"` // "equals", "contains" or "regex"
+	Value    string `json:"value"`
+}
+
+// String renders the condition in the "header operator value" form used by the admin forms.
+func (c GuardCondition) String() string {
+	return c.Header + " " + c.Operator + " " + c.Value
+}
+
+// RoutingRule sends the messages of a route whose JSON body matches a condition to another channel.
+// The rules of a route are evaluated in position order; the first match wins and messages matching
+// no rule go to the route's own destination.
+type RoutingRule struct {
+	ID                   string
+	RouteID              string
+	Position             int
+	Field                string // Dotted path into the JSON body, e.g. "order.customer.country"
+	Operator             string // "equals", "not_equals", "contains", "regex" or "exists"
+	Value                string
+	DestinationChannelID string
+	CreatedAt            time.Time
+
+	DestinationChannelName string // Filled by GetRoutingRules for display
+	DestinationAppName     string
+}
+
 // Integration represents a logical grouping of ESB components.
 type Integration struct {
 	ID          string
@@ -72,16 +142,102 @@ type RouteInfo struct {
 	DestinationDestination string
 	TransformationName     string // New field for UI display
 	IntegrationName        string
+
+	GuardConditions     []GuardCondition
+	GuardMismatchAction string
+	DelaySeconds        int
+	Priority            int
+	CanonicalizeJSON    bool
+	RetryMaxAttempts    int
+	RetryBackoffSeconds int
+	BatchSize           int
+	Concurrency         int
+	RateLimit           int
+	SampleRate          int
+	SampleChannelID     string
+	EnrichURL           string
+	EnrichMerge         string
+	EnrichField         string
+	Pipeline            []string
+	PipelineNames       []string // Names of the pipeline transformations, for UI display
+	ActiveWindow        string
+	RequestReply        bool
+	ReplyTimeoutSeconds int
+	WiretapChannelID    string
+	WiretapStage        string
+	ResequenceKey       string
+	ResequenceSeconds   int
+	Disabled            bool
+	Archive             bool
+	DeadLetterStore     string
+	Tags                []string
+	Revision            int
+}
+
+// ScriptLibrary is a shared script that transformations and collectors of the same engine can import:
+// with load() in Starlark and require() in JavaScript.
+type ScriptLibrary struct {
+	ID          string
+	Name        string // Name the scripts import the library by, unique per engine
+	Description string
+	Engine      string // "javascript" or "starlark"
+	Script      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SQLConnection is a connection profile of an external database that collector scripts can query
+// with the sql module, identified in the scripts by its name.
+type SQLConnection struct {
+	ID          string
+	Name        string
+	Description string
+	Driver      string // "postgres" or "sqlserver"
+	DSN         string // Connection string in the format of the driver
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// FileServer is an SFTP or FTP server that collector scripts can list, download and upload files on
+// with the sftp module, identified in the scripts by its name.
+type FileServer struct {
+	ID                string
+	Name              string
+	Description       string
+	Protocol          string // "sftp" or "ftp"
+	Host              string
+	Port              int
+	Username          string
+	Password          string // Also the passphrase of an encrypted private key
+	PrivateKey        string // PEM private key for SFTP public key authentication
+	HostKey           string // Expected SFTP host key in authorized_keys format
+	SkipHostKeyVerify bool   // Connect over SFTP without a HostKey, trusting any host (testing only)
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 }
 
 // Transformation represents a script for message transformation.
 type Transformation struct {
-	ID        string
-	Name      string
-	Engine    string // "javascript" or "starlark"
-	Script    string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          string
+	Name        string
+	Description string
+	Engine      string // "javascript", "starlark" or "cel"
+	Script      string
+	Tests       []TransformationTest     // Test cases shipped with the script, checked on import
+	Samples     []map[string]interface{} // Sample payloads that document the expected input
+	Tags        []string                 // Free-form labels for grouping and filtering
+	Revision    int                      // Incremented by every update, see ErrConflict
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TransformationTest is an input message together with the body the script must produce for it.
+// A null Expected means the script is expected to filter the message.
+type TransformationTest struct {
+	Name     string                 `json:"name"`
+	Message  map[string]interface{} `json:"message"`
+	Headers  map[string]interface{} `json:"headers,omitempty"`
+	Expected interface{}            `json:"expected"`
 }
 
 // Collector represents a scheduled job to fetch external data.
@@ -91,7 +247,221 @@ type Collector struct {
 	Schedule      string // Cron string
 	Engine        string // "javascript" or "starlark"
 	Script        string
-	IntegrationID *string // Nullable
+	IntegrationID *string  // Nullable
+	Tags          []string // Free-form labels for grouping and filtering
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
+
+// CollectorRun is one scheduled execution of a collector.
+type CollectorRun struct {
+	ID          int64
+	CollectorID string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Duration    time.Duration
+	Messages    int    // Messages published to the collector output exchange
+	Error       string // Why the run failed, empty on success
+}
+
+// TraceHop records one step of a traced message through the bus: collected from a 1C queue, routed or
+// forwarded to a 1C queue. All hops of a message share the trace ID carried in its x-esb-trace-id header.
+type TraceHop struct {
+	ID              int64
+	TraceID         string
+	Stage           string // "outbound", "route" or "inbound"
+	RouteID         string // Route that handled the hop, empty outside routers
+	Source          string // Queue the message was taken from
+	Destination     string // Exchange or queue the message was published to
+	MessageID       string
+	Transformations []string // Names of the transformation scripts applied by the hop, in order
+	CreatedAt       time.Time
+}
+
+// ScriptExecution is one run of a transformation script by a router, kept in the execution history
+// shown on the transformation page.
+type ScriptExecution struct {
+	ID               int64
+	TransformationID string
+	RouteID          string
+	RouteName        string // Name of the route at the time of the run
+	MessageID        string
+	Duration         time.Duration
+	Success          bool
+	Error            string // Why the script failed, empty on success
+	Input            string // Body given to the script as JSON, truncated; empty unless payloads are recorded
+	Output           string // Body returned by the script as JSON, truncated; "null" when it filtered the message
+	ExecutedAt       time.Time
+}
+
+// TraceSummary is a trace on the list of recent traces, described by its first hop.
+type TraceSummary struct {
+	FirstHop TraceHop
+	Hops     int
+}
+
+// DeliveryOutcome is what a router did with one delivery, counted in the route statistics and kept in
+// the message archive.
+type DeliveryOutcome string
+
+// Outcomes of a delivery.
+const (
+	DeliveryRouted   DeliveryOutcome = "routed"   // Published to the destination
+	DeliveryFiltered DeliveryOutcome = "filtered" // Dropped by a transformation that returned null
+	DeliverySkipped  DeliveryOutcome = "skipped"  // Not matched by the guard conditions of the route
+	DeliveryFailed   DeliveryOutcome = "failed"   // Rejected, requeued or handed to the retry policy
+)
+
+// ArchivedMessage is a delivery of an archiving route kept in the message archive: the message as
+// received, what the route did with it and, once routed, the body published to the destination.
+type ArchivedMessage struct {
+	ID          int64
+	RouteID     string
+	RouteName   string // Name of the route at the time of the delivery
+	MessageID   string
+	TraceID     string
+	Source      string // Queue the message was taken from
+	Destination string // Exchange the message was published to, empty unless routed
+	Outcome     DeliveryOutcome
+	Error       string // Why the delivery failed, when known
+	Headers     string // Headers as received, as a JSON object
+	Body        string // Body as received
+	OutputBody  string // Body as published, empty unless routed
+	ReceivedAt  time.Time
+	ProcessedAt time.Time
+}
+
+// ArchiveSearch filters the message archive. Empty fields match every message.
+type ArchiveSearch struct {
+	RouteID string
+	Outcome string
+	Term    string // Message ID, trace ID or text contained in the body
+	Limit   int
+}
+
+// ListFilter narrows and pages the lists of routes, channels and applications. The zero value lists
+// everything.
+type ListFilter struct {
+	Term   string // Text contained in the name, or the exact ID
+	Limit  int    // At most this many rows, 0 for all of them
+	Offset int    // Rows skipped before the first one returned
+	Tag    string // Only objects with this tag, when set
+}
+
+// RouteStats counts the deliveries of a route by outcome. Routes appear once they received a message.
+type RouteStats struct {
+	RouteID       string
+	Routed        int64 // Published to the destination
+	Filtered      int64 // Dropped by a transformation or skipped by the guard conditions
+	Failed        int64 // Rejected, requeued or handed to the retry policy, counted once per delivery attempt
+	LastMessageAt time.Time
+}
+
+// Where a route keeps the messages that failed for good: exhausted their retries, failed permanently,
+// or were rejected by a route without a retry policy.
+const (
+	DeadLetterBroker   = ""         // The parking-lot queue, or the dead-letter exchange of the source queue
+	DeadLetterDatabase = "database" // The dead_letters table instead of the broker
+	DeadLetterBoth     = "both"     // The dead_letters table and the broker
+)
+
+// DeadLetter is a message that failed for good on a route storing its dead letters in the database. It is
+// kept until it is replayed to the source queue of the route or deleted.
+type DeadLetter struct {
+	ID            int64
+	RouteID       string
+	RouteName     string // Name of the route at the time of the failure
+	MessageID     string
+	TraceID       string
+	Source        string // Queue the message was taken from
+	Reason        string // Why the message failed
+	Attempts      int    // Retries made before the message was dead-lettered
+	Headers       string // Headers as received, as a JSON object
+	ContentType   string
+	CorrelationID string
+	Body          string
+	CreatedAt     time.Time
+}
+
+// DeadLetterSearch filters the dead letters. Empty fields match every message.
+type DeadLetterSearch struct {
+	RouteID string
+	Term    string // Message ID, trace ID or text contained in the reason or the body
+	Limit   int
+}
+
+// RouteVersion is the configuration a route had before one of its updates, kept for rollback.
+type RouteVersion struct {
+	ID        int64
+	RouteID   string
+	Version   int   // Increases with every update of the route
+	Route     Route // The configuration that the update replaced
+	CreatedAt time.Time
+}
+
+// TransformationVersion is the script and settings a transformation had before one of its updates, kept
+// for comparison and rollback.
+type TransformationVersion struct {
+	ID               int64
+	TransformationID string
+	Version          int            // Increases with every update of the transformation
+	Transformation   Transformation // The transformation that the update replaced
+	CreatedAt        time.Time
+}
+
+// Kinds of the deleted objects kept in the trash.
+const (
+	TrashRoute          = "route"
+	TrashTransformation = "transformation"
+	TrashChannel        = "channel"
+)
+
+// TrashItem is a deleted route, transformation or channel, kept so that it can be restored. Only the
+// field of its kind is set.
+type TrashItem struct {
+	ID             int64
+	Kind           string // TrashRoute, TrashTransformation or TrashChannel
+	EntityID       string
+	Name           string
+	Route          *Route
+	Transformation *Transformation
+	Channel        *Channel
+	Released       []ReleasedRoute // References the deletion of a channel or transformation removed from routes
+	DeletedAt      time.Time
+}
+
+// ReleasedRoute is what the deletion of a channel or a transformation removed from a route, kept in its
+// trash item so that restoring the object puts it back.
+type ReleasedRoute struct {
+	RouteID       string
+	Usages        []string      // References of the route to the object, Usage* constants
+	Disabled      bool          // The deletion disabled the route, which ran before
+	SampleRate    int           // Sample rate of the route sampling to the deleted channel
+	PipelineSteps []int         // Positions of the deleted transformation in the pipeline of the route
+	RoutingRules  []RoutingRule // Routing rules of the route delivering to the deleted channel
+}
+
+// AuditEntry records a change requested through the admin interface or its JSON endpoints.
+type AuditEntry struct {
+	ID         int64
+	Actor      string // User reported by the authenticating proxy in front of the admin interface, if any
+	RemoteAddr string
+	Method     string
+	Path       string
+	Kind       string // Kind of the changed object, such as route or channel, or the admin section
+	EntityID   string
+	Action     string // What the request did, such as create, update or delete
+	Status     int    // HTTP status of the response
+	OldValue   string // The object before the change as JSON, with secrets masked
+	NewValue   string // The object after the change, or the submitted form when there is no object
+	CreatedAt  time.Time
+}
+
+// AuditSearch filters the audit log.
+type AuditSearch struct {
+	Kind   string
+	Action string
+	Actor  string
+	Term   string // Object ID, or text contained in the path or the recorded values
+	Limit  int
+}
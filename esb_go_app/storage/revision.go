@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrConflict is returned by the update of a channel, route or transformation that was changed or deleted
+// since it was read. The update names the revision it was read at; a zero revision skips the check, for
+// the writes that do not start from what an editor has seen.
+var ErrConflict = errors.New("the record was changed by someone else since it was read")
+
+// revisionCondition narrows an update by ID to the revision it was read at, taking the revision twice.
+const revisionCondition = ` AND (? = 0 OR revision = ?)`
+
+// checkRevision returns ErrConflict when an update checking the revision changed no row, and otherwise
+// moves the revision of the updated object to the stored one.
+func checkRevision(res sql.Result, revision *int) error {
+	if *revision == 0 {
+		return nil
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check revision: %w", err)
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	*revision++
+	return nil
+}
+
+// migrateRevisionColumns adds the revision column to the tables whose rows are edited in the admin
+// interface.
+func (s *SQLStore) migrateRevisionColumns() error {
+	for _, table := range []string{"channels", "routes", "transformations"} {
+		rows, err := s.db.Query(s.db.dialect.tableInfoQuery(table))
+		if err != nil {
+			return fmt.Errorf("failed to read table_info for %s: %w", table, err)
+		}
+		hasRevision := false
+		for rows.Next() {
+			var cid, notnull, pk int
+			var name, rtype string
+			var dfltValue interface{}
+			if err := rows.Scan(&cid, &name, &rtype, &notnull, &dfltValue, &pk); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan table_info for %s: %w", table, err)
+			}
+			if name == "revision" {
+				hasRevision = true
+			}
+		}
+		rows.Close()
+		if hasRevision {
+			continue
+		}
+
+		s.logger.Info("migrating '" + table + "' table: adding revision column...")
+		if _, err := s.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN revision INTEGER NOT NULL DEFAULT 1`); err != nil {
+			return fmt.Errorf("failed to add revision to %s table: %w", table, err)
+		}
+		s.logger.Info("'" + table + "' table migrated successfully (revision).")
+	}
+	return nil
+}
@@ -2,48 +2,218 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
 
+// routeColumns is the column list used by every query that loads full Route rows.
+const routeColumns = `id, name, source_channel_id, destination_channel_id, route_type, transformation_id, integration_id, guard_conditions, guard_mismatch_action, delay_seconds, priority, canonicalize_json, retry_max_attempts, retry_backoff_seconds, batch_size, concurrency, rate_limit, sample_rate, sample_channel_id, enrich_url, enrich_merge, enrich_field, transformation_pipeline, active_window, request_reply, reply_timeout_seconds, wiretap_channel_id, wiretap_stage, resequence_key, resequence_window_seconds, disabled, archive, dead_letter_store, tags, revision, created_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// extendedRow scans the columns a query selects after the ones of a scan function into extra destinations.
+type extendedRow struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (e extendedRow) Scan(dest ...interface{}) error {
+	return e.row.Scan(append(dest, e.extra...)...)
+}
+
+// scanRoute scans a row selected with routeColumns into a Route.
+func scanRoute(row rowScanner) (*Route, error) {
+	r := &Route{}
+	var guardConditions, pipeline, tags string
+	err := row.Scan(&r.ID, &r.Name, &r.SourceChannelID, &r.DestinationChannelID, &r.RouteType, &r.TransformationID, &r.IntegrationID, &guardConditions, &r.GuardMismatchAction, &r.DelaySeconds, &r.Priority, &r.CanonicalizeJSON, &r.RetryMaxAttempts, &r.RetryBackoffSeconds, &r.BatchSize, &r.Concurrency, &r.RateLimit, &r.SampleRate, &r.SampleChannelID, &r.EnrichURL, &r.EnrichMerge, &r.EnrichField, &pipeline, &r.ActiveWindow, &r.RequestReply, &r.ReplyTimeoutSeconds, &r.WiretapChannelID, &r.WiretapStage, &r.ResequenceKey, &r.ResequenceSeconds, &r.Disabled, &r.Archive, &r.DeadLetterStore, &tags, &r.Revision, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if guardConditions != "" {
+		if err := json.Unmarshal([]byte(guardConditions), &r.GuardConditions); err != nil {
+			return nil, fmt.Errorf("failed to decode guard conditions for route %s: %w", r.ID, err)
+		}
+	}
+	if pipeline != "" {
+		if err := json.Unmarshal([]byte(pipeline), &r.Pipeline); err != nil {
+			return nil, fmt.Errorf("failed to decode transformation pipeline for route %s: %w", r.ID, err)
+		}
+	}
+	if r.Tags, err = decodeTags(tags, r.ID); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// encodeGuardConditions serializes guard conditions for storage, using an empty string when there are none.
+func encodeGuardConditions(conditions []GuardCondition) (string, error) {
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(conditions)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode guard conditions: %w", err)
+	}
+	return string(data), nil
+}
+
+// encodePipeline serializes the transformation pipeline of a route, using an empty string when there is none.
+func encodePipeline(ids []string) (string, error) {
+	if len(ids) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode transformation pipeline: %w", err)
+	}
+	return string(data), nil
+}
+
 // CreateRoute creates a new route in the database.
-func (s *Store) CreateRoute(route *Route) error {
-	query := `INSERT INTO routes (id, name, source_channel_id, destination_channel_id, route_type, transformation_id, integration_id) VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err := s.db.Exec(query, route.ID, route.Name, route.SourceChannelID, route.DestinationChannelID, route.RouteType, route.TransformationID, route.IntegrationID)
+func (s *SQLStore) CreateRoute(route *Route) error {
+	return insertRoute(s.db, route)
+}
+
+// insertRoute inserts a route on the database or within a transaction.
+func insertRoute(e execer, route *Route) error {
+	guardConditions, err := encodeGuardConditions(route.GuardConditions)
+	if err != nil {
+		return err
+	}
+	pipeline, err := encodePipeline(route.Pipeline)
+	if err != nil {
+		return err
+	}
+	tags, err := encodeTags(route.Tags)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO routes (id, name, source_channel_id, destination_channel_id, route_type, transformation_id, integration_id, guard_conditions, guard_mismatch_action, delay_seconds, priority, canonicalize_json, retry_max_attempts, retry_backoff_seconds, batch_size, concurrency, rate_limit, sample_rate, sample_channel_id, enrich_url, enrich_merge, enrich_field, transformation_pipeline, active_window, request_reply, reply_timeout_seconds, wiretap_channel_id, wiretap_stage, resequence_key, resequence_window_seconds, disabled, archive, dead_letter_store, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = e.Exec(query, route.ID, route.Name, route.SourceChannelID, route.DestinationChannelID, route.RouteType, route.TransformationID, route.IntegrationID, guardConditions, route.GuardMismatchAction, route.DelaySeconds, route.Priority, route.CanonicalizeJSON, route.RetryMaxAttempts, route.RetryBackoffSeconds, route.BatchSize, route.Concurrency, route.RateLimit, route.SampleRate, route.SampleChannelID, route.EnrichURL, route.EnrichMerge, route.EnrichField, pipeline, route.ActiveWindow, route.RequestReply, route.ReplyTimeoutSeconds, route.WiretapChannelID, route.WiretapStage, route.ResequenceKey, route.ResequenceSeconds, route.Disabled, route.Archive, route.DeadLetterStore, tags)
 	if err != nil {
 		return fmt.Errorf("failed to create route: %w", err)
 	}
 	return nil
 }
 
-// UpdateRoute updates an existing route in the database.
-func (s *Store) UpdateRoute(route *Route) error {
-	query := `UPDATE routes SET name = ?, source_channel_id = ?, destination_channel_id = ?, route_type = ?, transformation_id = ?, integration_id = ? WHERE id = ?`
-	_, err := s.db.Exec(query, route.Name, route.SourceChannelID, route.DestinationChannelID, route.RouteType, route.TransformationID, route.IntegrationID, route.ID)
+// UpdateRoute updates an existing route in the database. The configuration it replaces is kept as a
+// new version of the route.
+func (s *SQLStore) UpdateRoute(route *Route) error {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to update route: %w", err)
+		return fmt.Errorf("failed to begin route update: %w", err)
+	}
+	defer tx.Rollback()
+	if err := updateRoute(tx, route); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit route update: %w", err)
 	}
 	return nil
 }
 
-// DeleteRoute deletes a route by its ID.
-func (s *Store) DeleteRoute(id string) error {
-	query := "DELETE FROM routes WHERE id = ?"
-	_, err := s.db.Exec(query, id)
+// updateRoute updates a route within a transaction, keeping the configuration it replaces as a version.
+func updateRoute(tx *dbTx, route *Route) error {
+	guardConditions, err := encodeGuardConditions(route.GuardConditions)
+	if err != nil {
+		return err
+	}
+	pipeline, err := encodePipeline(route.Pipeline)
 	if err != nil {
+		return err
+	}
+	tags, err := encodeTags(route.Tags)
+	if err != nil {
+		return err
+	}
+	if err := snapshotRoute(tx, route.ID); err != nil {
+		return err
+	}
+
+	query := `UPDATE routes SET name = ?, source_channel_id = ?, destination_channel_id = ?, route_type = ?, transformation_id = ?, integration_id = ?, guard_conditions = ?, guard_mismatch_action = ?, delay_seconds = ?, priority = ?, canonicalize_json = ?, retry_max_attempts = ?, retry_backoff_seconds = ?, batch_size = ?, concurrency = ?, rate_limit = ?, sample_rate = ?, sample_channel_id = ?, enrich_url = ?, enrich_merge = ?, enrich_field = ?, transformation_pipeline = ?, active_window = ?, request_reply = ?, reply_timeout_seconds = ?, wiretap_channel_id = ?, wiretap_stage = ?, resequence_key = ?, resequence_window_seconds = ?, disabled = ?, archive = ?, dead_letter_store = ?, tags = ?, revision = revision + 1 WHERE id = ?` + revisionCondition
+	res, err := tx.Exec(query, route.Name, route.SourceChannelID, route.DestinationChannelID, route.RouteType, route.TransformationID, route.IntegrationID, guardConditions, route.GuardMismatchAction, route.DelaySeconds, route.Priority, route.CanonicalizeJSON, route.RetryMaxAttempts, route.RetryBackoffSeconds, route.BatchSize, route.Concurrency, route.RateLimit, route.SampleRate, route.SampleChannelID, route.EnrichURL, route.EnrichMerge, route.EnrichField, pipeline, route.ActiveWindow, route.RequestReply, route.ReplyTimeoutSeconds, route.WiretapChannelID, route.WiretapStage, route.ResequenceKey, route.ResequenceSeconds, route.Disabled, route.Archive, route.DeadLetterStore, tags, route.ID, route.Revision, route.Revision)
+	if err != nil {
+		return fmt.Errorf("failed to update route: %w", err)
+	}
+	return checkRevision(res, &route.Revision)
+}
+
+// DeleteRoute moves a route to the trash.
+func (s *SQLStore) DeleteRoute(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin route deletion: %w", err)
+	}
+	defer tx.Rollback()
+	route, err := scanRoute(tx.QueryRow(`SELECT `+routeColumns+` FROM routes WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read route before deletion: %w", err)
+	}
+	if err := trashRoute(tx, route); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit route deletion: %w", err)
+	}
+	return nil
+}
+
+// trashRoute moves a route to the trash within a transaction.
+func trashRoute(tx *dbTx, route *Route) error {
+	if err := moveToTrash(tx, TrashRoute, route.ID, route.Name, route, nil); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM routes WHERE id = ?", route.ID); err != nil {
 		return fmt.Errorf("failed to delete route: %w", err)
 	}
 	return nil
 }
 
-// buildRouteInfo manually builds the extended RouteInfo struct from a raw Route.
-func (s *Store) BuildRouteInfo(route Route) (RouteInfo, error) {
+// newRouteInfo copies the fields of a route to a RouteInfo, without the names of the objects it refers to.
+func newRouteInfo(route Route) RouteInfo {
 	info := RouteInfo{
 		ID:              route.ID,
 		Name:            route.Name,
 		SourceChannelID: route.SourceChannelID,
 		RouteType:       route.RouteType,
 		CreatedAt:       route.CreatedAt,
+
+		GuardConditions:     route.GuardConditions,
+		GuardMismatchAction: route.GuardMismatchAction,
+		Disabled:            route.Disabled,
+		Archive:             route.Archive,
+		DeadLetterStore:     route.DeadLetterStore,
+		Tags:                route.Tags,
+		Revision:            route.Revision,
+		ResequenceKey:       route.ResequenceKey,
+		ResequenceSeconds:   route.ResequenceSeconds,
+		WiretapStage:        route.WiretapStage,
+		WiretapChannelID:    route.WiretapChannelID,
+		ReplyTimeoutSeconds: route.ReplyTimeoutSeconds,
+		RequestReply:        route.RequestReply,
+		ActiveWindow:        route.ActiveWindow,
+		Pipeline:            route.Pipeline,
+		EnrichField:         route.EnrichField,
+		EnrichMerge:         route.EnrichMerge,
+		EnrichURL:           route.EnrichURL,
+		SampleChannelID:     route.SampleChannelID,
+		SampleRate:          route.SampleRate,
+		RateLimit:           route.RateLimit,
+		Concurrency:         route.Concurrency,
+		BatchSize:           route.BatchSize,
+		RetryBackoffSeconds: route.RetryBackoffSeconds,
+		RetryMaxAttempts:    route.RetryMaxAttempts,
+		CanonicalizeJSON:    route.CanonicalizeJSON,
+		Priority:            route.Priority,
+		DelaySeconds:        route.DelaySeconds,
 	}
 
 	if route.DestinationChannelID != nil {
@@ -55,6 +225,13 @@ func (s *Store) BuildRouteInfo(route Route) (RouteInfo, error) {
 	if route.IntegrationID != nil {
 		info.IntegrationID = *route.IntegrationID
 	}
+	return info
+}
+
+// BuildRouteInfo builds the extended RouteInfo struct of a single route from a raw Route, looking up the
+// objects it refers to. Lists of routes read them with the route in one query instead.
+func (s *SQLStore) BuildRouteInfo(route Route) (RouteInfo, error) {
+	info := newRouteInfo(route)
 
 	// 1. Populate Source Info
 	if strings.HasPrefix(route.SourceChannelID, "collector-output:") {
@@ -98,6 +275,13 @@ func (s *Store) BuildRouteInfo(route Route) (RouteInfo, error) {
 			info.TransformationName = transform.Name
 		}
 	}
+	for _, id := range route.Pipeline {
+		name := id // Shown as is when the transformation no longer exists
+		if transform, err := s.GetTransformationByID(id); err == nil && transform != nil {
+			name = transform.Name
+		}
+		info.PipelineNames = append(info.PipelineNames, name)
+	}
 
 	// 4. Populate Integration Info
 	if route.IntegrationID != nil {
@@ -110,56 +294,151 @@ func (s *Store) BuildRouteInfo(route Route) (RouteInfo, error) {
 	return info, nil
 }
 
-// processRoutesRows iterates over rows and builds a slice of RouteInfo.
-func (s *Store) processRoutesRows(rows *sql.Rows) ([]RouteInfo, error) {
+// routeInfoQuery selects the routes with the names of their channels, applications, collector,
+// transformation and integration, so a list of routes is read in one query.
+var routeInfoQuery = `SELECT r.` + strings.ReplaceAll(routeColumns, ", ", ", r.") + `,
+		COALESCE(sc.id, ''), COALESCE(sc.name, ''), COALESCE(sc.destination, ''), COALESCE(sa.name, ''), COALESCE(col.id, ''), COALESCE(col.name, ''),
+		COALESCE(dc.name, ''), COALESCE(dc.destination, ''), COALESCE(da.name, ''), COALESCE(t.name, ''), COALESCE(i.name, '')
+	FROM routes r
+	LEFT JOIN channels sc ON sc.id = r.source_channel_id
+	LEFT JOIN applications sa ON sa.id = sc.application_id
+	LEFT JOIN collectors col ON 'collector-output:' || col.id = r.source_channel_id
+	LEFT JOIN channels dc ON dc.id = r.destination_channel_id
+	LEFT JOIN applications da ON da.id = dc.application_id
+	LEFT JOIN transformations t ON t.id = r.transformation_id
+	LEFT JOIN integrations i ON i.id = r.integration_id`
+
+// queryRouteInfos reads the routes of a routeInfoQuery narrowed by a condition and paged by the filter,
+// newest first.
+func (s *SQLStore) queryRouteInfos(condition string, args []interface{}, filter ListFilter) ([]RouteInfo, error) {
+	conditions, filterArgs := filterConditions(filter, "r.id", "r.tags", "r.name")
+	if condition != "" {
+		conditions = append([]string{condition}, conditions...)
+	}
+	args = append(args, filterArgs...)
+	query := routeInfoQuery
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	page, pageArgs := pageClause(filter)
+	query += ` ORDER BY r.created_at DESC, r.id` + page
+
+	rows, err := s.db.Query(query, append(args, pageArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	var results []RouteInfo
+	hasPipeline := false
 	for rows.Next() {
-		var route Route
-		// Scan all fields from the routes table
-		if err := rows.Scan(&route.ID, &route.Name, &route.CreatedAt, &route.RouteType, &route.TransformationID, &route.IntegrationID, &route.SourceChannelID, &route.DestinationChannelID); err != nil {
-			return nil, fmt.Errorf("failed to scan raw route: %w", err)
-		}
-		info, err := s.BuildRouteInfo(route)
+		info, err := scanRouteInfo(rows)
 		if err != nil {
-			s.logger.Warn("could not build full route info, skipping", "route_id", route.ID, "error", err)
-			continue
+			return nil, err
 		}
+		hasPipeline = hasPipeline || len(info.Pipeline) > 0
 		results = append(results, info)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if hasPipeline {
+		if err := s.fillPipelineNames(results); err != nil {
+			return nil, err
+		}
+	}
 	return results, nil
 }
 
-// GetAllRoutes retrieves all routes and enriches them with related info.
-func (s *Store) GetAllRoutes() ([]RouteInfo, error) {
-	query := `SELECT id, name, created_at, route_type, transformation_id, integration_id, source_channel_id, destination_channel_id FROM routes ORDER BY created_at DESC`
-	rows, err := s.db.Query(query)
+// scanRouteInfo scans a row selected with routeInfoQuery.
+func scanRouteInfo(row rowScanner) (RouteInfo, error) {
+	var sourceID, sourceName, sourceDestination, sourceApp, collectorID, collectorName string
+	var destName, destDestination, destApp, transformationName, integrationName string
+	route, err := scanRoute(extendedRow{row: row, extra: []interface{}{
+		&sourceID, &sourceName, &sourceDestination, &sourceApp, &collectorID, &collectorName,
+		&destName, &destDestination, &destApp, &transformationName, &integrationName,
+	}})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all routes: %w", err)
+		return RouteInfo{}, fmt.Errorf("failed to scan route info row: %w", err)
+	}
+
+	info := newRouteInfo(*route)
+	if strings.HasPrefix(route.SourceChannelID, "collector-output:") {
+		if collectorID != "" {
+			info.SourceAppName = "Сборщик"
+			info.SourceChannelName = collectorName
+			info.SourceBaseName = route.SourceChannelID
+		}
+	} else if sourceID != "" {
+		info.SourceBaseName = sourceDestination
+		info.SourceDestination = sourceDestination
+		info.SourceChannelName = sourceName
+		info.SourceAppName = sourceApp
+	}
+	info.DestinationChannelName = destName
+	info.DestinationDestination = destDestination
+	info.DestinationAppName = destApp
+	info.TransformationName = transformationName
+	info.IntegrationName = integrationName
+	return info, nil
+}
+
+// fillPipelineNames sets the names of the pipeline transformations of the routes from one query.
+func (s *SQLStore) fillPipelineNames(routes []RouteInfo) error {
+	rows, err := s.db.Query(`SELECT id, name FROM transformations`)
+	if err != nil {
+		return err
 	}
 	defer rows.Close()
+	names := make(map[string]string)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-	return s.processRoutesRows(rows)
+	for i := range routes {
+		for _, id := range routes[i].Pipeline {
+			name, ok := names[id]
+			if !ok {
+				name = id // Shown as is when the transformation no longer exists
+			}
+			routes[i].PipelineNames = append(routes[i].PipelineNames, name)
+		}
+	}
+	return nil
+}
+
+// GetAllRoutes retrieves the routes matching the filter by name, newest first, with the names of the
+// objects they refer to.
+func (s *SQLStore) GetAllRoutes(filter ListFilter) ([]RouteInfo, error) {
+	routes, err := s.queryRouteInfos("", nil, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all routes: %w", err)
+	}
+	return routes, nil
 }
 
 // GetRoutesByIntegrationID retrieves all routes for a given integration ID.
-func (s *Store) GetRoutesByIntegrationID(integrationID string) ([]RouteInfo, error) {
-	query := `SELECT id, name, created_at, route_type, transformation_id, integration_id, source_channel_id, destination_channel_id FROM routes WHERE integration_id = ? ORDER BY created_at DESC`
-	rows, err := s.db.Query(query, integrationID)
+func (s *SQLStore) GetRoutesByIntegrationID(integrationID string) ([]RouteInfo, error) {
+	routes, err := s.queryRouteInfos("r.integration_id = ?", []interface{}{integrationID}, ListFilter{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get routes by integration id: %w", err)
 	}
-	defer rows.Close()
-
-	return s.processRoutesRows(rows)
+	return routes, nil
 }
 
 // GetRouteByID retrieves a single route by its ID.
-func (s *Store) GetRouteByID(id string) (*Route, error) {
-	query := `SELECT id, name, source_channel_id, destination_channel_id, route_type, transformation_id, integration_id, created_at FROM routes WHERE id = ?`
+func (s *SQLStore) GetRouteByID(id string) (*Route, error) {
+	query := `SELECT ` + routeColumns + ` FROM routes WHERE id = ?`
 	row := s.db.QueryRow(query, id)
 
-	r := &Route{}
-	err := row.Scan(&r.ID, &r.Name, &r.SourceChannelID, &r.DestinationChannelID, &r.RouteType, &r.TransformationID, &r.IntegrationID, &r.CreatedAt)
+	r, err := scanRoute(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Not found is not an error
@@ -0,0 +1,57 @@
+package storage
+
+import "fmt"
+
+// AddRouteStats adds delivery counters to the statistics of their routes, all of them or none.
+func (s *SQLStore) AddRouteStats(stats []RouteStats) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin route statistics update: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Several instances sharing a PostgreSQL database add to the same rows, so the last message time
+	// only moves forward.
+	query := `INSERT INTO route_stats (route_id, routed, filtered, failed, last_message_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(route_id) DO UPDATE SET
+			routed = route_stats.routed + excluded.routed,
+			filtered = route_stats.filtered + excluded.filtered,
+			failed = route_stats.failed + excluded.failed,
+			last_message_at = CASE WHEN excluded.last_message_at > route_stats.last_message_at THEN excluded.last_message_at ELSE route_stats.last_message_at END`
+	for _, st := range stats {
+		if _, err := tx.Exec(query, st.RouteID, st.Routed, st.Filtered, st.Failed, st.LastMessageAt); err != nil {
+			return fmt.Errorf("failed to update statistics of route %s: %w", st.RouteID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit route statistics: %w", err)
+	}
+	return nil
+}
+
+// GetAllRouteStats returns the statistics of every route that has received a message, keyed by route ID.
+func (s *SQLStore) GetAllRouteStats() (map[string]RouteStats, error) {
+	rows, err := s.db.Query(`SELECT route_id, routed, filtered, failed, last_message_at FROM route_stats`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get route statistics: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]RouteStats)
+	for rows.Next() {
+		var st RouteStats
+		if err := rows.Scan(&st.RouteID, &st.Routed, &st.Filtered, &st.Failed, &st.LastMessageAt); err != nil {
+			return nil, fmt.Errorf("failed to scan route statistics row: %w", err)
+		}
+		stats[st.RouteID] = st
+	}
+	return stats, rows.Err()
+}
+
+// deleteRouteStats deletes the statistics of a route on the database or within a transaction.
+func deleteRouteStats(e execer, routeID string) error {
+	if _, err := e.Exec(`DELETE FROM route_stats WHERE route_id = ?`, routeID); err != nil {
+		return fmt.Errorf("failed to delete route statistics: %w", err)
+	}
+	return nil
+}
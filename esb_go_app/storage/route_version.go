@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// MaxRouteVersions is how many previous versions are kept per route; older ones are deleted.
+const MaxRouteVersions = 50
+
+// snapshotRoute stores the current configuration of a route as its next version, within the
+// transaction that is about to update it.
+func snapshotRoute(tx *dbTx, routeID string) error {
+	previous, err := scanRoute(tx.QueryRow(`SELECT `+routeColumns+` FROM routes WHERE id = ?`, routeID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil // Nothing to keep; the update does not change any row either
+		}
+		return fmt.Errorf("failed to read route for its version history: %w", err)
+	}
+	snapshot, err := json.Marshal(previous)
+	if err != nil {
+		return fmt.Errorf("failed to encode route version: %w", err)
+	}
+
+	query := `INSERT INTO route_versions (route_id, version, snapshot)
+		VALUES (?, (SELECT COALESCE(MAX(version), 0) + 1 FROM route_versions WHERE route_id = ?), ?)`
+	if _, err := tx.Exec(query, routeID, routeID, string(snapshot)); err != nil {
+		return fmt.Errorf("failed to store route version: %w", err)
+	}
+	query = `DELETE FROM route_versions WHERE route_id = ? AND version <= (SELECT MAX(version) FROM route_versions WHERE route_id = ?) - ?`
+	if _, err := tx.Exec(query, routeID, routeID, MaxRouteVersions); err != nil {
+		return fmt.Errorf("failed to prune route versions: %w", err)
+	}
+	return nil
+}
+
+// GetRouteVersions returns the stored versions of a route, newest first.
+func (s *SQLStore) GetRouteVersions(routeID string) ([]RouteVersion, error) {
+	rows, err := s.db.Query(`SELECT id, route_id, version, snapshot, created_at FROM route_versions WHERE route_id = ? ORDER BY version DESC`, routeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get route versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []RouteVersion
+	for rows.Next() {
+		v, err := scanRouteVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// GetRouteVersion returns a stored version of a route by its ID.
+func (s *SQLStore) GetRouteVersion(routeID string, id int64) (*RouteVersion, error) {
+	row := s.db.QueryRow(`SELECT id, route_id, version, snapshot, created_at FROM route_versions WHERE route_id = ? AND id = ?`, routeID, id)
+	v, err := scanRouteVersion(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// scanRouteVersion scans a route version row and decodes its snapshot.
+func scanRouteVersion(row rowScanner) (*RouteVersion, error) {
+	v := &RouteVersion{}
+	var snapshot string
+	if err := row.Scan(&v.ID, &v.RouteID, &v.Version, &snapshot, &v.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan route version row: %w", err)
+	}
+	if err := json.Unmarshal([]byte(snapshot), &v.Route); err != nil {
+		return nil, fmt.Errorf("failed to decode route version %d: %w", v.Version, err)
+	}
+	return v, nil
+}
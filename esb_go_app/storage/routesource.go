@@ -13,7 +13,7 @@ type RouteSource struct {
 
 // GetAllRouteSources fetches all possible sources for routes (all channels and all collectors)
 // and returns them as a unified list.
-func (s *Store) GetAllRouteSources() ([]RouteSource, error) {
+func (s *SQLStore) GetAllRouteSources() ([]RouteSource, error) {
 	var sources []RouteSource
 
 	// 1. Get all outbound channels
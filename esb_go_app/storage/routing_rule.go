@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// GetRoutingRules returns the routing rules of a route in evaluation order, with the names of their
+// destination channels.
+func (s *SQLStore) GetRoutingRules(routeID string) ([]RoutingRule, error) {
+	query := `
+		SELECT r.id, r.route_id, r.position, r.field, r.operator, r.value, r.destination_channel_id, r.created_at,
+			COALESCE(c.name, ''), COALESCE(a.name, '')
+		FROM routing_rules r
+		LEFT JOIN channels c ON r.destination_channel_id = c.id
+		LEFT JOIN applications a ON c.application_id = a.id
+		WHERE r.route_id = ?
+		ORDER BY r.position, r.created_at
+	`
+	rows, err := s.db.Query(query, routeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routing rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []RoutingRule
+	for rows.Next() {
+		var rule RoutingRule
+		if err := rows.Scan(&rule.ID, &rule.RouteID, &rule.Position, &rule.Field, &rule.Operator, &rule.Value, &rule.DestinationChannelID, &rule.CreatedAt,
+			&rule.DestinationChannelName, &rule.DestinationAppName); err != nil {
+			return nil, fmt.Errorf("failed to scan routing rule row: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// CreateRoutingRule appends a routing rule to the end of its route's rules.
+func (s *SQLStore) CreateRoutingRule(rule *RoutingRule) error {
+	query := `INSERT INTO routing_rules (id, route_id, position, field, operator, value, destination_channel_id)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM routing_rules WHERE route_id = ?), ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, rule.ID, rule.RouteID, rule.RouteID, rule.Field, rule.Operator, rule.Value, rule.DestinationChannelID)
+	if err != nil {
+		return fmt.Errorf("failed to create routing rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteRoutingRule deletes a routing rule of a route.
+func (s *SQLStore) DeleteRoutingRule(routeID, id string) error {
+	_, err := s.db.Exec("DELETE FROM routing_rules WHERE id = ? AND route_id = ?", id, routeID)
+	if err != nil {
+		return fmt.Errorf("failed to delete routing rule: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecordScriptExecution stores a run of a transformation script and deletes the oldest runs of the
+// transformation beyond the keep most recent ones.
+func (s *SQLStore) RecordScriptExecution(exec *ScriptExecution, keep int) error {
+	if exec.ExecutedAt.IsZero() {
+		exec.ExecutedAt = time.Now()
+	}
+	query := `INSERT INTO script_executions (transformation_id, route_id, route_name, message_id, duration_ms, success, error, input, output, executed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.db.insertID(query, exec.TransformationID, exec.RouteID, exec.RouteName, exec.MessageID, exec.Duration.Milliseconds(), exec.Success, exec.Error, exec.Input, exec.Output, exec.ExecutedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record script execution: %w", err)
+	}
+	exec.ID = id
+
+	_, err = s.db.Exec(`DELETE FROM script_executions WHERE transformation_id = ? AND id <= (
+		SELECT id FROM script_executions WHERE transformation_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`,
+		exec.TransformationID, exec.TransformationID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to prune script executions: %w", err)
+	}
+	return nil
+}
+
+// GetScriptExecutions returns the most recent runs of a transformation script, newest first.
+func (s *SQLStore) GetScriptExecutions(transformationID string, limit int) ([]ScriptExecution, error) {
+	query := `SELECT id, transformation_id, route_id, route_name, message_id, duration_ms, success, error, input, output, executed_at
+		FROM script_executions WHERE transformation_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.Query(query, transformationID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script executions: %w", err)
+	}
+	defer rows.Close()
+
+	var executions []ScriptExecution
+	for rows.Next() {
+		var exec ScriptExecution
+		var durationMs int64
+		if err := rows.Scan(&exec.ID, &exec.TransformationID, &exec.RouteID, &exec.RouteName, &exec.MessageID, &durationMs, &exec.Success, &exec.Error, &exec.Input, &exec.Output, &exec.ExecutedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan script execution row: %w", err)
+		}
+		exec.Duration = time.Duration(durationMs) * time.Millisecond
+		executions = append(executions, exec)
+	}
+	return executions, rows.Err()
+}
+
+// deleteScriptExecutions deletes the execution history of a transformation.
+func (s *SQLStore) deleteScriptExecutions(transformationID string) error {
+	if _, err := s.db.Exec(`DELETE FROM script_executions WHERE transformation_id = ?`, transformationID); err != nil {
+		return fmt.Errorf("failed to delete script executions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// scriptLibraryColumns is the column list used by every query that loads full ScriptLibrary rows.
+const scriptLibraryColumns = `id, name, description, engine, script, created_at, updated_at`
+
+// scanScriptLibrary scans a row selected with scriptLibraryColumns into a ScriptLibrary.
+func scanScriptLibrary(row rowScanner) (*ScriptLibrary, error) {
+	l := &ScriptLibrary{}
+	if err := row.Scan(&l.ID, &l.Name, &l.Description, &l.Engine, &l.Script, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// CreateScriptLibrary creates a new script library in the database.
+func (s *SQLStore) CreateScriptLibrary(l *ScriptLibrary) error {
+	query := `INSERT INTO script_libraries (id, name, description, engine, script) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, l.ID, l.Name, l.Description, l.Engine, l.Script)
+	if err != nil {
+		return fmt.Errorf("failed to create script library: %w", err)
+	}
+	return nil
+}
+
+// GetScriptLibraryByID retrieves a script library by its ID.
+func (s *SQLStore) GetScriptLibraryByID(id string) (*ScriptLibrary, error) {
+	query := `SELECT ` + scriptLibraryColumns + ` FROM script_libraries WHERE id = ?`
+	l, err := scanScriptLibrary(s.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get script library by ID: %w", err)
+	}
+	return l, nil
+}
+
+// GetScriptLibraryByName retrieves the script library that scripts of the given engine import by name.
+func (s *SQLStore) GetScriptLibraryByName(engine, name string) (*ScriptLibrary, error) {
+	query := `SELECT ` + scriptLibraryColumns + ` FROM script_libraries WHERE engine = ? AND name = ?`
+	l, err := scanScriptLibrary(s.db.QueryRow(query, engine, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get script library by name: %w", err)
+	}
+	return l, nil
+}
+
+// GetAllScriptLibraries retrieves all script libraries ordered by engine and name.
+func (s *SQLStore) GetAllScriptLibraries() ([]ScriptLibrary, error) {
+	query := `SELECT ` + scriptLibraryColumns + ` FROM script_libraries ORDER BY engine, name`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all script libraries: %w", err)
+	}
+	defer rows.Close()
+
+	var libraries []ScriptLibrary
+	for rows.Next() {
+		l, err := scanScriptLibrary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan script library row: %w", err)
+		}
+		libraries = append(libraries, *l)
+	}
+	return libraries, nil
+}
+
+// UpdateScriptLibrary updates an existing script library in the database.
+func (s *SQLStore) UpdateScriptLibrary(l *ScriptLibrary) error {
+	query := `UPDATE script_libraries SET name = ?, description = ?, engine = ?, script = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := s.db.Exec(query, l.Name, l.Description, l.Engine, l.Script, l.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update script library: %w", err)
+	}
+	return nil
+}
+
+// DeleteScriptLibrary deletes a script library by its ID.
+func (s *SQLStore) DeleteScriptLibrary(id string) error {
+	query := `DELETE FROM script_libraries WHERE id = ?`
+	_, err := s.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete script library: %w", err)
+	}
+	return nil
+}
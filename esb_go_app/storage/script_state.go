@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// TransformationStateNamespace is the namespace of the key-value state of a transformation script.
+func TransformationStateNamespace(transformationID string) string {
+	return "transformation:" + transformationID
+}
+
+// CollectorStateNamespace is the namespace of the key-value state of a collector script.
+func CollectorStateNamespace(collectorID string) string {
+	return "collector:" + collectorID
+}
+
+// IsCollectorStateNamespace reports whether the namespace is the one of a collector script.
+func IsCollectorStateNamespace(namespace string) bool {
+	return strings.HasPrefix(namespace, "collector:")
+}
+
+// GetScriptState returns the JSON-encoded value a script stored under the key, and false if there is none.
+func (s *SQLStore) GetScriptState(namespace, key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM script_state WHERE namespace = ? AND key = ?`, namespace, key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to get script state: %w", err)
+	}
+	return value, true, nil
+}
+
+// SetScriptState stores the JSON-encoded value under the key, replacing the previous one.
+func (s *SQLStore) SetScriptState(namespace, key, value string) error {
+	query := `INSERT INTO script_state (namespace, key, value, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(namespace, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`
+	if _, err := s.db.Exec(query, namespace, key, value); err != nil {
+		return fmt.Errorf("failed to set script state: %w", err)
+	}
+	return nil
+}
+
+// DeleteScriptState removes the value stored under the key.
+func (s *SQLStore) DeleteScriptState(namespace, key string) error {
+	if _, err := s.db.Exec(`DELETE FROM script_state WHERE namespace = ? AND key = ?`, namespace, key); err != nil {
+		return fmt.Errorf("failed to delete script state: %w", err)
+	}
+	return nil
+}
+
+// deleteScriptStateNamespace removes all state of a deleted transformation or collector.
+func (s *SQLStore) deleteScriptStateNamespace(namespace string) error {
+	if _, err := s.db.Exec(`DELETE FROM script_state WHERE namespace = ?`, namespace); err != nil {
+		return fmt.Errorf("failed to delete script state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of the objects found by SearchEntities.
+const (
+	SearchApplication    = "application"
+	SearchChannel        = "channel"
+	SearchRoute          = "route"
+	SearchTransformation = "transformation"
+	SearchCollector      = "collector"
+)
+
+// Snippets of search results mark their matches between SnippetMatchStart and SnippetMatchEnd.
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// DefaultSearchLimit is how many results a search returns when it sets no limit.
+const DefaultSearchLimit = 50
+
+// searchSnippetRunes is how much text around the first match the snippets of the LIKE search show.
+const searchSnippetRunes = 60
+
+// searchSource is a table of objects found by the search. The parent, name and content are SQL
+// expressions over the columns of the table; the content holds the rest of the searchable text.
+type searchSource struct {
+	kind, table, parent, name, content string
+}
+
+// searchTags is the tags column of a tagged table as plain words for the search.
+const searchTags = `REPLACE(REPLACE(REPLACE(tags, '[', ''), ']', ''), '"', ' ')`
+
+// searchSources are the tables the search index covers.
+var searchSources = []searchSource{
+	{SearchApplication, "applications", `''`, `name`, `vhost`},
+	{SearchChannel, "channels", `application_id`, `name`, `destination || ' ' || direction || ' ' || connection || ' ' || ` + searchTags},
+	{SearchRoute, "routes", `''`, `name`, `source_channel_id || ' ' || COALESCE(destination_channel_id, '') || ' ' || route_type || ' ' || guard_conditions || ' ' || enrich_url || ' ' || enrich_field || ' ' || resequence_key || ' ' || COALESCE(sample_channel_id, '') || ' ' || wiretap_channel_id || ' ' || ` + searchTags},
+	{SearchTransformation, "transformations", `''`, `name`, `description || ' ' || script || ' ' || ` + searchTags},
+	{SearchCollector, "collectors", `''`, `name`, `schedule || ' ' || script || ' ' || ` + searchTags},
+}
+
+// selectQuery selects the rows of a source in the columns of the search index.
+func (src searchSource) selectQuery() string {
+	return `SELECT '` + src.kind + `', id, ` + src.parent + `, ` + src.name + `, ` + src.content + ` FROM ` + src.table
+}
+
+// SearchResult is an object whose name, settings or script match a search.
+type SearchResult struct {
+	Kind     string // One of the Search* kinds
+	ID       string
+	ParentID string // Application of a channel, empty for the other kinds
+	Name     string
+	Snippet  string // Text around the matches, marked with SnippetMatchStart and SnippetMatchEnd
+}
+
+// fullTextSearch reports whether the store keeps a full-text index of its objects, which SQLite does with
+// FTS5. Other backends search the tables with LIKE.
+func (s *SQLStore) fullTextSearch() bool {
+	_, ok := s.db.dialect.(sqliteDialect)
+	return ok
+}
+
+// migrateSearchIndex creates the full-text index and the triggers keeping it up to date, and rebuilds it
+// so it covers changes of the searched columns between versions.
+func (s *SQLStore) migrateSearchIndex() error {
+	if !s.fullTextSearch() {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin search index migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(kind UNINDEXED, entity_id UNINDEXED, parent_id UNINDEXED, name, content)`); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM search_index`); err != nil {
+		return fmt.Errorf("failed to clear search index: %w", err)
+	}
+	for _, src := range searchSources {
+		insert := `INSERT INTO search_index (kind, entity_id, parent_id, name, content) ` + src.selectQuery()
+		remove := `DELETE FROM search_index WHERE kind = '` + src.kind + `' AND entity_id = OLD.id;`
+		statements := []string{
+			`DROP TRIGGER IF EXISTS search_index_` + src.table + `_insert`,
+			`DROP TRIGGER IF EXISTS search_index_` + src.table + `_update`,
+			`DROP TRIGGER IF EXISTS search_index_` + src.table + `_delete`,
+			`CREATE TRIGGER search_index_` + src.table + `_insert AFTER INSERT ON ` + src.table + ` BEGIN ` +
+				insert + ` WHERE id = NEW.id; END`,
+			`CREATE TRIGGER search_index_` + src.table + `_update AFTER UPDATE ON ` + src.table + ` BEGIN ` +
+				remove + ` ` + insert + ` WHERE id = NEW.id; END`,
+			`CREATE TRIGGER search_index_` + src.table + `_delete AFTER DELETE ON ` + src.table + ` BEGIN ` +
+				remove + ` END`,
+			insert,
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("failed to index %s: %w", src.table, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit search index migration: %w", err)
+	}
+	return nil
+}
+
+// SearchEntities returns the applications, channels, routes, transformations and collectors whose name,
+// settings, script or tags contain every word of the term, best matches first.
+func (s *SQLStore) SearchEntities(term string, limit int) ([]SearchResult, error) {
+	words := strings.Fields(term)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if s.fullTextSearch() {
+		return s.searchIndex(words, limit)
+	}
+	return s.searchTables(words, limit)
+}
+
+// searchIndex runs a search on the full-text index. Every word matches as a prefix, and words with
+// punctuation, such as queue names, as a phrase of their parts.
+func (s *SQLStore) searchIndex(words []string, limit int) ([]SearchResult, error) {
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	query := `SELECT kind, entity_id, parent_id, name, snippet(search_index, -1, char(2), char(3), '…', 16)
+		FROM search_index WHERE search_index MATCH ? ORDER BY rank LIMIT ?`
+	rows, err := s.db.Query(query, strings.Join(terms, " "), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		if err := rows.Scan(&result.Kind, &result.ID, &result.ParentID, &result.Name, &result.Snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.Snippet = strings.TrimSpace(result.Snippet) // Empty columns of the content leave spaces
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// searchTables runs a search with LIKE on the tables of the search sources, for backends without the
+// full-text index.
+func (s *SQLStore) searchTables(words []string, limit int) ([]SearchResult, error) {
+	var results []SearchResult
+	for _, src := range searchSources {
+		text := `LOWER(` + src.name + ` || ' ' || ` + src.content + `)`
+		conditions := make([]string, len(words))
+		args := make([]interface{}, len(words))
+		for i, word := range words {
+			conditions[i] = text + ` LIKE '%' || LOWER(?) || '%'`
+			args[i] = word
+		}
+		query := src.selectQuery() + ` WHERE ` + strings.Join(conditions, ` AND `) + ` ORDER BY ` + src.name + ` LIMIT ?`
+		rows, err := s.db.Query(query, append(args, limit-len(results))...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %w", src.table, err)
+		}
+		for rows.Next() {
+			var result SearchResult
+			var content string
+			if err := rows.Scan(&result.Kind, &result.ID, &result.ParentID, &result.Name, &content); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan search result: %w", err)
+			}
+			result.Snippet = likeSnippet(strings.TrimSpace(content), words[0])
+			results = append(results, result)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// likeSnippet cuts the text around the first match of a word, marked like the snippets of the full-text
+// index.
+func likeSnippet(text, word string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	match := []rune(strings.ToLower(word))
+	at := -1
+	if len(lower) == len(runes) {
+		at = strings.Index(string(lower), string(match))
+	}
+	if at < 0 {
+		if len(runes) > searchSnippetRunes {
+			return string(runes[:searchSnippetRunes]) + "…"
+		}
+		return text
+	}
+	at = len([]rune(string(lower)[:at]))
+	end := at + len(match)
+	from := max(at-searchSnippetRunes/2, 0)
+	to := min(end+searchSnippetRunes/2, len(runes))
+	snippet := string(runes[from:at]) + SnippetMatchStart + string(runes[at:end]) + SnippetMatchEnd + string(runes[end:to])
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
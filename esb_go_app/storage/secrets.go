@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks a column value encrypted with the secrets key. Values without it were stored
+// before encryption was enabled and are encrypted by UseSecretsKey.
+const encryptedPrefix = "enc:v1:"
+
+// secretsKeySize is the size of the AES-256 key, before base64 encoding.
+const secretsKeySize = 32
+
+// ErrSecretsKeyRequired is returned by UseSecretsKey when the database holds encrypted credentials but no
+// key is configured.
+var ErrSecretsKeyRequired = errors.New("the application credentials are encrypted, configure secrets_key or SECRETS_KEY")
+
+// secretBox encrypts the credentials of applications with AES-GCM and hashes their ID tokens with
+// HMAC-SHA256, so they can be looked up without being decrypted.
+type secretBox struct {
+	aead    cipher.AEAD
+	hashKey []byte
+}
+
+// ParseSecretsKey decodes a base64 encoded 32 byte key, such as the output of `openssl rand -base64 32`.
+func ParseSecretsKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("the secrets key is not valid base64: %w", err)
+	}
+	if len(key) != secretsKeySize {
+		return nil, fmt.Errorf("the secrets key must be %d bytes, got %d", secretsKeySize, len(key))
+	}
+	return key, nil
+}
+
+func newSecretBox(key []byte) (*secretBox, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The hash key is derived from the secrets key so it never equals the encryption key.
+	hashKey := hmac.New(sha256.New, key)
+	hashKey.Write([]byte("esb id token"))
+	return &secretBox{aead: aead, hashKey: hashKey.Sum(nil)}, nil
+}
+
+func (b *secretBox) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *secretBox) decrypt(value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt value, the secrets key does not match the one it was encrypted with")
+	}
+	return string(plaintext), nil
+}
+
+func (b *secretBox) hash(token string) string {
+	mac := hmac.New(sha256.New, b.hashKey)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// UseSecretsKey sets the key the client secrets and ID tokens of applications are encrypted with, and
+// encrypts the ones stored before it was set. A nil key keeps them in plain text, which is refused once
+// they have been encrypted.
+func (s *SQLStore) UseSecretsKey(key []byte) error {
+	if key == nil {
+		var encrypted int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM applications WHERE client_secret LIKE ?`, encryptedPrefix+"%").Scan(&encrypted); err != nil {
+			return fmt.Errorf("failed to check application credentials: %w", err)
+		}
+		if encrypted > 0 {
+			return ErrSecretsKeyRequired
+		}
+		s.secrets = nil
+		return nil
+	}
+
+	box, err := newSecretBox(key)
+	if err != nil {
+		return fmt.Errorf("invalid secrets key: %w", err)
+	}
+	s.secrets = box
+	return s.encryptApplicationSecrets()
+}
+
+// encryptApplicationSecrets encrypts the credentials stored in plain text and checks that the ones
+// already encrypted can be decrypted, so a wrong key stops the service at startup.
+func (s *SQLStore) encryptApplicationSecrets() error {
+	rows, err := s.db.Query(`SELECT id, client_secret, id_token, previous_id_token FROM applications`)
+	if err != nil {
+		return fmt.Errorf("failed to read application credentials: %w", err)
+	}
+	type credentials struct{ id, secret, token, previous string }
+	var plain []credentials
+	for rows.Next() {
+		var c credentials
+		if err := rows.Scan(&c.id, &c.secret, &c.token, &c.previous); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan application credentials: %w", err)
+		}
+		if strings.HasPrefix(c.secret, encryptedPrefix) {
+			if _, err := s.secrets.decrypt(c.secret); err != nil {
+				rows.Close()
+				return fmt.Errorf("application %s: %w", c.id, err)
+			}
+			continue
+		}
+		plain = append(plain, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read application credentials: %w", err)
+	}
+
+	for _, c := range plain {
+		secret, token, tokenHash, err := s.sealCredentials(c.secret, c.token)
+		if err != nil {
+			return err
+		}
+		previous, previousHash, err := s.sealToken(c.previous)
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(`UPDATE applications SET client_secret = ?, id_token = ?, id_token_hash = ?, previous_id_token = ?, previous_id_token_hash = ? WHERE id = ?`, secret, token, tokenHash, previous, previousHash, c.id); err != nil {
+			return fmt.Errorf("failed to encrypt credentials of application %s: %w", c.id, err)
+		}
+	}
+	if len(plain) > 0 {
+		s.logger.Info("encrypted application credentials stored in plain text", "count", len(plain))
+	}
+	return nil
+}
+
+// sealCredentials returns the client secret and ID token as they are stored, with the hash the token is
+// looked up by. Without a secrets key they are stored as they are and the hash is empty.
+func (s *SQLStore) sealCredentials(secret, token string) (string, string, string, error) {
+	if s.secrets == nil {
+		return secret, token, "", nil
+	}
+	encSecret, err := s.secrets.encrypt(secret)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to encrypt client secret: %w", err)
+	}
+	encToken, tokenHash, err := s.sealToken(token)
+	if err != nil {
+		return "", "", "", err
+	}
+	return encSecret, encToken, tokenHash, nil
+}
+
+// sealToken returns an ID token as it is stored, with the hash it is looked up by.
+func (s *SQLStore) sealToken(token string) (string, string, error) {
+	if s.secrets == nil || token == "" {
+		return token, "", nil
+	}
+	encToken, err := s.secrets.encrypt(token)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt ID token: %w", err)
+	}
+	return encToken, s.secrets.hash(token), nil
+}
+
+// openSecret decrypts a stored client secret or ID token. Values stored in plain text are returned as
+// they are.
+func (s *SQLStore) openSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if s.secrets == nil {
+		return "", ErrSecretsKeyRequired
+	}
+	return s.secrets.decrypt(value)
+}
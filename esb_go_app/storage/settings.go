@@ -3,10 +3,136 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// SettingType is the type of the value of a setting.
+type SettingType string
+
+const (
+	SettingString   SettingType = "string"
+	SettingBool     SettingType = "bool"
+	SettingInt      SettingType = "int"
+	SettingDuration SettingType = "duration" // Stored in the format of time.Duration, such as "30s"
+)
+
+// SettingDefinition describes a setting: its type, the value used while none is stored and the values
+// it accepts.
+type SettingDefinition struct {
+	Key     string
+	Type    SettingType
+	Default string
+	Options []string // Values accepted by a string setting, any value when empty
+	Min     int64    // Bounds of an int setting, or of a duration setting in nanoseconds, unchecked when both are 0
+	Max     int64
+}
+
+// Normalize checks a value submitted for the setting and returns it as it is stored. An empty value
+// stands for the default.
+func (d SettingDefinition) Normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	switch d.Type {
+	case SettingBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", d.Key)
+		}
+		return strconv.FormatBool(b), nil
+	case SettingInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a whole number", d.Key)
+		}
+		if err := d.checkBounds(n, strconv.FormatInt); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case SettingDuration:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a duration such as 30s or 5m", d.Key)
+		}
+		if err := d.checkBounds(int64(duration), func(n int64, _ int) string { return time.Duration(n).String() }); err != nil {
+			return "", err
+		}
+		return duration.String(), nil
+	default:
+		if len(d.Options) > 0 && !slices.Contains(d.Options, value) {
+			return "", fmt.Errorf("%s must be one of %s", d.Key, strings.Join(d.Options, ", "))
+		}
+		return value, nil
+	}
+}
+
+func (d SettingDefinition) checkBounds(n int64, format func(int64, int) string) error {
+	if d.Min == 0 && d.Max == 0 {
+		return nil
+	}
+	if n < d.Min || n > d.Max {
+		return fmt.Errorf("%s must be between %s and %s", d.Key, format(d.Min, 10), format(d.Max, 10))
+	}
+	return nil
+}
+
+// settingValue returns the stored value of a setting, or its default when none is stored. A stored value
+// the definition no longer accepts is reported and replaced by the default.
+func (s *SQLStore) settingValue(d SettingDefinition) (string, error) {
+	value, err := s.GetSetting(d.Key)
+	if err != nil {
+		return d.Default, err
+	}
+	if value, err = d.Normalize(value); err != nil {
+		return d.Default, err
+	}
+	if value == "" {
+		return d.Default, nil
+	}
+	return value, nil
+}
+
+// GetStringSetting returns the value of a string setting, or its default when none is stored.
+func (s *SQLStore) GetStringSetting(d SettingDefinition) (string, error) {
+	return s.settingValue(d)
+}
+
+// GetBoolSetting returns the value of a bool setting, or its default when none is stored.
+func (s *SQLStore) GetBoolSetting(d SettingDefinition) (bool, error) {
+	value, err := s.settingValue(d)
+	b, _ := strconv.ParseBool(value)
+	return b, err
+}
+
+// GetIntSetting returns the value of an int setting, or its default when none is stored.
+func (s *SQLStore) GetIntSetting(d SettingDefinition) (int, error) {
+	value, err := s.settingValue(d)
+	n, _ := strconv.Atoi(value)
+	return n, err
+}
+
+// GetDurationSetting returns the value of a duration setting, or its default when none is stored.
+func (s *SQLStore) GetDurationSetting(d SettingDefinition) (time.Duration, error) {
+	value, err := s.settingValue(d)
+	duration, _ := time.ParseDuration(value)
+	return duration, err
+}
+
+// SaveSetting checks a value submitted for a setting and stores it. An empty value restores the default.
+func (s *SQLStore) SaveSetting(d SettingDefinition, value string) error {
+	value, err := d.Normalize(value)
+	if err != nil {
+		return err
+	}
+	return s.SetSetting(d.Key, value)
+}
+
 // GetSetting retrieves a setting value by its key.
-func (s *Store) GetSetting(key string) (string, error) {
+func (s *SQLStore) GetSetting(key string) (string, error) {
 	var value string
 	query := `SELECT value FROM settings WHERE key = ?`
 	err := s.db.QueryRow(query, key).Scan(&value)
@@ -20,7 +146,7 @@ func (s *Store) GetSetting(key string) (string, error) {
 }
 
 // SetSetting creates or updates a setting value.
-func (s *Store) SetSetting(key, value string) error {
+func (s *SQLStore) SetSetting(key, value string) error {
 	query := `INSERT INTO settings (key, value) VALUES (?, ?)
 			  ON CONFLICT(key) DO UPDATE SET value = excluded.value`
 	_, err := s.db.Exec(query, key, value)
@@ -29,3 +155,62 @@ func (s *Store) SetSetting(key, value string) error {
 	}
 	return nil
 }
+
+// GetAllSettings returns every stored setting by its key.
+func (s *SQLStore) GetAllSettings() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %w", err)
+		}
+		settings[key] = value.String
+	}
+	return settings, rows.Err()
+}
+
+// Setting keys of the global transformation hooks.
+const (
+	settingPreTransformationHook  = "hook_pre_transformation_id"
+	settingPostTransformationHook = "hook_post_transformation_id"
+)
+
+// TransformationHooks are the transformations the routers run before and after the transformations of
+// every transform route, configured in the admin settings. An empty ID disables the hook.
+type TransformationHooks struct {
+	PreID  string
+	PostID string
+}
+
+// Uses reports whether the transformation is one of the hooks.
+func (h TransformationHooks) Uses(transformationID string) bool {
+	return transformationID != "" && (h.PreID == transformationID || h.PostID == transformationID)
+}
+
+// GetTransformationHooks reads the global transformation hooks.
+func (s *SQLStore) GetTransformationHooks() (TransformationHooks, error) {
+	pre, err := s.GetSetting(settingPreTransformationHook)
+	if err != nil {
+		return TransformationHooks{}, err
+	}
+	post, err := s.GetSetting(settingPostTransformationHook)
+	if err != nil {
+		return TransformationHooks{}, err
+	}
+	return TransformationHooks{PreID: pre, PostID: post}, nil
+}
+
+// SaveTransformationHooks stores the global transformation hooks.
+func (s *SQLStore) SaveTransformationHooks(hooks TransformationHooks) error {
+	if err := s.SetSetting(settingPreTransformationHook, hooks.PreID); err != nil {
+		return err
+	}
+	return s.SetSetting(settingPostTransformationHook, hooks.PostID)
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SQLConnectionDrivers are the database drivers a connection profile can use.
+var SQLConnectionDrivers = []string{"postgres", "sqlserver"}
+
+// sqlConnectionColumns is the column list used by every query that loads full SQLConnection rows.
+const sqlConnectionColumns = `id, name, description, driver, dsn, created_at, updated_at`
+
+// scanSQLConnection scans a row selected with sqlConnectionColumns into an SQLConnection.
+func scanSQLConnection(row rowScanner) (*SQLConnection, error) {
+	c := &SQLConnection{}
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Driver, &c.DSN, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CreateSQLConnection creates a new connection profile in the database.
+func (s *SQLStore) CreateSQLConnection(c *SQLConnection) error {
+	query := `INSERT INTO sql_connections (id, name, description, driver, dsn) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, c.ID, c.Name, c.Description, c.Driver, c.DSN)
+	if err != nil {
+		return fmt.Errorf("failed to create SQL connection: %w", err)
+	}
+	return nil
+}
+
+// GetSQLConnectionByID retrieves a connection profile by its ID.
+func (s *SQLStore) GetSQLConnectionByID(id string) (*SQLConnection, error) {
+	query := `SELECT ` + sqlConnectionColumns + ` FROM sql_connections WHERE id = ?`
+	c, err := scanSQLConnection(s.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get SQL connection by ID: %w", err)
+	}
+	return c, nil
+}
+
+// GetSQLConnectionByName retrieves the connection profile that scripts refer to by name.
+func (s *SQLStore) GetSQLConnectionByName(name string) (*SQLConnection, error) {
+	query := `SELECT ` + sqlConnectionColumns + ` FROM sql_connections WHERE name = ?`
+	c, err := scanSQLConnection(s.db.QueryRow(query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get SQL connection by name: %w", err)
+	}
+	return c, nil
+}
+
+// GetAllSQLConnections retrieves all connection profiles ordered by name.
+func (s *SQLStore) GetAllSQLConnections() ([]SQLConnection, error) {
+	query := `SELECT ` + sqlConnectionColumns + ` FROM sql_connections ORDER BY name`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all SQL connections: %w", err)
+	}
+	defer rows.Close()
+
+	var connections []SQLConnection
+	for rows.Next() {
+		c, err := scanSQLConnection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan SQL connection row: %w", err)
+		}
+		connections = append(connections, *c)
+	}
+	return connections, nil
+}
+
+// UpdateSQLConnection updates an existing connection profile in the database.
+func (s *SQLStore) UpdateSQLConnection(c *SQLConnection) error {
+	query := `UPDATE sql_connections SET name = ?, description = ?, driver = ?, dsn = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := s.db.Exec(query, c.Name, c.Description, c.Driver, c.DSN, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update SQL connection: %w", err)
+	}
+	return nil
+}
+
+// DeleteSQLConnection deletes a connection profile by its ID.
+func (s *SQLStore) DeleteSQLConnection(id string) error {
+	query := `DELETE FROM sql_connections WHERE id = ?`
+	_, err := s.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete SQL connection: %w", err)
+	}
+	return nil
+}
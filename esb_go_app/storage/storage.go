@@ -6,60 +6,112 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	_ "modernc.org/sqlite"
 )
 
-// Store
-type Store struct {
-	db     *sql.DB
-	logger *slog.Logger
+// SQLStore is the Store on a SQL database, SQLite or PostgreSQL.
+type SQLStore struct {
+	db      *database
+	logger  *slog.Logger
+	secrets *secretBox // Encrypts the credentials of applications, nil until UseSecretsKey is given a key
 }
 
 // NewStore
-func NewStore(dbPath string, logger *slog.Logger) (*Store, error) {
+func NewStore(dbPath string, logger *slog.Logger) (*SQLStore, error) {
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath+"?_foreign_keys=on")
+	db, err := sql.Open(DriverSQLite, sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.SetMaxOpenConns(sqliteMaxOpenConns)
+	db.SetMaxIdleConns(sqliteMaxOpenConns)
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	store := &Store{
-		db:     db,
+	store := &SQLStore{
+		db:     &database{DB: db, dialect: sqliteDialect{}},
 		logger: logger,
 	}
 
 	if err := store.migrate(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	// Close and re-open the database connection to ensure schema cache is refreshed
-	if store.db != nil {
-		store.db.Close()
-	}
-	db, err = sql.Open("sqlite", dbPath+"?_foreign_keys=on")
+	logger.Info("database initialized and migrated successfully", "path", dbPath)
+	return store, nil
+}
+
+// sqliteMaxOpenConns bounds the connections to the SQLite database. In WAL mode readers do not block
+// the writer, so the routers and the admin pages read in parallel while writes take turns.
+const sqliteMaxOpenConns = 8
+
+// sqliteBusyTimeout is how long, in milliseconds, a connection waits for another one to release the
+// database before failing with "database is locked".
+const sqliteBusyTimeout = 5000
+
+// sqliteDSN returns the data source name of a SQLite database file. The pragmas run on every connection
+// of the pool: WAL lets reads run alongside a write, busy_timeout makes a write wait for the one in
+// progress, and transactions take the write lock when they begin, since a transaction that reads first
+// and then has to upgrade its lock fails at once instead of waiting.
+func sqliteDSN(dbPath string) string {
+	return dbPath + "?_pragma=journal_mode(WAL)" +
+		"&_pragma=busy_timeout(" + strconv.Itoa(sqliteBusyTimeout) + ")" +
+		"&_pragma=synchronous(NORMAL)" +
+		"&_txlock=immediate"
+}
+
+// NewPostgresStore opens the store on a PostgreSQL database, creating or migrating its schema. The
+// instances sharing the database take turns to migrate it at startup.
+func NewPostgresStore(dsn string, logger *slog.Logger) (*SQLStore, error) {
+	db, err := sql.Open(DriverPostgres, dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to re-open database after migration: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to re-connect to database after migration: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-	store.db = db
 
-	logger.Info("database initialized and migrated successfully", "path", dbPath)
+	store := &SQLStore{
+		db:     &database{DB: db, dialect: postgresDialect{}},
+		logger: logger,
+	}
+
+	// The advisory lock belongs to a session, so the migration runs on a single connection.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`SELECT pg_advisory_lock($1)`, postgresMigrationLock); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to lock database for migration: %w", err)
+	}
+	migrateErr := store.migrate()
+	if _, err := db.Exec(`SELECT pg_advisory_unlock($1)`, postgresMigrationLock); err != nil && migrateErr == nil {
+		migrateErr = fmt.Errorf("failed to unlock database after migration: %w", err)
+	}
+	db.SetMaxOpenConns(0)
+	if migrateErr != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", migrateErr)
+	}
+
+	logger.Info("database initialized and migrated successfully", "driver", DriverPostgres)
 	return store, nil
 }
 
+// postgresMigrationLock is the advisory lock key instances hold while migrating a shared database.
+const postgresMigrationLock = 0x657362676f
+
 // migrate handles database schema setup and evolution.
-func (s *Store) migrate() error {
+func (s *SQLStore) migrate() error {
 	s.logger.Info("checking database schema...")
 
 	// Create tables if they don't exist
@@ -74,16 +126,37 @@ func (s *Store) migrate() error {
 	if err := s.migrateRoutesTable(); err != nil {
 		return fmt.Errorf("failed to migrate routes table: %w", err)
 	}
+	if err := s.migrateApplicationsTable(); err != nil {
+		return fmt.Errorf("failed to migrate applications table: %w", err)
+	}
 	if err := s.migrateChannelsTable(); err != nil {
 		return fmt.Errorf("failed to migrate channels table: %w", err)
 	}
+	if err := s.migrateTransformationsTable(); err != nil {
+		return fmt.Errorf("failed to migrate transformations table: %w", err)
+	}
+	if err := s.migrateTrashTable(); err != nil {
+		return fmt.Errorf("failed to migrate trash table: %w", err)
+	}
+	if err := s.migrateFileServersTable(); err != nil {
+		return fmt.Errorf("failed to migrate file servers table: %w", err)
+	}
+	if err := s.migrateTagsColumns(); err != nil {
+		return err
+	}
+	if err := s.migrateRevisionColumns(); err != nil {
+		return err
+	}
+	if err := s.migrateSearchIndex(); err != nil {
+		return fmt.Errorf("failed to migrate search index: %w", err)
+	}
 
 	s.logger.Info("database schema is up to date.")
 	return nil
 }
 
 // createTablesIfNotExist ensures all necessary tables are created.
-func (s *Store) createTablesIfNotExist() error {
+func (s *SQLStore) createTablesIfNotExist() error {
 	// The order is important due to foreign key constraints
 	tables := []string{
 		`CREATE TABLE IF NOT EXISTS applications (
@@ -91,6 +164,11 @@ func (s *Store) createTablesIfNotExist() error {
 			name TEXT NOT NULL UNIQUE,
 			client_secret TEXT NOT NULL,
 			id_token TEXT NOT NULL,
+			id_token_hash TEXT NOT NULL DEFAULT '',
+			vhost TEXT NOT NULL DEFAULT '',
+			previous_id_token TEXT NOT NULL DEFAULT '',
+			previous_id_token_hash TEXT NOT NULL DEFAULT '',
+			previous_id_token_expires_at DATETIME,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`,
@@ -101,6 +179,14 @@ func (s *Store) createTablesIfNotExist() error {
 			direction TEXT NOT NULL,
 			destination TEXT NOT NULL,
 			fanout_mode BOOLEAN NOT NULL DEFAULT 0,
+			connection TEXT NOT NULL DEFAULT '',
+			max_priority INTEGER NOT NULL DEFAULT 0,
+			silence_alert_minutes INTEGER NOT NULL DEFAULT 0,
+			queue_type TEXT NOT NULL DEFAULT '',
+			message_ttl_seconds INTEGER NOT NULL DEFAULT 0,
+			lazy_mode BOOLEAN NOT NULL DEFAULT 0,
+			tags TEXT NOT NULL DEFAULT '',
+			revision INTEGER NOT NULL DEFAULT 1,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (application_id) REFERENCES applications(id) ON DELETE CASCADE,
 			UNIQUE(application_id, name)
@@ -108,11 +194,57 @@ func (s *Store) createTablesIfNotExist() error {
 		`CREATE TABLE IF NOT EXISTS transformations (
 			id TEXT PRIMARY KEY,
 			name TEXT NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
 			engine TEXT NOT NULL,
 			script TEXT NOT NULL,
+			tests TEXT NOT NULL DEFAULT '',
+			samples TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			revision INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS script_libraries (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			engine TEXT NOT NULL,
+			script TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(engine, name)
+		);`,
+		`CREATE TABLE IF NOT EXISTS sql_connections (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			driver TEXT NOT NULL,
+			dsn TEXT NOT NULL,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`,
+		`CREATE TABLE IF NOT EXISTS file_servers (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			protocol TEXT NOT NULL,
+			host TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			password TEXT NOT NULL DEFAULT '',
+			private_key TEXT NOT NULL DEFAULT '',
+			host_key TEXT NOT NULL DEFAULT '',
+			skip_host_key_verify BOOLEAN NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS script_state (
+			namespace TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (namespace, key)
+		);`,
 		`CREATE TABLE IF NOT EXISTS integrations (
 			id TEXT PRIMARY KEY,
 			name TEXT NOT NULL UNIQUE,
@@ -127,6 +259,7 @@ func (s *Store) createTablesIfNotExist() error {
 			engine TEXT NOT NULL,
 			script TEXT NOT NULL,
 			integration_id TEXT,
+			tags TEXT NOT NULL DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (integration_id) REFERENCES integrations(id) ON DELETE SET NULL
@@ -139,16 +272,182 @@ func (s *Store) createTablesIfNotExist() error {
 			route_type TEXT NOT NULL DEFAULT 'direct',
 			transformation_id TEXT,
 			integration_id TEXT,
+			guard_conditions TEXT NOT NULL DEFAULT '',
+			guard_mismatch_action TEXT NOT NULL DEFAULT 'skip',
+			delay_seconds INTEGER NOT NULL DEFAULT 0,
+			priority INTEGER NOT NULL DEFAULT 0,
+			canonicalize_json BOOLEAN NOT NULL DEFAULT 0,
+			retry_max_attempts INTEGER NOT NULL DEFAULT 0,
+			retry_backoff_seconds INTEGER NOT NULL DEFAULT 5,
+			batch_size INTEGER NOT NULL DEFAULT 0,
+			concurrency INTEGER NOT NULL DEFAULT 0,
+			rate_limit INTEGER NOT NULL DEFAULT 0,
+			sample_rate INTEGER DEFAULT 0,
+			sample_channel_id TEXT DEFAULT '',
+			enrich_url TEXT NOT NULL DEFAULT '',
+			enrich_merge TEXT NOT NULL DEFAULT 'shallow',
+			enrich_field TEXT NOT NULL DEFAULT '',
+			transformation_pipeline TEXT NOT NULL DEFAULT '',
+			active_window TEXT NOT NULL DEFAULT '',
+			request_reply BOOLEAN NOT NULL DEFAULT 0,
+			reply_timeout_seconds INTEGER NOT NULL DEFAULT 30,
+			wiretap_channel_id TEXT NOT NULL DEFAULT '',
+			wiretap_stage TEXT NOT NULL DEFAULT 'post',
+			resequence_key TEXT NOT NULL DEFAULT '',
+			resequence_window_seconds INTEGER NOT NULL DEFAULT 10,
+			disabled BOOLEAN NOT NULL DEFAULT 0,
+			archive BOOLEAN NOT NULL DEFAULT 0,
+			dead_letter_store TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			revision INTEGER NOT NULL DEFAULT 1,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (source_channel_id) REFERENCES channels(id) ON DELETE CASCADE,
 			FOREIGN KEY (destination_channel_id) REFERENCES channels(id) ON DELETE SET NULL,
 			FOREIGN KEY (transformation_id) REFERENCES transformations(id) ON DELETE SET NULL,
 			FOREIGN KEY (integration_id) REFERENCES integrations(id) ON DELETE SET NULL
 		);`,
+		`CREATE TABLE IF NOT EXISTS routing_rules (
+			id TEXT PRIMARY KEY,
+			route_id TEXT NOT NULL,
+			position INTEGER NOT NULL DEFAULT 0,
+			field TEXT NOT NULL,
+			operator TEXT NOT NULL,
+			value TEXT NOT NULL DEFAULT '',
+			destination_channel_id TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (route_id) REFERENCES routes(id) ON DELETE CASCADE,
+			FOREIGN KEY (destination_channel_id) REFERENCES channels(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS route_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			route_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			snapshot TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (route_id) REFERENCES routes(id) ON DELETE CASCADE,
+			UNIQUE(route_id, version)
+		);`,
+		`CREATE TABLE IF NOT EXISTS transformation_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			transformation_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			snapshot TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (transformation_id) REFERENCES transformations(id) ON DELETE CASCADE,
+			UNIQUE(transformation_id, version)
+		);`,
+		`CREATE TABLE IF NOT EXISTS trash (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			entity_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			snapshot TEXT NOT NULL,
+			released TEXT NOT NULL DEFAULT '',
+			deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
 		`CREATE TABLE IF NOT EXISTS settings (
 			key TEXT PRIMARY KEY,
 			value TEXT
 		);`,
+		`CREATE TABLE IF NOT EXISTS trace_hops (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			trace_id TEXT NOT NULL,
+			stage TEXT NOT NULL,
+			route_id TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL DEFAULT '',
+			destination TEXT NOT NULL DEFAULT '',
+			message_id TEXT NOT NULL DEFAULT '',
+			transformations TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_trace_hops_trace_id ON trace_hops (trace_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_trace_hops_message_id ON trace_hops (message_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_trace_hops_created_at ON trace_hops (created_at);`,
+		`CREATE TABLE IF NOT EXISTS script_executions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			transformation_id TEXT NOT NULL,
+			route_id TEXT NOT NULL DEFAULT '',
+			route_name TEXT NOT NULL DEFAULT '',
+			message_id TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			success BOOLEAN NOT NULL DEFAULT 1,
+			error TEXT NOT NULL DEFAULT '',
+			input TEXT NOT NULL DEFAULT '',
+			output TEXT NOT NULL DEFAULT '',
+			executed_at DATETIME NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_script_executions_transformation_id ON script_executions (transformation_id, id);`,
+		`CREATE TABLE IF NOT EXISTS collector_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			collector_id TEXT NOT NULL,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME NOT NULL,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			messages INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_collector_runs_collector_id ON collector_runs (collector_id, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_collector_runs_finished_at ON collector_runs (finished_at);`,
+		`CREATE TABLE IF NOT EXISTS message_archive (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			route_id TEXT NOT NULL,
+			route_name TEXT NOT NULL DEFAULT '',
+			message_id TEXT NOT NULL DEFAULT '',
+			trace_id TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL DEFAULT '',
+			destination TEXT NOT NULL DEFAULT '',
+			outcome TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			headers TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL DEFAULT '',
+			output_body TEXT NOT NULL DEFAULT '',
+			received_at DATETIME NOT NULL,
+			processed_at DATETIME NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_archive_route_id ON message_archive (route_id, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_archive_message_id ON message_archive (message_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_archive_trace_id ON message_archive (trace_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_archive_processed_at ON message_archive (processed_at);`,
+		`CREATE TABLE IF NOT EXISTS dead_letters (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			route_id TEXT NOT NULL,
+			route_name TEXT NOT NULL DEFAULT '',
+			message_id TEXT NOT NULL DEFAULT '',
+			trace_id TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			headers TEXT NOT NULL DEFAULT '',
+			content_type TEXT NOT NULL DEFAULT '',
+			correlation_id TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_dead_letters_route_id ON dead_letters (route_id, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_dead_letters_message_id ON dead_letters (message_id);`,
+		`CREATE TABLE IF NOT EXISTS route_stats (
+			route_id TEXT PRIMARY KEY,
+			routed INTEGER NOT NULL DEFAULT 0,
+			filtered INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			last_message_at DATETIME NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor TEXT NOT NULL DEFAULT '',
+			remote_addr TEXT NOT NULL DEFAULT '',
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			kind TEXT NOT NULL DEFAULT '',
+			entity_id TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL DEFAULT '',
+			status INTEGER NOT NULL DEFAULT 0,
+			old_value TEXT NOT NULL DEFAULT '',
+			new_value TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_kind ON audit_log (kind, entity_id, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);`,
 	}
 
 	for _, tableSQL := range tables {
@@ -165,15 +464,78 @@ func (s *Store) createTablesIfNotExist() error {
 	return nil
 }
 
-// migrateChannelsTable handles adding the fanout_mode column to the `channels` table.
-func (s *Store) migrateChannelsTable() error {
-	rows, err := s.db.Query(`PRAGMA table_info(channels);`)
+// migrateApplicationsTable handles adding the vhost, id_token_hash and previous ID token columns to the `applications` table.
+func (s *SQLStore) migrateApplicationsTable() error {
+	rows, err := s.db.Query(s.db.dialect.tableInfoQuery("applications"))
+	if err != nil {
+		return nil // Table might not exist on a fresh DB, which is fine.
+	}
+	defer rows.Close()
+
+	var hasVHost, hasIDTokenHash, hasPreviousIDToken bool
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, rtype string
+		var dfltValue interface{}
+		if err := rows.Scan(&cid, &name, &rtype, &notnull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table_info for applications: %w", err)
+		}
+		if name == "vhost" {
+			hasVHost = true
+		}
+		if name == "id_token_hash" {
+			hasIDTokenHash = true
+		}
+		if name == "previous_id_token" {
+			hasPreviousIDToken = true
+		}
+	}
+
+	if !hasVHost {
+		s.logger.Info("migrating 'applications' table: adding vhost column...")
+		if _, err := s.db.Exec(`ALTER TABLE applications ADD COLUMN vhost TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add vhost to applications table: %w", err)
+		}
+		s.logger.Info("'applications' table migrated successfully (vhost).")
+	}
+	if !hasIDTokenHash {
+		s.logger.Info("migrating 'applications' table: adding id_token_hash column...")
+		if _, err := s.db.Exec(`ALTER TABLE applications ADD COLUMN id_token_hash TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add id_token_hash to applications table: %w", err)
+		}
+		s.logger.Info("'applications' table migrated successfully (id_token_hash).")
+	}
+	if !hasPreviousIDToken {
+		s.logger.Info("migrating 'applications' table: adding previous ID token columns...")
+		for _, column := range []string{
+			`previous_id_token TEXT NOT NULL DEFAULT ''`,
+			`previous_id_token_hash TEXT NOT NULL DEFAULT ''`,
+			`previous_id_token_expires_at DATETIME`,
+		} {
+			if _, err := s.db.Exec(`ALTER TABLE applications ADD COLUMN ` + column); err != nil {
+				return fmt.Errorf("failed to add previous ID token columns to applications table: %w", err)
+			}
+		}
+		s.logger.Info("'applications' table migrated successfully (previous ID token).")
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_applications_id_token_hash ON applications (id_token_hash)`); err != nil {
+		return fmt.Errorf("failed to index id_token_hash of applications table: %w", err)
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_applications_previous_id_token_hash ON applications (previous_id_token_hash)`); err != nil {
+		return fmt.Errorf("failed to index previous_id_token_hash of applications table: %w", err)
+	}
+	return nil
+}
+
+// migrateChannelsTable handles adding the fanout_mode, connection, max_priority, silence_alert_minutes, queue_type, message_ttl_seconds and lazy_mode columns to the `channels` table.
+func (s *SQLStore) migrateChannelsTable() error {
+	rows, err := s.db.Query(s.db.dialect.tableInfoQuery("channels"))
 	if err != nil {
 		return nil // Table might not exist on a fresh DB, which is fine.
 	}
 	defer rows.Close()
 
-	var hasFanoutMode bool
+	var hasFanoutMode, hasConnection, hasMaxPriority, hasSilenceAlert, hasQueueType, hasMessageTTL, hasLazyMode bool
 	for rows.Next() {
 		var cid, notnull, pk int
 		var name, rtype string
@@ -181,9 +543,21 @@ func (s *Store) migrateChannelsTable() error {
 		if err := rows.Scan(&cid, &name, &rtype, &notnull, &dfltValue, &pk); err != nil {
 			return fmt.Errorf("failed to scan table_info for channels: %w", err)
 		}
-		if name == "fanout_mode" {
+		switch name {
+		case "fanout_mode":
 			hasFanoutMode = true
-			break
+		case "connection":
+			hasConnection = true
+		case "max_priority":
+			hasMaxPriority = true
+		case "silence_alert_minutes":
+			hasSilenceAlert = true
+		case "queue_type":
+			hasQueueType = true
+		case "message_ttl_seconds":
+			hasMessageTTL = true
+		case "lazy_mode":
+			hasLazyMode = true
 		}
 	}
 
@@ -195,14 +569,95 @@ func (s *Store) migrateChannelsTable() error {
 		s.logger.Info("'channels' table migrated successfully (fanout_mode).")
 	}
 
+	if !hasConnection {
+		s.logger.Info("migrating 'channels' table: adding connection column...")
+		if _, err := s.db.Exec(`ALTER TABLE channels ADD COLUMN connection TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add connection to channels table: %w", err)
+		}
+		s.logger.Info("'channels' table migrated successfully (connection).")
+	}
+
+	if !hasMaxPriority {
+		s.logger.Info("migrating 'channels' table: adding max_priority column...")
+		if _, err := s.db.Exec(`ALTER TABLE channels ADD COLUMN max_priority INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add max_priority to channels table: %w", err)
+		}
+		s.logger.Info("'channels' table migrated successfully (max_priority).")
+	}
+
+	if !hasSilenceAlert {
+		s.logger.Info("migrating 'channels' table: adding silence_alert_minutes column...")
+		if _, err := s.db.Exec(`ALTER TABLE channels ADD COLUMN silence_alert_minutes INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add silence_alert_minutes to channels table: %w", err)
+		}
+		s.logger.Info("'channels' table migrated successfully (silence_alert_minutes).")
+	}
+
+	if !hasQueueType {
+		s.logger.Info("migrating 'channels' table: adding queue_type column...")
+		if _, err := s.db.Exec(`ALTER TABLE channels ADD COLUMN queue_type TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add queue_type to channels table: %w", err)
+		}
+		s.logger.Info("'channels' table migrated successfully (queue_type).")
+	}
+
+	if !hasMessageTTL {
+		s.logger.Info("migrating 'channels' table: adding message_ttl_seconds column...")
+		if _, err := s.db.Exec(`ALTER TABLE channels ADD COLUMN message_ttl_seconds INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add message_ttl_seconds to channels table: %w", err)
+		}
+		s.logger.Info("'channels' table migrated successfully (message_ttl_seconds).")
+	}
+
+	if !hasLazyMode {
+		s.logger.Info("migrating 'channels' table: adding lazy_mode column...")
+		if _, err := s.db.Exec(`ALTER TABLE channels ADD COLUMN lazy_mode BOOLEAN NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add lazy_mode to channels table: %w", err)
+		}
+		s.logger.Info("'channels' table migrated successfully (lazy_mode).")
+	}
+
 	return nil
 }
 
 
+// migrateTransformationsTable handles adding the description, tests and samples columns to the `transformations` table.
+func (s *SQLStore) migrateTransformationsTable() error {
+	rows, err := s.db.Query(s.db.dialect.tableInfoQuery("transformations"))
+	if err != nil {
+		return nil // Table might not exist on a fresh DB, which is fine.
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, rtype string
+		var dfltValue interface{}
+		if err := rows.Scan(&cid, &name, &rtype, &notnull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table_info for transformations: %w", err)
+		}
+		columns[name] = true
+	}
+
+	for _, column := range []string{"description", "tests", "samples"} {
+		if columns[column] {
+			continue
+		}
+		s.logger.Info("migrating 'transformations' table: adding " + column + " column...")
+		if _, err := s.db.Exec(`ALTER TABLE transformations ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add %s to transformations table: %w", column, err)
+		}
+		s.logger.Info("'transformations' table migrated successfully (" + column + ").")
+	}
+
+	return nil
+}
+
 // migrateCollectorsTable handles the migration for the 'collectors' table.
 // It transitions from the old schema with `destination_channel_id` to the new one without it.
-func (s *Store) migrateCollectorsTable() error {
-	rows, err := s.db.Query(`PRAGMA table_info(collectors);`)
+func (s *SQLStore) migrateCollectorsTable() error {
+	rows, err := s.db.Query(s.db.dialect.tableInfoQuery("collectors"))
 	if err != nil {
 		// This can happen on a fresh DB, which is fine.
 		return nil
@@ -272,8 +727,8 @@ func (s *Store) migrateCollectorsTable() error {
 }
 
 // migrateRoutesTable handles adding new columns to the `routes` table if they are missing.
-func (s *Store) migrateRoutesTable() error {
-	rows, err := s.db.Query(`PRAGMA table_info(routes);`)
+func (s *SQLStore) migrateRoutesTable() error {
+	rows, err := s.db.Query(s.db.dialect.tableInfoQuery("routes"))
 	if err != nil {
 		// Table might not exist on a fresh DB, which is fine.
 		return nil
@@ -281,6 +736,7 @@ func (s *Store) migrateRoutesTable() error {
 	defer rows.Close()
 
 	var hasName, hasSourceChannelID, hasDestinationChannelID, hasRouteType, hasTransformationID, hasIntegrationID, hasCreatedAt bool
+	var hasGuardConditions, hasGuardMismatchAction, hasDelaySeconds, hasPriority, hasCanonicalizeJSON, hasRetryMaxAttempts, hasRetryBackoffSeconds, hasBatchSize, hasConcurrency, hasRateLimit, hasSampleRate, hasSampleChannelID, hasEnrichURL, hasEnrichMerge, hasEnrichField, hasPipeline, hasActiveWindow, hasRequestReply, hasReplyTimeoutSeconds, hasWiretapChannelID, hasWiretapStage, hasResequenceKey, hasResequenceSeconds, hasDisabled, hasArchive, hasDeadLetterStore bool
 	for rows.Next() {
 		var cid, notnull, pk int
 		var name, rtype string
@@ -303,6 +759,58 @@ func (s *Store) migrateRoutesTable() error {
 			hasIntegrationID = true
 		case "created_at":
 			hasCreatedAt = true
+		case "guard_conditions":
+			hasGuardConditions = true
+		case "guard_mismatch_action":
+			hasGuardMismatchAction = true
+		case "delay_seconds":
+			hasDelaySeconds = true
+		case "priority":
+			hasPriority = true
+		case "canonicalize_json":
+			hasCanonicalizeJSON = true
+		case "retry_max_attempts":
+			hasRetryMaxAttempts = true
+		case "retry_backoff_seconds":
+			hasRetryBackoffSeconds = true
+		case "batch_size":
+			hasBatchSize = true
+		case "concurrency":
+			hasConcurrency = true
+		case "rate_limit":
+			hasRateLimit = true
+		case "sample_rate":
+			hasSampleRate = true
+		case "sample_channel_id":
+			hasSampleChannelID = true
+		case "enrich_url":
+			hasEnrichURL = true
+		case "enrich_merge":
+			hasEnrichMerge = true
+		case "enrich_field":
+			hasEnrichField = true
+		case "transformation_pipeline":
+			hasPipeline = true
+		case "active_window":
+			hasActiveWindow = true
+		case "request_reply":
+			hasRequestReply = true
+		case "reply_timeout_seconds":
+			hasReplyTimeoutSeconds = true
+		case "wiretap_channel_id":
+			hasWiretapChannelID = true
+		case "wiretap_stage":
+			hasWiretapStage = true
+		case "resequence_key":
+			hasResequenceKey = true
+		case "resequence_window_seconds":
+			hasResequenceSeconds = true
+		case "disabled":
+			hasDisabled = true
+		case "archive":
+			hasArchive = true
+		case "dead_letter_store":
+			hasDeadLetterStore = true
 		}
 	}
 
@@ -362,10 +870,218 @@ func (s *Store) migrateRoutesTable() error {
 		s.logger.Info("'routes' table migrated successfully (created_at).")
 	}
 
+	if !hasGuardConditions {
+		s.logger.Info("migrating 'routes' table: adding guard_conditions column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN guard_conditions TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add guard_conditions to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (guard_conditions).")
+	}
+
+	if !hasGuardMismatchAction {
+		s.logger.Info("migrating 'routes' table: adding guard_mismatch_action column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN guard_mismatch_action TEXT NOT NULL DEFAULT 'skip'`); err != nil {
+			return fmt.Errorf("failed to add guard_mismatch_action to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (guard_mismatch_action).")
+	}
+
+	if !hasDelaySeconds {
+		s.logger.Info("migrating 'routes' table: adding delay_seconds column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN delay_seconds INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add delay_seconds to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (delay_seconds).")
+	}
+
+	if !hasPriority {
+		s.logger.Info("migrating 'routes' table: adding priority column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN priority INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add priority to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (priority).")
+	}
+
+	if !hasCanonicalizeJSON {
+		s.logger.Info("migrating 'routes' table: adding canonicalize_json column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN canonicalize_json BOOLEAN NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add canonicalize_json to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (canonicalize_json).")
+	}
+
+	if !hasRetryMaxAttempts {
+		s.logger.Info("migrating 'routes' table: adding retry_max_attempts column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN retry_max_attempts INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add retry_max_attempts to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (retry_max_attempts).")
+	}
+
+	if !hasRetryBackoffSeconds {
+		s.logger.Info("migrating 'routes' table: adding retry_backoff_seconds column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN retry_backoff_seconds INTEGER NOT NULL DEFAULT 5`); err != nil {
+			return fmt.Errorf("failed to add retry_backoff_seconds to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (retry_backoff_seconds).")
+	}
+
+	if !hasBatchSize {
+		s.logger.Info("migrating 'routes' table: adding batch_size column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN batch_size INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add batch_size to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (batch_size).")
+	}
+
+	if !hasConcurrency {
+		s.logger.Info("migrating 'routes' table: adding concurrency column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN concurrency INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add concurrency to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (concurrency).")
+	}
+
+	if !hasRateLimit {
+		s.logger.Info("migrating 'routes' table: adding rate_limit column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN rate_limit INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add rate_limit to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (rate_limit).")
+	}
+
+	if !hasSampleRate {
+		s.logger.Info("migrating 'routes' table: adding sample_rate column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN sample_rate INTEGER DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add sample_rate to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (sample_rate).")
+	}
+
+	if !hasSampleChannelID {
+		s.logger.Info("migrating 'routes' table: adding sample_channel_id column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN sample_channel_id TEXT DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add sample_channel_id to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (sample_channel_id).")
+	}
+
+	if !hasEnrichURL {
+		s.logger.Info("migrating 'routes' table: adding enrich_url column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN enrich_url TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add enrich_url to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (enrich_url).")
+	}
+
+	if !hasEnrichMerge {
+		s.logger.Info("migrating 'routes' table: adding enrich_merge column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN enrich_merge TEXT NOT NULL DEFAULT 'shallow'`); err != nil {
+			return fmt.Errorf("failed to add enrich_merge to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (enrich_merge).")
+	}
+
+	if !hasEnrichField {
+		s.logger.Info("migrating 'routes' table: adding enrich_field column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN enrich_field TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add enrich_field to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (enrich_field).")
+	}
+
+	if !hasPipeline {
+		s.logger.Info("migrating 'routes' table: adding transformation_pipeline column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN transformation_pipeline TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add transformation_pipeline to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (transformation_pipeline).")
+	}
+
+	if !hasActiveWindow {
+		s.logger.Info("migrating 'routes' table: adding active_window column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN active_window TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add active_window to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (active_window).")
+	}
+
+	if !hasRequestReply {
+		s.logger.Info("migrating 'routes' table: adding request_reply column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN request_reply BOOLEAN NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add request_reply to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (request_reply).")
+	}
+
+	if !hasReplyTimeoutSeconds {
+		s.logger.Info("migrating 'routes' table: adding reply_timeout_seconds column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN reply_timeout_seconds INTEGER NOT NULL DEFAULT 30`); err != nil {
+			return fmt.Errorf("failed to add reply_timeout_seconds to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (reply_timeout_seconds).")
+	}
+
+	if !hasWiretapChannelID {
+		s.logger.Info("migrating 'routes' table: adding wiretap_channel_id column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN wiretap_channel_id TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add wiretap_channel_id to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (wiretap_channel_id).")
+	}
+
+	if !hasWiretapStage {
+		s.logger.Info("migrating 'routes' table: adding wiretap_stage column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN wiretap_stage TEXT NOT NULL DEFAULT 'post'`); err != nil {
+			return fmt.Errorf("failed to add wiretap_stage to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (wiretap_stage).")
+	}
+
+	if !hasResequenceKey {
+		s.logger.Info("migrating 'routes' table: adding resequence_key column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN resequence_key TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add resequence_key to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (resequence_key).")
+	}
+
+	if !hasResequenceSeconds {
+		s.logger.Info("migrating 'routes' table: adding resequence_window_seconds column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN resequence_window_seconds INTEGER NOT NULL DEFAULT 10`); err != nil {
+			return fmt.Errorf("failed to add resequence_window_seconds to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (resequence_window_seconds).")
+	}
+
+	if !hasDisabled {
+		s.logger.Info("migrating 'routes' table: adding disabled column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add disabled to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (disabled).")
+	}
+
+	if !hasArchive {
+		s.logger.Info("migrating 'routes' table: adding archive column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN archive BOOLEAN NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("failed to add archive to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (archive).")
+	}
+
+	if !hasDeadLetterStore {
+		s.logger.Info("migrating 'routes' table: adding dead_letter_store column...")
+		if _, err := s.db.Exec(`ALTER TABLE routes ADD COLUMN dead_letter_store TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add dead_letter_store to routes table: %w", err)
+		}
+		s.logger.Info("'routes' table migrated successfully (dead_letter_store).")
+	}
+
 	return nil
 }
 
 // Close
-func (s *Store) Close() error {
+func (s *SQLStore) Close() error {
 	return s.db.Close()
 }
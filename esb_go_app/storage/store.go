@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Store is the storage of the configuration and state of the service. SQLStore implements it on SQLite,
+// for a single instance, and on PostgreSQL, for several instances sharing one database; both run the same
+// queries, adapted to the backend by its dialect.
+type Store interface {
+	// The database itself, its backups and the key its secrets are encrypted with.
+	Close() error
+	SupportsBackup() bool
+	Backup(ctx context.Context, path string) error
+	Restore(ctx context.Context, path string) error
+	UseSecretsKey(key []byte) error
+
+	// Applications and their channels.
+	CreateApplication(app *Application) error
+	GetApplicationByName(name string) (*Application, error)
+	GetApplicationByID(id string) (*Application, error)
+	GetApplicationByIDToken(token string) (*Application, error)
+	GetAllApplications(filter ListFilter) ([]Application, error)
+	UpdateApplication(app *Application) error
+	RotateApplicationCredentials(id, secret, token string, grace time.Duration) error
+	DeleteApplication(id string) error
+	CreateChannel(ch *Channel) error
+	UpdateChannel(ch *Channel) error
+	GetChannelsByAppID(appID string) ([]Channel, error)
+	GetAllChannels(filter ListFilter) ([]Channel, error)
+	GetChannelByID(id string) (*Channel, error)
+	GetChannelsByName(name string) ([]Channel, error)
+	FindChannel(identifier string) (*Channel, error)
+	DeleteChannel(id string) ([]RouteDependent, error)
+	DeleteOrphanedChannels() (int64, error)
+	GetAllRoutableChannels(direction string) ([]ChannelInfo, error)
+	ValidateChannel(ch *Channel) error
+
+	// Transformations and script libraries, with their versions.
+	CreateTransformation(t *Transformation) error
+	GetTransformationByID(id string) (*Transformation, error)
+	GetTransformationByName(name string) (*Transformation, error)
+	GetAllTransformations() ([]Transformation, error)
+	UpdateTransformation(t *Transformation) error
+	DeleteTransformation(id string) ([]RouteDependent, error)
+	GetTransformationVersions(transformationID string) ([]TransformationVersion, error)
+	GetTransformationVersion(transformationID string, id int64) (*TransformationVersion, error)
+	CreateScriptLibrary(l *ScriptLibrary) error
+	GetScriptLibraryByID(id string) (*ScriptLibrary, error)
+	GetScriptLibraryByName(engine, name string) (*ScriptLibrary, error)
+	GetAllScriptLibraries() ([]ScriptLibrary, error)
+	UpdateScriptLibrary(l *ScriptLibrary) error
+	DeleteScriptLibrary(id string) error
+
+	// Routes, their routing rules and versions, and their statistics.
+	CreateRoute(route *Route) error
+	UpdateRoute(route *Route) error
+	DeleteRoute(id string) error
+	BuildRouteInfo(route Route) (RouteInfo, error)
+	GetAllRoutes(filter ListFilter) ([]RouteInfo, error)
+	GetRoutesByIntegrationID(integrationID string) ([]RouteInfo, error)
+	GetRouteByID(id string) (*Route, error)
+	GetAllRouteSources() ([]RouteSource, error)
+	GetRoutingRules(routeID string) ([]RoutingRule, error)
+	CreateRoutingRule(rule *RoutingRule) error
+	DeleteRoutingRule(routeID, id string) error
+	GetRouteVersions(routeID string) ([]RouteVersion, error)
+	GetRouteVersion(routeID string, id int64) (*RouteVersion, error)
+	AddRouteStats(stats []RouteStats) error
+	GetAllRouteStats() (map[string]RouteStats, error)
+
+	// Integrations and the collectors feeding them.
+	CreateIntegration(i *Integration) error
+	GetIntegrationByID(id string) (*Integration, error)
+	GetAllIntegrations() ([]Integration, error)
+	UpdateIntegration(i *Integration) error
+	DeleteIntegration(id string) error
+	CreateCollector(c *Collector) error
+	GetCollectorByID(id string) (*Collector, error)
+	GetCollectorsByIntegrationID(integrationID string) ([]Collector, error)
+	GetCollectorByName(name string) (*Collector, error)
+	GetAllCollectors() ([]Collector, error)
+	UpdateCollector(c *Collector) error
+	DeleteCollector(id string) error
+	RecordCollectorRun(run *CollectorRun, keep int) error
+	GetCollectorRuns(collectorID string, limit int) ([]CollectorRun, error)
+	GetFailedCollectorRuns(limit int) ([]CollectorRun, error)
+
+	// Resources of the scripts: file servers, SQL connections, mail settings and script state.
+	CreateFileServer(f *FileServer) error
+	GetFileServerByID(id string) (*FileServer, error)
+	GetFileServerByName(name string) (*FileServer, error)
+	GetAllFileServers() ([]FileServer, error)
+	UpdateFileServer(f *FileServer) error
+	DeleteFileServer(id string) error
+	CreateSQLConnection(c *SQLConnection) error
+	GetSQLConnectionByID(id string) (*SQLConnection, error)
+	GetSQLConnectionByName(name string) (*SQLConnection, error)
+	GetAllSQLConnections() ([]SQLConnection, error)
+	UpdateSQLConnection(c *SQLConnection) error
+	DeleteSQLConnection(id string) error
+	GetMailSettings() (*MailSettings, error)
+	SaveMailSettings(settings *MailSettings) error
+	GetScriptState(namespace, key string) (string, bool, error)
+	SetScriptState(namespace, key, value string) error
+	DeleteScriptState(namespace, key string) error
+	RecordScriptExecution(exec *ScriptExecution, keep int) error
+	GetScriptExecutions(transformationID string, limit int) ([]ScriptExecution, error)
+
+	// Messages kept after routing: dead letters, archive and traces.
+	StoreDeadLetter(msg *DeadLetter) error
+	SearchDeadLetters(search DeadLetterSearch) ([]DeadLetter, error)
+	CountDeadLetters(routeID string) (int, error)
+	GetDeadLetter(id int64) (*DeadLetter, error)
+	DeleteDeadLetter(id int64) error
+	ArchiveMessage(msg *ArchivedMessage) error
+	SearchArchive(search ArchiveSearch) ([]ArchivedMessage, error)
+	GetArchivedMessage(id int64) (*ArchivedMessage, error)
+	PruneArchive(before time.Time) (int64, error)
+	CreateTraceHop(hop *TraceHop) error
+	SearchTraceHops(term string) ([]TraceHop, error)
+	GetRecentTraces(limit int) ([]TraceSummary, error)
+	PruneTraceHops(before time.Time) (int64, error)
+
+	// Audit log, trash and settings.
+	RecordAudit(entry *AuditEntry) error
+	SearchAudit(search AuditSearch) ([]AuditEntry, error)
+	GetAuditEntry(id int64) (*AuditEntry, error)
+	GetAuditActors() ([]string, error)
+	GetTrash() ([]TrashItem, error)
+	GetTrashItem(id int64) (*TrashItem, error)
+	RestoreTrashItem(item *TrashItem) ([]RouteDependent, error)
+	PurgeTrashItem(item *TrashItem) error
+	PruneTrash(before time.Time) (int64, error)
+	GetStringSetting(d SettingDefinition) (string, error)
+	GetBoolSetting(d SettingDefinition) (bool, error)
+	GetIntSetting(d SettingDefinition) (int, error)
+	GetDurationSetting(d SettingDefinition) (time.Duration, error)
+	SaveSetting(d SettingDefinition, value string) error
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+	GetAllSettings() (map[string]string, error)
+	GetTransformationHooks() (TransformationHooks, error)
+	SaveTransformationHooks(hooks TransformationHooks) error
+
+	// Search, tags, the checks across entities and housekeeping.
+	SearchEntities(term string, limit int) ([]SearchResult, error)
+	GetTags(kind string) ([]string, error)
+	ChannelDependents(channelID string) ([]RouteDependent, error)
+	TransformationDependents(transformationID string) ([]RouteDependent, error)
+	FindIntegrityIssues() ([]IntegrityIssue, error)
+	FixMissingChannel(id string) ([]RouteDependent, error)
+	FixMissingTransformation(id string) ([]RouteDependent, error)
+	ClearMissingIntegration(collectorID string) error
+	Housekeep(policy RetentionPolicy, now time.Time) (HousekeepingResult, error)
+	PruneAuditLog(before time.Time) (int64, error)
+	PruneCollectorRuns(before time.Time) (int64, error)
+}
+
+var _ Store = (*SQLStore)(nil)
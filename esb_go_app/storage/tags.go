@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// taggedTables are the tables of the objects that can be tagged, keyed by the kind of the object.
+var taggedTables = map[string]string{
+	SearchChannel:        "channels",
+	SearchRoute:          "routes",
+	SearchTransformation: "transformations",
+	SearchCollector:      "collectors",
+}
+
+// NormalizeTags trims the tags and drops the empty and repeated ones, keeping their order.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// HasTag reports whether tags contain the tag.
+func HasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeTags serializes the tags of an object for storage, using an empty string when there are none.
+func encodeTags(tags []string) (string, error) {
+	tags = NormalizeTags(tags)
+	if len(tags) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tags: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeTags reads the tags column of an object.
+func decodeTags(data, id string) ([]string, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(data), &tags); err != nil {
+		return nil, fmt.Errorf("failed to decode tags for %s: %w", id, err)
+	}
+	return tags, nil
+}
+
+// tagCondition returns the condition matching the rows whose tags column holds the tag of a filter, or
+// an empty string when the filter has no tag.
+func tagCondition(filter ListFilter, column string) (string, []interface{}) {
+	if filter.Tag == "" {
+		return "", nil
+	}
+	encoded, err := json.Marshal(filter.Tag)
+	if err != nil {
+		return "", nil
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return column + ` LIKE ? ESCAPE '\'`, []interface{}{`%` + escaper.Replace(string(encoded)) + `%`}
+}
+
+// GetTags returns the tags used by the objects of a kind, sorted.
+func (s *SQLStore) GetTags(kind string) ([]string, error) {
+	table, ok := taggedTables[kind]
+	if !ok {
+		return nil, fmt.Errorf("objects of kind %s have no tags", kind)
+	}
+	rows, err := s.db.Query(`SELECT id, tags FROM ` + table + ` WHERE tags <> ''`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var all []string
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan tags row: %w", err)
+		}
+		tags, err := decodeTags(data, id)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, tags...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	all = NormalizeTags(all)
+	sort.Strings(all)
+	return all, nil
+}
+
+// migrateTagsColumns adds the tags column to the tables of the objects that can be tagged.
+func (s *SQLStore) migrateTagsColumns() error {
+	for _, table := range []string{"channels", "routes", "transformations", "collectors"} {
+		rows, err := s.db.Query(s.db.dialect.tableInfoQuery(table))
+		if err != nil {
+			return fmt.Errorf("failed to read table_info for %s: %w", table, err)
+		}
+		hasTags := false
+		for rows.Next() {
+			var cid, notnull, pk int
+			var name, rtype string
+			var dfltValue interface{}
+			if err := rows.Scan(&cid, &name, &rtype, &notnull, &dfltValue, &pk); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan table_info for %s: %w", table, err)
+			}
+			if name == "tags" {
+				hasTags = true
+			}
+		}
+		rows.Close()
+		if hasTags {
+			continue
+		}
+
+		s.logger.Info("migrating '" + table + "' table: adding tags column...")
+		if _, err := s.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN tags TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("failed to add tags to %s table: %w", table, err)
+		}
+		s.logger.Info("'" + table + "' table migrated successfully (tags).")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const traceHopColumns = `id, trace_id, stage, route_id, source, destination, message_id, transformations, created_at`
+
+// CreateTraceHop stores a hop of a traced message.
+func (s *SQLStore) CreateTraceHop(hop *TraceHop) error {
+	transformations := ""
+	if len(hop.Transformations) > 0 {
+		data, err := json.Marshal(hop.Transformations)
+		if err != nil {
+			return fmt.Errorf("failed to encode trace hop transformations: %w", err)
+		}
+		transformations = string(data)
+	}
+	if hop.CreatedAt.IsZero() {
+		hop.CreatedAt = time.Now()
+	}
+	query := `INSERT INTO trace_hops (trace_id, stage, route_id, source, destination, message_id, transformations, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.db.insertID(query, hop.TraceID, hop.Stage, hop.RouteID, hop.Source, hop.Destination, hop.MessageID, transformations, hop.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create trace hop: %w", err)
+	}
+	hop.ID = id
+	return nil
+}
+
+// SearchTraceHops returns every hop of the traces matching term, which is either a trace ID or the
+// message ID of one of the hops, in the order they happened.
+func (s *SQLStore) SearchTraceHops(term string) ([]TraceHop, error) {
+	query := `SELECT ` + traceHopColumns + ` FROM trace_hops
+		WHERE trace_id = ? OR trace_id IN (SELECT trace_id FROM trace_hops WHERE message_id = ?)
+		ORDER BY created_at, id`
+	rows, err := s.db.Query(query, term, term)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search trace hops: %w", err)
+	}
+	defer rows.Close()
+
+	var hops []TraceHop
+	for rows.Next() {
+		hop, err := scanTraceHop(rows)
+		if err != nil {
+			return nil, err
+		}
+		hops = append(hops, *hop)
+	}
+	return hops, rows.Err()
+}
+
+// GetRecentTraces returns the most recently active traces, newest first.
+func (s *SQLStore) GetRecentTraces(limit int) ([]TraceSummary, error) {
+	query := `SELECT h.id, h.trace_id, h.stage, h.route_id, h.source, h.destination, h.message_id, h.transformations, h.created_at, t.hops
+		FROM trace_hops h
+		JOIN (SELECT MIN(id) AS first_id, MAX(id) AS last_id, COUNT(*) AS hops FROM trace_hops GROUP BY trace_id) t ON h.id = t.first_id
+		ORDER BY t.last_id DESC
+		LIMIT ?`
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent traces: %w", err)
+	}
+	defer rows.Close()
+
+	var traces []TraceSummary
+	for rows.Next() {
+		var trace TraceSummary
+		var transformations string
+		hop := &trace.FirstHop
+		if err := rows.Scan(&hop.ID, &hop.TraceID, &hop.Stage, &hop.RouteID, &hop.Source, &hop.Destination, &hop.MessageID, &transformations, &hop.CreatedAt, &trace.Hops); err != nil {
+			return nil, fmt.Errorf("failed to scan trace summary row: %w", err)
+		}
+		if err := decodeTransformations(hop, transformations); err != nil {
+			return nil, err
+		}
+		traces = append(traces, trace)
+	}
+	return traces, rows.Err()
+}
+
+// PruneTraceHops deletes the hops recorded before the given time and returns how many were deleted.
+func (s *SQLStore) PruneTraceHops(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM trace_hops WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune trace hops: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// scanTraceHop scans a row selected with traceHopColumns.
+func scanTraceHop(rows *sql.Rows) (*TraceHop, error) {
+	hop := &TraceHop{}
+	var transformations string
+	if err := rows.Scan(&hop.ID, &hop.TraceID, &hop.Stage, &hop.RouteID, &hop.Source, &hop.Destination, &hop.MessageID, &transformations, &hop.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan trace hop row: %w", err)
+	}
+	if err := decodeTransformations(hop, transformations); err != nil {
+		return nil, err
+	}
+	return hop, nil
+}
+
+// decodeTransformations fills the transformations of a hop from their stored JSON list.
+func decodeTransformations(hop *TraceHop, transformations string) error {
+	if transformations == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(transformations), &hop.Transformations); err != nil {
+		return fmt.Errorf("failed to decode trace hop transformations: %w", err)
+	}
+	return nil
+}
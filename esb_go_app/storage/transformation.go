@@ -2,13 +2,77 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 )
 
+// transformationColumns is the column list used by every query that loads full Transformation rows.
+const transformationColumns = `id, name, description, engine, script, tests, samples, tags, revision, created_at, updated_at`
+
+// scanTransformation scans a row selected with transformationColumns into a Transformation.
+func scanTransformation(row rowScanner) (*Transformation, error) {
+	t := &Transformation{}
+	var tests, samples, tags string
+	err := row.Scan(&t.ID, &t.Name, &t.Description, &t.Engine, &t.Script, &tests, &samples, &tags, &t.Revision, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if tests != "" {
+		if err := json.Unmarshal([]byte(tests), &t.Tests); err != nil {
+			return nil, fmt.Errorf("failed to decode tests for transformation %s: %w", t.ID, err)
+		}
+	}
+	if samples != "" {
+		if err := json.Unmarshal([]byte(samples), &t.Samples); err != nil {
+			return nil, fmt.Errorf("failed to decode samples for transformation %s: %w", t.ID, err)
+		}
+	}
+	if t.Tags, err = decodeTags(tags, t.ID); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// encodeTransformationExtras serializes the tests and samples of a transformation, using empty strings when there are none.
+func encodeTransformationExtras(t *Transformation) (string, string, error) {
+	var tests, samples string
+	if len(t.Tests) > 0 {
+		data, err := json.Marshal(t.Tests)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode transformation tests: %w", err)
+		}
+		tests = string(data)
+	}
+	if len(t.Samples) > 0 {
+		data, err := json.Marshal(t.Samples)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode transformation samples: %w", err)
+		}
+		samples = string(data)
+	}
+	return tests, samples, nil
+}
+
 // CreateTransformation creates a new transformation in the database.
-func (s *Store) CreateTransformation(t *Transformation) error {
-	query := `INSERT INTO transformations (id, name, engine, script) VALUES (?, ?, ?, ?)`
-	_, err := s.db.Exec(query, t.ID, t.Name, t.Engine, t.Script)
+func (s *SQLStore) CreateTransformation(t *Transformation) error {
+	return insertTransformation(s.db, t)
+}
+
+// insertTransformation inserts a transformation on the database or within a transaction.
+func insertTransformation(e execer, t *Transformation) error {
+	if err := ValidateTransformation(t); err != nil {
+		return err
+	}
+	tests, samples, err := encodeTransformationExtras(t)
+	if err != nil {
+		return err
+	}
+	tags, err := encodeTags(t.Tags)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO transformations (id, name, description, engine, script, tests, samples, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = e.Exec(query, t.ID, t.Name, t.Description, t.Engine, t.Script, tests, samples, tags)
 	if err != nil {
 		return fmt.Errorf("failed to create transformation: %w", err)
 	}
@@ -16,12 +80,9 @@ func (s *Store) CreateTransformation(t *Transformation) error {
 }
 
 // GetTransformationByID retrieves a transformation by its ID.
-func (s *Store) GetTransformationByID(id string) (*Transformation, error) {
-	query := `SELECT id, name, engine, script, created_at, updated_at FROM transformations WHERE id = ?`
-	row := s.db.QueryRow(query, id)
-
-	t := &Transformation{}
-	err := row.Scan(&t.ID, &t.Name, &t.Engine, &t.Script, &t.CreatedAt, &t.UpdatedAt)
+func (s *SQLStore) GetTransformationByID(id string) (*Transformation, error) {
+	query := `SELECT ` + transformationColumns + ` FROM transformations WHERE id = ?`
+	t, err := scanTransformation(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -32,12 +93,9 @@ func (s *Store) GetTransformationByID(id string) (*Transformation, error) {
 }
 
 // GetTransformationByName retrieves a transformation by its name.
-func (s *Store) GetTransformationByName(name string) (*Transformation, error) {
-	query := `SELECT id, name, engine, script, created_at, updated_at FROM transformations WHERE name = ?`
-	row := s.db.QueryRow(query, name)
-
-	t := &Transformation{}
-	err := row.Scan(&t.ID, &t.Name, &t.Engine, &t.Script, &t.CreatedAt, &t.UpdatedAt)
+func (s *SQLStore) GetTransformationByName(name string) (*Transformation, error) {
+	query := `SELECT ` + transformationColumns + ` FROM transformations WHERE name = ?`
+	t, err := scanTransformation(s.db.QueryRow(query, name))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -48,8 +106,8 @@ func (s *Store) GetTransformationByName(name string) (*Transformation, error) {
 }
 
 // GetAllTransformations retrieves all transformations from the database.
-func (s *Store) GetAllTransformations() ([]Transformation, error) {
-	query := `SELECT id, name, engine, script, created_at, updated_at FROM transformations ORDER BY created_at DESC`
+func (s *SQLStore) GetAllTransformations() ([]Transformation, error) {
+	query := `SELECT ` + transformationColumns + ` FROM transformations ORDER BY created_at DESC`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all transformations: %w", err)
@@ -58,31 +116,120 @@ func (s *Store) GetAllTransformations() ([]Transformation, error) {
 
 	var transformations []Transformation
 	for rows.Next() {
-		var t Transformation
-		if err := rows.Scan(&t.ID, &t.Name, &t.Engine, &t.Script, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		t, err := scanTransformation(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan transformation row: %w", err)
 		}
-		transformations = append(transformations, t)
+		transformations = append(transformations, *t)
 	}
 	return transformations, nil
 }
 
-// UpdateTransformation updates an existing transformation in the database.
-func (s *Store) UpdateTransformation(t *Transformation) error {
-	query := `UPDATE transformations SET name = ?, engine = ?, script = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := s.db.Exec(query, t.Name, t.Engine, t.Script, t.ID)
+// UpdateTransformation updates an existing transformation in the database. The script and settings it
+// replaces are kept as a new version of the transformation.
+func (s *SQLStore) UpdateTransformation(t *Transformation) error {
+	if err := ValidateTransformation(t); err != nil {
+		return err
+	}
+	tests, samples, err := encodeTransformationExtras(t)
+	if err != nil {
+		return err
+	}
+	tags, err := encodeTags(t.Tags)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transformation update: %w", err)
+	}
+	defer tx.Rollback()
+	if err := snapshotTransformation(tx, t.ID); err != nil {
+		return err
+	}
+
+	query := `UPDATE transformations SET name = ?, description = ?, engine = ?, script = ?, tests = ?, samples = ?, tags = ?, revision = revision + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?` + revisionCondition
+	res, err := tx.Exec(query, t.Name, t.Description, t.Engine, t.Script, tests, samples, tags, t.ID, t.Revision, t.Revision)
 	if err != nil {
 		return fmt.Errorf("failed to update transformation: %w", err)
 	}
+	if err := checkRevision(res, &t.Revision); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transformation update: %w", err)
+	}
 	return nil
 }
 
-// DeleteTransformation deletes a transformation by its ID.
-func (s *Store) DeleteTransformation(id string) error {
+// DeleteTransformation moves a transformation to the trash. Its executions, versions and script state are
+// kept until it is purged from the trash, so a restored transformation gets them back. Routes running it
+// first are disabled, and it is removed from the pipelines of the others. It returns the routes it changed,
+// so that their routers can be stopped or restarted.
+func (s *SQLStore) DeleteTransformation(id string) ([]RouteDependent, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transformation deletion: %w", err)
+	}
+	defer tx.Rollback()
+	t, err := scanTransformation(tx.QueryRow(`SELECT `+transformationColumns+` FROM transformations WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transformation before deletion: %w", err)
+	}
+	dependents, released, err := releaseTransformation(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := moveToTrash(tx, TrashTransformation, t.ID, t.Name, t, released); err != nil {
+		return nil, err
+	}
+
 	query := `DELETE FROM transformations WHERE id = ?`
-	_, err := s.db.Exec(query, id)
+	if _, err := tx.Exec(query, id); err != nil {
+		return nil, fmt.Errorf("failed to delete transformation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transformation deletion: %w", err)
+	}
+	return routeDependents(dependents), nil
+}
+
+// releaseTransformation removes the references to a transformation from the routes using it within a
+// transaction: the routes running it first are disabled and it is dropped from the pipelines. It returns
+// what it removed from each route, to be kept in the trash item of the transformation.
+func releaseTransformation(tx *dbTx, id string) ([]dependentRoute, []ReleasedRoute, error) {
+	dependents, err := transformationDependents(tx, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete transformation: %w", err)
+		return nil, nil, err
 	}
-	return nil
+	var released []ReleasedRoute
+	for _, d := range dependents {
+		r := ReleasedRoute{RouteID: d.RouteID, Usages: d.Usages, Disabled: d.Action == DependentDisabled && !d.WasDisabled}
+		for i, step := range d.route.Pipeline {
+			if step == id {
+				r.PipelineSteps = append(r.PipelineSteps, i)
+			}
+		}
+		released = append(released, r)
+	}
+
+	err = releaseDependents(tx, dependents, func(route *Route) {
+		if route.TransformationID != nil && *route.TransformationID == id {
+			route.TransformationID = nil
+		}
+		var pipeline []string
+		for _, step := range route.Pipeline {
+			if step != id {
+				pipeline = append(pipeline, step)
+			}
+		}
+		route.Pipeline = pipeline
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return dependents, released, nil
 }
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// MaxTransformationVersions is how many previous versions are kept per transformation; older ones are deleted.
+const MaxTransformationVersions = 50
+
+// snapshotTransformation stores the current script and settings of a transformation as its next version,
+// within the transaction that is about to update it.
+func snapshotTransformation(tx *dbTx, transformationID string) error {
+	previous, err := scanTransformation(tx.QueryRow(`SELECT `+transformationColumns+` FROM transformations WHERE id = ?`, transformationID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil // Nothing to keep; the update does not change any row either
+		}
+		return fmt.Errorf("failed to read transformation for its version history: %w", err)
+	}
+	snapshot, err := json.Marshal(previous)
+	if err != nil {
+		return fmt.Errorf("failed to encode transformation version: %w", err)
+	}
+
+	query := `INSERT INTO transformation_versions (transformation_id, version, snapshot)
+		VALUES (?, (SELECT COALESCE(MAX(version), 0) + 1 FROM transformation_versions WHERE transformation_id = ?), ?)`
+	if _, err := tx.Exec(query, transformationID, transformationID, string(snapshot)); err != nil {
+		return fmt.Errorf("failed to store transformation version: %w", err)
+	}
+	query = `DELETE FROM transformation_versions WHERE transformation_id = ? AND version <= (SELECT MAX(version) FROM transformation_versions WHERE transformation_id = ?) - ?`
+	if _, err := tx.Exec(query, transformationID, transformationID, MaxTransformationVersions); err != nil {
+		return fmt.Errorf("failed to prune transformation versions: %w", err)
+	}
+	return nil
+}
+
+// GetTransformationVersions returns the stored versions of a transformation, newest first.
+func (s *SQLStore) GetTransformationVersions(transformationID string) ([]TransformationVersion, error) {
+	rows, err := s.db.Query(`SELECT id, transformation_id, version, snapshot, created_at FROM transformation_versions WHERE transformation_id = ? ORDER BY version DESC`, transformationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transformation versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []TransformationVersion
+	for rows.Next() {
+		v, err := scanTransformationVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// GetTransformationVersion returns a stored version of a transformation by its ID.
+func (s *SQLStore) GetTransformationVersion(transformationID string, id int64) (*TransformationVersion, error) {
+	row := s.db.QueryRow(`SELECT id, transformation_id, version, snapshot, created_at FROM transformation_versions WHERE transformation_id = ? AND id = ?`, transformationID, id)
+	v, err := scanTransformationVersion(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// deleteTransformationVersions deletes the version history of a transformation.
+func (s *SQLStore) deleteTransformationVersions(transformationID string) error {
+	if _, err := s.db.Exec(`DELETE FROM transformation_versions WHERE transformation_id = ?`, transformationID); err != nil {
+		return fmt.Errorf("failed to delete transformation versions: %w", err)
+	}
+	return nil
+}
+
+// scanTransformationVersion scans a transformation version row and decodes its snapshot.
+func scanTransformationVersion(row rowScanner) (*TransformationVersion, error) {
+	v := &TransformationVersion{}
+	var snapshot string
+	if err := row.Scan(&v.ID, &v.TransformationID, &v.Version, &snapshot, &v.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan transformation version row: %w", err)
+	}
+	if err := json.Unmarshal([]byte(snapshot), &v.Transformation); err != nil {
+		return nil, fmt.Errorf("failed to decode transformation version %d: %w", v.Version, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// trashColumns are the columns scanned by scanTrashItem.
+const trashColumns = `id, kind, entity_id, name, snapshot, released, deleted_at`
+
+// moveToTrash keeps a snapshot of an object that is deleted within the same transaction, with the
+// references its deletion removed from the routes it kept.
+func moveToTrash(tx *dbTx, kind, entityID, name string, entity interface{}, released []ReleasedRoute) error {
+	snapshot, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to encode deleted %s: %w", kind, err)
+	}
+	var releasedJSON []byte
+	if len(released) > 0 {
+		if releasedJSON, err = json.Marshal(released); err != nil {
+			return fmt.Errorf("failed to encode references of deleted %s: %w", kind, err)
+		}
+	}
+	query := `INSERT INTO trash (kind, entity_id, name, snapshot, released) VALUES (?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(query, kind, entityID, name, string(snapshot), string(releasedJSON)); err != nil {
+		return fmt.Errorf("failed to move %s to trash: %w", kind, err)
+	}
+	return nil
+}
+
+// GetTrash returns the deleted objects kept in the trash, most recently deleted first.
+func (s *SQLStore) GetTrash() ([]TrashItem, error) {
+	rows, err := s.db.Query(`SELECT ` + trashColumns + ` FROM trash ORDER BY deleted_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trash: %w", err)
+	}
+	defer rows.Close()
+
+	var items []TrashItem
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+// GetTrashItem returns a deleted object of the trash by its ID, or nil if there is none.
+func (s *SQLStore) GetTrashItem(id int64) (*TrashItem, error) {
+	item, err := scanTrashItem(s.db.QueryRow(`SELECT `+trashColumns+` FROM trash WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+// RestoreTrashItem recreates a deleted object with its ID and removes it from the trash, in a single
+// transaction. The references the deletion of a channel or a transformation removed are put back on the
+// routes that still exist and have not been given another one since, and the routes it disabled are
+// enabled again; it returns those routes, so that their routers can be restarted. It fails, leaving the
+// trash as it is, when an object with the same ID or unique name was created in the meantime.
+func (s *SQLStore) RestoreTrashItem(item *TrashItem) ([]RouteDependent, error) {
+	if item.Kind == TrashChannel {
+		if err := s.ValidateChannel(item.Channel); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", item.Kind, err)
+		}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin restore of %s: %w", item.Kind, err)
+	}
+	defer tx.Rollback()
+
+	switch item.Kind {
+	case TrashRoute:
+		if err = insertRoute(tx, item.Route); err == nil {
+			_, err = tx.Exec(`UPDATE routes SET created_at = ? WHERE id = ?`, item.Route.CreatedAt, item.EntityID)
+		}
+	case TrashTransformation:
+		if err = insertTransformation(tx, item.Transformation); err == nil {
+			_, err = tx.Exec(`UPDATE transformations SET created_at = ?, updated_at = ? WHERE id = ?`, item.Transformation.CreatedAt, item.Transformation.UpdatedAt, item.EntityID)
+		}
+	case TrashChannel:
+		if err = insertChannel(tx, item.Channel); err == nil {
+			_, err = tx.Exec(`UPDATE channels SET created_at = ? WHERE id = ?`, item.Channel.CreatedAt, item.EntityID)
+		}
+	default:
+		return nil, fmt.Errorf("unknown trash item kind %q", item.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore %s: %w", item.Kind, err)
+	}
+	if item.Kind == TrashRoute {
+		if err := deleteRouteStats(tx, item.EntityID); err != nil {
+			return nil, err
+		}
+	}
+	relinked, err := relinkRoutes(tx, item)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM trash WHERE id = ?`, item.ID); err != nil {
+		return nil, fmt.Errorf("failed to remove restored %s from trash: %w", item.Kind, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit restore of %s: %w", item.Kind, err)
+	}
+	return relinked, nil
+}
+
+// relinkRoutes puts the references of the released routes of a restored channel or transformation back
+// within the restore's transaction. A route that was deleted since is skipped, and a reference the route
+// was given another value for is left as it is; the routing rules are restored in any case, as they
+// come back with a route restored from the trash later.
+func relinkRoutes(tx *dbTx, item *TrashItem) ([]RouteDependent, error) {
+	var relinked []RouteDependent
+	for _, released := range item.Released {
+		for _, rule := range released.RoutingRules {
+			query := `INSERT INTO routing_rules (id, route_id, position, field, operator, value, destination_channel_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+			if _, err := tx.Exec(query, rule.ID, rule.RouteID, rule.Position, rule.Field, rule.Operator, rule.Value, rule.DestinationChannelID, rule.CreatedAt); err != nil {
+				return nil, fmt.Errorf("failed to restore routing rule %s: %w", rule.ID, err)
+			}
+		}
+
+		route, err := scanRoute(tx.QueryRow(`SELECT `+routeColumns+` FROM routes WHERE id = ?`, released.RouteID))
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read route %s to restore its references: %w", released.RouteID, err)
+		}
+		changed := len(released.RoutingRules) > 0
+		enable := false
+		id := item.EntityID
+		for _, usage := range released.Usages {
+			switch usage {
+			case UsageDestination:
+				if route.DestinationChannelID == nil {
+					route.DestinationChannelID = &id
+					changed, enable = true, true
+				}
+			case UsageWiretap:
+				if route.WiretapChannelID == "" {
+					route.WiretapChannelID = id
+					changed = true
+				}
+			case UsageSample:
+				if route.SampleChannelID == "" {
+					route.SampleChannelID, route.SampleRate = id, released.SampleRate
+					changed = true
+				}
+			case UsageTransformation:
+				if route.TransformationID == nil {
+					route.TransformationID = &id
+					changed, enable = true, true
+				}
+			case UsagePipeline:
+				if !slices.Contains(route.Pipeline, id) {
+					for _, step := range released.PipelineSteps {
+						step = min(step, len(route.Pipeline))
+						route.Pipeline = slices.Insert(route.Pipeline, step, id)
+					}
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		if enable && released.Disabled {
+			route.Disabled = false
+		}
+		if err := updateRoute(tx, route); err != nil {
+			return nil, err
+		}
+		relinked = append(relinked, RouteDependent{
+			RouteID: route.ID, RouteName: route.Name, SourceChannelID: route.SourceChannelID, WasDisabled: route.Disabled,
+			Usages: released.Usages, Action: DependentUpdated,
+		})
+	}
+	return relinked, nil
+}
+
+// PurgeTrashItem deletes an object of the trash for good, together with the data that was kept so that
+// it could be restored, such as the version history and script state of a transformation.
+func (s *SQLStore) PurgeTrashItem(item *TrashItem) error {
+	if item.Kind == TrashTransformation {
+		if err := s.deleteScriptExecutions(item.EntityID); err != nil {
+			return err
+		}
+		if err := s.deleteTransformationVersions(item.EntityID); err != nil {
+			return err
+		}
+		if err := s.deleteScriptStateNamespace(TransformationStateNamespace(item.EntityID)); err != nil {
+			return err
+		}
+	}
+	if _, err := s.db.Exec(`DELETE FROM trash WHERE id = ?`, item.ID); err != nil {
+		return fmt.Errorf("failed to delete %s from trash: %w", item.Kind, err)
+	}
+	return nil
+}
+
+// PruneTrash purges the objects deleted before the given time and returns how many were purged.
+func (s *SQLStore) PruneTrash(before time.Time) (int64, error) {
+	items, err := s.GetTrash()
+	if err != nil {
+		return 0, err
+	}
+	var purged int64
+	for i := range items {
+		if !items[i].DeletedAt.Before(before) {
+			continue
+		}
+		if err := s.PurgeTrashItem(&items[i]); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// scanTrashItem scans a trash row and decodes its snapshot into the field of its kind.
+func scanTrashItem(row rowScanner) (*TrashItem, error) {
+	item := &TrashItem{}
+	var snapshot, released string
+	if err := row.Scan(&item.ID, &item.Kind, &item.EntityID, &item.Name, &snapshot, &released, &item.DeletedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan trash row: %w", err)
+	}
+	var target interface{}
+	switch item.Kind {
+	case TrashRoute:
+		item.Route = &Route{}
+		target = item.Route
+	case TrashTransformation:
+		item.Transformation = &Transformation{}
+		target = item.Transformation
+	case TrashChannel:
+		item.Channel = &Channel{}
+		target = item.Channel
+	default:
+		return nil, fmt.Errorf("unknown kind %q of trash item %d", item.Kind, item.ID)
+	}
+	if err := json.Unmarshal([]byte(snapshot), target); err != nil {
+		return nil, fmt.Errorf("failed to decode trash item %d: %w", item.ID, err)
+	}
+	if released != "" {
+		if err := json.Unmarshal([]byte(released), &item.Released); err != nil {
+			return nil, fmt.Errorf("failed to decode references of trash item %d: %w", item.ID, err)
+		}
+	}
+	return item, nil
+}
+
+// migrateTrashTable adds the released column to a trash created before it. The objects deleted before
+// are restored without the references their deletion removed, as none were kept.
+func (s *SQLStore) migrateTrashTable() error {
+	rows, err := s.db.Query(s.db.dialect.tableInfoQuery("trash"))
+	if err != nil {
+		return fmt.Errorf("failed to read table_info for trash: %w", err)
+	}
+	hasReleased := false
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, rtype string
+		var dfltValue interface{}
+		if err := rows.Scan(&cid, &name, &rtype, &notnull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan table_info for trash: %w", err)
+		}
+		if name == "released" {
+			hasReleased = true
+		}
+	}
+	rows.Close()
+	if hasReleased {
+		return nil
+	}
+
+	s.logger.Info("migrating 'trash' table: adding released column...")
+	if _, err := s.db.Exec(`ALTER TABLE trash ADD COLUMN released TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("failed to add released to trash table: %w", err)
+	}
+	s.logger.Info("'trash' table migrated successfully (released).")
+	return nil
+}
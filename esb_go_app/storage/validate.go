@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Allowed values of the enumerated fields of the stored objects.
+var (
+	ChannelDirections     = []string{"inbound", "outbound"}
+	TransformationEngines = []string{"javascript", "starlark", "cel"}
+	CollectorEngines      = []string{"javascript", "starlark"}
+)
+
+// maxDestinationLength keeps the durable queue and exchange names derived from a destination within the
+// 255 bytes RabbitMQ allows.
+const maxDestinationLength = 200
+
+// destinationPattern is the set of characters a destination may use, so the queue and exchange names are
+// valid on every broker and readable in the management UI.
+var destinationPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// defaultConnection is the broker connection of the channels whose connection is empty, as named by the
+// rabbitmq package.
+const defaultConnection = "default"
+
+// FieldError is an invalid value of an object, named after the form field it is edited in. The message is
+// a format string, translated with its arguments by the admin interface.
+type FieldError struct {
+	Field   string
+	Message string
+	Args    []interface{}
+}
+
+// ValidationError is returned by the writes of objects with invalid values, listing every invalid field.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Field+": "+fmt.Sprintf(f.Message, f.Args...))
+	}
+	return "invalid values: " + strings.Join(messages, "; ")
+}
+
+// add records an invalid field.
+func (e *ValidationError) add(field, message string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message, Args: args})
+}
+
+// err returns the validation error, or nil when no field is invalid.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ValidateChannel checks the fields of a channel before it is created or updated. A destination must
+// not be used by another channel of the same connection and vhost, unless the channel already shared it.
+func (s *SQLStore) ValidateChannel(ch *Channel) error {
+	v := &ValidationError{}
+	if strings.TrimSpace(ch.Name) == "" {
+		v.add("name", "The name is required.")
+	}
+	if !slices.Contains(ChannelDirections, ch.Direction) {
+		v.add("direction", "The direction must be inbound or outbound.")
+	}
+	switch {
+	case ch.Destination == "":
+		v.add("destination", "The destination is required.")
+	case len(ch.Destination) > maxDestinationLength:
+		v.add("destination", "The destination must not be longer than %d characters.", maxDestinationLength)
+	case !destinationPattern.MatchString(ch.Destination):
+		v.add("destination", "The destination may only contain letters, digits, dots, dashes, underscores and colons.")
+	default:
+		other, err := s.destinationConflict(ch)
+		if err != nil {
+			return err
+		}
+		if other != nil {
+			v.add("destination", "The destination %s is already used by channel %s.", ch.Destination, other.Name)
+		}
+	}
+	return v.err()
+}
+
+// destinationConflict returns another channel using the destination of ch on the same connection and
+// vhost, or nil if there is none. A channel keeping the destination it is stored with has no conflict, so
+// channels sharing a destination from before the rule can still be edited.
+func (s *SQLStore) destinationConflict(ch *Channel) (*Channel, error) {
+	stored, err := s.GetChannelByID(ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil && stored.Destination == ch.Destination && sameConnectionName(stored.Connection, ch.Connection) {
+		return nil, nil
+	}
+
+	var vhost string
+	if err := s.db.QueryRow(`SELECT COALESCE((SELECT vhost FROM applications WHERE id = ?), '')`, ch.ApplicationID).Scan(&vhost); err != nil {
+		return nil, fmt.Errorf("failed to get vhost of application %s: %w", ch.ApplicationID, err)
+	}
+	rows, err := s.db.Query(`SELECT `+channelColumns+` FROM channels WHERE destination = ? AND id <> ?`, ch.Destination, ch.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check destination of channel: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		other, err := scanChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel row: %w", err)
+		}
+		if sameConnectionName(other.Connection, ch.Connection) && other.VHost == vhost {
+			return other, nil
+		}
+	}
+	return nil, rows.Err()
+}
+
+// sameConnectionName reports whether two connection names refer to the same broker connection.
+func sameConnectionName(a, b string) bool {
+	if a == "" {
+		a = defaultConnection
+	}
+	if b == "" {
+		b = defaultConnection
+	}
+	return a == b
+}
+
+// ValidateCollector checks the fields of a collector before it is created or updated.
+func ValidateCollector(c *Collector) error {
+	v := &ValidationError{}
+	if strings.TrimSpace(c.Name) == "" {
+		v.add("name", "The name is required.")
+	}
+	if strings.TrimSpace(c.Schedule) == "" {
+		v.add("schedule", "The schedule is required.")
+	} else if _, err := cron.ParseStandard(c.Schedule); err != nil {
+		v.add("schedule", "The schedule is not a valid cron expression: %s", err.Error())
+	}
+	if !slices.Contains(CollectorEngines, c.Engine) {
+		v.add("engine", "Unsupported scripting engine: %s", c.Engine)
+	}
+	if strings.TrimSpace(c.Script) == "" {
+		v.add("script", "The script is required.")
+	}
+	return v.err()
+}
+
+// ValidateTransformation checks the fields of a transformation before it is created or updated.
+func ValidateTransformation(t *Transformation) error {
+	v := &ValidationError{}
+	if strings.TrimSpace(t.Name) == "" {
+		v.add("name", "The name is required.")
+	}
+	if !slices.Contains(TransformationEngines, t.Engine) {
+		v.add("engine", "Unsupported scripting engine: %s", t.Engine)
+	}
+	if strings.TrimSpace(t.Script) == "" {
+		v.add("script", "The script is required.")
+	}
+	return v.err()
+}